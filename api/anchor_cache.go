@@ -0,0 +1,132 @@
+// Copyright 2019 The trust-net Authors
+// Cache of issued anchors, for idempotent anchor requests
+
+package api
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sync"
+	"time"
+)
+
+// cache of anchor responses issued within AnchorTTL, keyed by (submitter, seq, lastTx),
+// so that a retried anchor request gets same anchor instead of minting new shard parents
+type AnchorCache struct {
+	lock    sync.Mutex
+	entries map[string]*AnchorResponse
+	// outstanding batch of pre-fetched anchors for each submitter
+	batches map[string]*anchorBatch
+}
+
+// pre-fetched anchors of a batch request, trimmed as they are consumed
+type anchorBatch struct {
+	key     string
+	anchors []*AnchorResponse
+}
+
+func NewAnchorCache() *AnchorCache {
+	return &AnchorCache{
+		entries: make(map[string]*AnchorResponse),
+		batches: make(map[string]*anchorBatch),
+	}
+}
+
+func anchorCacheKey(req *AnchorRequest) string {
+	lastTx := req.LastTxId()
+	return anchorKey(req.Submitter(), req.SubmitterSeq, lastTx[:])
+}
+
+func anchorKey(submitter []byte, seq uint64, lastTx []byte) string {
+	return fmt.Sprintf("%x:%d:%x", submitter, seq, lastTx)
+}
+
+// get a previously issued unexpired anchor for the request, or issue a new anchor, returns nil if issue fails
+func (c *AnchorCache) Issue(req *AnchorRequest, issue func() *dto.Anchor) *AnchorResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evict()
+	key := anchorCacheKey(req)
+	if res, found := c.entries[key]; found {
+		return res
+	}
+	a := issue()
+	if a == nil {
+		return nil
+	}
+	res := NewAnchorResponse(a, req)
+	c.entries[key] = res
+	return res
+}
+
+// get previously issued unexpired anchors for a repeated batch request, or issue a new batch of sequential
+// anchors, invalidating any unused anchors of submitter's earlier batch, returns nil if issue fails
+func (c *AnchorCache) IssueBatch(req *AnchorBatchRequest, issue func(seq uint64, lastTx [64]byte) *dto.Anchor) []*AnchorResponse {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.evict()
+	submitter, key := fmt.Sprintf("%x", req.Submitter()), fmt.Sprintf("%s:%d", anchorCacheKey(&req.AnchorRequest), req.Count)
+	if batch, found := c.batches[submitter]; found && batch.key == key {
+		return batch.anchors
+	}
+	// a new batch supersedes any earlier batch of the submitter
+	delete(c.batches, submitter)
+	batch := &anchorBatch{key: key}
+	for i := 0; i < req.Count; i++ {
+		// last transaction is known only for first anchor of the batch
+		seqReq := &AnchorRequest{
+			SubmitterId:  req.SubmitterId,
+			SubmitterSeq: req.SubmitterSeq + uint64(i),
+			submitterId:  req.submitterId,
+		}
+		if i == 0 {
+			seqReq.LastTx, seqReq.lastTx = req.LastTx, req.lastTx
+		}
+		a := issue(seqReq.SubmitterSeq, seqReq.lastTx)
+		if a == nil {
+			return nil
+		}
+		batch.anchors = append(batch.anchors, NewAnchorResponse(a, seqReq))
+	}
+	c.batches[submitter] = batch
+	return batch.anchors
+}
+
+// mark pre-fetched anchors of a submitter up to (and including) a sequence as consumed by submitted transactions
+func (c *AnchorCache) Consume(submitter []byte, seq uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	id := fmt.Sprintf("%x", submitter)
+	if batch, found := c.batches[id]; found {
+		for len(batch.anchors) > 0 && batch.anchors[0].Request.SubmitterSeq <= seq {
+			batch.anchors = batch.anchors[1:]
+		}
+		if len(batch.anchors) == 0 {
+			delete(c.batches, id)
+		}
+	}
+}
+
+// drop anchors issued for a submitter's transaction that was rejected for a stale anchor, along with
+// submitter's pre-fetched batch, so that a re-anchor request gets a fresh anchor
+func (c *AnchorCache) Stale(submitter []byte, seq uint64, lastTx [64]byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, anchorKey(submitter, seq, lastTx[:]))
+	delete(c.batches, fmt.Sprintf("%x", submitter))
+}
+
+// remove expired anchors and batches
+func (c *AnchorCache) evict() {
+	now := time.Now().Unix()
+	for key, res := range c.entries {
+		if now > res.ExpiresAt {
+			delete(c.entries, key)
+		}
+	}
+	for key, batch := range c.batches {
+		if len(batch.anchors) == 0 || now > batch.anchors[0].ExpiresAt {
+			delete(c.batches, key)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+	"time"
+)
+
+func TestAnchorCache_Idempotent(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter"), lastTx: dto.RandomHash()}
+	calls := 0
+	issue := func() *dto.Anchor {
+		calls += 1
+		a := dto.TestAnchor()
+		a.ShardParent = dto.RandomHash()
+		return a
+	}
+	first := c.Issue(req, issue)
+	second := c.Issue(&AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter"), lastTx: req.lastTx}, issue)
+	if calls != 1 || first != second {
+		t.Errorf("repeated request should return same anchor, issued: %d", calls)
+	}
+	// different sequence should get a new anchor
+	if third := c.Issue(&AnchorRequest{SubmitterSeq: 2, submitterId: []byte("submitter"), lastTx: req.lastTx}, issue); calls != 2 || third == first {
+		t.Errorf("new request should issue new anchor, issued: %d", calls)
+	}
+}
+
+func TestAnchorCache_Expired(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter"), lastTx: dto.RandomHash()}
+	calls := 0
+	issue := func() *dto.Anchor {
+		calls += 1
+		return dto.TestAnchor()
+	}
+	c.Issue(req, issue).ExpiresAt = time.Now().Add(-time.Second).Unix()
+	c.Issue(req, issue)
+	if calls != 2 {
+		t.Errorf("expired anchor should be re-issued, issued: %d", calls)
+	}
+}
+
+func TestAnchorCache_Stale(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter"), lastTx: dto.RandomHash()}
+	calls := 0
+	issue := func() *dto.Anchor {
+		calls += 1
+		return dto.TestAnchor()
+	}
+	c.Issue(req, issue)
+	c.Stale([]byte("submitter"), 1, req.lastTx)
+	c.Issue(req, issue)
+	if calls != 2 {
+		t.Errorf("stale anchor should be re-issued, issued: %d", calls)
+	}
+}
+
+func TestAnchorCache_IssueFailed(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter")}
+	if res := c.Issue(req, func() *dto.Anchor { return nil }); res != nil || len(c.entries) != 0 {
+		t.Errorf("failed issue should not be cached")
+	}
+}
+
+func TestAnchorCache_IssueBatch(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorBatchRequest{
+		AnchorRequest: AnchorRequest{SubmitterSeq: 5, submitterId: []byte("submitter"), LastTx: "last", lastTx: dto.RandomHash()},
+		Count:         3,
+	}
+	seqs := []uint64{}
+	issue := func(seq uint64, lastTx [64]byte) *dto.Anchor {
+		if seq == req.SubmitterSeq && lastTx != req.lastTx {
+			t.Errorf("first anchor should use request's last tx")
+		}
+		seqs = append(seqs, seq)
+		return dto.TestAnchor()
+	}
+	res := c.IssueBatch(req, issue)
+	if len(res) != 3 || len(seqs) != 3 || seqs[0] != 5 || seqs[2] != 7 {
+		t.Errorf("incorrect batch issued: %v", seqs)
+		return
+	}
+	if res[1].Request.SubmitterSeq != 6 || len(res[1].Request.LastTx) != 0 {
+		t.Errorf("incorrect request echo: %v", res[1].Request)
+	}
+	// repeated batch request should get same anchors
+	if again := c.IssueBatch(req, issue); len(seqs) != 3 || again[0] != res[0] {
+		t.Errorf("repeated batch request should not issue new anchors")
+	}
+}
+
+func TestAnchorCache_BatchConsumeAndInvalidate(t *testing.T) {
+	c := NewAnchorCache()
+	req := &AnchorBatchRequest{
+		AnchorRequest: AnchorRequest{SubmitterSeq: 1, submitterId: []byte("submitter"), lastTx: dto.RandomHash()},
+		Count:         4,
+	}
+	issued := 0
+	issue := func(seq uint64, lastTx [64]byte) *dto.Anchor {
+		issued += 1
+		return dto.TestAnchor()
+	}
+	c.IssueBatch(req, issue)
+	c.Consume([]byte("submitter"), 2)
+	if batch := c.batches[fmt.Sprintf("%x", "submitter")]; batch == nil || len(batch.anchors) != 2 || batch.anchors[0].Request.SubmitterSeq != 3 {
+		t.Errorf("consumed anchors not trimmed from batch")
+	}
+	// a new batch should invalidate unused anchors of earlier batch
+	next := &AnchorBatchRequest{
+		AnchorRequest: AnchorRequest{SubmitterSeq: 3, submitterId: []byte("submitter"), lastTx: dto.RandomHash()},
+		Count:         2,
+	}
+	if res := c.IssueBatch(next, issue); issued != 6 || len(res) != 2 {
+		t.Errorf("new batch should issue new anchors, issued: %d", issued)
+	}
+	c.Consume([]byte("submitter"), 4)
+	if len(c.batches) != 0 {
+		t.Errorf("fully consumed batch should be removed")
+	}
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 The trust-net Authors
+// Submitter side cache of anchors, refreshed in background, so that apps submit transactions without handling anchors
+
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// a cached anchor is refreshed when it expires within this duration
+var AnchorRefreshMargin = 30 * time.Second
+
+// interval at which background refresh checks the cached anchor
+var AnchorRefreshInterval = 5 * time.Second
+
+// max number of resubmissions of a transaction rejected for a stale anchor
+var AnchorClientRetries = 3
+
+// client of a node's anchor and transaction endpoints for a submitter, with a local cache of the anchor for
+// submitter's next transaction. Cached anchor is refreshed in background before it expires, and a submission
+// rejected for a stale anchor is re-anchored and resubmitted transparently
+type AnchorClient struct {
+	// base URL of node's API, e.g. "http://localhost:8080"
+	url    string
+	client *http.Client
+	// API key of client, if node requires one
+	apiKey string
+	// submitter's next sequence and last transaction, and anchor issued for them
+	req    AnchorRequest
+	cached *AnchorResponse
+	stop   chan struct{}
+	lock   sync.Mutex
+	logger log.Logger
+}
+
+// create a client for a submitter's next transaction (seq) after its last transaction
+func NewAnchorClient(url string, submitterId []byte, seq uint64, lastTx [64]byte) *AnchorClient {
+	return &AnchorClient{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+		req: AnchorRequest{
+			SubmitterId:  hex.EncodeToString(submitterId),
+			SubmitterSeq: seq,
+			LastTx:       hex.EncodeToString(lastTx[:]),
+			submitterId:  submitterId,
+			lastTx:       lastTx,
+		},
+		logger: log.NewLogger("Anchor Client"),
+	}
+}
+
+// set API key sent with requests to node
+func (c *AnchorClient) SetApiKey(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.apiKey = key
+}
+
+// start refreshing cached anchor in background, until client is stopped
+func (c *AnchorClient) Start() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	go c.refresher(c.stop)
+}
+
+// stop background refresh of cached anchor
+func (c *AnchorClient) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+func (c *AnchorClient) refresher(stop chan struct{}) {
+	ticker := time.NewTicker(AnchorRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := c.Anchor(); err != nil {
+			c.logger.Debug("Failed to refresh anchor: %s", err)
+		}
+	}
+}
+
+// get anchor for submitter's next transaction, from cache unless it is missing or about to expire
+func (c *AnchorClient) Anchor() (*AnchorResponse, error) {
+	c.lock.Lock()
+	req, cached, apiKey := c.req, c.cached, c.apiKey
+	c.lock.Unlock()
+	if cached != nil && time.Now().Add(AnchorRefreshMargin).Unix() <= cached.ExpiresAt {
+		return cached, nil
+	}
+	res, err := c.fetch(&req, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// cache only if submitter did not move on to its next transaction while anchor was fetched
+	if c.req.SubmitterSeq == req.SubmitterSeq {
+		c.cached = res
+	}
+	return res, nil
+}
+
+// fetch a new anchor from node
+func (c *AnchorClient) fetch(req *AnchorRequest, apiKey string) (*AnchorResponse, error) {
+	body, _ := json.Marshal(req)
+	data, status, err := c.post("/anchors", body, apiKey)
+	if err != nil {
+		return nil, err
+	} else if status != http.StatusOK {
+		msg := ""
+		json.Unmarshal(data, &msg)
+		return nil, fmt.Errorf("failed to get anchor (%d): %s", status, msg)
+	}
+	return ParseAnchorResponse(data)
+}
+
+func (c *AnchorClient) post(path string, body []byte, apiKey string) ([]byte, int, error) {
+	r, err := http.NewRequest(http.MethodPost, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, 0, err
+	}
+	r.Header.Set("content-type", "application/json")
+	if len(apiKey) > 0 {
+		r.Header.Set(ApiKeyHeader, apiKey)
+	}
+	res, err := c.client.Do(r)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	return data, res.StatusCode, err
+}
+
+// submit a signed transaction request for submitter's next transaction with the cached anchor, a rejection
+// for stale anchor is resubmitted (up to AnchorClientRetries) with a fresh anchor, and cache moves on to
+// submitter's next transaction once request is accepted. A rejection is returned as an error with its code
+func (c *AnchorClient) Submit(req *SubmitRequest) (*SubmitResponse, error) {
+	for retry := 0; ; retry++ {
+		anchor, err := c.Anchor()
+		if err != nil {
+			return nil, dto.NewTxError(dto.ErrInternal, "failed to get anchor: %s", err)
+		}
+		// submit a copy of request with the anchor, leaving caller's request as is
+		anchored := *req
+		anchored.Anchor = &TxAnchor{
+			NodeId:      anchor.NodeId,
+			ShardSeq:    anchor.ShardSeq,
+			Weight:      anchor.Weight,
+			ShardParent: anchor.ShardParent,
+			ShardUncles: anchor.ShardUncles,
+			Signature:   anchor.Signature,
+		}
+		body, err := json.Marshal(&anchored)
+		if err != nil {
+			return nil, err
+		}
+		c.lock.Lock()
+		apiKey := c.apiKey
+		c.lock.Unlock()
+		data, status, err := c.post("/transactions", body, apiKey)
+		if err != nil {
+			return nil, dto.NewTxError(dto.ErrInternal, "node unavailable: %s", err)
+		} else if status == http.StatusOK {
+			res := &SubmitResponse{}
+			if err := json.Unmarshal(data, res); err != nil {
+				return nil, dto.NewTxError(dto.ErrInternal, "malformed response: %s", err)
+			}
+			c.submitted(req.SubmitterSeq, res)
+			return res, nil
+		}
+		rejection := &ErrorResponse{}
+		if err := json.Unmarshal(data, rejection); err != nil || len(rejection.Code) == 0 {
+			return nil, dto.NewTxError(dto.ErrInternal, "submission failed (%d): %s", status, data)
+		} else if rejection.Code != dto.ErrStaleAnchor || retry >= AnchorClientRetries {
+			return nil, dto.NewTxError(rejection.Code, "%s", rejection.Error)
+		}
+		// shard's tips moved past cached anchor, drop it so that resubmission fetches a fresh anchor
+		c.logger.Debug("Re-anchoring submission after stale anchor (retry %d): %s", retry+1, rejection.Error)
+		c.invalidate(req.SubmitterSeq)
+	}
+}
+
+// drop cached anchor of a submitter sequence
+func (c *AnchorClient) invalidate(seq uint64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.req.SubmitterSeq == seq {
+		c.cached = nil
+	}
+}
+
+// move on to submitter's next transaction after an accepted submission
+func (c *AnchorClient) submitted(seq uint64, res *SubmitResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if seq < c.req.SubmitterSeq {
+		return
+	}
+	c.req.SubmitterSeq, c.req.LastTx = seq+1, res.TxId
+	if bytes, err := hex.DecodeString(res.TxId); err == nil && len(bytes) == 64 {
+		copy(c.req.lastTx[:], bytes)
+	}
+	c.cached = nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// node serving anchors from a mock source, and rejecting first submissions for stale anchor
+type mockAnchorNode struct {
+	source    *mockAnchorSource
+	stale     int
+	submitted int
+	// shard parents of anchors submitted with transactions
+	parents []string
+	lock    sync.Mutex
+}
+
+func (n *mockAnchorNode) SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	return n.SubmitAnchored(req, nil, traceId)
+}
+
+func (n *mockAnchorNode) SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.submitted += 1
+	if anchor == nil {
+		anchor = dto.TestAnchor()
+	} else {
+		n.parents = append(n.parents, hex.EncodeToString(anchor.ShardParent[:]))
+	}
+	if n.stale > 0 {
+		n.stale -= 1
+		return nil, dto.NewTxError(dto.ErrStaleAnchor, "parent transaction unknown for shard")
+	}
+	return dto.NewTransaction(req, anchor), nil
+}
+
+func (n *mockAnchorNode) submissions() int {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.submitted
+}
+
+func (n *mockAnchorNode) submittedParents() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return append([]string{}, n.parents...)
+}
+
+func (s *mockAnchorSource) issues() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.issued
+}
+
+func newMockAnchorNode(stale int) (*mockAnchorNode, *httptest.Server) {
+	n := &mockAnchorNode{source: newMockAnchorSource(), stale: stale}
+	mux := http.NewServeMux()
+	anchors := NewAnchorHandler(n.source, []byte("test shard"))
+	mux.HandleFunc("/anchors", anchors.Issue)
+	mux.HandleFunc("/transactions", NewTransactionHandler(n, anchors).Submit)
+	return n, httptest.NewServer(mux)
+}
+
+func testSubmitRequest(seq uint64, lastTx [64]byte) *SubmitRequest {
+	return &SubmitRequest{
+		Payload:      "cGF5bG9hZA==",
+		ShardId:      hex.EncodeToString([]byte("test shard")),
+		LastTx:       hex.EncodeToString(lastTx[:]),
+		SubmitterId:  hex.EncodeToString([]byte("submitter")),
+		SubmitterSeq: seq,
+		Signature:    "c2lnbmF0dXJl",
+	}
+}
+
+func TestAnchorClient_Cached(t *testing.T) {
+	n, server := newMockAnchorNode(0)
+	defer server.Close()
+	c := NewAnchorClient(server.URL, []byte("submitter"), 1, [64]byte{})
+	first, err := c.Anchor()
+	if err != nil {
+		t.Fatalf("failed to get anchor: %s", err)
+	}
+	if second, _ := c.Anchor(); second != first || n.source.issues() != 1 {
+		t.Errorf("anchor should be served from cache, issued: %d", n.source.issues())
+	}
+	// anchor about to expire should be refreshed
+	first.ExpiresAt = time.Now().Add(AnchorRefreshMargin / 2).Unix()
+	if second, _ := c.Anchor(); second == first {
+		t.Errorf("expiring anchor should be refreshed")
+	}
+}
+
+func TestAnchorClient_Refresher(t *testing.T) {
+	defer func(interval time.Duration) { AnchorRefreshInterval = interval }(AnchorRefreshInterval)
+	AnchorRefreshInterval = 10 * time.Millisecond
+	n, server := newMockAnchorNode(0)
+	defer server.Close()
+	c := NewAnchorClient(server.URL, []byte("submitter"), 1, [64]byte{})
+	c.Start()
+	defer c.Stop()
+	for wait := 0; wait < 100; wait++ {
+		c.lock.Lock()
+		cached := c.cached
+		c.lock.Unlock()
+		if cached != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("anchor not fetched in background, issued: %d", n.source.issues())
+}
+
+func TestAnchorClient_SubmitReanchors(t *testing.T) {
+	n, server := newMockAnchorNode(2)
+	defer server.Close()
+	c := NewAnchorClient(server.URL, []byte("submitter"), 1, [64]byte{})
+	cached, err := c.Anchor()
+	if err != nil {
+		t.Fatalf("failed to get anchor: %s", err)
+	}
+	res, err := c.Submit(testSubmitRequest(1, [64]byte{}))
+	if err != nil {
+		t.Fatalf("submission should be re-anchored: %s", err)
+	}
+	if n.submissions() != 3 || n.source.issues() != 3 {
+		t.Errorf("incorrect number of submissions: %d, anchors: %d", n.submissions(), n.source.issues())
+	}
+	// first submission should carry the cached anchor, and each resubmission a fresh anchor
+	parents := n.submittedParents()
+	if len(parents) != 3 || parents[0] != cached.ShardParent || parents[1] == parents[0] || parents[2] == parents[1] {
+		t.Errorf("resubmissions not re-anchored: %v", parents)
+	}
+	if res.Anchor == nil || res.Anchor.ShardParent != parents[2] {
+		t.Errorf("transaction not anchored with fresh anchor: %v", res.Anchor)
+	}
+	// cache should move on to next transaction of submitter
+	if c.req.SubmitterSeq != 2 || c.req.LastTx != res.TxId || c.cached != nil {
+		t.Errorf("cache did not move to next transaction: %v", c.req)
+	}
+}
+
+func TestAnchorClient_SubmitStaleRetriesExhausted(t *testing.T) {
+	n, server := newMockAnchorNode(AnchorClientRetries + 1)
+	defer server.Close()
+	c := NewAnchorClient(server.URL, []byte("submitter"), 1, [64]byte{})
+	if _, err := c.Submit(testSubmitRequest(1, [64]byte{})); dto.ErrorCodeOf(err) != dto.ErrStaleAnchor {
+		t.Errorf("incorrect error: %v", err)
+	}
+	if n.submissions() != AnchorClientRetries+1 || c.req.SubmitterSeq != 1 {
+		t.Errorf("incorrect resubmissions: %d", n.submissions())
+	}
+}
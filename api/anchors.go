@@ -0,0 +1,204 @@
+// Copyright 2019 The trust-net Authors
+// Anchor API endpoints, issuing anchors on request and pushing fresh anchors over WebSocket
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"sync"
+)
+
+// source of anchors for a shard, e.g. a DLT stack with registered app
+type AnchorSource interface {
+	// get a transaction anchor for specified submitter id
+	Anchor(id []byte, seq uint64, lastTx [64]byte) *dto.Anchor
+	// watch accepted transactions of a shard, i.e. changes of shard's tips
+	Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error)
+	Unwatch(id uint64)
+}
+
+// message pushed to an anchor stream client, either a fresh anchor for client's last request,
+// or an error when request was invalid or an anchor could not be issued
+type AnchorStreamMessage struct {
+	Anchor *AnchorResponse `json:"anchor,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// handlers of anchor endpoints for a shard:
+//
+//	POST /anchors:        issue an anchor (AnchorRequest -> AnchorResponse)
+//	POST /anchors/batch:  issue sequential anchors (AnchorBatchRequest -> AnchorBatchResponse)
+//	GET  /anchors/stream: WebSocket, client sends AnchorRequest messages (e.g. after each submission) and
+//	                      is pushed an AnchorStreamMessage with a fresh anchor for its last request, right
+//	                      away and then whenever shard's tips change
+type AnchorHandler struct {
+	source   AnchorSource
+	shardId  []byte
+	cache    *AnchorCache
+	upgrader websocket.Upgrader
+	logger   log.Logger
+}
+
+// create handlers issuing anchors from a source (e.g. DLT stack) for a shard (e.g. registered app's shard)
+func NewAnchorHandler(source AnchorSource, shardId []byte) *AnchorHandler {
+	return &AnchorHandler{
+		source:  source,
+		shardId: shardId,
+		cache:   NewAnchorCache(),
+		logger:  log.NewLogger("Anchor API"),
+	}
+}
+
+// mark pre-fetched anchors of a submitter up to (and including) a sequence as consumed by submitted transactions
+func (h *AnchorHandler) Consume(submitter []byte, seq uint64) {
+	h.cache.Consume(submitter, seq)
+}
+
+// drop anchors issued for a submitter's transaction that was rejected for a stale anchor
+func (h *AnchorHandler) Stale(submitter []byte, seq uint64, lastTx [64]byte) {
+	h.cache.Stale(submitter, seq, lastTx)
+}
+
+func writeAnchorError(w http.ResponseWriter, msg string) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusNotAcceptable)
+	json.NewEncoder(w).Encode(msg)
+}
+
+// POST /anchors
+func (h *AnchorHandler) Issue(w http.ResponseWriter, r *http.Request) {
+	req, err := ParseAnchorRequest(r)
+	if err != nil {
+		WriteBadRequest(w, err)
+		return
+	}
+	if err := Authorize(r, req.Submitter(), h.shardId); err != nil {
+		WriteForbidden(w, err)
+		return
+	}
+	if res := h.cache.Issue(req, func() *dto.Anchor {
+		return h.source.Anchor(req.Submitter(), req.SubmitterSeq, req.LastTxId())
+	}); res == nil {
+		writeAnchorError(w, "failed to get anchor")
+	} else {
+		w.Header().Set("content-type", AnchorMediaType)
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+// POST /anchors/batch
+func (h *AnchorHandler) IssueBatch(w http.ResponseWriter, r *http.Request) {
+	req, err := ParseAnchorBatchRequest(r)
+	if err != nil {
+		WriteBadRequest(w, err)
+		return
+	}
+	if err := Authorize(r, req.Submitter(), h.shardId); err != nil {
+		WriteForbidden(w, err)
+		return
+	}
+	if res := h.cache.IssueBatch(req, func(seq uint64, lastTx [64]byte) *dto.Anchor {
+		return h.source.Anchor(req.Submitter(), seq, lastTx)
+	}); res == nil {
+		writeAnchorError(w, "failed to get anchors")
+	} else {
+		w.Header().Set("content-type", AnchorMediaType)
+		json.NewEncoder(w).Encode(&AnchorBatchResponse{Anchors: res})
+	}
+}
+
+// a client connected to anchor stream
+type anchorStream struct {
+	req *AnchorRequest
+	err string
+	// signal to writer that a message is due, pending signals are coalesced
+	notify chan struct{}
+	lock   sync.Mutex
+}
+
+func (s *anchorStream) signal() {
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+}
+
+// GET /anchors/stream
+func (h *AnchorHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	conn, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// upgrader has already responded with an error
+		h.logger.Debug("Failed to upgrade anchor stream from %s: %s", r.RemoteAddr, err)
+		return
+	}
+	defer conn.Close()
+	s := &anchorStream{notify: make(chan struct{}, 1)}
+	// shard's tips change with each accepted transaction
+	id, err := h.source.Watch(h.shardId, func(tx dto.Transaction) { s.signal() })
+	if err != nil {
+		conn.WriteJSON(&AnchorStreamMessage{Error: err.Error()})
+		return
+	}
+	defer h.source.Unwatch(id)
+	done := make(chan struct{})
+	defer close(done)
+	go h.push(conn, s, done)
+	// read client's requests until connection is closed
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		req, v := &AnchorRequest{}, &validator{}
+		if err := json.Unmarshal(data, req); err != nil {
+			v.fail("body", "malformed JSON: "+err.Error())
+		} else {
+			req.validate(v)
+		}
+		s.lock.Lock()
+		if err := v.err(); err != nil {
+			s.req, s.err = nil, err.Error()
+		} else if err := Authorize(r, req.Submitter(), h.shardId); err != nil {
+			s.req, s.err = nil, err.Error()
+		} else {
+			s.req, s.err = req, ""
+		}
+		s.lock.Unlock()
+		s.signal()
+	}
+}
+
+// write messages to a stream client when signalled, until stream is done
+func (h *AnchorHandler) push(conn *websocket.Conn, s *anchorStream, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-s.notify:
+		}
+		s.lock.Lock()
+		req, errMsg := s.req, s.err
+		// an error is reported once
+		s.err = ""
+		s.lock.Unlock()
+		msg := &AnchorStreamMessage{Error: errMsg}
+		if req != nil {
+			if a := h.source.Anchor(req.Submitter(), req.SubmitterSeq, req.LastTxId()); a != nil {
+				msg.Anchor = NewAnchorResponse(a, req)
+			} else {
+				msg.Error = "failed to get anchor"
+			}
+		} else if len(errMsg) == 0 {
+			// no request from client yet
+			continue
+		}
+		if err := conn.WriteJSON(msg); err != nil {
+			conn.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for anchor request
+
+package api
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"time"
+)
+
+// versioned media type of anchor response
+const AnchorMediaType = "application/vnd.dag-lib.anchor.v1+json"
+
+// version of anchor response schema
+const AnchorResponseVersion = 1
+
+// duration after which an issued anchor should be considered stale by client (shard tips would have moved)
+var AnchorTTL = 5 * time.Minute
+
+// A request for an anchor to submit a transaction
+type AnchorRequest struct {
+	// Submitter's public ID
+	SubmitterId string `json:"submitter_id"`
+	// submitter's transaction sequence for the transaction to be anchored
+	SubmitterSeq uint64 `json:"submitter_seq"`
+	// submitter's last transaction
+	LastTx string `json:"last_tx"`
+
+	submitterId []byte
+	lastTx      [64]byte
+}
+
+func (req *AnchorRequest) Submitter() []byte {
+	return req.submitterId
+}
+
+func (req *AnchorRequest) LastTxId() [64]byte {
+	return req.lastTx
+}
+
+// validate and decode request fields
+func (req *AnchorRequest) validate(v *validator) {
+	req.submitterId = v.hex("submitter_id", req.SubmitterId, 0)
+	v.positive("submitter_seq", req.SubmitterSeq)
+	req.lastTx = v.hash("last_tx", req.LastTx)
+}
+
+func ParseAnchorRequest(r *http.Request) (*AnchorRequest, error) {
+	req, v := &AnchorRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	req.validate(v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// max number of sequential anchors in a batch request
+var MaxAnchorBatch = 16
+
+// A request for anchors of a submitter's next sequential transactions (seq N..N+count-1),
+// so that bulk clients can pipeline submissions without a round trip per transaction
+type AnchorBatchRequest struct {
+	AnchorRequest
+	// number of sequential anchors requested
+	Count int `json:"count"`
+}
+
+func ParseAnchorBatchRequest(r *http.Request) (*AnchorBatchRequest, error) {
+	req, v := &AnchorBatchRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	req.validate(v)
+	if req.Count <= 0 || req.Count > MaxAnchorBatch {
+		v.fail("count", fmt.Sprintf("must be between 1 and %d", MaxAnchorBatch))
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// response with a batch of sequential anchors, in order of submitter sequence
+type AnchorBatchResponse struct {
+	Anchors []*AnchorResponse `json:"anchors"`
+}
+
+// response with an anchor issued by node (served with AnchorMediaType)
+type AnchorResponse struct {
+	// schema version of the response
+	Version int `json:"version"`
+	// ID of node that issued the anchor
+	NodeId string `json:"node_id"`
+	// sequence of the anchored transaction within the shard
+	ShardSeq uint64 `json:"shard_seq"`
+	// weight of the anchored transaction within shard DAG
+	Weight uint64 `json:"weight"`
+	// parent transaction within the shard
+	ShardParent string `json:"shard_parent"`
+	// uncle transactions within the shard
+	ShardUncles []string `json:"shard_uncles"`
+	// node's signature of the anchor
+	Signature string `json:"signature"`
+	// unix time (seconds) when anchor was issued
+	IssuedAt int64 `json:"issued_at"`
+	// unix time (seconds) after which anchor should be considered stale
+	ExpiresAt int64 `json:"expires_at"`
+	// echo of the anchor request
+	Request *AnchorRequest `json:"request,omitempty"`
+}
+
+func NewAnchorResponse(a *dto.Anchor, req *AnchorRequest) *AnchorResponse {
+	now := time.Now()
+	res := &AnchorResponse{
+		Version:     AnchorResponseVersion,
+		NodeId:      hex.EncodeToString(a.NodeId),
+		ShardSeq:    a.ShardSeq,
+		Weight:      a.Weight,
+		ShardParent: hex.EncodeToString(a.ShardParent[:]),
+		ShardUncles: make([]string, 0, len(a.ShardUncles)),
+		Signature:   hex.EncodeToString(a.Signature),
+		IssuedAt:    now.Unix(),
+		ExpiresAt:   now.Add(AnchorTTL).Unix(),
+		Request:     req,
+	}
+	for _, uncle := range a.ShardUncles {
+		res.ShardUncles = append(res.ShardUncles, hex.EncodeToString(uncle[:]))
+	}
+	return res
+}
+
+// parse an anchor response received by client
+func ParseAnchorResponse(data []byte) (*AnchorResponse, error) {
+	res := &AnchorResponse{}
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, fmt.Errorf("Malformed response: %s", err)
+	}
+	if res.Version != AnchorResponseVersion {
+		return nil, fmt.Errorf("unsupported anchor response version: %d", res.Version)
+	}
+	return res, nil
+}
+
+// check if the anchor is past its expiry
+func (res *AnchorResponse) Expired() bool {
+	return time.Now().Unix() > res.ExpiresAt
+}
+
+// decode the anchor from response
+func (res *AnchorResponse) DltAnchor() (*dto.Anchor, error) {
+	a := &dto.Anchor{
+		ShardSeq: res.ShardSeq,
+		Weight:   res.Weight,
+	}
+	if a.NodeId, _ = hex.DecodeString(res.NodeId); len(a.NodeId) == 0 {
+		return nil, fmt.Errorf("invalid node_id")
+	}
+	if bytes, _ := hex.DecodeString(res.ShardParent); len(bytes) != 64 {
+		return nil, fmt.Errorf("invalid shard_parent")
+	} else {
+		copy(a.ShardParent[:], bytes)
+	}
+	for _, uncle := range res.ShardUncles {
+		if bytes, _ := hex.DecodeString(uncle); len(bytes) != 64 {
+			return nil, fmt.Errorf("invalid shard_uncles")
+		} else {
+			hash := [64]byte{}
+			copy(hash[:], bytes)
+			a.ShardUncles = append(a.ShardUncles, hash)
+		}
+	}
+	if a.Signature, _ = hex.DecodeString(res.Signature); len(a.Signature) == 0 {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	return a, nil
+}
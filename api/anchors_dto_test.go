@@ -0,0 +1,37 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+func TestAnchorResponse_RoundTrip(t *testing.T) {
+	a := dto.TestAnchor()
+	a.ShardUncles = [][64]byte{dto.RandomHash()}
+	a.Signature = []byte("test signature")
+	data, _ := json.Marshal(NewAnchorResponse(a, nil))
+	res, err := ParseAnchorResponse(data)
+	if err != nil {
+		t.Errorf("failed to parse anchor response: %s", err)
+		return
+	}
+	if res.Expired() || res.ExpiresAt <= res.IssuedAt {
+		t.Errorf("incorrect anchor expiry: %d", res.ExpiresAt)
+	}
+	if parsed, err := res.DltAnchor(); err != nil {
+		t.Errorf("failed to decode anchor: %s", err)
+	} else if string(parsed.Bytes()) != string(a.Bytes()) || string(parsed.Signature) != string(a.Signature) {
+		t.Errorf("decoded anchor does not match:\n%s\n%s", parsed.ToString(), a.ToString())
+	}
+}
+
+func TestParseAnchorResponse_Version(t *testing.T) {
+	res := NewAnchorResponse(dto.TestAnchor(), nil)
+	res.Version = AnchorResponseVersion + 1
+	data, _ := json.Marshal(res)
+	if _, err := ParseAnchorResponse(data); err == nil {
+		t.Errorf("unsupported version should fail")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gorilla/websocket"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// anchor source minting a new anchor on each request
+type mockAnchorSource struct {
+	issued   int
+	watchers map[uint64]func(tx dto.Transaction)
+	lock     sync.Mutex
+}
+
+func newMockAnchorSource() *mockAnchorSource {
+	return &mockAnchorSource{watchers: make(map[uint64]func(tx dto.Transaction))}
+}
+
+func (s *mockAnchorSource) Anchor(id []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.issued += 1
+	a := dto.TestAnchor()
+	a.ShardParent, a.Signature = dto.RandomHash(), []byte("anchor signature")
+	return a
+}
+
+func (s *mockAnchorSource) Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	id := uint64(len(s.watchers) + 1)
+	s.watchers[id] = handler
+	return id, nil
+}
+
+func (s *mockAnchorSource) Unwatch(id uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.watchers, id)
+}
+
+// simulate a change of shard's tips
+func (s *mockAnchorSource) accept() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, handler := range s.watchers {
+		handler(dto.TestSignedTransaction("test data"))
+	}
+}
+
+func (s *mockAnchorSource) watching() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.watchers)
+}
+
+func testAnchorRequest() *AnchorRequest {
+	lastTx := dto.RandomHash()
+	return &AnchorRequest{
+		SubmitterId:  hex.EncodeToString([]byte("submitter")),
+		SubmitterSeq: 2,
+		LastTx:       hex.EncodeToString(lastTx[:]),
+	}
+}
+
+func TestAnchorHandler_Issue(t *testing.T) {
+	source := newMockAnchorSource()
+	h := NewAnchorHandler(source, []byte("test shard"))
+	body, _ := json.Marshal(testAnchorRequest())
+	var first *AnchorResponse
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.Issue(w, httptest.NewRequest("POST", "/anchors", bytes.NewReader(body)))
+		if w.Code != http.StatusOK || w.Header().Get("content-type") != AnchorMediaType {
+			t.Errorf("incorrect response: %d, %s", w.Code, w.Header().Get("content-type"))
+			return
+		}
+		res, err := ParseAnchorResponse(w.Body.Bytes())
+		if err != nil {
+			t.Errorf("failed to parse response: %s", err)
+			return
+		}
+		// repeated request gets same anchor
+		if first == nil {
+			first = res
+		} else if res.Signature != first.Signature || res.ShardParent != first.ShardParent || source.issued != 1 {
+			t.Errorf("repeated request should get same anchor")
+		}
+	}
+	w := httptest.NewRecorder()
+	h.Issue(w, httptest.NewRequest("POST", "/anchors", strings.NewReader(`{"submitter_seq": 1}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid request should fail: %d", w.Code)
+	}
+}
+
+func TestAnchorHandler_Stream(t *testing.T) {
+	source := newMockAnchorSource()
+	h := NewAnchorHandler(source, []byte("test shard"))
+	server := httptest.NewServer(http.HandlerFunc(h.Stream))
+	defer server.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Errorf("failed to connect to anchor stream: %s", err)
+		return
+	}
+	defer conn.Close()
+	read := func() *AnchorStreamMessage {
+		msg := &AnchorStreamMessage{}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		if err := conn.ReadJSON(msg); err != nil {
+			t.Errorf("failed to read message: %s", err)
+			return nil
+		}
+		return msg
+	}
+
+	// client is pushed an anchor right after request
+	req := testAnchorRequest()
+	conn.WriteJSON(req)
+	first := read()
+	if first == nil || first.Anchor == nil || first.Anchor.Request.SubmitterSeq != req.SubmitterSeq {
+		t.Errorf("did not get anchor for request: %v", first)
+		return
+	}
+	// and a fresh anchor when shard's tips change
+	source.accept()
+	if msg := read(); msg == nil || msg.Anchor == nil || msg.Anchor.ShardParent == first.Anchor.ShardParent {
+		t.Errorf("did not get fresh anchor: %v", msg)
+	}
+	// invalid request is reported
+	conn.WriteJSON(&AnchorRequest{SubmitterSeq: 3})
+	if msg := read(); msg == nil || msg.Anchor != nil || !strings.Contains(msg.Error, "submitter_id") {
+		t.Errorf("invalid request not reported: %v", msg)
+	}
+
+	// watch is cancelled when client disconnects
+	conn.Close()
+	for i := 0; i < 100 && source.watching() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if source.watching() != 0 {
+		t.Errorf("watch not cancelled after disconnect")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2019 The trust-net Authors
+// API key authentication, with per-key binding to submitters and shards
+
+package api
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// header carrying client's API key
+const ApiKeyHeader = "X-Api-Key"
+
+// an API key issued to a tenant of a shared node
+type ApiKey struct {
+	// secret key presented by client in X-Api-Key header
+	Key string `json:"key"`
+	// name of the tenant (for logs)
+	Name string `json:"name"`
+	// hex encoded submitter IDs the key may act as (any submitter when empty)
+	Submitters []string `json:"submitters"`
+	// hex encoded shard IDs the key may act on (any shard when empty)
+	Shards []string `json:"shards"`
+}
+
+// check if key is bound to allow specified submitter and shard (nil values are not checked)
+func (k *ApiKey) allows(submitterId, shardId []byte) error {
+	if submitterId != nil && !boundTo(k.Submitters, submitterId) {
+		return fmt.Errorf("api key not authorized for submitter: %x", submitterId)
+	}
+	if shardId != nil && !boundTo(k.Shards, shardId) {
+		return fmt.Errorf("api key not authorized for shard: %x", shardId)
+	}
+	return nil
+}
+
+func boundTo(ids []string, id []byte) bool {
+	if len(ids) == 0 {
+		return true
+	}
+	for _, bound := range ids {
+		if bytes, err := hex.DecodeString(bound); err == nil && string(bytes) == string(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// load API keys from a JSON file with a list of keys
+func LoadApiKeys(file string) ([]ApiKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	keys := []ApiKey{}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("malformed API keys file: %s", err)
+	}
+	for i, key := range keys {
+		if len(key.Key) == 0 {
+			return nil, fmt.Errorf("API key %d has no key", i)
+		}
+		for _, id := range append(append([]string{}, key.Submitters...), key.Shards...) {
+			if bytes, err := hex.DecodeString(id); err != nil || len(bytes) == 0 {
+				return nil, fmt.Errorf("API key %s has invalid binding: %s", key.Name, id)
+			}
+		}
+	}
+	return keys, nil
+}
+
+type apiKeyContext struct{}
+
+// API key of an authenticated request, nil if API keys are not configured
+func RequestApiKey(r *http.Request) *ApiKey {
+	key, _ := r.Context().Value(apiKeyContext{}).(*ApiKey)
+	return key
+}
+
+// authorize an authenticated request to act as submitter on shard, always allowed when
+// API keys are not configured
+func Authorize(r *http.Request, submitterId, shardId []byte) error {
+	if key := RequestApiKey(r); key != nil {
+		return key.allows(submitterId, shardId)
+	}
+	return nil
+}
+
+// write an error response for a request not authorized by its API key
+func WriteForbidden(w http.ResponseWriter, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(err.Error())
+}
+
+// middleware to authenticate requests with one of the API keys, requests without a valid key are rejected
+func Auth(keys []ApiKey, next http.Handler) http.Handler {
+	byKey := make(map[string]*ApiKey)
+	for i := range keys {
+		byKey[keys[i].Key] = &keys[i]
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, found := byKey[r.Header.Get(ApiKeyHeader)]
+		if !found {
+			w.Header().Set("content-type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode("missing or invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key)))
+	})
+}
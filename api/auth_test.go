@@ -0,0 +1,64 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestServer_ApiKeys(t *testing.T) {
+	var authErr error
+	s := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authErr = Authorize(r, []byte("tenant 1"), []byte("shard 1"))
+	}), ServerConfig{ApiKeys: []ApiKey{
+		{Key: "key1", Name: "tenant 1", Submitters: []string{"74656e616e742031"}},
+		{Key: "key2", Name: "tenant 2", Shards: []string{"73686172642032"}},
+	}})
+
+	// request without key should be rejected
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request without API key not rejected: %d", w.Code)
+	}
+
+	// key bound to submitter should be authorized for that submitter on any shard
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set(ApiKeyHeader, "key1")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if authErr != nil {
+		t.Errorf("bound submitter not authorized: %s", authErr)
+	}
+
+	// key bound to a different shard should not be authorized
+	req = httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set(ApiKeyHeader, "key2")
+	s.Handler().ServeHTTP(httptest.NewRecorder(), req)
+	if authErr == nil {
+		t.Errorf("submission to unbound shard authorized")
+	}
+}
+
+func TestAuthorize_NoKeys(t *testing.T) {
+	if err := Authorize(httptest.NewRequest("GET", "/foo", nil), []byte("any"), []byte("any")); err != nil {
+		t.Errorf("request should be authorized when API keys are not configured: %s", err)
+	}
+}
+
+func TestLoadApiKeys(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "apikeys")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keys.json")
+	ioutil.WriteFile(file, []byte(`[{"key": "key1", "name": "tenant", "shards": ["0102"]}]`), 0600)
+	if keys, err := LoadApiKeys(file); err != nil || len(keys) != 1 || keys[0].Shards[0] != "0102" {
+		t.Errorf("failed to load API keys: %v, %s", keys, err)
+	}
+	ioutil.WriteFile(file, []byte(`[{"key": "key1", "submitters": ["xyz"]}]`), 0600)
+	if _, err := LoadApiKeys(file); err == nil {
+		t.Errorf("invalid binding should fail")
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2019 The trust-net Authors
+// Internal interface between stateless client API front-ends and the stack process owning the DAG and repo,
+// so that client API capacity scales independently of the single DAG writing node
+
+package api
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// operations client API needs from the stack process, implemented by stack.DLT in process, and by
+// BackendClient in a front-end process
+type Backend interface {
+	Anchor(submitterId []byte, seq uint64, lastTx [64]byte) *dto.Anchor
+	SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error)
+	SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error)
+	GetState(key []byte) (*state.Resource, error)
+	GetShardState(shardId []byte, key []byte) (*state.Resource, error)
+	GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error)
+	WaitFor(txId [64]byte, criteria stack.WaitCriteria, timeout time.Duration) (*stack.WaitResult, error)
+	NodeInfo() *stack.NodeInfo
+}
+
+// request of a backend call, fields used depend on the call
+type BackendRequest struct {
+	SubmitterId []byte
+	Seq         uint64
+	LastTx      [64]byte
+	Request     *dto.TxRequest
+	Anchor      *dto.Anchor
+	TraceId     string
+	ShardId     []byte
+	Key         []byte
+	AtSeq       bool
+	TxId        [64]byte
+	Criteria    stack.WaitCriteria
+	Timeout     time.Duration
+}
+
+// response of a backend call, fields set depend on the call
+type BackendResponse struct {
+	Anchor   *dto.Anchor
+	Tx       []byte
+	Resource *state.Resource
+	Result   *stack.WaitResult
+	Info     *stack.NodeInfo
+	Error    *BackendError
+}
+
+// error of a backend call, with error's code so that a front-end reports it same as the stack process would
+type BackendError struct {
+	Code    dto.ErrorCode
+	Message string
+}
+
+// errors that front-ends compare against, returned as is from a backend call
+var backendSentinels = []error{stack.ErrWaitTimeout}
+
+func newBackendError(err error) *BackendError {
+	if err == nil {
+		return nil
+	}
+	e := &BackendError{Message: err.Error()}
+	if coded, ok := err.(interface{ ErrorCode() dto.ErrorCode }); ok {
+		e.Code = coded.ErrorCode()
+	}
+	return e
+}
+
+func (e *BackendError) err() error {
+	if e == nil {
+		return nil
+	} else if len(e.Code) > 0 {
+		return dto.NewTxError(e.Code, "%s", e.Message)
+	}
+	for _, sentinel := range backendSentinels {
+		if e.Message == sentinel.Error() {
+			return sentinel
+		}
+	}
+	return errors.New(e.Message)
+}
+
+// net/rpc service of a backend
+type backendService struct {
+	backend Backend
+}
+
+func (s *backendService) Anchor(req *BackendRequest, res *BackendResponse) error {
+	res.Anchor = s.backend.Anchor(req.SubmitterId, req.Seq, req.LastTx)
+	return nil
+}
+
+func (s *backendService) Submit(req *BackendRequest, res *BackendResponse) error {
+	var tx dto.Transaction
+	var err error
+	if req.Anchor != nil {
+		tx, err = s.backend.SubmitAnchored(req.Request, req.Anchor, req.TraceId)
+	} else {
+		tx, err = s.backend.SubmitWithTrace(req.Request, req.TraceId)
+	}
+	if err != nil {
+		res.Error = newBackendError(err)
+		return nil
+	}
+	res.Tx, err = tx.Serialize()
+	return err
+}
+
+func (s *backendService) GetState(req *BackendRequest, res *BackendResponse) error {
+	var err error
+	if req.AtSeq {
+		res.Resource, err = s.backend.GetStateAtSeq(req.ShardId, req.Seq, req.Key)
+	} else if len(req.ShardId) > 0 {
+		res.Resource, err = s.backend.GetShardState(req.ShardId, req.Key)
+	} else {
+		res.Resource, err = s.backend.GetState(req.Key)
+	}
+	res.Error = newBackendError(err)
+	return nil
+}
+
+func (s *backendService) WaitFor(req *BackendRequest, res *BackendResponse) error {
+	var err error
+	res.Result, err = s.backend.WaitFor(req.TxId, req.Criteria, req.Timeout)
+	res.Error = newBackendError(err)
+	return nil
+}
+
+func (s *backendService) NodeInfo(req *BackendRequest, res *BackendResponse) error {
+	res.Info = s.backend.NodeInfo()
+	return nil
+}
+
+// server of backend calls from front-ends, run by the stack process on an internal network address (calls
+// are neither authenticated nor encrypted, front-ends authenticate clients)
+type BackendServer struct {
+	rpc      *rpc.Server
+	listener net.Listener
+	conns    map[net.Conn]bool
+	lock     sync.Mutex
+	logger   log.Logger
+}
+
+func NewBackendServer(backend Backend) *BackendServer {
+	s := &BackendServer{
+		rpc:    rpc.NewServer(),
+		conns:  make(map[net.Conn]bool),
+		logger: log.NewLogger("Backend Server"),
+	}
+	s.rpc.RegisterName("Backend", &backendService{backend: backend})
+	return s
+}
+
+// listen for front-ends on an address, and serve their calls in background until server is stopped
+func (s *BackendServer) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				s.logger.Debug("Stopped accepting front-ends: %s", err)
+				return
+			}
+			s.lock.Lock()
+			s.conns[conn] = true
+			s.lock.Unlock()
+			go func() {
+				s.rpc.ServeConn(conn)
+				s.lock.Lock()
+				delete(s.conns, conn)
+				s.lock.Unlock()
+			}()
+		}
+	}()
+	return nil
+}
+
+// address server is listening on, nil if not started
+func (s *BackendServer) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// stop listening, and disconnect front-ends
+func (s *BackendServer) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener != nil {
+		s.listener.Close()
+		s.listener = nil
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+}
+
+// client of a backend server, used by a front-end in place of a DLT stack, connects on first call and
+// reconnects after a lost connection
+type BackendClient struct {
+	addr   string
+	client *rpc.Client
+	lock   sync.Mutex
+	logger log.Logger
+}
+
+func NewBackendClient(addr string) *BackendClient {
+	return &BackendClient{
+		addr:   addr,
+		logger: log.NewLogger("Backend Client"),
+	}
+}
+
+func (c *BackendClient) connection() (*rpc.Client, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == nil {
+		client, err := rpc.Dial("tcp", c.addr)
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	return c.client, nil
+}
+
+// drop a lost connection, unless already replaced
+func (c *BackendClient) reset(client *rpc.Client) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client == client {
+		c.client.Close()
+		c.client = nil
+	}
+}
+
+// call backend, re-attempting once on a new connection when call was not sent over a lost connection (so
+// that a submission is never sent twice), a failure to reach backend is reported as an internal error
+func (c *BackendClient) call(method string, req *BackendRequest) (*BackendResponse, error) {
+	for attempt := 0; ; attempt++ {
+		client, err := c.connection()
+		if err != nil {
+			return nil, dto.NewTxError(dto.ErrInternal, "backend unavailable: %s", err)
+		}
+		res := &BackendResponse{}
+		if err = client.Call("Backend."+method, req, res); err == nil {
+			return res, res.Error.err()
+		} else if _, ok := err.(rpc.ServerError); ok {
+			return nil, dto.NewTxError(dto.ErrInternal, "backend failed: %s", err)
+		}
+		c.reset(client)
+		if err != rpc.ErrShutdown || attempt > 0 {
+			return nil, dto.NewTxError(dto.ErrInternal, "backend unavailable: %s", err)
+		}
+	}
+}
+
+func (c *BackendClient) Anchor(submitterId []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	res, err := c.call("Anchor", &BackendRequest{SubmitterId: submitterId, Seq: seq, LastTx: lastTx})
+	if err != nil {
+		c.logger.Error("Failed to get anchor: %s", err)
+		return nil
+	}
+	return res.Anchor
+}
+
+func (c *BackendClient) SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	return c.SubmitAnchored(req, nil, traceId)
+}
+
+func (c *BackendClient) SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	res, err := c.call("Submit", &BackendRequest{Request: req, Anchor: anchor, TraceId: traceId})
+	if err != nil {
+		return nil, err
+	}
+	tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if err := tx.DeSerialize(res.Tx); err != nil {
+		return nil, dto.NewTxError(dto.ErrInternal, "failed to decode submitted transaction: %s", err)
+	}
+	return tx, nil
+}
+
+func (c *BackendClient) GetState(key []byte) (*state.Resource, error) {
+	res, err := c.call("GetState", &BackendRequest{Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return res.Resource, nil
+}
+
+func (c *BackendClient) GetShardState(shardId []byte, key []byte) (*state.Resource, error) {
+	res, err := c.call("GetState", &BackendRequest{ShardId: shardId, Key: key})
+	if err != nil {
+		return nil, err
+	}
+	return res.Resource, nil
+}
+
+func (c *BackendClient) GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error) {
+	res, err := c.call("GetState", &BackendRequest{ShardId: shardId, Seq: seq, Key: key, AtSeq: true})
+	if err != nil {
+		return nil, err
+	}
+	return res.Resource, nil
+}
+
+func (c *BackendClient) WaitFor(txId [64]byte, criteria stack.WaitCriteria, timeout time.Duration) (*stack.WaitResult, error) {
+	res, err := c.call("WaitFor", &BackendRequest{TxId: txId, Criteria: criteria, Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+	return res.Result, nil
+}
+
+func (c *BackendClient) NodeInfo() *stack.NodeInfo {
+	res, err := c.call("NodeInfo", &BackendRequest{})
+	if err != nil {
+		c.logger.Error("Failed to get node info: %s", err)
+		return nil
+	}
+	return res.Info
+}
+
+// close connection to backend
+func (c *BackendClient) Close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+}
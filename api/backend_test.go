@@ -0,0 +1,154 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+// DLT stack should serve as backend in process
+var _ Backend = stack.DLT(nil)
+
+// backend answering from fixed values
+type mockBackend struct {
+	submitErr error
+	traceId   string
+	anchor    *dto.Anchor
+}
+
+func (b *mockBackend) Anchor(submitterId []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	a := dto.TestAnchor()
+	a.ShardSeq = seq
+	return a
+}
+
+func (b *mockBackend) SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	if b.submitErr != nil {
+		return nil, b.submitErr
+	}
+	b.traceId = traceId
+	tx := dto.NewTransaction(req, dto.TestAnchor())
+	tx.SetTraceId(traceId)
+	return tx, nil
+}
+
+func (b *mockBackend) SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	if b.submitErr != nil {
+		return nil, b.submitErr
+	}
+	b.traceId, b.anchor = traceId, anchor
+	tx := dto.NewTransaction(req, anchor)
+	tx.SetTraceId(traceId)
+	return tx, nil
+}
+
+func (b *mockBackend) GetState(key []byte) (*state.Resource, error) {
+	return &state.Resource{Key: key, Value: []byte("current")}, nil
+}
+
+func (b *mockBackend) GetShardState(shardId []byte, key []byte) (*state.Resource, error) {
+	return &state.Resource{Key: key, Value: append([]byte("current in "), shardId...)}, nil
+}
+
+func (b *mockBackend) GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error) {
+	return nil, errors.New("resource not found")
+}
+
+func (b *mockBackend) WaitFor(txId [64]byte, criteria stack.WaitCriteria, timeout time.Duration) (*stack.WaitResult, error) {
+	if timeout < time.Second {
+		return nil, stack.ErrWaitTimeout
+	}
+	return &stack.WaitResult{Depth: 3, Confirmations: criteria.Confirmations}, nil
+}
+
+func (b *mockBackend) NodeInfo() *stack.NodeInfo {
+	return &stack.NodeInfo{Name: "backend"}
+}
+
+func startMockBackend(t *testing.T, backend Backend) (*BackendServer, *BackendClient) {
+	server := NewBackendServer(backend)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to start backend server: %s", err)
+	}
+	return server, NewBackendClient(server.Addr().String())
+}
+
+func TestBackend_Calls(t *testing.T) {
+	backend := &mockBackend{}
+	server, client := startMockBackend(t, backend)
+	defer server.Stop()
+	defer client.Close()
+
+	if a := client.Anchor([]byte("submitter"), 5, [64]byte{}); a == nil || a.ShardSeq != 5 {
+		t.Errorf("incorrect anchor: %v", a)
+	}
+	req := dto.TestRequest()
+	if tx, err := client.SubmitWithTrace(req, "trace-1"); err != nil {
+		t.Errorf("failed to submit: %s", err)
+	} else if string(tx.Request().Signature) != string(req.Signature) || tx.TraceId() != "trace-1" || backend.traceId != "trace-1" {
+		t.Errorf("incorrect transaction: %x", tx.Id())
+	}
+	if r, err := client.GetState([]byte("key")); err != nil || string(r.Key) != "key" || string(r.Value) != "current" {
+		t.Errorf("incorrect resource: %v, %s", r, err)
+	}
+	if r, err := client.GetShardState([]byte("shard"), []byte("key")); err != nil || string(r.Value) != "current in shard" {
+		t.Errorf("incorrect resource of shard: %v, %s", r, err)
+	}
+	if _, err := client.GetStateAtSeq([]byte("shard"), 1, []byte("key")); err == nil || err.Error() != "resource not found" {
+		t.Errorf("incorrect error: %s", err)
+	}
+	if res, err := client.WaitFor([64]byte{}, stack.WaitCriteria{Confirmations: 2}, time.Minute); err != nil || res.Depth != 3 || res.Confirmations != 2 {
+		t.Errorf("incorrect wait result: %v, %s", res, err)
+	}
+	if _, err := client.WaitFor([64]byte{}, stack.WaitCriteria{}, time.Millisecond); err != stack.ErrWaitTimeout {
+		t.Errorf("incorrect wait error: %s", err)
+	}
+	if info := client.NodeInfo(); info == nil || info.Name != "backend" {
+		t.Errorf("incorrect node info: %v", info)
+	}
+}
+
+// submission errors should carry their codes across to front-end
+func TestBackend_SubmitErrorCodes(t *testing.T) {
+	backend := &mockBackend{}
+	server, client := startMockBackend(t, backend)
+	defer server.Stop()
+	defer client.Close()
+	for _, err := range []error{
+		dto.NewTxError(dto.ErrSeqMismatch, "sequence mismatch"),
+		&stack.LimitError{Limit: "stack.max_payload_size", Max: 1, Value: 2},
+	} {
+		backend.submitErr = err
+		if _, res := client.SubmitWithTrace(dto.TestRequest(), ""); res == nil || res.Error() != err.Error() {
+			t.Errorf("incorrect error: %s", res)
+		} else if dto.ErrorCodeOf(res) != dto.ErrorCodeOf(err) {
+			t.Errorf("incorrect error code: %s", dto.ErrorCodeOf(res))
+		}
+	}
+}
+
+// an unreachable backend should fail calls as internal errors, and client should reconnect once it's back
+func TestBackend_Reconnect(t *testing.T) {
+	server, client := startMockBackend(t, &mockBackend{})
+	defer client.Close()
+	if info := client.NodeInfo(); info == nil {
+		t.Fatalf("failed to call backend")
+	}
+	addr := server.Addr().String()
+	server.Stop()
+	if _, err := client.GetState([]byte("key")); dto.ErrorCodeOf(err) != dto.ErrInternal {
+		t.Errorf("incorrect error for unreachable backend: %s", err)
+	}
+	server = NewBackendServer(&mockBackend{})
+	if err := server.Start(addr); err != nil {
+		t.Fatalf("Failed to restart backend server: %s", err)
+	}
+	defer server.Stop()
+	if info := client.NodeInfo(); info == nil {
+		t.Errorf("client did not reconnect to backend")
+	}
+}
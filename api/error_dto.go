@@ -0,0 +1,47 @@
+// Copyright 2019 The trust-net Authors
+// API DTO for errors of rejected transaction submissions
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+)
+
+// error response body for a rejected submission, with stable code of rejection reason
+type ErrorResponse struct {
+	Code  dto.ErrorCode `json:"code"`
+	Error string        `json:"error"`
+}
+
+func NewErrorResponse(err error) *ErrorResponse {
+	return &ErrorResponse{
+		Code:  dto.ErrorCodeOf(err),
+		Error: err.Error(),
+	}
+}
+
+// HTTP status of a rejected submission's response
+func ErrorStatus(code dto.ErrorCode) int {
+	switch code {
+	case dto.ErrPayloadTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case dto.ErrRateLimited:
+		return http.StatusTooManyRequests
+	case dto.ErrAppNotRegistered, dto.ErrAppPaused:
+		return http.StatusServiceUnavailable
+	case dto.ErrInternal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusNotAcceptable
+	}
+}
+
+// write an error response for a rejected submission, with error's code in response body
+func WriteSubmitError(w http.ResponseWriter, err error) {
+	res := NewErrorResponse(err)
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(ErrorStatus(res.Code))
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,36 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteSubmitError(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		code   dto.ErrorCode
+		status int
+	}{
+		{dto.NewTxError(dto.ErrDoubleSpend, "double spend"), dto.ErrDoubleSpend, http.StatusNotAcceptable},
+		{dto.NewTxError(dto.ErrPayloadTooLarge, "too large"), dto.ErrPayloadTooLarge, http.StatusRequestEntityTooLarge},
+		{dto.NewTxError(dto.ErrAppPaused, "app paused"), dto.ErrAppPaused, http.StatusServiceUnavailable},
+		{errors.New("db failure"), dto.ErrInternal, http.StatusInternalServerError},
+	} {
+		w := httptest.NewRecorder()
+		WriteSubmitError(w, test.err)
+		res := &ErrorResponse{}
+		if w.Code != test.status {
+			t.Errorf("incorrect status: %d, expected: %d", w.Code, test.status)
+		}
+		if err := json.NewDecoder(w.Body).Decode(res); err != nil {
+			t.Errorf("failed to decode response: %s", err)
+		} else if res.Code != test.code || res.Error != test.err.Error() {
+			t.Errorf("incorrect response: %v", res)
+		}
+	}
+}
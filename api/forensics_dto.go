@@ -0,0 +1,64 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for double spend forensic records
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+)
+
+// a conflicting transaction of a double spend, with its anchor
+type ForensicTransaction struct {
+	Transaction
+	LastTx          string `json:"last_tx"`
+	ShardParent     string `json:"shard_parent"`
+	Signature       string `json:"signature"`
+	AnchorSignature string `json:"anchor_signature"`
+}
+
+func NewForensicTransaction(r *dto.TxRequest, a *dto.Anchor) *ForensicTransaction {
+	tx := dto.NewTransaction(r, a)
+	return &ForensicTransaction{
+		Transaction:     *NewTransaction(tx),
+		LastTx:          hex.EncodeToString(r.LastTx[:]),
+		ShardParent:     hex.EncodeToString(a.ShardParent[:]),
+		Signature:       base64.StdEncoding.EncodeToString(r.Signature),
+		AnchorSignature: base64.StdEncoding.EncodeToString(a.Signature),
+	}
+}
+
+// a double spend forensic record in list responses
+type ForensicRecord struct {
+	Id           string               `json:"id"`
+	SubmitterId  string               `json:"submitter_id"`
+	SubmitterSeq uint64               `json:"submitter_seq"`
+	ShardId      string               `json:"shard_id"`
+	Local        *ForensicTransaction `json:"local"`
+	Remote       *ForensicTransaction `json:"remote"`
+	PeerId       string               `json:"peer_id"`
+	PeerAddr     string               `json:"peer_addr,omitempty"`
+	Winner       string               `json:"winner"`
+	Resolution   string               `json:"resolution"`
+	// unix time (nano seconds) of detection
+	DetectedAt int64 `json:"detected_at"`
+}
+
+func NewForensicRecord(r *repo.ForensicRecord) *ForensicRecord {
+	id := r.Id()
+	return &ForensicRecord{
+		Id:           hex.EncodeToString(id[:]),
+		SubmitterId:  hex.EncodeToString(r.Submitter),
+		SubmitterSeq: r.Seq,
+		ShardId:      hex.EncodeToString(r.ShardId),
+		Local:        NewForensicTransaction(r.LocalRequest, r.LocalAnchor),
+		Remote:       NewForensicTransaction(r.RemoteRequest, r.RemoteAnchor),
+		PeerId:       hex.EncodeToString(r.PeerId),
+		PeerAddr:     r.PeerAddr,
+		Winner:       hex.EncodeToString(r.Winner[:]),
+		Resolution:   r.Resolution,
+		DetectedAt:   r.DetectedAt,
+	}
+}
@@ -0,0 +1,332 @@
+// Copyright 2019 The trust-net Authors
+// Minimal GraphQL query support (parser and executor) for API handlers
+
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// a field selected in a GraphQL query
+type gqlField struct {
+	alias  string
+	name   string
+	args   map[string]interface{}
+	fields []*gqlField
+}
+
+// resolver for a field of a GraphQL object, returns a scalar, gqlObject, []gqlObject or nil
+type gqlResolver func(args map[string]interface{}) (interface{}, error)
+
+// a GraphQL object, as a map of field names to resolvers
+type gqlObject map[string]gqlResolver
+
+// tokenizer for GraphQL query documents
+type gqlLexer struct {
+	src       string
+	pos       int
+	variables map[string]interface{}
+}
+
+const gqlPunctuators = "{}():$!=[]@"
+
+// next token, empty string at end of document
+func (l *gqlLexer) next() string {
+	tok := l.peek()
+	l.pos += len(tok)
+	return tok
+}
+
+// number of ignored characters (whitespace, commas, comments) at current position
+func (l *gqlLexer) skip() int {
+	i := l.pos
+	for i < len(l.src) {
+		switch c := l.src[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case c == '#':
+			for i < len(l.src) && l.src[i] != '\n' {
+				i++
+			}
+		default:
+			return i - l.pos
+		}
+	}
+	return i - l.pos
+}
+
+// token at current position, without consuming it
+func (l *gqlLexer) peek() string {
+	l.pos += l.skip()
+	if l.pos >= len(l.src) {
+		return ""
+	}
+	src := l.src[l.pos:]
+	switch c := src[0]; {
+	case strings.IndexByte(gqlPunctuators, c) >= 0:
+		return src[:1]
+	case c == '"':
+		for i := 1; i < len(src); i++ {
+			if src[i] == '\\' {
+				i++
+			} else if src[i] == '"' {
+				return src[:i+1]
+			}
+		}
+		return src
+	default:
+		i := 0
+		for i < len(src) && (src[i] == '_' || src[i] == '-' || src[i] == '.' ||
+			(src[i] >= '0' && src[i] <= '9') || (src[i] >= 'a' && src[i] <= 'z') || (src[i] >= 'A' && src[i] <= 'Z')) {
+			i++
+		}
+		if i == 0 {
+			return src[:1]
+		}
+		return src[:i]
+	}
+}
+
+func (l *gqlLexer) expect(tok string) error {
+	if got := l.next(); got != tok {
+		return fmt.Errorf("syntax error: expected '%s', found '%s'", tok, got)
+	}
+	return nil
+}
+
+func isGqlName(tok string) bool {
+	return len(tok) > 0 && (tok[0] == '_' || (tok[0] >= 'a' && tok[0] <= 'z') || (tok[0] >= 'A' && tok[0] <= 'Z'))
+}
+
+// parse a query document into its top level field selections
+func parseGraphQL(query string, variables map[string]interface{}) ([]*gqlField, error) {
+	l := &gqlLexer{src: query, variables: variables}
+	switch tok := l.peek(); tok {
+	case "{":
+	case "query":
+		l.next()
+		// optional operation name
+		if isGqlName(l.peek()) {
+			l.next()
+		}
+		// variable definitions are not type checked, skip them
+		if l.peek() == "(" {
+			for tok := l.next(); tok != ")"; tok = l.next() {
+				if tok == "" {
+					return nil, fmt.Errorf("syntax error: unterminated variable definitions")
+				}
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported operation: %s", tok)
+	}
+	fields, err := l.selectionSet()
+	if err != nil {
+		return nil, err
+	}
+	if tok := l.peek(); tok != "" {
+		return nil, fmt.Errorf("syntax error: unexpected '%s' after query", tok)
+	}
+	return fields, nil
+}
+
+func (l *gqlLexer) selectionSet() ([]*gqlField, error) {
+	if err := l.expect("{"); err != nil {
+		return nil, err
+	}
+	fields := []*gqlField{}
+	for l.peek() != "}" {
+		if field, err := l.field(); err != nil {
+			return nil, err
+		} else {
+			fields = append(fields, field)
+		}
+	}
+	l.next()
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("syntax error: empty selection set")
+	}
+	return fields, nil
+}
+
+func (l *gqlLexer) field() (*gqlField, error) {
+	field := &gqlField{args: make(map[string]interface{})}
+	if field.name = l.next(); !isGqlName(field.name) {
+		return nil, fmt.Errorf("syntax error: expected field name, found '%s'", field.name)
+	}
+	field.alias = field.name
+	if l.peek() == ":" {
+		l.next()
+		if field.name = l.next(); !isGqlName(field.name) {
+			return nil, fmt.Errorf("syntax error: expected field name, found '%s'", field.name)
+		}
+	}
+	if l.peek() == "(" {
+		l.next()
+		for l.peek() != ")" {
+			name := l.next()
+			if !isGqlName(name) {
+				return nil, fmt.Errorf("syntax error: expected argument name, found '%s'", name)
+			}
+			if err := l.expect(":"); err != nil {
+				return nil, err
+			}
+			if value, err := l.value(); err != nil {
+				return nil, err
+			} else {
+				field.args[name] = value
+			}
+		}
+		l.next()
+	}
+	if l.peek() == "{" {
+		if fields, err := l.selectionSet(); err != nil {
+			return nil, err
+		} else {
+			field.fields = fields
+		}
+	}
+	return field, nil
+}
+
+func (l *gqlLexer) value() (interface{}, error) {
+	tok := l.next()
+	switch {
+	case tok == "$":
+		name := l.next()
+		return l.variables[name], nil
+	case tok == "[":
+		list := []interface{}{}
+		for l.peek() != "]" {
+			if l.peek() == "" {
+				return nil, fmt.Errorf("syntax error: unterminated list")
+			}
+			if value, err := l.value(); err != nil {
+				return nil, err
+			} else {
+				list = append(list, value)
+			}
+		}
+		l.next()
+		return list, nil
+	case strings.HasPrefix(tok, "\""):
+		if value, err := strconv.Unquote(tok); err != nil {
+			return nil, fmt.Errorf("syntax error: invalid string %s", tok)
+		} else {
+			return value, nil
+		}
+	case tok == "true":
+		return true, nil
+	case tok == "false":
+		return false, nil
+	case tok == "null":
+		return nil, nil
+	default:
+		if value, err := strconv.ParseInt(tok, 10, 64); err == nil {
+			return value, nil
+		}
+		return nil, fmt.Errorf("syntax error: unsupported value '%s'", tok)
+	}
+}
+
+// depth of a selection, i.e. max nesting of its fields
+func gqlDepth(fields []*gqlField) int {
+	depth := 0
+	for _, field := range fields {
+		if d := 1 + gqlDepth(field.fields); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// estimated complexity of a selection, each field counts 1 and sub-selection of a list field counts once for
+// each item that list field may return (as per listSize, 0 for a non-list field)
+func gqlComplexity(fields []*gqlField, listSize func(field *gqlField) int) int {
+	complexity := 0
+	for _, field := range fields {
+		sub := gqlComplexity(field.fields, listSize)
+		if size := listSize(field); size > 0 {
+			sub *= size
+		}
+		complexity += 1 + sub
+	}
+	return complexity
+}
+
+// resolve selected fields of an object
+func executeGraphQL(obj gqlObject, fields []*gqlField) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, field := range fields {
+		resolver, found := obj[field.name]
+		if !found {
+			return nil, fmt.Errorf("unknown field: %s", field.name)
+		}
+		value, err := resolver(field.args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", field.alias, err)
+		}
+		if result[field.alias], err = completeGraphQL(field, value); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// complete a resolved value by resolving sub-selections of objects
+func completeGraphQL(field *gqlField, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case gqlObject:
+		if v == nil {
+			return nil, nil
+		} else if len(field.fields) == 0 {
+			return nil, fmt.Errorf("%s: object field requires a selection", field.alias)
+		}
+		return executeGraphQL(v, field.fields)
+	case []gqlObject:
+		if len(field.fields) == 0 {
+			return nil, fmt.Errorf("%s: object field requires a selection", field.alias)
+		}
+		list := make([]interface{}, 0, len(v))
+		for _, obj := range v {
+			if res, err := executeGraphQL(obj, field.fields); err != nil {
+				return nil, err
+			} else {
+				list = append(list, res)
+			}
+		}
+		return list, nil
+	default:
+		if value == nil {
+			return nil, nil
+		} else if len(field.fields) > 0 {
+			return nil, fmt.Errorf("%s: scalar field cannot have a selection", field.alias)
+		}
+		return value, nil
+	}
+}
+
+// get a required string argument
+func gqlStringArg(args map[string]interface{}, name string) (string, error) {
+	if value, ok := args[name].(string); !ok || len(value) == 0 {
+		return "", fmt.Errorf("missing argument: %s", name)
+	} else {
+		return value, nil
+	}
+}
+
+// get an optional integer argument (literals parse as int64, JSON variables decode as float64)
+func gqlIntArg(args map[string]interface{}, name string, def int) (int, error) {
+	switch value := args[name].(type) {
+	case nil:
+		return def, nil
+	case int64:
+		return int(value), nil
+	case float64:
+		return int(value), nil
+	default:
+		return 0, fmt.Errorf("invalid integer argument: %s", name)
+	}
+}
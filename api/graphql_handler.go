@@ -0,0 +1,351 @@
+// Copyright 2019 The trust-net Authors
+// GraphQL endpoint over transactions, resources and DAG structure
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"net/http"
+)
+
+// max number of items returned by a GraphQL list field
+var GraphQLMaxLimit = 100
+
+// max nesting of fields in a GraphQL query, deeper queries are rejected before execution (0 for no limit)
+var GraphQLMaxDepth = 10
+
+// max estimated complexity of a GraphQL query, i.e. number of fields resolved when list fields return their
+// max number of items, more complex queries are rejected before execution (0 for no limit)
+var GraphQLMaxComplexity = 10000
+
+// list fields of schema, estimated to return as many items as their limit argument (or GraphQLMaxLimit)
+var graphQLListFields = map[string]bool{
+	"transactions": true,
+	"children":     true,
+	"history":      true,
+	"resources":    true,
+}
+
+// A GraphQL request
+type GraphQLRequest struct {
+	Query     string                 `json:"query"`
+	Variables map[string]interface{} `json:"variables,omitempty"`
+}
+
+// response to a GraphQL request
+type GraphQLResponse struct {
+	Data   map[string]interface{} `json:"data,omitempty"`
+	Errors []GraphQLError         `json:"errors,omitempty"`
+}
+
+type GraphQLError struct {
+	Message string `json:"message"`
+}
+
+// schema (root query fields):
+//
+//	transaction(id: String!): Transaction
+//	transactions(shardId: String!, submitterId: String, limit: Int): [Transaction]
+//	resource(key: String!): Resource
+//	dagNode(id: String!): DagNode
+//	submitter(id: String!): Submitter
+//
+//	Transaction { id shardId shardSeq submitterId submitterSeq nodeId weight payload traceId parent dagNode }
+//	Resource { key value owner }
+//	DagNode { id depth transaction parent children }
+//	Submitter { id history(fromSeq: Int, limit: Int) resources }
+//	SubmitterHistory { seq transactions }
+type graphQLHandler struct {
+	dlt stack.DLT
+	db  repo.DltDb
+}
+
+// create a GraphQL handler serving queries (GET with "query" parameter, or POST with JSON body)
+// from the DLT stack, and DLT DB for transaction history and DAG structure
+func NewGraphQLHandler(dlt stack.DLT, db repo.DltDb) http.Handler {
+	return &graphQLHandler{dlt: dlt, db: db}
+}
+
+func (h *graphQLHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("content-type", "application/json")
+	req := &GraphQLRequest{}
+	if r.Method == http.MethodGet {
+		req.Query = r.URL.Query().Get("query")
+	} else if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("Malformed request: %s", err)}}})
+		return
+	}
+	res := h.Execute(req)
+	if res.Data == nil {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// execute a GraphQL query
+func (h *graphQLHandler) Execute(req *GraphQLRequest) *GraphQLResponse {
+	fields, err := parseGraphQL(req.Query, req.Variables)
+	if err != nil {
+		return &GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+	}
+	if depth := gqlDepth(fields); GraphQLMaxDepth > 0 && depth > GraphQLMaxDepth {
+		return &GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("query depth %d exceeds limit %d", depth, GraphQLMaxDepth)}}}
+	}
+	if complexity := gqlComplexity(fields, graphQLListSize); GraphQLMaxComplexity > 0 && complexity > GraphQLMaxComplexity {
+		return &GraphQLResponse{Errors: []GraphQLError{{Message: fmt.Sprintf("query complexity %d exceeds limit %d", complexity, GraphQLMaxComplexity)}}}
+	}
+	data, err := executeGraphQL(h.query(), fields)
+	if err != nil {
+		return &GraphQLResponse{Errors: []GraphQLError{{Message: err.Error()}}}
+	}
+	return &GraphQLResponse{Data: data}
+}
+
+func (h *graphQLHandler) query() gqlObject {
+	return gqlObject{
+		"transaction": func(args map[string]interface{}) (interface{}, error) {
+			if id, err := gqlHashArg(args, "id"); err != nil {
+				return nil, err
+			} else {
+				return h.transaction(h.db.GetTx(id)), nil
+			}
+		},
+		"transactions": h.transactions,
+		"resource": func(args map[string]interface{}) (interface{}, error) {
+			if key, err := gqlStringArg(args, "key"); err != nil {
+				return nil, err
+			} else if r, err := h.dlt.GetState([]byte(key)); err != nil {
+				return nil, nil
+			} else {
+				return h.resource(r), nil
+			}
+		},
+		"dagNode": func(args map[string]interface{}) (interface{}, error) {
+			if id, err := gqlHashArg(args, "id"); err != nil {
+				return nil, err
+			} else {
+				return h.dagNode(h.db.GetShardDagNode(id)), nil
+			}
+		},
+		"submitter": func(args map[string]interface{}) (interface{}, error) {
+			if id, err := gqlStringArg(args, "id"); err != nil {
+				return nil, err
+			} else if submitter, err := hex.DecodeString(id); err != nil || len(submitter) == 0 {
+				return nil, fmt.Errorf("invalid submitter id")
+			} else {
+				return h.submitter(submitter), nil
+			}
+		},
+	}
+}
+
+// transactions of a shard in canonical order, filtered by submitter
+func (h *graphQLHandler) transactions(args map[string]interface{}) (interface{}, error) {
+	shardId, err := gqlBytesArg(args, "shardId")
+	if err != nil {
+		return nil, err
+	}
+	var submitterId []byte
+	if _, found := args["submitterId"]; found {
+		if submitterId, err = gqlBytesArg(args, "submitterId"); err != nil {
+			return nil, err
+		}
+	}
+	limit, err := gqlLimitArg(args)
+	if err != nil {
+		return nil, err
+	}
+	txs, _, err := h.dlt.ShardLog(shardId, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	list := []gqlObject{}
+	for _, tx := range txs {
+		if len(list) >= limit {
+			break
+		}
+		if submitterId == nil || string(tx.Request().SubmitterId) == string(submitterId) {
+			list = append(list, h.transaction(tx))
+		}
+	}
+	return list, nil
+}
+
+func (h *graphQLHandler) transaction(tx dto.Transaction) gqlObject {
+	if tx == nil {
+		return nil
+	}
+	id := tx.Id()
+	return gqlObject{
+		"id":           gqlValue(hex.EncodeToString(id[:])),
+		"shardId":      gqlValue(hex.EncodeToString(tx.Request().ShardId)),
+		"shardSeq":     gqlValue(tx.Anchor().ShardSeq),
+		"submitterId":  gqlValue(hex.EncodeToString(tx.Request().SubmitterId)),
+		"submitterSeq": gqlValue(tx.Request().SubmitterSeq),
+		"nodeId":       gqlValue(hex.EncodeToString(tx.Anchor().NodeId)),
+		"weight":       gqlValue(tx.Anchor().Weight),
+		"payload":      gqlValue(base64.StdEncoding.EncodeToString(tx.Request().Payload)),
+		"traceId":      gqlValue(tx.TraceId()),
+		"parent": func(args map[string]interface{}) (interface{}, error) {
+			return h.transaction(h.db.GetTx(tx.Anchor().ShardParent)), nil
+		},
+		"dagNode": func(args map[string]interface{}) (interface{}, error) {
+			return h.dagNode(h.db.GetShardDagNode(id)), nil
+		},
+	}
+}
+
+func (h *graphQLHandler) resource(r *state.Resource) gqlObject {
+	return gqlObject{
+		"key":   gqlValue(string(r.Key)),
+		"value": gqlValue(base64.StdEncoding.EncodeToString(r.Value)),
+		"owner": func(args map[string]interface{}) (interface{}, error) {
+			if len(r.Owner) == 0 {
+				return gqlObject(nil), nil
+			}
+			return h.submitter(r.Owner), nil
+		},
+	}
+}
+
+func (h *graphQLHandler) dagNode(node *repo.DagNode) gqlObject {
+	if node == nil {
+		return nil
+	}
+	return gqlObject{
+		"id":    gqlValue(hex.EncodeToString(node.TxId[:])),
+		"depth": gqlValue(node.Depth),
+		"transaction": func(args map[string]interface{}) (interface{}, error) {
+			return h.transaction(h.db.GetTx(node.TxId)), nil
+		},
+		"parent": func(args map[string]interface{}) (interface{}, error) {
+			return h.dagNode(h.db.GetShardDagNode(node.Parent)), nil
+		},
+		"children": func(args map[string]interface{}) (interface{}, error) {
+			children := []gqlObject{}
+			for _, id := range node.Children {
+				if child := h.dagNode(h.db.GetShardDagNode(id)); child != nil {
+					children = append(children, child)
+				}
+			}
+			return children, nil
+		},
+	}
+}
+
+func (h *graphQLHandler) submitter(id []byte) gqlObject {
+	return gqlObject{
+		"id": gqlValue(hex.EncodeToString(id)),
+		"history": func(args map[string]interface{}) (interface{}, error) {
+			from, err := gqlIntArg(args, "fromSeq", 1)
+			if err != nil {
+				return nil, err
+			}
+			limit, err := gqlLimitArg(args)
+			if err != nil {
+				return nil, err
+			}
+			// walk submitter's sequence until first gap
+			history := []gqlObject{}
+			for seq := uint64(from); len(history) < limit; seq++ {
+				entry := h.db.GetSubmitterHistory(id, seq)
+				if entry == nil {
+					break
+				}
+				history = append(history, h.submitterHistory(entry))
+			}
+			return history, nil
+		},
+		"resources": func(args map[string]interface{}) (interface{}, error) {
+			// resources owned by submitter in registered app's world state
+			resources := []gqlObject{}
+			if h.dlt == nil {
+				return resources, nil
+			}
+			owned, err := h.dlt.ListByOwner(id)
+			if err != nil {
+				return nil, err
+			}
+			for _, r := range owned {
+				resources = append(resources, h.resource(r))
+			}
+			return resources, nil
+		},
+	}
+}
+
+func (h *graphQLHandler) submitterHistory(entry *repo.SubmitterHistory) gqlObject {
+	return gqlObject{
+		"seq": gqlValue(entry.Seq),
+		"transactions": func(args map[string]interface{}) (interface{}, error) {
+			txs := []gqlObject{}
+			for _, pair := range entry.ShardTxPairs {
+				if tx := h.transaction(h.db.GetTx(pair.TxId)); tx != nil {
+					txs = append(txs, tx)
+				}
+			}
+			return txs, nil
+		},
+	}
+}
+
+// resolver for a scalar value
+func gqlValue(value interface{}) gqlResolver {
+	return func(args map[string]interface{}) (interface{}, error) {
+		return value, nil
+	}
+}
+
+// get a required hex encoded bytes argument
+func gqlBytesArg(args map[string]interface{}, name string) ([]byte, error) {
+	if value, err := gqlStringArg(args, name); err != nil {
+		return nil, err
+	} else if bytes, err := hex.DecodeString(value); err != nil || len(bytes) == 0 {
+		return nil, fmt.Errorf("invalid argument: %s", name)
+	} else {
+		return bytes, nil
+	}
+}
+
+// get a required hex encoded 64 byte hash argument
+func gqlHashArg(args map[string]interface{}, name string) ([64]byte, error) {
+	hash := [64]byte{}
+	if bytes, err := gqlBytesArg(args, name); err != nil {
+		return hash, err
+	} else if len(bytes) != 64 {
+		return hash, fmt.Errorf("invalid argument: %s", name)
+	} else {
+		copy(hash[:], bytes)
+	}
+	return hash, nil
+}
+
+// get the limit argument for a list field, bounded by GraphQLMaxLimit
+func gqlLimitArg(args map[string]interface{}) (int, error) {
+	if limit, err := gqlIntArg(args, "limit", GraphQLMaxLimit); err != nil {
+		return 0, err
+	} else if limit <= 0 || limit > GraphQLMaxLimit {
+		return GraphQLMaxLimit, nil
+	} else {
+		return limit, nil
+	}
+}
+
+// max number of items a field may return, 0 for a non-list field
+func graphQLListSize(field *gqlField) int {
+	if !graphQLListFields[field.name] {
+		return 0
+	} else if limit, err := gqlLimitArg(field.args); err != nil {
+		return GraphQLMaxLimit
+	} else {
+		return limit
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"strings"
+	"testing"
+)
+
+func TestParseGraphQL(t *testing.T) {
+	fields, err := parseGraphQL(`query Test($id: String!) {
+		# comment
+		tx: transaction(id: $id, limit: 5) { id parent { id } }
+	}`, map[string]interface{}{"id": "abc"})
+	if err != nil {
+		t.Errorf("failed to parse query: %s", err)
+		return
+	}
+	if len(fields) != 1 || fields[0].alias != "tx" || fields[0].name != "transaction" {
+		t.Errorf("incorrect field: %v", fields)
+		return
+	}
+	if fields[0].args["id"] != "abc" || fields[0].args["limit"] != int64(5) {
+		t.Errorf("incorrect arguments: %v", fields[0].args)
+	}
+	if len(fields[0].fields) != 2 || fields[0].fields[1].fields[0].name != "id" {
+		t.Errorf("incorrect selections")
+	}
+}
+
+func TestParseGraphQL_Errors(t *testing.T) {
+	for _, query := range []string{`mutation { foo }`, `{ foo`, `{ }`, `{ foo(bar) }`, `{ foo } extra`} {
+		if _, err := parseGraphQL(query, nil); err == nil {
+			t.Errorf("query should have failed: %s", query)
+		}
+	}
+}
+
+func TestGraphQL_TransactionAndDag(t *testing.T) {
+	db := repo.NewMockDltDb()
+	parent := dto.TestSignedTransaction("parent")
+	db.AddTx(parent)
+	db.UpdateShard(parent)
+	child := dto.TestSignedTransaction("child")
+	child.Anchor().ShardParent = parent.Id()
+	db.AddTx(child)
+	db.UpdateShard(child)
+
+	h := NewGraphQLHandler(nil, db).(*graphQLHandler)
+	id := child.Id()
+	res := h.Execute(&GraphQLRequest{
+		Query:     `query ($id: String) { transaction(id: $id) { submitterSeq parent { dagNode { children { id } } } } }`,
+		Variables: map[string]interface{}{"id": hex.EncodeToString(id[:])},
+	})
+	if len(res.Errors) != 0 {
+		t.Errorf("query failed: %v", res.Errors)
+		return
+	}
+	tx := res.Data["transaction"].(map[string]interface{})
+	children := tx["parent"].(map[string]interface{})["dagNode"].(map[string]interface{})["children"].([]interface{})
+	if len(children) != 1 || children[0].(map[string]interface{})["id"] != hex.EncodeToString(id[:]) {
+		t.Errorf("incorrect DAG traversal: %v", tx)
+	}
+
+	// unknown transaction should resolve to null
+	unknown := dto.RandomHash()
+	res = h.Execute(&GraphQLRequest{Query: `{ transaction(id: "` + hex.EncodeToString(unknown[:]) + `") { id } }`})
+	if len(res.Errors) != 0 || res.Data["transaction"] != nil {
+		t.Errorf("unknown transaction should be null: %v", res)
+	}
+
+	// unknown field should fail
+	if res = h.Execute(&GraphQLRequest{Query: `{ foo }`}); len(res.Errors) == 0 {
+		t.Errorf("unknown field should fail")
+	}
+}
+
+func TestGraphQL_DepthAndComplexity(t *testing.T) {
+	fields, _ := parseGraphQL(`{ transactions(shardId: "ab", limit: 5) { id dagNode { children { id } } } }`, nil)
+	if depth := gqlDepth(fields); depth != 4 {
+		t.Errorf("incorrect depth: %d", depth)
+	}
+	// transactions + 5 x (id + dagNode + children + GraphQLMaxLimit x id)
+	if complexity := gqlComplexity(fields, graphQLListSize); complexity != 1+5*(3+GraphQLMaxLimit) {
+		t.Errorf("incorrect complexity: %d", complexity)
+	}
+}
+
+func TestGraphQL_Limits(t *testing.T) {
+	defer func(depth, complexity int) {
+		GraphQLMaxDepth, GraphQLMaxComplexity = depth, complexity
+	}(GraphQLMaxDepth, GraphQLMaxComplexity)
+	// handler without a DB, so query would fail if it was executed
+	h := NewGraphQLHandler(nil, nil).(*graphQLHandler)
+
+	GraphQLMaxDepth, GraphQLMaxComplexity = 3, 0
+	res := h.Execute(&GraphQLRequest{Query: `{ transaction(id: "ab") { parent { parent { id } } } }`})
+	if res.Data != nil || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "depth 4 exceeds limit 3") {
+		t.Errorf("deep query should be rejected: %v", res)
+	}
+
+	GraphQLMaxDepth, GraphQLMaxComplexity = 0, 100
+	res = h.Execute(&GraphQLRequest{Query: `{ transactions(shardId: "ab", limit: 50) { id submitterSeq } }`})
+	if res.Data != nil || len(res.Errors) != 1 || !strings.Contains(res.Errors[0].Message, "complexity 101 exceeds limit 100") {
+		t.Errorf("complex query should be rejected: %v", res)
+	}
+}
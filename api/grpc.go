@@ -0,0 +1,398 @@
+// Copyright 2019 The trust-net Authors
+//go:build go1.24
+// +build go1.24
+
+// gRPC server of client API (service in api/dag_api.proto), for strongly-typed non-Go clients
+
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max size of a request message
+var GrpcMaxMessageSize = 4 * 1024 * 1024
+
+// max number of accepted transactions queued for a stream client, a client falling further behind is disconnected
+var GrpcStreamBuffer = 1000
+
+// name of gRPC service, as in api/dag_api.proto
+const GrpcService = "dag.DagApi"
+
+// trailer with stable code of a rejected submission, for clients to implement targeted recovery
+const GrpcErrorCodeTrailer = "Dag-Error-Code"
+
+// gRPC status codes
+const (
+	grpcOK                 = 0
+	grpcCanceled           = 1
+	grpcInvalidArgument    = 3
+	grpcDeadlineExceeded   = 4
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcAborted            = 10
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// operations gRPC client API needs from the stack process, implemented by stack.DLT
+type GrpcBackend interface {
+	Backend
+	Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error)
+	Unwatch(id uint64)
+}
+
+type GrpcConfig struct {
+	// serve API over TLS, with optional client certificate authentication (unencrypted HTTP/2 otherwise)
+	TLS TLSConfig `json:"tls"`
+	// require calls to present one of these API keys in X-Api-Key metadata (no authentication when empty)
+	ApiKeys []ApiKey `json:"api_keys"`
+}
+
+// failure of a call with its gRPC status code
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+func newGrpcError(code int, format string, args ...interface{}) *grpcError {
+	return &grpcError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// gRPC status of a rejected submission's error code
+func grpcStatus(code dto.ErrorCode) int {
+	switch code {
+	case dto.ErrInvalidRequest, dto.ErrInvalidSignature:
+		return grpcInvalidArgument
+	case dto.ErrShardUnknown:
+		return grpcNotFound
+	case dto.ErrPayloadTooLarge, dto.ErrLimitExceeded, dto.ErrRateLimited:
+		return grpcResourceExhausted
+	case dto.ErrAppNotRegistered, dto.ErrAppPaused:
+		return grpcUnavailable
+	case dto.ErrSeqMismatch, dto.ErrStaleParent, dto.ErrStaleAnchor:
+		return grpcFailedPrecondition
+	case dto.ErrDoubleSpend, dto.ErrDuplicate:
+		return grpcAlreadyExists
+	case dto.ErrRejected:
+		return grpcAborted
+	default:
+		return grpcInternal
+	}
+}
+
+// percent-encode a status message, as required by gRPC for grpc-message trailer
+func grpcEncodeMessage(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		if c := msg[i]; c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// parse a grpc-timeout header value, e.g. "100m" for 100 milliseconds
+func grpcTimeout(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	units := map[byte]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second,
+		'm': time.Millisecond, 'u': time.Microsecond, 'n': time.Nanosecond}
+	unit, found := units[value[len(value)-1]]
+	count, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+	if !found || err != nil || count < 0 {
+		return 0, false
+	}
+	return time.Duration(count) * unit, true
+}
+
+// read a length prefixed message of a call
+func grpcReadMessage(r io.Reader, m common.ProtoMessage) error {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return newGrpcError(grpcInvalidArgument, "missing request message")
+	} else if header[0] != 0 {
+		return newGrpcError(grpcUnimplemented, "compressed messages are not supported")
+	}
+	size := binary.BigEndian.Uint32(header[1:])
+	if uint64(size) > uint64(GrpcMaxMessageSize) {
+		return newGrpcError(grpcResourceExhausted, "request message larger than %d bytes", GrpcMaxMessageSize)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return newGrpcError(grpcInvalidArgument, "truncated request message")
+	} else if err := m.UnmarshalProto(data); err != nil {
+		return newGrpcError(grpcInvalidArgument, "malformed request message: %s", err)
+	}
+	return nil
+}
+
+// write a length prefixed message of a call's response
+func grpcWriteMessage(w http.ResponseWriter, m interface{}) error {
+	data, err := common.ProtobufCodec.Marshal(m)
+	if err != nil {
+		return newGrpcError(grpcInternal, "failed to encode response: %s", err)
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	if _, err := w.Write(append(frame, data...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// a call of a service method, reading request from body and sending response messages
+type grpcMethod func(s *GrpcServer, r *http.Request, send func(m interface{}) error) error
+
+var grpcMethods = map[string]grpcMethod{
+	"GetResource":        (*GrpcServer).getResource,
+	"RequestAnchor":      (*GrpcServer).requestAnchor,
+	"SubmitTransaction":  (*GrpcServer).submitTransaction,
+	"StreamTransactions": (*GrpcServer).streamTransactions,
+}
+
+// server of gRPC client API over HTTP/2, using protobuf encoding of api/dag_api.proto
+type GrpcServer struct {
+	conf     GrpcConfig
+	backend  GrpcBackend
+	keys     map[string]*ApiKey
+	server   *http.Server
+	listener net.Listener
+	lock     sync.Mutex
+	logger   log.Logger
+}
+
+// create a gRPC server of client API calls, answered from a backend (e.g. DLT stack)
+func NewGrpcServer(backend GrpcBackend, conf GrpcConfig) *GrpcServer {
+	s := &GrpcServer{
+		conf:    conf,
+		backend: backend,
+		logger:  log.NewLogger("gRPC Server"),
+	}
+	if len(conf.ApiKeys) > 0 {
+		s.keys = make(map[string]*ApiKey)
+		for i := range conf.ApiKeys {
+			s.keys[conf.ApiKeys[i].Key] = &conf.ApiKeys[i]
+		}
+	}
+	return s
+}
+
+func (s *GrpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("content-type"), "application/grpc") {
+		http.Error(w, "gRPC requests only", http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("content-type", "application/grpc")
+	w.WriteHeader(http.StatusOK)
+	// send headers right away, so that stream clients do not wait for first message
+	http.NewResponseController(w).Flush()
+	if timeout, ok := grpcTimeout(r.Header.Get("grpc-timeout")); ok {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+	var err error
+	if method, found := grpcMethods[strings.TrimPrefix(r.URL.Path, "/"+GrpcService+"/")]; !found {
+		err = newGrpcError(grpcUnimplemented, "unknown method: %s", r.URL.Path)
+	} else if key, found := s.keys[r.Header.Get(ApiKeyHeader)]; s.keys != nil && !found {
+		err = newGrpcError(grpcUnauthenticated, "missing or invalid API key")
+	} else {
+		if key != nil {
+			r = r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key))
+		}
+		err = method(s, r, func(m interface{}) error { return grpcWriteMessage(w, m) })
+	}
+	s.writeStatus(w, r, err)
+}
+
+// write call's status into trailers
+func (s *GrpcServer) writeStatus(w http.ResponseWriter, r *http.Request, err error) {
+	code := grpcOK
+	if e, ok := err.(*grpcError); ok {
+		code = e.code
+	} else if err == context.DeadlineExceeded {
+		code = grpcDeadlineExceeded
+	} else if err == context.Canceled {
+		code = grpcCanceled
+	} else if err != nil {
+		txCode := dto.ErrorCodeOf(err)
+		code = grpcStatus(txCode)
+		w.Header().Set(http.TrailerPrefix+GrpcErrorCodeTrailer, string(txCode))
+	}
+	if err != nil {
+		s.logger.Debug("Failed %s from %s: %s", r.URL.Path, r.RemoteAddr, err)
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(err.Error()))
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+}
+
+func (s *GrpcServer) getResource(r *http.Request, send func(m interface{}) error) error {
+	req := &GrpcResourceRequest{}
+	if err := grpcReadMessage(r.Body, req); err != nil {
+		return err
+	} else if len(req.Key) == 0 {
+		return newGrpcError(grpcInvalidArgument, "missing key")
+	} else if len(req.ShardId) == 0 {
+		return newGrpcError(grpcInvalidArgument, "missing shard id")
+	} else if err := Authorize(r, nil, req.ShardId); err != nil {
+		return newGrpcError(grpcPermissionDenied, "%s", err)
+	}
+	var res *state.Resource
+	var err error
+	if req.Seq > 0 {
+		res, err = s.backend.GetStateAtSeq(req.ShardId, req.Seq, req.Key)
+	} else {
+		res, err = s.backend.GetShardState(req.ShardId, req.Key)
+	}
+	if err != nil {
+		return newGrpcError(grpcNotFound, "%s", err)
+	}
+	return send((*GrpcResource)(res))
+}
+
+func (s *GrpcServer) requestAnchor(r *http.Request, send func(m interface{}) error) error {
+	req := &GrpcAnchorRequest{}
+	if err := grpcReadMessage(r.Body, req); err != nil {
+		return err
+	} else if len(req.SubmitterId) == 0 || req.SubmitterSeq == 0 {
+		return newGrpcError(grpcInvalidArgument, "missing submitter id or sequence")
+	} else if err := Authorize(r, req.SubmitterId, nil); err != nil {
+		return newGrpcError(grpcPermissionDenied, "%s", err)
+	}
+	if anchor := s.backend.Anchor(req.SubmitterId, req.SubmitterSeq, req.LastTx); anchor == nil {
+		return newGrpcError(grpcUnavailable, "failed to get anchor")
+	} else {
+		return send(anchor)
+	}
+}
+
+func (s *GrpcServer) submitTransaction(r *http.Request, send func(m interface{}) error) error {
+	req := &GrpcSubmitRequest{}
+	if err := grpcReadMessage(r.Body, req); err != nil {
+		return err
+	} else if req.Request == nil {
+		return newGrpcError(grpcInvalidArgument, "missing transaction request")
+	} else if err := Authorize(r, req.Request.SubmitterId, req.Request.ShardId); err != nil {
+		return newGrpcError(grpcPermissionDenied, "%s", err)
+	}
+	if tx, err := s.backend.SubmitWithTrace(req.Request, req.TraceId); err != nil {
+		return err
+	} else {
+		return send(tx)
+	}
+}
+
+func (s *GrpcServer) streamTransactions(r *http.Request, send func(m interface{}) error) error {
+	req := &GrpcStreamRequest{}
+	if err := grpcReadMessage(r.Body, req); err != nil {
+		return err
+	} else if len(req.ShardId) == 0 {
+		return newGrpcError(grpcInvalidArgument, "missing shard id")
+	} else if err := Authorize(r, nil, req.ShardId); err != nil {
+		return newGrpcError(grpcPermissionDenied, "%s", err)
+	}
+	txs, lagged, once := make(chan dto.Transaction, GrpcStreamBuffer), make(chan struct{}), sync.Once{}
+	id, err := s.backend.Watch(req.ShardId, func(tx dto.Transaction) {
+		select {
+		case txs <- tx:
+		default:
+			once.Do(func() { close(lagged) })
+		}
+	})
+	if err != nil {
+		return newGrpcError(grpcInternal, "failed to watch shard: %s", err)
+	}
+	defer s.backend.Unwatch(id)
+	for {
+		select {
+		case <-r.Context().Done():
+			return r.Context().Err()
+		case <-lagged:
+			return newGrpcError(grpcResourceExhausted, "stream fell behind by more than %d transactions", GrpcStreamBuffer)
+		case tx := <-txs:
+			if err := send(tx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// listen on an address, and serve calls in background until server is stopped
+func (s *GrpcServer) Start(addr string) error {
+	tlsConf, err := s.conf.TLS.tlsConfig()
+	if err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	protocols := &http.Protocols{}
+	protocols.SetHTTP2(true)
+	protocols.SetUnencryptedHTTP2(tlsConf == nil)
+	server := &http.Server{
+		Handler:   Recovery(s.logger, s),
+		TLSConfig: tlsConf,
+		Protocols: protocols,
+	}
+	s.lock.Lock()
+	s.server, s.listener = server, listener
+	s.lock.Unlock()
+	go func() {
+		var err error
+		if tlsConf != nil {
+			// certificates are already loaded into TLS config
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			err = server.Serve(listener)
+		}
+		s.logger.Debug("Stopped serving gRPC calls: %s", err)
+	}()
+	return nil
+}
+
+// address server is listening on, nil if not started
+func (s *GrpcServer) Addr() net.Addr {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Addr()
+}
+
+// stop listening, and disconnect clients
+func (s *GrpcServer) Stop() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.server != nil {
+		s.server.Close()
+		s.server, s.listener = nil, nil
+	}
+}
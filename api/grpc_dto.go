@@ -0,0 +1,154 @@
+// Copyright 2019 The trust-net Authors
+// Messages of gRPC client API, encoded as per schema in api/dag_api.proto
+
+package api
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+)
+
+// request of GetResource, as of shard's sequence when Seq is non zero
+type GrpcResourceRequest struct {
+	Key     []byte
+	ShardId []byte
+	Seq     uint64
+}
+
+func (r *GrpcResourceRequest) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, r.Key)
+	w.Bytes(2, r.ShardId)
+	w.Uint64(3, r.Seq)
+	return w.Result(), nil
+}
+
+func (r *GrpcResourceRequest) UnmarshalProto(data []byte) error {
+	*r = GrpcResourceRequest{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.Key = pr.Bytes()
+		case 2:
+			r.ShardId = pr.Bytes()
+		case 3:
+			r.Seq = pr.Uint64()
+		}
+	}
+	return pr.Err()
+}
+
+// response of GetResource
+type GrpcResource state.Resource
+
+func (r *GrpcResource) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, r.Key)
+	w.Bytes(2, r.Owner)
+	w.Bytes(3, r.Value)
+	return w.Result(), nil
+}
+
+func (r *GrpcResource) UnmarshalProto(data []byte) error {
+	*r = GrpcResource{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.Key = pr.Bytes()
+		case 2:
+			r.Owner = pr.Bytes()
+		case 3:
+			r.Value = pr.Bytes()
+		}
+	}
+	return pr.Err()
+}
+
+// request of RequestAnchor
+type GrpcAnchorRequest struct {
+	SubmitterId  []byte
+	SubmitterSeq uint64
+	LastTx       [64]byte
+}
+
+func (r *GrpcAnchorRequest) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, r.SubmitterId)
+	w.Uint64(2, r.SubmitterSeq)
+	w.Hash(3, r.LastTx)
+	return w.Result(), nil
+}
+
+func (r *GrpcAnchorRequest) UnmarshalProto(data []byte) error {
+	*r = GrpcAnchorRequest{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.SubmitterId = pr.Bytes()
+		case 2:
+			r.SubmitterSeq = pr.Uint64()
+		case 3:
+			r.LastTx = pr.Hash()
+		}
+	}
+	return pr.Err()
+}
+
+// request of SubmitTransaction
+type GrpcSubmitRequest struct {
+	Request *dto.TxRequest
+	TraceId string
+}
+
+func (r *GrpcSubmitRequest) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	if r.Request != nil {
+		if err := w.Message(1, r.Request); err != nil {
+			return nil, err
+		}
+	}
+	w.Bytes(2, []byte(r.TraceId))
+	return w.Result(), nil
+}
+
+func (r *GrpcSubmitRequest) UnmarshalProto(data []byte) error {
+	*r = GrpcSubmitRequest{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.Request = &dto.TxRequest{}
+			pr.Message(r.Request)
+		case 2:
+			r.TraceId = string(pr.Bytes())
+		}
+	}
+	return pr.Err()
+}
+
+// request of StreamTransactions
+type GrpcStreamRequest struct {
+	ShardId []byte
+}
+
+func (r *GrpcStreamRequest) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, r.ShardId)
+	return w.Result(), nil
+}
+
+func (r *GrpcStreamRequest) UnmarshalProto(data []byte) error {
+	*r = GrpcStreamRequest{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.ShardId = pr.Bytes()
+		}
+	}
+	return pr.Err()
+}
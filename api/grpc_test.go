@@ -0,0 +1,225 @@
+// Copyright 2019 The trust-net Authors
+//go:build go1.24
+// +build go1.24
+
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// DLT stack should serve as gRPC backend
+var _ GrpcBackend = stack.DLT(nil)
+
+// backend with a shard watch, set by server's stream goroutine
+type mockGrpcBackend struct {
+	mockBackend
+	watch func(tx dto.Transaction)
+	lock  sync.Mutex
+}
+
+func (b *mockGrpcBackend) Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.watch = handler
+	return 1, nil
+}
+
+func (b *mockGrpcBackend) watcher() func(tx dto.Transaction) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.watch
+}
+
+func (b *mockGrpcBackend) Unwatch(id uint64) {}
+
+func startGrpcServer(t *testing.T, backend GrpcBackend, conf GrpcConfig) *GrpcServer {
+	server := NewGrpcServer(backend, conf)
+	if err := server.Start("127.0.0.1:0"); err != nil {
+		t.Fatalf("Failed to start gRPC server: %s", err)
+	}
+	return server
+}
+
+// HTTP/2 client without TLS, as used by gRPC clients with insecure credentials
+func grpcTestClient() *http.Client {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	return &http.Client{Transport: &http.Transport{Protocols: protocols}}
+}
+
+func grpcFrame(m common.ProtoMessage) []byte {
+	data, _ := m.MarshalProto()
+	frame := make([]byte, 5)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func grpcReadFrame(r io.Reader) ([]byte, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header[1:]))
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+func grpcCall(ctx context.Context, server *GrpcServer, method string, req common.ProtoMessage, apiKey string) (*http.Response, error) {
+	r, _ := http.NewRequestWithContext(ctx, "POST", "http://"+server.Addr().String()+"/"+GrpcService+"/"+method, bytes.NewReader(grpcFrame(req)))
+	r.Header.Set("content-type", "application/grpc")
+	r.Header.Set("te", "trailers")
+	if len(apiKey) > 0 {
+		r.Header.Set(ApiKeyHeader, apiKey)
+	}
+	return grpcTestClient().Do(r)
+}
+
+// make a unary call, returns response message and call's status trailers
+func grpcUnary(t *testing.T, server *GrpcServer, method string, req common.ProtoMessage, apiKey string) ([]byte, int, http.Header) {
+	res, err := grpcCall(context.Background(), server, method, req, apiKey)
+	if err != nil {
+		t.Fatalf("Failed to call %s: %s", method, err)
+	}
+	defer res.Body.Close()
+	data, _ := grpcReadFrame(res.Body)
+	io.Copy(io.Discard, res.Body)
+	status, err := strconv.Atoi(res.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("Missing status of %s: %v", method, res.Trailer)
+	}
+	return data, status, res.Trailer
+}
+
+func TestGrpc_Unary(t *testing.T) {
+	server := startGrpcServer(t, &mockGrpcBackend{}, GrpcConfig{})
+	defer server.Stop()
+	data, status, _ := grpcUnary(t, server, "GetResource", &GrpcResourceRequest{Key: []byte("key1"), ShardId: []byte("shard")}, "")
+	resource := &GrpcResource{}
+	if status != grpcOK || resource.UnmarshalProto(data) != nil || string(resource.Key) != "key1" || string(resource.Value) != "current in shard" {
+		t.Errorf("Incorrect resource: %d, %v", status, resource)
+	}
+	if _, status, _ = grpcUnary(t, server, "GetResource", &GrpcResourceRequest{Key: []byte("key1")}, ""); status != grpcInvalidArgument {
+		t.Errorf("Expected resource without shard to be invalid, got: %d", status)
+	}
+	if _, status, _ = grpcUnary(t, server, "GetResource", &GrpcResourceRequest{Key: []byte("key1"), ShardId: []byte("shard"), Seq: 2}, ""); status != grpcNotFound {
+		t.Errorf("Expected resource at sequence not found, got: %d", status)
+	}
+	data, status, _ = grpcUnary(t, server, "RequestAnchor", &GrpcAnchorRequest{SubmitterId: []byte("submitter"), SubmitterSeq: 7}, "")
+	anchor := &dto.Anchor{}
+	if status != grpcOK || anchor.UnmarshalProto(data) != nil || anchor.ShardSeq != 7 {
+		t.Errorf("Incorrect anchor: %d, %v", status, anchor)
+	}
+	req := dto.TestSignedTransaction("test payload").Request()
+	data, status, _ = grpcUnary(t, server, "SubmitTransaction", &GrpcSubmitRequest{Request: req, TraceId: "trace-1"}, "")
+	tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if status != grpcOK || common.ProtobufCodec.Unmarshal(data, tx) != nil || string(tx.Request().Payload) != "test payload" || tx.TraceId() != "trace-1" {
+		t.Errorf("Incorrect submitted transaction: %d, %v", status, tx)
+	}
+	if _, status, _ = grpcUnary(t, server, "NoSuchMethod", &GrpcStreamRequest{}, ""); status != grpcUnimplemented {
+		t.Errorf("Expected unknown method to be unimplemented, got: %d", status)
+	}
+}
+
+// rejected submission should fail with a gRPC status and its stable error code
+func TestGrpc_SubmitError(t *testing.T) {
+	backend := &mockGrpcBackend{}
+	backend.submitErr = dto.NewTxError(dto.ErrSeqMismatch, "unknown previous sequence")
+	server := startGrpcServer(t, backend, GrpcConfig{})
+	defer server.Stop()
+	req := dto.TestSignedTransaction("test payload").Request()
+	_, status, trailer := grpcUnary(t, server, "SubmitTransaction", &GrpcSubmitRequest{Request: req}, "")
+	if status != grpcFailedPrecondition || trailer.Get(GrpcErrorCodeTrailer) != string(dto.ErrSeqMismatch) ||
+		trailer.Get("Grpc-Message") != "unknown previous sequence" {
+		t.Errorf("Incorrect error: %d, %v", status, trailer)
+	}
+	if _, status, _ = grpcUnary(t, server, "SubmitTransaction", &GrpcSubmitRequest{}, ""); status != grpcInvalidArgument {
+		t.Errorf("Expected missing request to be invalid, got: %d", status)
+	}
+}
+
+func TestGrpc_ApiKeys(t *testing.T) {
+	conf := GrpcConfig{ApiKeys: []ApiKey{{Key: "key1", Submitters: []string{"0102"}}}}
+	server := startGrpcServer(t, &mockGrpcBackend{}, conf)
+	defer server.Stop()
+	req := &GrpcAnchorRequest{SubmitterId: []byte{1, 2}, SubmitterSeq: 1}
+	if _, status, _ := grpcUnary(t, server, "RequestAnchor", req, ""); status != grpcUnauthenticated {
+		t.Errorf("Expected call without key to be unauthenticated, got: %d", status)
+	}
+	if _, status, _ := grpcUnary(t, server, "RequestAnchor", req, "key1"); status != grpcOK {
+		t.Errorf("Expected call with key to succeed, got: %d", status)
+	}
+	req.SubmitterId = []byte{3, 4}
+	if _, status, _ := grpcUnary(t, server, "RequestAnchor", req, "key1"); status != grpcPermissionDenied {
+		t.Errorf("Expected call for other submitter to be denied, got: %d", status)
+	}
+}
+
+// a key bound to a shard should not read resources of another shard
+func TestGrpc_ApiKeyShardResource(t *testing.T) {
+	conf := GrpcConfig{ApiKeys: []ApiKey{{Key: "key1", Shards: []string{hex.EncodeToString([]byte("shard A"))}}}}
+	server := startGrpcServer(t, &mockGrpcBackend{}, conf)
+	defer server.Stop()
+	data, status, _ := grpcUnary(t, server, "GetResource", &GrpcResourceRequest{Key: []byte("key1"), ShardId: []byte("shard A")}, "key1")
+	resource := &GrpcResource{}
+	if status != grpcOK || resource.UnmarshalProto(data) != nil || string(resource.Value) != "current in shard A" {
+		t.Errorf("Incorrect resource of bound shard: %d, %v", status, resource)
+	}
+	if _, status, _ := grpcUnary(t, server, "GetResource", &GrpcResourceRequest{Key: []byte("key1"), ShardId: []byte("shard B")}, "key1"); status != grpcPermissionDenied {
+		t.Errorf("Expected resource of other shard to be denied, got: %d", status)
+	}
+}
+
+// accepted transactions of a shard should be streamed to client until it cancels
+func TestGrpc_StreamTransactions(t *testing.T) {
+	backend := &mockGrpcBackend{}
+	server := startGrpcServer(t, backend, GrpcConfig{})
+	defer server.Stop()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, err := grpcCall(ctx, server, "StreamTransactions", &GrpcStreamRequest{ShardId: []byte("shard")}, "")
+	if err != nil {
+		t.Fatalf("Failed to open stream: %s", err)
+	}
+	defer res.Body.Close()
+	watch := backend.watcher()
+	for wait := 0; watch == nil && wait < 100; wait++ {
+		time.Sleep(10 * time.Millisecond)
+		watch = backend.watcher()
+	}
+	if watch == nil {
+		t.Fatalf("Stream did not watch shard")
+	}
+	sent := []dto.Transaction{dto.TestSignedTransaction("payload 1"), dto.TestSignedTransaction("payload 2")}
+	for _, tx := range sent {
+		watch(tx)
+	}
+	for _, expected := range sent {
+		data, err := grpcReadFrame(res.Body)
+		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+		if err != nil || common.ProtobufCodec.Unmarshal(data, tx) != nil || tx.Id() != expected.Id() {
+			t.Errorf("Incorrect streamed transaction: %s", err)
+		}
+	}
+}
+
+func TestGrpcTimeout(t *testing.T) {
+	if d, ok := grpcTimeout("100m"); !ok || d != 100*time.Millisecond {
+		t.Errorf("Incorrect timeout: %s", d)
+	}
+	if _, ok := grpcTimeout("10x"); ok {
+		t.Errorf("Expected unknown unit to fail")
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for local labels and notes on transactions
+
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"net/http"
+)
+
+// A request to replace a transaction's labels and note (empty to remove), from path parameter {id}
+// (hex encoded transaction ID) and JSON body
+type LabelsRequest struct {
+	Labels []string `json:"labels"`
+	Note   string   `json:"note"`
+	txId   [64]byte
+}
+
+func (req *LabelsRequest) TxId() [64]byte {
+	return req.txId
+}
+
+func ParseLabelsRequest(r *http.Request, id string) (*LabelsRequest, error) {
+	req, v := &LabelsRequest{}, &validator{}
+	req.txId = v.hash("id", id)
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	for _, label := range req.Labels {
+		if len(label) == 0 {
+			v.fail("labels", "empty label")
+			break
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// labels and note attached to a transaction
+type TxLabels struct {
+	TxId   string   `json:"tx_id"`
+	Labels []string `json:"labels"`
+	Note   string   `json:"note,omitempty"`
+}
+
+func NewTxLabels(txId [64]byte, labels *repo.TxLabels) *TxLabels {
+	res := &TxLabels{
+		TxId:   hex.EncodeToString(txId[:]),
+		Labels: []string{},
+	}
+	if labels != nil {
+		res.Labels = append(res.Labels, labels.Labels...)
+		res.Note = labels.Note
+	}
+	return res
+}
@@ -0,0 +1,164 @@
+// Copyright 2019 The trust-net Authors
+// Pagination, filtering and field selection conventions for API list endpoints
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default number of items in a page of list response
+var DefaultListLimit = 20
+
+// max number of items in a page of list response
+var MaxListLimit = 100
+
+// query parameters common to all list endpoints:
+//
+//	limit:  number of items in page (default DefaultListLimit, max MaxListLimit)
+//	cursor: opaque cursor from "next_cursor" of previous page
+//	fields: comma separated names of fields to include in each item (default all)
+//	sort:   name of field to sort items by, prefixed with "-" for descending order
+type ListParams struct {
+	Limit  int
+	Offset int
+	Fields []string
+	Sort   string
+	Desc   bool
+}
+
+// a page of list response
+type ListResponse struct {
+	Items      []map[string]interface{} `json:"items"`
+	NextCursor string                   `json:"next_cursor,omitempty"`
+	Total      int                      `json:"total"`
+}
+
+func ParseListParams(r *http.Request) (*ListParams, error) {
+	query := r.URL.Query()
+	params := &ListParams{
+		Limit: DefaultListLimit,
+	}
+	if value := query.Get("limit"); len(value) > 0 {
+		if limit, err := strconv.Atoi(value); err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit")
+		} else if limit > MaxListLimit {
+			params.Limit = MaxListLimit
+		} else {
+			params.Limit = limit
+		}
+	}
+	if value := query.Get("cursor"); len(value) > 0 {
+		if offset, err := decodeListCursor(value); err != nil {
+			return nil, err
+		} else {
+			params.Offset = offset
+		}
+	}
+	if value := query.Get("fields"); len(value) > 0 {
+		params.Fields = strings.Split(value, ",")
+	}
+	if value := query.Get("sort"); len(value) > 0 {
+		params.Sort, params.Desc = strings.TrimPrefix(value, "-"), strings.HasPrefix(value, "-")
+	}
+	return params, nil
+}
+
+func encodeListCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeListCursor(cursor string) (int, error) {
+	if bytes, err := base64.RawURLEncoding.DecodeString(cursor); err != nil {
+		return 0, fmt.Errorf("invalid cursor")
+	} else if offset, err := strconv.Atoi(string(bytes)); err != nil || offset < 0 {
+		return 0, fmt.Errorf("invalid cursor")
+	} else {
+		return offset, nil
+	}
+}
+
+// build a page of list response from items (any JSON serializable DTOs), applying sort, paging and field selection
+func (p *ListParams) Page(items []interface{}) (*ListResponse, error) {
+	// convert items to their JSON representation, for sorting and field selection by JSON field names
+	maps := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		m := make(map[string]interface{})
+		if data, err := json.Marshal(item); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		maps = append(maps, m)
+	}
+	if len(p.Sort) > 0 {
+		for _, m := range maps {
+			if _, found := m[p.Sort]; !found {
+				return nil, fmt.Errorf("invalid sort field: %s", p.Sort)
+			}
+		}
+		sort.SliceStable(maps, func(i, j int) bool {
+			if p.Desc {
+				return lessListValue(maps[j][p.Sort], maps[i][p.Sort])
+			}
+			return lessListValue(maps[i][p.Sort], maps[j][p.Sort])
+		})
+	}
+	res := &ListResponse{
+		Items: []map[string]interface{}{},
+		Total: len(maps),
+	}
+	end := p.Offset + p.Limit
+	if end < len(maps) {
+		res.NextCursor = encodeListCursor(end)
+	} else {
+		end = len(maps)
+	}
+	for i := p.Offset; i < end; i++ {
+		res.Items = append(res.Items, p.selectFields(maps[i]))
+	}
+	return res, nil
+}
+
+func (p *ListParams) selectFields(m map[string]interface{}) map[string]interface{} {
+	if len(p.Fields) == 0 {
+		return m
+	}
+	selected := make(map[string]interface{})
+	for _, field := range p.Fields {
+		if value, found := m[field]; found {
+			selected[field] = value
+		}
+	}
+	return selected
+}
+
+// compare JSON values of a sort field, numbers numerically and everything else as strings
+func lessListValue(a, b interface{}) bool {
+	if x, ok := a.(float64); ok {
+		if y, ok := b.(float64); ok {
+			return x < y
+		}
+	}
+	return fmt.Sprintf("%v", a) < fmt.Sprintf("%v", b)
+}
+
+// write a page of list response for items as per request's list parameters
+func WriteList(w http.ResponseWriter, r *http.Request, items []interface{}) {
+	w.Header().Set("content-type", "application/json")
+	if params, err := ParseListParams(r); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+	} else if res, err := params.Page(items); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(err.Error())
+	} else {
+		json.NewEncoder(w).Encode(res)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for items of list endpoints
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"time"
+)
+
+// a transaction in list responses
+type Transaction struct {
+	TxId         string `json:"tx_id"`
+	ShardId      string `json:"shard_id"`
+	ShardSeq     uint64 `json:"shard_seq"`
+	SubmitterId  string `json:"submitter_id"`
+	SubmitterSeq uint64 `json:"submitter_seq"`
+	NodeId       string `json:"node_id"`
+	Weight       uint64 `json:"weight"`
+	Payload      string `json:"payload"`
+	TraceId      string `json:"trace_id,omitempty"`
+}
+
+func NewTransaction(tx dto.Transaction) *Transaction {
+	id := tx.Id()
+	return &Transaction{
+		TxId:         hex.EncodeToString(id[:]),
+		ShardId:      hex.EncodeToString(tx.Request().ShardId),
+		ShardSeq:     tx.Anchor().ShardSeq,
+		SubmitterId:  hex.EncodeToString(tx.Request().SubmitterId),
+		SubmitterSeq: tx.Request().SubmitterSeq,
+		NodeId:       hex.EncodeToString(tx.Anchor().NodeId),
+		Weight:       tx.Anchor().Weight,
+		Payload:      base64.StdEncoding.EncodeToString(tx.Request().Payload),
+		TraceId:      tx.TraceId(),
+	}
+}
+
+// a shard in list responses
+type Shard struct {
+	ShardId      string `json:"shard_id"`
+	TxCount      uint64 `json:"tx_count"`
+	TotalTxCount uint64 `json:"total_tx_count"`
+	AvgPayload   uint64 `json:"avg_payload"`
+}
+
+func NewShard(shardId []byte, stats *shard.ShardStats) *Shard {
+	res := &Shard{
+		ShardId: hex.EncodeToString(shardId),
+	}
+	if stats != nil {
+		res.TxCount = stats.TxCount
+		res.TotalTxCount = stats.TotalTxCount
+		res.AvgPayload = stats.AvgPayload()
+	}
+	return res
+}
+
+// a shard abandoned by its apps in list responses
+type AbandonedShard struct {
+	ShardId   string `json:"shard_id"`
+	TxCount   uint64 `json:"tx_count"`
+	LatestSeq uint64 `json:"latest_seq"`
+	// time node last added a transaction to shard, in RFC3339 format
+	LastTxAt string `json:"last_tx_at"`
+}
+
+func NewAbandonedShard(info *repo.ShardInfo) *AbandonedShard {
+	return &AbandonedShard{
+		ShardId:   hex.EncodeToString(info.ShardId),
+		TxCount:   info.TxCount,
+		LatestSeq: info.LatestSeq,
+		LastTxAt:  time.Unix(0, info.LastTxAt).UTC().Format(time.RFC3339),
+	}
+}
+
+// an entry of submitter's history in list responses
+type SubmitterHistory struct {
+	SubmitterId string   `json:"submitter_id"`
+	Seq         uint64   `json:"seq"`
+	ShardIds    []string `json:"shard_ids"`
+	TxIds       []string `json:"tx_ids"`
+}
+
+func NewSubmitterHistory(h *repo.SubmitterHistory) *SubmitterHistory {
+	res := &SubmitterHistory{
+		SubmitterId: hex.EncodeToString(h.Submitter),
+		Seq:         h.Seq,
+		ShardIds:    []string{},
+		TxIds:       []string{},
+	}
+	for _, pair := range h.ShardTxPairs {
+		res.ShardIds = append(res.ShardIds, hex.EncodeToString(pair.ShardId))
+		res.TxIds = append(res.TxIds, hex.EncodeToString(pair.TxId[:]))
+	}
+	return res
+}
+
+// a stack event in list responses
+type Event struct {
+	Type    string `json:"type"`
+	TxId    string `json:"tx_id"`
+	ShardId string `json:"shard_id"`
+	Reason  uint64 `json:"reason"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func NewEvent(e *stack.Event) *Event {
+	res := &Event{
+		TxId:    hex.EncodeToString(e.TxId[:]),
+		ShardId: hex.EncodeToString(e.ShardId),
+		Reason:  e.Reason,
+		Detail:  e.Detail,
+	}
+	switch e.Type {
+	case stack.EVENT_TX_REJECTED:
+		res.Type = "tx_rejected"
+	case stack.EVENT_DOUBLE_SPEND:
+		res.Type = "double_spend"
+	default:
+		res.Type = "unknown"
+	}
+	return res
+}
@@ -0,0 +1,62 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+type testItem struct {
+	Name  string `json:"name"`
+	Value int    `json:"value"`
+}
+
+func testItems() []interface{} {
+	return []interface{}{&testItem{"b", 2}, &testItem{"a", 10}, &testItem{"c", 1}}
+}
+
+func TestListParams_Paging(t *testing.T) {
+	params, err := ParseListParams(httptest.NewRequest("GET", "/items?limit=2", nil))
+	if err != nil {
+		t.Errorf("failed to parse params: %s", err)
+		return
+	}
+	page, _ := params.Page(testItems())
+	if len(page.Items) != 2 || page.Total != 3 || len(page.NextCursor) == 0 {
+		t.Errorf("incorrect first page: %v", page)
+		return
+	}
+	params, _ = ParseListParams(httptest.NewRequest("GET", "/items?limit=2&cursor="+page.NextCursor, nil))
+	page, _ = params.Page(testItems())
+	if len(page.Items) != 1 || page.Items[0]["name"] != "c" || len(page.NextCursor) != 0 {
+		t.Errorf("incorrect last page: %v", page)
+	}
+}
+
+func TestListParams_SortAndFields(t *testing.T) {
+	params, _ := ParseListParams(httptest.NewRequest("GET", "/items?sort=-value&fields=name", nil))
+	page, err := params.Page(testItems())
+	if err != nil {
+		t.Errorf("failed to build page: %s", err)
+		return
+	}
+	if page.Items[0]["name"] != "a" || page.Items[2]["name"] != "c" {
+		t.Errorf("incorrect sort order: %v", page.Items)
+	}
+	if _, found := page.Items[0]["value"]; found {
+		t.Errorf("unselected field should not be included")
+	}
+	// sort by unknown field should fail
+	params, _ = ParseListParams(httptest.NewRequest("GET", "/items?sort=foo", nil))
+	if _, err := params.Page(testItems()); err == nil {
+		t.Errorf("sort by unknown field should fail")
+	}
+}
+
+func TestParseListParams_Invalid(t *testing.T) {
+	for _, query := range []string{"limit=0", "limit=abc", "cursor=@@"} {
+		if _, err := ParseListParams(httptest.NewRequest("GET", "/items?"+query, nil)); err == nil {
+			t.Errorf("params should be invalid: %s", query)
+		}
+	}
+}
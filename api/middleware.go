@@ -0,0 +1,133 @@
+// Copyright 2019 The trust-net Authors
+// HTTP middleware for API server
+
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// response writer that records status and size of response, for access logs
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += n
+	return n, err
+}
+
+// hijack underlying connection, e.g. for WebSocket upgrade
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	if w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+// log each request with its status, size and latency
+func AccessLog(logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		logger.Info("method=%s path=%s status=%d bytes=%d latency=%s remote=%s trace=%s",
+			r.Method, r.URL.Path, sw.status, sw.bytes, time.Since(start), r.RemoteAddr, r.Header.Get("X-Trace-Id"))
+	})
+}
+
+// recover from a panic in handler, responding with 500 instead of dropping the connection
+func Recovery(logger log.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				logger.Error("ALERT: panic serving %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+				w.Header().Set("content-type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				json.NewEncoder(w).Encode("internal server error")
+			}
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// cross-origin resource sharing configuration
+type CorsConfig struct {
+	// origins allowed to make cross-origin requests ("*" for any origin), CORS is disabled when empty
+	AllowedOrigins []string `json:"allowed_origins"`
+	// methods allowed for cross-origin requests (default GET, POST)
+	AllowedMethods []string `json:"allowed_methods"`
+	// request headers allowed for cross-origin requests (default Content-Type, X-Trace-Id, X-Api-Key)
+	AllowedHeaders []string `json:"allowed_headers"`
+	// seconds for which browsers can cache preflight response
+	MaxAge int `json:"max_age"`
+}
+
+func (c *CorsConfig) allowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// add CORS headers to responses for allowed origins, and answer preflight requests
+func Cors(conf CorsConfig, next http.Handler) http.Handler {
+	methods, headers := conf.AllowedMethods, conf.AllowedHeaders
+	if len(methods) == 0 {
+		methods = []string{"GET", "POST"}
+	}
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "X-Trace-Id", ApiKeyHeader}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if len(origin) == 0 || !conf.allowed(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Add("Vary", "Origin")
+		if r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0 {
+			// preflight request
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			if conf.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(conf.MaxAge))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,128 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for node information
+
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/version"
+)
+
+// build version of a node
+type NodeVersion struct {
+	Semver    string   `json:"semver"`
+	Commit    string   `json:"commit"`
+	BuildTime string   `json:"build_time,omitempty"`
+	Features  []string `json:"features"`
+}
+
+func NewNodeVersion(info version.Info) *NodeVersion {
+	v := &NodeVersion{
+		Semver:    info.Semver,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		Features:  info.Features,
+	}
+	if v.Features == nil {
+		v.Features = []string{}
+	}
+	return v
+}
+
+// limits of the API layer
+type ApiLimits struct {
+	DefaultListLimit      int   `json:"default_list_limit"`
+	MaxListLimit          int   `json:"max_list_limit"`
+	GraphQLMaxLimit       int   `json:"graphql_max_limit"`
+	MaxAnchorBatch        int   `json:"max_anchor_batch"`
+	AnchorTTLSeconds      int64 `json:"anchor_ttl_seconds"`
+	MaxWaitTimeoutSeconds int64 `json:"max_wait_timeout_seconds"`
+}
+
+type StackLimits struct {
+	MaxPayloadSize         int     `json:"max_payload_size"`
+	MaxShardIdSize         int     `json:"max_shard_id_size"`
+	MaxUnclesPerAnchor     int     `json:"max_uncles_per_anchor"`
+	ShardQueueSize         int     `json:"shard_queue_size"`
+	ShardWorkers           int     `json:"shard_workers"`
+	MaxNacksPerSecond      int     `json:"max_nacks_per_second"`
+	MaxNackHops            uint64  `json:"max_nack_hops"`
+	MaxRejectDetail        int     `json:"max_reject_detail"`
+	MaxReanchorRetries     int     `json:"max_reanchor_retries"`
+	MaxSyncPeers           int     `json:"max_sync_peers"`
+	TxValidationWorkers    int     `json:"tx_validation_workers"`
+	SubmitterTxRate        float64 `json:"submitter_tx_rate"`
+	SubmitterNetworkTxRate float64 `json:"submitter_network_tx_rate"`
+	SubmitterTxBurst       int     `json:"submitter_tx_burst"`
+}
+
+type ShardLimits struct {
+	HandlerRetryLimit     int   `json:"handler_retry_limit"`
+	HandlerRetryBackoffMs int64 `json:"handler_retry_backoff_ms"`
+	DeadLetterLimit       int   `json:"dead_letter_limit"`
+	MaxAnchorUncles       int   `json:"max_anchor_uncles"`
+	MaxResourceSize       int   `json:"max_resource_size"`
+	ChunkSize             int   `json:"chunk_size"`
+}
+
+type P2PLimits struct {
+	MaxPeers int `json:"max_peers"`
+}
+
+// effective limits of each layer, a limit error names the exceeded limit as "<layer>.<limit>"
+type NodeLimits struct {
+	Api   ApiLimits   `json:"api"`
+	Stack StackLimits `json:"stack"`
+	Shard ShardLimits `json:"shard"`
+	P2P   P2PLimits   `json:"p2p"`
+}
+
+// response to a node information query
+type NodeInfoResponse struct {
+	NodeId  string       `json:"node_id"`
+	Name    string       `json:"name"`
+	ShardId string       `json:"shard_id,omitempty"`
+	AppName string       `json:"app_name,omitempty"`
+	Limits  NodeLimits   `json:"limits"`
+	Version *NodeVersion `json:"version"`
+	// versions of connected peers, keyed by hex encoded peer id
+	PeerVersions map[string]*NodeVersion `json:"peer_versions,omitempty"`
+}
+
+func NewNodeInfoResponse(info *stack.NodeInfo) *NodeInfoResponse {
+	res := &NodeInfoResponse{
+		NodeId:  hex.EncodeToString(info.NodeId),
+		Name:    info.Name,
+		ShardId: hex.EncodeToString(info.ShardId),
+		AppName: info.AppName,
+		Limits: NodeLimits{
+			Api: ApiLimits{
+				DefaultListLimit:      DefaultListLimit,
+				MaxListLimit:          MaxListLimit,
+				GraphQLMaxLimit:       GraphQLMaxLimit,
+				MaxAnchorBatch:        MaxAnchorBatch,
+				AnchorTTLSeconds:      int64(AnchorTTL.Seconds()),
+				MaxWaitTimeoutSeconds: int64(MaxWaitTimeout.Seconds()),
+			},
+			Stack: StackLimits(info.Limits.Stack),
+			Shard: ShardLimits{
+				HandlerRetryLimit:     info.Limits.Shard.HandlerRetryLimit,
+				HandlerRetryBackoffMs: int64(info.Limits.Shard.HandlerRetryBackoff / 1e6),
+				DeadLetterLimit:       info.Limits.Shard.DeadLetterLimit,
+				MaxAnchorUncles:       info.Limits.Shard.MaxAnchorUncles,
+				MaxResourceSize:       info.Limits.Shard.MaxResourceSize,
+				ChunkSize:             info.Limits.Shard.ChunkSize,
+			},
+			P2P: P2PLimits(info.Limits.P2P),
+		},
+		Version: NewNodeVersion(info.Version),
+	}
+	if len(info.PeerVersions) > 0 {
+		res.PeerVersions = make(map[string]*NodeVersion)
+		for id, v := range info.PeerVersions {
+			res.PeerVersions[id] = NewNodeVersion(v)
+		}
+	}
+	return res
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The trust-net Authors
+// HTTP server for client API
+
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/log"
+	"io/ioutil"
+	"net/http"
+)
+
+// TLS configuration for serving API over HTTPS
+type TLSConfig struct {
+	// PEM encoded server certificate (chain) file, API is served over plain HTTP when empty
+	CertFile string `json:"cert_file"`
+	// PEM encoded server private key file
+	KeyFile string `json:"key_file"`
+	// PEM encoded CA certificates for authenticating client certificates (mutual TLS)
+	ClientCAFile string `json:"client_ca_file"`
+	// reject clients without a valid certificate (otherwise client certificate is verified only if provided)
+	RequireClientCert bool `json:"require_client_cert"`
+}
+
+type ServerConfig struct {
+	// cross-origin resource sharing for browser based clients
+	Cors CorsConfig `json:"cors"`
+	// disable access logs
+	NoAccessLog bool `json:"no_access_log"`
+	// serve API over HTTPS, with optional client certificate authentication
+	TLS TLSConfig `json:"tls"`
+	// require requests to present one of these API keys (no authentication when empty)
+	ApiKeys []ApiKey `json:"api_keys"`
+}
+
+type Server struct {
+	conf    ServerConfig
+	handler http.Handler
+	server  *http.Server
+	logger  log.Logger
+}
+
+// handler with middleware applied, i.e. access logs, panic recovery, CORS and API key authentication
+func (s *Server) Handler() http.Handler {
+	handler := s.handler
+	if len(s.conf.ApiKeys) > 0 {
+		handler = Auth(s.conf.ApiKeys, handler)
+	}
+	handler = Recovery(s.logger, Cors(s.conf.Cors, handler))
+	if !s.conf.NoAccessLog {
+		handler = AccessLog(s.logger, handler)
+	}
+	return handler
+}
+
+// build TLS config for server from configured certificate files (nil if TLS is not configured)
+func (c *TLSConfig) tlsConfig() (*tls.Config, error) {
+	if len(c.CertFile) == 0 {
+		if len(c.ClientCAFile) > 0 || c.RequireClientCert {
+			return nil, fmt.Errorf("client certificate authentication requires server certificate")
+		}
+		return nil, nil
+	}
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %s", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if len(c.ClientCAFile) > 0 {
+		pem, err := ioutil.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %s", err)
+		}
+		conf.ClientCAs = x509.NewCertPool()
+		if !conf.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in client CA file")
+		}
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if c.RequireClientCert {
+		return nil, fmt.Errorf("client certificate authentication requires client CA file")
+	}
+	return conf, nil
+}
+
+// listen on specified address and serve API requests, blocks until server is closed
+func (s *Server) ListenAndServe(addr string) error {
+	tlsConf, err := s.conf.TLS.tlsConfig()
+	if err != nil {
+		return err
+	}
+	s.server = &http.Server{
+		Addr:      addr,
+		Handler:   s.Handler(),
+		TLSConfig: tlsConf,
+	}
+	if tlsConf != nil {
+		// certificates are already loaded into TLS config
+		return s.server.ListenAndServeTLS("", "")
+	}
+	return s.server.ListenAndServe()
+}
+
+// stop serving API requests
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	return s.server.Close()
+}
+
+// create an API server for application's request handler (e.g. a router with API endpoints)
+func NewServer(handler http.Handler, conf ServerConfig) *Server {
+	return &Server{
+		conf:    conf,
+		handler: handler,
+		logger:  log.NewLogger("API Server"),
+	}
+}
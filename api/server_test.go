@@ -0,0 +1,107 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServer_Recovery(t *testing.T) {
+	s := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("test panic")
+	}), ServerConfig{})
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/foo", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("content-type") != "application/json" {
+		t.Errorf("panic not recovered with 500 response: %d", w.Code)
+	}
+}
+
+func TestServer_Cors(t *testing.T) {
+	called := false
+	s := NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), ServerConfig{Cors: CorsConfig{AllowedOrigins: []string{"http://example.com"}}})
+
+	// preflight from allowed origin should be answered without calling handler
+	req := httptest.NewRequest("OPTIONS", "/foo", nil)
+	req.Header.Set("Origin", "http://example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "http://example.com" || called {
+		t.Errorf("incorrect preflight response: %d", w.Code)
+	}
+
+	// request from other origin should not get CORS headers
+	req = httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Origin", "http://other.com")
+	w = httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, req)
+	if len(w.Header().Get("Access-Control-Allow-Origin")) != 0 || !called {
+		t.Errorf("request from other origin should not be allowed cross-origin")
+	}
+}
+
+// write a self-signed certificate and its key to PEM files in a temp directory
+func testCertFiles(t *testing.T) (string, string, func()) {
+	dir, _ := ioutil.TempDir("", "api-tls")
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+	keyDer, _ := x509.MarshalECPrivateKey(key)
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile, func() { os.RemoveAll(dir) }
+}
+
+func TestTLSConfig(t *testing.T) {
+	certFile, keyFile, cleanup := testCertFiles(t)
+	defer cleanup()
+
+	// no TLS configured
+	if conf, err := (&TLSConfig{}).tlsConfig(); conf != nil || err != nil {
+		t.Errorf("TLS should not be configured: %s", err)
+	}
+	// server TLS only
+	if conf, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile}).tlsConfig(); err != nil || conf.ClientAuth != tls.NoClientCert {
+		t.Errorf("incorrect server TLS config: %s", err)
+	}
+	// mutual TLS
+	conf, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, RequireClientCert: true}).tlsConfig()
+	if err != nil || conf.ClientAuth != tls.RequireAndVerifyClientCert || conf.ClientCAs == nil {
+		t.Errorf("incorrect mutual TLS config: %s", err)
+	}
+	// client authentication without CA
+	if _, err := (&TLSConfig{CertFile: certFile, KeyFile: keyFile, RequireClientCert: true}).tlsConfig(); err == nil {
+		t.Errorf("client authentication without CA should fail")
+	}
+	// missing certificate file
+	if _, err := (&TLSConfig{CertFile: "no-such-file", KeyFile: keyFile}).tlsConfig(); err == nil {
+		t.Errorf("missing certificate should fail")
+	}
+}
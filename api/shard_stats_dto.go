@@ -0,0 +1,63 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for a shard's transaction statistics
+
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+)
+
+// size and handler statistics of transactions accepted for a shard since node's start
+type ShardStats struct {
+	ShardId string `json:"shard_id"`
+	// number of transactions accepted for the shard, and across restarts
+	TxCount      uint64 `json:"tx_count"`
+	TotalTxCount uint64 `json:"total_tx_count"`
+	// payload sizes (bytes) of accepted transactions
+	PayloadBytes uint64 `json:"payload_bytes"`
+	PayloadMin   uint64 `json:"payload_min"`
+	PayloadMax   uint64 `json:"payload_max"`
+	AvgPayload   uint64 `json:"avg_payload"`
+	// payload size distribution, with upper bounds of buckets (last bucket counts larger payloads)
+	PayloadSizeBuckets []uint64 `json:"payload_size_buckets"`
+	PayloadSizeDist    []uint64 `json:"payload_size_dist"`
+	// uncles referenced by anchors of accepted transactions
+	UncleCount uint64  `json:"uncle_count"`
+	AvgUncles  float64 `json:"avg_uncles"`
+	// app transaction handler invocations, and time spent in handler (milliseconds)
+	HandlerCount    uint64  `json:"handler_count"`
+	HandlerAvgMs    float64 `json:"handler_avg_ms"`
+	HandlerMaxMs    float64 `json:"handler_max_ms"`
+	HandlerRetries  uint64  `json:"handler_retries"`
+	SlowHandlers    uint64  `json:"slow_handlers"`
+	HandlerTimeouts uint64  `json:"handler_timeouts"`
+	HandlerPanics   uint64  `json:"handler_panics"`
+	DeadLettered    uint64  `json:"dead_lettered"`
+	InternalErrors  uint64  `json:"internal_errors"`
+}
+
+func NewShardStats(shardId []byte, stats *shard.ShardStats) *ShardStats {
+	res := &ShardStats{
+		ShardId:            hex.EncodeToString(shardId),
+		PayloadSizeBuckets: shard.PayloadSizeBuckets,
+		PayloadSizeDist:    []uint64{},
+	}
+	if stats == nil {
+		return res
+	}
+	res.TxCount, res.TotalTxCount = stats.TxCount, stats.TotalTxCount
+	res.PayloadBytes, res.PayloadMin, res.PayloadMax = stats.PayloadBytes, stats.PayloadMin, stats.PayloadMax
+	res.AvgPayload = stats.AvgPayload()
+	if stats.PayloadSizeDist != nil {
+		res.PayloadSizeDist = stats.PayloadSizeDist
+	}
+	res.UncleCount, res.AvgUncles = stats.UncleCount, stats.AvgUncles()
+	res.HandlerCount = stats.HandlerCount
+	res.HandlerAvgMs = stats.AvgHandlerTime().Seconds() * 1000
+	res.HandlerMaxMs = stats.HandlerMax.Seconds() * 1000
+	res.HandlerRetries = stats.HandlerRetries
+	res.SlowHandlers, res.HandlerTimeouts, res.HandlerPanics = stats.SlowHandlers, stats.HandlerTimeouts, stats.HandlerPanics
+	res.DeadLettered, res.InternalErrors = stats.DeadLettered, stats.InternalErrors
+	return res
+}
@@ -0,0 +1,33 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+	"time"
+)
+
+func TestNewShardStats(t *testing.T) {
+	stats := &shard.ShardStats{
+		TxCount:         2,
+		PayloadBytes:    300,
+		PayloadSizeDist: make([]uint64, len(shard.PayloadSizeBuckets)+1),
+		HandlerCount:    2,
+		HandlerTime:     4 * time.Millisecond,
+		HandlerMax:      3 * time.Millisecond,
+	}
+	res := NewShardStats([]byte{0x01, 0x02}, stats)
+	if res.ShardId != "0102" || res.TxCount != 2 || res.AvgPayload != 150 {
+		t.Errorf("incorrect transaction stats: %v", res)
+	}
+	if res.HandlerAvgMs != 2 || res.HandlerMaxMs != 3 {
+		t.Errorf("incorrect handler times: %f, %f", res.HandlerAvgMs, res.HandlerMaxMs)
+	}
+	if len(res.PayloadSizeDist) != len(res.PayloadSizeBuckets)+1 {
+		t.Errorf("incorrect payload size distribution: %v", res.PayloadSizeDist)
+	}
+	// shard not seen since node's start
+	if res := NewShardStats([]byte{0x01}, nil); res.TxCount != 0 || res.PayloadSizeDist == nil {
+		t.Errorf("incorrect stats of unknown shard: %v", res)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2019 The trust-net Authors
+// Remote signing flow for submitters that cannot do sequence bookkeeping (e.g. browser wallets)
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// duration within which a signing challenge must be completed
+var SigningChallengeTTL = 2 * time.Minute
+
+// A request for a signing challenge, for a transaction with specified payload
+type SigningChallengeRequest struct {
+	// Submitter's public ID
+	SubmitterId string `json:"submitter_id"`
+	// shard id for the transaction
+	ShardId string `json:"shard_id"`
+	// base64 encoded payload for transaction's operations
+	Payload string `json:"payload"`
+
+	submitterId []byte
+	shardId     []byte
+	payload     []byte
+}
+
+// build a signing challenge request for a payload constructed on server (e.g. from a transaction template)
+func NewSigningChallengeRequest(submitterId, shardId, payload []byte) *SigningChallengeRequest {
+	return &SigningChallengeRequest{
+		SubmitterId: hex.EncodeToString(submitterId),
+		ShardId:     hex.EncodeToString(shardId),
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		submitterId: submitterId,
+		shardId:     shardId,
+		payload:     payload,
+	}
+}
+
+func (req *SigningChallengeRequest) Submitter() []byte {
+	return req.submitterId
+}
+
+func (req *SigningChallengeRequest) Shard() []byte {
+	return req.shardId
+}
+
+func ParseSigningChallengeRequest(r *http.Request) (*SigningChallengeRequest, error) {
+	req, v := &SigningChallengeRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	req.submitterId = v.hex("submitter_id", req.SubmitterId, 0)
+	req.shardId = v.hex("shard_id", req.ShardId, 0)
+	req.payload = v.base64("payload", req.Payload)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// a signing challenge, with the transaction request assembled by server for client to sign
+type SigningChallengeResponse struct {
+	// nonce identifying the challenge, also used as request's padding so that signature is bound to it
+	Nonce string `json:"nonce"`
+	// sequence and last transaction assigned to the request by server
+	SubmitterSeq uint64 `json:"submitter_seq"`
+	LastTx       string `json:"last_tx"`
+	// base64 encoded bytes to sign (SHA256 digest signed with submitter's private key)
+	SignBytes string `json:"sign_bytes"`
+	// unix time (seconds) after which challenge cannot be completed
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// A request to complete a signing challenge with client's signature
+type SigningCompleteRequest struct {
+	Nonce string `json:"nonce"`
+	// base64 encoded signature of challenge's sign bytes
+	Signature string `json:"signature"`
+	// optional caller provided trace ID for the transaction
+	TraceId string `json:"trace_id,omitempty"`
+
+	nonce     uint64
+	signature []byte
+}
+
+func ParseSigningCompleteRequest(r *http.Request) (*SigningCompleteRequest, error) {
+	req, v := &SigningCompleteRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	if nonce := v.hex("nonce", req.Nonce, 8); nonce != nil {
+		req.nonce = binary.BigEndian.Uint64(nonce)
+	}
+	req.signature = v.base64("signature", req.Signature)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	if len(req.TraceId) == 0 {
+		req.TraceId = r.Header.Get("X-Trace-Id")
+	}
+	return req, nil
+}
+
+type signingChallenge struct {
+	req       *dto.TxRequest
+	expiresAt time.Time
+}
+
+// outstanding signing challenges, at most one per submitter and shard (a new challenge replaces older one)
+type SigningChallenges struct {
+	db         repo.DltDb
+	lock       sync.Mutex
+	challenges map[uint64]*signingChallenge
+}
+
+// create signing challenges store, using DLT DB for submitters' sequence bookkeeping
+func NewSigningChallenges(db repo.DltDb) *SigningChallenges {
+	return &SigningChallenges{
+		db:         db,
+		challenges: make(map[uint64]*signingChallenge),
+	}
+}
+
+// next sequence and last transaction for a submitter, from its history
+func (s *SigningChallenges) nextSeq(submitterId, shardId []byte) (uint64, [64]byte) {
+	lastTx := [64]byte{}
+	seq := uint64(1)
+	for history := s.db.GetSubmitterHistory(submitterId, seq); history != nil; history = s.db.GetSubmitterHistory(submitterId, seq) {
+		if len(history.ShardTxPairs) > 0 {
+			lastTx = history.ShardTxPairs[0].TxId
+		}
+		for _, pair := range history.ShardTxPairs {
+			if string(pair.ShardId) == string(shardId) {
+				lastTx = pair.TxId
+				break
+			}
+		}
+		seq++
+	}
+	return seq, lastTx
+}
+
+// issue a challenge for client to sign, with sequence bookkeeping done by server
+func (s *SigningChallenges) Issue(req *SigningChallengeRequest) (*SigningChallengeResponse, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	for nonce, c := range s.challenges {
+		// drop expired challenges, and any older challenge for same submitter and shard
+		if now.After(c.expiresAt) || (string(c.req.SubmitterId) == string(req.submitterId) && string(c.req.ShardId) == string(req.shardId)) {
+			delete(s.challenges, nonce)
+		}
+	}
+	bytes := make([]byte, 8)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %s", err)
+	}
+	txReq := &dto.TxRequest{
+		Payload:     req.payload,
+		ShardId:     req.shardId,
+		SubmitterId: req.submitterId,
+		Padding:     binary.BigEndian.Uint64(bytes),
+	}
+	txReq.SubmitterSeq, txReq.LastTx = s.nextSeq(req.submitterId, req.shardId)
+	c := &signingChallenge{
+		req:       txReq,
+		expiresAt: now.Add(SigningChallengeTTL),
+	}
+	s.challenges[txReq.Padding] = c
+	return &SigningChallengeResponse{
+		Nonce:        hex.EncodeToString(bytes),
+		SubmitterSeq: txReq.SubmitterSeq,
+		LastTx:       hex.EncodeToString(txReq.LastTx[:]),
+		SignBytes:    base64.StdEncoding.EncodeToString(txReq.Bytes()),
+		ExpiresAt:    c.expiresAt.Unix(),
+	}, nil
+}
+
+// complete a challenge with client's signature, returning the final transaction request for submission,
+// a challenge can be completed only once
+func (s *SigningChallenges) Complete(req *SigningCompleteRequest) (*dto.TxRequest, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c, found := s.challenges[req.nonce]
+	if !found {
+		return nil, fmt.Errorf("unknown or already used nonce")
+	}
+	delete(s.challenges, req.nonce)
+	if time.Now().After(c.expiresAt) {
+		return nil, fmt.Errorf("signing challenge expired")
+	}
+	c.req.Signature = req.signature
+	return c.req, nil
+}
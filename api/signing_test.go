@@ -0,0 +1,62 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"testing"
+)
+
+func TestSigningChallenges_IssueAndComplete(t *testing.T) {
+	db := repo.NewMockDltDb()
+	// submitter already has one transaction in shard
+	tx := dto.TestSignedTransaction("first")
+	db.AddTx(tx)
+	db.UpdateSubmitter(tx)
+	s := NewSigningChallenges(db)
+	req := &SigningChallengeRequest{
+		submitterId: tx.Request().SubmitterId,
+		shardId:     tx.Request().ShardId,
+		payload:     []byte("second"),
+	}
+	challenge, err := s.Issue(req)
+	if err != nil {
+		t.Errorf("failed to issue challenge: %s", err)
+		return
+	}
+	txId := tx.Id()
+	if challenge.SubmitterSeq != 2 || challenge.LastTx != hex.EncodeToString(txId[:]) {
+		t.Errorf("incorrect sequence bookkeeping: %d, %s", challenge.SubmitterSeq, challenge.LastTx)
+	}
+	nonce, _ := hex.DecodeString(challenge.Nonce)
+	complete := &SigningCompleteRequest{nonce: binary.BigEndian.Uint64(nonce), signature: []byte("signature")}
+	txReq, err := s.Complete(complete)
+	if err != nil {
+		t.Errorf("failed to complete challenge: %s", err)
+		return
+	}
+	// signed bytes must be exactly those of the assembled request, including nonce as padding
+	if base64.StdEncoding.EncodeToString(txReq.Bytes()) != challenge.SignBytes || txReq.Padding != complete.nonce {
+		t.Errorf("assembled request does not match challenge")
+	}
+	if string(txReq.Signature) != "signature" || string(txReq.Payload) != "second" {
+		t.Errorf("incorrect assembled request")
+	}
+	// challenge cannot be replayed
+	if _, err := s.Complete(complete); err == nil {
+		t.Errorf("completed challenge should not be reusable")
+	}
+}
+
+func TestSigningChallenges_NewChallengeReplacesOld(t *testing.T) {
+	s := NewSigningChallenges(repo.NewMockDltDb())
+	req := &SigningChallengeRequest{submitterId: []byte("submitter"), shardId: []byte("shard"), payload: []byte("payload")}
+	first, _ := s.Issue(req)
+	second, _ := s.Issue(req)
+	if first.SubmitterSeq != 1 || len(s.challenges) != 1 || first.Nonce == second.Nonce {
+		t.Errorf("new challenge should replace older challenge of submitter")
+	}
+}
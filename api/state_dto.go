@@ -0,0 +1,38 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for querying world state
+
+package api
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// A request to query a resource, from path and query parameters:
+//
+//	{key}: key of the resource
+//	at:    shard sequence to query resource's value as of (default current value)
+type StateRequest struct {
+	Key string
+	// query value as of shard sequence At, when set
+	AtSeq bool
+	At    uint64
+}
+
+func ParseStateRequest(r *http.Request, key string) (*StateRequest, error) {
+	req, v := &StateRequest{Key: key}, &validator{}
+	if len(key) == 0 {
+		v.fail("key", "required")
+	}
+	if value := r.URL.Query().Get("at"); len(value) > 0 {
+		if at, err := strconv.ParseUint(value, 10, 64); err != nil {
+			v.fail("at", "not a non-negative integer")
+		} else {
+			req.AtSeq, req.At = true, at
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for verifiable submitter history proofs
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack"
+)
+
+// a submitter's transaction in history proof
+type SubmitterProofEntry struct {
+	Seq             uint64 `json:"seq"`
+	ShardId         string `json:"shard_id"`
+	TxId            string `json:"tx_id"`
+	LastTx          string `json:"last_tx"`
+	Payload         string `json:"payload"`
+	Padding         uint64 `json:"padding"`
+	Signature       string `json:"signature"`
+	AnchorSignature string `json:"anchor_signature"`
+}
+
+// response with proof of a submitter's transaction history, auditors can verify it
+// independently by converting back with Proof() and calling Verify() on the result
+type SubmitterProofResponse struct {
+	SubmitterId string                `json:"submitter_id"`
+	Entries     []SubmitterProofEntry `json:"entries"`
+}
+
+func NewSubmitterProofResponse(proof *stack.SubmitterProof) *SubmitterProofResponse {
+	res := &SubmitterProofResponse{
+		SubmitterId: hex.EncodeToString(proof.SubmitterId),
+		Entries:     make([]SubmitterProofEntry, 0, len(proof.Entries)),
+	}
+	for _, e := range proof.Entries {
+		res.Entries = append(res.Entries, SubmitterProofEntry{
+			Seq:             e.Seq,
+			ShardId:         hex.EncodeToString(e.ShardId),
+			TxId:            hex.EncodeToString(e.TxId[:]),
+			LastTx:          hex.EncodeToString(e.LastTx[:]),
+			Payload:         base64.StdEncoding.EncodeToString(e.Payload),
+			Padding:         e.Padding,
+			Signature:       base64.StdEncoding.EncodeToString(e.Signature),
+			AnchorSignature: base64.StdEncoding.EncodeToString(e.AnchorSignature),
+		})
+	}
+	return res
+}
+
+// decode the proof from its API representation
+func (res *SubmitterProofResponse) Proof() (*stack.SubmitterProof, error) {
+	v := &validator{}
+	proof := &stack.SubmitterProof{
+		SubmitterId: v.hex("submitter_id", res.SubmitterId, 0),
+		Entries:     make([]stack.SubmitterProofEntry, 0, len(res.Entries)),
+	}
+	for i, e := range res.Entries {
+		field := fmt.Sprintf("entries[%d]", i)
+		proof.Entries = append(proof.Entries, stack.SubmitterProofEntry{
+			Seq:             e.Seq,
+			ShardId:         v.hex(field+".shard_id", e.ShardId, 0),
+			TxId:            v.hash(field+".tx_id", e.TxId),
+			LastTx:          v.hash(field+".last_tx", e.LastTx),
+			Payload:         v.base64(field+".payload", e.Payload),
+			Padding:         e.Padding,
+			Signature:       v.base64(field+".signature", e.Signature),
+			AnchorSignature: v.base64(field+".anchor_signature", e.AnchorSignature),
+		})
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return proof, nil
+}
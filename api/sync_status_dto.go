@@ -0,0 +1,59 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for shard sync status
+
+package api
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack"
+)
+
+// progress of a shard's sync with a peer
+type SyncStatus struct {
+	// shard being synced
+	ShardId string `json:"shard_id"`
+	// peer the shard is being synced with
+	Peer string `json:"peer"`
+	// true while sync is in progress
+	Syncing bool `json:"syncing"`
+	// depth of local shard DAG reached so far
+	CurrentDepth uint64 `json:"current_depth"`
+	// depth of remote shard DAG advertised by peer
+	TargetDepth uint64 `json:"target_depth"`
+	// number of transactions fetched from peer so far
+	TxFetched uint64 `json:"tx_fetched"`
+	// estimated number of transactions to fetch
+	TxEstimated uint64 `json:"tx_estimated"`
+	// percentage of sync completed
+	Progress float64 `json:"progress"`
+	// unix time (seconds) when sync started
+	StartedAt int64 `json:"started_at"`
+	// estimated seconds to complete sync
+	EtaSeconds float64 `json:"eta_seconds"`
+}
+
+// response to a sync status query
+type SyncStatusResponse struct {
+	Shards []SyncStatus `json:"shards"`
+}
+
+func NewSyncStatusResponse(statuses []stack.SyncStatus) *SyncStatusResponse {
+	res := &SyncStatusResponse{
+		Shards: make([]SyncStatus, 0, len(statuses)),
+	}
+	for _, s := range statuses {
+		res.Shards = append(res.Shards, SyncStatus{
+			ShardId:      hex.EncodeToString(s.ShardId),
+			Peer:         s.Peer,
+			Syncing:      s.Syncing,
+			CurrentDepth: s.CurrentDepth,
+			TargetDepth:  s.TargetDepth,
+			TxFetched:    s.TxFetched,
+			TxEstimated:  s.TxEstimated,
+			Progress:     s.Progress(),
+			StartedAt:    s.StartedAt,
+			EtaSeconds:   s.ETA.Seconds(),
+		})
+	}
+	return res
+}
@@ -0,0 +1,222 @@
+// Copyright 2019 The trust-net Authors
+// Named transaction templates, for building app payloads from JSON arguments
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// type of a transaction template argument, as provided in JSON request
+type ArgType string
+
+const (
+	// JSON string
+	ARG_STRING ArgType = "string"
+	// JSON integer, built as int64
+	ARG_INT ArgType = "int"
+	// JSON non-negative integer, built as uint64
+	ARG_UINT ArgType = "uint"
+	// JSON boolean
+	ARG_BOOL ArgType = "bool"
+	// base64 encoded JSON string, built as []byte
+	ARG_BYTES ArgType = "bytes"
+)
+
+// schema of a transaction template argument
+type TemplateArg struct {
+	Name     string  `json:"name"`
+	Type     ArgType `json:"type"`
+	Required bool    `json:"required"`
+}
+
+// a named transaction template registered by an application for its shard
+type TxTemplate struct {
+	Name string `json:"name"`
+	// app's op-code for the operation
+	OpCode uint64 `json:"op_code"`
+	// human readable description of the operation
+	Description string        `json:"description,omitempty"`
+	Args        []TemplateArg `json:"args"`
+	// app specific construction of transaction payload from validated arguments
+	// (missing optional arguments are absent from map)
+	Build func(args map[string]interface{}) ([]byte, error) `json:"-"`
+}
+
+// registry of transaction templates per shard
+type Templates struct {
+	lock   sync.RWMutex
+	shards map[string]map[string]*TxTemplate
+}
+
+func NewTemplates() *Templates {
+	return &Templates{
+		shards: make(map[string]map[string]*TxTemplate),
+	}
+}
+
+// register a transaction template for a shard, replacing any existing template with same name
+func (t *Templates) Register(shardId []byte, tmpl *TxTemplate) error {
+	if len(shardId) == 0 || tmpl == nil || len(tmpl.Name) == 0 || tmpl.Build == nil {
+		return fmt.Errorf("incomplete transaction template")
+	}
+	for _, arg := range tmpl.Args {
+		switch arg.Type {
+		case ARG_STRING, ARG_INT, ARG_UINT, ARG_BOOL, ARG_BYTES:
+		default:
+			return fmt.Errorf("unsupported type of template argument %s: %s", arg.Name, arg.Type)
+		}
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if _, found := t.shards[string(shardId)]; !found {
+		t.shards[string(shardId)] = make(map[string]*TxTemplate)
+	}
+	t.shards[string(shardId)][tmpl.Name] = tmpl
+	return nil
+}
+
+// get a registered transaction template of a shard, nil if not found
+func (t *Templates) Get(shardId []byte, name string) *TxTemplate {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return t.shards[string(shardId)][name]
+}
+
+// list registered transaction templates of a shard
+func (t *Templates) List(shardId []byte) []*TxTemplate {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	list := []*TxTemplate{}
+	for _, tmpl := range t.shards[string(shardId)] {
+		list = append(list, tmpl)
+	}
+	return list
+}
+
+// A request to build a transaction payload from a template
+type OpRequest struct {
+	// arguments as per template's schema
+	Args map[string]json.RawMessage `json:"args"`
+	// optional submitter, to get a signing challenge for built payload
+	SubmitterId string `json:"submitter_id,omitempty"`
+
+	args        map[string]interface{}
+	submitterId []byte
+}
+
+func (req *OpRequest) Submitter() []byte {
+	return req.submitterId
+}
+
+// parse and validate a request's arguments against template's schema
+func ParseOpRequest(r *http.Request, tmpl *TxTemplate) (*OpRequest, error) {
+	req, v := &OpRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	if len(req.SubmitterId) > 0 {
+		req.submitterId = v.hex("submitter_id", req.SubmitterId, 0)
+	}
+	req.args = tmpl.parseArgs(req.Args, v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// validate raw arguments against template's schema, recording any failures with validator
+func (tmpl *TxTemplate) parseArgs(raws map[string]json.RawMessage, v *validator) map[string]interface{} {
+	args := make(map[string]interface{})
+	known := make(map[string]bool)
+	for _, arg := range tmpl.Args {
+		known[arg.Name] = true
+		field := "args." + arg.Name
+		raw, found := raws[arg.Name]
+		if !found || string(raw) == "null" {
+			if arg.Required {
+				v.fail(field, "required")
+			}
+			continue
+		}
+		if value, err := parseTemplateArg(arg.Type, raw); err != nil {
+			v.fail(field, fmt.Sprintf("not a valid %s", arg.Type))
+		} else {
+			args[arg.Name] = value
+		}
+	}
+	for name := range raws {
+		if !known[name] {
+			v.fail("args."+name, "unknown argument")
+		}
+	}
+	return args
+}
+
+// build transaction payload from template using arguments of any JSON compatible types
+// (e.g. decoded from a script), validated against template's schema
+func (tmpl *TxTemplate) BuildArgs(values map[string]interface{}) ([]byte, error) {
+	v := &validator{}
+	raws := make(map[string]json.RawMessage)
+	for name, value := range values {
+		if raw, err := json.Marshal(value); err != nil {
+			v.fail("args."+name, "not a JSON value")
+		} else {
+			raws[name] = raw
+		}
+	}
+	args := tmpl.parseArgs(raws, v)
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return tmpl.Payload(&OpRequest{args: args})
+}
+
+func parseTemplateArg(argType ArgType, raw json.RawMessage) (interface{}, error) {
+	switch argType {
+	case ARG_STRING:
+		var value string
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ARG_INT:
+		var value int64
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ARG_UINT:
+		var value uint64
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	case ARG_BOOL:
+		var value bool
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	default:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(value)
+	}
+}
+
+// response with payload built from a template
+type OpResponse struct {
+	// base64 encoded transaction payload
+	Payload     string `json:"payload"`
+	Description string `json:"description,omitempty"`
+	// signing challenge for the payload, when request specified a submitter
+	Challenge *SigningChallengeResponse `json:"challenge,omitempty"`
+}
+
+// build transaction payload from template using validated request arguments
+func (tmpl *TxTemplate) Payload(req *OpRequest) ([]byte, error) {
+	payload, err := tmpl.Build(req.args)
+	if err != nil {
+		return nil, &ValidationError{Errors: []FieldError{{Field: "args", Reason: err.Error()}}}
+	}
+	return payload, nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testTemplate() *TxTemplate {
+	return &TxTemplate{
+		Name:   "xfer",
+		OpCode: 2,
+		Args: []TemplateArg{
+			{Name: "source", Type: ARG_STRING, Required: true},
+			{Name: "value", Type: ARG_UINT, Required: true},
+			{Name: "memo", Type: ARG_BYTES},
+		},
+		Build: func(args map[string]interface{}) ([]byte, error) {
+			return []byte(args["source"].(string)), nil
+		},
+	}
+}
+
+func TestTemplates_Register(t *testing.T) {
+	templates := NewTemplates()
+	if err := templates.Register([]byte("shard"), testTemplate()); err != nil {
+		t.Errorf("failed to register template: %s", err)
+	}
+	if templates.Get([]byte("shard"), "xfer") == nil || templates.Get([]byte("other shard"), "xfer") != nil {
+		t.Errorf("template not registered for shard")
+	}
+	bad := testTemplate()
+	bad.Args[0].Type = "float"
+	if err := templates.Register([]byte("shard"), bad); err == nil {
+		t.Errorf("unsupported argument type should fail")
+	}
+}
+
+func TestParseOpRequest(t *testing.T) {
+	tmpl := testTemplate()
+	req, err := ParseOpRequest(httptest.NewRequest("POST", "/shards/01/ops/xfer",
+		strings.NewReader(`{"args": {"source": "alice", "value": 10, "memo": "aGVsbG8="}}`)), tmpl)
+	if err != nil {
+		t.Errorf("failed to parse valid request: %s", err)
+		return
+	}
+	if req.args["value"].(uint64) != 10 || string(req.args["memo"].([]byte)) != "hello" {
+		t.Errorf("incorrect arguments: %v", req.args)
+	}
+	if payload, err := tmpl.Payload(req); err != nil || string(payload) != "alice" {
+		t.Errorf("incorrect payload: %s, %s", payload, err)
+	}
+}
+
+func TestParseOpRequest_Invalid(t *testing.T) {
+	_, err := ParseOpRequest(httptest.NewRequest("POST", "/shards/01/ops/xfer",
+		strings.NewReader(`{"args": {"value": -1, "extra": true}}`)), testTemplate())
+	verr, ok := err.(*ValidationError)
+	if !ok || len(verr.Errors) != 3 {
+		t.Errorf("expected 3 field errors, got: %s", err)
+	}
+}
+
+func TestTxTemplate_BuildArgs(t *testing.T) {
+	tmpl := testTemplate()
+	if payload, err := tmpl.BuildArgs(map[string]interface{}{"source": "src", "value": 5}); err != nil {
+		t.Errorf("failed to build payload: %s", err)
+	} else if string(payload) != "src" {
+		t.Errorf("incorrect payload: %s", payload)
+	}
+	if _, err := tmpl.BuildArgs(map[string]interface{}{"source": "src", "value": -1}); err == nil || !strings.Contains(err.Error(), "args.value") {
+		t.Errorf("invalid argument should fail: %v", err)
+	}
+	if _, err := tmpl.BuildArgs(map[string]interface{}{"value": 1, "other": true}); err == nil ||
+		!strings.Contains(err.Error(), "args.source") || !strings.Contains(err.Error(), "args.other") {
+		t.Errorf("missing and unknown arguments should fail: %v", err)
+	}
+}
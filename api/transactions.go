@@ -0,0 +1,73 @@
+// Copyright 2019 The trust-net Authors
+// Transaction submission API endpoint, so that apps do not each implement their own
+
+package api
+
+import (
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+)
+
+// submitter of signed transaction requests, e.g. a DLT stack with registered app
+type TxSubmitter interface {
+	SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error)
+	SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error)
+}
+
+// handler of transaction submission endpoint:
+//
+//	POST /transactions: submit a signed transaction request (SubmitRequest -> SubmitResponse), with an anchor
+//	                    issued earlier by node or anchored by node, a rejected submission is answered with
+//	                    an ErrorResponse with stable code of rejection reason
+type TransactionHandler struct {
+	submitter TxSubmitter
+	anchors   *AnchorHandler
+	logger    log.Logger
+}
+
+// create handler submitting transactions to a submitter (e.g. DLT stack), and marking pre-fetched anchors
+// of anchor endpoints (if not nil) as consumed by submitted transactions
+func NewTransactionHandler(submitter TxSubmitter, anchors *AnchorHandler) *TransactionHandler {
+	return &TransactionHandler{
+		submitter: submitter,
+		anchors:   anchors,
+		logger:    log.NewLogger("Transaction API"),
+	}
+}
+
+// POST /transactions
+func (h *TransactionHandler) Submit(w http.ResponseWriter, r *http.Request) {
+	req, err := ParseSubmitRequest(r)
+	if err != nil {
+		WriteBadRequest(w, err)
+		return
+	}
+	if err := Authorize(r, req.DltRequest().SubmitterId, req.DltRequest().ShardId); err != nil {
+		h.logger.Debug("[trace %s] Unauthorized submission: %s", req.TraceId, err)
+		WriteForbidden(w, err)
+		return
+	}
+	var tx dto.Transaction
+	if anchor := req.DltAnchor(); anchor != nil {
+		tx, err = h.submitter.SubmitAnchored(req.DltRequest(), anchor, req.TraceId)
+	} else {
+		tx, err = h.submitter.SubmitWithTrace(req.DltRequest(), req.TraceId)
+	}
+	if err != nil {
+		h.logger.Debug("[trace %s] Failed to submit transaction: %s", req.TraceId, err)
+		if h.anchors != nil && dto.ErrorCodeOf(err) == dto.ErrStaleAnchor {
+			// submitter will re-anchor, which should not get the same stale anchor
+			h.anchors.Stale(req.DltRequest().SubmitterId, req.SubmitterSeq, req.DltRequest().LastTx)
+		}
+		WriteSubmitError(w, err)
+		return
+	}
+	if h.anchors != nil {
+		// any pre-fetched anchors up to this sequence are now used
+		h.anchors.Consume(req.DltRequest().SubmitterId, req.SubmitterSeq)
+	}
+	w.Header().Set("content-type", "application/json")
+	json.NewEncoder(w).Encode(NewSubmitResponse(tx))
+}
@@ -4,10 +4,7 @@
 package api
 
 import (
-	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
-	"fmt"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"net/http"
 )
@@ -28,56 +25,103 @@ type SubmitRequest struct {
 	Padding uint64 `json:"padding"`
 	// signature of the transaction request's contents using submitter's private key
 	Signature string `json:"signature"`
+	// optional trace/correlation ID for the request (also accepted via X-Trace-Id header)
+	TraceId string `json:"trace_id,omitempty"`
+	// optional anchor issued earlier by node for the transaction, e.g. cached by submitter (node anchors the
+	// transaction when not specified)
+	Anchor *TxAnchor `json:"anchor,omitempty"`
 
-	txReq *dto.TxRequest
+	txReq  *dto.TxRequest
+	anchor *dto.Anchor
 }
 
 func (req *SubmitRequest) DltRequest() *dto.TxRequest {
 	return req.txReq
 }
 
+// anchor of the submission, nil if node should anchor the transaction
+func (req *SubmitRequest) DltAnchor() *dto.Anchor {
+	return req.anchor
+}
+
 func ParseSubmitRequest(r *http.Request) (*SubmitRequest, error) {
-	req := &SubmitRequest{}
-	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
-		return nil, fmt.Errorf("Malformed request: %s", err)
+	req, v := &SubmitRequest{}, &validator{}
+	if !v.decode(r, req) {
+		return nil, v.err()
+	}
+	if len(req.TraceId) == 0 {
+		req.TraceId = r.Header.Get("X-Trace-Id")
 	}
 	txReq := &dto.TxRequest{
 		SubmitterSeq: req.SubmitterSeq,
 		Padding:      req.Padding,
 	}
-
-	if payload, _ := base64.StdEncoding.DecodeString(req.Payload); len(payload) == 0 {
-		return nil, fmt.Errorf("malformed payload")
-	} else {
-		txReq.Payload = payload
-	}
-	if txReq.ShardId, _ = hex.DecodeString(req.ShardId); len(txReq.ShardId) == 0 {
-		return nil, fmt.Errorf("invalid shard_id")
-	}
-	if bytes, _ := hex.DecodeString(req.LastTx); len(bytes) != 64 {
-		return nil, fmt.Errorf("invalid last_tx")
-	} else {
-		copy(txReq.LastTx[:], bytes)
+	txReq.Payload = v.base64("payload", req.Payload)
+	txReq.ShardId = v.hex("shard_id", req.ShardId, 0)
+	txReq.LastTx = v.hash("last_tx", req.LastTx)
+	txReq.SubmitterId = v.hex("submitter_id", req.SubmitterId, 0)
+	v.positive("submitter_seq", req.SubmitterSeq)
+	txReq.Signature = v.base64("signature", req.Signature)
+	if req.Anchor != nil {
+		req.anchor = &dto.Anchor{
+			NodeId:      v.hex("anchor.node_id", req.Anchor.NodeId, 0),
+			ShardSeq:    req.Anchor.ShardSeq,
+			Weight:      req.Anchor.Weight,
+			ShardParent: v.hash("anchor.shard_parent", req.Anchor.ShardParent),
+			Signature:   v.hex("anchor.signature", req.Anchor.Signature, 0),
+		}
+		for _, uncle := range req.Anchor.ShardUncles {
+			req.anchor.ShardUncles = append(req.anchor.ShardUncles, v.hash("anchor.shard_uncles", uncle))
+		}
 	}
-	if txReq.SubmitterId, _ = hex.DecodeString(req.SubmitterId); len(txReq.SubmitterId) == 0 {
-		return nil, fmt.Errorf("invalid submitter_id")
-	}
-	if txReq.Signature, _ = base64.StdEncoding.DecodeString(req.Signature); len(txReq.Signature) == 0 {
-		return nil, fmt.Errorf("invalid signature")
+	if err := v.err(); err != nil {
+		return nil, err
 	}
 	req.txReq = txReq
 	return req, nil
 }
 
+// anchor of a submitted transaction, as issued by node
+type TxAnchor struct {
+	// ID of node that issued the anchor
+	NodeId string `json:"node_id"`
+	// sequence of the transaction within the shard
+	ShardSeq uint64 `json:"shard_seq"`
+	// weight of the transaction within shard DAG
+	Weight uint64 `json:"weight"`
+	// parent transaction within the shard
+	ShardParent string `json:"shard_parent"`
+	// uncle transactions within the shard
+	ShardUncles []string `json:"shard_uncles"`
+	// node's signature of the anchor
+	Signature string `json:"signature"`
+}
+
 // response to successful submission of a transaction
 type SubmitResponse struct {
-	TxId string `json:"tx_id"`
+	TxId    string    `json:"tx_id"`
+	TraceId string    `json:"trace_id,omitempty"`
+	Anchor  *TxAnchor `json:"anchor,omitempty"`
 }
 
 func NewSubmitResponse(tx dto.Transaction) *SubmitResponse {
 	txId := tx.Id()
 	res := &SubmitResponse{
-		TxId: hex.EncodeToString(txId[:]),
+		TxId:    hex.EncodeToString(txId[:]),
+		TraceId: tx.TraceId(),
+	}
+	if a := tx.Anchor(); a != nil {
+		res.Anchor = &TxAnchor{
+			NodeId:      hex.EncodeToString(a.NodeId),
+			ShardSeq:    a.ShardSeq,
+			Weight:      a.Weight,
+			ShardParent: hex.EncodeToString(a.ShardParent[:]),
+			ShardUncles: make([]string, 0, len(a.ShardUncles)),
+			Signature:   hex.EncodeToString(a.Signature),
+		}
+		for _, uncle := range a.ShardUncles {
+			res.Anchor.ShardUncles = append(res.Anchor.ShardUncles, hex.EncodeToString(uncle[:]))
+		}
 	}
 	return res
 }
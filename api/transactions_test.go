@@ -0,0 +1,97 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func submitTestBody(tx dto.Transaction) *bytes.Buffer {
+	req := tx.Request()
+	body, _ := json.Marshal(&SubmitRequest{
+		Payload:      base64.StdEncoding.EncodeToString(req.Payload),
+		ShardId:      hex.EncodeToString(req.ShardId),
+		LastTx:       hex.EncodeToString(req.LastTx[:]),
+		SubmitterId:  hex.EncodeToString(req.SubmitterId),
+		SubmitterSeq: req.SubmitterSeq,
+		Signature:    base64.StdEncoding.EncodeToString(req.Signature),
+		TraceId:      "trace-1",
+	})
+	return bytes.NewBuffer(body)
+}
+
+// a submitted transaction should be answered with its ID and anchor
+func TestTransactionHandler_Submit(t *testing.T) {
+	backend := &mockBackend{}
+	h := NewTransactionHandler(backend, NewAnchorHandler(newMockAnchorSource(), []byte("shard")))
+	w := httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest("POST", "/transactions", submitTestBody(dto.TestSignedTransaction("test payload"))))
+	res := &SubmitResponse{}
+	if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), res) != nil {
+		t.Fatalf("Failed to submit transaction: %d, %s", w.Code, w.Body.String())
+	}
+	if len(res.TxId) != 128 || res.TraceId != "trace-1" || backend.traceId != "trace-1" {
+		t.Errorf("Incorrect response: %v", res)
+	}
+	anchor := dto.TestAnchor()
+	if res.Anchor == nil || res.Anchor.ShardSeq != anchor.ShardSeq || res.Anchor.NodeId != hex.EncodeToString(anchor.NodeId) {
+		t.Errorf("Incorrect anchor: %v", res.Anchor)
+	}
+}
+
+// anchor of a submission should be used for the transaction, instead of node anchoring it
+func TestTransactionHandler_SubmitAnchored(t *testing.T) {
+	backend := &mockBackend{}
+	h := NewTransactionHandler(backend, nil)
+	tx := dto.TestSignedTransaction("test payload")
+	req := &SubmitRequest{}
+	json.Unmarshal(submitTestBody(tx).Bytes(), req)
+	parent := dto.RandomHash()
+	req.Anchor = &TxAnchor{
+		NodeId:      hex.EncodeToString([]byte("node")),
+		ShardSeq:    5,
+		ShardParent: hex.EncodeToString(parent[:]),
+		Signature:   hex.EncodeToString([]byte("anchor signature")),
+	}
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Failed to submit transaction: %d, %s", w.Code, w.Body.String())
+	}
+	if backend.anchor == nil || backend.anchor.ShardSeq != 5 || backend.anchor.ShardParent != parent ||
+		string(backend.anchor.Signature) != "anchor signature" {
+		t.Errorf("Submission's anchor not used: %v", backend.anchor)
+	}
+	// an anchor with missing fields should be refused
+	req.Anchor.Signature = ""
+	body, _ = json.Marshal(req)
+	w = httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest("POST", "/transactions", bytes.NewBuffer(body)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request, got: %d", w.Code)
+	}
+}
+
+// a rejected submission should be answered with rejection's error code
+func TestTransactionHandler_Rejected(t *testing.T) {
+	backend := &mockBackend{submitErr: dto.NewTxError(dto.ErrRateLimited, "too many submissions")}
+	h := NewTransactionHandler(backend, nil)
+	w := httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest("POST", "/transactions", submitTestBody(dto.TestSignedTransaction("test payload"))))
+	res := &ErrorResponse{}
+	if w.Code != http.StatusTooManyRequests || json.Unmarshal(w.Body.Bytes(), res) != nil || res.Code != dto.ErrRateLimited {
+		t.Errorf("Incorrect rejection: %d, %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	h.Submit(w, httptest.NewRequest("POST", "/transactions", bytes.NewBufferString(`{"payload": "not base64"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected bad request, got: %d", w.Code)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2019 The trust-net Authors
+// Validation of API request DTOs with per-field errors
+
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// validation failure of a single request field
+type FieldError struct {
+	Field  string `json:"field"`
+	Reason string `json:"reason"`
+}
+
+// validation failure of a request, with details of each invalid field
+type ValidationError struct {
+	Errors []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	reasons := make([]string, 0, len(e.Errors))
+	for _, f := range e.Errors {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", f.Field, f.Reason))
+	}
+	return "invalid request: " + strings.Join(reasons, "; ")
+}
+
+// collector of field errors during validation of a request
+type validator struct {
+	errs []FieldError
+}
+
+func (v *validator) fail(field, reason string) {
+	v.errs = append(v.errs, FieldError{Field: field, Reason: reason})
+}
+
+// validation result, nil if all fields are valid
+func (v *validator) err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: v.errs}
+}
+
+// decode JSON request body into DTO
+func (v *validator) decode(r *http.Request, dto interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(dto); err != nil {
+		v.fail("body", fmt.Sprintf("malformed JSON: %s", err))
+		return false
+	}
+	return true
+}
+
+// validate a required hex encoded field, of exact size if size > 0
+func (v *validator) hex(field, value string, size int) []byte {
+	if len(value) == 0 {
+		v.fail(field, "required")
+	} else if bytes, err := hex.DecodeString(value); err != nil {
+		v.fail(field, "not hex encoded")
+	} else if size > 0 && len(bytes) != size {
+		v.fail(field, fmt.Sprintf("must be %d bytes", size))
+	} else if len(bytes) == 0 {
+		v.fail(field, "required")
+	} else {
+		return bytes
+	}
+	return nil
+}
+
+// validate a required hex encoded 64 byte hash field
+func (v *validator) hash(field, value string) [64]byte {
+	hash := [64]byte{}
+	copy(hash[:], v.hex(field, value, 64))
+	return hash
+}
+
+// validate a required base64 encoded field
+func (v *validator) base64(field, value string) []byte {
+	if len(value) == 0 {
+		v.fail(field, "required")
+	} else if bytes, err := base64.StdEncoding.DecodeString(value); err != nil {
+		v.fail(field, "not base64 encoded")
+	} else if len(bytes) == 0 {
+		v.fail(field, "required")
+	} else {
+		return bytes
+	}
+	return nil
+}
+
+// validate a required positive number field
+func (v *validator) positive(field string, value uint64) {
+	if value == 0 {
+		v.fail(field, "must be greater than 0")
+	}
+}
+
+// write an error response for a bad request, with per-field details for validation errors
+func WriteBadRequest(w http.ResponseWriter, err error) {
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	if verr, ok := err.(*ValidationError); ok {
+		json.NewEncoder(w).Encode(verr)
+	} else {
+		json.NewEncoder(w).Encode(err.Error())
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2019 The trust-net Authors
+package api
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseSubmitRequest_FieldErrors(t *testing.T) {
+	body := `{"payload": "not base64!", "shard_id": "0102", "last_tx": "0102", "submitter_id": "xyz", "signature": ""}`
+	_, err := ParseSubmitRequest(httptest.NewRequest("POST", "/transactions", strings.NewReader(body)))
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Errorf("expected validation error, got: %s", err)
+		return
+	}
+	expected := map[string]string{
+		"payload":       "not base64 encoded",
+		"last_tx":       "must be 64 bytes",
+		"submitter_id":  "not hex encoded",
+		"submitter_seq": "must be greater than 0",
+		"signature":     "required",
+	}
+	if len(verr.Errors) != len(expected) {
+		t.Errorf("incorrect number of field errors: %v", verr.Errors)
+	}
+	for _, f := range verr.Errors {
+		if expected[f.Field] != f.Reason {
+			t.Errorf("incorrect field error: %s: %s", f.Field, f.Reason)
+		}
+	}
+}
+
+func TestParseSubmitRequest_Valid(t *testing.T) {
+	body, _ := json.Marshal(&SubmitRequest{
+		Payload:      base64.StdEncoding.EncodeToString([]byte("payload")),
+		ShardId:      "0102",
+		LastTx:       hex.EncodeToString(make([]byte, 64)),
+		SubmitterId:  "0304",
+		SubmitterSeq: 1,
+		Signature:    base64.StdEncoding.EncodeToString([]byte("signature")),
+	})
+	if req, err := ParseSubmitRequest(httptest.NewRequest("POST", "/transactions", strings.NewReader(string(body)))); err != nil {
+		t.Errorf("failed to parse valid request: %s", err)
+	} else if string(req.DltRequest().Payload) != "payload" {
+		t.Errorf("incorrect payload: %s", req.DltRequest().Payload)
+	}
+}
+
+func TestParseAnchorRequest_MalformedBody(t *testing.T) {
+	_, err := ParseAnchorRequest(httptest.NewRequest("POST", "/anchors", strings.NewReader("{")))
+	if verr, ok := err.(*ValidationError); !ok || len(verr.Errors) != 1 || verr.Errors[0].Field != "body" {
+		t.Errorf("expected body validation error, got: %s", err)
+	}
+}
+
+func TestWriteBadRequest(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteBadRequest(w, &ValidationError{Errors: []FieldError{{Field: "last_tx", Reason: "required"}}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("incorrect status: %d", w.Code)
+	}
+	res := &ValidationError{}
+	if err := json.NewDecoder(w.Body).Decode(res); err != nil || len(res.Errors) != 1 || res.Errors[0].Field != "last_tx" {
+		t.Errorf("incorrect error response: %v, %s", res, err)
+	}
+}
+
+func TestParseWaitRequest(t *testing.T) {
+	id := hex.EncodeToString(make([]byte, 64))
+	req, err := ParseWaitRequest(httptest.NewRequest("GET", "/transactions/"+id+"/wait?confirmations=2&timeout=5s", nil), id)
+	if err != nil {
+		t.Errorf("failed to parse valid request: %s", err)
+	} else if req.Criteria.Confirmations != 2 || req.Timeout.Seconds() != 5 {
+		t.Errorf("incorrect wait request: %v", req)
+	}
+	_, err = ParseWaitRequest(httptest.NewRequest("GET", "/transactions/xyz/wait?confirmations=-1&timeout=1h", nil), "xyz")
+	if verr, ok := err.(*ValidationError); !ok || len(verr.Errors) != 3 {
+		t.Errorf("expected 3 field errors, got: %s", err)
+	}
+}
+
+func TestParseStateRequest(t *testing.T) {
+	if req, err := ParseStateRequest(httptest.NewRequest("GET", "/resources/key1?at=12", nil), "key1"); err != nil {
+		t.Errorf("failed to parse valid request: %s", err)
+	} else if req.Key != "key1" || !req.AtSeq || req.At != 12 {
+		t.Errorf("incorrect state request: %v", req)
+	}
+	if req, err := ParseStateRequest(httptest.NewRequest("GET", "/resources/key1", nil), "key1"); err != nil || req.AtSeq {
+		t.Errorf("incorrect state request without sequence: %v, %s", req, err)
+	}
+	_, err := ParseStateRequest(httptest.NewRequest("GET", "/resources/?at=-1", nil), "")
+	if verr, ok := err.(*ValidationError); !ok || len(verr.Errors) != 2 {
+		t.Errorf("expected 2 field errors, got: %s", err)
+	}
+}
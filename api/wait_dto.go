@@ -0,0 +1,73 @@
+// Copyright 2019 The trust-net Authors
+// API DTOs for waiting on a transaction
+
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// wait timeout used when request does not specify one
+var DefaultWaitTimeout = 30 * time.Second
+
+// max wait timeout a request can specify
+var MaxWaitTimeout = 60 * time.Second
+
+// A request to wait for a transaction, from path and query parameters:
+//
+//	{id}:          hex encoded transaction ID
+//	confirmations: number of shard DAG levels to wait for on top of transaction (default 0)
+//	timeout:       max duration to wait, e.g. "10s" (default DefaultWaitTimeout, max MaxWaitTimeout)
+type WaitRequest struct {
+	TxId     [64]byte
+	Criteria stack.WaitCriteria
+	Timeout  time.Duration
+}
+
+func ParseWaitRequest(r *http.Request, id string) (*WaitRequest, error) {
+	req, v := &WaitRequest{Timeout: DefaultWaitTimeout}, &validator{}
+	req.TxId = v.hash("id", id)
+	query := r.URL.Query()
+	if value := query.Get("confirmations"); len(value) > 0 {
+		if confirmations, err := strconv.ParseUint(value, 10, 64); err != nil {
+			v.fail("confirmations", "not a non-negative integer")
+		} else {
+			req.Criteria.Confirmations = confirmations
+		}
+	}
+	if value := query.Get("timeout"); len(value) > 0 {
+		if timeout, err := time.ParseDuration(value); err != nil || timeout <= 0 {
+			v.fail("timeout", "not a positive duration")
+		} else if timeout > MaxWaitTimeout {
+			v.fail("timeout", fmt.Sprintf("must not exceed %s", MaxWaitTimeout))
+		} else {
+			req.Timeout = timeout
+		}
+	}
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// response to a completed wait for transaction
+type WaitResponse struct {
+	TxId string `json:"tx_id"`
+	// depth of the transaction in shard DAG
+	Depth uint64 `json:"depth"`
+	// number of shard DAG levels built on top of the transaction
+	Confirmations uint64 `json:"confirmations"`
+}
+
+func NewWaitResponse(txId [64]byte, res *stack.WaitResult) *WaitResponse {
+	return &WaitResponse{
+		TxId:          hex.EncodeToString(txId[:]),
+		Depth:         res.Depth,
+		Confirmations: res.Confirmations,
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2019 The trust-net Authors
+// Arguments of a shell command, scanned word by word
+package cli
+
+import (
+	"strconv"
+	"strings"
+)
+
+// words of a command line following the command, scanned same as a bufio.Scanner over words,
+// words not consumed by a command are run as next command of the line
+type Args struct {
+	words []string
+	pos   int
+}
+
+func NewArgs(line string) *Args {
+	return &Args{
+		words: strings.Fields(line),
+		pos:   -1,
+	}
+}
+
+// advance to next word, returns false when no more words
+func (a *Args) Scan() bool {
+	if a.pos+1 >= len(a.words) {
+		a.pos = len(a.words)
+		return false
+	}
+	a.pos += 1
+	return true
+}
+
+// current word
+func (a *Args) Text() string {
+	if a.pos < 0 || a.pos >= len(a.words) {
+		return ""
+	}
+	return a.words[a.pos]
+}
+
+// scan next word as an integer, returns false when no more words or word is not an integer
+func (a *Args) Int() (int, bool) {
+	if !a.Scan() {
+		return 0, false
+	}
+	value, err := strconv.Atoi(a.Text())
+	return value, err == nil
+}
+
+// consume and return all remaining words
+func (a *Args) Rest() []string {
+	rest := []string{}
+	for a.Scan() {
+		rest = append(rest, a.Text())
+	}
+	return rest
+}
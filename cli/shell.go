@@ -0,0 +1,327 @@
+// Copyright 2019 The trust-net Authors
+// Reusable interactive shell for test drivers and operator consoles
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"golang.org/x/crypto/ssh/terminal"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// max number of lines remembered in shell's history
+var MaxHistory = 1000
+
+// return from a command's Run to leave the shell
+var ErrQuit = fmt.Errorf("quit")
+
+// return from a command's Run to print command's usage
+var ErrUsage = fmt.Errorf("invalid usage")
+
+// a command of the shell
+type Command struct {
+	Name    string
+	Aliases []string
+	// usage and description of the command, e.g. "usage: show <resource name> ...", "show resource's value"
+	Usage       string
+	Description string
+	// run command with its arguments, remaining arguments are run as next command of the line
+	Run func(args *Args) error
+	// optional completions for argument being typed, given prior arguments of the command
+	Complete func(prev []string, prefix string) []string
+}
+
+type Shell struct {
+	prompt   string
+	commands map[string]*Command
+	names    []string
+	history  []string
+	in       io.Reader
+	out      io.Writer
+	scanner  *bufio.Scanner
+	term     *terminal.Terminal
+	lock     sync.RWMutex
+}
+
+// create a shell over standard input and output
+func NewShell(prompt string) *Shell {
+	return NewShellIO(prompt, os.Stdin, os.Stdout)
+}
+
+// create a shell over provided input and output
+func NewShellIO(prompt string, in io.Reader, out io.Writer) *Shell {
+	s := &Shell{
+		prompt:   prompt,
+		commands: make(map[string]*Command),
+		history:  []string{},
+		in:       in,
+		out:      out,
+	}
+	s.Register(Command{
+		Name:        "help",
+		Aliases:     []string{"h"},
+		Usage:       "usage: help [<command>]",
+		Description: "list accepted commands, or show usage of a command",
+		Run: func(args *Args) error {
+			name := ""
+			if args.Scan() {
+				name = args.Text()
+			}
+			fmt.Fprint(s.out, s.Help(name))
+			return nil
+		},
+		Complete: func(prev []string, prefix string) []string {
+			if len(prev) == 0 {
+				return s.matchCommands(prefix)
+			}
+			return nil
+		},
+	})
+	s.Register(Command{
+		Name:        "history",
+		Usage:       "usage: history",
+		Description: "list previous command lines, re-run a line using !<number> or last line using !!",
+		Run: func(args *Args) error {
+			for i, line := range s.History() {
+				fmt.Fprintf(s.out, "% 5d  %s\n", i+1, line)
+			}
+			return nil
+		},
+	})
+	return s
+}
+
+// register a command with the shell
+func (s *Shell) Register(cmd Command) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(cmd.Name) == 0 || cmd.Run == nil {
+		return fmt.Errorf("missing command name or handler")
+	}
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		if _, found := s.commands[name]; found {
+			return fmt.Errorf("command already registered: %s", name)
+		}
+	}
+	for _, name := range append([]string{cmd.Name}, cmd.Aliases...) {
+		s.commands[name] = &cmd
+	}
+	s.names = append(s.names, cmd.Name)
+	sort.Strings(s.names)
+	return nil
+}
+
+func (s *Shell) SetPrompt(prompt string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.prompt = prompt
+}
+
+func (s *Shell) Prompt() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.prompt
+}
+
+// help text listing all commands, or usage of a specific command
+func (s *Shell) Help(name string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	var b strings.Builder
+	if len(name) > 0 {
+		if cmd, found := s.commands[name]; !found {
+			fmt.Fprintf(&b, "Unknown Command: %s\n", name)
+		} else {
+			fmt.Fprintf(&b, "%s\n%s\n", cmd.Description, cmd.Usage)
+		}
+		return b.String()
+	}
+	b.WriteString("Accepted commands...\n")
+	for _, name := range s.names {
+		cmd := s.commands[name]
+		if len(cmd.Aliases) > 0 {
+			name += " (" + strings.Join(cmd.Aliases, ", ") + ")"
+		}
+		fmt.Fprintf(&b, "  %-20s %s\n", name, cmd.Description)
+	}
+	return b.String()
+}
+
+// previous command lines, oldest first
+func (s *Shell) History() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]string{}, s.history...)
+}
+
+// expand a history reference ("!!" or "!<number>") and record line in history
+func (s *Shell) remember(line string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if strings.HasPrefix(line, "!") {
+		index := len(s.history)
+		if line != "!!" {
+			var err error
+			if index, err = strconv.Atoi(line[1:]); err != nil {
+				return "", fmt.Errorf("invalid history reference: %s", line)
+			}
+		}
+		if index < 1 || index > len(s.history) {
+			return "", fmt.Errorf("no such history entry: %s", line)
+		}
+		line = s.history[index-1]
+	}
+	s.history = append(s.history, line)
+	if len(s.history) > MaxHistory {
+		s.history = s.history[len(s.history)-MaxHistory:]
+	}
+	return line, nil
+}
+
+// execute a command line, returns ErrQuit when a command asks to leave the shell
+func (s *Shell) Exec(line string) error {
+	line = strings.TrimSpace(line)
+	if len(line) == 0 {
+		return nil
+	}
+	line, err := s.remember(line)
+	if err != nil {
+		fmt.Fprintf(s.out, "%s\n", err)
+		return nil
+	}
+	args := NewArgs(line)
+	for args.Scan() {
+		name := args.Text()
+		s.lock.RLock()
+		cmd, found := s.commands[name]
+		s.lock.RUnlock()
+		if !found {
+			fmt.Fprintf(s.out, "Unknown Command: %s", name)
+			for _, word := range args.Rest() {
+				fmt.Fprintf(s.out, " %s", word)
+			}
+			fmt.Fprintf(s.out, "\n\n%s", s.Help(""))
+			return nil
+		}
+		switch err := cmd.Run(args); err {
+		case nil:
+		case ErrQuit:
+			return ErrQuit
+		case ErrUsage:
+			fmt.Fprintf(s.out, "%s\n%s\n", cmd.Description, cmd.Usage)
+		default:
+			fmt.Fprintf(s.out, "Error: %s\n", err)
+		}
+	}
+	return nil
+}
+
+func (s *Shell) matchCommands(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	matches := []string{}
+	for name, _ := range s.commands {
+		if strings.HasPrefix(name, prefix) {
+			matches = append(matches, name)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// completions for the last word of a partial command line
+func (s *Shell) Complete(line string) []string {
+	words := strings.Fields(line)
+	prefix := ""
+	if len(words) > 0 && !strings.HasSuffix(line, " ") {
+		prefix, words = words[len(words)-1], words[:len(words)-1]
+	}
+	if len(words) == 0 {
+		return s.matchCommands(prefix)
+	}
+	s.lock.RLock()
+	cmd, found := s.commands[words[0]]
+	s.lock.RUnlock()
+	if !found || cmd.Complete == nil {
+		return nil
+	}
+	return cmd.Complete(words[1:], prefix)
+}
+
+// tab completion callback for terminal, completes the word at cursor up to longest common prefix
+func (s *Shell) autoComplete(line string, pos int, key rune) (string, int, bool) {
+	if key != '\t' {
+		return "", 0, false
+	}
+	matches := s.Complete(line[:pos])
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	common := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, common) {
+			common = common[:len(common)-1]
+		}
+	}
+	if len(matches) == 1 {
+		common += " "
+	}
+	start := pos
+	for start > 0 && line[start-1] != ' ' {
+		start--
+	}
+	return line[:start] + common + line[pos:], start + len(common), true
+}
+
+// read next command line, with line editing, history and tab completion when input is a terminal
+func (s *Shell) readLine() (string, error) {
+	if in, ok := s.in.(*os.File); ok && terminal.IsTerminal(int(in.Fd())) {
+		if s.term == nil {
+			s.term = terminal.NewTerminal(struct {
+				io.Reader
+				io.Writer
+			}{s.in, s.out}, s.Prompt())
+			s.term.AutoCompleteCallback = s.autoComplete
+		}
+		// keep terminal in raw mode only while reading, so that command output is not affected
+		state, err := terminal.MakeRaw(int(in.Fd()))
+		if err != nil {
+			return "", err
+		}
+		defer terminal.Restore(int(in.Fd()), state)
+		s.term.SetPrompt(s.Prompt())
+		return s.term.ReadLine()
+	}
+	if s.scanner == nil {
+		s.scanner = bufio.NewScanner(s.in)
+	}
+	fmt.Fprint(s.out, s.Prompt())
+	if !s.scanner.Scan() {
+		if err := s.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	return s.scanner.Text(), nil
+}
+
+// run the shell until a command asks to quit or input ends
+func (s *Shell) Run() error {
+	for {
+		line, err := s.readLine()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := s.Exec(line); err == ErrQuit {
+			return nil
+		}
+		fmt.Fprintf(s.out, "\n")
+	}
+}
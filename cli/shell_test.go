@@ -0,0 +1,132 @@
+// Copyright 2019 The trust-net Authors
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testShell(input string) (*Shell, *bytes.Buffer, *[]string) {
+	out := &bytes.Buffer{}
+	s := NewShellIO("> ", strings.NewReader(input), out)
+	calls := &[]string{}
+	s.Register(Command{
+		Name:        "show",
+		Aliases:     []string{"v"},
+		Usage:       "usage: show <name> ...",
+		Description: "show values",
+		Run: func(args *Args) error {
+			names := args.Rest()
+			if len(names) == 0 {
+				return ErrUsage
+			}
+			*calls = append(*calls, "show "+strings.Join(names, " "))
+			return nil
+		},
+		Complete: func(prev []string, prefix string) []string {
+			return []string{prefix + "-1", prefix + "-2"}
+		},
+	})
+	s.Register(Command{
+		Name:        "incr",
+		Usage:       "usage: incr <name>",
+		Description: "increment a value",
+		Run: func(args *Args) error {
+			if !args.Scan() {
+				return ErrUsage
+			}
+			*calls = append(*calls, "incr "+args.Text())
+			return nil
+		},
+	})
+	s.Register(Command{
+		Name:        "quit",
+		Aliases:     []string{"q"},
+		Usage:       "usage: quit",
+		Description: "leave",
+		Run:         func(args *Args) error { return ErrQuit },
+	})
+	return s, out, calls
+}
+
+// test that commands consume their arguments and remaining words run as next command
+func TestExec(t *testing.T) {
+	s, out, calls := testShell("")
+	s.Exec("incr a incr b v c d")
+	if strings.Join(*calls, ",") != "incr a,incr b,show c d" {
+		t.Errorf("incorrect commands: %v", *calls)
+	}
+	s.Exec("show")
+	if !strings.Contains(out.String(), "usage: show <name> ...") {
+		t.Errorf("usage not printed: %s", out.String())
+	}
+	s.Exec("unknown x")
+	if !strings.Contains(out.String(), "Unknown Command: unknown x") || !strings.Contains(out.String(), "show (v)") {
+		t.Errorf("help not printed for unknown command: %s", out.String())
+	}
+	if err := s.Exec("q"); err != ErrQuit {
+		t.Errorf("quit should leave shell")
+	}
+}
+
+// test that duplicate command names are rejected
+func TestRegister_Duplicate(t *testing.T) {
+	s, _, _ := testShell("")
+	if err := s.Register(Command{Name: "x", Aliases: []string{"v"}, Run: func(args *Args) error { return nil }}); err == nil {
+		t.Errorf("duplicate alias should be rejected")
+	}
+	if err := s.Register(Command{Name: "y"}); err == nil {
+		t.Errorf("command without handler should be rejected")
+	}
+}
+
+// test history recording and recall
+func TestHistory(t *testing.T) {
+	s, out, calls := testShell("")
+	s.Exec("incr a")
+	s.Exec("show b")
+	s.Exec("!1")
+	s.Exec("!!")
+	if strings.Join(*calls, ",") != "incr a,show b,incr a,incr a" {
+		t.Errorf("incorrect commands: %v", *calls)
+	}
+	if history := s.History(); len(history) != 4 || history[3] != "incr a" {
+		t.Errorf("incorrect history: %v", history)
+	}
+	s.Exec("!9")
+	if !strings.Contains(out.String(), "no such history entry") {
+		t.Errorf("invalid history reference not reported")
+	}
+}
+
+// test completion of command names and arguments
+func TestComplete(t *testing.T) {
+	s, _, _ := testShell("")
+	if matches := s.Complete("h"); strings.Join(matches, ",") != "h,help,history" {
+		t.Errorf("incorrect command completions: %v", matches)
+	}
+	if matches := s.Complete("show x"); strings.Join(matches, ",") != "x-1,x-2" {
+		t.Errorf("incorrect argument completions: %v", matches)
+	}
+	if line, pos, ok := s.autoComplete("sh", 2, '\t'); !ok || line != "show " || pos != 5 {
+		t.Errorf("incorrect auto completion: %s, %d", line, pos)
+	}
+	if line, _, ok := s.autoComplete("show x", 6, '\t'); !ok || line != "show x-" {
+		t.Errorf("incorrect auto completion to common prefix: %s", line)
+	}
+}
+
+// test that shell runs commands from input until quit
+func TestRun(t *testing.T) {
+	s, out, calls := testShell("incr a\n\nshow b\nquit\nincr c\n")
+	if err := s.Run(); err != nil {
+		t.Errorf("shell failed: %s", err)
+	}
+	if strings.Join(*calls, ",") != "incr a,show b" {
+		t.Errorf("incorrect commands: %v", *calls)
+	}
+	if !strings.HasPrefix(out.String(), "> ") {
+		t.Errorf("prompt not printed: %s", out.String())
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2019 The trust-net Authors
+// Bloom filter to rule out keys not present in a set, growing with the set by adding filters of larger capacity
+package common
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// min number of keys a filter is sized for
+const bloomMinCapacity = 1024
+
+// a fixed capacity filter, for one step of growth
+type bloomStage struct {
+	bits     []uint64
+	hashes   uint64
+	capacity uint64
+	count    uint64
+}
+
+func newBloomStage(capacity uint64, fpRate float64) *bloomStage {
+	// optimal number of bits and hash functions for capacity and false positive rate
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(fpRate) / (math.Ln2 * math.Ln2)))
+	hashes := uint64(math.Ceil(float64(size) / float64(capacity) * math.Ln2))
+	if hashes < 1 {
+		hashes = 1
+	}
+	return &bloomStage{
+		bits:     make([]uint64, (size+63)/64),
+		hashes:   hashes,
+		capacity: capacity,
+	}
+}
+
+// bit positions of a key, using double hashing of key's two hashes
+func (s *bloomStage) positions(h1, h2 uint64, visit func(word, mask uint64) bool) bool {
+	size := uint64(len(s.bits)) * 64
+	for i := uint64(0); i < s.hashes; i++ {
+		pos := (h1 + i*h2) % size
+		if !visit(pos/64, 1<<(pos%64)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *bloomStage) add(h1, h2 uint64) {
+	s.positions(h1, h2, func(word, mask uint64) bool {
+		s.bits[word] |= mask
+		return true
+	})
+	s.count += 1
+}
+
+func (s *bloomStage) has(h1, h2 uint64) bool {
+	return s.positions(h1, h2, func(word, mask uint64) bool {
+		return s.bits[word]&mask != 0
+	})
+}
+
+type BloomFilter struct {
+	// false positive rate of filter, across all stages
+	fpRate   float64
+	capacity uint64
+	stages   []*bloomStage
+	lock     sync.RWMutex
+}
+
+// create a filter for approximately capacity keys with specified false positive rate, filter grows
+// beyond capacity while keeping (approximately) the false positive rate
+func NewBloomFilter(capacity uint64, fpRate float64) *BloomFilter {
+	if capacity < bloomMinCapacity {
+		capacity = bloomMinCapacity
+	}
+	f := &BloomFilter{
+		fpRate:   fpRate,
+		capacity: capacity,
+	}
+	f.reset()
+	return f
+}
+
+func bloomHashes(key []byte) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write(key)
+	h1 := h.Sum64()
+	h = fnv.New64()
+	h.Write(key)
+	// odd second hash, so that positions cycle through all bits
+	return h1, h.Sum64() | 1
+}
+
+func (f *BloomFilter) reset() {
+	// first stage takes half of the false positive rate, each later stage half of previous stage
+	f.stages = []*bloomStage{newBloomStage(f.capacity, f.fpRate/2)}
+}
+
+// add a key to the filter
+func (f *BloomFilter) Add(key []byte) {
+	h1, h2 := bloomHashes(key)
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	last := f.stages[len(f.stages)-1]
+	if last.count >= last.capacity {
+		last = newBloomStage(last.capacity*2, f.fpRate/math.Pow(2, float64(len(f.stages)+1)))
+		f.stages = append(f.stages, last)
+	}
+	last.add(h1, h2)
+}
+
+// check if key may have been added to the filter, false means key was definitely not added
+func (f *BloomFilter) MayContain(key []byte) bool {
+	h1, h2 := bloomHashes(key)
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	for _, stage := range f.stages {
+		if stage.has(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// number of keys added to the filter
+func (f *BloomFilter) Count() uint64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	count := uint64(0)
+	for _, stage := range f.stages {
+		count += stage.count
+	}
+	return count
+}
+
+// remove all keys from the filter
+func (f *BloomFilter) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.reset()
+}
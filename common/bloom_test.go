@@ -0,0 +1,37 @@
+// Copyright 2019 The trust-net Authors
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+// added keys should always be found, and keys not added should be found at about the false positive rate,
+// also after filter grows beyond its capacity
+func TestBloomFilter(t *testing.T) {
+	uut := NewBloomFilter(1000, 0.01)
+	for i := 0; i < 10000; i++ {
+		uut.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	if uut.Count() != 10000 {
+		t.Errorf("Expected: %d, Actual: %d", 10000, uut.Count())
+	}
+	for i := 0; i < 10000; i++ {
+		if !uut.MayContain([]byte(fmt.Sprintf("key-%d", i))) {
+			t.Fatalf("Expected: key-%d, Not found", i)
+		}
+	}
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if uut.MayContain([]byte(fmt.Sprintf("missing-%d", i))) {
+			falsePositives += 1
+		}
+	}
+	if falsePositives > 200 {
+		t.Errorf("Too many false positives: %d", falsePositives)
+	}
+	uut.Reset()
+	if uut.Count() != 0 || uut.MayContain([]byte("key-1")) {
+		t.Errorf("Filter not reset")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2019 The trust-net Authors
+// Pluggable codecs of serialized entities, gob (Go only) and protobuf (for non-Go clients)
+package common
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// names of codecs, as selected in config
+const (
+	CodecGob      = "gob"
+	CodecProtobuf = "protobuf"
+)
+
+// codec of serialized entities
+type Codec interface {
+	Name() string
+	Marshal(entity interface{}) ([]byte, error)
+	Unmarshal(data []byte, entity interface{}) error
+}
+
+// codec using Go's gob encoding (same as Serialize/Deserialize), for any entity
+var GobCodec Codec = gobCodec{}
+
+// codec using protobuf wire format, for entities implementing ProtoMessage
+var ProtobufCodec Codec = protobufCodec{}
+
+// get a codec by its name, gob when name is empty
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", CodecGob:
+		return GobCodec, nil
+	case CodecProtobuf:
+		return ProtobufCodec, nil
+	default:
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Name() string {
+	return CodecGob
+}
+
+func (gobCodec) Marshal(entity interface{}) ([]byte, error) {
+	return Serialize(entity)
+}
+
+func (gobCodec) Unmarshal(data []byte, entity interface{}) error {
+	return Deserialize(data, entity)
+}
+
+// an entity with a protobuf schema
+type ProtoMessage interface {
+	MarshalProto() ([]byte, error)
+	UnmarshalProto(data []byte) error
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+	return CodecProtobuf
+}
+
+func (protobufCodec) Marshal(entity interface{}) ([]byte, error) {
+	if m, ok := entity.(ProtoMessage); !ok {
+		return nil, fmt.Errorf("no protobuf schema for %T", entity)
+	} else {
+		return m.MarshalProto()
+	}
+}
+
+func (protobufCodec) Unmarshal(data []byte, entity interface{}) error {
+	if m, ok := entity.(ProtoMessage); !ok {
+		return fmt.Errorf("no protobuf schema for %T", entity)
+	} else {
+		return m.UnmarshalProto(data)
+	}
+}
+
+// protobuf wire types
+const (
+	protoVarint  = 0
+	protoFixed64 = 1
+	protoBytes   = 2
+	protoFixed32 = 5
+)
+
+// writer of an entity's fields in protobuf wire format, zero values of scalar fields are omitted (as in proto3)
+type ProtoWriter struct {
+	buf []byte
+}
+
+func (w *ProtoWriter) key(field, wire int) {
+	w.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (w *ProtoWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf = append(w.buf, b[:binary.PutUvarint(b[:], v)]...)
+}
+
+// write a uint64 field, omitted when 0
+func (w *ProtoWriter) Uint64(field int, v uint64) {
+	if v != 0 {
+		w.key(field, protoVarint)
+		w.varint(v)
+	}
+}
+
+// write a bytes field, omitted when empty
+func (w *ProtoWriter) Bytes(field int, v []byte) {
+	if len(v) > 0 {
+		w.Repeated(field, v)
+	}
+}
+
+// write an element of a repeated bytes field, written even when empty
+func (w *ProtoWriter) Repeated(field int, v []byte) {
+	w.key(field, protoBytes)
+	w.varint(uint64(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+// write a 64 byte hash as a bytes field
+func (w *ProtoWriter) Hash(field int, v [64]byte) {
+	w.Repeated(field, v[:])
+}
+
+// write an embedded message field
+func (w *ProtoWriter) Message(field int, m ProtoMessage) error {
+	data, err := m.MarshalProto()
+	if err != nil {
+		return err
+	}
+	w.Repeated(field, data)
+	return nil
+}
+
+// encoded fields written so far
+func (w *ProtoWriter) Result() []byte {
+	return w.buf
+}
+
+// reader of an entity's fields in protobuf wire format, fields not consumed (e.g. unknown fields) are skipped
+type ProtoReader struct {
+	data  []byte
+	field int
+	wire  int
+	value uint64
+	bytes []byte
+	err   error
+}
+
+func NewProtoReader(data []byte) *ProtoReader {
+	return &ProtoReader{data: data}
+}
+
+func (r *ProtoReader) varint() (uint64, bool) {
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = fmt.Errorf("malformed protobuf varint")
+		return 0, false
+	}
+	r.data = r.data[n:]
+	return v, true
+}
+
+func (r *ProtoReader) take(n uint64) ([]byte, bool) {
+	if uint64(len(r.data)) < n {
+		r.err = fmt.Errorf("truncated protobuf field %d", r.field)
+		return nil, false
+	}
+	v := r.data[:n]
+	r.data = r.data[n:]
+	return v, true
+}
+
+// advance to next field, returns false at end of data or on a malformed field
+func (r *ProtoReader) Next() bool {
+	if r.err != nil || len(r.data) == 0 {
+		return false
+	}
+	key, ok := r.varint()
+	if !ok {
+		return false
+	}
+	r.field, r.wire = int(key>>3), int(key&0x7)
+	switch r.wire {
+	case protoVarint:
+		r.value, ok = r.varint()
+	case protoBytes:
+		var size uint64
+		if size, ok = r.varint(); ok {
+			r.bytes, ok = r.take(size)
+		}
+	case protoFixed64:
+		_, ok = r.take(8)
+	case protoFixed32:
+		_, ok = r.take(4)
+	default:
+		r.err, ok = fmt.Errorf("unsupported protobuf wire type %d of field %d", r.wire, r.field), false
+	}
+	return ok
+}
+
+// number of current field
+func (r *ProtoReader) Field() int {
+	return r.field
+}
+
+// value of current field as uint64
+func (r *ProtoReader) Uint64() uint64 {
+	if r.wire != protoVarint {
+		r.err = fmt.Errorf("protobuf field %d is not a varint", r.field)
+		return 0
+	}
+	return r.value
+}
+
+// value of current field as bytes (a copy)
+func (r *ProtoReader) Bytes() []byte {
+	if r.wire != protoBytes {
+		r.err = fmt.Errorf("protobuf field %d is not bytes", r.field)
+		return nil
+	}
+	return append([]byte{}, r.bytes...)
+}
+
+// value of current field as a 64 byte hash
+func (r *ProtoReader) Hash() (hash [64]byte) {
+	if v := r.Bytes(); r.err == nil && len(v) != 64 {
+		r.err = fmt.Errorf("protobuf field %d is not a 64 byte hash", r.field)
+	} else {
+		copy(hash[:], v)
+	}
+	return hash
+}
+
+// value of current field as an embedded message
+func (r *ProtoReader) Message(m ProtoMessage) {
+	if v := r.Bytes(); r.err == nil {
+		r.err = m.UnmarshalProto(v)
+	}
+}
+
+// first error reading fields, if any
+func (r *ProtoReader) Err() error {
+	return r.err
+}
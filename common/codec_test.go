@@ -0,0 +1,106 @@
+// Copyright 2019 The trust-net Authors
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testProtoEntity struct {
+	Name  []byte
+	Count uint64
+	Hash  [64]byte
+	Tags  [][]byte
+}
+
+func (e *testProtoEntity) MarshalProto() ([]byte, error) {
+	w := &ProtoWriter{}
+	w.Bytes(1, e.Name)
+	w.Uint64(2, e.Count)
+	w.Hash(3, e.Hash)
+	for _, tag := range e.Tags {
+		w.Repeated(4, tag)
+	}
+	return w.Result(), nil
+}
+
+func (e *testProtoEntity) UnmarshalProto(data []byte) error {
+	*e = testProtoEntity{}
+	r := NewProtoReader(data)
+	for r.Next() {
+		switch r.Field() {
+		case 1:
+			e.Name = r.Bytes()
+		case 2:
+			e.Count = r.Uint64()
+		case 3:
+			e.Hash = r.Hash()
+		case 4:
+			e.Tags = append(e.Tags, r.Bytes())
+		}
+	}
+	return r.Err()
+}
+
+func TestCodecByName(t *testing.T) {
+	for name, expected := range map[string]Codec{"": GobCodec, CodecGob: GobCodec, CodecProtobuf: ProtobufCodec} {
+		if codec, err := CodecByName(name); err != nil || codec != expected {
+			t.Errorf("incorrect codec for %q: %v, %s", name, codec, err)
+		}
+	}
+	if _, err := CodecByName("cbor"); err == nil {
+		t.Errorf("expected unknown codec to fail")
+	}
+}
+
+// entities should round trip through each codec, and protobuf codec should refuse entities without a schema
+func TestCodec_RoundTrip(t *testing.T) {
+	entity := &testProtoEntity{Name: []byte("name"), Count: 300, Tags: [][]byte{[]byte("a"), {}, []byte("c")}}
+	entity.Hash[0], entity.Hash[63] = 0x01, 0xff
+	for _, codec := range []Codec{GobCodec, ProtobufCodec} {
+		var decoded testProtoEntity
+		if data, err := codec.Marshal(entity); err != nil {
+			t.Errorf("failed to marshal with %s: %s", codec.Name(), err)
+		} else if err := codec.Unmarshal(data, &decoded); err != nil {
+			t.Errorf("failed to unmarshal with %s: %s", codec.Name(), err)
+		} else if !bytes.Equal(decoded.Name, entity.Name) || decoded.Count != entity.Count || decoded.Hash != entity.Hash ||
+			len(decoded.Tags) != 3 || string(decoded.Tags[2]) != "c" {
+			t.Errorf("entity did not round trip with %s: %v", codec.Name(), decoded)
+		}
+	}
+	if _, err := ProtobufCodec.Marshal(&TestEntity{}); err == nil {
+		t.Errorf("expected entity without protobuf schema to fail")
+	}
+}
+
+// fields should be encoded as per protobuf wire format, and unknown fields skipped when reading
+func TestProtoWireFormat(t *testing.T) {
+	w := &ProtoWriter{}
+	w.Uint64(2, 300)
+	w.Bytes(1, []byte("hi"))
+	w.Uint64(5, 0)
+	if expected := []byte{0x10, 0xac, 0x02, 0x0a, 0x02, 'h', 'i'}; !bytes.Equal(w.Result(), expected) {
+		t.Errorf("incorrect encoding: %x", w.Result())
+	}
+	// unknown varint, fixed64, bytes and fixed32 fields
+	data := append([]byte{0x48, 0x01, 0x51, 1, 2, 3, 4, 5, 6, 7, 8, 0x5a, 0x01, 'x', 0x65, 1, 2, 3, 4}, w.Result()...)
+	var entity testProtoEntity
+	if err := entity.UnmarshalProto(data); err != nil || entity.Count != 300 || string(entity.Name) != "hi" {
+		t.Errorf("incorrect decoding: %v, %s", entity, err)
+	}
+}
+
+func TestProtoReader_Malformed(t *testing.T) {
+	var entity testProtoEntity
+	for _, data := range [][]byte{
+		{0x0a, 0x05, 'h'},
+		{0x10, 0xff},
+		{0x0b},
+		{0x0a, 0x02, 'h', 'i', 0x1a, 0x01, 0x00},
+		{0x08, 0x01},
+	} {
+		if err := entity.UnmarshalProto(data); err == nil {
+			t.Errorf("expected malformed data to fail: %x", data)
+		}
+	}
+}
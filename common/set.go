@@ -58,6 +58,17 @@ func (set *Set) Has(item interface{}) bool {
 	return has
 }
 
+// get a copy of all elements of the set, in no particular order
+func (set *Set) Items() []interface{} {
+	set.lock.RLock()
+	defer set.lock.RUnlock()
+	items := make([]interface{}, 0, len(set.data))
+	for item, _ := range set.data {
+		items = append(items, item)
+	}
+	return items
+}
+
 func (set *Set) Pop() interface{} {
 	set.lock.Lock()
 	defer set.lock.Unlock()
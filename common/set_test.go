@@ -71,3 +71,17 @@ func TestNonExistingRemove(t *testing.T) {
 		t.Errorf("Expected: %d, Actual: %d", 3, uut.Size())
 	}
 }
+
+func TestItems(t *testing.T) {
+	uut := NewSet()
+	uut.Add("1", 2, 'c')
+	items := uut.Items()
+	if len(items) != 3 {
+		t.Errorf("Expected: %d, Actual: %d", 3, len(items))
+	}
+	for _, item := range items {
+		if !uut.Has(item) {
+			t.Errorf("Expected: %s, Not found", item)
+		}
+	}
+}
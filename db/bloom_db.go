@@ -0,0 +1,120 @@
+// Copyright 2019 The trust-net Authors
+// Database wrapper answering lookups of keys not in the database from a bloom filter, without reading the database
+package db
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/common"
+	"sync"
+	"sync/atomic"
+)
+
+type bloomDb struct {
+	Database
+	filter *common.BloomFilter
+	// number of lookups answered by the filter as not found
+	skipped uint64
+}
+
+// databases wrapped so far, so that a database is populated into a filter only once
+var bloomDbs = make(map[Database]*bloomDb)
+var bloomDbsLock sync.Mutex
+
+// wrap a database with a bloom filter of specified false positive rate, populated with keys of existing records
+// derived from their values by keyOf. Same wrapper is returned for a database already wrapped, and database is
+// returned as is when rate is 0 or key of an existing record cannot be derived
+func NewBloomDatabase(database Database, fpRate float64, keyOf func(value []byte) ([]byte, error)) Database {
+	if database == nil || fpRate <= 0 || fpRate >= 1 {
+		return database
+	}
+	if buffered, ok := database.(BufferedDatabase); ok {
+		// wrap the underlying database instead, so that its filter is populated only once and learns keys of
+		// buffered writes when they are applied
+		return buffered.Over(NewBloomDatabase(buffered.Underlying(), fpRate, keyOf))
+	}
+	bloomDbsLock.Lock()
+	defer bloomDbsLock.Unlock()
+	if wrapped, found := bloomDbs[database]; found {
+		return wrapped
+	}
+	values := database.GetAll()
+	filter := common.NewBloomFilter(uint64(2*len(values)), fpRate)
+	for _, value := range values {
+		if key, err := keyOf(value); err != nil {
+			return database
+		} else {
+			filter.Add(key)
+		}
+	}
+	wrapped := &bloomDb{
+		Database: database,
+		filter:   filter,
+	}
+	bloomDbs[database] = wrapped
+	return wrapped
+}
+
+// number of lookups of a database answered by its bloom filter as not found (0 if database is not wrapped)
+func BloomSkipped(database Database) uint64 {
+	if buffered, ok := database.(BufferedDatabase); ok {
+		database = buffered.Underlying()
+	}
+	if wrapped, ok := database.(*bloomDb); ok {
+		return atomic.LoadUint64(&wrapped.skipped)
+	}
+	return 0
+}
+
+func (db *bloomDb) Put(key []byte, value []byte) error {
+	// add key before the write, so that a concurrent lookup never misses a written record
+	db.filter.Add(key)
+	return db.Database.Put(key, value)
+}
+
+// batch of writes to a database wrapped with a bloom filter, adding keys to the filter before the write
+type bloomBatch struct {
+	Batch
+	filter *common.BloomFilter
+	keys   [][]byte
+}
+
+func (b *bloomBatch) Put(key []byte, value []byte) {
+	b.keys = append(b.keys, key)
+	b.Batch.Put(key, value)
+}
+
+func (b *bloomBatch) Write() error {
+	for _, key := range b.keys {
+		b.filter.Add(key)
+	}
+	return b.Batch.Write()
+}
+
+func (db *bloomDb) NewBatch() Batch {
+	return &bloomBatch{
+		Batch:  db.Database.NewBatch(),
+		filter: db.filter,
+	}
+}
+
+func (db *bloomDb) Get(key []byte) ([]byte, error) {
+	if !db.filter.MayContain(key) {
+		atomic.AddUint64(&db.skipped, 1)
+		return nil, errors.New("not found")
+	}
+	return db.Database.Get(key)
+}
+
+func (db *bloomDb) Has(key []byte) (bool, error) {
+	if !db.filter.MayContain(key) {
+		atomic.AddUint64(&db.skipped, 1)
+		return false, nil
+	}
+	return db.Database.Has(key)
+}
+
+func (db *bloomDb) Drop() error {
+	// reset filter before the drop, so that a concurrent write is not missed by filter
+	db.filter.Reset()
+	return db.Database.Drop()
+}
@@ -4,17 +4,50 @@ package db
 
 import ()
 
+// iterator over records of a database, in order of keys
+type Iterator interface {
+	// advance to next record, returns false when there are no more records
+	Next() bool
+	// key of current record
+	Key() []byte
+	// value of current record
+	Value() []byte
+	// release resources held by iterator
+	Release()
+}
+
+// a batch of writes to a database, applied together by a single write
+type Batch interface {
+	Put(key []byte, value []byte)
+	Delete(key []byte)
+	// apply all writes of the batch atomically
+	Write() error
+}
+
 type Database interface {
 	Put(key []byte, value []byte) error
 	Get(key []byte) ([]byte, error)
 	GetAll() [][]byte
+	// iterate over records with keys starting with prefix (all records for empty prefix), in order of keys
+	Iterator(prefix []byte) Iterator
 	Has(key []byte) (bool, error)
 	Delete(key []byte) error
+	// start a batch of writes, applied to database only when batch is written
+	NewBatch() Batch
 	Close() error
 	Name() string
 	Drop() error
 }
 
+// a database view that buffers its writes (e.g. in a write batch) before they are applied to an underlying database
+type BufferedDatabase interface {
+	Database
+	// database that buffered writes are applied to
+	Underlying() Database
+	// same view buffering writes to another database, e.g. a wrapper of the underlying database
+	Over(database Database) Database
+}
+
 type DbProvider interface {
 	DB(namespace string) Database
 	CloseAll() error
@@ -5,6 +5,8 @@ package db
 import (
 	"errors"
 	"github.com/trust-net/dag-lib-go/log"
+	"sort"
+	"strings"
 	"sync"
 )
 
@@ -93,6 +95,47 @@ func (db *inMemDb) GetAll() [][]byte {
 	return values
 }
 
+// iterator over a copy of matching records, taken when iterator is created
+type inMemIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+func (it *inMemIterator) Next() bool {
+	if it.pos >= len(it.keys) {
+		return false
+	}
+	it.pos += 1
+	return true
+}
+
+func (it *inMemIterator) Key() []byte {
+	return []byte(it.keys[it.pos-1])
+}
+
+func (it *inMemIterator) Value() []byte {
+	return it.values[it.pos-1]
+}
+
+func (it *inMemIterator) Release() {}
+
+func (db *inMemDb) Iterator(prefix []byte) Iterator {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	it := &inMemIterator{}
+	for k, _ := range db.mdb {
+		if strings.HasPrefix(k, string(prefix)) {
+			it.keys = append(it.keys, k)
+		}
+	}
+	sort.Strings(it.keys)
+	for _, k := range it.keys {
+		it.values = append(it.values, db.mdb[k])
+	}
+	return it
+}
+
 func (db *inMemDb) Drop() error {
 	db.lock.Lock()
 	defer db.lock.Unlock()
@@ -122,6 +165,43 @@ func (db *inMemDb) Delete(key []byte) error {
 	return nil
 }
 
+// writes of a batch, in order of calls
+type inMemBatch struct {
+	db      *inMemDb
+	keys    []string
+	values  [][]byte
+	deleted []bool
+}
+
+func (b *inMemBatch) Put(key []byte, value []byte) {
+	b.keys = append(b.keys, string(key))
+	b.values = append(b.values, value)
+	b.deleted = append(b.deleted, false)
+}
+
+func (b *inMemBatch) Delete(key []byte) {
+	b.keys = append(b.keys, string(key))
+	b.values = append(b.values, nil)
+	b.deleted = append(b.deleted, true)
+}
+
+func (b *inMemBatch) Write() error {
+	b.db.lock.Lock()
+	defer b.db.lock.Unlock()
+	for i, key := range b.keys {
+		if b.deleted[i] {
+			delete(b.db.mdb, key)
+		} else {
+			b.db.mdb[key] = b.values[i]
+		}
+	}
+	return nil
+}
+
+func (db *inMemDb) NewBatch() Batch {
+	return &inMemBatch{db: db}
+}
+
 func (db *inMemDb) Close() error {
 	db.isOpen = false
 	db.logger.Debug("Closed DB: %s", db.name)
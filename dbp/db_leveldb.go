@@ -6,8 +6,10 @@ import (
 	"github.com/syndtr/goleveldb/leveldb"
 	"github.com/syndtr/goleveldb/leveldb/errors"
 	"github.com/syndtr/goleveldb/leveldb/filter"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
 	"github.com/syndtr/goleveldb/leveldb/opt"
 	"github.com/syndtr/goleveldb/leveldb/util"
+	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/log"
 )
 
@@ -20,20 +22,35 @@ type dbLevelDB struct {
 	logger log.Logger
 	// connection status
 	isOpen bool
+	// compact full key range when closed
+	compactOnClose bool
 }
 
 func newDbLevelDB(namespace string, path string, cache int, handles int) (*dbLevelDB, error) {
+	opts := DefaultOptions()
+	opts.CacheSize, opts.Handles = cache, handles
+	return newDbLevelDBWithOptions(namespace, path, opts)
+}
+
+func newDbLevelDBWithOptions(namespace string, path string, opts Options) (*dbLevelDB, error) {
 	// Ensure we have some minimal caching and file guarantees
+	cache, handles := opts.CacheSize, opts.Handles
 	if cache < 16 {
 		cache = 16
 	}
 	if handles < 16 {
 		handles = 16
 	}
+	writeBuffer := opts.WriteBuffer
+	if writeBuffer <= 0 {
+		writeBuffer = cache / 4 // Two of these are used internally
+	}
 	ldb, err := leveldb.OpenFile(path, &opt.Options{
 		OpenFilesCacheCapacity: handles,
-		BlockCacheCapacity:     cache / 2,
-		WriteBuffer:            cache / 4, // Two of these are used internally
+		BlockCacheCapacity:     cache / 2 * opt.MiB,
+		WriteBuffer:            writeBuffer * opt.MiB,
+		CompactionL0Trigger:    opts.CompactionL0Trigger,
+		CompactionTableSize:    opts.CompactionTableSize * opt.MiB,
 		Filter:                 filter.NewBloomFilter(10),
 	})
 	if _, corrupted := err.(*errors.ErrCorrupted); corrupted {
@@ -45,10 +62,11 @@ func newDbLevelDB(namespace string, path string, cache int, handles int) (*dbLev
 	}
 
 	db := &dbLevelDB{
-		ldb:       ldb,
-		namespace: namespace,
-		logger:    log.NewLogger("db-" + namespace),
-		isOpen:    true,
+		ldb:            ldb,
+		namespace:      namespace,
+		logger:         log.NewLogger("db-" + namespace),
+		isOpen:         true,
+		compactOnClose: opts.CompactOnClose,
 	}
 	return db, nil
 }
@@ -77,6 +95,23 @@ func (db *dbLevelDB) GetAll() [][]byte {
 	return values
 }
 
+// iterator over leveldb records, copying key and value since leveldb re-uses its slices
+type dbLevelDBIterator struct {
+	iterator.Iterator
+}
+
+func (it *dbLevelDBIterator) Key() []byte {
+	return append([]byte{}, it.Iterator.Key()...)
+}
+
+func (it *dbLevelDBIterator) Value() []byte {
+	return append([]byte{}, it.Iterator.Value()...)
+}
+
+func (db *dbLevelDB) Iterator(prefix []byte) db.Iterator {
+	return &dbLevelDBIterator{db.ldb.NewIterator(util.BytesPrefix(prefix), nil)}
+}
+
 func (db *dbLevelDB) Name() string {
 	return db.namespace
 }
@@ -97,15 +132,47 @@ func (db *dbLevelDB) Delete(key []byte) error {
 	return db.ldb.Delete(key, nil)
 }
 
-func (db *dbLevelDB) Close() error {
-	db.isOpen = false
-	// compact the DB
+// batch of writes to leveldb, applied in a single write
+type levelDBBatch struct {
+	ldb   *leveldb.DB
+	batch *leveldb.Batch
+}
+
+func (b *levelDBBatch) Put(key []byte, value []byte) {
+	b.batch.Put(key, value)
+}
+
+func (b *levelDBBatch) Delete(key []byte) {
+	b.batch.Delete(key)
+}
+
+func (b *levelDBBatch) Write() error {
+	return b.ldb.Write(b.batch, nil)
+}
+
+func (db *dbLevelDB) NewBatch() db.Batch {
+	return &levelDBBatch{ldb: db.ldb, batch: new(leveldb.Batch)}
+}
+
+// compact full key range of the DB
+func (db *dbLevelDB) compact() error {
 	db.logger.Debug("Compacting database ...")
 	if err := db.ldb.CompactRange(util.Range{}); err != nil {
 		db.logger.Error("Failed to compact db: %s", err)
 		return err
 	}
 	db.logger.Debug("Compacting done.")
+	return nil
+}
+
+func (db *dbLevelDB) Close() error {
+	db.isOpen = false
+	if db.compactOnClose {
+		if err := db.compact(); err != nil {
+			db.ldb.Close()
+			return err
+		}
+	}
 	db.logger.Debug("Closing database ...")
 	defer db.logger.Debug("Close done.")
 	return db.ldb.Close()
@@ -184,6 +184,35 @@ func Test_Db_DeleteAfterPut(t *testing.T) {
 	}
 }
 
+func Test_Db_BatchWrite(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dirPath := "tmp"
+	namespace := "test"
+	defer cleanup(dirPath)
+
+	// create a db
+	dbp, _ := NewDbp(dirPath)
+	db := dbp.DB(namespace)
+	db.Put([]byte("old-key"), []byte("old-value"))
+
+	// batch writes should not be applied until batch is written
+	batch := db.NewBatch()
+	batch.Put([]byte("test-key"), []byte("test-value"))
+	batch.Delete([]byte("old-key"))
+	if exists, _ := db.Has([]byte("test-key")); exists {
+		t.Errorf("batch write applied before batch is written")
+	}
+	if err := batch.Write(); err != nil {
+		t.Errorf("failed to write batch: %s", err)
+	}
+	if value, err := db.Get([]byte("test-key")); err != nil || string(value) != "test-value" {
+		t.Errorf("batch put not applied: %s", value)
+	}
+	if exists, _ := db.Has([]byte("old-key")); exists {
+		t.Errorf("batch delete not applied")
+	}
+}
+
 func Test_Db_DeleteNotExisting(t *testing.T) {
 	log.SetLogLevel(log.NONE)
 	dirPath := "tmp"
@@ -272,6 +301,36 @@ func Test_Db_GetAll(t *testing.T) {
 	}
 }
 
+func Test_Db_Iterator(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dirPath := "tmp"
+	namespace := "test"
+	defer cleanup(dirPath)
+
+	// create a db
+	dbp, _ := NewDbp(dirPath)
+	db := dbp.DB(namespace)
+
+	// put some value
+	db.Put([]byte("test-key-2"), []byte("test-value-2"))
+	db.Put([]byte("test-key-1"), []byte("test-value-1"))
+	db.Put([]byte("other-key-1"), []byte("other-value-1"))
+
+	// iterate over values with prefix, in order of keys
+	it := db.Iterator([]byte("test-"))
+	defer it.Release()
+	keys := []string{}
+	for it.Next() {
+		if string(it.Value()) != "test-value-"+string(it.Key())[len("test-key-"):] {
+			t.Errorf("incorrect value %s for key %s", it.Value(), it.Key())
+		}
+		keys = append(keys, string(it.Key()))
+	}
+	if len(keys) != 2 || keys[0] != "test-key-1" || keys[1] != "test-key-2" {
+		t.Errorf("incorrect keys from iterator: %s", keys)
+	}
+}
+
 func Test_Db_Drop(t *testing.T) {
 	log.SetLogLevel(log.NONE)
 	dirPath := "tmp"
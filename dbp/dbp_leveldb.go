@@ -11,8 +11,44 @@ import (
 
 var logger = log.NewLogger("dbpLevelDb")
 
+// tuning of leveldb databases opened by DB provider, applied to each namespace
+type Options struct {
+	// block cache size in MB
+	CacheSize int
+	// max number of open files
+	Handles int
+	// size of write buffer (memtable) in MB, 0 for a quarter of cache size
+	WriteBuffer int
+	// number of level-0 tables that triggers a compaction, 0 for leveldb's default
+	CompactionL0Trigger int
+	// size of tables written by compaction in MB, 0 for leveldb's default
+	CompactionTableSize int
+	// compact full key range of a namespace when it's closed, trading a slower shutdown for a compact data directory
+	CompactOnClose bool
+}
+
+// default tuning of DB provider
+func DefaultOptions() Options {
+	return Options{
+		CacheSize:      16,
+		Handles:        16,
+		CompactOnClose: true,
+	}
+}
+
+// a DB provider with controls for compaction of its databases
+type Compacter interface {
+	// compact full key range of all open namespaces
+	Compact() error
+}
+
 // provide a of DBP implementtion based upon levelDB
 func NewDbp(dirRoot string) (db.DbProvider, error) {
+	return NewDbpWithOptions(dirRoot, DefaultOptions())
+}
+
+// provide a DBP implementation based upon levelDB, with specified tuning of its databases
+func NewDbpWithOptions(dirRoot string, opts Options) (db.DbProvider, error) {
 	// check for status of the specified directory
 	if fs, err := os.Stat(dirRoot); err == nil {
 		logger.Debug("%s exists: %s", dirRoot, fs.Mode().String())
@@ -36,10 +72,18 @@ func NewDbp(dirRoot string) (db.DbProvider, error) {
 			return nil, err
 		}
 	}
+	// make sure no other instance is using the directory
+	lock, err := lockDir(dirRoot)
+	if err != nil {
+		logger.Error("Cannot lock %s: %s", dirRoot, err)
+		return nil, err
+	}
 	logger.Debug("Created a DB Provider instance at directory root: %s", dirRoot)
 	return &dbpLevelDb{
 		dirRoot: dirRoot,
 		repos:   make(map[string]*dbLevelDB),
+		lock:    lock,
+		opts:    opts,
 	}, nil
 }
 
@@ -64,11 +108,43 @@ type dbpLevelDb struct {
 	dirRoot string
 	// open DB connections
 	repos map[string]*dbLevelDB
+	// exclusive lock of directory root, released when all DBs are closed
+	lock *os.File
+	// tuning of databases
+	opts Options
 }
 
+// close all open namespaces, flushing their pending writes, and release the directory root,
+// returns the first error encountered after attempting to close every namespace
 func (dbp *dbpLevelDb) CloseAll() error {
-	for _, db := range dbp.repos {
-		db.Close()
+	var firstErr error
+	for namespace, db := range dbp.repos {
+		if !db.isOpen {
+			continue
+		}
+		if err := db.Close(); err != nil {
+			logger.Error("Failed to close namespace %s: %s", namespace, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+	if dbp.lock != nil {
+		unlockDir(dbp.lock)
+		dbp.lock = nil
+	}
+	return firstErr
+}
+
+func (dbp *dbpLevelDb) Compact() error {
+	for namespace, db := range dbp.repos {
+		if !db.isOpen {
+			continue
+		}
+		if err := db.compact(); err != nil {
+			logger.Error("Failed to compact namespace %s: %s", namespace, err)
+			return err
+		}
 	}
 	return nil
 }
@@ -89,7 +165,7 @@ func (dbp *dbpLevelDb) DB(namespace string) db.Database {
 		logger.Error("Cannot create %s: %s", dbp.dirRoot+"/"+namespace, err)
 		return nil
 	}
-	if repo, err := newDbLevelDB(namespace, dbp.dirRoot+"/"+namespace, 16, 16); err != nil {
+	if repo, err := newDbLevelDBWithOptions(namespace, dbp.dirRoot+"/"+namespace, dbp.opts); err != nil {
 		logger.Error("Failed to instantiate namespace %s: %s", namespace, err)
 		return nil
 	} else {
@@ -3,7 +3,10 @@
 package dbp
 
 import (
+	"fmt"
 	"github.com/trust-net/dag-lib-go/log"
+	"os"
+	"strings"
 	"testing"
 )
 
@@ -134,3 +137,96 @@ func Test_DB_Namepsaces(t *testing.T) {
 		t.Errorf("got incorrect exists check: %v", exists)
 	}
 }
+
+func Test_NewDbp_DirectoryLocked(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dirPath := "tmp/locked"
+	defer cleanup("tmp")
+	dbp, err := NewDbp(dirPath)
+	if err != nil {
+		t.Errorf("failed to instantiate db provider: %s", err)
+		return
+	}
+	// a second instance over same directory should fail, naming the holder
+	if _, err := NewDbp(dirPath); err == nil {
+		t.Errorf("failed to detect locked directory")
+	} else if !strings.Contains(err.Error(), fmt.Sprintf("pid %d", os.Getpid())) {
+		t.Errorf("error does not name lock holder: %s", err)
+	}
+	// after closing first instance, directory should be available
+	dbp.CloseAll()
+	if dbp2, err := NewDbp(dirPath); err != nil {
+		t.Errorf("failed to instantiate after lock released: %s", err)
+	} else {
+		dbp2.CloseAll()
+	}
+}
+
+func Test_NewDbpWithOptions_Persisted(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dirPath := "tmp/options"
+	defer cleanup("tmp")
+	opts := Options{
+		CacheSize:           32,
+		Handles:             32,
+		WriteBuffer:         1,
+		CompactionL0Trigger: 2,
+		CompactionTableSize: 1,
+	}
+	dbp, err := NewDbpWithOptions(dirPath, opts)
+	if err != nil {
+		t.Errorf("failed to instantiate db provider: %s", err)
+		return
+	}
+	dbp.DB("test-1").Put([]byte("key"), []byte("value-1"))
+	dbp.DB("test-2").Put([]byte("key"), []byte("value-2"))
+	if err := dbp.CloseAll(); err != nil {
+		t.Errorf("failed to close all namespaces: %s", err)
+	}
+	for _, repo := range dbp.(*dbpLevelDb).repos {
+		if repo.isOpen {
+			t.Errorf("namespace not closed: %s", repo.Name())
+		}
+	}
+
+	// values of all namespaces should be available after re-opening directory
+	dbp, err = NewDbpWithOptions(dirPath, opts)
+	if err != nil {
+		t.Errorf("failed to re-open db provider: %s", err)
+		return
+	}
+	defer dbp.CloseAll()
+	if value, _ := dbp.DB("test-1").Get([]byte("key")); string(value) != "value-1" {
+		t.Errorf("got unexpected value: %s", value)
+	}
+	if value, _ := dbp.DB("test-2").Get([]byte("key")); string(value) != "value-2" {
+		t.Errorf("got unexpected value: %s", value)
+	}
+}
+
+func Test_Dbp_Compact(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dirPath := "tmp/compact"
+	defer cleanup("tmp")
+	opts := DefaultOptions()
+	opts.CompactOnClose = false
+	dbp, err := NewDbpWithOptions(dirPath, opts)
+	if err != nil {
+		t.Errorf("failed to instantiate db provider: %s", err)
+		return
+	}
+	defer dbp.CloseAll()
+	db := dbp.DB("test")
+	for i := 0; i < 100; i++ {
+		db.Put([]byte(fmt.Sprintf("key-%d", i)), []byte("value"))
+		db.Delete([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	if compacter, ok := dbp.(Compacter); !ok {
+		t.Errorf("db provider does not support compaction")
+	} else if err := compacter.Compact(); err != nil {
+		t.Errorf("failed to compact: %s", err)
+	}
+	if values := db.GetAll(); len(values) != 0 {
+		t.Errorf("deleted keys present after compaction: %d", len(values))
+	}
+}
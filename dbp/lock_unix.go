@@ -0,0 +1,48 @@
+// Copyright 2019 The trust-net Authors
+//go:build !windows
+// +build !windows
+
+// Exclusive lock of a data directory, so that only one DB provider instance writes to it
+package dbp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// name of lock file in data directory, with PID of the lock holder
+const lockFileName = "dbp.lock"
+
+// acquire exclusive lock of a data directory, fails with holder's PID if directory is locked by
+// another DB provider instance (of this or other process)
+func lockDir(dirRoot string) (*os.File, error) {
+	path := dirRoot + "/" + lockFileName
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		holder := "unknown"
+		if data, err := ioutil.ReadFile(path); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			holder = strings.TrimSpace(string(data))
+		}
+		return nil, fmt.Errorf("data directory %s is in use by another instance (pid %s)", dirRoot, holder)
+	}
+	// record holder's PID for error message of other instances
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	file.Sync()
+	return file, nil
+}
+
+// release lock of a data directory
+func unlockDir(file *os.File) error {
+	file.Truncate(0)
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return file.Close()
+}
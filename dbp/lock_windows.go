@@ -0,0 +1,15 @@
+// Copyright 2019 The trust-net Authors
+// Exclusive lock of a data directory (not enforced on windows)
+package dbp
+
+import (
+	"os"
+)
+
+func lockDir(dirRoot string) (*os.File, error) {
+	return nil, nil
+}
+
+func unlockDir(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The trust-net Authors
+// Persistence of submitter client state through DB provider
+package dbp
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+)
+
+// persisted state of a submitter client
+type submitterState struct {
+	ShardId []byte
+	Seq     uint64
+	LastTx  [64]byte
+}
+
+// store for submitter client state (sequence, last transaction and shard), keyed by submitter ID,
+// so that a restarted client continues from its last submission instead of re-using sequences
+type SubmitterStore struct {
+	db db.Database
+}
+
+func NewSubmitterStore(dbp db.DbProvider) (*SubmitterStore, error) {
+	if dbp == nil {
+		return nil, fmt.Errorf("missing DB provider")
+	}
+	return &SubmitterStore{
+		db: dbp.DB("dlt_submitter_state"),
+	}, nil
+}
+
+// save submitter's current state
+func (s *SubmitterStore) Save(submitter *dto.Submitter) error {
+	if submitter == nil || len(submitter.Id) == 0 {
+		return fmt.Errorf("missing submitter id")
+	}
+	state := submitterState{
+		ShardId: submitter.ShardId,
+		Seq:     submitter.Seq,
+		LastTx:  submitter.LastTx,
+	}
+	if data, err := common.Serialize(state); err != nil {
+		return err
+	} else {
+		return s.db.Put(submitter.Id, data)
+	}
+}
+
+// restore submitter's state saved earlier, returns false when no state was saved for submitter
+func (s *SubmitterStore) Load(submitter *dto.Submitter) (bool, error) {
+	if submitter == nil || len(submitter.Id) == 0 {
+		return false, fmt.Errorf("missing submitter id")
+	}
+	data, err := s.db.Get(submitter.Id)
+	if err != nil || data == nil {
+		return false, nil
+	}
+	state := submitterState{}
+	if err := common.Deserialize(data, &state); err != nil {
+		return false, err
+	}
+	submitter.ShardId, submitter.Seq, submitter.LastTx = state.ShardId, state.Seq, state.LastTx
+	return true, nil
+}
+
+// remove submitter's saved state
+func (s *SubmitterStore) Delete(submitterId []byte) error {
+	return s.db.Delete(submitterId)
+}
@@ -0,0 +1,60 @@
+// Copyright 2019 The trust-net Authors
+// Tests for persistence of submitter client state
+package dbp
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+func Test_SubmitterStore_SaveLoad(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dbp := db.NewInMemDbProvider()
+	store, _ := NewSubmitterStore(dbp)
+	submitter := dto.TestSubmitter()
+	if found, err := store.Load(submitter); found || err != nil {
+		t.Errorf("unexpected state for new submitter: %v, %s", found, err)
+	}
+	submitter.Seq, submitter.LastTx, submitter.ShardId = 5, dto.RandomHash(), []byte("some shard")
+	if err := store.Save(submitter); err != nil {
+		t.Errorf("failed to save submitter: %s", err)
+	}
+	// simulate restart with a new store over same provider
+	restarted := &dto.Submitter{Key: submitter.Key, Id: submitter.Id, Seq: 1}
+	store, _ = NewSubmitterStore(dbp)
+	if found, err := store.Load(restarted); !found || err != nil {
+		t.Errorf("failed to load submitter: %v, %s", found, err)
+	} else if restarted.Seq != 5 || restarted.LastTx != submitter.LastTx || string(restarted.ShardId) != "some shard" {
+		t.Errorf("incorrect submitter state: %v", restarted)
+	}
+	store.Delete(submitter.Id)
+	if found, _ := store.Load(restarted); found {
+		t.Errorf("state should be deleted")
+	}
+}
+
+func Test_SubmitterStore_LevelDb(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	defer cleanup("tmp")
+	submitter := dto.TestSubmitter()
+	submitter.Seq = 3
+	if dbp, err := NewDbp("tmp/submitters"); err != nil {
+		t.Errorf("failed to create dbp: %s", err)
+	} else {
+		store, _ := NewSubmitterStore(dbp)
+		store.Save(submitter)
+		dbp.CloseAll()
+	}
+	if dbp, err := NewDbp("tmp/submitters"); err != nil {
+		t.Errorf("failed to re-open dbp: %s", err)
+	} else {
+		defer dbp.CloseAll()
+		store, _ := NewSubmitterStore(dbp)
+		restarted := &dto.Submitter{Id: submitter.Id, Seq: 1}
+		if found, err := store.Load(restarted); !found || err != nil || restarted.Seq != 3 {
+			t.Errorf("failed to load persisted submitter: %v, %s, %d", found, err, restarted.Seq)
+		}
+	}
+}
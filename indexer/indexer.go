@@ -0,0 +1,216 @@
+// Copyright 2019 The trust-net Authors
+// Indexer maintaining a relational read model of a shard, from the shard's log
+package indexer
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"sync"
+	"time"
+)
+
+// max number of transactions read from shard log and indexed within a single database transaction
+var BatchSize = 100
+
+type Config struct {
+	// SQL dialect of the database (database driver is chosen and opened by application)
+	Dialect Dialect
+	// shard to index
+	ShardId []byte
+	// optional app specific mapping of a transaction to resources it updates (a resource
+	// with nil owner and value is deleted), resources table is not maintained when nil
+	Resources func(tx dto.Transaction) ([]*state.Resource, error)
+}
+
+type Indexer struct {
+	db     *sql.DB
+	dlt    stack.DLT
+	conf   Config
+	lock   sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	logger log.Logger
+}
+
+// read all new transactions from shard log and index them, returns number of transactions indexed
+func (i *Indexer) Sync() (int, error) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+	cursor, err := i.cursor()
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for {
+		txs, next, err := i.dlt.ShardLog(i.conf.ShardId, cursor, BatchSize)
+		if err == shard.ErrLogCursorInvalid {
+			// shard history changed before our position, rebuild index from beginning
+			i.logger.Info("Shard history changed, rebuilding index for shard: %x", i.conf.ShardId)
+			if err := i.reset(); err != nil {
+				return count, err
+			}
+			cursor = nil
+			continue
+		} else if err != nil {
+			return count, err
+		}
+		if len(txs) == 0 {
+			return count, nil
+		}
+		if err := i.index(txs, next); err != nil {
+			return count, err
+		}
+		count += len(txs)
+		cursor = next
+	}
+}
+
+// index a batch of transactions and save the cursor atomically
+func (i *Indexer) index(txs []dto.Transaction, next *shard.LogCursor) error {
+	dbTx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	pos := next.Count - uint64(len(txs))
+	for _, tx := range txs {
+		pos += 1
+		if err := i.indexTx(dbTx, tx, pos); err != nil {
+			dbTx.Rollback()
+			return err
+		}
+	}
+	if _, err := dbTx.Exec(i.conf.Dialect.rebind(`INSERT INTO index_cursor (shard_id, depth, tx_id, tx_count) VALUES (?, ?, ?, ?)
+		ON CONFLICT (shard_id) DO UPDATE SET depth = excluded.depth, tx_id = excluded.tx_id, tx_count = excluded.tx_count`),
+		hex.EncodeToString(i.conf.ShardId), next.Depth, hex.EncodeToString(next.TxId[:]), next.Count); err != nil {
+		dbTx.Rollback()
+		return err
+	}
+	return dbTx.Commit()
+}
+
+func (i *Indexer) indexTx(dbTx *sql.Tx, tx dto.Transaction, pos uint64) error {
+	txId, shardId := tx.Id(), hex.EncodeToString(i.conf.ShardId)
+	req, a := tx.Request(), tx.Anchor()
+	if _, err := dbTx.Exec(i.conf.Dialect.rebind(`INSERT INTO transactions
+		(tx_id, shard_id, shard_seq, log_pos, submitter_id, submitter_seq, node_id, payload, trace_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+		hex.EncodeToString(txId[:]), shardId, a.ShardSeq, pos, hex.EncodeToString(req.SubmitterId), req.SubmitterSeq,
+		hex.EncodeToString(a.NodeId), base64.StdEncoding.EncodeToString(req.Payload), tx.TraceId()); err != nil {
+		return fmt.Errorf("failed to index transaction: %s", err)
+	}
+	if _, err := dbTx.Exec(i.conf.Dialect.rebind(`INSERT INTO submitters (shard_id, submitter_id, last_seq, last_tx, tx_count)
+		VALUES (?, ?, ?, ?, 1)
+		ON CONFLICT (shard_id, submitter_id) DO UPDATE SET tx_count = submitters.tx_count + 1,
+		last_seq = CASE WHEN excluded.last_seq >= submitters.last_seq THEN excluded.last_seq ELSE submitters.last_seq END,
+		last_tx = CASE WHEN excluded.last_seq >= submitters.last_seq THEN excluded.last_tx ELSE submitters.last_tx END`),
+		shardId, hex.EncodeToString(req.SubmitterId), req.SubmitterSeq, hex.EncodeToString(txId[:])); err != nil {
+		return fmt.Errorf("failed to index submitter: %s", err)
+	}
+	if i.conf.Resources == nil {
+		return nil
+	}
+	resources, err := i.conf.Resources(tx)
+	if err != nil {
+		return fmt.Errorf("failed to map resources: %s", err)
+	}
+	for _, r := range resources {
+		if r.Owner == nil && r.Value == nil {
+			_, err = dbTx.Exec(i.conf.Dialect.rebind(`DELETE FROM resources WHERE shard_id = ? AND res_key = ?`),
+				shardId, hex.EncodeToString(r.Key))
+		} else {
+			_, err = dbTx.Exec(i.conf.Dialect.rebind(`INSERT INTO resources (shard_id, res_key, owner, value, tx_id) VALUES (?, ?, ?, ?, ?)
+				ON CONFLICT (shard_id, res_key) DO UPDATE SET owner = excluded.owner, value = excluded.value, tx_id = excluded.tx_id`),
+				shardId, hex.EncodeToString(r.Key), hex.EncodeToString(r.Owner), base64.StdEncoding.EncodeToString(r.Value), hex.EncodeToString(txId[:]))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to index resource: %s", err)
+		}
+	}
+	return nil
+}
+
+// fetch saved log cursor for the shard, nil if shard has not been indexed yet
+func (i *Indexer) cursor() (*shard.LogCursor, error) {
+	var txId string
+	cursor := &shard.LogCursor{}
+	if err := i.db.QueryRow(i.conf.Dialect.rebind(`SELECT depth, tx_id, tx_count FROM index_cursor WHERE shard_id = ?`),
+		hex.EncodeToString(i.conf.ShardId)).Scan(&cursor.Depth, &txId, &cursor.Count); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if bytes, _ := hex.DecodeString(txId); len(bytes) != 64 {
+		return nil, fmt.Errorf("corrupt index cursor")
+	} else {
+		copy(cursor.TxId[:], bytes)
+	}
+	return cursor, nil
+}
+
+// remove all indexed data for the shard
+func (i *Indexer) reset() error {
+	dbTx, err := i.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"transactions", "resources", "submitters", "index_cursor"} {
+		if _, err := dbTx.Exec(i.conf.Dialect.rebind(`DELETE FROM `+table+` WHERE shard_id = ?`), hex.EncodeToString(i.conf.ShardId)); err != nil {
+			dbTx.Rollback()
+			return err
+		}
+	}
+	return dbTx.Commit()
+}
+
+// start indexing shard periodically in background
+func (i *Indexer) Start(interval time.Duration) {
+	i.stop, i.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(i.done)
+		for {
+			if _, err := i.Sync(); err != nil {
+				i.logger.Error("Failed to index shard: %s", err)
+			}
+			select {
+			case <-i.stop:
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// stop background indexing
+func (i *Indexer) Stop() {
+	if i.stop != nil {
+		close(i.stop)
+		<-i.done
+		i.stop = nil
+	}
+}
+
+// create an indexer for a shard using application provided database, applying any pending schema migrations
+func NewIndexer(db *sql.DB, dlt stack.DLT, conf Config) (*Indexer, error) {
+	if db == nil || dlt == nil {
+		return nil, fmt.Errorf("missing database or DLT stack")
+	}
+	if len(conf.ShardId) == 0 {
+		return nil, fmt.Errorf("missing shard id")
+	}
+	if err := migrate(db, conf.Dialect); err != nil {
+		return nil, err
+	}
+	return &Indexer{
+		db:     db,
+		dlt:    dlt,
+		conf:   conf,
+		logger: log.NewLogger("Indexer"),
+	}, nil
+}
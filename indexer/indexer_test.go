@@ -0,0 +1,22 @@
+// Copyright 2019 The trust-net Authors
+package indexer
+
+import (
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	query := `INSERT INTO t (a, b) VALUES (?, ?)`
+	if q := SQLITE.rebind(query); q != query {
+		t.Errorf("sqlite query should not be rewritten: %s", q)
+	}
+	if q := POSTGRES.rebind(query); q != `INSERT INTO t (a, b) VALUES ($1, $2)` {
+		t.Errorf("incorrect postgres query: %s", q)
+	}
+}
+
+func TestNewIndexer_Validation(t *testing.T) {
+	if _, err := NewIndexer(nil, nil, Config{ShardId: []byte("test shard")}); err == nil {
+		t.Errorf("indexer should not be created without database")
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2019 The trust-net Authors
+// Relational schema and migrations for shard indexer
+package indexer
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// SQL dialect of the indexer's database
+type Dialect int
+
+const (
+	SQLITE Dialect = iota
+	POSTGRES
+)
+
+// schema migrations, applied in order and tracked in schema_version table,
+// new schema changes must be appended (never modify an existing migration)
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS transactions (
+		tx_id         TEXT PRIMARY KEY,
+		shard_id      TEXT NOT NULL,
+		shard_seq     BIGINT NOT NULL,
+		log_pos       BIGINT NOT NULL,
+		submitter_id  TEXT NOT NULL,
+		submitter_seq BIGINT NOT NULL,
+		node_id       TEXT NOT NULL,
+		payload       TEXT NOT NULL,
+		trace_id      TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS transactions_submitter ON transactions (submitter_id, submitter_seq)`,
+	`CREATE INDEX IF NOT EXISTS transactions_log ON transactions (shard_id, log_pos)`,
+	`CREATE TABLE IF NOT EXISTS resources (
+		shard_id TEXT NOT NULL,
+		res_key  TEXT NOT NULL,
+		owner    TEXT,
+		value    TEXT,
+		tx_id    TEXT NOT NULL,
+		PRIMARY KEY (shard_id, res_key)
+	)`,
+	`CREATE INDEX IF NOT EXISTS resources_owner ON resources (owner)`,
+	`CREATE TABLE IF NOT EXISTS submitters (
+		shard_id     TEXT NOT NULL,
+		submitter_id TEXT NOT NULL,
+		last_seq     BIGINT NOT NULL,
+		last_tx      TEXT NOT NULL,
+		tx_count     BIGINT NOT NULL,
+		PRIMARY KEY (shard_id, submitter_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS index_cursor (
+		shard_id TEXT PRIMARY KEY,
+		depth    BIGINT NOT NULL,
+		tx_id    TEXT NOT NULL,
+		tx_count BIGINT NOT NULL
+	)`,
+}
+
+// rewrite "?" placeholders of a statement for the dialect
+func (d Dialect) rebind(query string) string {
+	if d != POSTGRES {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n += 1
+			fmt.Fprintf(&b, "$%d", n)
+		} else {
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// current schema version of the database
+func schemaVersion(db *sql.DB) (int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER NOT NULL)`); err != nil {
+		return 0, err
+	}
+	version := 0
+	if err := db.QueryRow(`SELECT version FROM schema_version`).Scan(&version); err != nil && err != sql.ErrNoRows {
+		return 0, err
+	} else if err == sql.ErrNoRows {
+		if _, err := db.Exec(`INSERT INTO schema_version (version) VALUES (0)`); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// apply all pending migrations, each within its own database transaction
+func migrate(db *sql.DB, d Dialect) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %s", err)
+	}
+	for ; version < len(migrations); version++ {
+		if tx, err := db.Begin(); err != nil {
+			return err
+		} else if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %s", version+1, err)
+		} else if _, err := tx.Exec(d.rebind(`UPDATE schema_version SET version = ?`), version+1); err != nil {
+			tx.Rollback()
+			return err
+		} else if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
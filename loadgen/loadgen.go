@@ -0,0 +1,180 @@
+// Copyright 2019 The trust-net Authors
+// Load generation against DLT stacks or client APIs, with configurable workload mix and rate
+package loadgen
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// default number of consecutive failures after which a submitter gives up
+var MaxConsecutiveFailures = 100
+
+// an operation of workload's mix
+type Op struct {
+	// name of the operation, for report's breakdown
+	Name string
+	// relative share of the operation in workload's mix
+	Weight int
+	// payload for a submitter's n'th successful transaction (n starts at 1, and is
+	// repeated upon failure), submitter is the index of submitter in config
+	Payload func(submitter int, n uint64) []byte
+}
+
+type Config struct {
+	// submitters, each submitting its transactions sequentially (use NewSubmitters to create
+	// new submitters), submitters' sequence and last transaction are updated as per run
+	Submitters []*dto.Submitter
+	// targets to submit transactions, submitter i submits to target i % len(Targets)
+	Targets []Target
+	// optional payloads submitted by each submitter before load starts, not included in report
+	Setup func(submitter int) [][]byte
+	// mix of operations of the workload
+	Mix []Op
+	// target rate of submissions per second across all submitters, 0 for unthrottled
+	TPS float64
+	// run until duration elapses and/or count of successful transactions across all
+	// submitters is reached (at least one must be specified)
+	Duration time.Duration
+	Count    int
+	// consecutive failures after which a submitter gives up (default MaxConsecutiveFailures)
+	MaxFailures int
+}
+
+// create new submitters for a shard
+func NewSubmitters(count int, shardId []byte) []*dto.Submitter {
+	submitters := make([]*dto.Submitter, count)
+	for i := range submitters {
+		submitters[i] = dto.TestSubmitter()
+		submitters[i].ShardId = shardId
+	}
+	return submitters
+}
+
+func (c *Config) validate() error {
+	if len(c.Submitters) == 0 || len(c.Targets) == 0 {
+		return fmt.Errorf("missing submitters or targets")
+	}
+	if len(c.Mix) == 0 {
+		return fmt.Errorf("missing workload mix")
+	}
+	for _, op := range c.Mix {
+		if op.Weight <= 0 || op.Payload == nil {
+			return fmt.Errorf("invalid op in workload mix: %s", op.Name)
+		}
+	}
+	if c.Duration <= 0 && c.Count <= 0 {
+		return fmt.Errorf("missing duration or count")
+	}
+	return nil
+}
+
+// pick an operation from mix as per weights
+func (c *Config) pick(rnd *rand.Rand) *Op {
+	total := 0
+	for _, op := range c.Mix {
+		total += op.Weight
+	}
+	n := rnd.Intn(total)
+	for i := range c.Mix {
+		if n -= c.Mix[i].Weight; n < 0 {
+			return &c.Mix[i]
+		}
+	}
+	return &c.Mix[len(c.Mix)-1]
+}
+
+// submit a payload for submitter, advancing submitter upon success
+func submit(target Target, s *dto.Submitter, payload []byte) error {
+	txId, err := target.Submit(s.NewRequest(string(payload)))
+	if err == nil {
+		s.LastTx = txId
+		s.Seq += 1
+	}
+	return err
+}
+
+// run the workload and report results
+func Run(conf Config) (*Report, error) {
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
+	if conf.MaxFailures <= 0 {
+		conf.MaxFailures = MaxConsecutiveFailures
+	}
+	// run setup for all submitters
+	for i, s := range conf.Submitters {
+		if conf.Setup == nil {
+			break
+		}
+		for _, payload := range conf.Setup(i) {
+			if err := submit(conf.Targets[i%len(conf.Targets)], s, payload); err != nil {
+				return nil, fmt.Errorf("setup failed for submitter %d: %s", i, err)
+			}
+		}
+	}
+	// rate limiter shared by all submitters
+	stop := make(chan struct{})
+	var tokens <-chan time.Time
+	if conf.TPS > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / conf.TPS))
+		defer ticker.Stop()
+		tokens = ticker.C
+	}
+	if conf.Duration > 0 {
+		timer := time.AfterFunc(conf.Duration, func() { close(stop) })
+		defer timer.Stop()
+	}
+	rec := newRecorder()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i, s := range conf.Submitters {
+		// share of count for this submitter
+		count := 0
+		if conf.Count > 0 {
+			if count = conf.Count / len(conf.Submitters); i < conf.Count%len(conf.Submitters) {
+				count += 1
+			}
+			if count == 0 {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(i int, s *dto.Submitter, count int) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))
+			target := conf.Targets[i%len(conf.Targets)]
+			failures := 0
+			for n := uint64(1); count == 0 || n <= uint64(count); {
+				if tokens != nil {
+					select {
+					case <-stop:
+						return
+					case <-tokens:
+					}
+				} else {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+				op := conf.pick(rnd)
+				begin := time.Now()
+				err := submit(target, s, op.Payload(i, n))
+				rec.record(op.Name, time.Since(begin), err)
+				if err == nil {
+					n += 1
+					failures = 0
+				} else if failures += 1; failures >= conf.MaxFailures {
+					return
+				}
+			}
+		}(i, s, count)
+	}
+	wg.Wait()
+	return rec.finish(time.Since(start)), nil
+}
@@ -0,0 +1,170 @@
+// Copyright 2019 The trust-net Authors
+package loadgen
+
+import (
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// target that accepts requests in submitter's sequence, and rejects every failEvery'th request
+type mockTarget struct {
+	failEvery int
+	calls     int
+	payloads  []string
+	lock      sync.Mutex
+}
+
+func (t *mockTarget) Submit(req *dto.TxRequest) ([64]byte, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.calls += 1
+	if t.failEvery > 0 && t.calls%t.failEvery == 0 {
+		return [64]byte{}, fmt.Errorf("rejected: request %d", t.calls)
+	}
+	t.payloads = append(t.payloads, string(req.Payload))
+	return sha512.Sum512(req.Signature), nil
+}
+
+func testMix() []Op {
+	return []Op{
+		{Name: "create", Weight: 1, Payload: func(s int, n uint64) []byte { return []byte(fmt.Sprintf("create-%d-%d", s, n)) }},
+		{Name: "xfer", Weight: 3, Payload: func(s int, n uint64) []byte { return []byte(fmt.Sprintf("xfer-%d-%d", s, n)) }},
+	}
+}
+
+// test that count based run submits requested number of transactions across submitters
+func TestRun_Count(t *testing.T) {
+	target := &mockTarget{}
+	submitters := NewSubmitters(3, []byte("test shard"))
+	report, err := Run(Config{
+		Submitters: submitters,
+		Targets:    []Target{target},
+		Setup:      func(s int) [][]byte { return [][]byte{[]byte(fmt.Sprintf("setup-%d", s))} },
+		Mix:        testMix(),
+		Count:      10,
+	})
+	if err != nil {
+		t.Errorf("run failed: %s", err)
+	} else if report.Submitted != 10 || report.Succeeded != 10 || report.Failed != 0 {
+		t.Errorf("incorrect report: %s", report)
+	}
+	total := 0
+	for _, op := range report.Ops {
+		total += op.Submitted
+	}
+	if total != 10 {
+		t.Errorf("incorrect op breakdown: %s", report)
+	}
+	// setup payloads plus transactions
+	if len(target.payloads) != 13 {
+		t.Errorf("incorrect number of submissions: %d", len(target.payloads))
+	}
+	// submitters should be advanced as per their transactions (4 + 3 + 3 plus setup)
+	if submitters[0].Seq != 6 || submitters[1].Seq != 5 || submitters[2].Seq != 5 {
+		t.Errorf("incorrect submitter sequences: %d, %d, %d", submitters[0].Seq, submitters[1].Seq, submitters[2].Seq)
+	}
+}
+
+// test that failures are reported by kind, and failed payload is retried
+func TestRun_Errors(t *testing.T) {
+	target := &mockTarget{failEvery: 2}
+	report, err := Run(Config{
+		Submitters: NewSubmitters(1, []byte("test shard")),
+		Targets:    []Target{target},
+		Mix:        testMix()[:1],
+		Count:      5,
+	})
+	if err != nil {
+		t.Errorf("run failed: %s", err)
+	} else if report.Succeeded != 5 || report.Failed != 4 || report.Errors["rejected"] != 4 {
+		t.Errorf("incorrect report: %s", report)
+	}
+	if strings.Join(target.payloads, ",") != "create-0-1,create-0-2,create-0-3,create-0-4,create-0-5" {
+		t.Errorf("incorrect payloads: %v", target.payloads)
+	}
+}
+
+// test that submitter gives up after consecutive failures
+func TestRun_MaxFailures(t *testing.T) {
+	report, _ := Run(Config{
+		Submitters:  NewSubmitters(1, []byte("test shard")),
+		Targets:     []Target{&mockTarget{failEvery: 1}},
+		Mix:         testMix(),
+		Count:       5,
+		MaxFailures: 3,
+	})
+	if report.Failed != 3 || report.Succeeded != 0 {
+		t.Errorf("incorrect report: %s", report)
+	}
+}
+
+// test that duration based run is throttled to target rate
+func TestRun_DurationTPS(t *testing.T) {
+	report, err := Run(Config{
+		Submitters: NewSubmitters(2, []byte("test shard")),
+		Targets:    []Target{&mockTarget{}},
+		Mix:        testMix(),
+		TPS:        50,
+		Duration:   200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Errorf("run failed: %s", err)
+	} else if report.Succeeded < 5 || report.Succeeded > 12 {
+		t.Errorf("run not throttled to target rate: %s", report)
+	} else if report.Latency.Max < report.Latency.P50 {
+		t.Errorf("incorrect latencies: %s", report)
+	}
+}
+
+// test that invalid configuration is rejected
+func TestRun_InvalidConfig(t *testing.T) {
+	if _, err := Run(Config{Targets: []Target{&mockTarget{}}, Mix: testMix(), Count: 1}); err == nil {
+		t.Errorf("missing submitters should fail")
+	}
+	if _, err := Run(Config{Submitters: NewSubmitters(1, nil), Targets: []Target{&mockTarget{}}, Mix: testMix()}); err == nil {
+		t.Errorf("missing duration and count should fail")
+	}
+}
+
+// test submission through client API target
+func TestApiTarget(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if req, err := api.ParseSubmitRequest(r); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(err.Error())
+		} else if string(req.DltRequest().Payload) == "bad" {
+			w.WriteHeader(http.StatusNotAcceptable)
+			json.NewEncoder(w).Encode("rejected")
+		} else if string(req.DltRequest().Payload) == "double" {
+			api.WriteSubmitError(w, dto.NewTxError(dto.ErrDoubleSpend, "double spend"))
+		} else {
+			txId := sha512.Sum512(req.DltRequest().Signature)
+			json.NewEncoder(w).Encode(&api.SubmitResponse{TxId: hex.EncodeToString(txId[:])})
+		}
+	}))
+	defer server.Close()
+	target := ApiTarget(server.URL+"/", nil)
+	s := NewSubmitters(1, []byte("test shard"))[0]
+	req := s.NewRequest("good")
+	if txId, err := target.Submit(req); err != nil {
+		t.Errorf("submission failed: %s", err)
+	} else if txId != sha512.Sum512(req.Signature) {
+		t.Errorf("incorrect transaction id")
+	}
+	if _, err := target.Submit(s.NewRequest("bad")); err == nil || !strings.Contains(err.Error(), "406") {
+		t.Errorf("rejection not reported: %v", err)
+	}
+	if _, err := target.Submit(s.NewRequest("double")); dto.ErrorCodeOf(err) != dto.ErrDoubleSpend {
+		t.Errorf("rejection code not reported: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 The trust-net Authors
+// Report of a load generation run
+package loadgen
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// submission latency percentiles
+type Latency struct {
+	P50 time.Duration
+	P90 time.Duration
+	P99 time.Duration
+	Max time.Duration
+}
+
+// counts for an operation of workload's mix
+type OpReport struct {
+	Submitted int
+	Failed    int
+}
+
+type Report struct {
+	Submitted int
+	Succeeded int
+	Failed    int
+	Duration  time.Duration
+	// achieved rate of successful transactions per second
+	TPS     float64
+	Latency Latency
+	// number of failures by kind of error
+	Errors map[string]int
+	// counts by operation name
+	Ops map[string]*OpReport
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Submitted: %d, Succeeded: %d, Failed: %d in %s (%.1f TPS)\n",
+		r.Submitted, r.Succeeded, r.Failed, r.Duration.Round(time.Millisecond), r.TPS)
+	fmt.Fprintf(&b, "Latency: p50 %s, p90 %s, p99 %s, max %s\n", r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.Max)
+	names := make([]string, 0, len(r.Ops))
+	for name, _ := range r.Ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "Op %s: submitted %d, failed %d\n", name, r.Ops[name].Submitted, r.Ops[name].Failed)
+	}
+	kinds := make([]string, 0, len(r.Errors))
+	for kind, _ := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		fmt.Fprintf(&b, "Error %q: %d\n", kind, r.Errors[kind])
+	}
+	return b.String()
+}
+
+// collector of submission results from concurrent submitters
+type recorder struct {
+	report    *Report
+	latencies []time.Duration
+	lock      sync.Mutex
+}
+
+func newRecorder() *recorder {
+	return &recorder{
+		report: &Report{
+			Errors: make(map[string]int),
+			Ops:    make(map[string]*OpReport),
+		},
+	}
+}
+
+func (r *recorder) record(op string, latency time.Duration, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.Submitted += 1
+	if r.report.Ops[op] == nil {
+		r.report.Ops[op] = &OpReport{}
+	}
+	r.report.Ops[op].Submitted += 1
+	if err != nil {
+		r.report.Failed += 1
+		r.report.Ops[op].Failed += 1
+		r.report.Errors[errorKind(err)] += 1
+		return
+	}
+	r.report.Succeeded += 1
+	r.latencies = append(r.latencies, latency)
+}
+
+// finish the report for a run of specified duration
+func (r *recorder) finish(duration time.Duration) *Report {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.report.Duration = duration
+	if duration > 0 {
+		r.report.TPS = float64(r.report.Succeeded) / duration.Seconds()
+	}
+	if len(r.latencies) > 0 {
+		sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+		r.report.Latency = Latency{
+			P50: percentile(r.latencies, 50),
+			P90: percentile(r.latencies, 90),
+			P99: percentile(r.latencies, 99),
+			Max: r.latencies[len(r.latencies)-1],
+		}
+	}
+	return r.report
+}
+
+// percentile of sorted latencies, using nearest rank
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// kind of an error for breakdown, i.e. error message without its transaction specific details
+func errorKind(err error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, ":"); i > 0 {
+		return msg[:i]
+	}
+	return msg
+}
@@ -0,0 +1,94 @@
+// Copyright 2019 The trust-net Authors
+// Targets for load generation, a DLT stack or a node's client API
+package loadgen
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"net/http"
+	"strings"
+)
+
+// a target accepting transaction submissions
+type Target interface {
+	Submit(req *dto.TxRequest) ([64]byte, error)
+}
+
+type stackTarget struct {
+	dlt stack.DLT
+}
+
+func (t *stackTarget) Submit(req *dto.TxRequest) ([64]byte, error) {
+	if tx, err := t.dlt.Submit(req); err != nil {
+		return [64]byte{}, err
+	} else {
+		return tx.Id(), nil
+	}
+}
+
+// target submitting transactions directly to a DLT stack
+func StackTarget(dlt stack.DLT) Target {
+	return &stackTarget{dlt: dlt}
+}
+
+type apiTarget struct {
+	url    string
+	client *http.Client
+}
+
+func (t *apiTarget) Submit(req *dto.TxRequest) ([64]byte, error) {
+	txId := [64]byte{}
+	body, _ := json.Marshal(&api.SubmitRequest{
+		Payload:      base64.StdEncoding.EncodeToString(req.Payload),
+		ShardId:      hex.EncodeToString(req.ShardId),
+		LastTx:       hex.EncodeToString(req.LastTx[:]),
+		SubmitterId:  hex.EncodeToString(req.SubmitterId),
+		SubmitterSeq: req.SubmitterSeq,
+		Padding:      req.Padding,
+		Signature:    base64.StdEncoding.EncodeToString(req.Signature),
+	})
+	res, err := t.client.Post(t.url+"/transactions", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return txId, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var msg json.RawMessage
+		json.NewDecoder(res.Body).Decode(&msg)
+		// report rejection reason's code, when node responded with one
+		if rejected := (&api.ErrorResponse{}); json.Unmarshal(msg, rejected) == nil && len(rejected.Code) > 0 {
+			return txId, dto.NewTxError(rejected.Code, "%s: %s", res.Status, rejected.Error)
+		}
+		var text interface{}
+		json.Unmarshal(msg, &text)
+		return txId, fmt.Errorf("%s: %v", res.Status, text)
+	}
+	submitted := &api.SubmitResponse{}
+	if err := json.NewDecoder(res.Body).Decode(submitted); err != nil {
+		return txId, err
+	}
+	if id, err := hex.DecodeString(submitted.TxId); err != nil || len(id) != 64 {
+		return txId, fmt.Errorf("invalid transaction id in response: %s", submitted.TxId)
+	} else {
+		copy(txId[:], id)
+	}
+	return txId, nil
+}
+
+// target submitting transactions to a node's client API at base URL (e.g. "http://localhost:8080"),
+// using default HTTP client when client is nil
+func ApiTarget(url string, client *http.Client) Target {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &apiTarget{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2019 The trust-net Authors
+// Orchestration of multi-node networks of DLT stacks, for end-to-end tests and demos
+package nodes
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/dbp"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// time to wait for a subprocess node to exit upon interrupt, before it is killed
+var ShutdownTimeout = 5 * time.Second
+
+type Config struct {
+	// number of nodes in the network
+	Count int
+	// prefix for node names (default "node"), nodes are named <prefix>-<index>
+	Name string
+	// working directory for keys, configs and storage of nodes (default a new temporary
+	// directory, which is removed upon teardown)
+	Dir string
+	// persist in-process nodes' databases under node's directory, instead of in-memory storage
+	Persistent bool
+	// template for p2p config of nodes, key, name, port and bootnodes are populated for each
+	// node (default max peers is number of nodes)
+	Template p2p.Config
+	// optional additional stack options for an in-process node
+	Options func(index int) []stack.Option
+	// connect in-process nodes over in-memory connections instead of DEVp2p, so that network can be
+	// partitioned and healed
+	InMemory bool
+	// command and arguments to launch nodes as subprocesses, "${config}" in arguments is replaced
+	// with path of node's config file and "${index}" with node's index (nodes are launched
+	// in-process when empty), subprocesses run in node's directory with output in "output.log"
+	Command []string
+}
+
+// a node of the network
+type Node struct {
+	Index int
+	Name  string
+	// node's directory, with its key, config and storage
+	Dir    string
+	Config p2p.Config
+	// path of node's config file
+	ConfigFile string
+	// node's enode URL, used as bootnode by other nodes
+	Enode string
+	// stack of an in-process node
+	DLT stack.DLT
+	// process of a subprocess node
+	Cmd *exec.Cmd
+	// closed when subprocess exits
+	exited chan struct{}
+}
+
+type Cluster struct {
+	Nodes []*Node
+	Dir   string
+	// in-memory network of nodes, nil unless launched in memory
+	fabric *fabric
+	// remove working directory upon teardown
+	cleanup bool
+}
+
+// reserve a free local port, for both TCP (p2p) and UDP (discovery)
+func freePort() (int, error) {
+	for attempts := 0; attempts < 10; attempts++ {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return 0, err
+		}
+		port := l.Addr().(*net.TCPAddr).Port
+		l.Close()
+		if u, err := net.ListenPacket("udp", "127.0.0.1:"+strconv.Itoa(port)); err == nil {
+			u.Close()
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port")
+}
+
+// generate a new node key, persisted in the format expected by p2p config
+func newKey(file string) (string, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(p2p.ECDSAKey{
+		Curve: "S256",
+		X:     key.X.Bytes(),
+		Y:     key.Y.Bytes(),
+		D:     key.D.Bytes(),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(file, data, 0600); err != nil {
+		return "", err
+	}
+	return discover.PubkeyID(&key.PublicKey).String(), nil
+}
+
+// generate a node's key, port and config
+func (c *Cluster) newNode(conf *Config, index int) (*Node, error) {
+	n := &Node{
+		Index: index,
+		Name:  fmt.Sprintf("%s-%d", conf.Name, index),
+	}
+	n.Dir = filepath.Join(c.Dir, n.Name)
+	if err := os.MkdirAll(n.Dir, 0700); err != nil {
+		return nil, err
+	}
+	n.Config = conf.Template
+	n.Config.Name = n.Name
+	n.Config.KeyFile = filepath.Join(n.Dir, "key.json")
+	n.Config.KeyType = "ECDSA_S256"
+	if n.Config.MaxPeers == 0 {
+		n.Config.MaxPeers = conf.Count
+	}
+	if len(n.Config.ProtocolName) == 0 {
+		n.Config.ProtocolName = stack.ProtocolName
+	}
+	id, err := newKey(n.Config.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create key for %s: %s", n.Name, err)
+	}
+	port, err := freePort()
+	if err != nil {
+		return nil, err
+	}
+	n.Config.Port = strconv.Itoa(port)
+	n.Enode = fmt.Sprintf("enode://%s@127.0.0.1:%d", id, port)
+	return n, nil
+}
+
+// write node's config file, with other nodes as its bootnodes
+func (c *Cluster) configure(n *Node) error {
+	n.Config.Bootnodes = []string{}
+	for _, other := range c.Nodes {
+		if other != n {
+			n.Config.Bootnodes = append(n.Config.Bootnodes, other.Enode)
+		}
+	}
+	n.ConfigFile = filepath.Join(n.Dir, "config.json")
+	if data, err := json.MarshalIndent(n.Config, "", "\t"); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(n.ConfigFile, data, 0600)
+	}
+}
+
+// start node in-process, or as subprocess
+func (c *Cluster) start(conf *Config, n *Node) error {
+	if len(conf.Command) > 0 {
+		args := make([]string, len(conf.Command)-1)
+		for i, arg := range conf.Command[1:] {
+			arg = strings.Replace(arg, "${config}", n.ConfigFile, -1)
+			args[i] = strings.Replace(arg, "${index}", strconv.Itoa(n.Index), -1)
+		}
+		output, err := os.Create(filepath.Join(n.Dir, "output.log"))
+		if err != nil {
+			return err
+		}
+		n.Cmd = exec.Command(conf.Command[0], args...)
+		n.Cmd.Dir, n.Cmd.Stdout, n.Cmd.Stderr = n.Dir, output, output
+		if err := n.Cmd.Start(); err != nil {
+			output.Close()
+			n.Cmd = nil
+			return err
+		}
+		n.exited = make(chan struct{})
+		go func(cmd *exec.Cmd, exited chan struct{}) {
+			cmd.Wait()
+			output.Close()
+			close(exited)
+		}(n.Cmd, n.exited)
+		return nil
+	}
+	var provider db.DbProvider = db.NewInMemDbProvider()
+	if conf.Persistent {
+		var err error
+		if provider, err = dbp.NewDbp(filepath.Join(n.Dir, "db")); err != nil {
+			return err
+		}
+	}
+	opts := []stack.Option{stack.WithConfig(n.Config), stack.WithStorage(provider)}
+	if c.fabric != nil {
+		opts = append(opts, stack.WithP2P(c.fabric.factory(n.Index)))
+	}
+	if conf.Options != nil {
+		opts = append(opts, conf.Options(n.Index)...)
+	}
+	dlt, err := stack.NewDltStack(opts...)
+	if err != nil {
+		return err
+	}
+	if err := dlt.Start(); err != nil {
+		return err
+	}
+	n.DLT = dlt
+	return nil
+}
+
+// launch a network of nodes with generated keys, ports and bootnode wiring, every node
+// uses all other nodes as its bootnodes
+func Launch(conf Config) (*Cluster, error) {
+	if conf.Count < 1 {
+		return nil, fmt.Errorf("invalid number of nodes: %d", conf.Count)
+	}
+	if len(conf.Name) == 0 {
+		conf.Name = "node"
+	}
+	c := &Cluster{Dir: conf.Dir}
+	if conf.InMemory {
+		if len(conf.Command) > 0 {
+			return nil, fmt.Errorf("subprocess nodes cannot be connected in memory")
+		}
+		c.fabric = newFabric()
+	}
+	if len(c.Dir) == 0 {
+		var err error
+		if c.Dir, err = ioutil.TempDir("", "dag-nodes-"); err != nil {
+			return nil, err
+		}
+		c.cleanup = true
+	}
+	for i := 0; i < conf.Count; i++ {
+		if n, err := c.newNode(&conf, i); err != nil {
+			c.Teardown()
+			return nil, err
+		} else {
+			c.Nodes = append(c.Nodes, n)
+		}
+	}
+	for _, n := range c.Nodes {
+		if err := c.configure(n); err != nil {
+			c.Teardown()
+			return nil, err
+		}
+		if err := c.start(&conf, n); err != nil {
+			c.Teardown()
+			return nil, fmt.Errorf("failed to start %s: %s", n.Name, err)
+		}
+	}
+	return c, nil
+}
+
+// stacks of in-process nodes
+func (c *Cluster) DLTs() []stack.DLT {
+	dlts := []stack.DLT{}
+	for _, n := range c.Nodes {
+		if n.DLT != nil {
+			dlts = append(dlts, n.DLT)
+		}
+	}
+	return dlts
+}
+
+// wait until every in-process node has completed handshake with at least specified number of peers
+func (c *Cluster) WaitForPeers(peers int, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for _, n := range c.Nodes {
+		if n.DLT == nil {
+			continue
+		}
+		for len(n.DLT.NodeInfo().PeerVersions) < peers {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("%s connected to %d peers, expected %d", n.Name, len(n.DLT.NodeInfo().PeerVersions), peers)
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+	return nil
+}
+
+// split network of in-memory nodes into groups of node indexes, nodes of different groups are disconnected
+// and cannot connect until network is healed, nodes not in any group are isolated
+func (c *Cluster) Partition(groups ...[]int) error {
+	if c.fabric == nil {
+		return fmt.Errorf("network is not in memory")
+	}
+	c.fabric.partition(groups)
+	return nil
+}
+
+// re-connect all nodes of a partitioned in-memory network
+func (c *Cluster) Heal() error {
+	if c.fabric == nil {
+		return fmt.Errorf("network is not in memory")
+	}
+	c.fabric.heal()
+	return nil
+}
+
+// a node's view of a shard, compared across nodes to check their convergence
+type ShardView struct {
+	// shard's transactions in canonical order
+	Txs [][64]byte
+	// transactions without children in shard's DAG
+	Tips [][64]byte
+	// root of shard's world state
+	StateRoot [64]byte
+}
+
+// get a stack's view of a shard
+func View(dlt stack.DLT, shardId []byte) (*ShardView, error) {
+	txs, _, err := dlt.ShardLog(shardId, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	view := &ShardView{}
+	for _, tx := range txs {
+		id := tx.Id()
+		view.Txs = append(view.Txs, id)
+		if len(dlt.ChildrenOf(id)) == 0 {
+			view.Tips = append(view.Tips, id)
+		}
+	}
+	header, err := dlt.ExportSnapshot(shardId, ioutil.Discard)
+	if err != nil {
+		return nil, err
+	}
+	view.StateRoot = header.Root
+	return view, nil
+}
+
+// check if two views of a shard are same, returns a description of first difference otherwise
+func (v *ShardView) Diff(other *ShardView) string {
+	switch {
+	case len(v.Txs) != len(other.Txs):
+		return fmt.Sprintf("%d transactions vs %d", len(v.Txs), len(other.Txs))
+	case len(v.Tips) != len(other.Tips):
+		return fmt.Sprintf("%d tips vs %d", len(v.Tips), len(other.Tips))
+	case v.StateRoot != other.StateRoot:
+		return fmt.Sprintf("state root %x vs %x", v.StateRoot[:8], other.StateRoot[:8])
+	}
+	for i := range v.Txs {
+		if v.Txs[i] != other.Txs[i] {
+			return fmt.Sprintf("transaction %d: %x vs %x", i, v.Txs[i][:8], other.Txs[i][:8])
+		}
+	}
+	for i := range v.Tips {
+		if v.Tips[i] != other.Tips[i] {
+			return fmt.Sprintf("tip %d: %x vs %x", i, v.Tips[i][:8], other.Tips[i][:8])
+		}
+	}
+	return ""
+}
+
+// wait until every in-process node has same view of a shard, i.e. same transactions, tips and world state
+func (c *Cluster) WaitForConvergence(shardId []byte, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		diff, err := c.diverged(shardId)
+		if err == nil && len(diff) == 0 {
+			return nil
+		} else if time.Now().After(deadline) {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("shard did not converge: %s", diff)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// first difference in views of a shard across in-process nodes, empty if all views are same
+func (c *Cluster) diverged(shardId []byte) (string, error) {
+	var first *Node
+	var view *ShardView
+	for _, n := range c.Nodes {
+		if n.DLT == nil {
+			continue
+		}
+		other, err := View(n.DLT, shardId)
+		if err != nil {
+			return "", fmt.Errorf("%s: %s", n.Name, err)
+		} else if first == nil {
+			first, view = n, other
+		} else if diff := view.Diff(other); len(diff) > 0 {
+			return fmt.Sprintf("%s vs %s: %s", first.Name, n.Name, diff), nil
+		}
+	}
+	return "", nil
+}
+
+// stop a subprocess node, killing it if it does not exit upon interrupt
+func (n *Node) stopProcess() {
+	n.Cmd.Process.Signal(os.Interrupt)
+	select {
+	case <-n.exited:
+	case <-time.After(ShutdownTimeout):
+		n.Cmd.Process.Kill()
+		<-n.exited
+	}
+}
+
+// stop all nodes, and remove working directory if it was created by launch
+func (c *Cluster) Teardown() {
+	for _, n := range c.Nodes {
+		if n.DLT != nil {
+			n.DLT.Stop()
+			n.DLT = nil
+		}
+		if n.Cmd != nil {
+			n.stopProcess()
+			n.Cmd = nil
+		}
+	}
+	if c.cleanup {
+		os.RemoveAll(c.Dir)
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2019 The trust-net Authors
+package nodes
+
+import (
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// test that in-process nodes are launched with unique keys and ports, wired to each other, and peer up
+func TestLaunch_InProcess(t *testing.T) {
+	c, err := Launch(Config{Count: 3})
+	if err != nil {
+		t.Fatalf("failed to launch: %s", err)
+	}
+	ports := make(map[string]bool)
+	for _, n := range c.Nodes {
+		if ports[n.Config.Port] {
+			t.Errorf("%s re-uses port %s", n.Name, n.Config.Port)
+		}
+		ports[n.Config.Port] = true
+		if len(n.Config.Bootnodes) != 2 {
+			t.Errorf("%s has incorrect bootnodes: %v", n.Name, n.Config.Bootnodes)
+		}
+		if _, err := os.Stat(n.Config.KeyFile); err != nil {
+			t.Errorf("%s key not created: %s", n.Name, err)
+		}
+	}
+	if len(c.DLTs()) != 3 {
+		t.Errorf("incorrect number of stacks: %d", len(c.DLTs()))
+	}
+	if err := c.WaitForPeers(1, 20*time.Second); err != nil {
+		t.Errorf("nodes did not peer: %s", err)
+	}
+	c.Teardown()
+	if _, err := os.Stat(c.Dir); !os.IsNotExist(err) {
+		t.Errorf("working directory not removed: %v", err)
+	}
+}
+
+// test that subprocess nodes are launched with their config file, and are stopped upon teardown
+func TestLaunch_Subprocess(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "nodes-test-")
+	defer os.RemoveAll(dir)
+	c, err := Launch(Config{Count: 2, Name: "app", Dir: dir, Command: []string{"sh", "-c", "cat ${config}; echo ${index}; exec sleep 30"}})
+	if err != nil {
+		t.Fatalf("failed to launch: %s", err)
+	}
+	n := c.Nodes[1]
+	if n.Name != "app-1" || n.Cmd == nil || n.DLT != nil {
+		t.Errorf("incorrect subprocess node: %+v", n)
+	}
+	conf := p2p.Config{}
+	if data, err := ioutil.ReadFile(n.ConfigFile); err != nil {
+		t.Errorf("config not written: %s", err)
+	} else if json.Unmarshal(data, &conf); conf.Name != "app-1" || len(conf.Bootnodes) != 1 || conf.Bootnodes[0] != c.Nodes[0].Enode {
+		t.Errorf("incorrect config: %s", data)
+	}
+	// wait for subprocess to write its output
+	var output []byte
+	for i := 0; i < 50 && len(output) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		output, _ = ioutil.ReadFile(filepath.Join(n.Dir, "output.log"))
+	}
+	if len(output) == 0 {
+		t.Errorf("subprocess output not captured")
+	}
+	start := time.Now()
+	c.Teardown()
+	if time.Since(start) > ShutdownTimeout {
+		t.Errorf("subprocess not stopped upon interrupt")
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("caller's working directory should not be removed: %s", err)
+	}
+}
+
+// test that invalid network size is rejected
+func TestLaunch_Invalid(t *testing.T) {
+	if _, err := Launch(Config{}); err == nil {
+		t.Errorf("launch without nodes should fail")
+	}
+}
+
+// register a test app on all nodes of a cluster, recording each transaction's payload as a resource
+func registerTestApp(t *testing.T, c *Cluster, shardId []byte) {
+	for _, dlt := range c.DLTs() {
+		if err := dlt.Register(shardId, "test app", func(tx dto.Transaction, s state.State) error {
+			return s.Put(&state.Resource{Key: tx.Request().Payload, Value: tx.Request().Payload})
+		}); err != nil {
+			t.Fatalf("failed to register app: %s", err)
+		}
+	}
+}
+
+// submit a transaction of a submitter to a node
+func submitTestTx(t *testing.T, dlt stack.DLT, s *dto.Submitter, payload string) [64]byte {
+	tx, err := dlt.Submit(s.NewRequest(payload))
+	if err != nil {
+		t.Fatalf("failed to submit transaction: %s", err)
+	}
+	s.Seq, s.LastTx = s.Seq+1, tx.Id()
+	return tx.Id()
+}
+
+// test that nodes of an in-memory network diverge while partitioned, and converge once healed
+func TestPartition_Converge(t *testing.T) {
+	// a node syncs only a peer's shard that is ahead of its own, so a branch of the other side of partition
+	// is fetched by reconciling tips with peers
+	defer func(interval time.Duration) { stack.TipReconcileInterval = interval }(stack.TipReconcileInterval)
+	stack.TipReconcileInterval = 100 * time.Millisecond
+	c, err := Launch(Config{Count: 3, InMemory: true})
+	if err != nil {
+		t.Fatalf("failed to launch: %s", err)
+	}
+	defer c.Teardown()
+	shardId := []byte("partition shard")
+	registerTestApp(t, c, shardId)
+	if err := c.WaitForPeers(2, 10*time.Second); err != nil {
+		t.Fatalf("nodes did not peer: %s", err)
+	}
+
+	if err := c.Partition([]int{0}, []int{1, 2}); err != nil {
+		t.Fatalf("failed to partition: %s", err)
+	}
+	s1, s2 := dto.TestSubmitter(), dto.TestSubmitter()
+	s1.ShardId, s2.ShardId = shardId, shardId
+	tx1 := submitTestTx(t, c.Nodes[0].DLT, s1, "tx 1")
+	tx2 := submitTestTx(t, c.Nodes[1].DLT, s2, "tx 2")
+	// transaction should reach only nodes of submitting node's group
+	if _, err := c.Nodes[2].DLT.WaitFor(tx2, stack.WaitCriteria{}, 5*time.Second); err != nil {
+		t.Errorf("transaction did not reach node of same group: %s", err)
+	}
+	if c.Nodes[0].DLT.GetDagNode(tx2) != nil || c.Nodes[2].DLT.GetDagNode(tx1) != nil {
+		t.Errorf("transaction crossed partition")
+	}
+	if err := c.WaitForConvergence(shardId, 100*time.Millisecond); err == nil {
+		t.Errorf("partitioned nodes should not converge")
+	}
+
+	if err := c.Heal(); err != nil {
+		t.Fatalf("failed to heal: %s", err)
+	}
+	if err := c.WaitForConvergence(shardId, 20*time.Second); err != nil {
+		t.Errorf("healed nodes did not converge: %s", err)
+	}
+	if c.Nodes[0].DLT.GetDagNode(tx2) == nil || c.Nodes[2].DLT.GetDagNode(tx1) == nil {
+		t.Errorf("transactions not synced after heal")
+	}
+}
+
+// test that partition controls are refused for a network not in memory
+func TestPartition_NotInMemory(t *testing.T) {
+	c := &Cluster{}
+	if c.Partition([]int{0}) == nil || c.Heal() == nil {
+		t.Errorf("partition of network not in memory should fail")
+	}
+}
@@ -0,0 +1,328 @@
+// Copyright 2019 The trust-net Authors
+// In-memory network of in-process nodes, whose connections can be partitioned and healed
+package nodes
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/trust-net/dag-lib-go/stack"
+	dltp2p "github.com/trust-net/dag-lib-go/stack/p2p"
+	"io/ioutil"
+	"net"
+	"sync"
+)
+
+// max number of messages in flight on a connection in each direction, before sender blocks
+var PipeBuffer = 100 * 12
+
+// one end of an in-memory connection, messages are buffered (same as on a network connection) so
+// that both ends can write before reading, e.g. during handshake
+type pipeEnd struct {
+	in      chan p2p.Msg
+	out     chan p2p.Msg
+	closing chan struct{}
+	once    *sync.Once
+}
+
+func newPipe() (*pipeEnd, *pipeEnd) {
+	c1, c2 := make(chan p2p.Msg, PipeBuffer), make(chan p2p.Msg, PipeBuffer)
+	closing, once := make(chan struct{}), &sync.Once{}
+	return &pipeEnd{in: c1, out: c2, closing: closing, once: once},
+		&pipeEnd{in: c2, out: c1, closing: closing, once: once}
+}
+
+func (p *pipeEnd) WriteMsg(msg p2p.Msg) error {
+	// copy the payload, since sender may re-use it once write returns
+	data, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-p.closing:
+		return p2p.ErrPipeClosed
+	default:
+	}
+	select {
+	case p.out <- p2p.Msg{Code: msg.Code, Size: uint32(len(data)), Payload: bytes.NewReader(data)}:
+		return nil
+	case <-p.closing:
+		return p2p.ErrPipeClosed
+	}
+}
+
+func (p *pipeEnd) ReadMsg() (p2p.Msg, error) {
+	select {
+	case <-p.closing:
+		return p2p.Msg{}, p2p.ErrPipeClosed
+	default:
+	}
+	select {
+	case msg := <-p.in:
+		return msg, nil
+	case <-p.closing:
+		return p2p.Msg{}, p2p.ErrPipeClosed
+	}
+}
+
+// close both ends of connection
+func (p *pipeEnd) close() {
+	p.once.Do(func() { close(p.closing) })
+}
+
+func (p *pipeEnd) closed() bool {
+	select {
+	case <-p.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// remote node of a connection, as seen by DEVp2p peer wrapper
+type pipePeer struct {
+	remote *memLayer
+	local  *memLayer
+	pipe   *pipeEnd
+}
+
+func (p *pipePeer) ID() discover.NodeID {
+	return p.remote.nodeId
+}
+
+func (p *pipePeer) Name() string {
+	return p.remote.name
+}
+
+func (p *pipePeer) RemoteAddr() net.Addr {
+	return p.remote.addr()
+}
+
+func (p *pipePeer) LocalAddr() net.Addr {
+	return p.local.addr()
+}
+
+func (p *pipePeer) Disconnect(reason p2p.DiscReason) {
+	p.pipe.close()
+}
+
+func (p *pipePeer) String() string {
+	return fmt.Sprintf("Peer %x %s", p.remote.nodeId[:8], p.remote.addr())
+}
+
+// a connection of a node with another node
+type memConn struct {
+	peer dltp2p.Peer
+	pipe *pipeEnd
+}
+
+// in-memory p2p layer of an in-process node, identity and signatures are of node's DEVp2p layer (which is
+// never started), while messages are exchanged with other nodes of the fabric over in-memory connections
+type memLayer struct {
+	dltp2p.Layer
+	fabric  *fabric
+	index   int
+	name    string
+	nodeId  discover.NodeID
+	runner  dltp2p.Runner
+	started bool
+	conns   map[int]*memConn
+	lock    sync.RWMutex
+}
+
+func (l *memLayer) addr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: l.index + 1}
+}
+
+func (l *memLayer) Start() error {
+	return l.fabric.start(l)
+}
+
+func (l *memLayer) Stop() {
+	l.fabric.stop(l)
+}
+
+func (l *memLayer) Self() string {
+	return fmt.Sprintf("enode://%x@%s", l.nodeId[:], l.addr())
+}
+
+// snapshot of connections
+func (l *memLayer) connected() []*memConn {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	conns := make([]*memConn, 0, len(l.conns))
+	for _, conn := range l.conns {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+func (l *memLayer) Disconnect(peer dltp2p.Peer) {
+	for _, conn := range l.connected() {
+		if string(conn.peer.ID()) == string(peer.ID()) {
+			conn.pipe.close()
+		}
+	}
+	peer.Disconnect()
+}
+
+func (l *memLayer) Broadcast(msgId []byte, msgcode uint64, data interface{}) error {
+	for _, conn := range l.connected() {
+		conn.peer.Send(msgId, msgcode, data)
+	}
+	return nil
+}
+
+func (l *memLayer) BroadcastTo(msgId []byte, msgcode uint64, data interface{}, filter func(peerId []byte) bool) error {
+	for _, conn := range l.connected() {
+		if filter(conn.peer.ID()) {
+			conn.peer.Send(msgId, msgcode, data)
+		}
+	}
+	return nil
+}
+
+// close connection with a node, if connected
+func (l *memLayer) disconnect(index int) {
+	l.lock.RLock()
+	conn := l.conns[index]
+	l.lock.RUnlock()
+	if conn != nil {
+		conn.pipe.close()
+	}
+}
+
+func (l *memLayer) isConnected(index int) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	conn := l.conns[index]
+	return conn != nil && !conn.pipe.closed()
+}
+
+// run stack's runner for a connection with a node, until connection is closed
+func (l *memLayer) serve(remote *memLayer, pipe *pipeEnd) {
+	conn := &memConn{
+		peer: dltp2p.NewDEVp2pPeer(&pipePeer{remote: remote, local: l, pipe: pipe}, pipe),
+		pipe: pipe,
+	}
+	l.lock.Lock()
+	l.conns[remote.index] = conn
+	l.lock.Unlock()
+	go func() {
+		l.runner(conn.peer)
+		pipe.close()
+		l.lock.Lock()
+		if l.conns[remote.index] == conn {
+			delete(l.conns, remote.index)
+		}
+		l.lock.Unlock()
+	}()
+}
+
+// network of in-memory p2p layers, nodes in different groups of a partition are not connected
+type fabric struct {
+	layers []*memLayer
+	// group of each node while network is partitioned, nil when network is whole
+	groups map[int]int
+	lock   sync.Mutex
+}
+
+func newFabric() *fabric {
+	return &fabric{}
+}
+
+// factory of a node's in-memory p2p layer, for stack's WithP2P option
+func (f *fabric) factory(index int) stack.P2PFactory {
+	return func(conf dltp2p.Config, runner dltp2p.Runner) (dltp2p.Layer, error) {
+		layer, err := dltp2p.NewDEVp2pLayer(conf, runner)
+		if err != nil {
+			return nil, err
+		}
+		l := &memLayer{
+			Layer:  layer,
+			fabric: f,
+			index:  index,
+			name:   conf.Name,
+			runner: runner,
+			conns:  make(map[int]*memConn),
+		}
+		// node ID is the public key without its format prefix
+		copy(l.nodeId[:], layer.Id()[1:])
+		f.lock.Lock()
+		f.layers = append(f.layers, l)
+		f.lock.Unlock()
+		return l, nil
+	}
+}
+
+// check if two nodes can connect, i.e. they are in same group of a partition (called with lock held)
+func (f *fabric) reachable(a, b *memLayer) bool {
+	if f.groups == nil {
+		return true
+	}
+	groupA, foundA := f.groups[a.index]
+	groupB, foundB := f.groups[b.index]
+	return foundA && foundB && groupA == groupB
+}
+
+// connect started nodes that can reach each other, but are not yet connected (called with lock held)
+func (f *fabric) connect() {
+	for i, a := range f.layers {
+		for _, b := range f.layers[i+1:] {
+			if !a.started || !b.started || !f.reachable(a, b) || a.isConnected(b.index) || b.isConnected(a.index) {
+				continue
+			}
+			pipeA, pipeB := newPipe()
+			a.serve(b, pipeA)
+			b.serve(a, pipeB)
+		}
+	}
+}
+
+func (f *fabric) start(l *memLayer) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	l.started = true
+	f.connect()
+	return nil
+}
+
+func (f *fabric) stop(l *memLayer) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	l.started = false
+	for _, conn := range l.connected() {
+		conn.pipe.close()
+	}
+}
+
+// split network into groups of node indexes, connections across groups are closed and nodes of different groups
+// do not connect until network is healed, nodes not in any group are isolated
+func (f *fabric) partition(groups [][]int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.groups = make(map[int]int)
+	for group, indexes := range groups {
+		for _, index := range indexes {
+			f.groups[index] = group
+		}
+	}
+	for _, a := range f.layers {
+		for _, b := range f.layers {
+			if a != b && !f.reachable(a, b) {
+				a.disconnect(b.index)
+			}
+		}
+	}
+	// nodes of a group that were disconnected earlier connect again
+	f.connect()
+}
+
+// re-connect all nodes of network
+func (f *fabric) heal() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.groups = nil
+	f.connect()
+}
@@ -0,0 +1,279 @@
+// Copyright 2019 The trust-net Authors
+// Runner of scenarios against a set of nodes
+package scenario
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/loadgen"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interval between evaluations of assertions while waiting for convergence
+var ConvergePollInterval = 200 * time.Millisecond
+
+// a node that scenario submits to and asserts on
+type Node struct {
+	Target loadgen.Target
+	// value of an app resource on the node, an error if resource does not exist
+	Value func(key string) (interface{}, error)
+}
+
+// environment to run scenarios in
+type Env struct {
+	ShardId []byte
+	// nodes by name
+	Nodes map[string]*Node
+	// build app payload for an operation from its arguments
+	Build func(op string, args map[string]interface{}) ([]byte, error)
+}
+
+// result of a step's submission
+type SubmissionResult struct {
+	Step      int
+	Node      string
+	Submitter string
+	Op        string
+	TxId      [64]byte
+	Error     error
+}
+
+type Result struct {
+	Scenario    string
+	RunId       string
+	Submissions []*SubmissionResult
+	// failed expectations and assertions, empty when scenario passed
+	Failures []string
+	Duration time.Duration
+}
+
+func (r *Result) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Result) String() string {
+	var b strings.Builder
+	status := "PASS"
+	if !r.Passed() {
+		status = "FAIL"
+	}
+	fmt.Fprintf(&b, "%s: %s (run %s, %s)\n", status, r.Scenario, r.RunId, r.Duration.Round(time.Millisecond))
+	for _, failure := range r.Failures {
+		fmt.Fprintf(&b, "  %s\n", failure)
+	}
+	return b.String()
+}
+
+// state of a scenario run
+type run struct {
+	scenario    *Scenario
+	env         *Env
+	id          string
+	submitters  map[string]*dto.Submitter
+	checkpoints map[string]dto.Submitter
+	result      *Result
+	lock        sync.Mutex
+}
+
+// replace run id placeholder in a string
+func (r *run) expand(value string) string {
+	return strings.Replace(value, "${run}", r.id, -1)
+}
+
+func (r *run) expandArgs(args map[string]interface{}) map[string]interface{} {
+	expanded := make(map[string]interface{})
+	for name, value := range args {
+		if s, ok := value.(string); ok {
+			value = r.expand(s)
+		}
+		expanded[name] = value
+	}
+	return expanded
+}
+
+func (r *run) submitter(name string) *dto.Submitter {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, found := r.submitters[name]; !found {
+		r.submitters[name] = loadgen.NewSubmitters(1, r.env.ShardId)[0]
+	}
+	return r.submitters[name]
+}
+
+func (r *run) checkpoint(s *Submission) {
+	if len(s.Checkpoint) > 0 {
+		submitter := r.submitter(s.Submitter)
+		r.lock.Lock()
+		r.checkpoints[s.Checkpoint] = *submitter
+		r.lock.Unlock()
+	}
+}
+
+func (r *run) fail(format string, args ...interface{}) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.result.Failures = append(r.result.Failures, fmt.Sprintf(format, args...))
+}
+
+// submit a step's transaction and check its expectation
+func (r *run) submit(step int, s *Submission) {
+	if len(s.Delay) > 0 {
+		delay, _ := time.ParseDuration(s.Delay)
+		time.Sleep(delay)
+	}
+	res := &SubmissionResult{Step: step, Node: s.Node, Submitter: s.Submitter, Op: s.Op}
+	r.lock.Lock()
+	r.result.Submissions = append(r.result.Submissions, res)
+	r.lock.Unlock()
+	node := r.env.Nodes[s.Node]
+	if node == nil {
+		r.fail("step %d: unknown node %s", step, s.Node)
+		return
+	}
+	submitter := r.submitter(s.Submitter)
+	if len(s.From) > 0 {
+		// submit as a copy of submitter at checkpoint, without advancing the submitter
+		r.lock.Lock()
+		forked := r.checkpoints[s.From]
+		r.lock.Unlock()
+		submitter = &forked
+	}
+	payload, err := r.env.Build(s.Op, r.expandArgs(s.Args))
+	if err != nil {
+		r.fail("step %d: failed to build %s payload: %s", step, s.Op, err)
+		return
+	}
+	r.lock.Lock()
+	req := submitter.NewRequest(string(payload))
+	r.lock.Unlock()
+	res.TxId, res.Error = node.Target.Submit(req)
+	if res.Error == nil && len(s.From) == 0 {
+		r.lock.Lock()
+		submitter.LastTx, submitter.Seq = res.TxId, submitter.Seq+1
+		r.lock.Unlock()
+	}
+	switch {
+	case s.Expect == "ok" && res.Error != nil:
+		r.fail("step %d: %s on %s expected to succeed: %s", step, s.Op, s.Node, res.Error)
+	case s.Expect == "fail" && res.Error == nil:
+		r.fail("step %d: %s on %s expected to fail", step, s.Op, s.Node)
+	}
+}
+
+// check an assertion on a node, returns description of failure or empty string
+func (r *run) check(name string, node *Node, a *Assertion) string {
+	var actual interface{}
+	var what string
+	if len(a.Resource) > 0 {
+		what = r.expand(a.Resource)
+		value, err := node.Value(what)
+		if a.Missing {
+			if err == nil {
+				return fmt.Sprintf("%s: %s expected to be missing, found %v", name, what, value)
+			}
+			return ""
+		} else if err != nil {
+			return fmt.Sprintf("%s: %s: %s", name, what, err)
+		}
+		actual = value
+	} else {
+		sum := int64(0)
+		names := []string{}
+		for _, key := range a.Sum {
+			key = r.expand(key)
+			names = append(names, key)
+			if value, err := node.Value(key); err == nil {
+				var n int64
+				fmt.Sscan(fmt.Sprint(value), &n)
+				sum += n
+			}
+		}
+		what, actual = "sum("+strings.Join(names, ", ")+")", sum
+	}
+	expected := a.OneOf
+	if a.Value != nil {
+		expected = append(expected, a.Value)
+	}
+	for _, value := range expected {
+		if fmt.Sprint(value) == fmt.Sprint(actual) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s: %s = %v, expected %v", name, what, actual, expected)
+}
+
+// evaluate all assertions on all nodes, returns failures
+func (r *run) assert() []string {
+	names := make([]string, 0, len(r.env.Nodes))
+	for name, _ := range r.env.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	failures := []string{}
+	for i := range r.scenario.Assertions {
+		for _, name := range names {
+			if failure := r.check(name, r.env.Nodes[name], &r.scenario.Assertions[i]); len(failure) > 0 {
+				failures = append(failures, fmt.Sprintf("assertion %d: %s", i+1, failure))
+			}
+		}
+	}
+	return failures
+}
+
+// run the scenario in an environment, asserting on state once all nodes converge
+func (s *Scenario) Run(env *Env) *Result {
+	id := make([]byte, 4)
+	rand.Read(id)
+	r := &run{
+		scenario:    s,
+		env:         env,
+		id:          hex.EncodeToString(id),
+		submitters:  make(map[string]*dto.Submitter),
+		checkpoints: make(map[string]dto.Submitter),
+	}
+	r.result = &Result{Scenario: s.Name, RunId: r.id}
+	start := time.Now()
+	for i := range s.Steps {
+		step := &s.Steps[i]
+		switch {
+		case len(step.Wait) > 0:
+			wait, _ := time.ParseDuration(step.Wait)
+			time.Sleep(wait)
+		case len(step.Parallel) > 0:
+			for j := range step.Parallel {
+				r.checkpoint(&step.Parallel[j])
+			}
+			var wg sync.WaitGroup
+			for j := range step.Parallel {
+				wg.Add(1)
+				go func(sub *Submission) {
+					defer wg.Done()
+					r.submit(i+1, sub)
+				}(&step.Parallel[j])
+			}
+			wg.Wait()
+		default:
+			r.checkpoint(&step.Submission)
+			r.submit(i+1, &step.Submission)
+		}
+	}
+	// wait for assertions to hold on all nodes
+	timeout := ConvergeTimeout
+	if len(s.Converge) > 0 {
+		timeout, _ = time.ParseDuration(s.Converge)
+	}
+	deadline := time.Now().Add(timeout)
+	failures := r.assert()
+	for len(failures) > 0 && time.Now().Before(deadline) {
+		time.Sleep(ConvergePollInterval)
+		failures = r.assert()
+	}
+	r.result.Failures = append(r.result.Failures, failures...)
+	r.result.Duration = time.Since(start)
+	return r.result
+}
@@ -0,0 +1,168 @@
+// Copyright 2019 The trust-net Authors
+// Scripted scenarios of conflicting submissions across nodes, with assertions on converged state
+package scenario
+
+import (
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"time"
+)
+
+// default time to wait for nodes to converge before assertions fail
+var ConvergeTimeout = 10 * time.Second
+
+// a scenario described in YAML, e.g.:
+//
+//	name: split double spend
+//	steps:
+//	  - {node: local, submitter: alice, op: create, args: {name: "src-${run}", value: 10}, expect: ok}
+//	  - wait: 1s
+//	  - parallel:
+//	      - {node: local, submitter: alice, op: xfer, args: {source: "src-${run}", destination: "a-${run}", value: 5}, checkpoint: fork}
+//	      - {node: remote, submitter: alice, from: fork, op: xfer, args: {source: "src-${run}", destination: "b-${run}", value: 5}}
+//	assertions:
+//	  - {resource: "src-${run}", value: 5}
+//	  - {sum: ["a-${run}", "b-${run}"], value: 5}
+//
+// "${run}" in arguments and resource names is replaced with a unique id of each run
+type Scenario struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Steps       []Step `yaml:"steps"`
+	// time to wait for assertions to hold on all nodes (default ConvergeTimeout)
+	Converge   string      `yaml:"converge"`
+	Assertions []Assertion `yaml:"assertions"`
+}
+
+// a step of scenario, either a submission, a wait, or a group of parallel submissions
+type Step struct {
+	Submission `yaml:",inline"`
+	// pause for a duration, e.g. "500ms"
+	Wait string `yaml:"wait"`
+	// submissions run concurrently
+	Parallel []Submission `yaml:"parallel"`
+}
+
+// a transaction submission
+type Submission struct {
+	// name of node to submit to
+	Node string `yaml:"node"`
+	// name of submitter, each named submitter is created new for a run
+	Submitter string `yaml:"submitter"`
+	// app operation and its arguments to build payload
+	Op   string                 `yaml:"op"`
+	Args map[string]interface{} `yaml:"args"`
+	// optional delay before submission, e.g. "100ms"
+	Delay string `yaml:"delay"`
+	// save submitter's state before this submission under a label
+	Checkpoint string `yaml:"checkpoint"`
+	// submit from submitter's state saved at a checkpoint (i.e. re-using its sequence, to create a
+	// conflicting submission), such submission does not advance submitter's state
+	From string `yaml:"from"`
+	// expected result of submission: "ok", "fail" or "any" (default)
+	Expect string `yaml:"expect"`
+}
+
+// an assertion on converged state, evaluated on every node
+type Assertion struct {
+	// value of a resource
+	Resource string `yaml:"resource"`
+	// sum of values of resources
+	Sum []string `yaml:"sum"`
+	// expected value, or one of expected values
+	Value interface{}   `yaml:"value"`
+	OneOf []interface{} `yaml:"one_of"`
+	// resource should not exist
+	Missing bool `yaml:"missing"`
+}
+
+// parse a scenario from YAML
+func Parse(data []byte) (*Scenario, error) {
+	s := &Scenario{}
+	if err := yaml.UnmarshalStrict(data, s); err != nil {
+		return nil, fmt.Errorf("invalid scenario: %s", err)
+	}
+	if err := s.validate(); err != nil {
+		return nil, fmt.Errorf("invalid scenario %q: %s", s.Name, err)
+	}
+	return s, nil
+}
+
+// load a scenario from a YAML file
+func Load(file string) (*Scenario, error) {
+	if data, err := ioutil.ReadFile(file); err != nil {
+		return nil, err
+	} else {
+		return Parse(data)
+	}
+}
+
+func validDuration(value string) error {
+	if len(value) == 0 {
+		return nil
+	}
+	_, err := time.ParseDuration(value)
+	return err
+}
+
+func (s *Submission) validate(checkpoints map[string]bool) error {
+	if len(s.Node) == 0 || len(s.Submitter) == 0 || len(s.Op) == 0 {
+		return fmt.Errorf("submission requires node, submitter and op")
+	}
+	if err := validDuration(s.Delay); err != nil {
+		return err
+	}
+	switch s.Expect {
+	case "", "any", "ok", "fail":
+	default:
+		return fmt.Errorf("unknown expectation: %s", s.Expect)
+	}
+	if len(s.From) > 0 && !checkpoints[s.From] {
+		return fmt.Errorf("unknown checkpoint: %s", s.From)
+	}
+	if len(s.Checkpoint) > 0 {
+		checkpoints[s.Checkpoint] = true
+	}
+	return nil
+}
+
+func (s *Scenario) validate() error {
+	if len(s.Steps) == 0 {
+		return fmt.Errorf("no steps")
+	}
+	if err := validDuration(s.Converge); err != nil {
+		return err
+	}
+	checkpoints := make(map[string]bool)
+	for i, step := range s.Steps {
+		var err error
+		switch {
+		case len(step.Wait) > 0:
+			err = validDuration(step.Wait)
+		case len(step.Parallel) > 0:
+			// checkpoints of a parallel group are saved before any of its submissions
+			for j := range step.Parallel {
+				if len(step.Parallel[j].Checkpoint) > 0 {
+					checkpoints[step.Parallel[j].Checkpoint] = true
+				}
+			}
+			for j := 0; err == nil && j < len(step.Parallel); j++ {
+				err = step.Parallel[j].validate(checkpoints)
+			}
+		default:
+			err = step.Submission.validate(checkpoints)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d: %s", i+1, err)
+		}
+	}
+	for i, a := range s.Assertions {
+		if (len(a.Resource) == 0) == (len(a.Sum) == 0) {
+			return fmt.Errorf("assertion %d: requires one of resource or sum", i+1)
+		} else if !a.Missing && a.Value == nil && len(a.OneOf) == 0 {
+			return fmt.Errorf("assertion %d: requires value, one_of or missing", i+1)
+		}
+	}
+	return nil
+}
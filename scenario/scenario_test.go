@@ -0,0 +1,152 @@
+// Copyright 2019 The trust-net Authors
+package scenario
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// a network of nodes sharing a ledger, rejecting re-use of a submitter's sequence
+type testNetwork struct {
+	values map[string]int64
+	seqs   map[string]bool
+	lock   sync.Mutex
+}
+
+type testTarget struct {
+	net *testNetwork
+}
+
+func (t *testTarget) Submit(req *dto.TxRequest) ([64]byte, error) {
+	n := t.net
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	seq := fmt.Sprintf("%x:%d", req.SubmitterId, req.SubmitterSeq)
+	if n.seqs[seq] {
+		return [64]byte{}, fmt.Errorf("double spend: %s", seq)
+	}
+	n.seqs[seq] = true
+	words := strings.Fields(string(req.Payload))
+	value, _ := strconv.ParseInt(words[len(words)-1], 10, 64)
+	switch words[0] {
+	case "create":
+		n.values[words[1]] = value
+	case "xfer":
+		n.values[words[1]] -= value
+		n.values[words[2]] += value
+	}
+	return sha512.Sum512(req.Signature), nil
+}
+
+func testEnv() *Env {
+	net := &testNetwork{values: make(map[string]int64), seqs: make(map[string]bool)}
+	node := &Node{
+		Target: &testTarget{net: net},
+		Value: func(key string) (interface{}, error) {
+			net.lock.Lock()
+			defer net.lock.Unlock()
+			if value, found := net.values[key]; found {
+				return value, nil
+			}
+			return nil, fmt.Errorf("not found")
+		},
+	}
+	return &Env{
+		ShardId: []byte("test shard"),
+		Nodes:   map[string]*Node{"local": node, "remote": node},
+		Build: func(op string, args map[string]interface{}) ([]byte, error) {
+			switch op {
+			case "create":
+				return []byte(fmt.Sprintf("create %v %v", args["name"], args["value"])), nil
+			case "xfer":
+				return []byte(fmt.Sprintf("xfer %v %v %v", args["source"], args["destination"], args["value"])), nil
+			}
+			return nil, fmt.Errorf("unknown op")
+		},
+	}
+}
+
+const splitScenario = `
+name: split double spend
+steps:
+  - {node: local, submitter: alice, op: create, args: {name: "src-${run}", value: 10}, expect: ok}
+  - wait: 10ms
+  - parallel:
+      - {node: local, submitter: alice, op: xfer, args: {source: "src-${run}", destination: "a-${run}", value: 5}, checkpoint: fork}
+      - {node: remote, submitter: alice, from: fork, op: xfer, args: {source: "src-${run}", destination: "b-${run}", value: 5}}
+converge: 100ms
+assertions:
+  - {resource: "src-${run}", value: 5}
+  - {sum: ["a-${run}", "b-${run}"], value: 5}
+  - {sum: ["a-${run}"], one_of: [0, 5]}
+  - {resource: "c-${run}", missing: true}
+`
+
+// test that a conflicting submission scenario passes when only one spend is applied
+func TestRun_Split(t *testing.T) {
+	s, err := Parse([]byte(splitScenario))
+	if err != nil {
+		t.Fatalf("failed to parse scenario: %s", err)
+	}
+	res := s.Run(testEnv())
+	if !res.Passed() {
+		t.Errorf("scenario failed: %s", res)
+	}
+	if len(res.Submissions) != 3 {
+		t.Errorf("incorrect submissions: %d", len(res.Submissions))
+	}
+	failed := 0
+	for _, sub := range res.Submissions {
+		if sub.Error != nil {
+			failed += 1
+		}
+	}
+	if failed != 1 {
+		t.Errorf("one of conflicting submissions should fail: %d", failed)
+	}
+}
+
+// test that failed expectations and assertions are reported
+func TestRun_Failures(t *testing.T) {
+	s, err := Parse([]byte(`
+name: double on same node
+steps:
+  - {node: local, submitter: bob, op: create, args: {name: "x-${run}", value: 1}, checkpoint: first}
+  - {node: local, submitter: bob, from: first, op: create, args: {name: "y-${run}", value: 2}, expect: ok}
+converge: 50ms
+assertions:
+  - {resource: "x-${run}", value: 2}
+`))
+	if err != nil {
+		t.Fatalf("failed to parse scenario: %s", err)
+	}
+	res := s.Run(testEnv())
+	if res.Passed() || len(res.Failures) != 3 {
+		t.Errorf("incorrect failures: %s", res)
+	} else if !strings.Contains(res.Failures[0], "expected to succeed") || !strings.Contains(res.Failures[1], "expected [2]") {
+		t.Errorf("incorrect failures: %s", res)
+	}
+}
+
+// test that invalid scenarios are rejected
+func TestParse_Invalid(t *testing.T) {
+	for _, data := range []string{
+		`name: no steps`,
+		`steps: [{node: local, op: create}]`,
+		`steps: [{node: local, submitter: a, op: create, from: unknown}]`,
+		`steps: [{wait: forever}]`,
+		`steps: [{node: local, submitter: a, op: create, expect: maybe}]`,
+		`steps: [{node: local, submitter: a, op: create}]
+assertions: [{resource: x}]`,
+		`steps: [{node: local, submitter: a, op: create, unknown: field}]`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("invalid scenario should fail: %s", data)
+		}
+	}
+}
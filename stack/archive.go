@@ -0,0 +1,212 @@
+// Copyright 2019 The trust-net Authors
+// Export of a shard's DAG into an archive, and import of archives with full re-validation
+package stack
+
+import (
+	"encoding/gob"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"io"
+)
+
+// format version of shard archives
+var ArchiveVersion = uint64(1)
+
+// number of transactions read from shard log per batch during export
+var exportBatchSize = 100
+
+// header of a shard archive, followed by serialized transactions in shard's canonical order
+type archiveHeader struct {
+	Version uint64
+	ShardId []byte
+	// name of codec transactions are serialized with (gob when empty)
+	Codec string
+}
+
+// options for importing a shard archive
+type ImportOptions struct {
+	// trust the archive and skip re-validation of signatures and anchors, only for archives
+	// exported by the node itself (submitter history is validated in either case)
+	Trusted bool
+}
+
+// a transaction of the archive that was not imported
+type ImportFailure struct {
+	// position of the transaction in archive (starting at 1)
+	Index    int
+	TxId     [64]byte
+	ShardSeq uint64
+	Reason   string
+}
+
+// validation report of an archive import
+type ImportReport struct {
+	// number of transactions read from archive
+	Read int
+	// transactions validated and added to local DAG
+	Imported int
+	// transactions already present in local DAG
+	Duplicates int
+	// transactions that failed validation (descendants of a rejected transaction fail too)
+	Rejected int
+	Failures []ImportFailure
+}
+
+func (r *ImportReport) String() string {
+	return fmt.Sprintf("read: %d, imported: %d, duplicates: %d, rejected: %d", r.Read, r.Imported, r.Duplicates, r.Rejected)
+}
+
+// export a shard's transactions into an archive, in canonical order
+func (d *dlt) ExportShard(shardId []byte, w io.Writer) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(&archiveHeader{Version: ArchiveVersion, ShardId: shardId, Codec: d.codec.Name()}); err != nil {
+		return err
+	}
+	var cursor *shard.LogCursor
+	for {
+		d.lock.Lock()
+		txs, next, err := d.sharder.ShardLog(shardId, cursor, exportBatchSize)
+		d.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			if data, err := d.codec.Marshal(tx); err != nil {
+				return err
+			} else if err := enc.Encode(data); err != nil {
+				return err
+			}
+		}
+		if len(txs) < exportBatchSize {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// validate a transaction's signatures and its anchor's links into local shard DAG
+func (d *dlt) validateImport(shardId []byte, tx dto.Transaction) error {
+	if tx.Request() == nil || tx.Anchor() == nil {
+		return fmt.Errorf("missing request or anchor")
+	}
+	if string(tx.Request().ShardId) != string(shardId) {
+		return fmt.Errorf("transaction of a different shard")
+	}
+	if err := d.validateSignatures(tx); err != nil {
+		return err
+	}
+	a := tx.Anchor()
+	if a.ShardSeq == shard.ShardSeqOne {
+		if a.ShardParent != shard.GenesisShardTx(shardId).Id() {
+			return fmt.Errorf("first shard transaction's parent is not genesis")
+		}
+	} else if parent := d.db.GetShardDagNode(a.ShardParent); parent == nil {
+		return fmt.Errorf("parent transaction unknown")
+	} else if a.ShardSeq != parent.Depth+1 {
+		return fmt.Errorf("shard seq %d does not follow parent's depth %d", a.ShardSeq, parent.Depth)
+	}
+	for _, uncle := range a.ShardUncles {
+		if d.db.GetShardDagNode(uncle) == nil {
+			return fmt.Errorf("uncle transaction unknown: %x", uncle[:8])
+		}
+	}
+	return nil
+}
+
+// add a validated transaction to local DAG, through endorsement and sharding layers
+func (d *dlt) importTx(tx dto.Transaction) error {
+	// rejected transaction's updates are discarded, so that it's not left in history
+	batch := d.db.Begin()
+	defer batch.Discard()
+	endorser, sharder := d.endorser.WithBatch(batch), d.sharder.WithBatch(batch)
+	if _, err := endorser.Handle(tx); err != nil {
+		return err
+	}
+	if err := sharder.LockState(); err != nil {
+		return err
+	}
+	defer sharder.UnlockState()
+	if err := sharder.Handle(tx); err != nil {
+		d.invariantViolated(err)
+		return err
+	}
+	if err := endorser.Update(tx); err != nil {
+		return err
+	}
+	if err := sharder.CommitState(tx); err != nil {
+		return err
+	}
+	if err := batch.Commit(); err != nil {
+		return err
+	}
+	d.accepted(tx)
+	return nil
+}
+
+// import a shard's archive, re-validating every transaction's signatures, anchor and parent links
+// (unless archive is trusted) and submitter history, returns report of validation results, or an
+// error if archive itself can not be read
+func (d *dlt) ImportShard(shardId []byte, r io.Reader, opts *ImportOptions) (*ImportReport, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if !d.isStored(shardId) {
+		return nil, fmt.Errorf("shard not stored by node: %x", shardId)
+	}
+	dec := gob.NewDecoder(r)
+	header := &archiveHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid archive header: %s", err)
+	} else if header.Version > ArchiveVersion {
+		return nil, fmt.Errorf("unsupported archive version: %d", header.Version)
+	} else if string(header.ShardId) != string(shardId) {
+		return nil, fmt.Errorf("archive is for shard %x", header.ShardId)
+	}
+	codec, err := common.CodecByName(header.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive header: %s", err)
+	}
+	report := &ImportReport{}
+	for {
+		var data []byte
+		if err := dec.Decode(&data); err == io.EOF {
+			break
+		} else if err != nil {
+			return report, fmt.Errorf("invalid archive record %d: %s", report.Read+1, err)
+		}
+		report.Read += 1
+		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+		if err := codec.Unmarshal(data, tx); err != nil {
+			return report, fmt.Errorf("invalid archive transaction %d: %s", report.Read, err)
+		}
+		if d.db.GetShardDagNode(tx.Id()) != nil {
+			report.Duplicates += 1
+			continue
+		}
+		var err error
+		if !opts.Trusted {
+			err = d.validateImport(shardId, tx)
+		}
+		if err == nil {
+			err = d.importTx(tx)
+		}
+		if err != nil {
+			report.Rejected += 1
+			report.Failures = append(report.Failures, ImportFailure{
+				Index:    report.Read,
+				TxId:     tx.Id(),
+				ShardSeq: tx.Anchor().ShardSeq,
+				Reason:   err.Error(),
+			})
+			d.logger.Debug("Rejected imported transaction %x: %s", tx.Id(), err)
+		} else {
+			report.Imported += 1
+		}
+	}
+	d.logger.Info("Imported archive for shard %x, %s", shardId, report)
+	return report, nil
+}
@@ -0,0 +1,130 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// create a stack with a chain of submitted transactions, and export its shard
+func testArchive(t *testing.T, count int) (*bytes.Buffer, []dto.Transaction) {
+	return testArchiveWithCodec(t, count, common.GobCodec)
+}
+
+// create a stack using a codec with a chain of submitted transactions, and export its shard
+func testArchiveWithCodec(t *testing.T, count int, codec common.Codec) (*bytes.Buffer, []dto.Transaction) {
+	stack, _, _, _ := initMocks()
+	stack.codec = codec
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = stack.app.ShardId
+	txs := []dto.Transaction{}
+	for i := 0; i < count; i++ {
+		if tx, err := stack.Submit(submitter.NewRequest("test payload")); err != nil {
+			t.Fatalf("submission failed: %s", err)
+		} else {
+			submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+			txs = append(txs, tx)
+		}
+	}
+	archive := &bytes.Buffer{}
+	if err := stack.ExportShard(stack.app.ShardId, archive); err != nil {
+		t.Fatalf("export failed: %s", err)
+	}
+	return archive, txs
+}
+
+// archive exported by a node should be imported with full validation by another node
+func TestImportShard(t *testing.T) {
+	archive, txs := testArchive(t, 3)
+	data := archive.Bytes()
+	stack, _, _, _ := initMocks()
+	report, err := stack.ImportShard(stack.app.ShardId, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Errorf("import failed: %s", err)
+	} else if report.Read != 3 || report.Imported != 3 || report.Rejected != 0 {
+		t.Errorf("incorrect report: %s", report)
+	}
+	for _, tx := range txs {
+		if stack.db.GetShardDagNode(tx.Id()) == nil {
+			t.Errorf("transaction not imported: %x", tx.Id())
+		}
+	}
+	// re-import should only find duplicates
+	if report, _ := stack.ImportShard(stack.app.ShardId, bytes.NewReader(data), nil); report.Duplicates != 3 || report.Imported != 0 {
+		t.Errorf("incorrect report for re-import: %s", report)
+	}
+}
+
+// archive exported by a node using protobuf codec should be imported by a node using gob codec
+func TestImportShard_ProtobufCodec(t *testing.T) {
+	archive, txs := testArchiveWithCodec(t, 3, common.ProtobufCodec)
+	stack, _, _, _ := initMocks()
+	report, err := stack.ImportShard(stack.app.ShardId, archive, nil)
+	if err != nil {
+		t.Fatalf("import failed: %s", err)
+	} else if report.Imported != 3 || report.Rejected != 0 {
+		t.Errorf("incorrect report: %s", report)
+	}
+	for _, tx := range txs {
+		if stack.db.GetShardDagNode(tx.Id()) == nil {
+			t.Errorf("transaction not imported: %x", tx.Id())
+		}
+	}
+}
+
+// transactions with invalid signatures should be rejected, along with their descendants
+func TestImportShard_InvalidSignatures(t *testing.T) {
+	archive, _ := testArchive(t, 2)
+	data := archive.Bytes()
+	stack, _, _, p2p := initMocks()
+	p2p.InvalidSignatures = true
+	report, err := stack.ImportShard(stack.app.ShardId, bytes.NewReader(data), nil)
+	if err != nil {
+		t.Errorf("import failed: %s", err)
+	} else if report.Imported != 0 || report.Rejected != 2 || len(report.Failures) != 2 {
+		t.Errorf("incorrect report: %s", report)
+	} else if report.Failures[0].Reason != "Anchor signature invalid" || report.Failures[1].Index != 2 {
+		t.Errorf("incorrect failures: %v", report.Failures)
+	}
+	// a trusted import skips signature validation
+	p2p.InvalidSignatures = true
+	if report, _ := stack.ImportShard(stack.app.ShardId, bytes.NewReader(data), &ImportOptions{Trusted: true}); report.Imported != 2 {
+		t.Errorf("incorrect report for trusted import: %s", report)
+	}
+}
+
+// transactions with tampered anchors should be rejected
+func TestImportShard_InvalidAnchor(t *testing.T) {
+	_, txs := testArchive(t, 2)
+	// build an archive with second transaction's shard seq tampered
+	txs[1].Anchor().ShardSeq += 1
+	archive := &bytes.Buffer{}
+	enc := gob.NewEncoder(archive)
+	enc.Encode(&archiveHeader{Version: ArchiveVersion, ShardId: txs[0].Request().ShardId})
+	for _, tx := range txs {
+		data, _ := tx.Serialize()
+		enc.Encode(data)
+	}
+	stack, _, _, _ := initMocks()
+	report, err := stack.ImportShard(stack.app.ShardId, archive, nil)
+	if err != nil {
+		t.Errorf("import failed: %s", err)
+	} else if report.Imported != 1 || report.Rejected != 1 || report.Failures[0].TxId != txs[1].Id() {
+		t.Errorf("incorrect report: %s, %v", report, report.Failures)
+	}
+}
+
+// archives of other shards or unknown formats should be refused
+func TestImportShard_InvalidArchive(t *testing.T) {
+	archive, _ := testArchive(t, 1)
+	stack, _, _, _ := initMocks()
+	if _, err := stack.ImportShard([]byte("other shard"), bytes.NewReader(archive.Bytes()), nil); err == nil {
+		t.Errorf("expected archive of different shard to be refused")
+	}
+	if _, err := stack.ImportShard(stack.app.ShardId, bytes.NewReader([]byte("garbage")), nil); err == nil {
+		t.Errorf("expected invalid archive to be refused")
+	}
+}
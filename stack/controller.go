@@ -3,6 +3,8 @@
 package stack
 
 import (
+	"crypto/sha512"
+	"encoding/hex"
 	"errors"
 	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
@@ -13,29 +15,206 @@ import (
 	"github.com/trust-net/dag-lib-go/stack/repo"
 	"github.com/trust-net/dag-lib-go/stack/shard"
 	"github.com/trust-net/dag-lib-go/stack/state"
+	"github.com/trust-net/dag-lib-go/version"
+	"io"
 	"sync"
+	"time"
 )
 
+// max number of rejection (NACK) messages sent by node per second
+var MaxNacksPerSecond = 10
+
+// max number of hops a rejection (NACK) message is forwarded toward transaction's originator
+var MaxNackHops = uint64(3)
+
+// max number of times a submission is re-anchored when its anchor goes stale (disabled by default)
+var MaxReanchorRetries = 0
+
+// max time to wait for tips of registered app's shard from peers when issuing an anchor for a shard
+// not known locally (disabled by default)
+var RemoteAnchorTimeout = time.Duration(0)
+
+// max number of transactions per second accepted from a submitter for submission, and from network (no limit by default)
+var SubmitterTxRate = float64(0)
+var SubmitterNetworkTxRate = float64(0)
+
+// max number of transactions accepted from a submitter in a burst above its rate
+var SubmitterTxBurst = 10
+
 type DLT interface {
 	// register application shard with the DLT stack
 	Register(shardId []byte, name string, txHandler func(tx dto.Transaction, state state.State) error) error
-	// unregister application shard from DLT stack
+	// register application shard with the DLT stack using specified replay/state options
+	RegisterWithOptions(shardId []byte, name string, txHandler func(tx dto.Transaction, state state.State) error, opts *shard.RegisterOptions) error
+	// unregister all application shards from DLT stack
 	Unregister() error
-	// submit a transaction request to the network
+	// unregister application of specified shard from DLT stack, other registered applications continue
+	UnregisterShard(shardId []byte) error
+	// reset a shard not registered by any app: clear its world state, DAG, transactions and their submitters'
+	// history, so that an app registered for the shard afterwards replays a clean history
+	ResetShard(shardId []byte) error
+	// pause (first registered) application, stack continues to sync and store the shard's transactions
+	Pause() error
+	// resume paused application, replaying only the transactions received while paused
+	Resume(txHandler func(tx dto.Transaction, state state.State) error) error
+	// pause application registered for specified shard, other registered applications continue
+	PauseShard(shardId []byte) error
+	// resume paused application of specified shard, replaying only the transactions received while paused
+	ResumeShard(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) error
+	// submit a transaction request to the network, a rejection's reason is reported as a stable
+	// code by dto.ErrorCodeOf(err)
 	Submit(req *dto.TxRequest) (dto.Transaction, error)
-	// get a transaction Anchor for specified submitter id
+	// submit a transaction request to the network, with caller provided trace ID (new one generated if empty)
+	SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error)
+	// submit a transaction request with an anchor issued earlier by this node (e.g. cached by submitter), a
+	// stale anchor is not re-anchored by node but rejected with dto.ErrStaleAnchor (node anchors when nil)
+	SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error)
+	// get a transaction Anchor for specified submitter id, on (first registered) application's shard
 	Anchor(id []byte, seq uint64, lastTx [64]byte) *dto.Anchor
+	// get a transaction Anchor for specified submitter id, on specified registered application's shard
+	AnchorShard(shardId []byte, id []byte, seq uint64, lastTx [64]byte) *dto.Anchor
 	// start the controller
 	Start() error
 	// stop the controller
 	Stop()
-	// get value for a resource from current world state for the registered shard
+	// get value for a resource from current world state for the (first) registered shard
 	GetState(key []byte) (*state.Resource, error)
+	// get value for a resource from current world state of specified registered shard
+	GetShardState(shardId []byte, key []byte) (*state.Resource, error)
+	// get value for a resource from a shard's world state as of a shard sequence (i.e. after transactions
+	// up to that sequence were applied), for balance-as-of style queries
+	GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error)
+	// get resources owned by an owner in current world state for the (first) registered shard, in order of keys
+	ListByOwner(owner []byte) ([]*state.Resource, error)
+	// get resources owned by an owner in current world state of specified registered shard, in order of keys
+	ListShardByOwner(shardId []byte, owner []byte) ([]*state.Resource, error)
+	// get audit trail of anchors issued for specified submitter id
+	AnchorAudit(id []byte) []repo.AnchorRecord
+	// get anchors issued for specified submitter id that were never consumed
+	AbandonedAnchors(id []byte) []repo.AnchorRecord
+	// get forensic records of double spends detected by the node, in order of detection
+	Forensics() []repo.ForensicRecord
+	// get registry of shards seen in node's transaction history, in order of shard id
+	Shards() []repo.ShardInfo
+	// get transaction size/complexity statistics for specified shard
+	ShardStats(shardId []byte) *shard.ShardStats
+	// get transactions rejected as invalid by (first) registered app's transaction handler
+	DeadLetters() []shard.DeadLetter
+	// get transactions rejected as invalid by transaction handler of specified registered shard's app
+	ShardDeadLetters(shardId []byte) []shard.DeadLetter
+	// get ID and shard sequence of last transaction applied to specified shard's world state,
+	// for apps to checkpoint/resume external projections
+	LastApplied(shardId []byte) ([64]byte, uint64)
+	// read transactions of a shard in the canonical order used for state application, starting after
+	// specified cursor (nil to read from beginning), returns cursor for next read or shard.ErrLogCursorInvalid
+	// when shard history before cursor has changed and consumer must re-read from beginning
+	ShardLog(shardId []byte, cursor *shard.LogCursor, limit int) ([]dto.Transaction, *shard.LogCursor, error)
+	// get a transaction known to node, returns ErrTxNotFound for an unknown transaction
+	GetTx(id [64]byte) (dto.Transaction, error)
+	// iterate over a shard's transactions in topological order (same as ShardLog), reading the shard's
+	// history in pages as iteration progresses
+	TxIterator(shardId []byte) Iterator
+	// attach labels and a note to a transaction known to node (replacing earlier ones, empty to remove), kept
+	// locally and never gossiped, returns ErrTxNotFound for an unknown transaction
+	LabelTx(id [64]byte, labels []string, note string) error
+	// get labels and note attached to a transaction (nil if none)
+	TxLabels(id [64]byte) *repo.TxLabels
+	// get transactions with a label, of specified shard (any shard for nil), in order of transaction IDs
+	LabeledTxs(label string, shardId []byte) []dto.Transaction
+	// pin a transaction known to node, exempting it from pruning (regardless of its shard's retention policy)
+	// and its shard from collection, returns ErrTxNotFound for an unknown transaction
+	PinTx(id [64]byte, reason string) error
+	// remove a transaction's pin, returns ErrTxNotFound for a transaction that's not pinned
+	UnpinTx(id [64]byte) error
+	// get pinned transactions of specified shard (any shard for nil), in order of pinning
+	Pins(shardId []byte) []repo.Pin
+	// get finality status of a transaction known to node (one of TX_PENDING, TX_ACCEPTED, TX_REJECTED or
+	// TX_ORPHANED), returns ErrTxNotFound for an unknown transaction
+	Status(txId [64]byte) (string, error)
+	// get receipt of a transaction known to node, with detail of its last status update
+	Receipt(txId [64]byte) (*repo.TxReceipt, error)
+	// get progress of shard syncs with peers
+	SyncStatus() []SyncStatus
+	// get candidate sources for a shard's sync, ranked by their advertised tip depth, reliability and latency
+	SyncPeers(shardId []byte) []SyncPeer
+	// join an existing shard by locating peers carrying it and syncing its history (up to its trusted
+	// checkpoint, if any) before returning, so that an app registered for the shard afterwards replays
+	// shard's full history, returns ErrJoinTimeout if history was not synced within timeout
+	JoinShard(shardId []byte, timeout time.Duration) (*repo.ShardInfo, error)
+	// get node's information and effective limits of each layer
+	NodeInfo() *NodeInfo
+	// get shard DAG node of a transaction (nil if transaction is not in local DAG)
+	GetDagNode(id [64]byte) *DagNode
+	// get children of a transaction's shard DAG node
+	ChildrenOf(id [64]byte) []DagNode
+	// get parent of a transaction's shard DAG node (nil for genesis or unknown transaction)
+	ParentOf(id [64]byte) *DagNode
+	// get a verifiable proof of submitter's transaction history, for auditors
+	SubmitterProof(submitterId []byte) (*SubmitterProof, error)
+	// get a chronological report of submitter's transactions across shards, with payloads decoded into operations
+	// by specified hook (nil to report raw payloads), for compliance/audit exports as CSV or JSON
+	SubmitterReport(submitterId []byte, decode PayloadDecoder) (*SubmitterReport, error)
+	// block until a transaction is applied locally (and confirmed by specified number of shard DAG levels),
+	// returns ErrWaitTimeout if criteria is not met within timeout
+	WaitFor(txId [64]byte, criteria WaitCriteria, timeout time.Duration) (*WaitResult, error)
+	// export a shard's transactions into an archive, in canonical order
+	ExportShard(shardId []byte, w io.Writer) error
+	// import a shard's archive, re-validating every transaction (unless trusted), and report results
+	ImportShard(shardId []byte, r io.Reader, opts *ImportOptions) (*ImportReport, error)
+	// export a shard's world state (all resources) into a snapshot, along with the shard's tips it corresponds to
+	ExportSnapshot(shardId []byte, w io.Writer) (*state.SnapshotHeader, error)
+	// seed a shard unknown to node with a snapshot's world state and tips, instead of syncing and replaying
+	// shard's entire history, shard's later transactions are then synced from peers
+	RestoreSnapshot(shardId []byte, r io.Reader) (*state.SnapshotHeader, error)
+	// declare a shard's retention policy, shard's history before the epochs kept by the policy is pruned
+	// as shard moves into a new epoch
+	SetRetention(policy *shard.Retention) error
+	// prune a shard's history as per its retention policy right away
+	PruneShard(shardId []byte) (*shard.PruneReport, error)
+	// replace transaction handler of a registered (and not paused) shard between transactions, e.g. after
+	// loading a new version of app's module, when verify is non zero the new handler is first re-run over
+	// shard's last verify transactions and swap is refused unless it reproduces current state
+	SwapHandler(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, verify int) (*shard.SwapReport, error)
+	// get shards with no registered app that have had no new transactions for Policies.AbandonedShardPeriod
+	AbandonedShards() []*repo.ShardInfo
+	// archive an abandoned shard into writer (same as ExportShard) and then delete it from node, node stops
+	// storing the shard's transactions unless an app registers for it or it's joined
+	CollectShard(shardId []byte, w io.Writer) error
+	// subscribe to stack events, returns subscription ID
+	Subscribe(handler func(e *Event)) uint64
+	// cancel an event subscription
+	Unsubscribe(id uint64)
+	// register a handler called with evidence of each double spend observed by node (two conflicting
+	// transactions of a submitter for same sequence and shard), returns subscription ID to cancel with Unsubscribe
+	OnDoubleSpend(handler func(evidence DoubleSpendEvidence)) uint64
+	// watch a shard without registering as its app (no world state or genesis creation), handler is called
+	// in order with each transaction of the shard accepted by the node, returns watch ID
+	Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error)
+	// cancel a shard watch
+	Unwatch(id uint64)
+	// get node's cumulative counters, persisted across restarts
+	Counters() *NodeCounters
+	// get storage statistics of transaction records written since node's start, e.g. achieved compression
+	StorageStats() *repo.StorageStats
+	// get a snapshot of node's runtime statistics (peers, queues, shard transaction rates, database sizes,
+	// rejections), for apps rendering their own dashboards
+	Stats() *Stats
+	// listen for a handoff request from a new instance at a unix socket path, upon which stack is
+	// stopped to release its storage and p2p identity, and released is called
+	ServeHandoff(path string, released func(info *HandoffInfo)) (*HandoffServer, error)
+	// replay inbound messages captured by a node (p2p.Config.CaptureFile) through the controller, on a stack
+	// with a fresh repo, to reproduce a node's processing of gossip offline
+	Replay(path string) error
 }
 
 type dlt struct {
+	// first registered app, used by methods that do not specify a shard
 	app       *AppConfig
+	// apps registered with stack, in order of registration
+	apps      []*AppConfig
 	txHandler func(tx dto.Transaction, state state.State) error
+	// shards of registered apps that are paused
+	paused    map[string]bool
 	db        repo.DltDb
 	dbp		  db.DbProvider
 	p2p       p2p.Layer
@@ -43,18 +222,61 @@ type dlt struct {
 	sharder   shard.Sharder
 	endorser  endorsement.Endorser
 	seen      *common.Set
+	seenCache *repo.SeenCache
+	labels    *repo.LabelStore
+	receipts  *repo.ReceiptStore
+	// most recently processed transactions, and directory to write crash dumps into (disabled when empty)
+	recent       *recentTxs
+	crashDumpDir string
+	crashOnce    sync.Once
+	executor  *shardExecutor
+	validators *validationPool
+	subs      *subscriptions
+	watches   *watches
+	counters  *repo.Counters
+	stats     *runtimeStats
+	metrics   MetricsRegistry
+	latency   *latencyTracker
+	syncs     *syncTracker
+	joins     *shardJoins
+	collected *collectedShards
+	syncPeers *syncPeers
+	peerVersions *peerVersions
+	peerSubscriptions *peerSubscriptions
+	// codec of transactions exchanged during sync
+	codec     common.Codec
+	policies  Policies
+	filter    StorageFilter
+	// rate limit for rejection (NACK) messages
+	nackWindow time.Time
+	nackCount  int
+	nackLock   sync.Mutex
+	// locks of submitters whose transactions are being processed, since a submitter's transactions of
+	// different shards are processed concurrently
+	submitterLocks *keyedLocks
+	// node's own submitter sequence for housekeeping transactions
+	nodeSeq   uint64
+	nodeTasks []*nodeTask
 	lock      sync.RWMutex
 	logger    log.Logger
 }
 
 func (d *dlt) Register(shardId []byte, name string, txHandler func(tx dto.Transaction, state state.State) error) error {
+	return d.RegisterWithOptions(shardId, name, txHandler, nil)
+}
+
+func (d *dlt) RegisterWithOptions(shardId []byte, name string, txHandler func(tx dto.Transaction, state state.State) error, opts *shard.RegisterOptions) error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	if d.app != nil {
-		d.logger.Error("Attempt to register app on already registered stack")
+	if d.registered(shardId) != nil {
+		d.logger.Error("Attempt to register app for already registered shard")
 		return errors.New("App is already registered")
 	}
-	d.app = &AppConfig{
+	if d.joins.joining(shardId) {
+		d.logger.Error("Attempt to register app for shard being joined")
+		return errors.New("shard join in progress")
+	}
+	app := &AppConfig{
 		ShardId: shardId,
 		Name:    name,
 	}
@@ -63,17 +285,26 @@ func (d *dlt) Register(shardId []byte, name string, txHandler func(tx dto.Transa
 	// (since submitter may want to submit same transaction with multiple app instances) -- may be we should
 	// only have shard Id in the transaction
 	// ACTUALLY, this will be the Anchor (which will include app ID from DLT stack)
-	d.app.AppId = d.p2p.Id()
-	d.txHandler = txHandler
+	app.AppId = d.p2p.Id()
+	d.apps = append(d.apps, app)
+	d.collected.remove(shardId)
+	if d.app == nil {
+		d.app = app
+		d.txHandler = txHandler
+	}
 
 	// register app with sharder
-	if err := d.sharder.Register(shardId, txHandler); err != nil {
+	if err := d.sharder.RegisterWithOptions(shardId, txHandler, opts); err != nil {
 		d.logger.Error("Failed to register app with shard: %s", err)
+		d.removeApp(shardId)
+		d.invariantViolated(err)
 		return err
 	}
 
+	d.announceShards()
+
 	// initiate app registration sync protocol
-	if anchor, err := d.anchor(); err != nil {
+	if anchor, err := d.shardAnchor(shardId); err != nil {
 		d.logger.Error("Failed to get anchor for sync: %s", err)
 		return err
 	} else {
@@ -88,15 +319,162 @@ func (d *dlt) Register(shardId []byte, name string, txHandler func(tx dto.Transa
 func (d *dlt) Unregister() error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	return d.unregister()
+	if err := d.unregister(); err != nil {
+		return err
+	}
+	d.announceShards()
+	return nil
 }
 
 func (d *dlt) unregister() error {
 	d.app = nil
+	d.apps = nil
 	d.txHandler = nil
+	d.paused = make(map[string]bool)
 	return d.sharder.Unregister()
 }
 
+func (d *dlt) UnregisterShard(shardId []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil {
+		return errors.New("app not registered")
+	}
+	d.removeApp(shardId)
+	if err := d.sharder.UnregisterShard(shardId); err != nil {
+		return err
+	}
+	d.announceShards()
+	return nil
+}
+
+func (d *dlt) ResetShard(shardId []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) != nil {
+		return errors.New("app registered for shard")
+	}
+	return d.sharder.ResetShard(shardId)
+}
+
+// get app registered for a shard (nil if none)
+func (d *dlt) registered(shardId []byte) *AppConfig {
+	for _, app := range d.apps {
+		if string(app.ShardId) == string(shardId) {
+			return app
+		}
+	}
+	return nil
+}
+
+// remove app of a shard from registered apps, next registered app takes over when first app is removed
+func (d *dlt) removeApp(shardId []byte) {
+	for i, app := range d.apps {
+		if string(app.ShardId) == string(shardId) {
+			d.apps = append(d.apps[:i], d.apps[i+1:]...)
+			break
+		}
+	}
+	delete(d.paused, string(shardId))
+	if d.app != nil && string(d.app.ShardId) == string(shardId) {
+		d.app, d.txHandler = nil, nil
+		if len(d.apps) > 0 {
+			d.app = d.apps[0]
+		}
+	}
+}
+
+func (d *dlt) Pause() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.app == nil {
+		return errors.New("app not registered")
+	}
+	return d.pause(d.app.ShardId)
+}
+
+func (d *dlt) PauseShard(shardId []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil {
+		return errors.New("app not registered")
+	}
+	return d.pause(shardId)
+}
+
+// pause app of a registered shard, caller must hold stack's lock
+func (d *dlt) pause(shardId []byte) error {
+	if d.paused[string(shardId)] {
+		return errors.New("app already paused")
+	}
+	if err := d.sharder.PauseShard(shardId); err != nil {
+		d.logger.Error("Failed to pause app with shard: %s", err)
+		return err
+	}
+	if string(d.app.ShardId) == string(shardId) {
+		d.txHandler = nil
+	}
+	d.paused[string(shardId)] = true
+	return nil
+}
+
+func (d *dlt) SwapHandler(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, verify int) (*shard.SwapReport, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil {
+		return nil, errors.New("app not registered")
+	} else if d.paused[string(shardId)] {
+		return nil, errors.New("app paused")
+	}
+	report, err := d.sharder.SwapHandler(shardId, txHandler, verify)
+	if err != nil {
+		d.logger.Error("Failed to swap transaction handler of shard %x: %s", shardId, err)
+		return report, err
+	}
+	if string(d.app.ShardId) == string(shardId) {
+		d.txHandler = txHandler
+	}
+	return report, nil
+}
+
+func (d *dlt) Resume(txHandler func(tx dto.Transaction, state state.State) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.app == nil {
+		return errors.New("app not registered")
+	}
+	return d.resume(d.app.ShardId, txHandler)
+}
+
+func (d *dlt) ResumeShard(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil {
+		return errors.New("app not registered")
+	}
+	return d.resume(shardId, txHandler)
+}
+
+// resume paused app of a registered shard, caller must hold stack's lock
+func (d *dlt) resume(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) error {
+	if !d.paused[string(shardId)] {
+		return errors.New("app not paused")
+	}
+	// re-register with sharder, which will replay transactions not yet seen by app
+	if err := d.sharder.Register(shardId, txHandler); err != nil {
+		d.logger.Error("Failed to resume app with shard: %s", err)
+		// app cannot continue in paused state
+		d.removeApp(shardId)
+		d.sharder.UnregisterShard(shardId)
+		return err
+	}
+	if string(d.app.ShardId) == string(shardId) {
+		d.txHandler = txHandler
+	}
+	delete(d.paused, string(shardId))
+	return nil
+}
+
 func (d *dlt) validateSignatures(tx dto.Transaction) error {
 	// validate transaction Anchor signature using transaction approver's ID
 	if !d.p2p.Verify(tx.Anchor().Bytes(), tx.Anchor().Signature, tx.Anchor().NodeId) {
@@ -120,110 +498,325 @@ func (d *dlt) isPoW(req *dto.TxRequest) bool {
 }
 
 func (d *dlt) Submit(req *dto.TxRequest) (dto.Transaction, error) {
+	return d.SubmitWithTrace(req, "")
+}
+
+func (d *dlt) SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	if len(traceId) == 0 {
+		traceId = dto.NewTraceId()
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.submit(req, nil, traceId)
+}
+
+func (d *dlt) SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	if len(traceId) == 0 {
+		traceId = dto.NewTraceId()
+	}
 	d.lock.Lock()
 	defer d.lock.Unlock()
+	return d.submit(req, anchor, traceId)
+}
+
+// submit a transaction request with submitter's anchor (anchored by node when nil), caller must hold stack's lock
+func (d *dlt) submit(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
 	// node needs to host a registered app for accepting transaction request
 	if d.app == nil {
-		return nil, errors.New("app not registered")
+		return nil, dto.NewTxError(dto.ErrAppNotRegistered, "app not registered")
+	} else if req != nil && d.paused[string(req.ShardId)] {
+		return nil, dto.NewTxError(dto.ErrAppPaused, "app paused")
 	}
 	// validate transaction request
 	switch {
 	case req == nil:
-		return nil, errors.New("nil transaction")
-	case string(req.ShardId) != string(d.app.ShardId):
-		return nil, errors.New("incorrect shard id")
+		return nil, dto.NewTxError(dto.ErrInvalidRequest, "nil transaction")
+	case d.registered(req.ShardId) == nil:
+		return nil, dto.NewTxError(dto.ErrShardUnknown, "incorrect shard id")
 	case req.Payload == nil:
-		return nil, errors.New("nil transaction payload")
+		return nil, dto.NewTxError(dto.ErrInvalidRequest, "nil transaction payload")
 	case req.SubmitterId == nil:
-		return nil, errors.New("nil transaction submitter ID")
+		return nil, dto.NewTxError(dto.ErrInvalidRequest, "nil transaction submitter ID")
 	case req.Signature == nil:
-		return nil, errors.New("nil transaction signature")
+		return nil, dto.NewTxError(dto.ErrInvalidRequest, "nil transaction signature")
 	case !d.isPoW(req):
-		return nil, errors.New("insufficient proof of work")
+		return nil, dto.NewTxError(dto.ErrInvalidRequest, "insufficient proof of work")
+	}
+	if err := d.checkRequestLimits(req); err != nil {
+		return nil, err
 	}
 
 	// validate transaction request signature using transaction submitter's ID
 	if !d.p2p.Verify(req.Bytes(), req.Signature, req.SubmitterId) {
-		return nil, errors.New("Request signature invalid")
+		return nil, dto.NewTxError(dto.ErrInvalidSignature, "Request signature invalid")
 	}
 
-	// lock shard
-	if err := d.sharder.LockState(); err != nil {
+	// build and apply the transaction, re-anchoring when node's anchor goes stale before it's applied (a
+	// submitter's anchor is re-anchored by submitter)
+	var tx dto.Transaction
+	var err error
+	for retry := 0; ; retry++ {
+		if tx, err = d.submitAnchored(req, anchor, traceId); err == nil {
+			break
+		} else if dto.ErrorCodeOf(err) != dto.ErrStaleAnchor || anchor != nil || retry >= d.policies.MaxReanchorRetries {
+			return nil, err
+		}
+		d.logger.Debug("[trace %s] Re-anchoring submission after stale anchor (retry %d): %s", traceId, retry+1, err)
+	}
+	d.accepted(tx)
+	d.latencySubmitted(tx)
+	// log anchor details for successfully accpeted submission
+	d.logger.Debug("Submitted anchor signature for Tx: %x\n%s", tx.Id(), tx.Anchor().ToString())
+
+	// finally send it to p2p layer, to broadcase to others
+	id := tx.Id()
+	if err := d.broadcastTx(tx); err != nil {
+		d.logger.Error("[trace %s] Submitted transaction failed to broadcast: %s", traceId, err)
+		d.setStatus(id, TX_PENDING, "broadcast failed: "+err.Error())
+	} else {
+		d.logger.Debug("[trace %s] Submitted transaction accepted, broadcasting: %x", traceId, id)
+	}
+	return tx, nil
+}
+
+// anchor a transaction request (with node's current anchor when not specified) and apply it, caller must hold
+// stack's lock
+func (d *dlt) submitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	// buffer transaction's DLT DB and world state updates, so that they are applied together only if transaction
+	// is accepted
+	batch := d.db.Begin()
+	defer batch.Discard()
+	endorser, sharder := d.endorser.WithBatch(batch), d.sharder.WithBatch(batch)
+
+	// lock shard, with world state updated through the batch
+	if err := sharder.LockState(); err != nil {
 		d.logger.Error("Submit: failed to get world state lock: %s", err)
 		return nil, err
 	}
-	defer d.sharder.UnlockState()
+	defer sharder.UnlockState()
 
 	// build a transaction
 	var tx dto.Transaction
-	if a, err := d.anchor(); err != nil {
+	if anchor != nil {
+		// only anchors issued by this node are accepted from submitters
+		if string(anchor.NodeId) != string(d.p2p.Id()) || !d.p2p.Verify(anchor.Bytes(), anchor.Signature, anchor.NodeId) {
+			return nil, dto.NewTxError(dto.ErrInvalidSignature, "anchor not issued by node")
+		}
+		tx = dto.NewTransaction(req, anchor)
+		tx.SetTraceId(traceId)
+	} else if a, err := d.shardAnchor(req.ShardId); err != nil {
 		return nil, err
 	} else {
 		// test my own signature
 		if !d.p2p.Verify(a.Bytes(), a.Signature, a.NodeId) {
 			d.logger.Debug("Invalid signature for my own anchor!!!\n%s", a.ToString())
-			return nil, errors.New("Anchor signature invalid")
+			return nil, dto.NewTxError(dto.ErrInternal, "Anchor signature invalid")
 		}
 		tx = dto.NewTransaction(req, a)
+		tx.SetTraceId(traceId)
 	}
 
 	// check if message was already seen by stack
 	if d.isSeen(tx.Id()) {
-		d.logger.Debug("Discarding submission of seen transaction: %x", tx.Id())
-		return nil, errors.New("seen transaction")
+		d.logger.Debug("[trace %s] Discarding submission of seen transaction: %x", traceId, tx.Id())
+		return nil, dto.NewTxError(dto.ErrDuplicate, "seen transaction")
 	}
 
 	// check whether transaction has correct submitter sequencing
-	if err := d.endorser.Approve(tx); err != nil {
-		d.logger.Debug("Submitted transaction failed to approve at endorser: %s\ntransaction: %x", err, tx.Id())
+	if err := endorser.Approve(tx); err != nil {
+		d.logger.Debug("[trace %s] Submitted transaction failed to approve at endorser: %s\ntransaction: %x", traceId, err, tx.Id())
+		if dto.ErrorCodeOf(err) == dto.ErrDoubleSpend {
+			d.rejectedDoubleSpend(tx)
+		}
 		return nil, err
 	}
 
 	// process transaction and get approval from registered shard application instance
-	if err := d.sharder.Approve(tx); err != nil {
-		d.logger.Debug("Submitted transaction failed to approve at sharder: %s\ntransaction: %x", err, tx.Id())
-		return nil, err
+	if err := sharder.Approve(tx); err != nil {
+		d.logger.Debug("[trace %s] Submitted transaction failed to approve at sharder: %s\ntransaction: %x", traceId, err, tx.Id())
+		d.invariantViolated(err)
+		if dto.ErrorCodeOf(err) == dto.ErrStaleAnchor {
+			// transaction was never applied, so a resubmission with same anchor is not a seen transaction
+			d.seen.Remove(tx.Id())
+		}
+		return nil, dto.WithErrorCode(dto.ErrRejected, err)
 	} else {
 		d.logger.Debug("Committing world state after successful transaction: %x", tx.Id())
-		if err := d.endorser.Update(tx); err != nil {
+		if err := endorser.Update(tx); err != nil {
 			d.logger.Debug("Submitted transaction failed to update submitter history at endorser: %s\ntransaction: %x", err, tx.Id())
 			return nil, err
 		}
 
-		if err := d.sharder.CommitState(tx); err != nil {
+		if err := sharder.CommitState(tx); err != nil {
 			d.logger.Debug("Submitted transaction failed to commit world state and update shard DAG: %s\ntransaction: %x", err, tx.Id())
 			return nil, err
 		}
+		if err := batch.Commit(); err != nil {
+			d.logger.Error("[trace %s] Submitted transaction failed to commit DLT DB updates: %s\ntransaction: %x", traceId, err, tx.Id())
+			return nil, err
+		}
 	}
-	// log anchor details for successfully accpeted submission
-	d.logger.Debug("Submitted anchor signature for Tx: %x\n%s", tx.Id(), tx.Anchor().ToString())
+	return tx, nil
+}
 
-	// finally send it to p2p layer, to broadcase to others
+// broadcast a transaction to peers, with trace ID only if gossip of trace is enabled
+func (d *dlt) broadcastTx(tx dto.Transaction) error {
 	id := tx.Id()
-	if err := d.p2p.Broadcast(id[:], TransactionMsgCode, tx); err != nil {
-		d.logger.Error("Submitted transaction failed to broadcast: %s", err)
-	} else {
-		d.logger.Debug("Submitted transaction accepted, broadcasting: %x", id)
+	if len(tx.TraceId()) > 0 && !d.conf.GossipTrace {
+		// send a copy without the trace envelope field
+		tx = dto.NewTransaction(tx.Request(), tx.Anchor())
 	}
-	return tx, nil
+	// only forward to peers subscribed to transaction's shard
+	shardId := tx.Request().ShardId
+	if err := d.p2p.BroadcastTo(id[:], TransactionMsgCode, tx, func(peerId []byte) bool {
+		return d.peerSubscriptions.wants(peerId, shardId)
+	}); err != nil {
+		return err
+	}
+	d.countGossip(tx)
+	return nil
+}
+
+// book-keeping for a transaction accepted into local DAG
+func (d *dlt) accepted(tx dto.Transaction) {
+	d.recent.add(tx.Id())
+	d.countTx(tx)
+	d.stats.txAccepted(tx.Request().ShardId)
+	d.watches.deliver(tx)
+	d.receiptAccepted(tx)
+	d.pruneOnEpoch(tx)
 }
 
 func (d *dlt) Anchor(id []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	return d.issueAnchor(nil, id, seq, lastTx)
+}
+
+func (d *dlt) AnchorShard(shardId []byte, id []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	if len(shardId) == 0 {
+		d.logger.Error("Missing shard id for anchor")
+		return nil
+	}
+	return d.issueAnchor(shardId, id, seq, lastTx)
+}
+
+// issue an anchor on a registered app's shard (first registered app's shard when shard is not specified)
+func (d *dlt) issueAnchor(shardId []byte, id []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
 	// submitter sequence should be 1 or higher
 	if seq < 1 {
 		d.logger.Error("Incorrect submitter sequence: %d", seq)
 		return nil
 	}
 
+	// fetch tips of a shard not known locally from peers, so that anchor is not issued over shard's genesis
+	if d.policies.RemoteAnchorTimeout > 0 {
+		d.fetchShardTips(shardId, d.policies.RemoteAnchorTimeout)
+	}
+
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	if a, err := d.anchor(); err != nil {
+	anchor := d.shardAnchor
+	if len(shardId) == 0 {
+		anchor = func([]byte) (*dto.Anchor, error) { return d.anchor() }
+		if d.app != nil {
+			shardId = d.app.ShardId
+		}
+	}
+	if d.paused[string(shardId)] {
+		d.logger.Debug("Cannot issue anchor for paused app")
+		return nil
+	}
+	if a, err := anchor(shardId); err != nil {
 		return nil
 	} else {
+		// record issued anchor in audit trail
+		if err := d.endorser.AnchorIssued(id, seq, lastTx, shardId, a); err != nil {
+			d.logger.Error("Failed to record anchor in audit trail: %s", err)
+		}
+		d.latency.anchorIssued(id, seq, time.Now())
 		return a
 	}
 }
 
+func (d *dlt) AnchorAudit(id []byte) []repo.AnchorRecord {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.endorser.AnchorAudit(id)
+}
+
+func (d *dlt) AbandonedAnchors(id []byte) []repo.AnchorRecord {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.endorser.AbandonedAnchors(id)
+}
+
+func (d *dlt) Shards() []repo.ShardInfo {
+	shards := []repo.ShardInfo{}
+	for _, shardId := range d.db.GetShards() {
+		if info := d.db.GetShardInfo(shardId); info != nil {
+			shards = append(shards, *info)
+		}
+	}
+	return shards
+}
+
+func (d *dlt) ShardStats(shardId []byte) *shard.ShardStats {
+	stats := d.sharder.Stats(shardId)
+	// seed cumulative count from persisted counters, e.g. for shards not seen since restart
+	if total := d.counters.Get(shardTxCounter(shardId)); total > 0 {
+		if stats == nil {
+			stats = &shard.ShardStats{}
+		}
+		stats.TotalTxCount = total
+	}
+	return stats
+}
+
+func (d *dlt) StorageStats() *repo.StorageStats {
+	return d.db.StorageStats()
+}
+
+func (d *dlt) DeadLetters() []shard.DeadLetter {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.app == nil {
+		return nil
+	}
+	return d.sharder.DeadLetters(d.app.ShardId)
+}
+
+func (d *dlt) ShardDeadLetters(shardId []byte) []shard.DeadLetter {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil {
+		return nil
+	}
+	return d.sharder.DeadLetters(shardId)
+}
+
+func (d *dlt) LastApplied(shardId []byte) ([64]byte, uint64) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.LastApplied(shardId)
+}
+
+func (d *dlt) ShardLog(shardId []byte, cursor *shard.LogCursor, limit int) ([]dto.Transaction, *shard.LogCursor, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.ShardLog(shardId, cursor, limit)
+}
+
+func (d *dlt) SyncStatus() []SyncStatus {
+	return d.syncs.status()
+}
+
+func (d *dlt) Subscribe(handler func(e *Event)) uint64 {
+	return d.subs.add(handler)
+}
+
+func (d *dlt) Unsubscribe(id uint64) {
+	d.subs.remove(id)
+}
+
 func (d *dlt) GetState(key []byte) (*state.Resource, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
@@ -231,6 +824,30 @@ func (d *dlt) GetState(key []byte) (*state.Resource, error) {
 	return d.sharder.GetState(key)
 }
 
+func (d *dlt) GetShardState(shardId []byte, key []byte) (*state.Resource, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.GetShardState(shardId, key)
+}
+
+func (d *dlt) GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.GetStateAtSeq(shardId, seq, key)
+}
+
+func (d *dlt) ListByOwner(owner []byte) ([]*state.Resource, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.ListByOwner(owner)
+}
+
+func (d *dlt) ListShardByOwner(shardId []byte, owner []byte) ([]*state.Resource, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.ListShardByOwner(shardId, owner)
+}
+
 func (d *dlt) anchor() (*dto.Anchor, error) {
 	a := &dto.Anchor{}
 	if err := d.sharder.Anchor(a); err != nil {
@@ -246,44 +863,131 @@ func (d *dlt) anchor() (*dto.Anchor, error) {
 	return a, nil
 }
 
+// get anchor for a registered app's shard
+func (d *dlt) shardAnchor(shardId []byte) (*dto.Anchor, error) {
+	if d.app != nil && string(d.app.ShardId) == string(shardId) {
+		return d.anchor()
+	} else if d.registered(shardId) == nil {
+		return nil, errors.New("app not registered")
+	}
+	a := d.sharder.SyncAnchor(shardId)
+	if a == nil {
+		return nil, errors.New("shard unknown")
+	}
+	if err := d.p2p.Anchor(a); err != nil {
+		d.logger.Debug("Failed to get p2p layer's anchor: %s", err)
+		return nil, err
+	}
+	return a, nil
+}
+
 func (d *dlt) Start() error {
 	d.lock.Lock()
 	defer d.lock.Unlock()
-	return d.p2p.Start()
+	d.logger.Info("Starting node %s, version: %s", d.conf.Name, version.Get())
+	if err := d.p2p.Start(); err != nil {
+		return err
+	}
+	d.startNodeTasks()
+	return nil
 }
 
 func (d *dlt) Stop() {
+	d.stopNodeTasks()
+	// drain queued network transactions before taking stack's lock, since their jobs need a shared lock
+	d.executor.stop()
 	d.lock.Lock()
 	defer d.lock.Unlock()
 	d.logger.Debug("Shutting down...")
 	d.p2p.Stop()
+	d.saveSeen()
 	d.dbp.CloseAll()
 }
 
 // perform handshake with the peer node
 func (d *dlt) handshake(peer p2p.Peer) error {
+	// advertise node's version to peer
+	msg := NewNodeVersionMsg(version.Get())
+	if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+		return err
+	}
+	// announce shards stored by node, if enabled
+	if d.conf.AnnounceShards {
+		msg := NewShardSubscriptionMsg(d.storedShards())
+		if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+			return err
+		}
+	}
 	// if there is a registered app, send shard sync message for the app's shard
 	//   1) ask sharding layer for the current shard's Anchor
 	//   2) ask endorsing layer for the current Anchor's update
 	//   3) send the ShardSyncMsg message to peer
 	if anchor, err := d.anchor(); err != nil {
 		d.logger.Debug("Cannot run handshake: %s", err)
+		return nil
 	} else {
 		msg := NewShardSyncMsg(d.app.ShardId, anchor)
-		return peer.Send(msg.Id(), msg.Code(), msg)
+		if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+			return err
+		}
+	}
+	// followed by shard sync message for shards of other registered apps
+	for _, app := range d.apps[1:] {
+		if anchor, err := d.shardAnchor(app.ShardId); err != nil {
+			d.logger.Debug("Cannot sync shard in handshake: %s", err)
+		} else {
+			msg := NewShardSyncMsg(app.ShardId, anchor)
+			if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+				return err
+			}
+		}
 	}
 	return nil
 }
 
+// check if node stores transactions of a shard, registered apps' shards are always stored, and shards collected
+// as abandoned are not
+func (d *dlt) isStored(shardId []byte) bool {
+	if d.registered(shardId) != nil || d.joins.member(shardId) {
+		return true
+	} else if d.collected.has(shardId) {
+		return false
+	}
+	return d.filter == nil || d.filter(shardId)
+}
+
 func (d *dlt) handleTransaction(peer p2p.Peer, events chan controllerEvent, tx dto.Transaction, allowDupe bool) error {
+	// refuse transactions of shards that node does not store, e.g. during sync
+	if !d.isStored(tx.Request().ShardId) {
+		return errors.New("shard not stored by node")
+	}
+	// refuse oversized transactions, e.g. from sync responses
+	if err := d.checkLimits(tx); err != nil {
+		peer.Logger().Debug("Network transaction exceeds limits: %s", err)
+		d.nack(peer, tx, REJECT_LIMIT, err)
+		return err
+	}
+	// buffer transaction's DLT DB and world state updates, so that they are applied together only if transaction
+	// is accepted
+	batch := d.db.Begin()
+	defer batch.Discard()
+	endorser, sharder := d.endorser.WithBatch(batch), d.sharder.WithBatch(batch)
+
+	// lock submitter's history until transaction's updates are committed, transactions of other shards are
+	// processed concurrently
+	d.submitterLocks.Lock(tx.Request().SubmitterId)
+	defer d.submitterLocks.Unlock(tx.Request().SubmitterId)
+
 	// send transaction to endorsing layer for handling
-	if res, err := d.endorser.Handle(tx); err != nil {
+	if res, err := endorser.Handle(tx); err != nil {
+		d.stats.txRejected(res)
 		// check for failure reason
 		switch res {
 		case endorsement.ERR_DOUBLE_SPEND:
 			// trigger double spending resolution
 			peer.Logger().Error("Detected double spending for submitter/seq/shard: %x / %d / %x", tx.Request().SubmitterId, tx.Request().SubmitterSeq, tx.Request().ShardId)
 			peer.Logger().Error("Remote peer: %s / %s", peer.Name(), peer.RemoteAddr())
+			d.nack(peer, tx, REJECT_DOUBLE_SPEND, err)
 			events <- newControllerEvent(ALERT_DoubleSpend, tx)
 			return err
 		case endorsement.ERR_DUPLICATE:
@@ -293,6 +997,10 @@ func (d *dlt) handleTransaction(peer p2p.Peer, events chan controllerEvent, tx d
 				// we don't want to disconnect, since duplicate could happen if some other peer already forwarded the transaction
 				return err
 			}
+		case endorsement.ERR_THROTTLED:
+			// not a fault of peer, transaction would be fetched during a later sync of its shard
+			peer.Logger().Debug("Throttled transaction of submitter: %x", tx.Request().SubmitterId)
+			return err
 		case endorsement.ERR_ORPHAN:
 			// save the orphan transaction for later processing
 			if err := peer.ToBeFetchedStackPush(tx); err != nil {
@@ -314,41 +1022,108 @@ func (d *dlt) handleTransaction(peer p2p.Peer, events chan controllerEvent, tx d
 
 			return err
 		default:
+			d.nack(peer, tx, REJECT_INVALID, err)
 			return err
 		}
 	}
 
-	// let sharding layer process transaction
-	if err := d.sharder.LockState(); err != nil {
+	// let sharding layer process transaction, locking only world state of transaction's shard
+	if err := sharder.LockShardState(tx.Request().ShardId); err != nil {
 		peer.Logger().Error("handleTransaction: failed to get world state lock: %s\nTransaction: %x", err, tx.Id())
 		return err
 	}
-	defer d.sharder.UnlockState()
-	if err := d.sharder.Handle(tx); err != nil {
-		peer.Logger().Error("Failed to shard transaction: %s\nTransaction: %x", err, tx.Id())
+	defer sharder.UnlockShardState(tx.Request().ShardId)
+	if err := sharder.Handle(tx); err != nil {
+		peer.Logger().Error("[trace %s] Failed to shard transaction: %s\nTransaction: %x", tx.TraceId(), err, tx.Id())
+		d.invariantViolated(err)
+		d.nack(peer, tx, REJECT_SHARD, err)
 		return err
 	} else {
 		peer.Logger().Debug("Commiting world state after successful transaction: %x", tx.Id())
-		if err := d.endorser.Update(tx); err != nil {
+		if err := endorser.Update(tx); err != nil {
 			d.logger.Debug("Failed to update submitter history at endorser: %s\ntransaction: %x", err, tx.Id())
 			return err
 		}
-		if err := d.sharder.CommitState(tx); err != nil {
+		if err := sharder.CommitState(tx); err != nil {
 			d.logger.Debug("Failed to commit world state and update shard DAG: %s\ntransaction: %x", err, tx.Id())
 			return err
 		}
+		if err := batch.Commit(); err != nil {
+			d.logger.Error("Failed to commit DLT DB updates: %s\ntransaction: %x", err, tx.Id())
+			return err
+		}
 	}
+	d.accepted(tx)
 
 	// mark sender of the message as seen
 	id := tx.Id()
 	peer.Seen(id[:])
-	peer.Logger().Debug("Network transaction accepted, broadcasting: %x", id)
-	if err := d.p2p.Broadcast(id[:], TransactionMsgCode, tx); err != nil {
+	d.ack(peer, tx)
+	peer.Logger().Debug("[trace %s] Network transaction accepted, broadcasting: %x", tx.TraceId(), id)
+	if err := d.broadcastTx(tx); err != nil {
 		d.logger.Error("Failed to broadcast message: %s", err)
 	}
 	return nil
 }
 
+// send a rejection (NACK) for a transaction back to the peer that sent it, if enabled and within rate limit
+func (d *dlt) nack(peer p2p.Peer, tx dto.Transaction, reason uint64, err error) {
+	if !d.conf.SendNacks {
+		return
+	}
+	d.nackLock.Lock()
+	defer d.nackLock.Unlock()
+	if now := time.Now(); now.Sub(d.nackWindow) > time.Second {
+		d.nackWindow, d.nackCount = now, 0
+	}
+	if d.nackCount >= d.policies.MaxNacksPerSecond {
+		peer.Logger().Debug("Rate limited rejection for transaction: %x", tx.Id())
+		return
+	}
+	d.nackCount += 1
+	msg := NewTxRejectMsg(tx, reason, err.Error())
+	peer.Seen(msg.Id())
+	if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+		peer.Logger().Debug("Failed to send rejection for transaction: %x", tx.Id())
+	}
+}
+
+func (d *dlt) handleRECV_TxRejectMsg(peer p2p.Peer, msg *TxRejectMsg) error {
+	// skip rejections already processed
+	if d.isSeen(sha512.Sum512(msg.Id())) {
+		return nil
+	}
+	peer.Seen(msg.Id())
+	if string(msg.Origin) == string(d.p2p.Id()) {
+		// this node originated the transaction, surface rejection to app subscribers
+		peer.Logger().Debug("Transaction rejected by remote peer: %x\n%s", msg.TxId, msg.Detail)
+		d.receiptRejected(msg.TxId, msg.Detail)
+		d.subs.publish(&Event{
+			Type:    EVENT_TX_REJECTED,
+			TxId:    msg.TxId,
+			ShardId: msg.ShardId,
+			Reason:  msg.Reason,
+			Detail:  msg.Detail,
+		})
+		return nil
+	}
+	// forward toward originator, bounded by max hops
+	if msg.Hops >= d.policies.MaxNackHops {
+		return nil
+	}
+	msg.Hops += 1
+	return d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+}
+
+// record start of shard sync with a peer, depth of a shard is the sequence of its sync anchor
+func (d *dlt) startSync(peer p2p.Peer, shardId []byte, local, remote *dto.Anchor) {
+	localDepth := uint64(0)
+	if local != nil {
+		localDepth = local.ShardSeq
+	}
+	d.syncs.start(shardId, peer.String(), localDepth, remote.ShardSeq)
+}
+
 func (d *dlt) toWalkUpStage(shardId []byte, shardParent [64]byte, peer p2p.Peer) error {
 	// reset the seen set at peer to prepare for sync (and retransmissions)
 	peer.ResetSeen()
@@ -367,47 +1142,143 @@ func (d *dlt) toWalkUpStage(shardId []byte, shardParent [64]byte, peer p2p.Peer)
 }
 
 // listen on events for a specific peer connection
+func (d *dlt) handleRECV_NewTxBlockMsg(peer p2p.Peer, events chan controllerEvent, tx dto.Transaction) error {
+	// peer has observed the transaction, and transactions it is anchored over
+	d.latencyObserved(tx.Id())
+	d.latencyObservedAnchor(tx.Anchor())
+	// relay transactions of shards that node does not store, without processing
+	if !d.isStored(tx.Request().ShardId) {
+		id := tx.Id()
+		peer.Seen(id[:])
+		peer.Logger().Debug("Relaying transaction of filtered shard: %x", id)
+		if err := d.broadcastTx(tx); err != nil {
+			d.logger.Error("Failed to broadcast message: %s", err)
+		}
+		return nil
+	}
+	// check if transaction's parent is known
+	if d.db.GetTx(tx.Anchor().ShardParent) != nil {
+		// parent is known, so process normally
+		if err := d.handleTransaction(peer, events, tx, false); err != nil {
+			peer.Logger().Debug("Failed to handle network transaction: %s", err)
+			// TBD: should we disconnect from peer?
+			// let the handler decide based on error type
+		}
+		return nil
+	}
+	// parent is unknown, so initiate sync with peer
+	peer.Logger().Debug("Shard parent unknown for transaction: %x", tx.Id())
+	return d.toWalkUpStage(tx.Request().ShardId, tx.Anchor().ShardParent, peer)
+}
+
+// events emitted by shard jobs of a peer, queued for peer's event listener without blocking the job, since
+// the listener is the only reader of peer's events and may itself be waiting for space in a job's shard queue
+type jobEvents struct {
+	events []controllerEvent
+	ready  chan struct{}
+	lock   sync.Mutex
+}
+
+func newJobEvents() *jobEvents {
+	return &jobEvents{ready: make(chan struct{}, 1)}
+}
+
+func (q *jobEvents) push(e controllerEvent) {
+	q.lock.Lock()
+	q.events = append(q.events, e)
+	q.lock.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (q *jobEvents) pop() (controllerEvent, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if len(q.events) == 0 {
+		return controllerEvent{}, false
+	}
+	e := q.events[0]
+	q.events = q.events[1:]
+	return e, true
+}
+
 func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
+	defer d.recoverCrash()
 	// fmt.Printf("Entering event listener...\n")
+	// track transactions queued for shard processing from this peer, and events emitted by them
+	jobs := sync.WaitGroup{}
+	followUps := newJobEvents()
 	done := false
 	for !done {
-		e := <-events
-		d.lock.Lock()
-		d.logger.Debug("peerEventsListener: locked DLT stack")
-		switch e.code {
-		case RECV_NewTxBlockMsg:
-			// check if transaction's parent is known
-			if tx := e.data.(dto.Transaction); d.db.GetTx(tx.Anchor().ShardParent) != nil {
-				// parent is known, so process normally
-				if err := d.handleTransaction(peer, events, tx, false); err != nil {
-					peer.Logger().Debug("Failed to handle network transaction: %s", err)
-					// TBD: should we disconnect from peer?
-					// let the handler decide based on error type
-					break
-				}
-			} else {
-				// parent is unknown, so initiate sync with peer
-				peer.Logger().Debug("Shard parent unknown for transaction: %x", tx.Id())
-				if err := d.toWalkUpStage(tx.Request().ShardId, tx.Anchor().ShardParent, peer); err != nil {
+		e, found := followUps.pop()
+		if !found {
+			select {
+			case e = <-events:
+			case <-followUps.ready:
+				continue
+			}
+		}
+		if e.code == RECV_NewTxBlockMsg {
+			// process transaction on its shard's queue, so that a slow shard does not hold up other shards,
+			// submitted without stack's lock since submission waits while shard's queue is full
+			tx := e.data.(dto.Transaction)
+			jobs.Add(1)
+			d.executor.submit(tx.Request().ShardId, d.guarded(func() {
+				defer jobs.Done()
+				// shared lock, so that jobs of different shards run concurrently, and are serialized only
+				// with exclusive operations of the stack
+				d.lock.RLock()
+				defer d.lock.RUnlock()
+				// handler emits at most one event (double spend alert), which is sent on peer's events only
+				// if there is space, and queued for listener otherwise
+				out := make(chan controllerEvent, 1)
+				if err := d.handleRECV_NewTxBlockMsg(peer, out, tx); err != nil {
 					peer.Logger().Debug("Failed to transition to WalkUpStage: %s", err)
 					peer.Disconnect()
-					done = true
 				}
-			}
-
+				select {
+				case e := <-out:
+					select {
+					case events <- e:
+					default:
+						followUps.push(e)
+					}
+				default:
+				}
+			}))
+			continue
+		}
+		d.lock.Lock()
+		d.logger.Debug("peerEventsListener: locked DLT stack")
+		switch e.code {
 		case RECV_ShardSyncMsg:
 			msg := e.data.(*ShardSyncMsg)
+			d.latencyObservedAnchor(msg.Anchor)
 
 			// compare local anchor with remote anchor,
 			// fetch anchor only for remote peer's shard,
 			// since our local shard maybe different, but we may have more recent data
 			// due to network updates from other nodes,
 			// or if local sharder knows nothing about remot shard (sync anchor will be nil)
+			if !d.isStored(msg.ShardId) {
+				// node does not store the shard, so nothing to sync
+				peer.SetState(int(RECV_ShardAncestorResponseMsg), nil)
+				peer.Logger().Debug("Skipping sync of filtered shard: %x", msg.ShardId)
+				d.endSync(peer)
+				break
+			}
 			myAnchor := d.sharder.SyncAnchor(msg.ShardId)
 
-			if myAnchor == nil || msg.Anchor.Weight > myAnchor.Weight ||
+			behind := myAnchor == nil || msg.Anchor.Weight > myAnchor.Weight ||
 				(msg.Anchor.Weight == myAnchor.Weight &&
-					shard.Numeric(msg.Anchor.ShardParent[:]) > shard.Numeric(myAnchor.ShardParent[:])) {
+					shard.Numeric(msg.Anchor.ShardParent[:]) > shard.Numeric(myAnchor.ShardParent[:]))
+
+			if behind && !d.admitSyncSource(peer, msg.ShardId, msg.Anchor) {
+				// local shard's anchor is behind, but shard is being synced from better ranked peers
+				peer.SetState(int(RECV_ShardAncestorResponseMsg), nil)
+			} else if behind {
 				// local shard's anchor is behind, initiate sync with remote by walking up the DAG
 				req := &ShardAncestorRequestMsg{
 					StartHash:    msg.Anchor.ShardParent,
@@ -416,13 +1287,19 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 				peer.Logger().Debug("Initiating shard sync starting by ancestors request for: %x", msg.Anchor.ShardParent)
 				// save the last hash into peer's state to validate ancestors response
 				peer.SetState(int(RECV_ShardAncestorResponseMsg), req.StartHash)
+				// track progress of sync with peer
+				d.startSync(peer, msg.ShardId, myAnchor, msg.Anchor)
 				// send the ancestors request to peer
+				d.syncPeers.requested(peer.String())
 				peer.Send(req.Id(), req.Code(), req)
 			} else {
 				// explicitely set state to NOT expect any ancestor response
 				peer.SetState(int(RECV_ShardAncestorResponseMsg), nil)
 				peer.Logger().Debug("End of sync with peer: %s", peer.String())
+				d.endSync(peer)
 			}
+			// a peer carrying a shard being joined has responded, after sync with it was initiated (if behind)
+			d.joins.respond(msg.ShardId)
 
 		case RECV_ShardAncestorRequestMsg:
 			msg := e.data.(*ShardAncestorRequestMsg)
@@ -445,7 +1322,11 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 			// fetch state from peer to validate response's starting hash
 			if state := peer.GetState(int(RECV_ShardAncestorResponseMsg)); state != msg.StartHash {
 				peer.Logger().Debug("start hash of ShardAncestorResponseMsg does not match saved state")
+				d.syncPeers.responded(peer.String(), false)
 			} else {
+				d.syncPeers.responded(peer.String(), true)
+				// keep response to verify its consistency with shard DAG once shard is synced
+				d.syncPeers.ancestors(peer.String(), msg.StartHash, msg.Ancestors)
 				// walk through each ancestor to check if it's known common ancestor
 				found, i := false, 0
 				for ; !found && i < len(msg.Ancestors); i++ {
@@ -462,6 +1343,7 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 					peer.SetState(int(RECV_ShardAncestorResponseMsg), req.StartHash)
 					peer.Logger().Debug("no common ancestor found, continue walk up from: %x", req.StartHash)
 					// send the ancestors request to peer
+					d.syncPeers.requested(peer.String())
 					peer.Send(req.Id(), req.Code(), req)
 				} else if found {
 					peer.Logger().Debug("Found a known common ancestor: %x", msg.Ancestors[i-1])
@@ -477,6 +1359,7 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 					req := &ShardChildrenRequestMsg{
 						Parent: msg.Ancestors[i-1],
 					}
+					d.syncPeers.requested(peer.String())
 					peer.Send(req.Id(), req.Code(), req)
 
 				}
@@ -500,7 +1383,9 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 			// fetch state from peer to validate response's starting hash
 			if state := peer.GetState(int(RECV_ShardChildrenResponseMsg)); state != msg.Parent {
 				peer.Logger().Debug("start hash of ShardChildrenResponseMsg does not match saved state")
+				d.syncPeers.responded(peer.String(), false)
 			} else {
+				d.syncPeers.responded(peer.String(), true)
 				// walk through each child to check if it's unknown, then add to child queue
 				for _, child := range msg.Children {
 					if d.db.GetShardDagNode(child) == nil {
@@ -523,6 +1408,18 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 			if child, err := peer.ShardChildrenQ().Pop(); err != nil {
 				peer.Logger().Debug("Did not fetch child from shard children queue: %s", err)
 				// EndOfSync
+				d.endSync(peer)
+			} else if !d.syncPeers.claim(child.([64]byte), peer.String()) {
+				// child (and its descendants) is being fetched from another sync source, pop a new child
+				peer.Logger().Debug("Skipping child claimed by another sync source: %x", child)
+				events <- newControllerEvent(POP_ShardChild, nil)
+			} else if d.policies.ShardSyncBatchSize > 1 {
+				// fetch child transaction along with a batch of its descendants from peer's shard DAG
+				if err := d.requestTxShardBatch(peer, child.([64]byte)); err != nil {
+					peer.Logger().Debug("Failed to send request: %s", err)
+					// pop a new child
+					events <- newControllerEvent(POP_ShardChild, nil)
+				}
 			} else {
 				// send the request to fetch child transaction and its children from peer's shard DAG
 				req := &TxShardChildRequestMsg{
@@ -531,6 +1428,7 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 				// update the RECV_ShardChildrenResponseMsg state to null value, to prevent any repeated/cyclic DoS attack
 				peer.SetState(int(RECV_TxShardChildResponseMsg), req.Hash)
 				peer.Logger().Debug("Requesting transaction and shard DAG children for: %x", req.Hash)
+				d.syncPeers.requested(peer.String())
 				if err := peer.Send(req.Id(), req.Code(), req); err != nil {
 					peer.Logger().Debug("Failed to send request: %s", err)
 					// pop a new child
@@ -550,7 +1448,7 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 			} else {
 				// fetch children for this transaction from shard DAG
 				children := d.sharder.Children(msg.Hash)
-				req := NewTxShardChildResponseMsg(tx, children)
+				req := NewTxShardChildResponseMsg(tx, children, d.codec)
 				if req == nil {
 					d.logger.Debug("Failed to serialize transaction: %x", tx.Id())
 				} else {
@@ -567,8 +1465,9 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 			d.logger.Debug("#####################################################")
 			d.logger.Debug("// TBD: need to change dto.Transaction from interface to concrete type, so that p2p layer can provide rlp decoded transaction")
 			d.logger.Debug("#####################################################")
-			if err := tx.DeSerialize(msg.Bytes); err != nil {
+			if err := d.codec.Unmarshal(msg.Bytes, tx); err != nil {
 				peer.Logger().Debug("Failed to decode message: %s", err)
+				d.syncPeers.responded(peer.String(), false)
 				// EndOfSync
 				// TBD: or should we pop next child?
 				break
@@ -581,14 +1480,18 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 				// validate signatures
 				if err := d.validateSignatures(tx); err != nil {
 					peer.Logger().Debug("TxShardChildResponseMsg transaction failed signature verification: %s", err)
+					d.syncPeers.responded(peer.String(), false)
 					break
 				}
+				d.syncPeers.responded(peer.String(), true)
 
 				// mark the transaction as seen by stack
 				d.isSeen(tx.Id())
 
 				// handle transaction for each layer
 				if err := d.handleTransaction(peer, events, tx, true); err == nil {
+					// update sync progress, local shard's depth is now past this transaction
+					d.syncs.fetched(tx.Request().ShardId, tx.Anchor().ShardSeq+1)
 					// walk through each child to check if it's unknown, then add to child queue
 					for _, child := range msg.Children {
 						if err := peer.ShardChildrenQ().Push(child); err != nil {
@@ -606,6 +1509,18 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 				events <- newControllerEvent(POP_ShardChild, nil)
 			}
 
+		case RECV_TxShardBatchRequestMsg:
+			if err := d.handleRECV_TxShardBatchRequestMsg(peer, e.data.(*TxShardBatchRequestMsg)); err != nil {
+				peer.Logger().Error("Failed to handle TxShardBatchRequestMsg: %s", err)
+				// this is an error condition, terminate connection with peer
+				peer.Disconnect()
+			}
+
+		case RECV_TxShardBatchResponseMsg:
+			if err := d.handleRECV_TxShardBatchResponseMsg(peer, events, e.data.(*TxShardBatchResponseMsg)); err != nil {
+				peer.Logger().Debug("Failed to handle TxShardBatchResponseMsg: %s", err)
+			}
+
 		case RECV_ForceShardSyncMsg:
 			if err := d.handleRECV_ForceShardSyncMsg(peer, e.data.(*ForceShardSyncMsg)); err != nil {
 				peer.Logger().Debug("Failed to handle ForceShardSyncMsg: %s", err)
@@ -654,6 +1569,30 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 				break
 			}
 
+		case RECV_TxRejectMsg:
+			if err := d.handleRECV_TxRejectMsg(peer, e.data.(*TxRejectMsg)); err != nil {
+				peer.Logger().Debug("Failed to handle RECV_TxRejectMsg: %s", err)
+			}
+
+		case RECV_NodeVersionMsg:
+			d.handleRECV_NodeVersionMsg(peer, e.data.(*NodeVersionMsg))
+
+		case RECV_ShardSubscriptionMsg:
+			d.handleRECV_ShardSubscriptionMsg(peer, e.data.(*ShardSubscriptionMsg))
+
+		case RECV_TxAckMsg:
+			d.handleRECV_TxAckMsg(peer, e.data.(*TxAckMsg))
+
+		case RECV_ShardTipsRequestMsg:
+			if err := d.handleRECV_ShardTipsRequestMsg(peer, e.data.(*ShardTipsRequestMsg)); err != nil {
+				peer.Logger().Debug("Failed to handle RECV_ShardTipsRequestMsg: %s", err)
+			}
+
+		case RECV_ShardTipsSketchMsg:
+			if err := d.handleRECV_ShardTipsSketchMsg(peer, e.data.(*ShardTipsSketchMsg)); err != nil {
+				peer.Logger().Debug("Failed to handle RECV_ShardTipsSketchMsg: %s", err)
+			}
+
 		case RECV_ForceShardFlushMsg:
 			if err := d.handleRECV_ForceShardFlushMsg(peer, events, e.data.(*ForceShardFlushMsg)); err != nil {
 				peer.Logger().Debug("Failed to handle RECV_ForceShardFlushMsg: %s", err)
@@ -673,6 +1612,8 @@ func (d *dlt) peerEventsListener(peer p2p.Peer, events chan controllerEvent) {
 		d.logger.Debug("peerEventsListener: unlocked DLT stack")
 		d.lock.Unlock()
 	}
+	// wait for queued transactions from this peer to finish
+	jobs.Wait()
 	peer.Logger().Info("Exiting event listener...")
 }
 
@@ -693,9 +1634,14 @@ func (d *dlt) handleRECV_ForceShardSyncMsg(peer p2p.Peer, msg *ForceShardSyncMsg
 	myAnchor := d.sharder.SyncAnchor(msg.ShardId)
 	d.p2p.Anchor(myAnchor)
 
-	if myAnchor == nil || msg.Anchor.Weight > myAnchor.Weight ||
+	behind := myAnchor == nil || msg.Anchor.Weight > myAnchor.Weight ||
 		(msg.Anchor.Weight == myAnchor.Weight &&
-			shard.Numeric(msg.Anchor.ShardParent[:]) > shard.Numeric(myAnchor.ShardParent[:])) {
+			shard.Numeric(msg.Anchor.ShardParent[:]) > shard.Numeric(myAnchor.ShardParent[:]))
+
+	if behind && !d.admitSyncSource(peer, msg.ShardId, msg.Anchor) {
+		// local shard's anchor is behind, but shard is being synced from better ranked peers
+		peer.SetState(int(RECV_ShardAncestorResponseMsg), nil)
+	} else if behind {
 		// local shard's anchor is behind, initiate sync with remote by walking up the DAG
 		req := &ShardAncestorRequestMsg{
 			StartHash:    msg.Anchor.ShardParent,
@@ -704,7 +1650,10 @@ func (d *dlt) handleRECV_ForceShardSyncMsg(peer p2p.Peer, msg *ForceShardSyncMsg
 		peer.Logger().Debug("Initiating shard sync starting by ancestors request for: %x", msg.Anchor.ShardParent)
 		// save the last hash into peer's state to validate ancestors response
 		peer.SetState(int(RECV_ShardAncestorResponseMsg), req.StartHash)
+		// track progress of sync with peer
+		d.startSync(peer, msg.ShardId, myAnchor, msg.Anchor)
 		// send the ancestors request to peer
+		d.syncPeers.requested(peer.String())
 		peer.Send(req.Id(), req.Code(), req)
 	} else if myAnchor != nil && (myAnchor.Weight > msg.Anchor.Weight ||
 		(myAnchor.Weight == msg.Anchor.Weight && shard.Numeric(myAnchor.ShardParent[:]) > shard.Numeric(msg.Anchor.ShardParent[:]))) {
@@ -714,6 +1663,7 @@ func (d *dlt) handleRECV_ForceShardSyncMsg(peer p2p.Peer, msg *ForceShardSyncMsg
 		peer.Send(msg.Id(), msg.Code(), msg)
 	} else {
 		peer.Logger().Debug("Shard in sync with peer: %s", peer.String())
+		d.endSync(peer)
 	}
 	return nil
 }
@@ -822,7 +1772,7 @@ func (d *dlt) handleRECV_SubmitterProcessDownRequestMsg(peer p2p.Peer, events ch
 		txs = append(txs, d.db.GetTx(id))
 	}
 	// build the response
-	if resp := NewSubmitterProcessDownResponseMsg(msg, txs); resp != nil {
+	if resp := NewSubmitterProcessDownResponseMsg(msg, txs, d.codec); resp != nil {
 		peer.Logger().Debug("responding with %d transactions for: %x / %d", len(resp.TxBytes), resp.Submitter, resp.Seq)
 		peer.Send(resp.Id(), resp.Code(), resp)
 	} else {
@@ -849,7 +1799,7 @@ func (d *dlt) handleRECV_SubmitterProcessDownResponseMsg(peer p2p.Peer, events c
 		d.logger.Debug("// TBD: need to change dto.Transaction from interface to concrete type, so that p2p layer can provide rlp decoded transaction")
 		d.logger.Debug("#####################################################")
 		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
-		if err := tx.DeSerialize(bytes); err != nil {
+		if err := d.codec.Unmarshal(bytes, tx); err != nil {
 			peer.Logger().Error("Failed to decode transaction from SubmitterProcessDownResponseMsg: %s", err)
 			return err
 		}
@@ -928,9 +1878,7 @@ func (d *dlt) handleALERT_DoubleSpend(peer p2p.Peer, events chan controllerEvent
 	peer.Logger().Error("Local Double Spending Tx: %x\nRemote Double Spending Tx: %x", localTx.Id(), remoteTx.Id())
 	// compare local with remote
 	// first compare weights, if equal then compare numeric hash
-	if localId, remoteId := localTx.Id(), remoteTx.Id(); localTx.Anchor().Weight > remoteTx.Anchor().Weight ||
-		(localTx.Anchor().Weight == remoteTx.Anchor().Weight &&
-			shard.Numeric(localId[:]) > shard.Numeric(remoteId[:])) {
+	if !shard.Wins(localTx, remoteTx) {
 		// we should replace the local submitter history to use the winning transaction
 		// so that don't get into loop when sync and remote sends the winning transaction
 		// but local history still has old transaction
@@ -938,10 +1886,11 @@ func (d *dlt) handleALERT_DoubleSpend(peer p2p.Peer, events chan controllerEvent
 			peer.Logger().Error("Failed to update local submitter history: %s", err)
 			return err
 		}
-		if err := d.sharder.Flush(remoteTx.Request().ShardId); err != nil {
+		resolution, err := d.rollback(peer, localTx, remoteTx)
+		if err != nil {
 			return err
 		} else {
-			peer.Logger().Debug("flushed local shard")
+			peer.Logger().Debug("resolved local shard: %s", resolution)
 			// initiate a force shard sync for the flushed shard with peer
 			// we need to force the shard sync because if peer is headless
 			// then regular handshake will not result in sync
@@ -951,11 +1900,13 @@ func (d *dlt) handleALERT_DoubleSpend(peer p2p.Peer, events chan controllerEvent
 			peer.Logger().Debug("sending ForceShardSync: %x", msg.Id())
 			peer.Send(msg.Id(), msg.Code(), msg)
 		}
+		d.recordDoubleSpend(peer, localTx, remoteTx, resolution)
 	} else {
 		// send peer alert to flush
-		msg := NewForceShardFlushMsg(localTx)
+		msg := NewForceShardFlushMsg(localTx, d.codec)
 		peer.Logger().Debug("Alerting remote peer to flush and re-sync")
 		peer.Send(msg.Id(), msg.Code(), msg)
+		d.recordDoubleSpend(peer, localTx, remoteTx, RESOLUTION_PEER_FLUSH)
 	}
 	return nil
 }
@@ -973,7 +1924,7 @@ func (d *dlt) handleRECV_ForceShardFlushMsg(peer p2p.Peer, events chan controlle
 	d.logger.Debug("// TBD: need to change dto.Transaction from interface to concrete type, so that p2p layer can provide rlp decoded transaction")
 	d.logger.Debug("#####################################################")
 	remoteTx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
-	if err := remoteTx.DeSerialize(msg.Bytes); err != nil {
+	if err := d.codec.Unmarshal(msg.Bytes, remoteTx); err != nil {
 		peer.Logger().Debug("Failed to decode remote message: %s", err)
 		return err
 	}
@@ -996,15 +1947,14 @@ func (d *dlt) handleRECV_ForceShardFlushMsg(peer p2p.Peer, events chan controlle
 	}
 	// compare local with remote
 	// first compare weights, if equal then compare numeric hash
-	if localId, remoteId := localTx.Id(), remoteTx.Id(); localTx.Anchor().Weight > remoteTx.Anchor().Weight ||
-		(localTx.Anchor().Weight == remoteTx.Anchor().Weight &&
-			shard.Numeric(localId[:]) > shard.Numeric(remoteId[:])) {
-		if err := d.sharder.Flush(remoteTx.Request().ShardId); err != nil {
+	if !shard.Wins(localTx, remoteTx) {
+		resolution, err := d.rollback(peer, localTx, remoteTx)
+		if err != nil {
 			return err
 		} else {
 			// reset the seen set at peer to prepare for sync (and retransmissions)
 			peer.ResetSeen()
-			peer.Logger().Debug("flushed local shard and reset seen set")
+			peer.Logger().Debug("resolved local shard (%s) and reset seen set", resolution)
 			// initiate a force shard sync for the flushed shard with peer
 			// we need to force the shard sync because if peer is headless
 			// then regular handshake will not result in sync
@@ -1014,6 +1964,7 @@ func (d *dlt) handleRECV_ForceShardFlushMsg(peer p2p.Peer, events chan controlle
 			peer.Logger().Debug("sending ForceShardSync: %x", msg.Id())
 			peer.Send(msg.Id(), msg.Code(), msg)
 		}
+		d.recordDoubleSpend(peer, localTx, remoteTx, resolution)
 	} else {
 		// we received incorrect request, disconnect
 		return errors.New("incorred request to flush shard")
@@ -1023,12 +1974,32 @@ func (d *dlt) handleRECV_ForceShardFlushMsg(peer p2p.Peer, events chan controlle
 
 // listen on messages from the peer node
 func (d *dlt) listener(peer p2p.Peer, events chan controllerEvent) error {
+	// network transactions are validated in parallel, outside of stack's lock
+	txs := d.newTxPipeline(peer, events)
+	defer txs.close()
 	for {
 		msg, err := peer.ReadMsg()
 		if err != nil {
 			peer.Logger().Debug("Failed to read message: %s", err)
 			return err
 		}
+		if msg.Code() == TransactionMsgCode {
+			// deserialize the transaction message from payload
+			tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+			if err := msg.Decode(tx); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				return err
+			}
+			// submit for validation, pipeline emits the transaction once validated
+			if err := txs.submit(tx); err != nil {
+				return err
+			}
+			continue
+		}
+		// process any other message only after all earlier transactions from peer
+		if err := txs.flush(); err != nil {
+			return err
+		}
 		d.lock.Lock()
 		d.logger.Debug("listener: locked DLT stack for message code: %d", msg.Code())
 		switch msg.Code() {
@@ -1040,34 +2011,6 @@ func (d *dlt) listener(peer p2p.Peer, events chan controllerEvent) error {
 			d.lock.Unlock()
 			return nil
 
-		case TransactionMsgCode:
-			// deserialize the transaction message from payload
-			tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
-			if err := msg.Decode(tx); err != nil {
-				d.logger.Debug("Failed to decode message: %s", err)
-				d.logger.Debug("listener: unlocked DLT stack")
-				d.lock.Unlock()
-				return err
-			}
-
-			// validate signatures
-			if err := d.validateSignatures(tx); err != nil {
-				peer.Logger().Debug("Network transaction failed signature verification: %s", err)
-				d.logger.Debug("listener: unlocked DLT stack")
-				d.lock.Unlock()
-				return err
-			}
-
-			// check if message was already seen by stack
-			if d.isSeen(tx.Id()) {
-				d.logger.Debug("listener: unlocked DLT stack")
-				d.lock.Unlock()
-				continue
-			} else {
-				// emit a RECV_NewTxBlockMsg event
-				events <- newControllerEvent(RECV_NewTxBlockMsg, tx)
-			}
-
 		case ShardSyncMsgCode:
 			// deserialize the shard sync message from payload
 			m := &ShardSyncMsg{}
@@ -1237,6 +2180,110 @@ func (d *dlt) listener(peer p2p.Peer, events chan controllerEvent) error {
 				events <- newControllerEvent(RECV_ForceShardFlushMsg, m)
 			}
 
+		case TxRejectMsgCode:
+			// deserialize the transaction rejection message from payload
+			m := &TxRejectMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_TxRejectMsg event
+				events <- newControllerEvent(RECV_TxRejectMsg, m)
+			}
+
+		case NodeVersionMsgCode:
+			// deserialize the node version message from payload
+			m := &NodeVersionMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_NodeVersionMsg event
+				events <- newControllerEvent(RECV_NodeVersionMsg, m)
+			}
+
+		case ShardTipsRequestMsgCode:
+			// deserialize the shard tips request message from payload
+			m := &ShardTipsRequestMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_ShardTipsRequestMsg event
+				events <- newControllerEvent(RECV_ShardTipsRequestMsg, m)
+			}
+
+		case ShardTipsSketchMsgCode:
+			// deserialize the shard tips sketch message from payload
+			m := &ShardTipsSketchMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_ShardTipsSketchMsg event
+				events <- newControllerEvent(RECV_ShardTipsSketchMsg, m)
+			}
+
+		case TxShardBatchRequestMsgCode:
+			// deserialize the transaction batch request message from payload
+			m := &TxShardBatchRequestMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_TxShardBatchRequestMsg event
+				events <- newControllerEvent(RECV_TxShardBatchRequestMsg, m)
+			}
+
+		case TxShardBatchResponseMsgCode:
+			// deserialize the transaction batch response message from payload
+			m := &TxShardBatchResponseMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_TxShardBatchResponseMsg event
+				events <- newControllerEvent(RECV_TxShardBatchResponseMsg, m)
+			}
+
+		case ShardSubscriptionMsgCode:
+			// deserialize the shard subscription message from payload
+			m := &ShardSubscriptionMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_ShardSubscriptionMsg event
+				events <- newControllerEvent(RECV_ShardSubscriptionMsg, m)
+			}
+
+		case TxAckMsgCode:
+			// deserialize the transaction acknowledgement message from payload
+			m := &TxAckMsg{}
+			if err := msg.Decode(m); err != nil {
+				d.logger.Debug("Failed to decode message: %s", err)
+				d.logger.Debug("listener: unlocked DLT stack")
+				d.lock.Unlock()
+				return err
+			} else {
+				// emit a RECV_TxAckMsg event
+				events <- newControllerEvent(RECV_TxAckMsg, m)
+			}
+
 		// case 1 message type
 
 		// case 2 message type
@@ -1256,6 +2303,7 @@ func (d *dlt) listener(peer p2p.Peer, events chan controllerEvent) error {
 
 // handle a new peer node connection from p2p layer
 func (d *dlt) runner(peer p2p.Peer) error {
+	defer d.recoverCrash()
 	localAddr, remoteAddr := d.conf.ListenAddr, "unknown"
 	if peer.LocalAddr() != nil {
 		localAddr = peer.LocalAddr().String()
@@ -1271,8 +2319,14 @@ func (d *dlt) runner(peer p2p.Peer) error {
 		peer.Logger().Error("Hanshake failed: %s", err)
 		return err
 	} else {
+		d.stats.peerConnected()
 		defer func() {
 			peer.Logger().Info("Disconnecting with remote node: %s", peer.Name())
+			d.stats.peerDisconnected()
+			d.peerVersions.remove(peer.ID())
+			d.peerSubscriptions.remove(peer.ID())
+			d.endSync(peer)
+			d.syncPeers.remove(peer.String())
 			// TODO: perform any cleanup here upon exit
 		}()
 	}
@@ -1306,38 +2360,147 @@ func (d *dlt) isSeen(msgId [64]byte) bool {
 	}
 }
 
-func NewDltStack(conf p2p.Config, dbp db.DbProvider) (*dlt, error) {
+// persist the messages seen by stack, so that they are not processed again after a restart
+func (d *dlt) saveSeen() {
+	ids := make([][64]byte, 0, d.seen.Size())
+	for _, item := range d.seen.Items() {
+		if id, ok := item.([64]byte); ok {
+			ids = append(ids, id)
+		}
+	}
+	if err := d.seenCache.Save(ids); err != nil {
+		d.logger.Error("Failed to persist seen messages: %s", err)
+	}
+}
+
+// restore the messages seen by stack before a restart, a corrupt cache is ignored
+func (d *dlt) loadSeen() {
+	if ids, err := d.seenCache.Load(); err != nil {
+		d.logger.Error("Failed to load seen messages: %s", err)
+	} else {
+		for _, id := range ids {
+			d.seen.Add(id)
+		}
+		d.logger.Debug("Loaded %d seen messages", len(ids))
+	}
+}
+
+// decode a trusted checkpoint from its config
+func parseCheckpoint(c p2p.Checkpoint) (*shard.Checkpoint, error) {
+	cp := &shard.Checkpoint{
+		Seq: c.ShardSeq,
+	}
+	if cp.ShardId, _ = hex.DecodeString(c.ShardId); len(cp.ShardId) == 0 {
+		return nil, errors.New("invalid shard_id for checkpoint")
+	}
+	if bytes, _ := hex.DecodeString(c.TxId); len(bytes) != 64 {
+		return nil, errors.New("invalid tx_id for checkpoint")
+	} else {
+		copy(cp.TxId[:], bytes)
+	}
+	if len(c.StateRoot) > 0 {
+		if bytes, _ := hex.DecodeString(c.StateRoot); len(bytes) != 64 {
+			return nil, errors.New("invalid state_root for checkpoint")
+		} else {
+			copy(cp.StateRoot[:], bytes)
+		}
+	}
+	return cp, nil
+}
+
+// create a DLT stack instance composed from options, e.g.
+//
+//	NewDltStack(WithConfig(conf), WithStorage(dbp))
+func NewDltStack(opts ...Option) (*dlt, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	conf, dbp := *o.conf, o.dbp
+	codec, err := common.CodecByName(conf.Codec)
+	if err != nil {
+		return nil, err
+	}
 	var db repo.DltDb
-	var err error
 	if db, err = repo.NewDltDb(dbp); err != nil {
 		return nil, err
 	}
+	if err = db.SetCompression(o.policies.TxCompression); err != nil {
+		return nil, err
+	}
+	counters, err := repo.NewCounters(dbp)
+	if err != nil {
+		return nil, err
+	}
 	stack := &dlt{
-		db:     db,
-		dbp: dbp,
-		seen:   common.NewSet(),
-		logger: log.NewLogger(conf.Name),
-		conf:   &conf,
+		db:       db,
+		dbp:      dbp,
+		seen:     common.NewSet(),
+		seenCache: repo.NewSeenCache(dbp),
+		labels:    repo.NewLabelStore(dbp),
+		receipts:  repo.NewReceiptStore(dbp),
+		recent:    newRecentTxs(CrashDumpTxCount),
+		crashDumpDir: o.crashDumpDir,
+		submitterLocks: newKeyedLocks(),
+		paused:   make(map[string]bool),
+		executor: newWeightedShardExecutor(o.policies.ShardQueueSize, o.policies.ShardWorkers, o.policies.ShardWeights),
+		validators: newValidationPool(o.policies.TxValidationWorkers),
+		subs:     newSubscriptions(),
+		watches:  newWatches(),
+		counters: counters,
+		stats:    newRuntimeStats(o.metrics),
+		metrics:  o.metrics,
+		latency:  newLatencyTracker(),
+		syncs:    newSyncTracker(),
+		joins:    newShardJoins(),
+		collected: newCollectedShards(),
+		syncPeers: newSyncPeers(),
+		peerVersions: newPeerVersions(),
+		peerSubscriptions: newPeerSubscriptions(),
+		codec:    codec,
+		policies: o.policies,
+		filter:   o.filter,
+		logger:   o.logger,
+		conf:     &conf,
 	}
 	// update p2p.Config with protocol name, version and message count based on protocol specs
 	conf.ProtocolName = ProtocolName
 	conf.ProtocolVersion = ProtocolVersion
 	conf.ProtocolLength = ProtocolLength
-	if p2p, err := p2p.NewDEVp2pLayer(conf, stack.runner); err == nil {
+	if p2p, err := o.p2p(conf, stack.runner); err == nil {
 		stack.p2p = p2p
 	} else {
 		return nil, err
 	}
-	if endorser, err := endorsement.NewEndorser(db); err == nil {
+	if endorser, err := o.endorser(db); err == nil {
 		stack.endorser = endorser
+		stack.endorser.SetRateLimits(
+			&endorsement.RateLimit{Rate: o.policies.SubmitterTxRate, Burst: o.policies.SubmitterTxBurst},
+			&endorsement.RateLimit{Rate: o.policies.SubmitterNetworkTxRate, Burst: o.policies.SubmitterTxBurst})
 	} else {
 		return nil, err
 	}
-	if sharder, err := shard.NewSharder(db, dbp); err == nil {
+	if sharder, err := o.sharder(db, dbp); err == nil {
 		stack.sharder = sharder
 	} else {
 		return nil, err
 	}
+	stack.loadSeen()
+	stack.sharder.SetMaxUncles(o.policies.anchorUncles())
+	stack.sharder.SetMaxValueSize(o.policies.MaxResourceSize)
+	for _, c := range conf.Checkpoints {
+		if cp, err := parseCheckpoint(c); err != nil {
+			return nil, err
+		} else if err := stack.sharder.SetCheckpoint(cp); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range conf.Retention {
+		if policy, err := parseRetention(c); err != nil {
+			return nil, err
+		} else if err := stack.sharder.SetRetention(policy); err != nil {
+			return nil, err
+		}
+	}
 	return stack, nil
-
 }
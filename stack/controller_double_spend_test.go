@@ -2,10 +2,12 @@
 package stack
 
 import (
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/p2p"
 	"testing"
 	"github.com/trust-net/dag-lib-go/log"
+	"time"
 )
 
 // test stack controller event listener handles ALERT_DoubleSpend correctly
@@ -83,6 +85,13 @@ func TestRECV_ALERT_DoubleSpend_LocalWinner(t *testing.T) {
 	if peer.DisconnectCalled {
 		t.Errorf("we should not disconnect peer for double spending alert")
 	}
+
+	// we should record forensic evidence of double spend
+	if records := local.Forensics(); len(records) != 1 {
+		t.Errorf("Incorrect number of forensic records: %d", len(records))
+	} else if records[0].Resolution != RESOLUTION_PEER_FLUSH || records[0].Winner != localTx.Id() {
+		t.Errorf("Incorrect forensic record: %s / %x", records[0].Resolution, records[0].Winner)
+	}
 }
 
 // test stack controller event listener handles ALERT_DoubleSpend correctly
@@ -105,7 +114,8 @@ func TestRECV_ALERT_DoubleSpend_RemoteWinner(t *testing.T) {
 	// add some weight to local stack
 	local.Submit(dto.TestSubmitter().NewRequest("request from another submitter"))
 	// now add the double spending transaction to local stack, which should be later in sequence/weight
-	if _, err = local.Submit(submitter.NewRequest("spend same $10 again")); err != nil {
+	var localTx dto.Transaction
+	if localTx, err = local.Submit(submitter.NewRequest("spend same $10 again")); err != nil {
 		t.Errorf("Failed to submit local transaction: %s", err)
 	}
 	p2pLayer.Reset()
@@ -140,9 +150,11 @@ func TestRECV_ALERT_DoubleSpend_RemoteWinner(t *testing.T) {
 		t.Errorf("Endorser did not get called for submitter/seq history")
 	}
 
-	// we should flush the local shard
-	if !sharder.FlushCalled {
-		t.Errorf("shard flush did not get called when remote transaction wins")
+	// we should roll back the local transaction, instead of flushing the local shard
+	if !sharder.ResolveCalled || sharder.FlushCalled {
+		t.Errorf("local transaction not rolled back when remote transaction wins")
+	} else if local.db.GetShardDagNode(localTx.Id()) != nil {
+		t.Errorf("local transaction not removed from shard DAG")
 	}
 
 	// we should send force shard sync message to peer
@@ -154,6 +166,13 @@ func TestRECV_ALERT_DoubleSpend_RemoteWinner(t *testing.T) {
 	if peer.DisconnectCalled {
 		t.Errorf("we should not disconnect peer for double spending alert")
 	}
+
+	// we should record forensic evidence of double spend
+	if records := local.Forensics(); len(records) != 1 {
+		t.Errorf("Incorrect number of forensic records: %d", len(records))
+	} else if records[0].Resolution != RESOLUTION_LOCAL_ROLLBACK || records[0].Winner != remoteTx.Id() {
+		t.Errorf("Incorrect forensic record: %s / %x", records[0].Resolution, records[0].Winner)
+	}
 }
 
 // stack controller listner generates RECV_ForceShardFlushMsg event for ForceShardFlushMsg message
@@ -227,7 +246,7 @@ func TestRECV_ForceShardFlushMsg_LocalWasEarlier(t *testing.T) {
 	}()
 
 	// now emit RECV_ForceShardFlushMsg event with the transaction from peer that is later
-	events <- newControllerEvent(RECV_ForceShardFlushMsg, NewForceShardFlushMsg(remoteTx))
+	events <- newControllerEvent(RECV_ForceShardFlushMsg, NewForceShardFlushMsg(remoteTx, common.GobCodec))
 	events <- newControllerEvent(SHUTDOWN, nil)
 
 	// wait for event listener to finish
@@ -276,7 +295,8 @@ func TestRECV_ForceShardFlushMsg_RemoteWasEarlier(t *testing.T) {
 	// add some weight to local stack
 	local.Submit(dto.TestSubmitter().NewRequest("request from another submitter"))
 	// now add the double spending transaction to local stack, which should be later in sequence/weight
-	if _, err = local.Submit(submitter.NewRequest("spend same $10 again")); err != nil {
+	var localTx dto.Transaction
+	if localTx, err = local.Submit(submitter.NewRequest("spend same $10 again")); err != nil {
 		t.Errorf("Failed to submit local transaction: %s", err)
 	}
 	p2pLayer.Reset()
@@ -297,7 +317,7 @@ func TestRECV_ForceShardFlushMsg_RemoteWasEarlier(t *testing.T) {
 	}()
 
 	// now emit RECV_ForceShardFlushMsg event with the transaction from peer that is earlier
-	events <- newControllerEvent(RECV_ForceShardFlushMsg, NewForceShardFlushMsg(remoteTx))
+	events <- newControllerEvent(RECV_ForceShardFlushMsg, NewForceShardFlushMsg(remoteTx, common.GobCodec))
 	events <- newControllerEvent(SHUTDOWN, nil)
 
 	// wait for event listener to finish
@@ -311,9 +331,11 @@ func TestRECV_ForceShardFlushMsg_RemoteWasEarlier(t *testing.T) {
 		t.Errorf("Endorser did not get called for submitter/seq history")
 	}
 
-	// we should flush the local shard
-	if !sharder.FlushCalled {
-		t.Errorf("shard flush did not get called when remote transaction wins")
+	// we should roll back the local transaction, instead of flushing the local shard
+	if !sharder.ResolveCalled || sharder.FlushCalled {
+		t.Errorf("local transaction not rolled back when remote transaction wins")
+	} else if local.db.GetShardDagNode(localTx.Id()) != nil {
+		t.Errorf("local transaction not removed from shard DAG")
 	}
 
 	// we should send force shard sync message to peer
@@ -326,3 +348,43 @@ func TestRECV_ForceShardFlushMsg_RemoteWasEarlier(t *testing.T) {
 		t.Errorf("we should not disconnect peer for double spending alert")
 	}
 }
+
+// double spend handlers should be called with evidence of both conflicting transactions
+func TestOnDoubleSpend(t *testing.T) {
+	local, _, _, _, _ := initMocksAndDb()
+	remote, _, _, _, _ := initMocksAndDb()
+	received := make(chan DoubleSpendEvidence, 10)
+	local.OnDoubleSpend(func(evidence DoubleSpendEvidence) { received <- evidence })
+
+	// a network transaction conflicting with a local transaction
+	submitter := dto.TestSubmitter()
+	localTx, _ := local.Submit(submitter.NewRequest("spend $10"))
+	remote.Submit(dto.TestSubmitter().NewRequest("request from another submitter"))
+	remoteTx, _ := remote.Submit(submitter.NewRequest("spend same $10 again"))
+	peer := NewMockPeer(p2p.TestConn())
+	if err := local.handleALERT_DoubleSpend(peer, make(chan controllerEvent, 10), remoteTx); err != nil {
+		t.Fatalf("failed to handle double spend: %s", err)
+	}
+	select {
+	case e := <-received:
+		if e.ExistingTx != localTx.Id() || e.ConflictingTx != remoteTx.Id() || e.Seq != submitter.Seq ||
+			string(e.PeerId) != string(peer.ID()) || e.Resolution != RESOLUTION_PEER_FLUSH {
+			t.Errorf("incorrect evidence: %+v", e)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("double spend handler not called")
+	}
+
+	// a local submission conflicting with an existing transaction
+	if _, err := local.Submit(submitter.NewRequest("spend $10 yet again")); dto.ErrorCodeOf(err) != dto.ErrDoubleSpend {
+		t.Fatalf("expected double spending submission to be rejected: %s", err)
+	}
+	select {
+	case e := <-received:
+		if e.ExistingTx != localTx.Id() || e.Winner != localTx.Id() || e.PeerId != nil || e.Resolution != RESOLUTION_REJECTED {
+			t.Errorf("incorrect evidence: %+v", e)
+		}
+	case <-time.After(100 * time.Millisecond):
+		t.Errorf("double spend handler not called for local submission")
+	}
+}
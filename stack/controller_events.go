@@ -26,6 +26,14 @@ const (
 	RECV_SubmitterProcessDownRequestMsg
 	RECV_SubmitterProcessDownResponseMsg
 	RECV_ForceShardFlushMsg
+	RECV_TxRejectMsg
+	RECV_NodeVersionMsg
+	RECV_ShardTipsRequestMsg
+	RECV_ShardTipsSketchMsg
+	RECV_TxShardBatchRequestMsg
+	RECV_TxShardBatchResponseMsg
+	RECV_ShardSubscriptionMsg
+	RECV_TxAckMsg
 	POP_ShardChild
 	ALERT_DoubleSpend
 	SHUTDOWN
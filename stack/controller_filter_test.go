@@ -0,0 +1,100 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"strings"
+	"testing"
+)
+
+// storage filter that drops all shards
+func dropAll(shardId []byte) bool {
+	return false
+}
+
+// build a network transaction for a shard other than app's shard
+func otherShardTx() dto.Transaction {
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = []byte("other shard")
+	tx := submitter.NewTransaction(dto.TestAnchor(), "test payload")
+	tx.Anchor().ShardParent = shard.GenesisShardTx(submitter.ShardId).Id()
+	return tx
+}
+
+// test that transactions of filtered shards are relayed, but not stored
+func TestStorageFilter_Relay(t *testing.T) {
+	stack, _, _, mockP2P := initMocks()
+	stack.filter = dropAll
+	peer := NewMockPeer(p2p.TestConn())
+	tx := otherShardTx()
+	if err := stack.handleRECV_NewTxBlockMsg(peer, make(chan controllerEvent, 10), tx); err != nil {
+		t.Errorf("failed to handle transaction: %s", err)
+	}
+	if stack.db.GetTx(tx.Id()) != nil || stack.db.GetShardDagNode(tx.Id()) != nil {
+		t.Errorf("transaction of filtered shard should not be stored")
+	}
+	if !mockP2P.DidBroadcast {
+		t.Errorf("transaction of filtered shard should be relayed")
+	}
+	// no sync should be initiated for the filtered shard
+	if peer.SendCalled {
+		t.Errorf("should not send any message to peer")
+	}
+	// sync paths should refuse transactions of filtered shard
+	if err := stack.handleTransaction(peer, make(chan controllerEvent, 10), tx, true); err == nil {
+		t.Errorf("transaction of filtered shard should be refused")
+	}
+}
+
+// test that registered app's shard is always stored
+func TestStorageFilter_AppShard(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.filter = dropAll
+	tx, _ := shard.SignedShardTransaction("test payload")
+	if err := stack.handleRECV_NewTxBlockMsg(NewMockPeer(p2p.TestConn()), make(chan controllerEvent, 10), tx); err != nil {
+		t.Errorf("failed to handle transaction: %s", err)
+	}
+	if stack.db.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("transaction of app's shard should be stored")
+	}
+}
+
+// test that node does not sync filtered shards with peers
+func TestStorageFilter_ShardSync(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.filter = dropAll
+	peer := NewMockPeer(p2p.TestConn())
+	events := make(chan controllerEvent, 10)
+	finished := make(chan struct{}, 2)
+	go func() {
+		stack.peerEventsListener(peer, events)
+		finished <- struct{}{}
+	}()
+	events <- newControllerEvent(RECV_ShardSyncMsg, NewShardSyncMsg([]byte("other shard"), dto.TestAnchor()))
+	events <- newControllerEvent(SHUTDOWN, nil)
+	<-finished
+	if peer.SendCalled {
+		t.Errorf("should not sync filtered shard")
+	}
+	// no genesis should be created for the filtered shard
+	if len(stack.db.ShardTips([]byte("other shard"))) != 0 {
+		t.Errorf("filtered shard should not be initialized")
+	}
+}
+
+// test that storage filter option is applied, and archives of filtered shards are refused
+func TestStorageFilter_Option(t *testing.T) {
+	stack, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorageFilter(dropAll))
+	if err != nil {
+		t.Fatalf("failed to create stack: %s", err)
+	}
+	if stack.isStored([]byte("other shard")) {
+		t.Errorf("storage filter not applied")
+	}
+	if _, err := stack.ImportShard([]byte("other shard"), &bytes.Buffer{}, nil); err == nil || !strings.Contains(err.Error(), "not stored") {
+		t.Errorf("import of filtered shard should fail: %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+	"time"
+)
+
+// build a network transaction that will be rejected by sharder due to unknown parent
+func rejectedTx() dto.Transaction {
+	tx := dto.TestSignedTransaction("test payload")
+	tx.Anchor().ShardSeq = 0x02
+	tx.Anchor().ShardParent = dto.RandomHash()
+	return tx
+}
+
+// test that no rejection is sent when NACKs are not enabled
+func TestNack_Disabled(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+
+	events := make(chan controllerEvent, 10)
+	if err := stack.handleTransaction(peer, events, rejectedTx(), false); err == nil {
+		t.Errorf("transaction should have been rejected")
+	}
+	if peer.SendCalled {
+		t.Errorf("stack should not send rejection when disabled")
+	}
+}
+
+// test that rejection is sent back to peer when NACKs are enabled
+func TestNack_Enabled(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _ := initMocks()
+	stack.conf.SendNacks = true
+	peer := NewMockPeer(p2p.TestConn())
+
+	tx := rejectedTx()
+	events := make(chan controllerEvent, 10)
+	if err := stack.handleTransaction(peer, events, tx, false); err == nil {
+		t.Errorf("transaction should have been rejected")
+	}
+	if !peer.SendCalled || peer.SendMsgCode != TxRejectMsgCode {
+		t.Errorf("stack did not send rejection")
+	} else if msg := peer.SendMsg.(*TxRejectMsg); msg.TxId != tx.Id() || msg.Reason != REJECT_SHARD || string(msg.Origin) != string(tx.Anchor().NodeId) {
+		t.Errorf("incorrect rejection message: %v", msg)
+	}
+}
+
+// test that rejections are rate limited
+func TestNack_RateLimit(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _ := initMocks()
+	stack.conf.SendNacks = true
+	peer := NewMockPeer(p2p.TestConn())
+
+	for i := 0; i < MaxNacksPerSecond; i++ {
+		stack.nack(peer, rejectedTx(), REJECT_INVALID, errTest)
+	}
+	peer.Reset()
+	stack.nack(peer, rejectedTx(), REJECT_INVALID, errTest)
+	if peer.SendCalled {
+		t.Errorf("rejection should have been rate limited")
+	}
+}
+
+// test that originator surfaces rejection to subscribers
+func TestRECV_TxRejectMsg_Originator(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, p2pLayer := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+
+	received := make(chan *Event, 1)
+	stack.Subscribe(func(e *Event) { received <- e })
+
+	tx := rejectedTx()
+	msg := NewTxRejectMsg(tx, REJECT_DOUBLE_SPEND, "double spend")
+	msg.Origin = stack.p2p.Id()
+	if err := stack.handleRECV_TxRejectMsg(peer, msg); err != nil {
+		t.Errorf("failed to handle rejection: %s", err)
+	}
+	select {
+	case e := <-received:
+		if e.Type != EVENT_TX_REJECTED || e.TxId != tx.Id() || e.Reason != REJECT_DOUBLE_SPEND {
+			t.Errorf("incorrect event: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("rejection not delivered to subscriber")
+	}
+	if p2pLayer.DidBroadcast {
+		t.Errorf("originator should not forward rejection")
+	}
+}
+
+// test that rejection for another originator is forwarded with bounded hops
+func TestRECV_TxRejectMsg_Forward(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, p2pLayer := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+
+	msg := NewTxRejectMsg(rejectedTx(), REJECT_INVALID, "invalid")
+	if err := stack.handleRECV_TxRejectMsg(peer, msg); err != nil {
+		t.Errorf("failed to handle rejection: %s", err)
+	}
+	if !p2pLayer.DidBroadcast || msg.Hops != 1 {
+		t.Errorf("rejection not forwarded toward originator")
+	}
+
+	// same rejection again should be ignored
+	p2pLayer.Reset()
+	stack.handleRECV_TxRejectMsg(peer, msg)
+	if p2pLayer.DidBroadcast {
+		t.Errorf("duplicate rejection should not be forwarded")
+	}
+
+	// rejection at max hops should not be forwarded
+	msg = NewTxRejectMsg(rejectedTx(), REJECT_INVALID, "invalid")
+	msg.Hops = MaxNackHops
+	stack.handleRECV_TxRejectMsg(peer, msg)
+	if p2pLayer.DidBroadcast {
+		t.Errorf("rejection beyond max hops should not be forwarded")
+	}
+}
+
+var errTest = errors.New("test error")
@@ -0,0 +1,149 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// process a network transaction through sharder, as stack would do
+func handleShardTx(sharder *mockSharder, endorser *mockEndorser, tx dto.Transaction) {
+	endorser.Handle(tx)
+	sharder.LockState()
+	sharder.Handle(tx)
+	sharder.CommitState(tx)
+	sharder.UnlockState()
+}
+
+// test that paused app keeps shard registered but stops transaction processing
+func TestPause_RegisteredApp(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, _, _ := initMocks()
+
+	if err := stack.Pause(); err != nil {
+		t.Errorf("Failed to pause app: %s", err)
+	}
+	if !sharder.PauseCalled {
+		t.Errorf("DLT stack did not pause sharder")
+	}
+	if stack.app == nil || stack.txHandler != nil || !stack.paused[string(stack.app.ShardId)] {
+		t.Errorf("DLT stack not paused correctly")
+	}
+
+	// cannot pause again
+	if err := stack.Pause(); err == nil {
+		t.Errorf("should not pause an already paused app")
+	}
+
+	// paused app should not submit transactions or issue anchors
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); err == nil {
+		t.Errorf("paused app should not submit transactions")
+	}
+	if a := stack.Anchor([]byte("test submitter"), 0x01, dto.RandomHash()); a != nil {
+		t.Errorf("paused app should not get anchors")
+	}
+
+	// stack should still be able to sync the paused app's shard
+	if _, err := stack.anchor(); err != nil {
+		t.Errorf("paused app's shard not tracked for sync: %s", err)
+	}
+}
+
+// test that pause is rejected when no app is registered
+func TestPause_UnregisteredApp(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, _, _ := initMocks()
+	stack.Unregister()
+	sharder.Reset()
+
+	if err := stack.Pause(); err == nil {
+		t.Errorf("should not pause when app is not registered")
+	}
+	if sharder.PauseCalled {
+		t.Errorf("should not pause sharder when app is not registered")
+	}
+}
+
+// test that resume only replays transactions received while paused
+func TestResume_ReplaysGap(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, endorser, _ := initMocks()
+
+	// process a transaction while app is registered
+	tx1, _ := shard.SignedShardTransaction("before pause")
+	handleShardTx(sharder, endorser, tx1)
+
+	// pause app and process another transaction
+	stack.Pause()
+	tx2, _ := shard.SignedShardTransaction("during pause")
+	handleShardTx(sharder, endorser, tx2)
+
+	// resume app, which should only replay transaction received during pause
+	replayed := [][64]byte{}
+	txHandler := func(tx dto.Transaction, state state.State) error { replayed = append(replayed, tx.Id()); return nil }
+	if err := stack.Resume(txHandler); err != nil {
+		t.Errorf("Failed to resume app: %s", err)
+	}
+	if len(replayed) != 1 || replayed[0] != tx2.Id() {
+		t.Errorf("incorrect replay upon resume: %d", len(replayed))
+	}
+	if len(stack.paused) != 0 || stack.txHandler == nil {
+		t.Errorf("DLT stack not resumed correctly")
+	}
+
+	// cannot resume when not paused
+	if err := stack.Resume(txHandler); err == nil {
+		t.Errorf("should not resume an app that is not paused")
+	}
+}
+
+// test that pause and resume of a shard leave other registered app running
+func TestPauseShard_OtherAppContinues(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	other := []byte("another shard")
+	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
+	if err := stack.Register(other, "another app", txHandler); err != nil {
+		t.Fatalf("Registration of another shard failed: %s", err)
+	}
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = other
+
+	if err := stack.PauseShard(other); err != nil {
+		t.Errorf("Failed to pause app of shard: %s", err)
+	}
+	if err := stack.PauseShard(other); err == nil {
+		t.Errorf("should not pause an already paused app")
+	}
+	if err := stack.PauseShard([]byte("unknown shard")); err == nil {
+		t.Errorf("should not pause app of unregistered shard")
+	}
+	// paused shard rejects submissions and anchors, while first app continues
+	if _, err := stack.Submit(submitter.NewRequest("test payload")); dto.ErrorCodeOf(err) != dto.ErrAppPaused {
+		t.Errorf("paused app should not submit transactions: %s", err)
+	}
+	if a := stack.AnchorShard(other, []byte("test submitter"), 0x01, dto.RandomHash()); a != nil {
+		t.Errorf("paused app should not get anchors")
+	}
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); err != nil {
+		t.Errorf("first app should continue while other app is paused: %s", err)
+	}
+	if a := stack.Anchor([]byte("test submitter"), 0x01, dto.RandomHash()); a == nil {
+		t.Errorf("first app should get anchors while other app is paused")
+	}
+	if stack.txHandler == nil {
+		t.Errorf("pausing other app should not drop first app's handler")
+	}
+
+	// resume paused shard
+	if err := stack.ResumeShard(TestAppConfig().ShardId, txHandler); err == nil {
+		t.Errorf("should not resume an app that is not paused")
+	}
+	if err := stack.ResumeShard(other, txHandler); err != nil {
+		t.Errorf("Failed to resume app of shard: %s", err)
+	}
+	if _, err := stack.Submit(submitter.NewRequest("test payload")); err != nil {
+		t.Errorf("resumed app should submit transactions: %s", err)
+	}
+}
@@ -2,6 +2,7 @@
 package stack
 
 import (
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/log"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/p2p"
@@ -892,7 +893,7 @@ func TestRECV_SubmitterProcessDownResponseMsg_SubmitterSeqNoMatch(t *testing.T)
 	msg := NewSubmitterProcessDownResponseMsg(&SubmitterProcessDownRequestMsg{
 		Submitter: []byte("some random submitter"),
 		Seq:       0xff,
-	}, []dto.Transaction{TestSignedTransaction("test payload1")})
+	}, []dto.Transaction{TestSignedTransaction("test payload1")}, common.GobCodec)
 	events <- newControllerEvent(RECV_SubmitterProcessDownResponseMsg, msg)
 	events <- newControllerEvent(SHUTDOWN, nil)
 
@@ -958,7 +959,7 @@ func TestRECV_SubmitterProcessDownResponseMsg_DoubleSpend(t *testing.T) {
 	msg := NewSubmitterProcessDownResponseMsg(&SubmitterProcessDownRequestMsg{
 		Submitter: tx1.Request().SubmitterId,
 		Seq:       tx1.Request().SubmitterSeq,
-	}, []dto.Transaction{tx2})
+	}, []dto.Transaction{tx2}, common.GobCodec)
 	events <- newControllerEvent(RECV_SubmitterProcessDownResponseMsg, msg)
 	events <- newControllerEvent(SHUTDOWN, nil)
 
@@ -1056,7 +1057,7 @@ func TestRECV_SubmitterProcessDownResponseMsg_UnknownShardAncestor(t *testing.T)
 	msg := NewSubmitterProcessDownResponseMsg(&SubmitterProcessDownRequestMsg{
 		Submitter: tx2.Request().SubmitterId,
 		Seq:       tx2.Request().SubmitterSeq,
-	}, []dto.Transaction{tx2})
+	}, []dto.Transaction{tx2}, common.GobCodec)
 	events <- newControllerEvent(RECV_SubmitterProcessDownResponseMsg, msg)
 	events <- newControllerEvent(SHUTDOWN, nil)
 
@@ -1139,7 +1140,7 @@ func TestRECV_SubmitterProcessDownResponseMsg_HappyPath(t *testing.T) {
 	msg := NewSubmitterProcessDownResponseMsg(&SubmitterProcessDownRequestMsg{
 		Submitter: tx2.Request().SubmitterId,
 		Seq:       tx2.Request().SubmitterSeq,
-	}, []dto.Transaction{tx2})
+	}, []dto.Transaction{tx2}, common.GobCodec)
 	events <- newControllerEvent(RECV_SubmitterProcessDownResponseMsg, msg)
 	events <- newControllerEvent(SHUTDOWN, nil)
 
@@ -1215,7 +1216,7 @@ func TestRECV_SubmitterProcessDownResponseMsg_EndOfSync(t *testing.T) {
 	msg := NewSubmitterProcessDownResponseMsg(&SubmitterProcessDownRequestMsg{
 		Submitter: []byte("some submitter"),
 		Seq:       0x23,
-	}, []dto.Transaction{})
+	}, []dto.Transaction{}, common.GobCodec)
 	events <- newControllerEvent(RECV_SubmitterProcessDownResponseMsg, msg)
 	events <- newControllerEvent(SHUTDOWN, nil)
 
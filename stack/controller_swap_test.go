@@ -0,0 +1,44 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// test that swapping handler of registered app replaces stack's handler
+func TestSwapHandler_RegisteredApp(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, _, _ := initMocks()
+	called := false
+	handler := func(tx dto.Transaction, s state.State) error {
+		called = true
+		return nil
+	}
+	if _, err := stack.SwapHandler(stack.app.ShardId, handler, 0); err != nil {
+		t.Errorf("Failed to swap handler: %s", err)
+	}
+	if !sharder.SwapHandlerCalled {
+		t.Errorf("DLT stack did not swap handler with sharder")
+	}
+	if stack.txHandler(nil, nil); !called {
+		t.Errorf("DLT stack did not replace its handler")
+	}
+}
+
+// test that swap is rejected for unregistered or paused app
+func TestSwapHandler_NotActive(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	handler := func(tx dto.Transaction, s state.State) error { return nil }
+	if _, err := stack.SwapHandler([]byte("unknown shard"), handler, 0); err == nil {
+		t.Errorf("should not swap handler of unregistered shard")
+	}
+	stack.Pause()
+	if _, err := stack.SwapHandler(stack.app.ShardId, handler, 0); err == nil {
+		t.Errorf("should not swap handler of paused app")
+	}
+	if sharder.SwapHandlerCalled {
+		t.Errorf("should not swap handler with sharder")
+	}
+}
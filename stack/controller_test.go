@@ -3,6 +3,8 @@ package stack
 
 import (
 	"errors"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/log"
 	"github.com/trust-net/dag-lib-go/stack/dto"
@@ -23,7 +25,7 @@ func initMocks() (*dlt, *mockSharder, *mockEndorser, *p2p.MockP2P) {
 func initMocksAndDb() (*dlt, *mockSharder, *mockEndorser, *p2p.MockP2P, *repo.MockDltDb) {
 	log.SetLogLevel(log.DEBUG)
 	// create an instance of stack controller
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	mockDb := repo.NewMockDltDb()
 	stack.db = mockDb
 
@@ -59,7 +61,7 @@ func TestInitiatization(t *testing.T) {
 	var stack DLT
 	var err error
 	testDb := db.NewInMemDbProvider()
-	stack, err = NewDltStack(p2p.TestConfig(), testDb)
+	stack, err = NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(testDb))
 	if stack.(*dlt) == nil || err != nil {
 		t.Errorf("Initiatization validation failed, c: %s, err: %s", stack, err)
 	}
@@ -148,6 +150,70 @@ func TestRegister_UnseenTx(t *testing.T) {
 	}
 }
 
+// register application with replay options
+func TestRegisterWithOptions_SkipReplay(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, endorser, _ := initMocks()
+
+	// unregister default app
+	stack.Unregister()
+	// register a transaction with sharder that would be replayed upon app registration
+	tx, _ := shard.SignedShardTransaction("test payload")
+	endorser.Handle(tx)
+	sharder.LockState()
+	sharder.Handle(tx)
+	sharder.CommitState(tx)
+	sharder.UnlockState()
+	sharder.Reset()
+
+	// register app asking to skip replay
+	app := TestAppConfig()
+	cbCalled := false
+	txHandler := func(tx dto.Transaction, state state.State) error { cbCalled = true; return nil }
+	opts := &shard.RegisterOptions{SkipReplay: true}
+	if err := stack.RegisterWithOptions(app.ShardId, app.Name, txHandler, opts); err != nil {
+		t.Errorf("Registration failed: %s", err)
+	}
+
+	// sharder should have been given the options
+	if !sharder.IsRegistered || sharder.RegisterOptions != opts {
+		t.Errorf("DLT stack controller did not register with sharding layer using options")
+	}
+
+	// replay should not have called application's transaction handler
+	if cbCalled {
+		t.Errorf("DLT stack app registration should not replay transactions")
+	}
+}
+
+// failed registration should not leave app registered
+func TestRegisterWithOptions_Failure(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, endorser, _ := initMocks()
+
+	// unregister default app
+	stack.Unregister()
+	// register a transaction with sharder that would be replayed upon app registration
+	tx, _ := shard.SignedShardTransaction("test payload")
+	endorser.Handle(tx)
+	sharder.LockState()
+	sharder.Handle(tx)
+	sharder.CommitState(tx)
+	sharder.UnlockState()
+
+	// register app with a handler that fails replay
+	app := TestAppConfig()
+	txHandler := func(tx dto.Transaction, state state.State) error { return errors.New("replay failed") }
+	if err := stack.RegisterWithOptions(app.ShardId, app.Name, txHandler, nil); err == nil {
+		t.Errorf("Registration did not fail upon replay error")
+	}
+	if stack.app != nil || stack.txHandler != nil {
+		t.Errorf("app should not remain registered upon failure")
+	}
+}
+
 // re-register application after seen transaction
 func TestRegister_SeenTx(t *testing.T) {
 	log.SetLogLevel(log.NONE)
@@ -227,10 +293,10 @@ func TestPreRegistered(t *testing.T) {
 	endorser.Reset()
 	p2pLayer.Reset()
 
-	// attempt to register app again
+	// attempt to register app again for same shard
 	sharder.Reset()
 	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
-	if err := stack.Register([]byte("another shard"), "another app", txHandler); err == nil {
+	if err := stack.Register(TestAppConfig().ShardId, "another app", txHandler); err == nil {
 		t.Errorf("Registration did not check for already registered")
 	}
 
@@ -255,6 +321,38 @@ func TestPreRegistered(t *testing.T) {
 	}
 }
 
+// apps registered for multiple shards should accept their own shard's submissions, and be unregistered individually
+func TestRegister_MultipleShards(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	other := []byte("another shard")
+	handled := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { handled += 1; return nil }
+	if err := stack.Register(other, "another app", txHandler); err != nil {
+		t.Fatalf("Registration of another shard failed: %s", err)
+	}
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = other
+	if _, err := stack.Submit(submitter.NewRequest("test payload")); err != nil || handled != 1 {
+		t.Errorf("Submission to another shard failed: %s", err)
+	}
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); err != nil {
+		t.Errorf("Submission to first shard failed: %s", err)
+	}
+	// unregister first app, other app should take over as primary app
+	if err := stack.UnregisterShard(TestAppConfig().ShardId); err != nil {
+		t.Errorf("Unregistration of shard failed: %s", err)
+	}
+	if stack.app == nil || string(stack.app.ShardId) != string(other) || len(stack.apps) != 1 {
+		t.Errorf("Incorrect apps after unregistration")
+	}
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); dto.ErrorCodeOf(err) != dto.ErrShardUnknown {
+		t.Errorf("Expected submission to unregistered shard to fail: %s", err)
+	}
+	if err := stack.UnregisterShard(TestAppConfig().ShardId); err == nil {
+		t.Errorf("Expected unregistration of unknown shard to fail")
+	}
+}
+
 // unregister a previously registered application
 func TestUnRegister(t *testing.T) {
 	// create a DLT stack instance with registered app and initialized mocks
@@ -277,9 +375,33 @@ func TestUnRegister(t *testing.T) {
 	}
 }
 
+// reset of an unregistered shard should let a re-registered app replay a clean history
+func TestResetShard(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("Submission failed: %s", err)
+	}
+	if err := stack.ResetShard(TestAppConfig().ShardId); err == nil {
+		t.Errorf("Expected reset of registered shard to fail")
+	}
+	stack.Unregister()
+	if err := stack.ResetShard(TestAppConfig().ShardId); err != nil || !sharder.ResetCalled {
+		t.Errorf("Shard reset failed: %s", err)
+	}
+	if stack.db.GetTx(tx.Id()) != nil {
+		t.Errorf("Transaction of reset shard still in history")
+	}
+	replayed := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { replayed += 1; return nil }
+	if err := stack.Register(TestAppConfig().ShardId, TestAppConfig().Name, txHandler); err != nil || replayed != 0 {
+		t.Errorf("Re-registration did not replay clean history: %d, %s", replayed, err)
+	}
+}
+
 // try submitting a transaction without application being registered first
 func TestSubmitUnregistered(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	// inject mock endorser into stack
 	endorser := NewMockEndorser(stack.db)
 	stack.endorser = endorser
@@ -295,7 +417,7 @@ func TestSubmitUnregistered(t *testing.T) {
 
 // try submitting a transaction with nil/missing values
 func TestSubmitNilValues(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	app := TestAppConfig()
 	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
 	if err := stack.Register(app.ShardId, app.Name, txHandler); err != nil {
@@ -332,7 +454,7 @@ func TestSubmitNilValues(t *testing.T) {
 
 // try submitting a transaction with fake app ID, it should fail
 func TestSubmitAppIdNoMatch(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	app := TestAppConfig()
 	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
 	if err := stack.Register(app.ShardId, app.Name, txHandler); err != nil {
@@ -490,7 +612,7 @@ func TestSubmitNetworkSeen(t *testing.T) {
 
 // transaction submission validation of fields
 func TestSubmitValidation(t *testing.T) {
-	//	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	//	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	stack, _, _, p2pLayer := initMocks()
 
 	p2pLayer.Reset()
@@ -508,7 +630,7 @@ func TestSubmitValidation(t *testing.T) {
 func TestSubmitValidation_AnchorSignature(t *testing.T) {
 	// not applicable anymore, submitter does not fetches anchor for submission
 
-	//	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	//	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	//	// register app
 	//	app := TestAppConfig()
 	//	stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil })
@@ -527,7 +649,7 @@ func TestSubmitValidation_AnchorSignature(t *testing.T) {
 }
 
 func TestSubmitValidation_PayloadSignature(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	// register app
 	app := TestAppConfig()
 	stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil })
@@ -543,9 +665,108 @@ func TestSubmitValidation_PayloadSignature(t *testing.T) {
 	}
 }
 
+// transaction submission failures report stable error codes
+func TestSubmit_ErrorCodes(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = stack.app.ShardId
+	if _, err := stack.Submit(submitter.NewRequest("payload 1")); err != nil {
+		t.Errorf("Transaction submission failed: %s", err)
+		return
+	}
+	check := func(req *dto.TxRequest, code dto.ErrorCode) {
+		if _, err := stack.Submit(req); err == nil {
+			t.Errorf("Transaction submission did not fail for %s", code)
+		} else if dto.ErrorCodeOf(err) != code {
+			t.Errorf("incorrect error code: %s, expected: %s, error: %s", dto.ErrorCodeOf(err), code, err)
+		}
+	}
+	// same seq on same shard again
+	check(submitter.NewRequest("payload 2"), dto.ErrDoubleSpend)
+	// previous seq unknown
+	submitter.Seq = 3
+	check(submitter.NewRequest("payload 3"), dto.ErrSeqMismatch)
+	// last tx not of previous seq
+	submitter.Seq, submitter.LastTx = 2, dto.RandomHash()
+	check(submitter.NewRequest("payload 4"), dto.ErrStaleParent)
+	// shard not hosted
+	req := submitter.NewRequest("payload 6")
+	req.ShardId = []byte("unknown shard")
+	check(req, dto.ErrShardUnknown)
+	// no app registered
+	stack.Unregister()
+	check(submitter.NewRequest("payload 7"), dto.ErrAppNotRegistered)
+}
+
+// submission with stale anchor is re-anchored and retried up to policy's limit
+func TestSubmit_Reanchor(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = stack.app.ShardId
+
+	// stale anchor is reported when re-anchoring is disabled
+	sharder.StaleAnchors = 1
+	if _, err := stack.Submit(submitter.NewRequest("payload 1")); dto.ErrorCodeOf(err) != dto.ErrStaleAnchor {
+		t.Errorf("stale anchor not reported: %v", err)
+	}
+
+	// submission succeeds when re-anchored within limit
+	stack.policies.MaxReanchorRetries = 2
+	sharder.StaleAnchors, sharder.ApproveCount = 2, 0
+	if tx, err := stack.Submit(submitter.NewRequest("payload 2")); err != nil {
+		t.Errorf("re-anchored submission failed: %s", err)
+		return
+	} else if submitter.LastTx = tx.Id(); sharder.ApproveCount != 3 {
+		t.Errorf("incorrect number of approvals: %d", sharder.ApproveCount)
+	} else if stack.db.GetTx(tx.Id()) == nil {
+		t.Errorf("re-anchored transaction not saved")
+	}
+
+	// and fails when still stale after limit
+	submitter.Seq, sharder.StaleAnchors, sharder.ApproveCount = 2, 3, 0
+	if _, err := stack.Submit(submitter.NewRequest("payload 3")); dto.ErrorCodeOf(err) != dto.ErrStaleAnchor {
+		t.Errorf("stale anchor not reported after retries: %v", err)
+	} else if sharder.ApproveCount != 3 {
+		t.Errorf("incorrect number of approvals: %d", sharder.ApproveCount)
+	}
+}
+
+// submission with an anchor issued by node should use the anchor, and a stale anchor is left for submitter
+// to re-anchor
+func TestSubmitAnchored(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = stack.app.ShardId
+	stack.policies.MaxReanchorRetries = 2
+
+	// stale anchor is reported without re-anchoring
+	anchor := stack.Anchor(submitter.Id, submitter.Seq, submitter.LastTx)
+	sharder.StaleAnchors, sharder.ApproveCount = 1, 0
+	if _, err := stack.SubmitAnchored(submitter.NewRequest("payload 1"), anchor, ""); dto.ErrorCodeOf(err) != dto.ErrStaleAnchor {
+		t.Errorf("stale anchor not reported: %v", err)
+	} else if sharder.ApproveCount != 1 {
+		t.Errorf("submitter's anchor should not be re-anchored: %d", sharder.ApproveCount)
+	}
+
+	// transaction is built with submitter's anchor
+	if tx, err := stack.SubmitAnchored(submitter.NewRequest("payload 2"), anchor, ""); err != nil {
+		t.Errorf("anchored submission failed: %s", err)
+	} else if string(tx.Anchor().Signature) != string(anchor.Signature) || stack.db.GetTx(tx.Id()) == nil {
+		t.Errorf("transaction not built with submitter's anchor")
+	}
+
+	// anchor not issued by node is refused
+	submitter.Seq = 2
+	foreign := dto.TestAnchor()
+	foreign.Signature = []byte("signature")
+	if _, err := stack.SubmitAnchored(submitter.NewRequest("payload 3"), foreign, ""); dto.ErrorCodeOf(err) != dto.ErrInvalidSignature {
+		t.Errorf("foreign anchor not refused: %v", err)
+	}
+}
+
 // start of controller, happy path
 func TestStart(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	p2p := p2p.TestP2PLayer("mock p2p")
 	stack.p2p = p2p
 	if err := stack.Start(); err != nil || !p2p.IsStarted {
@@ -558,7 +779,7 @@ func TestStart(t *testing.T) {
 
 // stop of controller, happy path
 func TestStop(t *testing.T) {
-	stack, _ := NewDltStack(p2p.TestConfig(), db.NewInMemDbProvider())
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()))
 	p2p := p2p.TestP2PLayer("mock p2p")
 	stack.p2p = p2p
 	stack.Stop()
@@ -567,6 +788,26 @@ func TestStop(t *testing.T) {
 	}
 }
 
+// messages seen by stack should still be seen after a restart over same storage
+func TestStop_PersistSeen(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	stack, _ := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(dbp))
+	stack.p2p = p2p.TestP2PLayer("mock p2p")
+	seen := dto.RandomHash()
+	stack.isSeen(seen)
+	stack.Stop()
+	restarted, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(dbp))
+	if err != nil {
+		t.Fatalf("failed to create stack: %s", err)
+	}
+	if !restarted.isSeen(seen) {
+		t.Errorf("seen message not persisted across restart")
+	}
+	if restarted.isSeen(dto.RandomHash()) {
+		t.Errorf("did not expect unseen message to be seen")
+	}
+}
+
 // get an anchor from DLT stack when app is registered
 func TestAnchorRegisteredApp(t *testing.T) {
 	// create a DLT stack instance with registered app and initialized mocks
@@ -587,6 +828,32 @@ func TestAnchorRegisteredApp(t *testing.T) {
 	}
 }
 
+// anchor issued by DLT stack should be recorded in audit trail
+func TestAnchorAuditTrail(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, endorser, _ := initMocks()
+
+	// get an anchor
+	lastTx := dto.RandomHash()
+	if a := stack.Anchor([]byte("test submitter"), 0x02, lastTx); a == nil {
+		t.Errorf("Failed to get anchor")
+	}
+	if !endorser.AnchorIssuedCalled {
+		t.Errorf("DLT stack did not record anchor with endorser")
+	}
+
+	// query the audit trail
+	records := stack.AnchorAudit([]byte("test submitter"))
+	if len(records) != 1 {
+		t.Errorf("incorrect number of audit records: %d", len(records))
+	} else if records[0].Seq != 0x02 || records[0].LastTx != lastTx || string(records[0].ShardId) != string(stack.app.ShardId) {
+		t.Errorf("incorrect audit record: %v", records[0])
+	}
+	if len(stack.AbandonedAnchors([]byte("test submitter"))) != 1 {
+		t.Errorf("unused anchor should be reported as abandoned")
+	}
+}
+
 // get an anchor from DLT stack when app is not registered
 func TestAnchorUnregisteredApp(t *testing.T) {
 	// create a DLT stack instance with registered app and initialized mocks
@@ -639,7 +906,8 @@ func TestPeerHandshake(t *testing.T) {
 	} else if peer.SendMsgCode != ShardSyncMsgCode {
 		t.Errorf("Handshake did not send ShardSyncMsg message to peer")
 	}
-	if mockConn.WriteCount != 1 {
+	// node version message followed by shard sync message
+	if mockConn.WriteCount != 2 {
 		t.Errorf("Handshake sent unexpected number of messages: %d", mockConn.WriteCount)
 	}
 }
@@ -674,11 +942,13 @@ func TestPeerHandshakeUnregistered(t *testing.T) {
 		t.Errorf("Handshake should not fetch Anchor from p2p layer for unregistered app")
 	}
 
-	// we should not have sent ShardSyncMsg to peer
-	if peer.SendCalled {
-		t.Errorf("Handshake should not send any message to peer for unregistered app")
+	// we should have only sent node version message to peer
+	if !peer.SendCalled {
+		t.Errorf("Handshake did not send any message to peer")
+	} else if peer.SendMsgCode != NodeVersionMsgCode {
+		t.Errorf("Handshake should not send ShardSyncMsg to peer for unregistered app")
 	}
-	if mockConn.WriteCount != 0 {
+	if mockConn.WriteCount != 1 {
 		t.Errorf("Handshake sent unexpected number of messages: %d", mockConn.WriteCount)
 	}
 }
@@ -738,6 +1008,39 @@ func TestRECV_NewTxBlockMsgEvent(t *testing.T) {
 	}
 }
 
+// test stack controller event listener does not deadlock when a shard's queue is full, while stack's lock
+// is held by other events
+func TestRECV_NewTxBlockMsgEvent_QueueFull(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	// a single worker with a queue of size 1, so that submissions wait for queued jobs
+	stack.executor = newWeightedShardExecutor(1, 1, nil)
+	peer := NewMockPeer(p2p.TestConn())
+
+	// start stack's event listener
+	events := make(chan controllerEvent, 10)
+	finished := make(chan struct{}, 2)
+	go func() {
+		stack.peerEventsListener(peer, events)
+		finished <- struct{}{}
+	}()
+
+	// emit more transactions of a shard than its queue can hold, interleaved with events handled under lock
+	for i := 0; i < 5; i++ {
+		events <- newControllerEvent(RECV_NewTxBlockMsg, TestSignedTransaction(fmt.Sprintf("test payload %d", i)))
+		events <- newControllerEvent(RECV_ShardSyncMsg, NewShardSyncMsg([]byte("other shard"), dto.TestAnchor()))
+	}
+	events <- newControllerEvent(SHUTDOWN, nil)
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event listener deadlocked on full shard queue")
+	}
+	if !sharder.TxHandlerCalled {
+		t.Errorf("DLT stack controller did not call sharding layer")
+	}
+}
+
 // test stack controller event listener handles RECV_NewTxBlockMsg correctly for a duplicate transaction
 func TestRECV_NewTxBlockMsgEvent_Duplicate(t *testing.T) {
 	// create a DLT stack instance with registered app and initialized mocks
@@ -894,6 +1197,43 @@ func TestRECV_NewTxBlockMsgEvent_DoubleSpend(t *testing.T) {
 	}
 }
 
+// shard jobs emitting double spend alerts should not block on peer's events, while listener waits for space
+// in the shard's queue
+func TestRECV_NewTxBlockMsgEvent_DoubleSpendsQueueFull(t *testing.T) {
+	stack, _, _, _, _ := initMocksAndDb()
+	stack.executor = newWeightedShardExecutor(1, 1, nil)
+	submitter := dto.TestSubmitter()
+	stack.Submit(submitter.NewRequest("spend my $10"))
+
+	// double spending transactions from different remote stacks
+	txs := []dto.Transaction{}
+	for i := 0; i < 5; i++ {
+		remote, _, _, _, _ := initMocksAndDb()
+		tx, _ := remote.Submit(submitter.NewRequest(fmt.Sprintf("spend same $10 again %d", i)))
+		txs = append(txs, tx)
+	}
+
+	// start stack's event listener, with room for only one event
+	peer := NewMockPeer(p2p.TestConn())
+	events := make(chan controllerEvent, 1)
+	finished := make(chan struct{})
+	go func() {
+		stack.peerEventsListener(peer, events)
+		close(finished)
+	}()
+	go func() {
+		for _, tx := range txs {
+			events <- newControllerEvent(RECV_NewTxBlockMsg, tx)
+		}
+		events <- newControllerEvent(SHUTDOWN, nil)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("event listener blocked on shard jobs")
+	}
+}
+
 // test stack controller event listener handles RECV_NewTxBlockMsg correctly for unknown submitter last transaction
 func TestRECV_NewTxBlockMsgEvent_UnknownLastTx(t *testing.T) {
 	// create a DLT stack instance with registered app and initialized mocks
@@ -1899,8 +2239,8 @@ func TestStackRunner(t *testing.T) {
 		t.Errorf("Did not expect %d messages consumed from peer", mockConn.ReadCount)
 	}
 
-	// handshake message should have been sent to peer
-	if mockConn.WriteCount != 1 {
+	// handshake messages (node version and shard sync) should have been sent to peer
+	if mockConn.WriteCount != 2 {
 		t.Errorf("Did not expect %d messages sent to peer", mockConn.WriteCount)
 	}
 
@@ -2664,7 +3004,7 @@ func TestRECV_TxShardChildResponseMsg_UnexpectedHash(t *testing.T) {
 	}()
 
 	// build an transaction response message using hash unknown to shard
-	msg := NewTxShardChildResponseMsg(dto.TestSignedTransaction("test data"), [][64]byte{})
+	msg := NewTxShardChildResponseMsg(dto.TestSignedTransaction("test data"), [][64]byte{}, common.GobCodec)
 	for i := 0; i < 5; i++ {
 		msg.Children = append(msg.Children, dto.RandomHash())
 	}
@@ -2845,7 +3185,7 @@ func TestRECV_TxShardChildResponseMsg_ExpectedHash(t *testing.T) {
 	}()
 
 	// build an transaction response message using hash unknown to shard
-	msg := NewTxShardChildResponseMsg(tx2, [][64]byte{})
+	msg := NewTxShardChildResponseMsg(tx2, [][64]byte{}, common.GobCodec)
 	for i := 0; i < 5; i++ {
 		msg.Children = append(msg.Children, dto.RandomHash())
 	}
@@ -3275,3 +3615,167 @@ func TestGetState(t *testing.T) {
 		t.Errorf("GetState did not fetch value from sharding layer")
 	}
 }
+
+// query transaction statistics for a shard from DLT stack
+func TestShardStats(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, _, _ := initMocks()
+
+	// query stats for the app's shard
+	stack.ShardStats(stack.app.ShardId)
+	if !sharder.StatsCalled {
+		t.Errorf("DLT stack did not query sharder for stats")
+	}
+}
+
+// query registry of known shards from DLT stack
+func TestShards(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _, db := initMocksAndDb()
+
+	// app's shard is known from its genesis
+	shards := stack.Shards()
+	if len(shards) != 1 {
+		t.Errorf("incorrect number of shards: %d", len(shards))
+	} else if string(shards[0].ShardId) != string(stack.app.ShardId) {
+		t.Errorf("incorrect shard: %s", shards[0].ShardId)
+	} else if shards[0].GenesisTx != shard.GenesisShardTx(stack.app.ShardId).Id() {
+		t.Errorf("incorrect genesis: %x", shards[0].GenesisTx)
+	}
+	if db.GetShardsCallCount != 1 || db.GetShardInfoCount != 1 {
+		t.Errorf("DLT stack did not query DB for shard registry")
+	}
+}
+
+// query dead-lettered transactions for registered app from DLT stack
+func TestDeadLetters(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, _, _ := initMocks()
+
+	stack.DeadLetters()
+	if !sharder.DeadLettersCalled {
+		t.Errorf("DLT stack did not query sharder for dead letters")
+	}
+
+	// no dead letters without registered app
+	stack.Unregister()
+	sharder.Reset()
+	if stack.DeadLetters() != nil || sharder.DeadLettersCalled {
+		t.Errorf("DLT stack should not query dead letters without app")
+	}
+}
+
+// query world state and dead letters of each registered app's shard from DLT stack
+func TestShardQueries_MultipleShards(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	other := []byte("another shard")
+	txHandler := func(tx dto.Transaction, s state.State) error {
+		if string(tx.Request().Payload) == "invalid" {
+			return shard.InvalidTx(fmt.Errorf("invalid payload"))
+		}
+		return s.Put(&state.Resource{Key: []byte("key"), Owner: tx.Request().SubmitterId, Value: tx.Request().Payload})
+	}
+	if err := stack.Register(other, "another app", txHandler); err != nil {
+		t.Fatalf("Registration of another shard failed: %s", err)
+	}
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = other
+	if tx, err := stack.Submit(submitter.NewRequest("value")); err != nil {
+		t.Fatalf("Submission to another shard failed: %s", err)
+	} else {
+		submitter.Seq, submitter.LastTx = submitter.Seq+1, tx.Id()
+	}
+	stack.Submit(submitter.NewRequest("invalid"))
+
+	if r, err := stack.GetShardState(other, []byte("key")); err != nil || string(r.Value) != "value" {
+		t.Errorf("incorrect state of another shard: %v, %s", r, err)
+	}
+	if r, err := stack.GetState([]byte("key")); err == nil {
+		t.Errorf("first shard should not have other shard's state: %v", r)
+	}
+	if resources, err := stack.ListShardByOwner(other, submitter.Id); err != nil || len(resources) != 1 {
+		t.Errorf("incorrect resources of owner in another shard: %d, %s", len(resources), err)
+	}
+	if resources, _ := stack.ListByOwner(submitter.Id); len(resources) != 0 {
+		t.Errorf("first shard should not list other shard's resources: %d", len(resources))
+	}
+	if letters := stack.ShardDeadLetters(other); len(letters) != 1 {
+		t.Errorf("incorrect dead letters of another shard: %d", len(letters))
+	}
+	if letters := stack.DeadLetters(); len(letters) != 0 {
+		t.Errorf("first shard should not have other shard's dead letters: %d", len(letters))
+	}
+	if _, err := stack.GetShardState([]byte("unknown shard"), []byte("key")); err == nil {
+		t.Errorf("should not query state of unregistered shard")
+	}
+	if stack.ShardDeadLetters([]byte("unknown shard")) != nil {
+		t.Errorf("should not query dead letters of unregistered shard")
+	}
+}
+
+// query last applied cursor for a shard from DLT stack
+func TestLastApplied(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, sharder, endorser, _ := initMocks()
+
+	// process a transaction for app's shard
+	tx, _ := shard.SignedShardTransaction("test payload")
+	endorser.Handle(tx)
+	sharder.LockState()
+	sharder.Handle(tx)
+	sharder.CommitState(tx)
+	sharder.UnlockState()
+
+	if id, seq := stack.LastApplied(tx.Request().ShardId); id != tx.Id() || seq != tx.Anchor().ShardSeq {
+		t.Errorf("incorrect last applied cursor: %x, %d", id, seq)
+	}
+	if !sharder.LastAppliedCalled {
+		t.Errorf("DLT stack did not query sharder for last applied cursor")
+	}
+}
+
+// get resource value as of a shard sequence
+func TestGetStateAtSeq(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	sharder.Reset()
+	stack.GetStateAtSeq([]byte("test shard"), 1, []byte("test key"))
+	if !sharder.GetStateAtSeqCalled {
+		t.Errorf("GetStateAtSeq did not fetch value from sharding layer")
+	}
+}
+
+// list resources owned by an owner
+func TestListByOwner(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	sharder.Reset()
+	stack.ListByOwner([]byte("test owner"))
+	if !sharder.ListByOwnerCalled {
+		t.Errorf("ListByOwner did not fetch resources from sharding layer")
+	}
+}
+
+// a network transaction violating app's invariant should be rejected, and alerted to app subscribers
+func TestHandleTransaction_InvariantViolation(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	app := TestAppConfig()
+	stack.UnregisterShard(app.ShardId)
+	violated := shard.StateValidator{Name: "test", Check: func(s state.State) error { return errors.New("violated") }}
+	opts := &shard.RegisterOptions{Validators: []shard.StateValidator{violated}}
+	if err := stack.RegisterWithOptions(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil }, opts); err != nil {
+		t.Fatalf("Failed to register app: %s", err)
+	}
+	received := make(chan *Event, 10)
+	stack.Subscribe(func(e *Event) { received <- e })
+	tx := TestSignedTransaction("test payload")
+	if err := stack.handleTransaction(NewMockPeer(p2p.TestConn()), make(chan controllerEvent, 10), tx, false); err == nil {
+		t.Errorf("Expected transaction to fail on invariant violation")
+	}
+	select {
+	case e := <-received:
+		if e.Type != EVENT_INVARIANT_VIOLATION || e.TxId != tx.Id() || e.Violation == nil || e.Violation.Validator != "test" {
+			t.Errorf("Incorrect event: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Did not alert invariant violation")
+	}
+}
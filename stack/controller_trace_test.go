@@ -0,0 +1,89 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// test that submission generates a trace ID when caller does not provide one
+func TestSubmit_GeneratesTraceId(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _ := initMocks()
+
+	tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Errorf("Transaction submission failed, err: %s", err)
+		return
+	}
+	if len(tx.TraceId()) == 0 {
+		t.Errorf("submitted transaction does not have a trace ID")
+	}
+}
+
+// test that caller provided trace ID is used, and not gossiped by default
+func TestSubmitWithTrace(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, p2pLayer := initMocks()
+
+	tx, err := stack.SubmitWithTrace(dto.TestSubmitter().NewRequest("test payload"), "test trace")
+	if err != nil {
+		t.Errorf("Transaction submission failed, err: %s", err)
+		return
+	}
+	if tx.TraceId() != "test trace" {
+		t.Errorf("incorrect trace ID: %s", tx.TraceId())
+	}
+
+	// broadcast message should not include trace, since gossip is disabled by default
+	if !p2pLayer.DidBroadcast {
+		t.Errorf("stack did not broadcast transaction")
+	} else if msg := p2pLayer.BroadcastMsg.(dto.Transaction); msg.TraceId() != "" || msg.Id() != tx.Id() {
+		t.Errorf("incorrect broadcast of transaction: %s", msg.TraceId())
+	}
+}
+
+// test that trace ID is gossiped when enabled in config
+func TestSubmitWithTrace_Gossip(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, p2pLayer := initMocks()
+	stack.conf.GossipTrace = true
+
+	if _, err := stack.SubmitWithTrace(dto.TestSubmitter().NewRequest("test payload"), "test trace"); err != nil {
+		t.Errorf("Transaction submission failed, err: %s", err)
+		return
+	}
+	if msg := p2pLayer.BroadcastMsg.(dto.Transaction); msg.TraceId() != "test trace" {
+		t.Errorf("trace ID not gossiped: %s", msg.TraceId())
+	}
+}
+
+// test that transactions without trace are encoded on wire same as before trace was introduced
+func TestTraceId_WireCompatibility(t *testing.T) {
+	tx := dto.TestSignedTransaction("test payload")
+
+	// encode with a legacy structure that has no trace field
+	legacy := struct {
+		TxRequest *dto.TxRequest
+		TxAnchor  *dto.Anchor
+	}{tx.Request(), tx.Anchor()}
+	legacyBytes, _ := rlp.EncodeToBytes(legacy)
+	if txBytes, _ := rlp.EncodeToBytes(tx); string(txBytes) != string(legacyBytes) {
+		t.Errorf("transaction without trace not encoded same as legacy format")
+	}
+
+	// legacy bytes should decode into transaction
+	decoded := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if err := rlp.DecodeBytes(legacyBytes, decoded); err != nil || decoded.Id() != tx.Id() {
+		t.Errorf("failed to decode legacy transaction: %s", err)
+	}
+
+	// trace should survive encoding
+	tx.SetTraceId("test trace")
+	txBytes, _ := rlp.EncodeToBytes(tx)
+	decoded = dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if err := rlp.DecodeBytes(txBytes, decoded); err != nil || decoded.TraceId() != "test trace" || decoded.Id() != tx.Id() {
+		t.Errorf("failed to decode traced transaction: %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The trust-net Authors
+// Cumulative node counters persisted across restarts
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+)
+
+// names of node's cumulative counters
+var (
+	counterDoubleSpends  = []byte("double_spends")
+	counterBytesGossiped = []byte("bytes_gossiped")
+	counterShardTxPrefix = "shard_tx:"
+)
+
+// cumulative counters of a node, since its data directory was created
+type NodeCounters struct {
+	// number of transactions processed per shard, keyed by shard id
+	ShardTxCount map[string]uint64
+	// number of double spends detected
+	DoubleSpends uint64
+	// bytes of transactions broadcast to peers (counted once per broadcast)
+	BytesGossiped uint64
+}
+
+func shardTxCounter(shardId []byte) []byte {
+	return append([]byte(counterShardTxPrefix), shardId...)
+}
+
+// count a transaction accepted into local DAG
+func (d *dlt) countTx(tx dto.Transaction) {
+	if err := d.counters.Add(shardTxCounter(tx.Request().ShardId), 1); err != nil {
+		d.logger.Error("Failed to update transaction counter: %s", err)
+	}
+}
+
+// count a double spend detected by node
+func (d *dlt) countDoubleSpend() {
+	d.metrics.Counter(MetricDoubleSpends, 1, nil)
+	if err := d.counters.Add(counterDoubleSpends, 1); err != nil {
+		d.logger.Error("Failed to update double spend counter: %s", err)
+	}
+}
+
+// count a transaction broadcast to peers
+func (d *dlt) countGossip(tx dto.Transaction) {
+	if data, err := d.codec.Marshal(tx); err == nil {
+		d.metrics.Counter(MetricBytesGossiped, uint64(len(data)), map[string]string{LabelShard: string(tx.Request().ShardId)})
+		if err := d.counters.Add(counterBytesGossiped, uint64(len(data))); err != nil {
+			d.logger.Error("Failed to update gossip counter: %s", err)
+		}
+	}
+}
+
+func (d *dlt) Counters() *NodeCounters {
+	counters := &NodeCounters{
+		ShardTxCount:  make(map[string]uint64),
+		DoubleSpends:  d.counters.Get(counterDoubleSpends),
+		BytesGossiped: d.counters.Get(counterBytesGossiped),
+	}
+	for name, value := range d.counters.All() {
+		if len(name) > len(counterShardTxPrefix) && name[:len(counterShardTxPrefix)] == counterShardTxPrefix {
+			counters.ShardTxCount[name[len(counterShardTxPrefix):]] = value
+		}
+	}
+	return counters
+}
@@ -0,0 +1,47 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+// test that counters are updated for accepted and gossiped transactions, and survive restart
+func TestCounters(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	for i := 0; i < 2; i++ {
+		tx, err := stack.Submit(submitter.NewRequest("test payload"))
+		if err != nil {
+			t.Fatalf("submission failed: %s", err)
+		}
+		submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+	}
+	counters := stack.Counters()
+	if counters.ShardTxCount[string(stack.app.ShardId)] != 2 || counters.BytesGossiped == 0 || counters.DoubleSpends != 0 {
+		t.Errorf("incorrect counters: %+v", counters)
+	}
+
+	// a new stack over same storage should report persisted counters
+	restarted, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(stack.dbp))
+	if err != nil {
+		t.Fatalf("failed to create stack: %s", err)
+	}
+	if restarted.Counters().BytesGossiped != counters.BytesGossiped {
+		t.Errorf("incorrect counters after restart: %+v", restarted.Counters())
+	}
+	if stats := restarted.ShardStats(stack.app.ShardId); stats == nil || stats.TotalTxCount != 2 || stats.TxCount != 0 {
+		t.Errorf("incorrect shard stats after restart: %+v", stats)
+	}
+}
+
+// test that double spends are counted
+func TestCounters_DoubleSpend(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx := dto.TestSignedTransaction("test payload")
+	stack.recordDoubleSpend(NewMockPeer(p2p.TestConn()), tx, tx, RESOLUTION_PEER_FLUSH)
+	if stack.Counters().DoubleSpends != 1 {
+		t.Errorf("double spend not counted: %+v", stack.Counters())
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2019 The trust-net Authors
+// Crash dumps of stack's state upon a panic in stack's goroutines, for actionable field crash reports
+package stack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/version"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// number of most recently processed transactions recorded in a crash dump
+var CrashDumpTxCount = 100
+
+// max size (bytes) of stack traces of all goroutines recorded in a crash dump
+var CrashDumpTraceSize = 1 << 20
+
+// state of a stack captured upon a panic
+type CrashDump struct {
+	// time of crash, and build version of the node
+	Time    time.Time    `json:"time"`
+	Version version.Info `json:"version"`
+	// panic value, and stack trace of panicking goroutine
+	Panic string `json:"panic"`
+	Trace string `json:"trace"`
+	// stack traces of all goroutines
+	Goroutines string `json:"goroutines"`
+	// number of network transaction jobs pending per shard queue, keyed by hex encoded shard id
+	Queues map[string]int `json:"queues"`
+	// current tips of each known shard (hex encoded), keyed by hex encoded shard id
+	Tips map[string][]string `json:"tips"`
+	// IDs of most recently processed transactions (hex encoded), oldest first
+	RecentTxs []string `json:"recent_txs"`
+	// failure to capture stack's state, if any (dump then has only panic and traces)
+	Error string `json:"error,omitempty"`
+}
+
+// ring of most recently processed transaction IDs
+type recentTxs struct {
+	ids  [][64]byte
+	next int
+	full bool
+	lock sync.Mutex
+}
+
+func newRecentTxs(size int) *recentTxs {
+	if size < 1 {
+		size = 1
+	}
+	return &recentTxs{ids: make([][64]byte, size)}
+}
+
+func (r *recentTxs) add(id [64]byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.ids[r.next] = id
+	if r.next = (r.next + 1) % len(r.ids); r.next == 0 {
+		r.full = true
+	}
+}
+
+// recorded transaction IDs, oldest first
+func (r *recentTxs) all() [][64]byte {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([][64]byte{}, r.ids[:r.next]...)
+	}
+	return append(append([][64]byte{}, r.ids[r.next:]...), r.ids[:r.next]...)
+}
+
+// wrap a function run on a stack goroutine, so that a panic writes a crash dump
+func (d *dlt) guarded(run func()) func() {
+	return func() {
+		defer d.recoverCrash()
+		run()
+	}
+}
+
+// deferred by stack goroutines, writes a crash dump upon a panic (when enabled) and then panics again,
+// so that process still exits as it would without the dump (a panic recovered again up the same
+// goroutine is dumped only once)
+func (d *dlt) recoverCrash() {
+	if r := recover(); r != nil {
+		if len(d.crashDumpDir) > 0 {
+			d.crashOnce.Do(func() {
+				if path, err := d.writeCrashDump(r, debug.Stack()); err != nil {
+					d.logger.Error("Failed to write crash dump: %s", err)
+				} else {
+					d.logger.Error("Wrote crash dump: %s", path)
+				}
+			})
+		}
+		panic(r)
+	}
+}
+
+// capture stack's state without waiting on stack's lock, which the panicking goroutine may hold
+func (d *dlt) crashDump(r interface{}, trace []byte) (dump *CrashDump) {
+	dump = &CrashDump{
+		Time:      time.Now(),
+		Version:   version.Get(),
+		Panic:     fmt.Sprintf("%v", r),
+		Trace:     string(trace),
+		Queues:    make(map[string]int),
+		Tips:      make(map[string][]string),
+		RecentTxs: []string{},
+	}
+	traces := make([]byte, CrashDumpTraceSize)
+	dump.Goroutines = string(traces[:runtime.Stack(traces, true)])
+	// state is captured on a best effort basis, a failure to capture it should not lose the traces
+	defer func() {
+		if err := recover(); err != nil {
+			dump.Error = fmt.Sprintf("%v", err)
+		}
+	}()
+	for _, id := range d.recent.all() {
+		dump.RecentTxs = append(dump.RecentTxs, hex.EncodeToString(id[:]))
+	}
+	for id, pending := range d.executor.pending() {
+		dump.Queues[hex.EncodeToString([]byte(id))] = pending
+	}
+	for _, shardId := range d.db.GetShards() {
+		tips := []string{}
+		for _, tip := range d.db.ShardTips(shardId) {
+			tips = append(tips, hex.EncodeToString(tip[:]))
+		}
+		dump.Tips[hex.EncodeToString(shardId)] = tips
+	}
+	return dump
+}
+
+// write a crash dump into crash dump directory, returns path of dump file
+func (d *dlt) writeCrashDump(r interface{}, trace []byte) (string, error) {
+	dump := d.crashDump(r, trace)
+	path := filepath.Join(d.crashDumpDir, fmt.Sprintf("crash-%d.json", dump.Time.UnixNano()))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(dump); err != nil {
+		return "", err
+	}
+	return path, file.Sync()
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a panic in a stack goroutine should write a crash dump with stack's state, and still panic
+func TestCrashDump(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	dir, _ := ioutil.TempDir("", "crash")
+	defer os.RemoveAll(dir)
+	stack.crashDumpDir = dir
+	tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("submission failed: %s", err)
+	}
+	var recovered interface{}
+	func() {
+		defer func() { recovered = recover() }()
+		stack.guarded(func() { panic("test crash") })()
+	}()
+	if recovered != "test crash" {
+		t.Errorf("panic not raised again after crash dump: %v", recovered)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "crash-*.json"))
+	if len(files) != 1 {
+		t.Fatalf("incorrect number of crash dumps: %d", len(files))
+	}
+	data, _ := ioutil.ReadFile(files[0])
+	dump := CrashDump{}
+	if err := json.Unmarshal(data, &dump); err != nil {
+		t.Fatalf("failed to parse crash dump: %s", err)
+	}
+	if dump.Panic != "test crash" || len(dump.Trace) == 0 || len(dump.Goroutines) == 0 || len(dump.Error) != 0 {
+		t.Errorf("incorrect crash dump: %+v", dump)
+	}
+	id := tx.Id()
+	if len(dump.RecentTxs) != 1 || dump.RecentTxs[0] != hex.EncodeToString(id[:]) {
+		t.Errorf("incorrect recent transactions: %v", dump.RecentTxs)
+	}
+	if tips := dump.Tips[hex.EncodeToString(tx.Request().ShardId)]; len(tips) != 1 || tips[0] != hex.EncodeToString(id[:]) {
+		t.Errorf("incorrect shard tips: %v", dump.Tips)
+	}
+}
+
+// recent transactions should keep most recent IDs, oldest first
+func TestRecentTxs(t *testing.T) {
+	r := newRecentTxs(2)
+	for i := byte(1); i <= 3; i++ {
+		r.add([64]byte{i})
+	}
+	if ids := r.all(); len(ids) != 2 || ids[0][0] != 2 || ids[1][0] != 3 {
+		t.Errorf("incorrect recent transactions: %v", ids)
+	}
+}
+
+func TestWithCrashDumps_InvalidDir(t *testing.T) {
+	if _, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(db.NewInMemDbProvider()), WithCrashDumps("/no/such/dir")); err == nil {
+		t.Errorf("expected invalid crash dump directory to fail")
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The trust-net Authors
+// Read-only access to shard DAG for applications
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/repo"
+)
+
+// a node of a shard's DAG, as a copy detached from stack's storage
+type DagNode struct {
+	// transaction of the node
+	TxId [64]byte
+	// shard of the transaction
+	ShardId []byte
+	// parent node in the DAG
+	Parent [64]byte
+	// children nodes in the DAG
+	Children [][64]byte
+	// depth of the node in DAG
+	Depth uint64
+}
+
+func (d *dlt) dagNode(node *repo.DagNode) *DagNode {
+	if node == nil {
+		return nil
+	}
+	res := &DagNode{
+		TxId:     node.TxId,
+		Parent:   node.Parent,
+		Children: append([][64]byte{}, node.Children...),
+		Depth:    node.Depth,
+	}
+	if tx := d.db.GetTx(node.TxId); tx != nil {
+		res.ShardId = append([]byte{}, tx.Request().ShardId...)
+	}
+	return res
+}
+
+func (d *dlt) GetDagNode(id [64]byte) *DagNode {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.dagNode(d.db.GetShardDagNode(id))
+}
+
+func (d *dlt) ChildrenOf(id [64]byte) []DagNode {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node := d.db.GetShardDagNode(id)
+	if node == nil {
+		return nil
+	}
+	children := make([]DagNode, 0, len(node.Children))
+	for _, childId := range node.Children {
+		if child := d.dagNode(d.db.GetShardDagNode(childId)); child != nil {
+			children = append(children, *child)
+		}
+	}
+	return children
+}
+
+func (d *dlt) ParentOf(id [64]byte) *DagNode {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	node := d.db.GetShardDagNode(id)
+	if node == nil {
+		return nil
+	}
+	return d.dagNode(d.db.GetShardDagNode(node.Parent))
+}
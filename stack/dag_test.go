@@ -0,0 +1,41 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+)
+
+// test read-only DAG accessors
+func TestDagAccessors(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, sharder, endorser, _ := initMocks()
+	parent, genesis := shard.SignedShardTransaction("parent")
+	handleTestTx(endorser, sharder, parent)
+	child := dto.TestSignedTransaction("child")
+	child.Anchor().ShardParent = parent.Id()
+	child.Anchor().ShardSeq = 2
+	handleTestTx(endorser, sharder, child)
+
+	node := stack.GetDagNode(parent.Id())
+	if node == nil || node.Depth != 1 || node.Parent != genesis.Id() || string(node.ShardId) != string(parent.Request().ShardId) {
+		t.Errorf("incorrect DAG node: %v", node)
+		return
+	}
+	if children := stack.ChildrenOf(parent.Id()); len(children) != 1 || children[0].TxId != child.Id() {
+		t.Errorf("incorrect children: %v", children)
+	}
+	if p := stack.ParentOf(child.Id()); p == nil || p.TxId != parent.Id() {
+		t.Errorf("incorrect parent: %v", p)
+	}
+	// returned nodes should be copies
+	node.Children[0] = dto.RandomHash()
+	if stack.GetDagNode(parent.Id()).Children[0] != child.Id() {
+		t.Errorf("DAG node not detached from storage")
+	}
+	if stack.GetDagNode(dto.RandomHash()) != nil || stack.ParentOf(dto.RandomHash()) != nil {
+		t.Errorf("unknown transaction should have no DAG node")
+	}
+}
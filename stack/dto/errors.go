@@ -0,0 +1,83 @@
+// Copyright 2019 The trust-net Authors
+// Stable error codes of transaction rejections, for clients to implement targeted recovery
+package dto
+
+import (
+	"fmt"
+)
+
+// stable code of a transaction rejection reason
+type ErrorCode string
+
+const (
+	// no app registered with node for submissions, or registered app is paused
+	ErrAppNotRegistered ErrorCode = "APP_NOT_REGISTERED"
+	ErrAppPaused        ErrorCode = "APP_PAUSED"
+	// malformed request, e.g. missing payload, submitter ID or signature
+	ErrInvalidRequest ErrorCode = "INVALID_REQUEST"
+	// request's signature does not match its submitter ID
+	ErrInvalidSignature ErrorCode = "INVALID_SIGNATURE"
+	// request is for a shard not hosted by node
+	ErrShardUnknown ErrorCode = "SHARD_UNKNOWN"
+	// request exceeds node's max payload size
+	ErrPayloadTooLarge ErrorCode = "PAYLOAD_TOO_LARGE"
+	// request exceeds one of node's other limits
+	ErrLimitExceeded ErrorCode = "LIMIT_EXCEEDED"
+	// submitter exceeded its rate limit at node, submission may be retried later
+	ErrRateLimited ErrorCode = "RATE_LIMITED"
+	// submitter's previous sequence is not known to node, submitter should resync its sequence
+	ErrSeqMismatch ErrorCode = "SEQ_MISMATCH"
+	// submitter's last transaction is not a transaction of its previous sequence, submitter should
+	// resync its last transaction
+	ErrStaleParent ErrorCode = "STALE_PARENT"
+	// shard parent of transaction's anchor is no longer known to node, e.g. shard's tips moved
+	// (and DAG was flushed) before transaction was applied, request can be resubmitted for a new anchor
+	ErrStaleAnchor ErrorCode = "STALE_ANCHOR"
+	// submitter already has a different transaction with same sequence on the shard
+	ErrDoubleSpend ErrorCode = "DOUBLE_SPEND"
+	// transaction was already seen by node
+	ErrDuplicate ErrorCode = "DUPLICATE"
+	// transaction was rejected by shard's application
+	ErrRejected ErrorCode = "REJECTED"
+	// node failed to process the request, submission may be retried as is
+	ErrInternal ErrorCode = "INTERNAL"
+)
+
+// error of a rejected transaction, with stable code of the rejection reason
+type TxError struct {
+	Code   ErrorCode
+	Reason string
+}
+
+func (e *TxError) Error() string {
+	return e.Reason
+}
+
+func (e *TxError) ErrorCode() ErrorCode {
+	return e.Code
+}
+
+// create an error with specified code and formatted reason
+func NewTxError(code ErrorCode, format string, args ...interface{}) *TxError {
+	return &TxError{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+// wrap an error with specified code, an error that already has a code is returned as is
+func WithErrorCode(code ErrorCode, err error) error {
+	if err == nil {
+		return nil
+	} else if _, ok := err.(interface{ ErrorCode() ErrorCode }); ok {
+		return err
+	}
+	return &TxError{Code: code, Reason: err.Error()}
+}
+
+// get code of an error, ErrInternal for an error without a code and empty code for nil
+func ErrorCodeOf(err error) ErrorCode {
+	if err == nil {
+		return ""
+	} else if coded, ok := err.(interface{ ErrorCode() ErrorCode }); ok {
+		return coded.ErrorCode()
+	}
+	return ErrInternal
+}
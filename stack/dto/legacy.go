@@ -0,0 +1,60 @@
+// Copyright 2019 The trust-net Authors
+// Compatibility shim for the field-style transaction of the pre-request API
+package dto
+
+// Deprecated: field-style transaction of the pre-request API, kept only to let applications
+// migrate incrementally, use TxRequest for submission and Transaction for processing instead
+type LegacyTransaction struct {
+	// payload for transaction's operations
+	Payload []byte
+	// shard id for the transaction
+	ShardId []byte
+	// submitter's public ID
+	Submitter []byte
+	// submitter's transaction sequence and last transaction
+	SubmitterSeq uint64
+	LastTx       [64]byte
+	// a padding to meet challenge for network's DoS protection
+	Padding uint64
+	// signature of the transaction's request contents using submitter's private key
+	Signature []byte
+	// anchor fields, populated only for a transaction converted from the stack
+	NodeId      []byte
+	ShardSeq    uint64
+	ShardParent [64]byte
+	Weight      uint64
+}
+
+// Deprecated: convert legacy transaction into a transaction request for submission
+func (t *LegacyTransaction) Request() *TxRequest {
+	return &TxRequest{
+		Payload:      t.Payload,
+		ShardId:      t.ShardId,
+		LastTx:       t.LastTx,
+		SubmitterId:  t.Submitter,
+		SubmitterSeq: t.SubmitterSeq,
+		Padding:      t.Padding,
+		Signature:    t.Signature,
+	}
+}
+
+// Deprecated: convert a transaction into legacy field-style transaction
+func ToLegacyTransaction(tx Transaction) *LegacyTransaction {
+	if tx == nil || tx.Request() == nil {
+		return nil
+	}
+	r := tx.Request()
+	legacy := &LegacyTransaction{
+		Payload:      r.Payload,
+		ShardId:      r.ShardId,
+		Submitter:    r.SubmitterId,
+		SubmitterSeq: r.SubmitterSeq,
+		LastTx:       r.LastTx,
+		Padding:      r.Padding,
+		Signature:    r.Signature,
+	}
+	if a := tx.Anchor(); a != nil {
+		legacy.NodeId, legacy.ShardSeq, legacy.ShardParent, legacy.Weight = a.NodeId, a.ShardSeq, a.ShardParent, a.Weight
+	}
+	return legacy
+}
@@ -0,0 +1,111 @@
+// Copyright 2019 The trust-net Authors
+// Protobuf encoding of transactions, as per schema in docs/dag.proto
+package dto
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+)
+
+func (r *TxRequest) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, r.Payload)
+	w.Bytes(2, r.ShardId)
+	w.Hash(3, r.LastTx)
+	w.Bytes(4, r.SubmitterId)
+	w.Uint64(5, r.SubmitterSeq)
+	w.Uint64(6, r.Padding)
+	w.Bytes(7, r.Signature)
+	return w.Result(), nil
+}
+
+func (r *TxRequest) UnmarshalProto(data []byte) error {
+	*r = TxRequest{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			r.Payload = pr.Bytes()
+		case 2:
+			r.ShardId = pr.Bytes()
+		case 3:
+			r.LastTx = pr.Hash()
+		case 4:
+			r.SubmitterId = pr.Bytes()
+		case 5:
+			r.SubmitterSeq = pr.Uint64()
+		case 6:
+			r.Padding = pr.Uint64()
+		case 7:
+			r.Signature = pr.Bytes()
+		}
+	}
+	return pr.Err()
+}
+
+func (a *Anchor) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, a.NodeId)
+	w.Uint64(2, a.ShardSeq)
+	w.Uint64(3, a.Weight)
+	w.Hash(4, a.ShardParent)
+	for _, uncle := range a.ShardUncles {
+		w.Hash(5, uncle)
+	}
+	w.Bytes(6, a.Signature)
+	return w.Result(), nil
+}
+
+func (a *Anchor) UnmarshalProto(data []byte) error {
+	*a = Anchor{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			a.NodeId = pr.Bytes()
+		case 2:
+			a.ShardSeq = pr.Uint64()
+		case 3:
+			a.Weight = pr.Uint64()
+		case 4:
+			a.ShardParent = pr.Hash()
+		case 5:
+			a.ShardUncles = append(a.ShardUncles, pr.Hash())
+		case 6:
+			a.Signature = pr.Bytes()
+		}
+	}
+	return pr.Err()
+}
+
+func (tx *transaction) MarshalProto() ([]byte, error) {
+	if tx.TxRequest == nil || tx.TxAnchor == nil {
+		return nil, fmt.Errorf("incomplete transaction")
+	}
+	w := &common.ProtoWriter{}
+	if err := w.Message(1, tx.TxRequest); err != nil {
+		return nil, err
+	} else if err := w.Message(2, tx.TxAnchor); err != nil {
+		return nil, err
+	}
+	for _, trace := range tx.Trace {
+		w.Repeated(3, trace)
+	}
+	return w.Result(), nil
+}
+
+func (tx *transaction) UnmarshalProto(data []byte) error {
+	*tx = transaction{TxRequest: &TxRequest{}, TxAnchor: &Anchor{}}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			pr.Message(tx.TxRequest)
+		case 2:
+			pr.Message(tx.TxAnchor)
+		case 3:
+			tx.Trace = append(tx.Trace, pr.Bytes())
+		}
+	}
+	return pr.Err()
+}
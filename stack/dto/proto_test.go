@@ -0,0 +1,96 @@
+// Copyright 2019 The trust-net Authors
+package dto
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/common"
+	"google.golang.org/protobuf/encoding/protowire"
+	"testing"
+)
+
+// decode a protobuf message with the reference wire decoder, as a non-Go client would, into values of
+// each field number (bytes for length delimited fields, uint64 for varints)
+func wireFields(t *testing.T, data []byte) map[protowire.Number][]interface{} {
+	fields := make(map[protowire.Number][]interface{})
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			t.Fatalf("invalid tag: %s", protowire.ParseError(n))
+		}
+		data = data[n:]
+		switch typ {
+		case protowire.BytesType:
+			value, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				t.Fatalf("invalid bytes of field %d: %s", num, protowire.ParseError(n))
+			}
+			fields[num], data = append(fields[num], value), data[n:]
+		case protowire.VarintType:
+			value, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				t.Fatalf("invalid varint of field %d: %s", num, protowire.ParseError(n))
+			}
+			fields[num], data = append(fields[num], value), data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d of field %d", typ, num)
+		}
+	}
+	return fields
+}
+
+// transaction encoded by protobuf codec should decode with a real protobuf decoder as per docs/dag.proto
+func TestTransaction_ProtoWire(t *testing.T) {
+	tx := TestSignedTransaction("test payload")
+	tx.Request().SubmitterSeq, tx.Request().LastTx = 5, RandomHash()
+	tx.Anchor().ShardSeq, tx.Anchor().Weight, tx.Anchor().ShardParent = 3, 7, RandomHash()
+	tx.Anchor().ShardUncles = [][64]byte{RandomHash(), RandomHash()}
+	tx.Anchor().Signature = []byte("anchor signature")
+	tx.SetTraceId("trace")
+	data, err := common.ProtobufCodec.Marshal(tx)
+	if err != nil {
+		t.Fatalf("failed to marshal: %s", err)
+	}
+
+	// Transaction: request = 1, anchor = 2, trace = 3
+	fields := wireFields(t, data)
+	if len(fields[1]) != 1 || len(fields[2]) != 1 || len(fields[3]) != 1 || string(fields[3][0].([]byte)) != "trace" {
+		t.Fatalf("incorrect transaction fields: %v", fields)
+	}
+	// TxRequest: payload = 1, shard_id = 2, last_tx = 3, submitter_id = 4, submitter_seq = 5, signature = 7
+	req := wireFields(t, fields[1][0].([]byte))
+	lastTx := tx.Request().LastTx
+	if !bytes.Equal(req[1][0].([]byte), tx.Request().Payload) || !bytes.Equal(req[2][0].([]byte), tx.Request().ShardId) ||
+		!bytes.Equal(req[3][0].([]byte), lastTx[:]) || !bytes.Equal(req[4][0].([]byte), tx.Request().SubmitterId) ||
+		req[5][0].(uint64) != 5 || !bytes.Equal(req[7][0].([]byte), tx.Request().Signature) {
+		t.Errorf("incorrect request fields: %v", req)
+	}
+	// Anchor: node_id = 1, shard_seq = 2, weight = 3, shard_parent = 4, shard_uncles = 5, signature = 6
+	anchor := wireFields(t, fields[2][0].([]byte))
+	parent, uncle := tx.Anchor().ShardParent, tx.Anchor().ShardUncles[1]
+	if !bytes.Equal(anchor[1][0].([]byte), tx.Anchor().NodeId) || anchor[2][0].(uint64) != 3 || anchor[3][0].(uint64) != 7 ||
+		!bytes.Equal(anchor[4][0].([]byte), parent[:]) || len(anchor[5]) != 2 || !bytes.Equal(anchor[5][1].([]byte), uncle[:]) ||
+		!bytes.Equal(anchor[6][0].([]byte), tx.Anchor().Signature) {
+		t.Errorf("incorrect anchor fields: %v", anchor)
+	}
+
+	// a message built by another encoder (e.g. a non-Go client) should decode into same transaction
+	var reqMsg, anchorMsg, txMsg []byte
+	reqMsg = protowire.AppendTag(reqMsg, 1, protowire.BytesType)
+	reqMsg = protowire.AppendBytes(reqMsg, tx.Request().Payload)
+	reqMsg = protowire.AppendTag(reqMsg, 5, protowire.VarintType)
+	reqMsg = protowire.AppendVarint(reqMsg, 5)
+	reqMsg = protowire.AppendTag(reqMsg, 7, protowire.BytesType)
+	reqMsg = protowire.AppendBytes(reqMsg, tx.Request().Signature)
+	anchorMsg = protowire.AppendTag(anchorMsg, 6, protowire.BytesType)
+	anchorMsg = protowire.AppendBytes(anchorMsg, tx.Anchor().Signature)
+	txMsg = protowire.AppendTag(txMsg, 1, protowire.BytesType)
+	txMsg = protowire.AppendBytes(txMsg, reqMsg)
+	txMsg = protowire.AppendTag(txMsg, 2, protowire.BytesType)
+	txMsg = protowire.AppendBytes(txMsg, anchorMsg)
+	decoded := NewTransaction(&TxRequest{}, &Anchor{})
+	if err := common.ProtobufCodec.Unmarshal(txMsg, decoded); err != nil {
+		t.Fatalf("failed to unmarshal: %s", err)
+	} else if decoded.Id() != tx.Id() || decoded.Request().SubmitterSeq != 5 {
+		t.Errorf("transaction did not decode from reference encoder")
+	}
+}
@@ -3,7 +3,9 @@
 package dto
 
 import (
+	"crypto/rand"
 	"crypto/sha512"
+	"encoding/hex"
 	"github.com/trust-net/dag-lib-go/common"
 )
 
@@ -14,6 +16,9 @@ type Transaction interface {
 	Anchor() *Anchor
 	Request() *TxRequest
 	Self() *transaction
+	// trace/correlation ID of the transaction, not part of transaction's signed contents
+	TraceId() string
+	SetTraceId(traceId string)
 }
 
 // transaction message
@@ -25,6 +30,9 @@ type transaction struct {
 	TxRequest *TxRequest
 	// transaction anchor from DLT stack
 	TxAnchor *Anchor
+	// non-signed envelope fields, first element is trace/correlation ID
+	// (encoded as tail so that transactions without trace are same on wire as before)
+	Trace [][]byte `rlp:"tail"`
 }
 
 // compute SHA512 hash or return from cache
@@ -71,6 +79,28 @@ func (tx *transaction) Self() *transaction {
 	return tx
 }
 
+func (tx *transaction) TraceId() string {
+	if len(tx.Trace) == 0 {
+		return ""
+	}
+	return string(tx.Trace[0])
+}
+
+func (tx *transaction) SetTraceId(traceId string) {
+	if len(traceId) == 0 {
+		tx.Trace = nil
+	} else {
+		tx.Trace = [][]byte{[]byte(traceId)}
+	}
+}
+
+// generate a new random trace/correlation ID
+func NewTraceId() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
 // make sure any Transaction can only be created with a request and anchor
 func NewTransaction(r *TxRequest, a *Anchor) *transaction {
 	if r == nil || a == nil {
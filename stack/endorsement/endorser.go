@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/repo"
+	"time"
 )
 
 const (
@@ -14,6 +15,7 @@ const (
 	ERR_DOUBLE_SPEND
 	ERR_ORPHAN
 	ERR_INVALID
+	ERR_THROTTLED
 )
 
 type Endorser interface {
@@ -29,10 +31,25 @@ type Endorser interface {
 	Update(tx dto.Transaction) error
 	// Provide all known shard/tx pairs for a submitter/seq
 	KnownShardsTxs(submitter []byte, seq uint64) (shards [][]byte, txs [][64]byte)
+	// record an anchor issued for a submitter in the audit trail
+	AnchorIssued(submitter []byte, seq uint64, lastTx [64]byte, shardId []byte, a *dto.Anchor) error
+	// provide audit trail of all anchors issued for a submitter
+	AnchorAudit(submitter []byte) []repo.AnchorRecord
+	// provide anchors issued for a submitter that were never consumed by a transaction
+	AbandonedAnchors(submitter []byte) []repo.AnchorRecord
+	// limit rate of each submitter's submitted and network transactions, nil for no limit
+	SetRateLimits(submitted, network *RateLimit)
+	// number of submitted and network transactions throttled by rate limits
+	Throttled() (submitted, network uint64)
+	// endorser updating submitter history through a write batch, so that updates are applied along with the batch
+	WithBatch(batch repo.Batch) Endorser
 }
 
 type endorser struct {
 	db repo.DltDb
+	// rate limiters of submitted and network transactions, nil when not limited
+	submitted *rateLimiter
+	network   *rateLimiter
 }
 
 func GenesisSubmitterTx(submitterId []byte) dto.Transaction {
@@ -51,7 +68,7 @@ func (e *endorser) isValid(req *dto.TxRequest, tx dto.Transaction) (int, error)
 	// fetch submitter history for submitter's parent
 	if req.SubmitterSeq > 1 {
 		if parent := e.db.GetSubmitterHistory(req.SubmitterId, req.SubmitterSeq-1); parent == nil {
-			return ERR_ORPHAN, fmt.Errorf("Unexpected submitter sequence: %d", req.SubmitterSeq)
+			return ERR_ORPHAN, dto.NewTxError(dto.ErrSeqMismatch, "Unexpected submitter sequence: %d", req.SubmitterSeq)
 		} else {
 			// walk through known shard/tx pairs to check if parent is there
 			found := false
@@ -62,7 +79,7 @@ func (e *endorser) isValid(req *dto.TxRequest, tx dto.Transaction) (int, error)
 				}
 			}
 			if !found {
-				return ERR_ORPHAN, fmt.Errorf("Unknown submitter parent: %x", req.LastTx)
+				return ERR_ORPHAN, dto.NewTxError(dto.ErrStaleParent, "Unknown submitter parent: %x", req.LastTx)
 			}
 		}
 	}
@@ -73,7 +90,7 @@ func (e *endorser) isValid(req *dto.TxRequest, tx dto.Transaction) (int, error)
 		for _, pair := range current.ShardTxPairs {
 			if string(pair.ShardId) == string(req.ShardId) {
 				if tx == nil || tx.Id() != pair.TxId {
-					return ERR_DOUBLE_SPEND, fmt.Errorf("Double spending attempt for seq: %d, shardId: %x", req.SubmitterSeq, req.ShardId)
+					return ERR_DOUBLE_SPEND, dto.NewTxError(dto.ErrDoubleSpend, "Double spending attempt for seq: %d, shardId: %x", req.SubmitterSeq, req.ShardId)
 				}
 			}
 		}
@@ -110,6 +127,11 @@ func (e *endorser) Handle(tx dto.Transaction) (int, error) {
 		return res, err
 	}
 
+	// throttle submitter, unless transaction is a duplicate (e.g. same transaction forwarded by multiple peers)
+	if e.network != nil && e.db.GetTx(tx.Id()) == nil && !e.network.allow(tx.Request().SubmitterId) {
+		return ERR_THROTTLED, dto.NewTxError(dto.ErrRateLimited, "submitter rate limit exceeded: %x", tx.Request().SubmitterId)
+	}
+
 	// save the transaction
 	if err := e.db.AddTx(tx); err != nil {
 		return ERR_DUPLICATE, err
@@ -144,7 +166,7 @@ func (e *endorser) Replace(tx dto.Transaction) error {
 func (e *endorser) Approve(tx dto.Transaction) error {
 	// validate transaction
 	if tx == nil || tx.Request() == nil || tx.Request().SubmitterSeq < 1 {
-		return fmt.Errorf("invalid transaction")
+		return dto.NewTxError(dto.ErrInvalidRequest, "invalid transaction")
 	}
 
 	// check transaction against submitter history
@@ -152,6 +174,11 @@ func (e *endorser) Approve(tx dto.Transaction) error {
 		return err
 	}
 
+	// throttle submitter
+	if !e.submitted.allow(tx.Request().SubmitterId) {
+		return dto.NewTxError(dto.ErrRateLimited, "submitter rate limit exceeded: %x", tx.Request().SubmitterId)
+	}
+
 	// update submitter's DAG
 	// Below got deffered to a second stage as part of world state commit
 	//	if err := e.db.UpdateSubmitter(tx); err != nil {
@@ -167,9 +194,68 @@ func (e *endorser) Update(tx dto.Transaction) error {
 		return err
 	}
 
+	// mark the anchor as consumed in audit trail, if it was issued by this node
+	for _, record := range e.db.GetAnchorRecords(tx.Request().SubmitterId, tx.Request().SubmitterSeq) {
+		if string(record.Signature) == string(tx.Anchor().Signature) {
+			record.Consumed = true
+			record.TxId = tx.Id()
+			if err := e.db.UpdateAnchorRecord(&record); err != nil {
+				return err
+			}
+			break
+		}
+	}
+
 	return nil
 }
 
+func (e *endorser) AnchorIssued(submitter []byte, seq uint64, lastTx [64]byte, shardId []byte, a *dto.Anchor) error {
+	if a == nil {
+		return fmt.Errorf("nil anchor")
+	}
+	return e.db.AddAnchorRecord(&repo.AnchorRecord{
+		Submitter:   submitter,
+		Seq:         seq,
+		LastTx:      lastTx,
+		ShardId:     shardId,
+		ShardParent: a.ShardParent,
+		ShardSeq:    a.ShardSeq,
+		Signature:   a.Signature,
+		IssuedAt:    time.Now().UnixNano(),
+	})
+}
+
+func (e *endorser) AnchorAudit(submitter []byte) []repo.AnchorRecord {
+	// walk through each sequence anchored for the submitter still within audit depth, in order
+	records := []repo.AnchorRecord{}
+	seq, max := uint64(1), e.db.GetAnchorMaxSeq(submitter)
+	if repo.AnchorAuditDepth > 0 && max > repo.AnchorAuditDepth {
+		seq = max - repo.AnchorAuditDepth + 1
+	}
+	for ; seq <= max; seq++ {
+		records = append(records, e.db.GetAnchorRecords(submitter, seq)...)
+	}
+	return records
+}
+
+func (e *endorser) AbandonedAnchors(submitter []byte) []repo.AnchorRecord {
+	abandoned := []repo.AnchorRecord{}
+	for _, record := range e.AnchorAudit(submitter) {
+		if !record.Consumed {
+			abandoned = append(abandoned, record)
+		}
+	}
+	return abandoned
+}
+
+func (e *endorser) SetRateLimits(submitted, network *RateLimit) {
+	e.submitted, e.network = newRateLimiter(submitted), newRateLimiter(network)
+}
+
+func (e *endorser) Throttled() (submitted, network uint64) {
+	return e.submitted.count(), e.network.count()
+}
+
 func (e *endorser) KnownShardsTxs(submitter []byte, seq uint64) (shards [][]byte, txs [][64]byte) {
 	// initialize empty lists
 	shards, txs = [][]byte{}, [][64]byte{}
@@ -187,6 +273,12 @@ func (e *endorser) KnownShardsTxs(submitter []byte, seq uint64) (shards [][]byte
 	return
 }
 
+func (e *endorser) WithBatch(batch repo.Batch) Endorser {
+	view := *e
+	view.db = batch
+	return &view
+}
+
 func NewEndorser(db repo.DltDb) (*endorser, error) {
 	return &endorser{
 		db: db,
@@ -645,3 +645,66 @@ func TestKnownShardsTxs_UnknownSequence(t *testing.T) {
 		t.Errorf("Incorrect method call count: %d", testDb.GetSubmitterHistoryCount)
 	}
 }
+
+// AnchorIssued records the anchor in audit trail
+func TestAnchorIssued_AuditTrail(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	e, _ := NewEndorser(testDb)
+
+	submitter := []byte("test submitter")
+	a := dto.TestAnchor()
+	a.Signature = []byte("test anchor signature")
+	if err := e.AnchorIssued(submitter, 0x02, [64]byte{}, []byte("test shard"), a); err != nil {
+		t.Errorf("Failed to record anchor: %s", err)
+	}
+
+	// validate that audit record was saved
+	if testDb.AddAnchorRecordCount != 1 {
+		t.Errorf("Incorrect method call count: %d", testDb.AddAnchorRecordCount)
+	}
+
+	// audit trail should have the issued anchor as not consumed
+	records := e.AnchorAudit(submitter)
+	if len(records) != 1 {
+		t.Errorf("incorrect number of records: %d", len(records))
+	} else if records[0].Seq != 0x02 || records[0].Consumed || string(records[0].Signature) != string(a.Signature) {
+		t.Errorf("incorrect audit record: %v", records[0])
+	} else if records[0].IssuedAt == 0 {
+		t.Errorf("audit record does not have issue timestamp")
+	}
+	if len(e.AbandonedAnchors(submitter)) != 1 {
+		t.Errorf("issued anchor should be reported as abandoned")
+	}
+}
+
+// Update marks the transaction's anchor as consumed in audit trail
+func TestUpdate_AnchorConsumed(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	e, _ := NewEndorser(testDb)
+
+	// issue two anchors for same submitter/seq
+	tx := dto.TestSignedTransaction("test data")
+	tx.Anchor().Signature = []byte("test anchor signature")
+	e.AnchorIssued(tx.Request().SubmitterId, tx.Request().SubmitterSeq, tx.Request().LastTx, tx.Request().ShardId, tx.Anchor())
+	unused := dto.TestAnchor()
+	unused.Signature = []byte("unused anchor signature")
+	e.AnchorIssued(tx.Request().SubmitterId, tx.Request().SubmitterSeq, tx.Request().LastTx, tx.Request().ShardId, unused)
+
+	// update submitter history with transaction using first anchor
+	if err := e.Update(tx); err != nil {
+		t.Errorf("Failed to update transaction: %s", err)
+	}
+
+	// first anchor should be consumed, second one abandoned
+	records := e.AnchorAudit(tx.Request().SubmitterId)
+	if len(records) != 2 {
+		t.Errorf("incorrect number of records: %d", len(records))
+	} else if !records[0].Consumed || records[0].TxId != tx.Id() {
+		t.Errorf("anchor not marked consumed: %v", records[0])
+	}
+	if abandoned := e.AbandonedAnchors(tx.Request().SubmitterId); len(abandoned) != 1 {
+		t.Errorf("incorrect number of abandoned anchors: %d", len(abandoned))
+	} else if string(abandoned[0].Signature) != string(unused.Signature) {
+		t.Errorf("incorrect abandoned anchor: %x", abandoned[0].Signature)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 The trust-net Authors
+// Per submitter rate limiting of transactions, using token buckets keyed by submitter ID
+package endorsement
+
+import (
+	"sync"
+	"time"
+)
+
+// rate limit of a submitter's transactions, a token bucket refilled at Rate transactions per second up to
+// Burst transactions (at least 1)
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// tokens available to a submitter, as of last update
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// token buckets of submitters, and number of transactions throttled
+type rateLimiter struct {
+	limit     RateLimit
+	buckets   map[string]*tokenBucket
+	throttled uint64
+	lock      sync.Mutex
+}
+
+// max number of submitter buckets tracked, buckets that are full again are dropped beyond this
+var MaxRateLimitedSubmitters = 10000
+
+// create a rate limiter, nil (i.e. no limit) for a limit with no rate
+func newRateLimiter(limit *RateLimit) *rateLimiter {
+	if limit == nil || limit.Rate <= 0 {
+		return nil
+	}
+	r := &rateLimiter{
+		limit:   *limit,
+		buckets: make(map[string]*tokenBucket),
+	}
+	if r.limit.Burst < 1 {
+		r.limit.Burst = 1
+	}
+	return r
+}
+
+// take a token for a submitter's transaction, returns false (and counts transaction as throttled) if
+// submitter has no tokens left
+func (r *rateLimiter) allow(submitter []byte) bool {
+	if r == nil {
+		return true
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	now := time.Now()
+	b, found := r.buckets[string(submitter)]
+	if !found {
+		if len(r.buckets) >= MaxRateLimitedSubmitters {
+			r.evict(now)
+		}
+		b = &tokenBucket{tokens: float64(r.limit.Burst), last: now}
+		r.buckets[string(submitter)] = b
+	}
+	b.refill(now, r.limit)
+	if b.tokens < 1 {
+		r.throttled += 1
+		return false
+	}
+	b.tokens -= 1
+	return true
+}
+
+// drop buckets of submitters that have refilled to burst, they'd be created again as full
+func (r *rateLimiter) evict(now time.Time) {
+	for id, b := range r.buckets {
+		if b.refill(now, r.limit); b.tokens >= float64(r.limit.Burst) {
+			delete(r.buckets, id)
+		}
+	}
+}
+
+func (r *rateLimiter) count() uint64 {
+	if r == nil {
+		return 0
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.throttled
+}
+
+func (b *tokenBucket) refill(now time.Time, limit RateLimit) {
+	b.tokens += now.Sub(b.last).Seconds() * limit.Rate
+	if b.tokens > float64(limit.Burst) {
+		b.tokens = float64(limit.Burst)
+	}
+	b.last = now
+}
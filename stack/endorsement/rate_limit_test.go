@@ -0,0 +1,92 @@
+// Copyright 2019 The trust-net Authors
+package endorsement
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	if newRateLimiter(nil) != nil || newRateLimiter(&RateLimit{Burst: 5}) != nil {
+		t.Errorf("limit with no rate should not create a limiter")
+	}
+	r := newRateLimiter(&RateLimit{Rate: 10, Burst: 2})
+	for i := 0; i < 2; i++ {
+		if !r.allow([]byte("submitter 1")) {
+			t.Errorf("transaction within burst throttled")
+		}
+	}
+	if r.allow([]byte("submitter 1")) {
+		t.Errorf("transaction above burst not throttled")
+	}
+	// other submitters should have their own buckets
+	if !r.allow([]byte("submitter 2")) {
+		t.Errorf("transaction of other submitter throttled")
+	}
+	// bucket should refill at rate
+	r.buckets["submitter 1"].last = time.Now().Add(-150 * time.Millisecond)
+	if !r.allow([]byte("submitter 1")) {
+		t.Errorf("transaction not allowed after refill")
+	}
+	if r.count() != 1 {
+		t.Errorf("incorrect throttle count: %d", r.count())
+	}
+}
+
+// buckets of idle submitters should be evicted when tracking max submitters
+func TestRateLimiter_Evict(t *testing.T) {
+	defer func(max int) { MaxRateLimitedSubmitters = max }(MaxRateLimitedSubmitters)
+	MaxRateLimitedSubmitters = 2
+	r := newRateLimiter(&RateLimit{Rate: 1, Burst: 1})
+	r.allow([]byte("submitter 1"))
+	r.allow([]byte("submitter 2"))
+	r.buckets["submitter 1"].last = time.Now().Add(-time.Second)
+	r.allow([]byte("submitter 3"))
+	if _, found := r.buckets["submitter 1"]; found || len(r.buckets) != 2 {
+		t.Errorf("idle submitter not evicted")
+	}
+}
+
+// submissions above submitter's rate limit should be rejected
+func TestTxApprover_RateLimit(t *testing.T) {
+	e, _ := NewEndorser(repo.NewMockDltDb())
+	e.SetRateLimits(&RateLimit{Rate: 1, Burst: 1}, nil)
+	tx := dto.TestSignedTransaction("test data")
+	if err := e.Approve(tx); err != nil {
+		t.Errorf("Transacton approval failed: %s", err)
+	}
+	if err := e.Approve(tx); dto.ErrorCodeOf(err) != dto.ErrRateLimited {
+		t.Errorf("Transaction above rate limit not throttled: %v", err)
+	}
+	if submitted, network := e.Throttled(); submitted != 1 || network != 0 {
+		t.Errorf("Incorrect throttle counts: %d, %d", submitted, network)
+	}
+}
+
+// network transactions above submitter's rate limit should be rejected, duplicates should not be throttled
+func TestTxHandler_RateLimit(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	e, _ := NewEndorser(testDb)
+	e.SetRateLimits(nil, &RateLimit{Rate: 1, Burst: 1})
+	submitter := dto.TestSubmitter()
+	tx1 := submitter.NewTransaction(dto.TestAnchor(), "test data")
+	if res, err := e.Handle(tx1); err != nil || res != SUCCESS {
+		t.Errorf("Transacton handling failed: %s", err)
+	}
+	if res, _ := e.Handle(tx1); res != ERR_DUPLICATE {
+		t.Errorf("Duplicate transaction not detected: %d", res)
+	}
+	submitter.ShardId = []byte("other shard")
+	tx2 := submitter.NewTransaction(dto.TestAnchor(), "test data")
+	if res, err := e.Handle(tx2); res != ERR_THROTTLED || dto.ErrorCodeOf(err) != dto.ErrRateLimited {
+		t.Errorf("Transaction above rate limit not throttled: %d, %v", res, err)
+	}
+	if testDb.GetTx(tx2.Id()) != nil {
+		t.Errorf("Throttled transaction saved")
+	}
+	if submitted, network := e.Throttled(); submitted != 0 || network != 1 {
+		t.Errorf("Incorrect throttle counts: %d, %d", submitted, network)
+	}
+}
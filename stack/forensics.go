@@ -0,0 +1,151 @@
+// Copyright 2019 The trust-net Authors
+// Forensic records of detected double spends
+package stack
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"time"
+)
+
+// resolution decisions of a double spend
+const (
+	// local transaction won, peer was alerted to flush its shard
+	RESOLUTION_PEER_FLUSH = "peer_flush"
+	// remote transaction won, local shard was flushed and re-synced with peer
+	RESOLUTION_LOCAL_FLUSH = "local_flush"
+	// remote transaction won, local transaction's sub-DAG was rolled back and shard re-synced with peer
+	RESOLUTION_LOCAL_ROLLBACK = "local_rollback"
+	// transaction was submitted locally over an existing transaction, and rejected
+	RESOLUTION_REJECTED = "rejected"
+)
+
+// evidence of two conflicting transactions of a submitter, for same sequence on same shard
+type DoubleSpendEvidence struct {
+	Submitter []byte
+	Seq       uint64
+	ShardId   []byte
+	// transaction already known to node
+	ExistingTx [64]byte
+	// transaction conflicting with existing transaction
+	ConflictingTx [64]byte
+	// ID of peer that sent the conflicting transaction (nil for a local submission)
+	PeerId []byte
+	// resolution of the double spend, and transaction that won
+	Resolution string
+	Winner     [64]byte
+	DetectedAt time.Time
+}
+
+// persist forensic record of a resolved double spend and notify app subscribers
+func (d *dlt) recordDoubleSpend(peer p2p.Peer, localTx, remoteTx dto.Transaction, resolution string) {
+	record := &repo.ForensicRecord{
+		Submitter:     remoteTx.Request().SubmitterId,
+		Seq:           remoteTx.Request().SubmitterSeq,
+		ShardId:       remoteTx.Request().ShardId,
+		LocalRequest:  localTx.Request(),
+		LocalAnchor:   localTx.Anchor(),
+		RemoteRequest: remoteTx.Request(),
+		RemoteAnchor:  remoteTx.Anchor(),
+		PeerId:        peer.ID(),
+		Resolution:    resolution,
+		DetectedAt:    time.Now().UnixNano(),
+	}
+	if peer.RemoteAddr() != nil {
+		record.PeerAddr = peer.RemoteAddr().String()
+	}
+	if resolution == RESOLUTION_PEER_FLUSH {
+		record.Winner = localTx.Id()
+	} else {
+		record.Winner = remoteTx.Id()
+	}
+	if err := d.db.AddForensicRecord(record); err != nil {
+		peer.Logger().Error("Failed to save double spend forensic record: %s", err)
+	}
+	d.countDoubleSpend()
+	d.publishDoubleSpend(&DoubleSpendEvidence{
+		Submitter:     record.Submitter,
+		Seq:           record.Seq,
+		ShardId:       record.ShardId,
+		ExistingTx:    localTx.Id(),
+		ConflictingTx: remoteTx.Id(),
+		PeerId:        record.PeerId,
+		Resolution:    resolution,
+		Winner:        record.Winner,
+		DetectedAt:    time.Unix(0, record.DetectedAt),
+	})
+}
+
+// notify app subscribers of a double spend
+func (d *dlt) publishDoubleSpend(evidence *DoubleSpendEvidence) {
+	detail := fmt.Sprintf("double spend with local transaction %x", evidence.ExistingTx)
+	if len(evidence.Resolution) > 0 {
+		detail += ", resolution: " + evidence.Resolution
+	}
+	d.subs.publish(&Event{
+		Type:        EVENT_DOUBLE_SPEND,
+		TxId:        evidence.ConflictingTx,
+		ShardId:     evidence.ShardId,
+		Detail:      detail,
+		DoubleSpend: evidence,
+	})
+}
+
+// report a submission rejected for double spending against a transaction already in submitter's history
+func (d *dlt) rejectedDoubleSpend(tx dto.Transaction) {
+	req := tx.Request()
+	history := d.db.GetSubmitterHistory(req.SubmitterId, req.SubmitterSeq)
+	if history == nil {
+		return
+	}
+	for _, pair := range history.ShardTxPairs {
+		if string(pair.ShardId) == string(req.ShardId) && pair.TxId != tx.Id() {
+			d.publishDoubleSpend(&DoubleSpendEvidence{
+				Submitter:     req.SubmitterId,
+				Seq:           req.SubmitterSeq,
+				ShardId:       req.ShardId,
+				ExistingTx:    pair.TxId,
+				ConflictingTx: tx.Id(),
+				Resolution:    RESOLUTION_REJECTED,
+				Winner:        pair.TxId,
+				DetectedAt:    time.Now(),
+			})
+			return
+		}
+	}
+}
+
+func (d *dlt) OnDoubleSpend(handler func(evidence DoubleSpendEvidence)) uint64 {
+	return d.subs.add(func(e *Event) {
+		if e.Type == EVENT_DOUBLE_SPEND && e.DoubleSpend != nil {
+			handler(*e.DoubleSpend)
+		}
+	})
+}
+
+// roll back local transaction that lost a double spend to remote transaction, along with its shard DAG
+// descendants, flushing the shard when it cannot be rolled back in place (world state must be locked)
+func (d *dlt) rollback(peer p2p.Peer, localTx, remoteTx dto.Transaction) (string, error) {
+	if res, err := d.sharder.Resolve(localTx, remoteTx); err != nil {
+		peer.Logger().Error("Failed to roll back local transaction, flushing shard: %s", err)
+		if err := d.sharder.Flush(remoteTx.Request().ShardId); err != nil {
+			return "", err
+		}
+		d.setStatus(localTx.Id(), TX_ORPHANED, fmt.Sprintf("lost conflict to transaction %x", remoteTx.Id()))
+		return RESOLUTION_LOCAL_FLUSH, nil
+	} else {
+		peer.Logger().Debug("Rolled back %d local transactions, replayed %d transactions", len(res.Pruned), len(res.Replayed))
+		for _, id := range res.Pruned {
+			d.setStatus(id, TX_ORPHANED, fmt.Sprintf("rolled back after conflict with transaction %x", remoteTx.Id()))
+		}
+		return RESOLUTION_LOCAL_ROLLBACK, nil
+	}
+}
+
+func (d *dlt) Forensics() []repo.ForensicRecord {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.db.GetForensicRecords()
+}
@@ -0,0 +1,135 @@
+// Copyright 2019 The trust-net Authors
+// Golden fixtures of a shard's history, for regression testing of endorsement and sharding logic
+package golden
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/endorsement"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io/ioutil"
+)
+
+// a shard's canonical transaction sequence and resulting world state root
+type Fixture struct {
+	ShardId []byte `json:"shard_id"`
+	// serialized transactions in canonical order
+	Transactions [][]byte `json:"transactions"`
+	// root of shard's world state after all transactions are applied
+	StateRoot []byte `json:"state_root"`
+}
+
+// create a fixture from transactions in canonical order, with state root as produced by current code
+func NewFixture(shardId []byte, txs []dto.Transaction, txHandler func(tx dto.Transaction, state state.State) error) (*Fixture, error) {
+	f := &Fixture{
+		ShardId:      shardId,
+		Transactions: make([][]byte, 0, len(txs)),
+	}
+	for _, tx := range txs {
+		if data, err := tx.Serialize(); err != nil {
+			return nil, err
+		} else {
+			f.Transactions = append(f.Transactions, data)
+		}
+	}
+	root, err := f.Replay(txHandler)
+	if err != nil {
+		return nil, err
+	}
+	f.StateRoot = root[:]
+	return f, nil
+}
+
+// record a fixture from a shard's log on a DLT stack (app must use stack managed world state)
+func Record(dlt stack.DLT, shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) (*Fixture, error) {
+	txs, _, err := dlt.ShardLog(shardId, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	return NewFixture(shardId, txs, txHandler)
+}
+
+// replay fixture's transactions through fresh endorsement and sharding layers,
+// same as transactions received from network, and return resulting state root
+func (f *Fixture) Replay(txHandler func(tx dto.Transaction, state state.State) error) ([64]byte, error) {
+	root := [64]byte{}
+	dbp := db.NewInMemDbProvider()
+	defer dbp.CloseAll()
+	dltDb, err := repo.NewDltDb(dbp)
+	if err != nil {
+		return root, err
+	}
+	endorser, _ := endorsement.NewEndorser(dltDb)
+	sharder, _ := shard.NewSharder(dltDb, dbp)
+	if err := sharder.Register(f.ShardId, txHandler); err != nil {
+		return root, err
+	}
+	for i, data := range f.Transactions {
+		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+		if err := tx.DeSerialize(data); err != nil {
+			return root, fmt.Errorf("transaction %d: %s", i, err)
+		}
+		if err := f.apply(endorser, sharder, tx); err != nil {
+			return root, fmt.Errorf("transaction %d (%x): %s", i, tx.Id(), err)
+		}
+	}
+	s, err := state.NewWorldState(dbp, f.ShardId)
+	if err != nil {
+		return root, err
+	}
+	return s.Root()
+}
+
+func (f *Fixture) apply(endorser endorsement.Endorser, sharder shard.Sharder, tx dto.Transaction) error {
+	if _, err := endorser.Handle(tx); err != nil {
+		return err
+	}
+	if err := sharder.LockState(); err != nil {
+		return err
+	}
+	defer sharder.UnlockState()
+	if err := sharder.Handle(tx); err != nil {
+		return err
+	}
+	if err := endorser.Update(tx); err != nil {
+		return err
+	}
+	return sharder.CommitState(tx)
+}
+
+// replay fixture through current code and verify that resulting state is identical to recorded state
+func (f *Fixture) Verify(txHandler func(tx dto.Transaction, state state.State) error) error {
+	if root, err := f.Replay(txHandler); err != nil {
+		return err
+	} else if string(root[:]) != string(f.StateRoot) {
+		return fmt.Errorf("state root mismatch: %x\nExpected: %x", root, f.StateRoot)
+	}
+	return nil
+}
+
+// save fixture to a file
+func (f *Fixture) Save(file string) error {
+	if data, err := json.MarshalIndent(f, "", "  "); err != nil {
+		return err
+	} else {
+		return ioutil.WriteFile(file, data, 0644)
+	}
+}
+
+// load fixture from a file
+func Load(file string) (*Fixture, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	f := &Fixture{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
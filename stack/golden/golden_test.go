@@ -0,0 +1,89 @@
+// Copyright 2019 The trust-net Authors
+package golden
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// a chain of transactions from a submitter, each child of previous in shard DAG
+func testChain(count int) []dto.Transaction {
+	submitter := dto.TestSubmitter()
+	parent := shard.GenesisShardTx(submitter.ShardId).Id()
+	txs := []dto.Transaction{}
+	for i := 0; i < count; i++ {
+		a := dto.TestAnchor()
+		a.ShardParent, a.ShardSeq = parent, uint64(i+1)
+		tx := submitter.NewTransaction(a, fmt.Sprintf("payload %d", i))
+		txs = append(txs, tx)
+		parent = tx.Id()
+		submitter.Seq, submitter.LastTx = submitter.Seq+1, tx.Id()
+	}
+	return txs
+}
+
+// app handler saving each payload as a resource
+func testHandler(tx dto.Transaction, s state.State) error {
+	return s.Put(&state.Resource{Key: tx.Request().Payload, Value: tx.Request().SubmitterId})
+}
+
+func TestFixture_Verify(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	txs := testChain(3)
+	f, err := NewFixture(txs[0].Request().ShardId, txs, testHandler)
+	if err != nil {
+		t.Errorf("failed to create fixture: %s", err)
+		return
+	}
+	if len(f.Transactions) != 3 || len(f.StateRoot) != 64 {
+		t.Errorf("incorrect fixture: %d / %x", len(f.Transactions), f.StateRoot)
+	}
+	if err := f.Verify(testHandler); err != nil {
+		t.Errorf("fixture verification failed: %s", err)
+	}
+	// a change in behavior should be detected
+	changed := func(tx dto.Transaction, s state.State) error {
+		return s.Put(&state.Resource{Key: tx.Request().Payload, Value: []byte("changed")})
+	}
+	if err := f.Verify(changed); err == nil {
+		t.Errorf("did not detect changed state")
+	}
+}
+
+func TestFixture_VerifyOutOfOrder(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	txs := testChain(2)
+	f, _ := NewFixture(txs[0].Request().ShardId, txs, testHandler)
+	f.Transactions[0], f.Transactions[1] = f.Transactions[1], f.Transactions[0]
+	if err := f.Verify(testHandler); err == nil {
+		t.Errorf("did not detect out of order transactions")
+	}
+}
+
+func TestFixture_SaveLoad(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dir, _ := ioutil.TempDir("", "golden")
+	defer os.RemoveAll(dir)
+	txs := testChain(2)
+	f, _ := NewFixture(txs[0].Request().ShardId, txs, testHandler)
+	file := filepath.Join(dir, "shard.golden.json")
+	if err := f.Save(file); err != nil {
+		t.Errorf("failed to save fixture: %s", err)
+		return
+	}
+	loaded, err := Load(file)
+	if err != nil {
+		t.Errorf("failed to load fixture: %s", err)
+		return
+	}
+	if err := loaded.Verify(testHandler); err != nil {
+		t.Errorf("loaded fixture verification failed: %s", err)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 The trust-net Authors
+// Handoff of a node's data directory and p2p identity between instances, for rolling restarts
+package stack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/version"
+	"net"
+	"os"
+	"time"
+)
+
+// request from a new instance to take over from the running instance
+type handoffRequest struct {
+	Op      string       `json:"op"`
+	Version version.Info `json:"version"`
+}
+
+// details of the instance that released its resources for handoff
+type HandoffInfo struct {
+	// p2p identity and name of the node, that new instance resumes with same key file
+	NodeId string `json:"node_id"`
+	Name   string `json:"name"`
+	Port   string `json:"listen_port"`
+	// build version of the released instance
+	Version version.Info `json:"version"`
+	// reason of failure, when handoff was refused
+	Error string `json:"error,omitempty"`
+}
+
+// a running instance's handoff listener
+type HandoffServer struct {
+	listener net.Listener
+	path     string
+}
+
+// stop listening for handoff requests
+func (s *HandoffServer) Close() error {
+	err := s.listener.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// listen for a handoff request from a new instance on a unix socket (e.g. in node's data directory),
+// upon request the stack is stopped (disconnecting peers, stopping node tasks and closing all DBs of
+// storage provider, which flushes and releases their locks), the new instance is sent the node's details,
+// and released is called so that application can exit
+func (d *dlt) ServeHandoff(path string, released func(info *HandoffInfo)) (*HandoffServer, error) {
+	// remove a stale socket left by an instance that did not exit cleanly
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("handoff socket in use: %s", path)
+	}
+	os.Remove(path)
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	server := &HandoffServer{listener: listener, path: path}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			if info := d.handoff(conn); info != nil {
+				server.Close()
+				if released != nil {
+					released(info)
+				}
+				return
+			}
+		}
+	}()
+	return server, nil
+}
+
+// handle a handoff request, returns details of released instance, or nil if request was refused
+func (d *dlt) handoff(conn net.Conn) *HandoffInfo {
+	defer conn.Close()
+	req := &handoffRequest{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil || req.Op != "handoff" {
+		json.NewEncoder(conn).Encode(&HandoffInfo{Error: "invalid handoff request"})
+		return nil
+	}
+	d.logger.Info("Handing off to new instance, version: %s", req.Version.Semver)
+	info := &HandoffInfo{
+		NodeId:  hex.EncodeToString(d.p2p.Id()),
+		Name:    d.conf.Name,
+		Port:    d.conf.Port,
+		Version: version.Get(),
+	}
+	d.Stop()
+	if err := json.NewEncoder(conn).Encode(info); err != nil {
+		d.logger.Error("Failed to respond to handoff request: %s", err)
+	}
+	return info
+}
+
+// request the running instance listening at a handoff socket to release node's data directory and
+// p2p identity, returns after running instance has released its resources, so that new instance can
+// create its stack over same storage and config
+func RequestHandoff(path string, timeout time.Duration) (*HandoffInfo, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := json.NewEncoder(conn).Encode(&handoffRequest{Op: "handoff", Version: version.Get()}); err != nil {
+		return nil, err
+	}
+	info := &HandoffInfo{}
+	if err := json.NewDecoder(conn).Decode(info); err != nil {
+		return nil, fmt.Errorf("no handoff response: %s", err)
+	} else if len(info.Error) > 0 {
+		return nil, fmt.Errorf("handoff refused: %s", info.Error)
+	}
+	return info, nil
+}
@@ -0,0 +1,104 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/dbp"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// create a stack with mock p2p layer over a leveldb data directory
+func handoffStack(t *testing.T, dir string) *dlt {
+	provider, err := dbp.NewDbp(dir)
+	if err != nil {
+		t.Fatalf("failed to create db provider: %s", err)
+	}
+	stack, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(provider))
+	if err != nil {
+		t.Fatalf("failed to create stack: %s", err)
+	}
+	stack.p2p = p2p.TestP2PLayer("mock p2p")
+	app := TestAppConfig()
+	if err := stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil }); err != nil {
+		t.Fatalf("failed to register app: %s", err)
+	}
+	return stack
+}
+
+// test that a new instance takes over data directory after old instance releases it
+func TestHandoff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "handoff")
+	defer os.RemoveAll(dir)
+	old := handoffStack(t, filepath.Join(dir, "data"))
+	tx, err := old.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("submission failed: %s", err)
+	}
+	released := make(chan *HandoffInfo, 1)
+	socket := filepath.Join(dir, "handoff.sock")
+	if _, err := old.ServeHandoff(socket, func(info *HandoffInfo) { released <- info }); err != nil {
+		t.Fatalf("failed to serve handoff: %s", err)
+	}
+
+	// new instance requests handoff
+	info, err := RequestHandoff(socket, time.Second)
+	if err != nil {
+		t.Fatalf("handoff failed: %s", err)
+	} else if info.NodeId != hex.EncodeToString(old.p2p.Id()) || info.Name != old.conf.Name {
+		t.Errorf("incorrect handoff info: %+v", info)
+	}
+	select {
+	case <-released:
+	case <-time.After(time.Second):
+		t.Errorf("old instance not notified of release")
+	}
+	if !old.p2p.(*p2p.MockP2P).IsStopped {
+		t.Errorf("old instance not stopped")
+	}
+
+	// new instance should open same data directory, with old instance's data
+	resumed := handoffStack(t, filepath.Join(dir, "data"))
+	defer resumed.Stop()
+	if resumed.db.GetTx(tx.Id()) == nil {
+		t.Errorf("transaction not found after handoff")
+	}
+	// socket should be removed after handoff
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("handoff socket not removed")
+	}
+}
+
+// test that invalid handoff requests are refused, and running instance continues
+func TestHandoff_Invalid(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "handoff")
+	defer os.RemoveAll(dir)
+	stack, _, _, mockP2P := initMocks()
+	socket := filepath.Join(dir, "handoff.sock")
+	server, err := stack.ServeHandoff(socket, nil)
+	if err != nil {
+		t.Fatalf("failed to serve handoff: %s", err)
+	}
+	defer server.Close()
+	// another instance can not listen on same socket
+	if _, err := stack.ServeHandoff(socket, nil); err == nil {
+		t.Errorf("socket in use should fail")
+	}
+	conn, _ := net.Dial("unix", socket)
+	conn.Write([]byte("{\"op\": \"unknown\"}\n"))
+	data, _ := ioutil.ReadAll(conn)
+	conn.Close()
+	if len(data) == 0 || mockP2P.IsStopped {
+		t.Errorf("invalid request should be refused: %s", data)
+	}
+	if _, err := RequestHandoff(filepath.Join(dir, "missing.sock"), time.Second); err == nil {
+		t.Errorf("handoff without running instance should fail")
+	}
+}
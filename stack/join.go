@@ -0,0 +1,155 @@
+// Copyright 2019 The trust-net Authors
+// Joining an existing shard by syncing its history from peers, before registering an app for it
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"sync"
+	"time"
+)
+
+// error returned when shard's history could not be synced from peers within timeout
+var ErrJoinTimeout = errors.New("timed out joining shard")
+
+// progress of joining a shard
+type shardJoin struct {
+	// true once a peer carrying the shard has responded
+	responded bool
+	// true once shard's history is synced
+	done bool
+}
+
+// shards joined by node, stored regardless of storage filter
+type shardJoins struct {
+	shards map[string]*shardJoin
+	lock   sync.RWMutex
+}
+
+func newShardJoins() *shardJoins {
+	return &shardJoins{
+		shards: make(map[string]*shardJoin),
+	}
+}
+
+func (j *shardJoins) start(shardId []byte) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.shards[string(shardId)] = &shardJoin{}
+}
+
+// record response of a peer to a joining shard's tips request
+func (j *shardJoins) respond(shardId []byte) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if join, found := j.shards[string(shardId)]; found {
+		join.responded = true
+	}
+}
+
+func (j *shardJoins) responded(shardId []byte) bool {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	join, found := j.shards[string(shardId)]
+	return found && join.responded
+}
+
+func (j *shardJoins) finish(shardId []byte, done bool) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if !done {
+		delete(j.shards, string(shardId))
+	} else if join, found := j.shards[string(shardId)]; found {
+		join.done = true
+	}
+}
+
+// check whether a shard's join is in progress
+func (j *shardJoins) joining(shardId []byte) bool {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	join, found := j.shards[string(shardId)]
+	return found && !join.done
+}
+
+// check whether a shard is being joined or was joined
+func (j *shardJoins) member(shardId []byte) bool {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	_, found := j.shards[string(shardId)]
+	return found
+}
+
+// shards being joined or joined
+func (j *shardJoins) members() [][]byte {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	shards := make([][]byte, 0, len(j.shards))
+	for shardId := range j.shards {
+		shards = append(shards, []byte(shardId))
+	}
+	return shards
+}
+
+// check whether a joining shard's history is synced (called with lock held)
+func (d *dlt) joinSynced(shardId []byte) bool {
+	if !d.joins.responded(shardId) || d.syncs.syncing(shardId) || !d.shardKnown(shardId) {
+		return false
+	}
+	// history must reach shard's trusted checkpoint, if any
+	if cp := d.sharder.Checkpoint(shardId); cp != nil && d.db.GetShardDagNode(cp.TxId) == nil {
+		return false
+	}
+	return true
+}
+
+func (d *dlt) JoinShard(shardId []byte, timeout time.Duration) (*repo.ShardInfo, error) {
+	if len(shardId) == 0 {
+		return nil, errors.New("missing shard id")
+	}
+	d.lock.Lock()
+	if d.registered(shardId) != nil {
+		d.lock.Unlock()
+		return nil, errors.New("app is already registered for shard")
+	}
+	if d.joins.joining(shardId) {
+		d.lock.Unlock()
+		return nil, errors.New("shard join already in progress")
+	}
+	// locate peers carrying the shard, they respond with shard's sync message, upon which
+	// node syncs shard's history from them
+	d.joins.start(shardId)
+	d.announceShards()
+	msg := NewShardTipsRequestMsg(shardId)
+	d.logger.Debug("Requesting tips of shard to join from peers: %x", shardId)
+	d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+	d.lock.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		d.lock.Lock()
+		synced := d.joinSynced(shardId)
+		d.lock.Unlock()
+		if synced {
+			break
+		}
+		if !time.Now().Before(deadline) {
+			if !d.joins.responded(shardId) {
+				d.logger.Debug("No peer carrying the shard to join: %x", shardId)
+			}
+			d.joins.finish(shardId, false)
+			return nil, ErrJoinTimeout
+		}
+		wait := WaitPollInterval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		time.Sleep(wait)
+	}
+	d.joins.finish(shardId, true)
+	d.logger.Info("Joined shard: %x", shardId)
+	if info := d.db.GetShardInfo(shardId); info != nil {
+		return info, nil
+	}
+	return &repo.ShardInfo{ShardId: shardId}, nil
+}
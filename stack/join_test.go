@@ -0,0 +1,124 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+// build a transaction of a shard, submitted by a remote node registered for the shard
+func remoteShardTx(t *testing.T, shardId []byte) dto.Transaction {
+	remote, _, _, _ := initMocks()
+	remote.Unregister()
+	remote.Register(shardId, "remote app", func(tx dto.Transaction, state state.State) error { return nil })
+	submitter := dto.TestSubmitter()
+	req := submitter.NewRequest("remote tx")
+	req.ShardId = shardId
+	tx, err := remote.Submit(req)
+	if err != nil {
+		t.Fatalf("remote submission failed: %s", err)
+	}
+	return tx
+}
+
+// joining a shard that no peer carries should time out
+func TestJoinShard_NoPeers(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	stack.Unregister()
+
+	if _, err := stack.JoinShard([]byte("remote shard"), 50*time.Millisecond); err != ErrJoinTimeout {
+		t.Errorf("expected join timeout, got: %s", err)
+	}
+	if !p2pLayer.DidBroadcast || p2pLayer.BroadcastCode != ShardTipsRequestMsgCode {
+		t.Errorf("did not request shard's tips from peers")
+	} else if msg := p2pLayer.BroadcastMsg.(*ShardTipsRequestMsg); string(msg.ShardId) != "remote shard" {
+		t.Errorf("incorrect shard in tips request: %s", msg.ShardId)
+	}
+	// app can register for shard after a failed join
+	if err := stack.Register([]byte("remote shard"), "app", func(tx dto.Transaction, state state.State) error { return nil }); err != nil {
+		t.Errorf("failed to register after failed join: %s", err)
+	}
+}
+
+// joining a shard should return after shard's history is synced from a peer carrying it
+func TestJoinShard_Synced(t *testing.T) {
+	shardId := []byte("remote shard")
+	tx := remoteShardTx(t, shardId)
+	stack, _, _, _ := initMocks()
+	stack.Unregister()
+
+	type result struct {
+		info *repo.ShardInfo
+		err  error
+	}
+	joined := make(chan result, 1)
+	go func() {
+		info, err := stack.JoinShard(shardId, 5*time.Second)
+		joined <- result{info, err}
+	}()
+	for !stack.joins.joining(shardId) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// app registration is refused while shard is being joined
+	if err := stack.Register(shardId, "app", func(tx dto.Transaction, state state.State) error { return nil }); err == nil {
+		t.Errorf("should not register app while shard is being joined")
+		stack.Unregister()
+	}
+
+	// a peer responds and its shard history is synced, while join is waiting
+	stack.lock.Lock()
+	stack.sharder.SyncAnchor(shardId)
+	stack.db.AddTx(tx)
+	stack.db.UpdateShard(tx)
+	stack.joins.respond(shardId)
+	stack.lock.Unlock()
+
+	if res := <-joined; res.err != nil {
+		t.Errorf("failed to join shard: %s", res.err)
+	} else if string(res.info.ShardId) != string(shardId) || res.info.LatestSeq != 1 {
+		t.Errorf("incorrect info of joined shard: %+v", res.info)
+	}
+	if !stack.isStored(shardId) {
+		t.Errorf("joined shard should be stored")
+	}
+
+	// app registered after join replays shard's history
+	replayed := 0
+	if err := stack.Register(shardId, "app", func(tx dto.Transaction, state state.State) error { replayed++; return nil }); err != nil {
+		t.Errorf("failed to register after join: %s", err)
+	} else if replayed != 1 {
+		t.Errorf("incorrect number of replayed transactions: %d", replayed)
+	}
+}
+
+// a peer's shard sync message for a shard being joined should be recorded as response
+func TestRECV_ShardSyncMsg_JoiningShard(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	shardId := []byte("remote shard")
+	stack.joins.start(shardId)
+	stack.filter = func(shardId []byte) bool { return false }
+
+	peer := NewMockPeer(p2p.TestConn())
+	events := make(chan controllerEvent, 10)
+	finished := make(chan struct{}, 2)
+	go func() {
+		stack.peerEventsListener(peer, events)
+		finished <- struct{}{}
+	}()
+	events <- newControllerEvent(RECV_ShardSyncMsg, NewShardSyncMsg(shardId, &dto.Anchor{Weight: 5, ShardSeq: 5}))
+	events <- newControllerEvent(SHUTDOWN, nil)
+	<-finished
+
+	if !stack.joins.responded(shardId) {
+		t.Errorf("response of peer carrying the shard not recorded")
+	}
+	// joining shard is synced even though storage filter excludes it
+	if !peer.SendCalled || peer.SendMsgCode != ShardAncestorRequestMsgCode {
+		t.Errorf("did not initiate sync of joining shard")
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2019 The trust-net Authors
+// Locks keyed by an ID, e.g. of a submitter, for state shared by jobs of different shards
+package stack
+
+import (
+	"sync"
+)
+
+// a lock with count of its holders and waiters, removed when count drops to zero
+type keyedLock struct {
+	lock  sync.Mutex
+	count int
+}
+
+// set of locks keyed by an ID, created on demand so that only jobs with same key exclude each other
+type keyedLocks struct {
+	locks map[string]*keyedLock
+	lock  sync.Mutex
+}
+
+func newKeyedLocks() *keyedLocks {
+	return &keyedLocks{
+		locks: make(map[string]*keyedLock),
+	}
+}
+
+func (k *keyedLocks) Lock(key []byte) {
+	k.lock.Lock()
+	l, found := k.locks[string(key)]
+	if !found {
+		l = &keyedLock{}
+		k.locks[string(key)] = l
+	}
+	l.count += 1
+	k.lock.Unlock()
+	l.lock.Lock()
+}
+
+func (k *keyedLocks) Unlock(key []byte) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	if l, found := k.locks[string(key)]; found {
+		l.lock.Unlock()
+		if l.count -= 1; l.count == 0 {
+			delete(k.locks, string(key))
+		}
+	}
+}
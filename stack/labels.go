@@ -0,0 +1,30 @@
+// Copyright 2019 The trust-net Authors
+// Local labels and notes on transactions, for operators' and clients' bookkeeping (never gossiped)
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+)
+
+func (d *dlt) LabelTx(id [64]byte, labels []string, note string) error {
+	if d.db.GetTx(id) == nil {
+		return ErrTxNotFound
+	}
+	return d.labels.Set(id, labels, note)
+}
+
+func (d *dlt) TxLabels(id [64]byte) *repo.TxLabels {
+	return d.labels.Get(id)
+}
+
+func (d *dlt) LabeledTxs(label string, shardId []byte) []dto.Transaction {
+	txs := []dto.Transaction{}
+	for _, id := range d.labels.TxIds(label) {
+		// skip transactions no longer in node's history (e.g. of a reset shard)
+		if tx := d.db.GetTx(id); tx != nil && (shardId == nil || string(tx.Request().ShardId) == string(shardId)) {
+			txs = append(txs, tx)
+		}
+	}
+	return txs
+}
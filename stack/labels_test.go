@@ -0,0 +1,31 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// labels should only be attached to known transactions, and filter transactions by shard
+func TestLabelTx(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("Submission failed: %s", err)
+	}
+	if err := stack.LabelTx(dto.RandomHash(), []string{"incident"}, ""); err != ErrTxNotFound {
+		t.Errorf("Expected labeling of unknown transaction to fail: %s", err)
+	}
+	if err := stack.LabelTx(tx.Id(), []string{"incident"}, "operator note"); err != nil {
+		t.Fatalf("Failed to label transaction: %s", err)
+	}
+	if labels := stack.TxLabels(tx.Id()); labels == nil || labels.Note != "operator note" {
+		t.Errorf("Incorrect labels: %v", labels)
+	}
+	if txs := stack.LabeledTxs("incident", nil); len(txs) != 1 || txs[0].Id() != tx.Id() {
+		t.Errorf("Incorrect labeled transactions: %d", len(txs))
+	}
+	if txs := stack.LabeledTxs("incident", []byte("another shard")); len(txs) != 0 {
+		t.Errorf("Labeled transactions not filtered by shard: %d", len(txs))
+	}
+}
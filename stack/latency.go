@@ -0,0 +1,319 @@
+// Copyright 2019 The trust-net Authors
+// Tracking of transaction anchoring latencies per shard, with alerts when configured SLOs are breached
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// number of most recent latency samples per shard that percentiles are computed over
+var LatencySamples = 1000
+
+// max number of anchors pending submission, and submissions pending observation by a peer, tracked at a time
+var MaxLatencyTracked = 10000
+
+// time after which an anchor not submitted, or a submission not observed by a peer, is no longer tracked
+var LatencyTrackTimeout = 10 * time.Minute
+
+// max latency (at SLO percentile) from anchor issuance to acceptance of submission, 0 for no SLO
+var AnchorAcceptSLO = time.Duration(0)
+
+// max latency (at SLO percentile) from acceptance of submission to its observation by a peer, 0 for no SLO
+var PeerObservationSLO = time.Duration(0)
+
+// percentile of latencies that SLOs apply to
+var LatencySLOPercentile = 99.0
+
+// min number of samples of a shard before its latencies are checked against SLOs
+var LatencySLOMinSamples = 20
+
+// names of tracked latencies
+const (
+	LatencyAnchorAccept    = "anchor_to_accept"
+	LatencyPeerObservation = "accept_to_peer"
+)
+
+// percentiles of a shard's most recent latency samples
+type LatencyPercentiles struct {
+	Samples int
+	P50     time.Duration
+	P90     time.Duration
+	P99     time.Duration
+	Max     time.Duration
+}
+
+// latencies of a shard's transactions, nil when no samples
+type ShardLatency struct {
+	// from anchor issuance to acceptance of submission
+	AnchorAccept *LatencyPercentiles
+	// from acceptance of submission to its observation by a peer (acknowledgement, or a peer's
+	// transaction or shard sync anchored over it)
+	PeerObservation *LatencyPercentiles
+}
+
+// a shard's latency breaching its SLO
+type SLOBreach struct {
+	// name of latency, LatencyAnchorAccept or LatencyPeerObservation
+	Latency    string
+	Percentile float64
+	// latency at percentile, and its SLO
+	Value  time.Duration
+	Target time.Duration
+	// number of samples percentile was computed over
+	Samples int
+}
+
+// most recent latency samples of a shard, and whether they are in breach of SLO
+type latencyWindow struct {
+	samples  []time.Duration
+	next     int
+	breached bool
+}
+
+func (w *latencyWindow) add(sample time.Duration, size int) {
+	if len(w.samples) < size {
+		w.samples = append(w.samples, sample)
+	} else {
+		w.samples[w.next%len(w.samples)] = sample
+		w.next += 1
+	}
+}
+
+// nearest rank percentiles of samples
+func (w *latencyWindow) percentiles(ps ...float64) []time.Duration {
+	sorted := append([]time.Duration{}, w.samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	values := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		} else if rank >= len(sorted) {
+			rank = len(sorted) - 1
+		}
+		values[i] = sorted[rank]
+	}
+	return values
+}
+
+func (w *latencyWindow) summary() *LatencyPercentiles {
+	if len(w.samples) == 0 {
+		return nil
+	}
+	values := w.percentiles(50, 90, 99, 100)
+	return &LatencyPercentiles{
+		Samples: len(w.samples),
+		P50:     values[0],
+		P90:     values[1],
+		P99:     values[2],
+		Max:     values[3],
+	}
+}
+
+type latencyKey struct {
+	latency string
+	shardId string
+}
+
+// a submission accepted by node, pending observation by a peer
+type acceptedSubmission struct {
+	shardId []byte
+	at      time.Time
+}
+
+type latencyTracker struct {
+	// issue time of anchors, keyed by submitter id and sequence
+	anchors map[string]time.Time
+	// submissions pending observation by a peer, keyed by transaction id
+	accepted map[[64]byte]*acceptedSubmission
+	windows  map[latencyKey]*latencyWindow
+	lock     sync.Mutex
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{
+		anchors:  make(map[string]time.Time),
+		accepted: make(map[[64]byte]*acceptedSubmission),
+		windows:  make(map[latencyKey]*latencyWindow),
+	}
+}
+
+func anchorKey(submitterId []byte, seq uint64) string {
+	return string(append(common.Uint64ToBytes(seq), submitterId...))
+}
+
+// drop tracked anchors and submissions past timeout, when tracking is full
+func (t *latencyTracker) expire(now time.Time) {
+	if len(t.anchors) >= MaxLatencyTracked {
+		for key, at := range t.anchors {
+			if now.Sub(at) > LatencyTrackTimeout {
+				delete(t.anchors, key)
+			}
+		}
+	}
+	if len(t.accepted) >= MaxLatencyTracked {
+		for id, s := range t.accepted {
+			if now.Sub(s.at) > LatencyTrackTimeout {
+				delete(t.accepted, id)
+			}
+		}
+	}
+}
+
+func (t *latencyTracker) anchorIssued(submitterId []byte, seq uint64, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.expire(now)
+	if len(t.anchors) < MaxLatencyTracked {
+		t.anchors[anchorKey(submitterId, seq)] = now
+	}
+}
+
+// record a submission's acceptance, returns latency from issuance of anchor for its submitter sequence
+// (0 if not known)
+func (t *latencyTracker) submissionAccepted(tx dto.Transaction, now time.Time) time.Duration {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.expire(now)
+	if len(t.accepted) < MaxLatencyTracked {
+		t.accepted[tx.Id()] = &acceptedSubmission{shardId: tx.Request().ShardId, at: now}
+	}
+	key := anchorKey(tx.Request().SubmitterId, tx.Request().SubmitterSeq)
+	if at, found := t.anchors[key]; found {
+		delete(t.anchors, key)
+		if now.Sub(at) > LatencyTrackTimeout {
+			return 0
+		}
+		return now.Sub(at)
+	}
+	return 0
+}
+
+// record first observation of a submission by a peer, returns the submission and its latency from acceptance
+func (t *latencyTracker) observed(id [64]byte, now time.Time) (*acceptedSubmission, time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if s, found := t.accepted[id]; !found {
+		return nil, 0
+	} else if delete(t.accepted, id); now.Sub(s.at) > LatencyTrackTimeout {
+		return nil, 0
+	} else {
+		return s, now.Sub(s.at)
+	}
+}
+
+// add a latency sample of a shard, returns a breach if sample took shard's latency above its SLO
+func (t *latencyTracker) sample(latency string, shardId []byte, value, slo time.Duration, percentile float64) *SLOBreach {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	key := latencyKey{latency: latency, shardId: string(shardId)}
+	w, found := t.windows[key]
+	if !found {
+		w = &latencyWindow{}
+		t.windows[key] = w
+	}
+	size := LatencySamples
+	if size < 1 {
+		size = 1
+	}
+	w.add(value, size)
+	if slo <= 0 || len(w.samples) < LatencySLOMinSamples {
+		return nil
+	}
+	// alert once when shard's latency goes above SLO, and again only after it has recovered
+	current := w.percentiles(percentile)[0]
+	if current <= slo {
+		w.breached = false
+		return nil
+	} else if w.breached {
+		return nil
+	}
+	w.breached = true
+	return &SLOBreach{
+		Latency:    latency,
+		Percentile: percentile,
+		Value:      current,
+		Target:     slo,
+		Samples:    len(w.samples),
+	}
+}
+
+// latencies of all shards with samples, keyed by shard id
+func (t *latencyTracker) shards() map[string]*ShardLatency {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	shards := make(map[string]*ShardLatency)
+	for key, w := range t.windows {
+		l, found := shards[key.shardId]
+		if !found {
+			l = &ShardLatency{}
+			shards[key.shardId] = l
+		}
+		switch key.latency {
+		case LatencyAnchorAccept:
+			l.AnchorAccept = w.summary()
+		case LatencyPeerObservation:
+			l.PeerObservation = w.summary()
+		}
+	}
+	return shards
+}
+
+// add a latency sample, and alert app subscribers if shard's latency breached its SLO
+func (d *dlt) latencySample(latency string, shardId []byte, value, slo time.Duration) {
+	if breach := d.latency.sample(latency, shardId, value, slo, d.policies.LatencySLOPercentile); breach != nil {
+		d.logger.Error("Latency %s of shard %x at p%g is %s, above SLO of %s", latency, shardId, breach.Percentile, breach.Value, breach.Target)
+		d.subs.publish(&Event{
+			Type:    EVENT_SLO_BREACH,
+			ShardId: shardId,
+			Detail:  latency + " above SLO",
+			SLO:     breach,
+		})
+	}
+}
+
+// record acceptance of a submission, and its latency from anchor issuance
+func (d *dlt) latencySubmitted(tx dto.Transaction) {
+	if latency := d.latency.submissionAccepted(tx, time.Now()); latency > 0 {
+		d.latencySample(LatencyAnchorAccept, tx.Request().ShardId, latency, d.policies.AnchorAcceptSLO)
+	}
+}
+
+// record observation of a transaction by a peer, if it's a submission pending observation
+func (d *dlt) latencyObserved(id [64]byte) {
+	if s, latency := d.latency.observed(id, time.Now()); s != nil {
+		d.latencySample(LatencyPeerObservation, s.shardId, latency, d.policies.PeerObservationSLO)
+	}
+}
+
+// record observation of transactions that a peer's anchor is anchored over
+func (d *dlt) latencyObservedAnchor(a *dto.Anchor) {
+	if a == nil {
+		return
+	}
+	d.latencyObserved(a.ShardParent)
+	for _, uncle := range a.ShardUncles {
+		d.latencyObserved(uncle)
+	}
+}
+
+// send an acknowledgement for a transaction back to the peer that sent it, if enabled
+func (d *dlt) ack(peer p2p.Peer, tx dto.Transaction) {
+	if !d.conf.SendAcks {
+		return
+	}
+	msg := &TxAckMsg{TxId: tx.Id()}
+	if err := peer.Send(msg.Id(), msg.Code(), msg); err != nil {
+		peer.Logger().Debug("Failed to send acknowledgement for transaction: %x", msg.TxId)
+	}
+}
+
+func (d *dlt) handleRECV_TxAckMsg(peer p2p.Peer, msg *TxAckMsg) {
+	d.latencyObserved(msg.TxId)
+}
@@ -0,0 +1,102 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+	"time"
+)
+
+func TestLatencyWindow_Percentiles(t *testing.T) {
+	w := &latencyWindow{}
+	for i := 1; i <= 200; i++ {
+		w.add(time.Duration(i)*time.Millisecond, 100)
+	}
+	if s := w.summary(); s.Samples != 100 || s.P50 != 150*time.Millisecond || s.P90 != 190*time.Millisecond ||
+		s.P99 != 199*time.Millisecond || s.Max != 200*time.Millisecond {
+		t.Errorf("incorrect percentiles: %v", s)
+	}
+	if (&latencyWindow{}).summary() != nil {
+		t.Errorf("did not expect percentiles without samples")
+	}
+}
+
+// latency from anchor issuance to acceptance of submission should be sampled per shard, and a breach of SLO
+// should be alerted once until latency recovers
+func TestLatency_AnchorAcceptSLO(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.policies.AnchorAcceptSLO = time.Minute
+	received := make(chan *Event, 10)
+	stack.Subscribe(func(e *Event) { received <- e })
+	submit := func(latency time.Duration) {
+		tx := TestSignedTransaction("test payload")
+		tx.Request().SubmitterSeq = uint64(time.Now().UnixNano())
+		stack.latency.anchorIssued(tx.Request().SubmitterId, tx.Request().SubmitterSeq, time.Now().Add(-latency))
+		stack.latencySubmitted(tx)
+	}
+	for i := 0; i < LatencySLOMinSamples; i++ {
+		submit(time.Second)
+	}
+	shardId := string(TestAppConfig().ShardId)
+	if l := stack.Stats().ShardLatencies[shardId]; l == nil || l.AnchorAccept == nil || l.AnchorAccept.Samples != LatencySLOMinSamples {
+		t.Fatalf("incorrect latencies: %v", l)
+	} else if l.AnchorAccept.P99 < time.Second || l.PeerObservation != nil {
+		t.Errorf("incorrect anchor to accept latency: %v", l.AnchorAccept)
+	}
+	for i := 0; i < LatencySLOMinSamples; i++ {
+		submit(2 * time.Minute)
+	}
+	select {
+	case e := <-received:
+		if e.Type != EVENT_SLO_BREACH || string(e.ShardId) != shardId || e.SLO == nil ||
+			e.SLO.Latency != LatencyAnchorAccept || e.SLO.Value < 2*time.Minute || e.SLO.Target != time.Minute {
+			t.Errorf("incorrect event: %v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("did not alert SLO breach")
+	}
+	select {
+	case e := <-received:
+		t.Errorf("did not expect repeated alert: %v", e)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// latency from acceptance of submission to observation by a peer should be sampled for first observation only
+func TestLatency_PeerObservation(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+	tx1, tx2 := TestSignedTransaction("test payload1"), TestSignedTransaction("test payload2")
+	stack.latencySubmitted(tx1)
+	stack.latencySubmitted(tx2)
+	stack.handleRECV_TxAckMsg(peer, &TxAckMsg{TxId: tx1.Id()})
+	stack.handleRECV_TxAckMsg(peer, &TxAckMsg{TxId: tx1.Id()})
+	// a peer's anchor over submission is an observation too
+	anchor := dto.TestAnchor()
+	anchor.ShardUncles = [][64]byte{tx2.Id()}
+	stack.latencyObservedAnchor(anchor)
+	l := stack.Stats().ShardLatencies[string(TestAppConfig().ShardId)]
+	if l == nil || l.PeerObservation == nil || l.PeerObservation.Samples != 2 {
+		t.Errorf("incorrect latencies: %v", l)
+	}
+}
+
+// an accepted network transaction should be acknowledged back to peer, when enabled
+func TestAck_Enabled(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+	tx := TestSignedTransaction("test payload")
+	if err := stack.handleTransaction(peer, make(chan controllerEvent, 10), tx, false); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	} else if peer.SendCalled {
+		t.Errorf("did not expect acknowledgement when disabled")
+	}
+	stack.conf.SendAcks = true
+	tx = TestSignedTransaction("test payload2")
+	if err := stack.handleTransaction(peer, make(chan controllerEvent, 10), tx, false); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	} else if !peer.SendCalled || peer.SendMsgCode != TxAckMsgCode || peer.SendMsg.(*TxAckMsg).TxId != tx.Id() {
+		t.Errorf("stack did not send acknowledgement")
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright 2019 The trust-net Authors
+// Deprecated adapters for applications using the field-style transaction API
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"sync"
+)
+
+var legacyLogger = log.NewLogger("Legacy")
+
+var legacySubmitWarning, legacyHandlerWarning sync.Once
+
+// Deprecated: submit a field-style legacy transaction to the DLT stack, use DLT.Submit with a
+// dto.TxRequest instead (legacy transaction must be signed same as its request)
+func LegacySubmit(dlt DLT, tx *dto.LegacyTransaction) (*dto.LegacyTransaction, error) {
+	legacySubmitWarning.Do(func() {
+		legacyLogger.Info("DEPRECATED: LegacySubmit will be removed, use DLT.Submit with dto.TxRequest")
+	})
+	if res, err := dlt.Submit(tx.Request()); err != nil {
+		return nil, err
+	} else {
+		return dto.ToLegacyTransaction(res), nil
+	}
+}
+
+// Deprecated: adapt a field-style legacy transaction handler for DLT.Register, implement
+// func(tx dto.Transaction, state state.State) error instead
+func LegacyTxHandler(handler func(tx *dto.LegacyTransaction, state state.State) error) func(tx dto.Transaction, state state.State) error {
+	legacyHandlerWarning.Do(func() {
+		legacyLogger.Info("DEPRECATED: LegacyTxHandler will be removed, register a dto.Transaction handler")
+	})
+	return func(tx dto.Transaction, state state.State) error {
+		return handler(dto.ToLegacyTransaction(tx), state)
+	}
+}
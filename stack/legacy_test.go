@@ -0,0 +1,51 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// test that a legacy transaction is submitted as its request and converted back
+func TestLegacySubmit(t *testing.T) {
+	stack, _, endorser, p2p := initMocks()
+	req := dto.TestSubmitter().NewRequest("test payload")
+	legacy := &dto.LegacyTransaction{
+		Payload:      req.Payload,
+		ShardId:      req.ShardId,
+		Submitter:    req.SubmitterId,
+		SubmitterSeq: req.SubmitterSeq,
+		LastTx:       req.LastTx,
+		Padding:      req.Padding,
+		Signature:    req.Signature,
+	}
+	if res, err := LegacySubmit(stack, legacy); err != nil {
+		t.Errorf("legacy submission failed: %s", err)
+	} else if !endorser.ApproverCalled {
+		t.Errorf("endorser did not get called for submission")
+	} else if string(res.Payload) != "test payload" || string(res.Signature) != string(req.Signature) {
+		t.Errorf("incorrect legacy transaction: %v", res)
+	} else if string(res.NodeId) != string(p2p.Id()) || res.ShardSeq == 0 {
+		t.Errorf("legacy transaction anchor fields not populated: %v", res)
+	}
+}
+
+// test that legacy transaction handler gets called with converted transaction
+func TestLegacyTxHandler(t *testing.T) {
+	tx := dto.TestSignedTransaction("test payload")
+	var got *dto.LegacyTransaction
+	handler := LegacyTxHandler(func(tx *dto.LegacyTransaction, s state.State) error {
+		got = tx
+		return nil
+	})
+	if err := handler(tx, nil); err != nil {
+		t.Errorf("legacy handler failed: %s", err)
+	} else if got == nil || string(got.Payload) != "test payload" || string(got.Submitter) != string(tx.Request().SubmitterId) ||
+		got.ShardSeq != tx.Anchor().ShardSeq {
+		t.Errorf("incorrect legacy transaction: %v", got)
+	}
+	if back := got.Request(); string(back.Bytes()) != string(tx.Request().Bytes()) {
+		t.Errorf("legacy transaction did not convert back to original request")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 The trust-net Authors
+// Registry that a node reports its metrics to
+package stack
+
+// names of metrics reported by node
+const (
+	MetricTxAccepted    = "tx_accepted"
+	MetricTxRejected    = "tx_rejected"
+	MetricDoubleSpends  = "double_spends"
+	MetricBytesGossiped = "bytes_gossiped"
+	MetricPeers         = "peers"
+)
+
+// labels of metrics reported by node
+const (
+	LabelShard  = "shard"
+	LabelReason = "reason"
+)
+
+// registry that node's metrics are reported to, e.g. an adapter to application's
+// prometheus or expvar registry (implementations must be safe for concurrent use)
+type MetricsRegistry interface {
+	// add delta to a named counter
+	Counter(name string, delta uint64, labels map[string]string)
+	// set value of a named gauge
+	Gauge(name string, value float64, labels map[string]string)
+}
+
+// default registry that discards all metrics
+type nopMetrics struct{}
+
+func (m nopMetrics) Counter(name string, delta uint64, labels map[string]string) {}
+
+func (m nopMetrics) Gauge(name string, value float64, labels map[string]string) {}
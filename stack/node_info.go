@@ -0,0 +1,134 @@
+// Copyright 2019 The trust-net Authors
+// Node information and effective limits of the DLT stack
+package stack
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"github.com/trust-net/dag-lib-go/version"
+	"time"
+)
+
+// max size (bytes) of a transaction payload accepted for submission or from network
+var MaxPayloadSize = 1 << 20
+
+// error for a request that exceeds one of the node's limits
+type LimitError struct {
+	// name of the limit as reported in node info, e.g. "stack.max_payload_size"
+	Limit string
+	// configured max value of the limit
+	Max uint64
+	// value in request that exceeded the limit
+	Value uint64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("limit %s exceeded: %d > %d", e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) ErrorCode() dto.ErrorCode {
+	if e.Limit == "stack.max_payload_size" {
+		return dto.ErrPayloadTooLarge
+	}
+	return dto.ErrLimitExceeded
+}
+
+// limits of the stack controller
+type StackLimits struct {
+	MaxPayloadSize      int
+	MaxShardIdSize      int
+	MaxUnclesPerAnchor  int
+	ShardQueueSize      int
+	ShardWorkers        int
+	MaxNacksPerSecond   int
+	MaxNackHops         uint64
+	MaxRejectDetail     int
+	MaxReanchorRetries  int
+	MaxSyncPeers        int
+	TxValidationWorkers int
+	// per submitter rate limits (transactions per second, 0 for no limit) and burst
+	SubmitterTxRate        float64
+	SubmitterNetworkTxRate float64
+	SubmitterTxBurst       int
+}
+
+// limits of the sharding layer
+type ShardLimits struct {
+	HandlerRetryLimit   int
+	HandlerRetryBackoff time.Duration
+	DeadLetterLimit     int
+	MaxAnchorUncles     int
+	MaxResourceSize     int
+	ChunkSize           int
+}
+
+// limits of the p2p layer
+type P2PLimits struct {
+	MaxPeers int
+}
+
+// effective limits of each layer of the stack
+type Limits struct {
+	Stack StackLimits
+	Shard ShardLimits
+	P2P   P2PLimits
+}
+
+// information about the node and its effective configuration
+type NodeInfo struct {
+	NodeId []byte
+	Name   string
+	// registered app's shard and name (nil/empty when no app is registered)
+	ShardId []byte
+	AppName string
+	Limits  Limits
+	// build version of the node, and versions advertised by connected peers (keyed by hex encoded peer id)
+	Version      version.Info
+	PeerVersions map[string]version.Info
+}
+
+func (d *dlt) NodeInfo() *NodeInfo {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	info := &NodeInfo{
+		NodeId:       d.p2p.Id(),
+		Name:         d.conf.Name,
+		Version:      version.Get(),
+		PeerVersions: d.peerVersions.all(),
+		Limits: Limits{
+			Stack: StackLimits{
+				MaxPayloadSize:         d.policies.MaxPayloadSize,
+				MaxShardIdSize:         d.policies.MaxShardIdSize,
+				MaxUnclesPerAnchor:     d.policies.MaxUnclesPerAnchor,
+				ShardQueueSize:         d.policies.ShardQueueSize,
+				ShardWorkers:           d.policies.ShardWorkers,
+				MaxNacksPerSecond:      d.policies.MaxNacksPerSecond,
+				MaxNackHops:            d.policies.MaxNackHops,
+				MaxRejectDetail:        MaxRejectDetail,
+				MaxReanchorRetries:     d.policies.MaxReanchorRetries,
+				MaxSyncPeers:           d.policies.MaxSyncPeers,
+				TxValidationWorkers:    d.policies.TxValidationWorkers,
+				SubmitterTxRate:        d.policies.SubmitterTxRate,
+				SubmitterNetworkTxRate: d.policies.SubmitterNetworkTxRate,
+				SubmitterTxBurst:       d.policies.SubmitterTxBurst,
+			},
+			Shard: ShardLimits{
+				HandlerRetryLimit:   shard.HandlerRetryLimit,
+				HandlerRetryBackoff: shard.HandlerRetryBackoff,
+				DeadLetterLimit:     shard.DeadLetterLimit,
+				MaxAnchorUncles:     d.policies.anchorUncles(),
+				MaxResourceSize:     d.policies.MaxResourceSize,
+				ChunkSize:           state.ChunkSize,
+			},
+			P2P: P2PLimits{
+				MaxPeers: d.conf.MaxPeers,
+			},
+		},
+	}
+	if d.app != nil {
+		info.ShardId, info.AppName = d.app.ShardId, d.app.Name
+	}
+	return info
+}
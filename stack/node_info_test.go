@@ -0,0 +1,58 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/version"
+	"testing"
+)
+
+// test that node info reports registered app and effective limits
+func TestNodeInfo(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	info := stack.NodeInfo()
+	if string(info.NodeId) != string(stack.p2p.Id()) || string(info.ShardId) != string(TestAppConfig().ShardId) {
+		t.Errorf("incorrect node info: %v", info)
+	}
+	if info.Limits.Stack.MaxPayloadSize != MaxPayloadSize || info.Limits.Shard.DeadLetterLimit != shard.DeadLetterLimit ||
+		info.Limits.P2P.MaxPeers != stack.conf.MaxPeers {
+		t.Errorf("incorrect limits: %v", info.Limits)
+	}
+	if info.Version.Semver != version.Semver || info.Version.Commit != version.Commit {
+		t.Errorf("incorrect version: %v", info.Version)
+	}
+}
+
+// test that version advertised by peer is reported in node info until peer disconnects
+func TestNodeInfo_PeerVersions(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+	remote := version.Info{Semver: "1.2.3", Commit: "abc123", Features: []string{"rlp"}}
+	stack.handleRECV_NodeVersionMsg(peer, NewNodeVersionMsg(remote))
+	if v, found := stack.NodeInfo().PeerVersions[hex.EncodeToString(peer.ID())]; !found {
+		t.Errorf("peer version not reported")
+	} else if v.Semver != "1.2.3" || v.Commit != "abc123" || !v.HasFeature("rlp") {
+		t.Errorf("incorrect peer version: %v", v)
+	}
+	stack.peerVersions.remove(peer.ID())
+	if len(stack.NodeInfo().PeerVersions) != 0 {
+		t.Errorf("peer version should be removed")
+	}
+}
+
+// test that submission of oversized payload fails with limit error
+func TestSubmit_PayloadLimit(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	req := dto.TestRequest()
+	req.Payload = make([]byte, MaxPayloadSize+1)
+	if _, err := stack.Submit(req); err == nil {
+		t.Errorf("oversized payload should fail")
+	} else if lerr, ok := err.(*LimitError); !ok || lerr.Limit != "stack.max_payload_size" || lerr.Value != uint64(MaxPayloadSize+1) {
+		t.Errorf("incorrect error: %s", err)
+	} else if dto.ErrorCodeOf(err) != dto.ErrPayloadTooLarge {
+		t.Errorf("incorrect error code: %s", dto.ErrorCodeOf(err))
+	}
+}
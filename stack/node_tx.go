@@ -0,0 +1,162 @@
+// Copyright 2019 The trust-net Authors
+// Housekeeping transactions issued by node on its registered shards (tip merges and heartbeats)
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"time"
+)
+
+// interval at which node merges its registered shards' tips, 0 to disable
+var TipMergeInterval = time.Duration(0)
+
+// min number of shard tips for node to issue a tip merge transaction
+var TipMergeThreshold = 4
+
+// interval at which node emits heartbeat transactions on its registered shards, 0 to disable
+var HeartbeatInterval = time.Duration(0)
+
+// submit a tip merge transaction from node for a registered shard, if shard's tips
+// have reached the merge threshold (returns nil transaction otherwise)
+func (d *dlt) mergeTips(shardId []byte) (dto.Transaction, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil || d.paused[string(shardId)] {
+		return nil, nil
+	}
+	if tips := d.db.ShardTips(shardId); len(tips) < d.policies.TipMergeThreshold {
+		return nil, nil
+	}
+	return d.submitNodeTx(shardId, shard.TipMergePayload)
+}
+
+// submit a heartbeat transaction from node for a registered shard, to advance shard's
+// DAG depth and demonstrate node's liveness during quiet periods
+func (d *dlt) heartbeat(shardId []byte) (dto.Transaction, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) == nil || d.paused[string(shardId)] {
+		return nil, nil
+	}
+	return d.submitNodeTx(shardId, shard.HeartbeatPayload)
+}
+
+// shards of registered apps that are not paused, for node's housekeeping transactions
+func (d *dlt) activeShards() [][]byte {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	shards := [][]byte{}
+	for _, app := range d.apps {
+		if !d.paused[string(app.ShardId)] {
+			shards = append(shards, app.ShardId)
+		}
+	}
+	return shards
+}
+
+// submit a housekeeping transaction signed by node as its submitter, caller must hold stack's lock
+func (d *dlt) submitNodeTx(shardId []byte, payload []byte) (dto.Transaction, error) {
+	seq, lastTx := d.nodeSubmitterTip()
+	req := &dto.TxRequest{
+		Payload:      payload,
+		ShardId:      shardId,
+		LastTx:       lastTx,
+		SubmitterId:  d.p2p.Id(),
+		SubmitterSeq: seq,
+	}
+	if signature, err := d.p2p.Sign(req.Bytes()); err != nil {
+		return nil, err
+	} else {
+		req.Signature = signature
+	}
+	return d.submit(req, nil, dto.NewTraceId())
+}
+
+// next submitter sequence and last transaction of node's own submissions
+func (d *dlt) nodeSubmitterTip() (uint64, [64]byte) {
+	lastTx := [64]byte{}
+	if d.nodeSeq > 0 {
+		if h := d.db.GetSubmitterHistory(d.p2p.Id(), d.nodeSeq); h != nil && len(h.ShardTxPairs) > 0 {
+			lastTx = h.ShardTxPairs[0].TxId
+		}
+	}
+	// walk forward in case history moved ahead of our count (e.g. after restart)
+	for {
+		h := d.db.GetSubmitterHistory(d.p2p.Id(), d.nodeSeq+1)
+		if h == nil || len(h.ShardTxPairs) == 0 {
+			break
+		}
+		d.nodeSeq, lastTx = d.nodeSeq+1, h.ShardTxPairs[0].TxId
+	}
+	return d.nodeSeq + 1, lastTx
+}
+
+// a periodic background task of the node
+type nodeTask struct {
+	stop chan struct{}
+	done chan struct{}
+}
+
+func startNodeTask(interval time.Duration, run func()) *nodeTask {
+	t := &nodeTask{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(t.done)
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-time.After(interval):
+				run()
+			}
+		}
+	}()
+	return t
+}
+
+func (t *nodeTask) cancel() {
+	close(t.stop)
+	<-t.done
+}
+
+// start periodic housekeeping transactions and tip reconciliation enabled by policies, caller must hold stack's lock
+func (d *dlt) startNodeTasks() {
+	if len(d.nodeTasks) > 0 {
+		return
+	}
+	// run a housekeeping task on each registered shard that is not paused
+	logged := func(name string, submit func(shardId []byte) (dto.Transaction, error)) func() {
+		return func() {
+			for _, shardId := range d.activeShards() {
+				if tx, err := submit(shardId); err != nil {
+					d.logger.Debug("Failed to submit %s transaction on shard %x: %s", name, shardId, err)
+				} else if tx != nil {
+					d.logger.Debug("Submitted %s transaction: %x", name, tx.Id())
+				}
+			}
+		}
+	}
+	if d.policies.TipMergeInterval > 0 {
+		d.nodeTasks = append(d.nodeTasks, startNodeTask(d.policies.TipMergeInterval, d.guarded(logged("tip merge", d.mergeTips))))
+	}
+	if d.policies.HeartbeatInterval > 0 {
+		d.nodeTasks = append(d.nodeTasks, startNodeTask(d.policies.HeartbeatInterval, d.guarded(logged("heartbeat", d.heartbeat))))
+	}
+	if d.policies.TipReconcileInterval > 0 {
+		d.nodeTasks = append(d.nodeTasks, startNodeTask(d.policies.TipReconcileInterval, d.guarded(d.reconcileTips)))
+	}
+}
+
+// stop periodic node tasks
+func (d *dlt) stopNodeTasks() {
+	d.lock.Lock()
+	tasks := d.nodeTasks
+	d.nodeTasks = nil
+	d.lock.Unlock()
+	for _, t := range tasks {
+		t.cancel()
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+// add a number of tips to registered app's shard
+func addTestTips(endorser *mockEndorser, sharder *mockSharder, count int) {
+	for i := 0; i < count; i++ {
+		tx, _ := shard.SignedShardTransaction("tip")
+		handleTestTx(endorser, sharder, tx)
+	}
+}
+
+// test that node merges shard's tips once they reach threshold
+func TestMergeTips(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, sharder, endorser, _ := initMocks()
+	stack.policies.TipMergeThreshold = 3
+
+	addTestTips(endorser, sharder, 2)
+	if tx, err := stack.mergeTips(stack.app.ShardId); tx != nil || err != nil {
+		t.Errorf("should not merge tips below threshold: %v, %s", tx, err)
+	}
+
+	addTestTips(endorser, sharder, 1)
+	first, err := stack.mergeTips(stack.app.ShardId)
+	if err != nil || first == nil {
+		t.Errorf("failed to merge tips: %s", err)
+		return
+	}
+	if !shard.IsTipMerge(first) || first.Request().SubmitterSeq != 1 {
+		t.Errorf("incorrect tip merge transaction: %s", first.Anchor().ToString())
+	}
+	if len(first.Anchor().ShardUncles) != 2 {
+		t.Errorf("incorrect number of merged uncles: %d", len(first.Anchor().ShardUncles))
+	}
+	if tips := stack.db.ShardTips(stack.app.ShardId); len(tips) != 1 || tips[0] != first.Id() {
+		t.Errorf("tips not merged: %d", len(tips))
+	}
+
+	// next merge should continue node's own submitter sequence
+	if seq, lastTx := stack.nodeSubmitterTip(); seq != 2 || lastTx != first.Id() {
+		t.Errorf("incorrect node sequence: %d", seq)
+	}
+}
+
+// test that node emits heartbeat on registered shard, advancing shard's DAG depth
+func TestHeartbeat(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, sharder, endorser, _ := initMocks()
+	addTestTips(endorser, sharder, 1)
+	tx, err := stack.heartbeat(stack.app.ShardId)
+	if err != nil || tx == nil {
+		t.Errorf("failed to emit heartbeat: %s", err)
+		return
+	}
+	if !shard.IsHeartbeat(tx) || !shard.IsNodeTx(tx) || shard.IsTipMerge(tx) {
+		t.Errorf("incorrect heartbeat transaction")
+	}
+	if node := stack.GetDagNode(tx.Id()); node == nil || node.Depth != 2 {
+		t.Errorf("heartbeat did not advance shard DAG: %v", node)
+	}
+}
+
+// test that heartbeat is skipped while app is paused
+func TestHeartbeat_Paused(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, _, _ := initMocks()
+	stack.Pause()
+	if tx, err := stack.heartbeat(stack.app.ShardId); tx != nil || err != nil {
+		t.Errorf("heartbeat should be skipped while paused: %v, %s", tx, err)
+	}
+}
+
+// test that heartbeats are emitted on each registered shard, except a paused one
+func TestNodeTasks_HeartbeatShards(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, _, _ := initMocks()
+	other, paused := []byte("another shard"), []byte("paused shard")
+	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
+	stack.Register(other, "another app", txHandler)
+	stack.Register(paused, "paused app", txHandler)
+	stack.PauseShard(paused)
+	stack.policies.HeartbeatInterval = 10 * time.Millisecond
+	stack.lock.Lock()
+	stack.startNodeTasks()
+	stack.lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	stack.stopNodeTasks()
+	for _, shardId := range [][]byte{stack.app.ShardId, other, paused} {
+		beats := 0
+		for _, tip := range stack.db.ShardTips(shardId) {
+			if tx := stack.db.GetTx(tip); tx != nil && shard.IsHeartbeat(tx) {
+				beats += 1
+			}
+		}
+		if expected := string(shardId) != string(paused); (beats > 0) != expected {
+			t.Errorf("incorrect heartbeats on shard %s: %d", shardId, beats)
+		}
+	}
+}
+
+// test that heartbeats are emitted periodically as per policy, until stack stops
+func TestNodeTasks_Heartbeat(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, _, _ := initMocks()
+	stack.policies.HeartbeatInterval = 10 * time.Millisecond
+	stack.lock.Lock()
+	stack.startNodeTasks()
+	stack.lock.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	stack.stopNodeTasks()
+	if history := stack.db.GetSubmitterHistory(stack.p2p.Id(), 1); history == nil {
+		t.Errorf("no heartbeat emitted")
+	}
+	if len(stack.nodeTasks) != 0 {
+		t.Errorf("node tasks not stopped")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2019 The trust-net Authors
+// Functional options for composing a DLT stack instance
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/endorsement"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"os"
+	"time"
+)
+
+// policies of a stack instance, defaults are taken from package level variables
+type Policies struct {
+	// max size (bytes) of a transaction payload accepted for submission or from network
+	MaxPayloadSize int
+	// max size (bytes) of a transaction's shard id accepted for submission or from network, 0 for no limit
+	MaxShardIdSize int
+	// max number of uncles in an anchor of a network transaction, 0 for no limit
+	MaxUnclesPerAnchor int
+	// max number of pending jobs per shard queue
+	ShardQueueSize int
+	// max number of shards processing network transactions concurrently
+	ShardWorkers int
+	// relative weights (default 1) of shards, keyed by shard id, for scheduling of network transaction
+	// processing (and hence broadcast) when more shards are busy than there are workers
+	ShardWeights map[string]int
+	// max number of rejection (NACK) messages sent per second
+	MaxNacksPerSecond int
+	// max number of hops a rejection (NACK) message is forwarded
+	MaxNackHops uint64
+	// max number of tips (other than parent) an anchor merges as uncles, 0 for no limit
+	MaxAnchorUncles int
+	// max size (bytes) of a resource value accepted by world state, 0 for no limit (larger
+	// values are transparently stored in chunks of state.ChunkSize)
+	MaxResourceSize int
+	// interval at which node merges its registered shard's tips, 0 to disable
+	TipMergeInterval time.Duration
+	// min number of shard tips for node to issue a tip merge transaction
+	TipMergeThreshold int
+	// interval at which node emits heartbeat transactions on its registered shard, 0 to disable
+	HeartbeatInterval time.Duration
+	// max number of times a submission is re-anchored and retried when its anchor goes stale
+	// before it's applied, 0 to report stale anchor to submitter
+	MaxReanchorRetries int
+	// max time to wait for tips from peers when issuing an anchor for a shard not known locally,
+	// 0 to issue anchor over local shard DAG as is
+	RemoteAnchorTimeout time.Duration
+	// max number of peers a shard is synced from in parallel (0 for no limit), further peers advertising
+	// the shard are kept as standby sources
+	MaxSyncPeers int
+	// interval at which node reconciles its registered shard's tips with peers, 0 to disable
+	TipReconcileInterval time.Duration
+	// max number of transactions fetched per request during shard sync, a transaction is fetched along
+	// with its shard DAG descendants in batches, 0 or 1 to fetch one transaction at a time
+	ShardSyncBatchSize int
+	// codec to compress transaction records in storage (repo.CompressNone, repo.CompressSnappy or
+	// repo.CompressFlate), trading CPU for disk on payload heavy shards
+	TxCompression int
+	// number of workers validating network transactions (signatures, anchor sanity) in parallel, 0 to
+	// validate in each peer's listener
+	TxValidationWorkers int
+	// period without new transactions after which a shard with no registered app is reported as
+	// abandoned, 0 to never consider shards abandoned
+	AbandonedShardPeriod time.Duration
+	// max number of transactions per second accepted from a submitter for submission, 0 for no limit
+	SubmitterTxRate float64
+	// max number of transactions per second accepted from a submitter over network, 0 for no limit (throttled
+	// network transactions are only fetched again during a later sync of their shard, so this should be well
+	// above rate of submissions across the network)
+	SubmitterNetworkTxRate float64
+	// max number of transactions accepted from a submitter in a burst above its rates
+	SubmitterTxBurst int
+	// max latency from anchor issuance to acceptance of submission, and from acceptance of submission to
+	// its observation by a peer, at LatencySLOPercentile of a shard's recent samples, 0 for no SLO (an
+	// EVENT_SLO_BREACH event is published when a shard's latency goes above its SLO)
+	AnchorAcceptSLO      time.Duration
+	PeerObservationSLO   time.Duration
+	LatencySLOPercentile float64
+}
+
+func defaultPolicies() Policies {
+	return Policies{
+		MaxPayloadSize:         MaxPayloadSize,
+		MaxShardIdSize:         MaxShardIdSize,
+		MaxUnclesPerAnchor:     MaxUnclesPerAnchor,
+		ShardQueueSize:         ShardQueueSize,
+		ShardWorkers:           ShardWorkers,
+		MaxNacksPerSecond:      MaxNacksPerSecond,
+		MaxNackHops:            MaxNackHops,
+		MaxAnchorUncles:        shard.MaxAnchorUncles,
+		MaxResourceSize:        state.MaxValueSize,
+		TipMergeInterval:       TipMergeInterval,
+		TipMergeThreshold:      TipMergeThreshold,
+		HeartbeatInterval:      HeartbeatInterval,
+		MaxReanchorRetries:     MaxReanchorRetries,
+		RemoteAnchorTimeout:    RemoteAnchorTimeout,
+		MaxSyncPeers:           MaxSyncPeers,
+		TipReconcileInterval:   TipReconcileInterval,
+		ShardSyncBatchSize:     ShardSyncBatchSize,
+		TxCompression:          repo.TxCompression,
+		TxValidationWorkers:    TxValidationWorkers,
+		AbandonedShardPeriod:   AbandonedShardPeriod,
+		SubmitterTxRate:        SubmitterTxRate,
+		SubmitterNetworkTxRate: SubmitterNetworkTxRate,
+		SubmitterTxBurst:       SubmitterTxBurst,
+		AnchorAcceptSLO:        AnchorAcceptSLO,
+		PeerObservationSLO:     PeerObservationSLO,
+		LatencySLOPercentile:   LatencySLOPercentile,
+	}
+}
+
+// factory for stack's p2p layer, called with stack's p2p config (protocol fields populated)
+// and the runner that the layer must invoke for each connected peer
+type P2PFactory func(conf p2p.Config, runner p2p.Runner) (p2p.Layer, error)
+
+// factory for stack's sharding layer, called with stack's DLT DB and storage provider
+type SharderFactory func(db repo.DltDb, dbp db.DbProvider) (shard.Sharder, error)
+
+// factory for stack's endorsement layer, called with stack's DLT DB
+type EndorserFactory func(db repo.DltDb) (endorsement.Endorser, error)
+
+// filter of shards a node stores, returns false for shards whose transactions node should not store
+type StorageFilter func(shardId []byte) bool
+
+// option for creating a stack instance
+type Option func(o *options) error
+
+type options struct {
+	conf         *p2p.Config
+	dbp          db.DbProvider
+	p2p          P2PFactory
+	sharder      SharderFactory
+	endorser     EndorserFactory
+	logger       log.Logger
+	metrics      MetricsRegistry
+	policies     Policies
+	filter       StorageFilter
+	crashDumpDir string
+}
+
+// node's p2p configuration (required)
+func WithConfig(conf p2p.Config) Option {
+	return func(o *options) error {
+		o.conf = &conf
+		return nil
+	}
+}
+
+// storage provider for stack's databases (default in-memory storage)
+func WithStorage(dbp db.DbProvider) Option {
+	return func(o *options) error {
+		if dbp == nil {
+			return errors.New("nil storage provider")
+		}
+		o.dbp = dbp
+		return nil
+	}
+}
+
+// p2p layer implementation (default DEVp2p layer)
+func WithP2P(factory P2PFactory) Option {
+	return func(o *options) error {
+		if factory == nil {
+			return errors.New("nil p2p factory")
+		}
+		o.p2p = factory
+		return nil
+	}
+}
+
+// sharding layer implementation (default shard.NewSharder)
+func WithSharder(factory SharderFactory) Option {
+	return func(o *options) error {
+		if factory == nil {
+			return errors.New("nil sharder factory")
+		}
+		o.sharder = factory
+		return nil
+	}
+}
+
+// endorsement layer implementation (default endorsement.NewEndorser)
+func WithEndorser(factory EndorserFactory) Option {
+	return func(o *options) error {
+		if factory == nil {
+			return errors.New("nil endorser factory")
+		}
+		o.endorser = factory
+		return nil
+	}
+}
+
+// logger for stack controller (default logger named after node)
+func WithLogger(logger log.Logger) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// registry that stack reports its counters (accepted and rejected transactions, double spends, bytes
+// gossiped) and gauges (connected peers) to (default discards metrics)
+func WithMetrics(registry MetricsRegistry) Option {
+	return func(o *options) error {
+		if registry == nil {
+			return errors.New("nil metrics registry")
+		}
+		o.metrics = registry
+		return nil
+	}
+}
+
+// policies for the stack instance (default from package level variables)
+func WithPolicies(policies Policies) Option {
+	return func(o *options) error {
+		o.policies = policies
+		return nil
+	}
+}
+
+// directory (e.g. node's data directory) to write a crash dump into upon a panic in stack's goroutines,
+// capturing stack traces, shard queue depths, shard tips and most recently processed transactions
+func WithCrashDumps(dir string) Option {
+	return func(o *options) error {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return errors.New("invalid crash dump directory")
+		}
+		o.crashDumpDir = dir
+		return nil
+	}
+}
+
+// filter of shards that node stores transactions for (default stores all shards), transactions of
+// filtered shards are relayed to peers after signature verification, but not validated against, or
+// added to, local DAG (hence node does not sync those shards, or serve them in sync responses)
+func WithStorageFilter(filter StorageFilter) Option {
+	return func(o *options) error {
+		o.filter = filter
+		return nil
+	}
+}
+
+func newOptions(opts []Option) (*options, error) {
+	o := &options{
+		policies: defaultPolicies(),
+		p2p: func(conf p2p.Config, runner p2p.Runner) (p2p.Layer, error) {
+			return p2p.NewDEVp2pLayer(conf, runner)
+		},
+		sharder: func(db repo.DltDb, dbp db.DbProvider) (shard.Sharder, error) {
+			return shard.NewSharder(db, dbp)
+		},
+		endorser: func(db repo.DltDb) (endorsement.Endorser, error) {
+			return endorsement.NewEndorser(db)
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	if o.conf == nil {
+		return nil, errors.New("missing p2p config")
+	}
+	if o.dbp == nil {
+		o.dbp = db.NewInMemDbProvider()
+	}
+	if o.logger == nil {
+		o.logger = log.NewLogger(o.conf.Name)
+	}
+	if o.metrics == nil {
+		o.metrics = nopMetrics{}
+	}
+	return o, nil
+}
@@ -0,0 +1,221 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/dbp"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/endorsement"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// test that stack requires p2p config
+func TestNewDltStack_MissingConfig(t *testing.T) {
+	if _, err := NewDltStack(); err == nil {
+		t.Errorf("stack creation without config should fail")
+	}
+}
+
+// test that stack uses injected p2p layer and policies
+func TestNewDltStack_Options(t *testing.T) {
+	mockP2P := p2p.TestP2PLayer("mock p2p")
+	var runner p2p.Runner
+	policies := defaultPolicies()
+	policies.MaxPayloadSize = 10
+	stack, err := NewDltStack(WithConfig(p2p.TestConfig()), WithPolicies(policies),
+		WithP2P(func(conf p2p.Config, r p2p.Runner) (p2p.Layer, error) {
+			if conf.ProtocolName != ProtocolName {
+				t.Errorf("p2p config not populated with protocol")
+			}
+			runner = r
+			return mockP2P, nil
+		}))
+	if err != nil {
+		t.Errorf("failed to create stack: %s", err)
+		return
+	}
+	if stack.p2p != mockP2P || runner == nil {
+		t.Errorf("stack did not use injected p2p layer")
+	}
+	if stack.NodeInfo().Limits.Stack.MaxPayloadSize != 10 {
+		t.Errorf("stack did not use injected policies")
+	}
+}
+
+// test that stack uses injected sharder and endorser implementations
+func TestNewDltStack_SharderEndorser(t *testing.T) {
+	var sharder *mockSharder
+	var endorser *mockEndorser
+	stack, err := NewDltStack(WithConfig(p2p.TestConfig()),
+		WithSharder(func(db repo.DltDb, dbp db.DbProvider) (shard.Sharder, error) {
+			sharder = NewMockSharder(db)
+			return sharder, nil
+		}),
+		WithEndorser(func(db repo.DltDb) (endorsement.Endorser, error) {
+			endorser = NewMockEndorser(db)
+			return endorser, nil
+		}))
+	if err != nil {
+		t.Errorf("failed to create stack: %s", err)
+		return
+	}
+	if stack.sharder != sharder || stack.endorser != endorser {
+		t.Errorf("stack did not use injected sharder/endorser")
+	}
+	// stack should use injected sharder for app registration
+	app := TestAppConfig()
+	stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil })
+	if !sharder.IsRegistered {
+		t.Errorf("app not registered with injected sharder")
+	}
+}
+
+type mockMetrics struct {
+	counters map[string]uint64
+	gauges   map[string]float64
+	lock     sync.Mutex
+}
+
+func (m *mockMetrics) Counter(name string, delta uint64, labels map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.counters[name+labels[LabelShard]+labels[LabelReason]] += delta
+}
+
+func (m *mockMetrics) Gauge(name string, value float64, labels map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.gauges[name] = value
+}
+
+// test that stack reports its counters to injected metrics registry
+func TestNewDltStack_Metrics(t *testing.T) {
+	if _, err := NewDltStack(WithConfig(p2p.TestConfig()), WithMetrics(nil)); err == nil {
+		t.Errorf("expected stack with nil metrics registry to fail")
+	}
+	metrics := &mockMetrics{counters: make(map[string]uint64), gauges: make(map[string]float64)}
+	stack, err := NewDltStack(WithConfig(p2p.TestConfig()), WithMetrics(metrics),
+		WithP2P(func(conf p2p.Config, r p2p.Runner) (p2p.Layer, error) {
+			return p2p.TestP2PLayer("mock p2p"), nil
+		}))
+	if err != nil {
+		t.Fatalf("failed to create stack: %s", err)
+	}
+	app := TestAppConfig()
+	stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil })
+	tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("submission failed: %s", err)
+	}
+	stack.recordDoubleSpend(NewMockPeer(p2p.TestConn()), tx, tx, RESOLUTION_PEER_FLUSH)
+	stack.stats.txRejected(endorsement.ERR_THROTTLED)
+	stack.stats.peerConnected()
+	counters := stack.Counters()
+	shardId := string(app.ShardId)
+	if metrics.counters[MetricTxAccepted+shardId] != 1 ||
+		metrics.counters[MetricBytesGossiped+shardId] != counters.BytesGossiped ||
+		metrics.counters[MetricDoubleSpends] != counters.DoubleSpends ||
+		metrics.counters[MetricTxRejected+endorsementRejections[endorsement.ERR_THROTTLED]] != 1 ||
+		metrics.gauges[MetricPeers] != 1 {
+		t.Errorf("incorrect metrics: %+v, %+v", metrics.counters, metrics.gauges)
+	}
+}
+
+// test that anchor uncle cap policy is applied to stack's sharder
+func TestNewDltStack_MaxAnchorUncles(t *testing.T) {
+	var sharder *mockSharder
+	policies := defaultPolicies()
+	policies.MaxAnchorUncles = 3
+	if _, err := NewDltStack(WithConfig(p2p.TestConfig()), WithPolicies(policies),
+		WithSharder(func(db repo.DltDb, dbp db.DbProvider) (shard.Sharder, error) {
+			sharder = NewMockSharder(db)
+			return sharder, nil
+		})); err != nil {
+		t.Errorf("failed to create stack: %s", err)
+	} else if sharder.MaxUncles != 3 {
+		t.Errorf("uncle cap not applied to sharder: %d", sharder.MaxUncles)
+	}
+}
+
+// stack should use codec selected in config for sync messages, and refuse an unknown codec
+func TestNewDltStack_Codec(t *testing.T) {
+	conf := p2p.TestConfig()
+	if stack, err := NewDltStack(WithConfig(conf)); err != nil || stack.codec != common.GobCodec {
+		t.Errorf("stack did not default to gob codec: %s", err)
+	}
+	conf.Codec = common.CodecProtobuf
+	stack, err := NewDltStack(WithConfig(conf))
+	if err != nil || stack.codec != common.ProtobufCodec {
+		t.Fatalf("stack did not use protobuf codec: %s", err)
+	}
+	tx := TestSignedTransaction("test payload")
+	tx.SetTraceId("trace-1")
+	msg := NewTxShardChildResponseMsg(tx, nil, stack.codec)
+	decoded := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if err := stack.codec.Unmarshal(msg.Bytes, decoded); err != nil {
+		t.Errorf("failed to decode transaction: %s", err)
+	} else if decoded.Id() != tx.Id() || decoded.TraceId() != "trace-1" || string(decoded.Request().Payload) != "test payload" {
+		t.Errorf("transaction did not round trip: %x", decoded.Id())
+	}
+	conf.Codec = "cbor"
+	if _, err := NewDltStack(WithConfig(conf)); err == nil {
+		t.Errorf("expected stack with unknown codec to fail")
+	}
+}
+
+func TestNewDltStack_MaxResourceSize(t *testing.T) {
+	var sharder *mockSharder
+	policies := defaultPolicies()
+	policies.MaxResourceSize = 1024
+	if _, err := NewDltStack(WithConfig(p2p.TestConfig()), WithPolicies(policies),
+		WithSharder(func(db repo.DltDb, dbp db.DbProvider) (shard.Sharder, error) {
+			sharder = NewMockSharder(db)
+			return sharder, nil
+		})); err != nil {
+		t.Errorf("failed to create stack: %s", err)
+	} else if sharder.MaxValueSize != 1024 {
+		t.Errorf("resource size limit not applied to sharder: %d", sharder.MaxValueSize)
+	}
+}
+
+// test that stack runs the same over in-memory and persistent storage providers
+func TestNewDltStack_StorageProviders(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "storage")
+	defer os.RemoveAll(dir)
+	persistent, err := dbp.NewDbpWithOptions(filepath.Join(dir, "data"), dbp.DefaultOptions())
+	if err != nil {
+		t.Fatalf("failed to create db provider: %s", err)
+	}
+	for name, provider := range map[string]db.DbProvider{"in-memory": db.NewInMemDbProvider(), "leveldb": persistent} {
+		stack, err := NewDltStack(WithConfig(p2p.TestConfig()), WithStorage(provider))
+		if err != nil {
+			t.Errorf("%s: failed to create stack: %s", name, err)
+			continue
+		}
+		stack.p2p = p2p.TestP2PLayer("mock p2p")
+		app := TestAppConfig()
+		if err := stack.Register(app.ShardId, app.Name, func(tx dto.Transaction, state state.State) error { return nil }); err != nil {
+			t.Errorf("%s: failed to register app: %s", name, err)
+		} else if tx, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); err != nil {
+			t.Errorf("%s: submission failed: %s", name, err)
+		} else if stack.db.GetTx(tx.Id()) == nil {
+			t.Errorf("%s: submitted transaction not stored", name)
+		}
+		stack.Stop()
+	}
+	// stopping stack should have closed persistent provider, releasing its data directory
+	if provider, err := dbp.NewDbp(filepath.Join(dir, "data")); err != nil {
+		t.Errorf("data directory not released by stack: %s", err)
+	} else {
+		provider.CloseAll()
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2019 The trust-net Authors
+// Capture of inbound peer messages to a file, and replay peers that feed a capture back to the stack
+package p2p
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// an inbound message captured from a peer, captures are files of JSON encoded records, one per line
+type CaptureRecord struct {
+	// time message was read (unix nano)
+	Time int64 `json:"time"`
+	// hex encoded ID of the peer that sent the message
+	PeerId string `json:"peer_id"`
+	// protocol message code and RLP encoded message
+	Code    uint64 `json:"code"`
+	Payload []byte `json:"payload"`
+}
+
+// read all records of a capture, in the order they were captured
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	records := []CaptureRecord{}
+	dec := json.NewDecoder(r)
+	for {
+		record := CaptureRecord{}
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+}
+
+// a capture file shared by all peer connections
+type capture struct {
+	file *os.File
+	enc  *json.Encoder
+	lock sync.Mutex
+}
+
+func newCapture(path string) (*capture, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &capture{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// record a message, its payload is read and replaced so that message can still be decoded
+func (c *capture) record(peerId discover.NodeID, msg *p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	msg.Payload = bytes.NewReader(payload)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	// a failure to write capture should not fail peer's connection
+	c.enc.Encode(&CaptureRecord{
+		Time:    time.Now().UnixNano(),
+		PeerId:  hex.EncodeToString(peerId[:]),
+		Code:    msg.Code,
+		Payload: payload,
+	})
+	return nil
+}
+
+func (c *capture) close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.file.Close()
+}
+
+// a peer connection whose inbound messages are captured
+type captureReadWriter struct {
+	p2p.MsgReadWriter
+	peerId  discover.NodeID
+	capture *capture
+}
+
+func (rw *captureReadWriter) ReadMsg() (p2p.Msg, error) {
+	msg, err := rw.MsgReadWriter.ReadMsg()
+	if err == nil {
+		err = rw.capture.record(rw.peerId, &msg)
+	}
+	return msg, err
+}
+
+// a peer node replaying captured messages, messages are read by stack in the order they are fed
+type ReplayPeer struct {
+	*peerDEVp2p
+	conn *replayConn
+}
+
+// create a replay peer for a captured peer's hex encoded ID
+func NewReplayPeer(peerId string) (*ReplayPeer, error) {
+	id, err := discover.HexID(peerId)
+	if err != nil {
+		return nil, err
+	}
+	conn := &replayConn{
+		msgs: make(chan p2p.Msg),
+		done: make(chan struct{}),
+	}
+	return &ReplayPeer{
+		peerDEVp2p: NewDEVp2pPeer(&replayNode{id: id, conn: conn}, conn),
+		conn:       conn,
+	}, nil
+}
+
+// feed a captured message to peer, blocks until message is read (returns false if peer was closed)
+func (p *ReplayPeer) Feed(record *CaptureRecord) bool {
+	msg := p2p.Msg{
+		Code:       record.Code,
+		Size:       uint32(len(record.Payload)),
+		Payload:    bytes.NewReader(record.Payload),
+		ReceivedAt: time.Unix(0, record.Time),
+	}
+	select {
+	case p.conn.msgs <- msg:
+		return true
+	case <-p.conn.done:
+		return false
+	}
+}
+
+// close peer, any further read fails with io.EOF
+func (p *ReplayPeer) Close() {
+	p.conn.close()
+}
+
+// messages fed to a replay peer, messages sent to replay peer are discarded
+type replayConn struct {
+	msgs chan p2p.Msg
+	done chan struct{}
+	once sync.Once
+}
+
+func (c *replayConn) ReadMsg() (p2p.Msg, error) {
+	select {
+	case msg := <-c.msgs:
+		return msg, nil
+	case <-c.done:
+		return p2p.Msg{}, io.EOF
+	}
+}
+
+func (c *replayConn) WriteMsg(msg p2p.Msg) error {
+	return msg.Discard()
+}
+
+func (c *replayConn) close() {
+	c.once.Do(func() { close(c.done) })
+}
+
+// implements peerDEVp2pWrapper interface for a captured peer
+type replayNode struct {
+	id   discover.NodeID
+	conn *replayConn
+}
+
+func (n *replayNode) ID() discover.NodeID {
+	return n.id
+}
+
+func (n *replayNode) Name() string {
+	return "replay"
+}
+
+func (n *replayNode) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (n *replayNode) LocalAddr() net.Addr {
+	return nil
+}
+
+func (n *replayNode) Disconnect(reason p2p.DiscReason) {
+	n.conn.close()
+}
+
+func (n *replayNode) String() string {
+	return "Replay " + n.id.TerminalString()
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 The trust-net Authors
+package p2p
+
+import (
+	"bytes"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testCaptureMsg struct {
+	Value string
+}
+
+// captured messages should still be readable from connection, and replayable from capture
+func TestCapture(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "capture")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.json")
+	c, err := newCapture(path)
+	if err != nil {
+		t.Fatalf("failed to create capture: %s", err)
+	}
+	conn := TestConn()
+	conn.NextMsg(3, &testCaptureMsg{Value: "test"})
+	peerId := discover.NodeID{1, 2, 3}
+	rw := &captureReadWriter{MsgReadWriter: conn, peerId: peerId, capture: c}
+	msg, err := rw.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read message: %s", err)
+	}
+	if m := (&testCaptureMsg{}); msg.Decode(m) != nil || m.Value != "test" {
+		t.Errorf("captured message not decoded")
+	}
+	c.close()
+
+	// read back the capture
+	data, _ := ioutil.ReadFile(path)
+	records, err := ReadCapture(bytes.NewReader(data))
+	if err != nil || len(records) != 1 {
+		t.Fatalf("incorrect capture: %d, %v", len(records), err)
+	}
+	if records[0].Code != 3 || records[0].PeerId != peerId.String() || records[0].Time == 0 {
+		t.Errorf("incorrect capture record: %+v", records[0])
+	}
+
+	// replay the captured message
+	peer, err := NewReplayPeer(records[0].PeerId)
+	if err != nil {
+		t.Fatalf("failed to create replay peer: %s", err)
+	}
+	if string(peer.ID()) != string(peerId[:]) {
+		t.Errorf("incorrect replay peer ID")
+	}
+	go peer.Feed(&records[0])
+	if msg, err := peer.ReadMsg(); err != nil || msg.Code() != 3 {
+		t.Errorf("failed to read replayed message: %v", err)
+	} else if m := (&testCaptureMsg{}); msg.Decode(m) != nil || m.Value != "test" {
+		t.Errorf("replayed message not decoded")
+	}
+	// closed peer should fail reads, and not accept more messages
+	peer.Close()
+	if _, err := peer.ReadMsg(); err == nil {
+		t.Errorf("expected read from closed peer to fail")
+	}
+	if peer.Feed(&records[0]) {
+		t.Errorf("closed peer accepted message")
+	}
+}
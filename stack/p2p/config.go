@@ -28,7 +28,8 @@ type Config struct {
 	KeyType string `json:"key_type"       gencodec:"required"`
 
 	// MaxPeers is the maximum number of peers that can be
-	// connected. It must be greater than zero.
+	// connected. It must be greater than zero. Node stops dialing
+	// peers learned from peer exchange once it has max peers.
 	MaxPeers int `json:"max_peers"       gencodec:"required"`
 
 	// Name sets the node name of this server.
@@ -38,6 +39,11 @@ type Config struct {
 	// with the rest of the network.
 	Bootnodes []string `json:"boot_nodes"`
 
+	// If set to true, node exchanges known peers with connected peers,
+	// and dials peers it learns about (up to MaxPeers), so that a node
+	// can join the network with a single bootnode.
+	PeerExchange bool `json:"peer_exchange"`
+
 	// Name should contain the official protocol name,
 	// often a three-letter word.
 	ProtocolName string `json:"proto_name"       gencodec:"required"`
@@ -59,6 +65,58 @@ type Config struct {
 	// If set to true, the listening port is made available to the
 	// Internet.
 	NAT bool
+
+	// If set to true, transaction trace IDs are included in gossip to
+	// peers (requires peers that understand the trace envelope field).
+	GossipTrace bool `json:"gossip_trace"`
+
+	// If set to true, node sends a rejection (NACK) message back toward
+	// the originator of a gossiped transaction that it rejects.
+	SendNacks bool `json:"send_nacks"`
+
+	// If set to true, node sends an acknowledgement (ACK) message back to
+	// the peer that sent it a transaction that it accepts, for the peer to
+	// track latency of its transactions (requires peers that understand
+	// acknowledgement messages).
+	SendAcks bool `json:"send_acks"`
+
+	// If set to true, node announces the shards it stores to its peers,
+	// and peers forward it transactions of only those shards (node then
+	// does not learn about new shards until it registers or joins them).
+	AnnounceShards bool `json:"announce_shards"`
+
+	// If set, inbound messages from peers are recorded (along with time
+	// and peer ID) to this file, for offline replay when debugging.
+	CaptureFile string `json:"capture_file"`
+
+	// Trusted checkpoints for bootstrapping shards, node refuses
+	// any network history that conflicts with these.
+	Checkpoints []Checkpoint `json:"checkpoints"`
+
+	// Retention policies of shards, for pruning shards' history
+	// (shards without a policy keep their full history).
+	Retention []Retention `json:"retention"`
+
+	// Codec of transactions exchanged during sync with peers, "gob" (default)
+	// or "protobuf" (all nodes of a network must use same codec).
+	Codec string `json:"codec"`
+}
+
+// A trusted checkpoint in a shard's history (hex encoded values)
+type Checkpoint struct {
+	ShardId   string `json:"shard_id"`
+	TxId      string `json:"tx_id"`
+	ShardSeq  uint64 `json:"shard_seq"`
+	StateRoot string `json:"state_root"`
+}
+
+// A shard's retention policy (hex encoded shard ID)
+type Retention struct {
+	ShardId string `json:"shard_id"`
+	// one of "keep_forever", "keep_epochs" or "payload_prune"
+	Policy string `json:"policy"`
+	// number of most recent epochs kept in full
+	Epochs uint64 `json:"epochs"`
 }
 
 func (c *Config) key() (*ecdsa.PrivateKey, error) {
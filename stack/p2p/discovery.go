@@ -0,0 +1,207 @@
+// Copyright 2019 The trust-net Authors
+// Peer exchange, so that a node started with a single bootnode learns and connects to network's other peers
+package p2p
+
+import (
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"net"
+	"sync"
+	"time"
+)
+
+// name and version of peer exchange protocol, run alongside DAG protocol on same connections
+const (
+	peerExchangeProtocol = "dagpx"
+	peerExchangeVersion  = 1
+)
+
+// message codes of peer exchange protocol
+const (
+	// request for peers known to remote node
+	getPeersMsgCode = iota
+	// list of known peers (including sender itself)
+	peersMsgCode
+	peerExchangeLength
+)
+
+// interval at which connected peers are asked for peers they know
+var PeerExchangeInterval = time.Minute
+
+// maximum number of peers remembered from peer exchange
+var MaxKnownPeers = 256
+
+// maximum number of peers sent in a single peers message
+var MaxPeersPerMsg = 16
+
+// peers known to a node, as enode URLs
+type peersMsg struct {
+	Nodes []string
+}
+
+type peerExchange struct {
+	// own node
+	self func() *discover.Node
+	// connect to a node, and stop reconnecting to it
+	addPeer    func(node *discover.Node)
+	removePeer func(node *discover.Node)
+	// number of connected peers, and maximum allowed
+	peerCount func() int
+	maxPeers  int
+	// nodes learned from peers, those this node dialed, and those connected
+	known     map[discover.NodeID]*discover.Node
+	dialed    map[discover.NodeID]*discover.Node
+	connected map[discover.NodeID]bool
+	lock      sync.Mutex
+}
+
+func newPeerExchange(srv func() *p2p.Server, maxPeers int) *peerExchange {
+	return &peerExchange{
+		self:       func() *discover.Node { return srv().Self() },
+		addPeer:    func(node *discover.Node) { srv().AddPeer(node) },
+		removePeer: func(node *discover.Node) { srv().RemovePeer(node) },
+		peerCount:  func() int { return srv().PeerCount() },
+		maxPeers:   maxPeers,
+		known:      make(map[discover.NodeID]*discover.Node),
+		dialed:     make(map[discover.NodeID]*discover.Node),
+		connected:  make(map[discover.NodeID]bool),
+	}
+}
+
+func (x *peerExchange) protocol() p2p.Protocol {
+	return p2p.Protocol{
+		Name:    peerExchangeProtocol,
+		Version: peerExchangeVersion,
+		Length:  peerExchangeLength,
+		Run: func(dPeer *p2p.Peer, dRw p2p.MsgReadWriter) error {
+			return x.run(dPeer, dRw)
+		},
+	}
+}
+
+// exchange peers with a connected node, until connection is closed
+func (x *peerExchange) run(peer peerDEVp2pWrapper, rw p2p.MsgReadWriter) error {
+	x.lock.Lock()
+	x.connected[peer.ID()] = true
+	x.lock.Unlock()
+	defer x.disconnected(peer.ID())
+	// advertise self and ask for peers, and keep asking periodically to learn about nodes that join later
+	if self := x.self(); self != nil {
+		if err := p2p.Send(rw, peersMsgCode, &peersMsg{Nodes: []string{self.String()}}); err != nil {
+			return err
+		}
+	}
+	if err := p2p.Send(rw, getPeersMsgCode, struct{}{}); err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(PeerExchangeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				p2p.Send(rw, getPeersMsgCode, struct{}{})
+			case <-done:
+				return
+			}
+		}
+	}()
+	for {
+		msg, err := rw.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch msg.Code {
+		case getPeersMsgCode:
+			err = p2p.Send(rw, peersMsgCode, &peersMsg{Nodes: x.peers(peer.ID())})
+		case peersMsgCode:
+			resp := peersMsg{}
+			if err = msg.Decode(&resp); err == nil {
+				x.learn(peer, resp.Nodes)
+			}
+		}
+		msg.Discard()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// known nodes to send to a peer (excluding the peer itself), along with self
+func (x *peerExchange) peers(exclude discover.NodeID) []string {
+	nodes := []string{}
+	if self := x.self(); self != nil {
+		nodes = append(nodes, self.String())
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	// map iteration picks a random subset when there are more known nodes than fit in a message
+	for id, node := range x.known {
+		if len(nodes) >= MaxPeersPerMsg {
+			break
+		}
+		if id != exclude {
+			nodes = append(nodes, node.String())
+		}
+	}
+	return nodes
+}
+
+// remember nodes received from a peer, and dial new ones while below max peers
+func (x *peerExchange) learn(peer peerDEVp2pWrapper, urls []string) {
+	var selfId discover.NodeID
+	if self := x.self(); self != nil {
+		selfId = self.ID
+	}
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	for _, url := range urls {
+		node, err := discover.ParseNode(url)
+		if err != nil || node.ID == selfId {
+			continue
+		}
+		// a node listening on all interfaces advertises an unspecified IP, use the address it connected from
+		if node.IP.IsUnspecified() && node.ID == peer.ID() {
+			if addr, ok := peer.RemoteAddr().(*net.TCPAddr); ok {
+				node.IP = addr.IP
+			}
+		}
+		if node.IP.IsUnspecified() {
+			continue
+		}
+		if _, found := x.known[node.ID]; !found {
+			if len(x.known) >= MaxKnownPeers {
+				continue
+			}
+			x.known[node.ID] = node
+		}
+		if _, found := x.dialed[node.ID]; !found && !x.connected[node.ID] && x.peerCount()+x.pending() < x.maxPeers {
+			x.dialed[node.ID] = node
+			x.addPeer(node)
+		}
+	}
+}
+
+// number of dialed nodes not yet connected
+func (x *peerExchange) pending() int {
+	count := 0
+	for id := range x.dialed {
+		if !x.connected[id] {
+			count += 1
+		}
+	}
+	return count
+}
+
+// stop re-dialing a disconnected node that was dialed from peer exchange, it may be dialed again when learned again
+func (x *peerExchange) disconnected(id discover.NodeID) {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	delete(x.connected, id)
+	if node, found := x.dialed[id]; found {
+		delete(x.dialed, id)
+		x.removePeer(node)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2019 The trust-net Authors
+package p2p
+
+import (
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"net"
+	"testing"
+)
+
+func testNode(ip string) *discover.Node {
+	key, _ := crypto.GenerateKey()
+	return discover.NewNode(discover.PubkeyID(&key.PublicKey), net.ParseIP(ip), 30303, 30303)
+}
+
+// build a peer exchange with a fixed self node and recorded dials
+func testPeerExchange(maxPeers int) (*peerExchange, *[]*discover.Node, *[]*discover.Node) {
+	self := testNode("10.0.0.1")
+	added, removed := []*discover.Node{}, []*discover.Node{}
+	x := &peerExchange{
+		self:       func() *discover.Node { return self },
+		addPeer:    func(node *discover.Node) { added = append(added, node) },
+		removePeer: func(node *discover.Node) { removed = append(removed, node) },
+		peerCount:  func() int { return 1 },
+		maxPeers:   maxPeers,
+		known:      make(map[discover.NodeID]*discover.Node),
+		dialed:     make(map[discover.NodeID]*discover.Node),
+		connected:  make(map[discover.NodeID]bool),
+	}
+	return x, &added, &removed
+}
+
+// learned nodes should be remembered, and dialed only while below max peers
+func TestPeerExchange_Learn(t *testing.T) {
+	x, added, removed := testPeerExchange(3)
+	peer := TestDEVp2pPeer("mock peer")
+	x.connected[peer.ID()] = true
+	x.learn(peer, []string{
+		x.self().String(),
+		testNode("10.0.0.2").String(),
+		testNode("10.0.0.3").String(),
+		testNode("10.0.0.4").String(),
+		testNode("0.0.0.0").String(),
+		"invalid node",
+	})
+	if len(x.known) != 3 {
+		t.Errorf("incorrect number of known nodes: %d", len(x.known))
+	}
+	if len(*added) != 2 {
+		t.Errorf("incorrect number of dialed nodes: %d", len(*added))
+	}
+	// a dialed node should not be re-dialed once it disconnects
+	x.disconnected((*added)[0].ID)
+	if len(*removed) != 1 || len(x.dialed) != 1 {
+		t.Errorf("disconnected node not removed: %d", len(*removed))
+	}
+}
+
+// peer exchange should advertise self, request peers, and answer peer requests
+func TestPeerExchange_Run(t *testing.T) {
+	x, _, _ := testPeerExchange(3)
+	node := testNode("10.0.0.2")
+	conn := TestConn()
+	conn.NextMsg(peersMsgCode, &peersMsg{Nodes: []string{node.String()}})
+	conn.NextMsg(getPeersMsgCode, struct{}{})
+	if err := x.run(TestDEVp2pPeer("mock peer"), conn); err == nil {
+		t.Errorf("expected run to end with connection error")
+	}
+	if conn.WriteCount != 3 {
+		t.Errorf("incorrect number of messages sent: %d", conn.WriteCount)
+	}
+	if x.known[node.ID] == nil {
+		t.Errorf("node not learned from peer")
+	}
+	if nodes := x.peers(node.ID); len(nodes) != 1 || nodes[0] != x.self().String() {
+		t.Errorf("incorrect peers for requesting node: %v", nodes)
+	}
+}
@@ -11,7 +11,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"math/big"
-//	"sync"
+	"sync"
 )
 
 type Layer interface {
@@ -25,6 +25,8 @@ type Layer interface {
 	Sign(data []byte) ([]byte, error)
 	Verify(data, sign, id []byte) bool
 	Broadcast(msgId []byte, msgcode uint64, data interface{}) error
+	// send a message to connected peers accepted by filter (called with peer's ID)
+	BroadcastTo(msgId []byte, msgcode uint64, data interface{}, filter func(peerId []byte) bool) error
 }
 
 type Runner func(peer Peer) error
@@ -41,7 +43,12 @@ type layerDEVp2p struct {
 	cb    Runner
 	id    []byte
 	peers map[string]Peer
-//	lock  sync.RWMutex
+	// peer exchange, nil if disabled
+	px    *peerExchange
+	// capture of inbound messages, nil if disabled
+	capture *capture
+	// lock of peers map, peers are added and removed by their connections while transactions are broadcast
+	lock sync.RWMutex
 }
 
 func (l *layerDEVp2p) Anchor(a *dto.Anchor) error {
@@ -66,18 +73,32 @@ func (l *layerDEVp2p) Start() error {
 
 func (l *layerDEVp2p) Disconnect(peer Peer) {
 	// remove the peer from peer map
-//	l.lock.Lock()
-//	defer l.lock.Unlock()
+	l.lock.Lock()
 	delete(l.peers, string(peer.ID()))
+	l.lock.Unlock()
 	peer.Disconnect()
 }
 
+// snapshot of connected peers
+func (l *layerDEVp2p) connected() []Peer {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+	peers := make([]Peer, 0, len(l.peers))
+	for _, peer := range l.peers {
+		peers = append(peers, peer)
+	}
+	return peers
+}
+
 func (l *layerDEVp2p) Stop() {
 	// disconnect from all connected peers
-	for _, peer := range l.peers {
+	for _, peer := range l.connected() {
 		peer.Disconnect()
 	}
 	l.srv.Stop()
+	if l.capture != nil {
+		l.capture.close()
+	}
 }
 
 func (l *layerDEVp2p) Self() string {
@@ -106,6 +127,11 @@ func (l *layerDEVp2p) sign(data []byte) ([]byte, error) {
 }
 
 func (l *layerDEVp2p) Verify(payload, sign, id []byte) bool {
+	return VerifySignature(payload, sign, id)
+}
+
+// verify a signature of payload by the ID's key, usable without a p2p layer instance (e.g. by auditors)
+func VerifySignature(payload, sign, id []byte) bool {
 	// extract submitter's key
 	key := crypto.ToECDSAPub(id)
 	if key == nil || key.X == nil {
@@ -134,7 +160,7 @@ func (l *layerDEVp2p) Verify(payload, sign, id []byte) bool {
 
 func (l *layerDEVp2p) Broadcast(msgId []byte, msgcode uint64, data interface{}) error {
 	// walk through list of peers and send messages
-	for _, peer := range l.peers {
+	for _, peer := range l.connected() {
 		if err := peer.Send(msgId, msgcode, data); err != nil {
 			// skip
 		}
@@ -142,17 +168,29 @@ func (l *layerDEVp2p) Broadcast(msgId []byte, msgcode uint64, data interface{})
 	return nil
 }
 
+func (l *layerDEVp2p) BroadcastTo(msgId []byte, msgcode uint64, data interface{}, filter func(peerId []byte) bool) error {
+	for _, peer := range l.connected() {
+		if filter(peer.ID()) {
+			peer.Send(msgId, msgcode, data)
+		}
+	}
+	return nil
+}
+
 // we are just wrapping the callback to hide the DEVp2p specific details
 func (l *layerDEVp2p) runner(dPeer *p2p.Peer, dRw p2p.MsgReadWriter) error {
+	if l.capture != nil {
+		dRw = &captureReadWriter{MsgReadWriter: dRw, peerId: dPeer.ID(), capture: l.capture}
+	}
 	peer := NewDEVp2pPeer(dPeer, dRw)
 	// add the peer to layer's peers map
-//	l.lock.Lock()
+	l.lock.Lock()
 	l.peers[string(peer.ID())] = peer
-//	l.lock.Unlock()
+	l.lock.Unlock()
 	defer func() {
-//		l.lock.Lock()
+		l.lock.Lock()
 		delete(l.peers, string(peer.ID()))
-//		l.lock.Unlock()
+		l.lock.Unlock()
 	}()
 	return l.cb(peer)
 }
@@ -181,6 +219,15 @@ func NewDEVp2pLayer(c Config, cb Runner) (*layerDEVp2p, error) {
 		peers: make(map[string]Peer),
 	}
 	impl.conf.Protocols = impl.makeDEVp2pProtocols(c)
+	if c.PeerExchange {
+		impl.px = newPeerExchange(func() *p2p.Server { return impl.srv }, c.MaxPeers)
+		impl.conf.Protocols = append(impl.conf.Protocols, impl.px.protocol())
+	}
+	if len(c.CaptureFile) > 0 {
+		if impl.capture, err = newCapture(c.CaptureFile); err != nil {
+			return nil, err
+		}
+	}
 	impl.srv = &p2p.Server{Config: *impl.conf}
 	return impl, nil
 }
@@ -11,7 +11,7 @@ import (
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/repo"
 	"net"
-//	"sync"
+	"sync"
 )
 
 // P2P layer's wrapper for extracting Peer interface from underlying implementations
@@ -81,8 +81,9 @@ type peerDEVp2p struct {
 	states         map[int]interface{}
 	shardChildrenQ repo.Queue
 	txStack        []dto.Transaction
-//	lock           sync.RWMutex
-	logger         log.Logger
+	// lock of peer's states, seen set and fetch stack, updated by concurrent jobs of different shards
+	lock   sync.RWMutex
+	logger log.Logger
 }
 
 func NewDEVp2pPeer(peer peerDEVp2pWrapper, rw p2p.MsgReadWriter) *peerDEVp2p {
@@ -127,21 +128,31 @@ func (p *peerDEVp2p) LocalAddr() net.Addr {
 }
 
 func (p *peerDEVp2p) Disconnect() {
+	p.lock.Lock()
 	p.status = Disconnected
+	p.lock.Unlock()
 	p.peer.Disconnect(p2p.DiscSelf)
 	return
 }
 
 func (p *peerDEVp2p) Status() int {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	return p.status
 }
 
+func (p *peerDEVp2p) seenSet() *common.Set {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.seen
+}
+
 func (p *peerDEVp2p) String() string {
 	return p.peer.String()
 }
 
 func (p *peerDEVp2p) Send(msgId []byte, msgcode uint64, data interface{}) error {
-	if !p.seen.Has(string(msgId)) {
+	if !p.seenSet().Has(string(msgId)) {
 		p.Seen(msgId)
 		return p2p.Send(p.rw, msgcode, data)
 	}
@@ -149,15 +160,18 @@ func (p *peerDEVp2p) Send(msgId []byte, msgcode uint64, data interface{}) error
 }
 
 func (p *peerDEVp2p) Seen(msgId []byte) {
-	if p.seen.Size() > 100 {
+	seen := p.seenSet()
+	if seen.Size() > 100 {
 		for i := 0; i < 20; i += 1 {
-			p.seen.Pop()
+			seen.Pop()
 		}
 	}
-	p.seen.Add(string(msgId))
+	seen.Add(string(msgId))
 }
 
 func (p *peerDEVp2p) ResetSeen() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.seen = common.NewSet()
 }
 
@@ -170,11 +184,15 @@ func (p *peerDEVp2p) ReadMsg() (Msg, error) {
 }
 
 func (p *peerDEVp2p) SetState(stateId int, stateData interface{}) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.states[stateId] = stateData
 	return nil
 }
 
 func (p *peerDEVp2p) GetState(stateId int) interface{} {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
 	return p.states[stateId]
 }
 
@@ -183,15 +201,15 @@ func (p *peerDEVp2p) ShardChildrenQ() repo.Queue {
 }
 
 func (p *peerDEVp2p) ToBeFetchedStackPush(tx dto.Transaction) error {
-//	p.lock.Lock()
-//	defer p.lock.Unlock()
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	p.txStack = append([]dto.Transaction{tx}, p.txStack...)
 	return nil
 }
 
 func (p *peerDEVp2p) ToBeFetchedStackPop() dto.Transaction {
-//	p.lock.Lock()
-//	defer p.lock.Unlock()
+	p.lock.Lock()
+	defer p.lock.Unlock()
 	if len(p.txStack) > 0 {
 		tx := p.txStack[0]
 		p.txStack = p.txStack[1:]
@@ -3,6 +3,7 @@
 package p2p
 
 import (
+	"crypto/sha256"
 	"errors"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
@@ -65,9 +66,13 @@ type MockP2P struct {
 	DidBroadcast  bool
 	BroadcastCode uint64
 	BroadcastMsg  interface{}
-	IsAnchored    bool
-	Name          string
-	ID            []byte
+	// filter of last broadcast, nil if broadcast was to all peers
+	BroadcastFilter func(peerId []byte) bool
+	IsAnchored      bool
+	Name            string
+	ID              []byte
+	// fail verification of all signatures
+	InvalidSignatures bool
 }
 
 func (p2p *MockP2P) Anchor(a *dto.Anchor) error {
@@ -101,17 +106,26 @@ func (p2p *MockP2P) Id() []byte {
 }
 
 func (p2p *MockP2P) Sign(data []byte) ([]byte, error) {
-	return []byte("signature"), nil
+	// signature is unique per data, so that transactions signed by node have distinct IDs
+	hash := sha256.Sum256(data)
+	return append([]byte("signature"), hash[:]...), nil
 }
 
 func (p2p *MockP2P) Verify(payload, sign, id []byte) bool {
-	return true
+	return !p2p.InvalidSignatures
 }
 
 func (p2p *MockP2P) Broadcast(msgId []byte, msgcode uint64, data interface{}) error {
 	p2p.DidBroadcast = true
 	p2p.BroadcastCode = msgcode
 	p2p.BroadcastMsg = data
+	p2p.BroadcastFilter = nil
+	return nil
+}
+
+func (p2p *MockP2P) BroadcastTo(msgId []byte, msgcode uint64, data interface{}, filter func(peerId []byte) bool) error {
+	p2p.Broadcast(msgId, msgcode, data)
+	p2p.BroadcastFilter = filter
 	return nil
 }
 
@@ -0,0 +1,51 @@
+// Copyright 2019 The trust-net Authors
+// Tracking of versions advertised by connected peers
+package stack
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/version"
+	"sync"
+)
+
+// versions of connected peers, keyed by hex encoded peer id
+type peerVersions struct {
+	peers map[string]version.Info
+	lock  sync.RWMutex
+}
+
+func newPeerVersions() *peerVersions {
+	return &peerVersions{
+		peers: make(map[string]version.Info),
+	}
+}
+
+func (v *peerVersions) set(peerId []byte, info version.Info) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.peers[hex.EncodeToString(peerId)] = info
+}
+
+func (v *peerVersions) remove(peerId []byte) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	delete(v.peers, hex.EncodeToString(peerId))
+}
+
+// copy of versions of all connected peers
+func (v *peerVersions) all() map[string]version.Info {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+	peers := make(map[string]version.Info, len(v.peers))
+	for id, info := range v.peers {
+		peers[id] = info
+	}
+	return peers
+}
+
+func (d *dlt) handleRECV_NodeVersionMsg(peer p2p.Peer, msg *NodeVersionMsg) {
+	info := msg.Info()
+	peer.Logger().Info("Remote node version: %s", info)
+	d.peerVersions.set(peer.ID(), info)
+}
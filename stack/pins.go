@@ -0,0 +1,50 @@
+// Copyright 2019 The trust-net Authors
+// Pinning of transactions by local node, e.g. governance or legal-hold items, so that they're never pruned
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"time"
+)
+
+func (d *dlt) PinTx(id [64]byte, reason string) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	tx := d.db.GetTx(id)
+	if tx == nil {
+		return ErrTxNotFound
+	}
+	return d.db.PinTx(&repo.Pin{
+		TxId:     id,
+		ShardId:  tx.Request().ShardId,
+		ShardSeq: tx.Anchor().ShardSeq,
+		Reason:   reason,
+		PinnedAt: time.Now().Unix(),
+	})
+}
+
+func (d *dlt) UnpinTx(id [64]byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.db.GetPin(id) == nil {
+		return ErrTxNotFound
+	}
+	return d.db.UnpinTx(id)
+}
+
+func (d *dlt) Pins(shardId []byte) []repo.Pin {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.pins(shardId)
+}
+
+// pinned transactions of a shard (any shard for nil), called with lock held
+func (d *dlt) pins(shardId []byte) []repo.Pin {
+	pins := []repo.Pin{}
+	for _, pin := range d.db.GetPins() {
+		if shardId == nil || string(pin.ShardId) == string(shardId) {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}
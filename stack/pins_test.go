@@ -0,0 +1,50 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+// a shard with pinned transactions should not be abandoned, until its transactions are unpinned
+func TestPinTx(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	other := []byte("another shard")
+	stack.Register(other, "another app", func(tx dto.Transaction, state state.State) error { return nil })
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = other
+	tx, err := stack.Submit(submitter.NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("Submission failed: %s", err)
+	}
+	stack.UnregisterShard(other)
+	stack.policies.AbandonedShardPeriod = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+
+	if err := stack.PinTx(dto.RandomHash(), "legal hold"); err != ErrTxNotFound {
+		t.Errorf("Expected pinning of unknown transaction to fail: %s", err)
+	}
+	if err := stack.PinTx(tx.Id(), "legal hold"); err != nil {
+		t.Fatalf("Failed to pin transaction: %s", err)
+	}
+	if pins := stack.Pins(other); len(pins) != 1 || pins[0].TxId != tx.Id() || pins[0].ShardSeq != tx.Anchor().ShardSeq {
+		t.Errorf("Incorrect pins: %v", pins)
+	}
+	if pins := stack.Pins(TestAppConfig().ShardId); len(pins) != 0 {
+		t.Errorf("Pins not filtered by shard: %d", len(pins))
+	}
+	if shards := stack.AbandonedShards(); len(shards) != 0 {
+		t.Errorf("Shard with pinned transaction should not be abandoned")
+	}
+	if err := stack.UnpinTx(tx.Id()); err != nil {
+		t.Fatalf("Failed to unpin transaction: %s", err)
+	}
+	if err := stack.UnpinTx(tx.Id()); err != ErrTxNotFound {
+		t.Errorf("Expected unpinning of transaction that's not pinned to fail: %s", err)
+	}
+	if shards := stack.AbandonedShards(); len(shards) != 1 {
+		t.Errorf("Shard not abandoned after unpinning")
+	}
+}
@@ -5,6 +5,8 @@ package stack
 import (
 	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/version"
+	"time"
 )
 
 // protocol specs
@@ -49,6 +51,22 @@ const (
 	SubmitterProcessDownResponseMsgCode
 	// notify remote node to flush shard due to double spend
 	ForceShardFlushMsgCode
+	// notify originator of a transaction that it was rejected by a remote node
+	TxRejectMsgCode
+	// node's version and enabled features, sent during handshake
+	NodeVersionMsgCode
+	// request for tips of a shard not known locally, answered with a shard sync message
+	ShardTipsRequestMsgCode
+	// sketch of a shard's tips, for reconciling tips with peer without exchanging full tip lists
+	ShardTipsSketchMsgCode
+	// batch of a transaction and its shard DAG descendents request
+	TxShardBatchRequestMsgCode
+	// batch of a transaction and its shard DAG descendents response
+	TxShardBatchResponseMsgCode
+	// shards stored by node, so that peers forward it transactions of only those shards
+	ShardSubscriptionMsgCode
+	// acknowledgement of a transaction accepted by a remote node, back to the peer that sent it
+	TxAckMsgCode
 	// ProtocolLength should contain the number of message codes used
 	// by the protocol.
 	ProtocolLength
@@ -230,10 +248,10 @@ func (m *SubmitterProcessDownResponseMsg) Code() uint64 {
 	return SubmitterProcessDownResponseMsgCode
 }
 
-func NewSubmitterProcessDownResponseMsg(req *SubmitterProcessDownRequestMsg, txs []dto.Transaction) *SubmitterProcessDownResponseMsg {
+func NewSubmitterProcessDownResponseMsg(req *SubmitterProcessDownRequestMsg, txs []dto.Transaction, codec common.Codec) *SubmitterProcessDownResponseMsg {
 	txBytes := [][]byte{}
 	for _, tx := range txs {
-		if bytes, err := tx.Serialize(); err != nil {
+		if bytes, err := codec.Marshal(tx); err != nil {
 			return nil
 		} else {
 			txBytes = append(txBytes, bytes)
@@ -294,8 +312,8 @@ func (m *TxShardChildResponseMsg) Code() uint64 {
 	return TxShardChildResponseMsgCode
 }
 
-func NewTxShardChildResponseMsg(tx dto.Transaction, children [][64]byte) *TxShardChildResponseMsg {
-	if bytes, err := tx.Serialize(); err != nil {
+func NewTxShardChildResponseMsg(tx dto.Transaction, children [][64]byte, codec common.Codec) *TxShardChildResponseMsg {
+	if bytes, err := codec.Marshal(tx); err != nil {
 		return nil
 	} else {
 		return &TxShardChildResponseMsg{
@@ -306,6 +324,52 @@ func NewTxShardChildResponseMsg(tx dto.Transaction, children [][64]byte) *TxShar
 	}
 }
 
+type TxShardBatchRequestMsg struct {
+	Hash [64]byte
+	// max number of transactions in batch
+	MaxTxs uint64
+}
+
+func (m *TxShardBatchRequestMsg) Id() []byte {
+	return append([]byte("TxShardBatchRequestMsg"), m.Hash[:]...)
+}
+
+func (m *TxShardBatchRequestMsg) Code() uint64 {
+	return TxShardBatchRequestMsgCode
+}
+
+type TxShardBatchResponseMsg struct {
+	Hash [64]byte
+	// serialized transactions, starting with requested transaction, with parents before children
+	Txs [][]byte
+	// descendents not included in batch, whose parents are included
+	Pending [][64]byte
+}
+
+func (m *TxShardBatchResponseMsg) Id() []byte {
+	return append([]byte("TxShardBatchResponseMsg"), m.Hash[:]...)
+}
+
+func (m *TxShardBatchResponseMsg) Code() uint64 {
+	return TxShardBatchResponseMsgCode
+}
+
+func NewTxShardBatchResponseMsg(hash [64]byte, txs []dto.Transaction, pending [][64]byte, codec common.Codec) *TxShardBatchResponseMsg {
+	msg := &TxShardBatchResponseMsg{
+		Hash:    hash,
+		Txs:     make([][]byte, 0, len(txs)),
+		Pending: pending,
+	}
+	for _, tx := range txs {
+		if bytes, err := codec.Marshal(tx); err != nil {
+			return nil
+		} else {
+			msg.Txs = append(msg.Txs, bytes)
+		}
+	}
+	return msg
+}
+
 type ForceShardFlushMsg struct {
 	hash  [64]byte
 	Bytes []byte
@@ -319,8 +383,8 @@ func (m *ForceShardFlushMsg) Code() uint64 {
 	return ForceShardFlushMsgCode
 }
 
-func NewForceShardFlushMsg(tx dto.Transaction) *ForceShardFlushMsg {
-	if bytes, err := tx.Serialize(); err != nil {
+func NewForceShardFlushMsg(tx dto.Transaction, codec common.Codec) *ForceShardFlushMsg {
+	if bytes, err := codec.Marshal(tx); err != nil {
 		return nil
 	} else {
 		return &ForceShardFlushMsg{
@@ -329,3 +393,181 @@ func NewForceShardFlushMsg(tx dto.Transaction) *ForceShardFlushMsg {
 		}
 	}
 }
+
+// reasons for rejection of a transaction by a remote node
+const (
+	_ uint64 = iota
+	REJECT_BAD_SIGNATURE
+	REJECT_DOUBLE_SPEND
+	REJECT_INVALID
+	REJECT_SHARD
+	REJECT_LIMIT
+)
+
+// max length of rejection detail carried in a NACK message
+var MaxRejectDetail = 256
+
+type TxRejectMsg struct {
+	// transaction that was rejected
+	TxId [64]byte
+	// shard of the rejected transaction
+	ShardId []byte
+	// node ID of the transaction's originator (from transaction's anchor)
+	Origin []byte
+	// reason code for rejection
+	Reason uint64
+	// human readable detail of rejection
+	Detail string
+	// number of hops message has been forwarded toward originator
+	Hops uint64
+}
+
+func (m *TxRejectMsg) Id() []byte {
+	id := append([]byte("TxRejectMsg"), m.TxId[:]...)
+	return append(id, common.Uint64ToBytes(m.Reason)...)
+}
+
+func (m *TxRejectMsg) Code() uint64 {
+	return TxRejectMsgCode
+}
+
+func NewTxRejectMsg(tx dto.Transaction, reason uint64, detail string) *TxRejectMsg {
+	if len(detail) > MaxRejectDetail {
+		detail = detail[:MaxRejectDetail]
+	}
+	return &TxRejectMsg{
+		TxId:    tx.Id(),
+		ShardId: tx.Request().ShardId,
+		Origin:  tx.Anchor().NodeId,
+		Reason:  reason,
+		Detail:  detail,
+	}
+}
+
+type NodeVersionMsg struct {
+	Semver    string
+	Commit    string
+	BuildTime string
+	Features  []string
+}
+
+func (m *NodeVersionMsg) Id() []byte {
+	id := append([]byte("NodeVersionMsg"), []byte(m.Semver)...)
+	return append(id, []byte(m.Commit)...)
+}
+
+func (m *NodeVersionMsg) Code() uint64 {
+	return NodeVersionMsgCode
+}
+
+func (m *NodeVersionMsg) Info() version.Info {
+	return version.Info{
+		Semver:    m.Semver,
+		Commit:    m.Commit,
+		BuildTime: m.BuildTime,
+		Features:  m.Features,
+	}
+}
+
+type ShardTipsRequestMsg struct {
+	ShardId []byte
+	// unique nonce of request, so that a repeated request is not suppressed as seen message
+	Nonce uint64
+}
+
+func (m *ShardTipsRequestMsg) Id() []byte {
+	id := append([]byte("ShardTipsRequestMsg"), m.ShardId...)
+	return append(id, common.Uint64ToBytes(m.Nonce)...)
+}
+
+func (m *ShardTipsRequestMsg) Code() uint64 {
+	return ShardTipsRequestMsgCode
+}
+
+func NewShardTipsRequestMsg(shardId []byte) *ShardTipsRequestMsg {
+	return &ShardTipsRequestMsg{
+		ShardId: shardId,
+		Nonce:   uint64(time.Now().UnixNano()),
+	}
+}
+
+// a cell of an invertible bloom lookup table of transaction IDs
+type SketchCell struct {
+	// number of IDs inserted into the cell
+	Count uint64
+	// XOR of the IDs inserted into the cell
+	IdSum [64]byte
+	// XOR of check hashes of the IDs inserted into the cell
+	HashSum uint64
+}
+
+type ShardTipsSketchMsg struct {
+	ShardId []byte
+	// invertible bloom lookup table of sender's tips of the shard
+	Cells []SketchCell
+	// true for a sketch sent in reply to peer's sketch, which is not replied to again
+	Reply bool
+	// unique nonce of sketch, so that a periodic sketch is not suppressed as seen message
+	Nonce uint64
+}
+
+func (m *ShardTipsSketchMsg) Id() []byte {
+	id := append([]byte("ShardTipsSketchMsg"), m.ShardId...)
+	return append(id, common.Uint64ToBytes(m.Nonce)...)
+}
+
+func (m *ShardTipsSketchMsg) Code() uint64 {
+	return ShardTipsSketchMsgCode
+}
+
+func NewShardTipsSketchMsg(shardId []byte, cells []SketchCell, reply bool) *ShardTipsSketchMsg {
+	return &ShardTipsSketchMsg{
+		ShardId: shardId,
+		Cells:   cells,
+		Reply:   reply,
+		Nonce:   uint64(time.Now().UnixNano()),
+	}
+}
+
+func NewNodeVersionMsg(info version.Info) *NodeVersionMsg {
+	return &NodeVersionMsg{
+		Semver:    info.Semver,
+		Commit:    info.Commit,
+		BuildTime: info.BuildTime,
+		Features:  info.Features,
+	}
+}
+
+type ShardSubscriptionMsg struct {
+	// sequence of node's announcements, a later announcement replaces earlier ones
+	Seq      uint64
+	ShardIds [][]byte
+}
+
+func (m *ShardSubscriptionMsg) Id() []byte {
+	return append([]byte("ShardSubscriptionMsg"), common.Uint64ToBytes(m.Seq)...)
+}
+
+func (m *ShardSubscriptionMsg) Code() uint64 {
+	return ShardSubscriptionMsgCode
+}
+
+func NewShardSubscriptionMsg(shardIds [][]byte) *ShardSubscriptionMsg {
+	return &ShardSubscriptionMsg{
+		Seq:      uint64(time.Now().UnixNano()),
+		ShardIds: shardIds,
+	}
+}
+
+type TxAckMsg struct {
+	// transaction that was accepted
+	TxId [64]byte
+}
+
+func (m *TxAckMsg) Id() []byte {
+	return append([]byte("TxAckMsg"), m.TxId[:]...)
+}
+
+func (m *TxAckMsg) Code() uint64 {
+	return TxAckMsgCode
+}
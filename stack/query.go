@@ -0,0 +1,74 @@
+// Copyright 2019 The trust-net Authors
+// Read access to transactions and shard history for registered apps
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+)
+
+// error returned when a transaction is not known to the node
+var ErrTxNotFound = errors.New("transaction not found")
+
+// number of transactions an iterator reads from shard's log at a time
+var IteratorPageSize = 100
+
+// iterator over a shard's transactions
+type Iterator interface {
+	// advance to next transaction, returns false at end of shard or on error
+	Next() bool
+	// transaction at iterator's current position
+	Tx() dto.Transaction
+	// error that stopped iteration (e.g. shard.ErrLogCursorInvalid when shard history changed
+	// before iterator's position), nil at end of shard
+	Err() error
+}
+
+// iterator reading shard's log in pages
+type txIterator struct {
+	dlt     *dlt
+	shardId []byte
+	cursor  *shard.LogCursor
+	page    []dto.Transaction
+	current dto.Transaction
+	done    bool
+	err     error
+}
+
+func (it *txIterator) Next() bool {
+	if it.done {
+		return false
+	}
+	if len(it.page) == 0 {
+		it.page, it.cursor, it.err = it.dlt.ShardLog(it.shardId, it.cursor, IteratorPageSize)
+		if it.err != nil || len(it.page) == 0 {
+			it.done, it.current = true, nil
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+func (it *txIterator) Tx() dto.Transaction {
+	return it.current
+}
+
+func (it *txIterator) Err() error {
+	return it.err
+}
+
+func (d *dlt) GetTx(id [64]byte) (dto.Transaction, error) {
+	if tx := d.db.GetTx(id); tx != nil {
+		return tx, nil
+	}
+	return nil, ErrTxNotFound
+}
+
+func (d *dlt) TxIterator(shardId []byte) Iterator {
+	return &txIterator{
+		dlt:     d,
+		shardId: shardId,
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+func TestGetTx(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx, _ := stack.Submit(dto.TestSubmitter().NewRequest("tx1"))
+
+	if got, err := stack.GetTx(tx.Id()); err != nil {
+		t.Errorf("failed to get transaction: %s", err)
+	} else if got.Id() != tx.Id() {
+		t.Errorf("incorrect transaction: %x", got.Id())
+	}
+	if _, err := stack.GetTx(dto.RandomHash()); err != ErrTxNotFound {
+		t.Errorf("expected not found error, got: %s", err)
+	}
+}
+
+// iterator should walk shard's transactions in topological order, across pages
+func TestTxIterator(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	defer func(size int) { IteratorPageSize = size }(IteratorPageSize)
+	IteratorPageSize = 2
+
+	submitter := dto.TestSubmitter()
+	ids := [][64]byte{}
+	for i := 0; i < 5; i++ {
+		tx, err := stack.Submit(submitter.NewRequest("tx"))
+		if err != nil {
+			t.Fatalf("submission failed: %s", err)
+		}
+		submitter.LastTx = tx.Id()
+		submitter.Seq += 1
+		ids = append(ids, tx.Id())
+	}
+
+	it := stack.TxIterator(stack.app.ShardId)
+	count := 0
+	for it.Next() {
+		if count >= len(ids) || it.Tx().Id() != ids[count] {
+			t.Errorf("incorrect transaction at position %d: %x", count, it.Tx().Id())
+		}
+		count++
+	}
+	if it.Err() != nil {
+		t.Errorf("iteration failed: %s", it.Err())
+	}
+	if count != len(ids) {
+		t.Errorf("incorrect number of transactions iterated: %d", count)
+	}
+	if it.Next() || it.Tx() != nil {
+		t.Errorf("iterator should stay at end of shard")
+	}
+}
+
+func TestTxIterator_UnknownShard(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	it := stack.TxIterator([]byte("unknown shard"))
+	if it.Next() {
+		t.Errorf("should not iterate unknown shard")
+	}
+	if it.Err() == nil {
+		t.Errorf("expected error for unknown shard")
+	}
+}
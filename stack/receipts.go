@@ -0,0 +1,90 @@
+// Copyright 2019 The trust-net Authors
+// Finality status of transactions, updated as they are submitted, confirmed by peers, rejected or rolled back
+package stack
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"time"
+)
+
+// finality status of a transaction
+const (
+	// submitted to local node and broadcast, but not yet built upon by any peer
+	TX_PENDING = "pending"
+	// confirmed by a peer building on top of it (or received from network)
+	TX_ACCEPTED = "accepted"
+	// rejected by a remote peer
+	TX_REJECTED = "rejected"
+	// rolled back after losing a conflict with a competing transaction
+	TX_ORPHANED = "orphaned"
+)
+
+// update status of a transaction's receipt
+func (d *dlt) setStatus(txId [64]byte, status, detail string) {
+	if err := d.receipts.Set(&repo.TxReceipt{
+		TxId:      txId,
+		Status:    status,
+		Detail:    detail,
+		UpdatedAt: time.Now().Unix(),
+	}); err != nil {
+		d.logger.Error("Failed to update receipt of transaction %x: %s", txId, err)
+	}
+}
+
+// update receipts of a transaction accepted into local DAG, a transaction anchored by local node stays pending
+// until a transaction from another node builds on it, which confirms its pending ancestors
+func (d *dlt) receiptAccepted(tx dto.Transaction) {
+	nodeId := tx.Anchor().NodeId
+	if string(nodeId) == string(d.p2p.Id()) {
+		d.setStatus(tx.Id(), TX_PENDING, "")
+		return
+	}
+	d.setStatus(tx.Id(), TX_ACCEPTED, "")
+	detail := fmt.Sprintf("confirmed by node %x", nodeId)
+	parents := append([][64]byte{tx.Anchor().ShardParent}, tx.Anchor().ShardUncles...)
+	visited := make(map[[64]byte]bool)
+	for len(parents) > 0 {
+		id := parents[0]
+		parents = parents[1:]
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		if receipt := d.receipts.Get(id); receipt == nil || receipt.Status != TX_PENDING {
+			continue
+		}
+		d.setStatus(id, TX_ACCEPTED, detail)
+		if parent := d.db.GetTx(id); parent != nil {
+			parents = append(parents, parent.Anchor().ShardParent)
+			parents = append(parents, parent.Anchor().ShardUncles...)
+		}
+	}
+}
+
+// mark a pending transaction rejected by a remote peer, a transaction already confirmed by another peer stays accepted
+func (d *dlt) receiptRejected(txId [64]byte, detail string) {
+	if receipt := d.receipts.Get(txId); receipt == nil || receipt.Status == TX_PENDING {
+		d.setStatus(txId, TX_REJECTED, detail)
+	}
+}
+
+func (d *dlt) Status(txId [64]byte) (string, error) {
+	if receipt, err := d.Receipt(txId); err != nil {
+		return "", err
+	} else {
+		return receipt.Status, nil
+	}
+}
+
+func (d *dlt) Receipt(txId [64]byte) (*repo.TxReceipt, error) {
+	if receipt := d.receipts.Get(txId); receipt != nil {
+		return receipt, nil
+	}
+	// transactions accepted before receipts were tracked
+	if d.db.GetTx(txId) != nil {
+		return &repo.TxReceipt{TxId: txId, Status: TX_ACCEPTED}, nil
+	}
+	return nil, ErrTxNotFound
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+// a submitted transaction should be pending until a transaction from another node builds on it
+func TestStatus_Confirmed(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	if _, err := stack.Status(dto.RandomHash()); err != ErrTxNotFound {
+		t.Errorf("Expected status of unknown transaction to fail: %s", err)
+	}
+	tx1, _ := stack.Submit(dto.TestSubmitter().NewRequest("test payload 1"))
+	tx2, _ := stack.Submit(dto.TestSubmitter().NewRequest("test payload 2"))
+	if tx1 == nil || tx2 == nil || tx2.Anchor().ShardParent != tx1.Id() {
+		t.Fatalf("Submission failed")
+	}
+	if status, err := stack.Status(tx2.Id()); err != nil || status != TX_PENDING {
+		t.Errorf("Incorrect status of submitted transaction: %s, %v", status, err)
+	}
+	remote := dto.TestSignedTransaction("remote payload")
+	remote.Anchor().ShardParent = tx2.Id()
+	stack.receiptAccepted(remote)
+	for _, tx := range []dto.Transaction{tx1, tx2, remote} {
+		if status, _ := stack.Status(tx.Id()); status != TX_ACCEPTED {
+			t.Errorf("Incorrect status of confirmed transaction: %s", status)
+		}
+	}
+	// rejection of a confirmed transaction should not change its status
+	msg := NewTxRejectMsg(tx1, REJECT_INVALID, "invalid")
+	msg.Origin = stack.p2p.Id()
+	stack.handleRECV_TxRejectMsg(NewMockPeer(p2p.TestConn()), msg)
+	if status, _ := stack.Status(tx1.Id()); status != TX_ACCEPTED {
+		t.Errorf("Incorrect status of confirmed transaction after rejection: %s", status)
+	}
+}
+
+// a pending transaction rejected by a remote peer should be marked rejected
+func TestStatus_Rejected(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx, _ := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	msg := NewTxRejectMsg(tx, REJECT_SHARD, "rejected by app")
+	msg.Origin = stack.p2p.Id()
+	stack.handleRECV_TxRejectMsg(NewMockPeer(p2p.TestConn()), msg)
+	if receipt, err := stack.Receipt(tx.Id()); err != nil || receipt.Status != TX_REJECTED || receipt.Detail != "rejected by app" {
+		t.Errorf("Incorrect receipt of rejected transaction: %v, %v", receipt, err)
+	}
+}
+
+// a local transaction losing a conflict should be marked orphaned
+func TestStatus_Orphaned(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	local, _ := stack.Submit(submitter.NewRequest("local payload"))
+	if local == nil {
+		t.Fatalf("Submission failed")
+	}
+	competing := submitter.NewTransaction(&dto.Anchor{
+		NodeId:      []byte("remote node"),
+		ShardParent: local.Anchor().ShardParent,
+		ShardSeq:    local.Anchor().ShardSeq,
+		Weight:      local.Anchor().Weight - 1,
+	}, "remote payload")
+	stack.sharder.LockState()
+	_, err := stack.rollback(NewMockPeer(p2p.TestConn()), local, competing)
+	stack.sharder.UnlockState()
+	if err != nil {
+		t.Fatalf("Rollback failed: %s", err)
+	}
+	if status, _ := stack.Status(local.Id()); status != TX_ORPHANED {
+		t.Errorf("Incorrect status of rolled back transaction: %s", status)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2019 The trust-net Authors
+// Fetching tips of a shard not known locally from peers, before issuing an anchor for the shard
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"time"
+)
+
+// check whether a shard is known locally beyond its genesis transaction (called with lock held)
+func (d *dlt) shardKnown(shardId []byte) bool {
+	for _, tip := range d.db.ShardTips(shardId) {
+		if node := d.db.GetShardDagNode(tip); node != nil && node.Depth > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// request tips of a registered app's shard (first registered app's shard when not specified) from peers
+// when shard is not known locally, and wait until shard's sync with peers completes or timeout, so that
+// a node can issue an anchor for an existing remote shard without a prior sync of the shard. A shard that
+// is new across network leaves the wait by timeout, after which anchor is issued over shard's genesis as usual
+func (d *dlt) fetchShardTips(shardId []byte, timeout time.Duration) {
+	d.lock.Lock()
+	if len(shardId) == 0 && d.app != nil {
+		shardId = d.app.ShardId
+	}
+	if d.registered(shardId) == nil || d.paused[string(shardId)] || d.shardKnown(shardId) {
+		d.lock.Unlock()
+		return
+	}
+	msg := NewShardTipsRequestMsg(shardId)
+	d.logger.Debug("Requesting tips of unknown shard from peers: %x", shardId)
+	d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+	d.lock.Unlock()
+
+	deadline := time.Now().Add(timeout)
+	for {
+		d.lock.Lock()
+		known := d.shardKnown(shardId)
+		d.lock.Unlock()
+		if known && !d.syncs.syncing(shardId) {
+			return
+		}
+		if !time.Now().Before(deadline) {
+			d.logger.Debug("Timed out waiting for tips of shard from peers: %x", shardId)
+			return
+		}
+		wait := WaitPollInterval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		time.Sleep(wait)
+	}
+}
+
+// respond to a shard tips request with shard's sync message, so that peer syncs the shard from this node
+func (d *dlt) handleRECV_ShardTipsRequestMsg(peer p2p.Peer, msg *ShardTipsRequestMsg) error {
+	// only answer for a shard known beyond its genesis, there is nothing to sync otherwise
+	if !d.isStored(msg.ShardId) || !d.shardKnown(msg.ShardId) {
+		peer.Logger().Debug("No tips to share for shard: %x", msg.ShardId)
+		return nil
+	}
+	// lock shard
+	if err := d.sharder.LockState(); err != nil {
+		d.logger.Error("handleRECV_ShardTipsRequestMsg: failed to get world state lock: %s", err)
+		return err
+	}
+	defer d.sharder.UnlockState()
+	anchor := d.sharder.SyncAnchor(msg.ShardId)
+	if anchor == nil {
+		return nil
+	}
+	if err := d.p2p.Anchor(anchor); err != nil {
+		return err
+	}
+	// reset the seen set at peer, so that a sync message sent earlier (e.g. in handshake) is sent again
+	peer.ResetSeen()
+	sync := NewShardSyncMsg(msg.ShardId, anchor)
+	peer.Logger().Debug("Responding to shard tips request with sync message for shard: %x", msg.ShardId)
+	return peer.Send(sync.Id(), sync.Code(), sync)
+}
@@ -0,0 +1,121 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+	"time"
+)
+
+// anchor for a shard not known locally should request shard's tips from peers, and fall back to local anchor on timeout
+func TestAnchor_RemoteFetchTimeout(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	stack.policies.RemoteAnchorTimeout = 50 * time.Millisecond
+
+	start := time.Now()
+	a := stack.Anchor([]byte("test submitter"), 0x01, dto.RandomHash())
+	if a == nil {
+		t.Errorf("Failed to get anchor")
+	} else if a.ShardSeq != 1 {
+		t.Errorf("incorrect shard seq of anchor: %d", a.ShardSeq)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Errorf("did not wait for tips from peers")
+	}
+	if !p2pLayer.DidBroadcast || p2pLayer.BroadcastCode != ShardTipsRequestMsgCode {
+		t.Errorf("did not broadcast shard tips request")
+	} else if msg := p2pLayer.BroadcastMsg.(*ShardTipsRequestMsg); string(msg.ShardId) != string(stack.app.ShardId) {
+		t.Errorf("incorrect shard in tips request: %x", msg.ShardId)
+	}
+}
+
+// anchor for a shard not known locally should be issued over tips fetched from peers
+func TestAnchor_RemoteFetchSynced(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.policies.RemoteAnchorTimeout = 5 * time.Second
+
+	// shard's transaction arrives while waiting for tips (as a sync with peer would do)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		stack.Submit(dto.TestSubmitter().NewRequest("remote tx"))
+	}()
+
+	start := time.Now()
+	a := stack.Anchor([]byte("test submitter"), 0x01, dto.RandomHash())
+	if a == nil {
+		t.Errorf("Failed to get anchor")
+	} else if a.ShardSeq != 2 {
+		t.Errorf("anchor not issued over fetched tips, shard seq: %d", a.ShardSeq)
+	}
+	if time.Since(start) >= 5*time.Second {
+		t.Errorf("did not stop waiting after shard was synced")
+	}
+}
+
+// anchor for a shard known locally should not request tips from peers
+func TestAnchor_RemoteFetchKnownShard(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	stack.policies.RemoteAnchorTimeout = 5 * time.Second
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("tx1")); err != nil {
+		t.Fatalf("Failed to submit transaction: %s", err)
+	}
+	p2pLayer.Reset()
+
+	if a := stack.Anchor([]byte("test submitter"), 0x02, dto.RandomHash()); a == nil {
+		t.Errorf("Failed to get anchor")
+	}
+	if p2pLayer.DidBroadcast {
+		t.Errorf("should not request tips for a known shard")
+	}
+}
+
+func TestPeerListnerGeneratesEventForShardTipsRequestMsg(t *testing.T) {
+	stack, _, _, _ := initMocks()
+
+	mockConn := p2p.TestConn()
+	peer := NewMockPeer(mockConn)
+	mockConn.NextMsg(ShardTipsRequestMsgCode, NewShardTipsRequestMsg([]byte("shard")))
+	mockConn.NextMsg(NodeShutdownMsgCode, &NodeShutdown{})
+
+	events := make(chan controllerEvent, 10)
+	finished := checkForEventCode(RECV_ShardTipsRequestMsg, events)
+	if err := stack.listener(peer, events); err != nil {
+		t.Errorf("Transaction processing has errors: %s", err)
+	}
+	if result := <-finished; !result.seenMsgEvent {
+		t.Errorf("Event listener did not generate RECV_ShardTipsRequestMsg event!!!")
+	}
+}
+
+// a node with shard's history should respond to tips request with shard's sync message
+func TestRECV_ShardTipsRequestMsg_KnownShard(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx1, _ := stack.Submit(dto.TestSubmitter().NewRequest("tx1"))
+
+	peer := NewMockPeer(p2p.TestConn())
+	if err := stack.handleRECV_ShardTipsRequestMsg(peer, NewShardTipsRequestMsg(stack.app.ShardId)); err != nil {
+		t.Errorf("failed to handle tips request: %s", err)
+	}
+	if !peer.SendCalled || peer.SendMsgCode != ShardSyncMsgCode {
+		t.Errorf("did not respond with shard sync message")
+	} else if msg := peer.SendMsg.(*ShardSyncMsg); msg.Anchor.ShardParent != tx1.Id() {
+		t.Errorf("incorrect parent in sync anchor: %x", msg.Anchor.ShardParent)
+	}
+}
+
+// a node without shard's history should not respond to tips request
+func TestRECV_ShardTipsRequestMsg_UnknownShard(t *testing.T) {
+	stack, _, _, _ := initMocks()
+
+	peer := NewMockPeer(p2p.TestConn())
+	if err := stack.handleRECV_ShardTipsRequestMsg(peer, NewShardTipsRequestMsg([]byte("unknown shard"))); err != nil {
+		t.Errorf("failed to handle tips request: %s", err)
+	}
+	if peer.SendCalled {
+		t.Errorf("should not respond for unknown shard")
+	}
+	if len(stack.db.ShardTips([]byte("unknown shard"))) != 0 {
+		t.Errorf("should not create genesis for unknown shard")
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2019 The trust-net Authors
+// Replay of captured peer messages through the controller, for offline reproduction of gossip ordering issues
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"os"
+	"sync"
+)
+
+// replay messages captured by a node (p2p.Config.CaptureFile) through the controller, in the order they were
+// captured, with each captured peer replayed as a connected peer, meant for a stack with a fresh repo (and
+// same apps registered as the capturing node), messages sent by stack to replayed peers are discarded,
+// returns once all replayed messages are processed
+func (d *dlt) Replay(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	records, err := p2p.ReadCapture(file)
+	if err != nil {
+		return err
+	}
+	peers := make(map[string]*p2p.ReplayPeer)
+	wg := sync.WaitGroup{}
+	defer func() {
+		for _, peer := range peers {
+			peer.Close()
+		}
+		wg.Wait()
+	}()
+	for i := range records {
+		peer, found := peers[records[i].PeerId]
+		if !found {
+			if peer, err = p2p.NewReplayPeer(records[i].PeerId); err != nil {
+				return err
+			}
+			peers[records[i].PeerId] = peer
+			wg.Add(1)
+			go func(peer p2p.Peer) {
+				defer wg.Done()
+				d.replay(peer)
+			}(peer)
+		}
+		// messages of a peer disconnected during replay (e.g. for a bad transaction) are skipped
+		peer.Feed(&records[i])
+	}
+	return nil
+}
+
+// process messages of a replayed peer, until peer is closed
+func (d *dlt) replay(peer p2p.Peer) {
+	peer.SetLogger(log.NewLogger(d.conf.Name + " | " + peer.String()))
+	events := make(chan controllerEvent, 100*12)
+	done := make(chan struct{})
+	go func() {
+		d.peerEventsListener(peer, events)
+		close(done)
+	}()
+	if err := d.listener(peer, events); err != nil {
+		peer.Logger().Debug("Replay listener terminated: %s", err)
+	}
+	// stop reading more messages, and wait for events of messages read so far to be processed
+	peer.Disconnect()
+	events <- newControllerEvent(SHUTDOWN, nil)
+	<-done
+	d.endSync(peer)
+	d.peerVersions.remove(peer.ID())
+	d.peerSubscriptions.remove(peer.ID())
+	d.syncPeers.remove(peer.String())
+}
@@ -0,0 +1,59 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// write a capture of messages, each from a distinct peer
+func writeCapture(t *testing.T, path string, codes []uint64, msgs []interface{}) {
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create capture: %s", err)
+	}
+	defer file.Close()
+	enc := json.NewEncoder(file)
+	for i, msg := range msgs {
+		payload, _ := rlp.EncodeToBytes(msg)
+		peerId := [64]byte{byte(i + 1)}
+		enc.Encode(&p2p.CaptureRecord{Time: int64(i), PeerId: hex.EncodeToString(peerId[:]), Code: codes[i], Payload: payload})
+	}
+}
+
+// replayed transactions should be processed by controller as if received from peers
+func TestReplay(t *testing.T) {
+	stack, _, endorser, _ := initMocks()
+	dir, _ := ioutil.TempDir("", "replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.json")
+	tx := TestSignedTransaction("test payload")
+	writeCapture(t, path, []uint64{TransactionMsgCode, NodeShutdownMsgCode}, []interface{}{tx, &NodeShutdown{}})
+	if err := stack.Replay(path); err != nil {
+		t.Fatalf("failed to replay capture: %s", err)
+	}
+	if !stack.isSeen(tx.Id()) || !endorser.TxHandlerCalled {
+		t.Errorf("replayed transaction not processed")
+	}
+}
+
+// a malformed capture should fail replay
+func TestReplay_BadCapture(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	dir, _ := ioutil.TempDir("", "replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "capture.json")
+	ioutil.WriteFile(path, []byte("not a capture"), 0644)
+	if err := stack.Replay(path); err == nil {
+		t.Errorf("expected malformed capture to fail replay")
+	}
+	if err := stack.Replay(filepath.Join(dir, "missing.json")); err == nil {
+		t.Errorf("expected missing capture to fail replay")
+	}
+}
@@ -0,0 +1,461 @@
+// Copyright 2019 The trust-net Authors
+// Write batch of DLT DB mutations, committed or discarded together
+package repo
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sort"
+	"strings"
+)
+
+// a write batch of DLT DB mutations, buffered (and visible to reads through the batch) until the batch is
+// committed or discarded, so that related updates are applied together
+type Batch interface {
+	DltDb
+	// apply all mutations of the batch together (into parent batch, for a batch begun from a batch)
+	Commit() error
+	// drop all mutations of the batch
+	Discard()
+	// provider of DBs whose writes are buffered in the batch, so that updates of other stores (e.g. world
+	// state) are applied along with the batch's DLT DB mutations
+	Provider(dbp db.DbProvider) db.DbProvider
+}
+
+// a pending write of a record, either a new value or a delete
+type pendingWrite struct {
+	value   []byte
+	deleted bool
+}
+
+// pending writes of a DB in a batch, in order of first write to each key
+type pendingWrites struct {
+	keys   []string
+	writes map[string]*pendingWrite
+}
+
+// mutations buffered in a batch, for each of the DBs written
+type batch struct {
+	// batch that mutations are committed into, nil when committed to DBs
+	parent *batch
+	dbs    []db.Database
+	writes map[db.Database]*pendingWrites
+	// whether batch was already committed or discarded
+	closed bool
+}
+
+func newBatch(parent *batch) *batch {
+	return &batch{
+		parent: parent,
+		writes: make(map[db.Database]*pendingWrites),
+	}
+}
+
+// pending write of a key in batch, or in its parents
+func (b *batch) pending(database db.Database, key []byte) *pendingWrite {
+	for ; b != nil; b = b.parent {
+		if writes, found := b.writes[database]; found {
+			if w, found := writes.writes[string(key)]; found {
+				return w
+			}
+		}
+	}
+	return nil
+}
+
+func (b *batch) record(database db.Database, key []byte, w *pendingWrite) {
+	writes, found := b.writes[database]
+	if !found {
+		writes = &pendingWrites{writes: make(map[string]*pendingWrite)}
+		b.writes[database] = writes
+		b.dbs = append(b.dbs, database)
+	}
+	if _, found := writes.writes[string(key)]; !found {
+		writes.keys = append(writes.keys, string(key))
+	}
+	writes.writes[string(key)] = w
+}
+
+// move all pending writes of a committed batch into its parent
+func (b *batch) merge(child *batch) {
+	for _, database := range child.dbs {
+		writes := child.writes[database]
+		for _, key := range writes.keys {
+			b.record(database, []byte(key), writes.writes[key])
+		}
+	}
+}
+
+// records of a DB with keys starting with prefix, overlaid with pending writes of batch and its parents
+func (b *batch) overlay(database db.Database, prefix []byte) *batchIterator {
+	records := make(map[string][]byte)
+	iter := database.Iterator(prefix)
+	for iter.Next() {
+		records[string(iter.Key())] = append([]byte{}, iter.Value()...)
+	}
+	iter.Release()
+	// apply writes of outermost batch first, so that writes of inner batches take precedence
+	chain := []*batch{}
+	for ; b != nil; b = b.parent {
+		chain = append([]*batch{b}, chain...)
+	}
+	for _, b := range chain {
+		if writes, found := b.writes[database]; found {
+			for _, key := range writes.keys {
+				if !strings.HasPrefix(key, string(prefix)) {
+					continue
+				} else if w := writes.writes[key]; w.deleted {
+					delete(records, key)
+				} else {
+					records[key] = w.value
+				}
+			}
+		}
+	}
+	it := &batchIterator{}
+	for key := range records {
+		it.keys = append(it.keys, key)
+	}
+	sort.Strings(it.keys)
+	for _, key := range it.keys {
+		it.values = append(it.values, records[key])
+	}
+	return it
+}
+
+// iterator over records of a DB overlaid with pending writes, in order of keys
+type batchIterator struct {
+	keys   []string
+	values [][]byte
+	pos    int
+}
+
+func (it *batchIterator) Next() bool {
+	if it.pos >= len(it.keys) {
+		return false
+	}
+	it.pos += 1
+	return true
+}
+
+func (it *batchIterator) Key() []byte {
+	return []byte(it.keys[it.pos-1])
+}
+
+func (it *batchIterator) Value() []byte {
+	return it.values[it.pos-1]
+}
+
+func (it *batchIterator) Release() {}
+
+// a pending write recorded in journal, with namespace of its DB
+type journalWrite struct {
+	Namespace string
+	Key       []byte
+	Value     []byte
+	Deleted   bool
+}
+
+// key of journal record of the batch being applied (batches are applied one at a time)
+var journalKey = []byte("pending")
+
+func journalDb(dbp db.DbProvider) db.Database {
+	return dbp.DB("dlt_journal")
+}
+
+// apply pending writes of a batch with a single write to each DB, recording them in journal first when more
+// than one DB is written, so that writes interrupted part way are completed when DLT DB is opened again
+// (called with lock held)
+func (d *dltDb) apply(b *batch) error {
+	if len(b.dbs) == 0 {
+		return nil
+	}
+	journaled := len(b.dbs) > 1
+	if journaled {
+		journal := []journalWrite{}
+		for _, database := range b.dbs {
+			writes := b.writes[database]
+			for _, key := range writes.keys {
+				w := writes.writes[key]
+				journal = append(journal, journalWrite{Namespace: database.Name(), Key: []byte(key), Value: w.value, Deleted: w.deleted})
+			}
+		}
+		if data, err := common.Serialize(journal); err != nil {
+			return err
+		} else if err := d.journalDb.Put(journalKey, data); err != nil {
+			return err
+		}
+	}
+	for _, database := range b.dbs {
+		writes, dbBatch := b.writes[database], database.NewBatch()
+		for _, key := range writes.keys {
+			if w := writes.writes[key]; w.deleted {
+				dbBatch.Delete([]byte(key))
+			} else {
+				dbBatch.Put([]byte(key), w.value)
+			}
+		}
+		if err := dbBatch.Write(); err != nil {
+			// journal is kept, so that remaining writes are completed when DLT DB is opened again
+			return err
+		}
+	}
+	if journaled {
+		return d.journalDb.Delete(journalKey)
+	}
+	return nil
+}
+
+// complete writes of a batch interrupted part way, recorded in journal, to the specified DBs (e.g. DBs wrapped
+// with bloom filters) or else to DBs of the namespaces from provider
+func replayJournal(dbp db.DbProvider, dbs ...db.Database) error {
+	data, err := journalDb(dbp).Get(journalKey)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	journal := []journalWrite{}
+	if err := common.Deserialize(data, &journal); err != nil {
+		return err
+	}
+	batches := make(map[string]db.Batch)
+	namespaces := []string{}
+	for _, w := range journal {
+		dbBatch, found := batches[w.Namespace]
+		if !found {
+			database := dbp.DB(w.Namespace)
+			for _, known := range dbs {
+				if known.Name() == w.Namespace {
+					database = known
+				}
+			}
+			dbBatch = database.NewBatch()
+			batches[w.Namespace] = dbBatch
+			namespaces = append(namespaces, w.Namespace)
+		}
+		if w.Deleted {
+			dbBatch.Delete(w.Key)
+		} else {
+			dbBatch.Put(w.Key, w.Value)
+		}
+	}
+	for _, namespace := range namespaces {
+		if err := batches[namespace].Write(); err != nil {
+			return err
+		}
+	}
+	return journalDb(dbp).Delete(journalKey)
+}
+
+// read a record, including pending writes of the batch (called with lock held)
+func (d *dltDb) get(database db.Database, key []byte) ([]byte, error) {
+	if w := d.batch.pending(database, key); w != nil {
+		if w.deleted {
+			return nil, errors.New("not found")
+		}
+		return w.value, nil
+	}
+	return database.Get(key)
+}
+
+func (d *dltDb) has(database db.Database, key []byte) bool {
+	_, err := d.get(database, key)
+	return err == nil
+}
+
+// read all records of a DB, including pending writes of the batch
+func (d *dltDb) getAll(database db.Database) [][]byte {
+	if d.batch == nil {
+		return database.GetAll()
+	}
+	return d.batch.overlay(database, nil).values
+}
+
+// write a record, buffered in the batch if any (called with lock held)
+func (d *dltDb) put(database db.Database, key, value []byte) error {
+	if d.batch == nil {
+		return database.Put(key, value)
+	} else if d.batch.closed {
+		return errors.New("batch already closed")
+	}
+	d.batch.record(database, key, &pendingWrite{value: value})
+	return nil
+}
+
+func (d *dltDb) delete(database db.Database, key []byte) error {
+	if d.batch == nil {
+		return database.Delete(key)
+	} else if d.batch.closed {
+		return errors.New("batch already closed")
+	}
+	d.batch.record(database, key, &pendingWrite{deleted: true})
+	return nil
+}
+
+// a view of DLT DB buffering its mutations in a batch of its own, nested in the batch of the DB it's begun from
+func (d *dltDb) Begin() Batch {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	view := *d
+	view.batch = newBatch(d.batch)
+	return &view
+}
+
+func (d *dltDb) Commit() error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.batch == nil || d.batch.closed {
+		return errors.New("no open batch")
+	}
+	d.batch.closed = true
+	if d.batch.parent != nil {
+		if d.batch.parent.closed {
+			return errors.New("parent batch already closed")
+		}
+		d.batch.parent.merge(d.batch)
+		return nil
+	}
+	return d.apply(d.batch)
+}
+
+func (d *dltDb) Discard() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.batch != nil {
+		d.batch.closed = true
+	}
+}
+
+func (d *dltDb) Provider(dbp db.DbProvider) db.DbProvider {
+	return &batchProvider{dbp: dbp, view: d}
+}
+
+// provider of DBs buffering their writes in a batch
+type batchProvider struct {
+	dbp  db.DbProvider
+	view *dltDb
+}
+
+func (p *batchProvider) DB(namespace string) db.Database {
+	if database := p.dbp.DB(namespace); database != nil {
+		return &batchDatabase{Database: database, view: p.view}
+	}
+	return nil
+}
+
+// DBs are owned by underlying provider
+func (p *batchProvider) CloseAll() error {
+	return nil
+}
+
+// a DB buffering its writes in a batch, reads include pending writes of the batch
+type batchDatabase struct {
+	db.Database
+	view *dltDb
+}
+
+func (b *batchDatabase) Underlying() db.Database {
+	return b.Database
+}
+
+func (b *batchDatabase) Over(database db.Database) db.Database {
+	return &batchDatabase{Database: database, view: b.view}
+}
+
+func (b *batchDatabase) Put(key []byte, value []byte) error {
+	b.view.lock.Lock()
+	defer b.view.lock.Unlock()
+	return b.view.put(b.Database, key, value)
+}
+
+func (b *batchDatabase) Delete(key []byte) error {
+	b.view.lock.Lock()
+	defer b.view.lock.Unlock()
+	return b.view.delete(b.Database, key)
+}
+
+func (b *batchDatabase) Get(key []byte) ([]byte, error) {
+	b.view.lock.RLock()
+	defer b.view.lock.RUnlock()
+	return b.view.get(b.Database, key)
+}
+
+func (b *batchDatabase) Has(key []byte) (bool, error) {
+	b.view.lock.RLock()
+	defer b.view.lock.RUnlock()
+	return b.view.has(b.Database, key), nil
+}
+
+func (b *batchDatabase) GetAll() [][]byte {
+	b.view.lock.RLock()
+	defer b.view.lock.RUnlock()
+	return b.view.getAll(b.Database)
+}
+
+func (b *batchDatabase) Iterator(prefix []byte) db.Iterator {
+	b.view.lock.RLock()
+	defer b.view.lock.RUnlock()
+	return b.view.batch.overlay(b.Database, prefix)
+}
+
+func (b *batchDatabase) NewBatch() db.Batch {
+	return &batchDatabaseBatch{database: b}
+}
+
+// delete all records, as buffered deletes
+func (b *batchDatabase) Drop() error {
+	b.view.lock.Lock()
+	defer b.view.lock.Unlock()
+	iter := b.view.batch.overlay(b.Database, nil)
+	for iter.Next() {
+		if err := b.view.delete(b.Database, iter.Key()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DB is owned by underlying provider
+func (b *batchDatabase) Close() error {
+	return nil
+}
+
+// writes to a buffering DB, buffered together when written
+type batchDatabaseBatch struct {
+	database *batchDatabase
+	keys     [][]byte
+	writes   []*pendingWrite
+}
+
+func (b *batchDatabaseBatch) Put(key []byte, value []byte) {
+	b.keys = append(b.keys, key)
+	b.writes = append(b.writes, &pendingWrite{value: value})
+}
+
+func (b *batchDatabaseBatch) Delete(key []byte) {
+	b.keys = append(b.keys, key)
+	b.writes = append(b.writes, &pendingWrite{deleted: true})
+}
+
+func (b *batchDatabaseBatch) Write() error {
+	view := b.database.view
+	view.lock.Lock()
+	defer view.lock.Unlock()
+	if view.batch == nil {
+		dbBatch := b.database.Database.NewBatch()
+		for i, key := range b.keys {
+			if b.writes[i].deleted {
+				dbBatch.Delete(key)
+			} else {
+				dbBatch.Put(key, b.writes[i].value)
+			}
+		}
+		return dbBatch.Write()
+	} else if view.batch.closed {
+		return errors.New("batch already closed")
+	}
+	for i, key := range b.keys {
+		view.batch.record(b.database.Database, key, b.writes[i])
+	}
+	return nil
+}
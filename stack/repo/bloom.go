@@ -0,0 +1,41 @@
+// Copyright 2019 The trust-net Authors
+// Bloom filters over transaction and shard DAG records, so that lookups of unknown transactions (e.g. during
+// duplicate checks and orphan detection) do not read the DB
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+)
+
+// false positive rate of bloom filters over transaction IDs, 0 to disable filters
+var TxBloomFalsePositive = 0.01
+
+// key of a transaction record
+func txRecordKey(value []byte) ([]byte, error) {
+	data, err := decompressRecord(value)
+	if err != nil {
+		return nil, err
+	}
+	tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+	if err := tx.DeSerialize(data); err != nil {
+		return nil, err
+	}
+	id := tx.Id()
+	return id[:], nil
+}
+
+// key of a DAG node record
+func dagNodeKey(value []byte) ([]byte, error) {
+	node := &DagNode{}
+	if err := common.Deserialize(value, node); err != nil {
+		return nil, err
+	}
+	return node.TxId[:], nil
+}
+
+// wrap transaction and shard DAG databases with bloom filters
+func bloomDbs(txDb, shardDAGsDb db.Database) (db.Database, db.Database) {
+	return db.NewBloomDatabase(txDb, TxBloomFalsePositive, txRecordKey), db.NewBloomDatabase(shardDAGsDb, TxBloomFalsePositive, dagNodeKey)
+}
@@ -0,0 +1,43 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// filters should be populated with existing records, and lookups of unknown transactions should not read DB
+func TestBloomFilter_ExistingRecords(t *testing.T) {
+	defer func(rate float64) { TxBloomFalsePositive = rate }(TxBloomFalsePositive)
+	dbp := db.NewInMemDbProvider()
+	// records written without filters
+	TxBloomFalsePositive = 0
+	repo, _ := NewDltDb(dbp)
+	tx := dto.TestSignedTransaction("test payload")
+	repo.AddTx(tx)
+	repo.UpdateShard(tx)
+	// filters enabled on restart
+	TxBloomFalsePositive = 0.01
+	repo, _ = NewDltDb(dbp)
+	if repo.GetTx(tx.Id()) == nil || repo.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("existing records not found")
+	}
+	if repo.GetTx(dto.RandomHash()) != nil || repo.GetShardDagNode(dto.RandomHash()) != nil {
+		t.Errorf("did not expect unknown records")
+	}
+	if stats := repo.StorageStats(); stats.BloomSkipped != 2 {
+		t.Errorf("incorrect lookups skipped: %d", stats.BloomSkipped)
+	}
+	// records written after restart, including in a batch, should be found
+	tx2 := dto.TestSignedTransaction("test payload")
+	batch := repo.Begin()
+	batch.AddTx(tx2)
+	batch.Commit()
+	if repo.GetTx(tx2.Id()) == nil {
+		t.Errorf("new record not found")
+	}
+	if err := repo.AddTx(tx2); err == nil {
+		t.Errorf("expected duplicate transaction to be refused")
+	}
+}
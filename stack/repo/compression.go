@@ -0,0 +1,106 @@
+// Copyright 2019 The trust-net Authors
+// Transparent compression of transaction records, trading CPU for disk on payload heavy shards
+package repo
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"github.com/golang/snappy"
+	"io/ioutil"
+)
+
+const (
+	// transaction records are stored as is
+	CompressNone int = iota
+	// transaction records are compressed with snappy, fast with moderate ratio
+	CompressSnappy
+	// transaction records are compressed with deflate, slower with better ratio
+	CompressFlate
+)
+
+// codec to compress transaction records written by node, records are read back based on the flag
+// stored with each record, regardless of codec
+var TxCompression = CompressNone
+
+// min size (bytes) of a transaction record to compress, smaller records are stored as is
+var TxCompressMinSize = 256
+
+// flag of a compressed record, followed by codec, a gob encoded record never starts with a zero byte
+const compressedFlag = 0x00
+
+// storage statistics of transaction records written since node's start
+type StorageStats struct {
+	// codec used to compress transaction records
+	Compression int
+	// number of transaction records written compressed
+	TxCompressed uint64
+	// number of transaction records written as is (compression disabled, record too small or not compressible)
+	TxUncompressed uint64
+	// total size of compressed records before compression
+	RawBytes uint64
+	// total size of compressed records after compression
+	CompressedBytes uint64
+	// number of lookups of unknown transactions and shard DAG nodes answered by bloom filters without reading DB
+	BloomSkipped uint64
+}
+
+// ratio of size before compression to size after compression, of compressed records
+func (s *StorageStats) CompressionRatio() float64 {
+	if s.CompressedBytes == 0 {
+		return 0
+	}
+	return float64(s.RawBytes) / float64(s.CompressedBytes)
+}
+
+func validCompression(codec int) error {
+	if codec < CompressNone || codec > CompressFlate {
+		return fmt.Errorf("unknown compression codec: %d", codec)
+	}
+	return nil
+}
+
+// compress a record with codec, returns nil when record should be stored as is
+func compressRecord(codec int, data []byte) []byte {
+	if codec == CompressNone || len(data) < TxCompressMinSize {
+		return nil
+	}
+	compressed := []byte{compressedFlag, byte(codec)}
+	switch codec {
+	case CompressSnappy:
+		compressed = append(compressed, snappy.Encode(nil, data)...)
+	case CompressFlate:
+		buf := bytes.NewBuffer(compressed)
+		w, _ := flate.NewWriter(buf, flate.DefaultCompression)
+		if _, err := w.Write(data); err != nil {
+			return nil
+		} else if err := w.Close(); err != nil {
+			return nil
+		}
+		compressed = buf.Bytes()
+	default:
+		return nil
+	}
+	// not worth storing a record that did not compress
+	if len(compressed) >= len(data) {
+		return nil
+	}
+	return compressed
+}
+
+// decompress a record if it is flagged as compressed, otherwise return record as is
+func decompressRecord(data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] != compressedFlag {
+		return data, nil
+	} else if len(data) < 2 {
+		return nil, fmt.Errorf("truncated compressed record")
+	}
+	switch int(data[1]) {
+	case CompressSnappy:
+		return snappy.Decode(nil, data[2:])
+	case CompressFlate:
+		return ioutil.ReadAll(flate.NewReader(bytes.NewReader(data[2:])))
+	default:
+		return nil, fmt.Errorf("unknown compression codec of record: %d", data[1])
+	}
+}
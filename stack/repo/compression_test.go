@@ -0,0 +1,66 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"strings"
+	"testing"
+)
+
+// records should round trip through each codec, and small or incompressible records should be stored as is
+func TestCompressRecord(t *testing.T) {
+	data := []byte(strings.Repeat("compressible payload ", 100))
+	for _, codec := range []int{CompressSnappy, CompressFlate} {
+		compressed := compressRecord(codec, data)
+		if compressed == nil || len(compressed) >= len(data) || compressed[0] != compressedFlag {
+			t.Errorf("record not compressed with codec %d", codec)
+		} else if decompressed, err := decompressRecord(compressed); err != nil || !bytes.Equal(decompressed, data) {
+			t.Errorf("record did not round trip with codec %d: %s", codec, err)
+		}
+	}
+	if compressRecord(CompressNone, data) != nil || compressRecord(CompressSnappy, data[:10]) != nil {
+		t.Errorf("did not expect record to be compressed")
+	}
+	random := make([]byte, 0, 1024)
+	for len(random) < 1024 {
+		hash := dto.RandomHash()
+		random = append(random, hash[:]...)
+	}
+	if compressRecord(CompressSnappy, random) != nil {
+		t.Errorf("did not expect incompressible record to be compressed")
+	}
+	if decompressed, err := decompressRecord(data); err != nil || !bytes.Equal(decompressed, data) {
+		t.Errorf("uncompressed record not read as is: %s", err)
+	}
+	if _, err := decompressRecord([]byte{compressedFlag, 0xff, 0x01}); err == nil {
+		t.Errorf("expected record of unknown codec to fail")
+	}
+}
+
+// transactions should be stored compressed when enabled, with existing records still readable
+func TestAddTx_Compression(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	if err := repo.SetCompression(CompressFlate + 1); err == nil {
+		t.Errorf("expected unknown codec to be refused")
+	}
+	plain := dto.TestSignedTransaction(strings.Repeat("payload ", 100))
+	repo.AddTx(plain)
+	repo.SetCompression(CompressSnappy)
+	compressed := dto.TestSignedTransaction(strings.Repeat("payload ", 100))
+	repo.AddTx(compressed)
+	for _, tx := range []dto.Transaction{plain, compressed} {
+		if got := repo.GetTx(tx.Id()); got == nil || got.Id() != tx.Id() {
+			t.Errorf("transaction not read back: %x", tx.Id())
+		}
+	}
+	id := compressed.Id()
+	if data, _ := repo.txDb.Get(id[:]); len(data) == 0 || data[0] != compressedFlag {
+		t.Errorf("transaction not stored compressed")
+	}
+	stats := repo.StorageStats()
+	if stats.Compression != CompressSnappy || stats.TxCompressed != 1 || stats.TxUncompressed != 1 || stats.CompressionRatio() <= 1 {
+		t.Errorf("incorrect storage stats: %+v", stats)
+	}
+}
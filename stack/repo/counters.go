@@ -0,0 +1,70 @@
+// Copyright 2019 The trust-net Authors
+// Cumulative counters persisted in DLT DB, so that long-term statistics survive restarts
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sync"
+)
+
+// persisted record of a counter
+type counterRecord struct {
+	Name  []byte
+	Value uint64
+}
+
+// cumulative counters, loaded from DB when opened and written through on each update
+type Counters struct {
+	db     db.Database
+	values map[string]uint64
+	lock   sync.RWMutex
+}
+
+// open counters persisted in a DB provider
+func NewCounters(dbp db.DbProvider) (*Counters, error) {
+	c := &Counters{
+		db:     dbp.DB("dlt_counters"),
+		values: make(map[string]uint64),
+	}
+	for _, data := range c.db.GetAll() {
+		record := &counterRecord{}
+		if err := common.Deserialize(data, record); err != nil {
+			return nil, err
+		}
+		c.values[string(record.Name)] = record.Value
+	}
+	return c, nil
+}
+
+// add to a counter's value, and persist the updated value
+func (c *Counters) Add(name []byte, delta uint64) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	value := c.values[string(name)] + delta
+	if data, err := common.Serialize(&counterRecord{Name: name, Value: value}); err != nil {
+		return err
+	} else if err := c.db.Put(name, data); err != nil {
+		return err
+	}
+	c.values[string(name)] = value
+	return nil
+}
+
+// get a counter's value, 0 for a counter never updated
+func (c *Counters) Get(name []byte) uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.values[string(name)]
+}
+
+// get values of all counters, keyed by counter name
+func (c *Counters) All() map[string]uint64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	all := make(map[string]uint64, len(c.values))
+	for name, value := range c.values {
+		all[name] = value
+	}
+	return all
+}
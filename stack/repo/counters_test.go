@@ -0,0 +1,39 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"testing"
+)
+
+// counters should be updated and read back
+func TestCounters_Add(t *testing.T) {
+	c, err := NewCounters(db.NewInMemDbProvider())
+	if err != nil {
+		t.Fatalf("failed to open counters: %s", err)
+	}
+	if c.Get([]byte("counter")) != 0 {
+		t.Errorf("new counter should be 0")
+	}
+	c.Add([]byte("counter"), 2)
+	c.Add([]byte("counter"), 3)
+	c.Add([]byte("other"), 1)
+	if c.Get([]byte("counter")) != 5 || c.Get([]byte("other")) != 1 {
+		t.Errorf("incorrect counter values: %v", c.All())
+	}
+	if len(c.All()) != 2 {
+		t.Errorf("incorrect number of counters: %v", c.All())
+	}
+}
+
+// counters should survive re-opening of DB
+func TestCounters_Persist(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	c, _ := NewCounters(dbp)
+	c.Add([]byte("counter"), 7)
+	if c, err := NewCounters(dbp); err != nil {
+		t.Errorf("failed to re-open counters: %s", err)
+	} else if c.Get([]byte("counter")) != 7 {
+		t.Errorf("counter not persisted: %d", c.Get([]byte("counter")))
+	}
+}
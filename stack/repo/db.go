@@ -3,11 +3,13 @@
 package repo
 
 import (
+	"crypto/sha512"
 	"errors"
 	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/stack/dto"
-//	"sync"
+	"sort"
+	"sync"
 )
 
 type DagNode struct {
@@ -36,6 +38,65 @@ type SubmitterHistory struct {
 	ShardTxPairs []ShardTxPair
 }
 
+// audit record for an anchor issued to a submitter
+type AnchorRecord struct {
+	// Submitter ID
+	Submitter []byte
+	// Submitter Seq the anchor was requested for
+	Seq uint64
+	// submitter's last transaction provided with the anchor request
+	LastTx [64]byte
+	// shard the anchor was issued for
+	ShardId []byte
+	// shard DAG parent assigned to the anchor
+	ShardParent [64]byte
+	// shard sequence assigned to the anchor
+	ShardSeq uint64
+	// signature of the issued anchor (used to correlate with transaction)
+	Signature []byte
+	// time of issue (unix nano)
+	IssuedAt int64
+	// whether anchor was later consumed by an accepted transaction
+	Consumed bool
+	// transaction that consumed the anchor
+	TxId [64]byte
+}
+
+// forensic record of a double spend detected between a local and a remote transaction
+type ForensicRecord struct {
+	// Submitter ID
+	Submitter []byte
+	// Submitter Seq of the conflicting transactions
+	Seq uint64
+	// shard of the conflicting transactions
+	ShardId []byte
+	// local transaction's request and anchor
+	LocalRequest *dto.TxRequest
+	LocalAnchor  *dto.Anchor
+	// remote transaction's request and anchor
+	RemoteRequest *dto.TxRequest
+	RemoteAnchor  *dto.Anchor
+	// ID and address of the peer that sent the remote transaction
+	PeerId   []byte
+	PeerAddr string
+	// winning transaction of the resolution
+	Winner [64]byte
+	// resolution decision taken by the node
+	Resolution string
+	// time of detection (unix nano)
+	DetectedAt int64
+}
+
+// ID of the record, same for a conflicting pair irrespective of which transaction is local
+func (r *ForensicRecord) Id() [64]byte {
+	local := dto.NewTransaction(r.LocalRequest, r.LocalAnchor).Id()
+	remote := dto.NewTransaction(r.RemoteRequest, r.RemoteAnchor).Id()
+	if string(local[:]) > string(remote[:]) {
+		local, remote = remote, local
+	}
+	return sha512.Sum512(append(local[:], remote[:]...))
+}
+
 type DltDb interface {
 	// get a transaction from transaction history (no entry == nil)
 	GetTx(id [64]byte) dto.Transaction
@@ -45,24 +106,73 @@ type DltDb interface {
 	UpdateShard(tx dto.Transaction) error
 	// flush a shard DAG
 	FlushShard(shardId []byte) error
+	// remove a shard's DAG along with its transactions from transaction history, and the shard's transactions
+	// from their submitters' history and DAG, all together (i.e. none are removed if any removal fails)
+	ResetShard(shardId []byte) error
+	// remove a sub-DAG (a transaction and all of its descendants) from shard's DAG, making parents (and merged
+	// uncles) left without children the shard's tips again, transactions are kept in transaction history
+	PruneShard(shardId []byte, ids [][64]byte) error
+	// seed an empty shard's DAG with tip transactions restored from a snapshot, linked as children
+	// of shard's genesis (transactions must be in history) and made the tips of the shard
+	SeedShard(genesis dto.Transaction, tips []dto.Transaction) error
 	// update a submitter's DAG and tips for a new transaction
 	UpdateSubmitter(tx dto.Transaction) error
 	// replace a submitter's DAG and tips for a new transaction
 	ReplaceSubmitter(tx dto.Transaction) error
+	// strip payload of a transaction in transaction history, keeping its ID, signatures and anchor, returns
+	// false if transaction is unknown, pinned or its payload was already stripped
+	PrunePayload(id [64]byte) (bool, error)
+	// pin a transaction, exempting it from pruning (replaces an existing pin of the transaction)
+	PinTx(pin *Pin) error
+	// remove a transaction's pin
+	UnpinTx(id [64]byte) error
+	// get pin of a transaction (nil if not pinned)
+	GetPin(id [64]byte) *Pin
+	// get all pinned transactions, in order of pinning
+	GetPins() []Pin
 	// delete an existing transaction from transaction history (deleting a non-tip transaction will cause errors)
 	DeleteTx(id [64]byte) error
+	// set codec to compress transaction records written from now on (existing records are read as stored)
+	SetCompression(codec int) error
+	// get storage statistics of transaction records written since node's start
+	StorageStats() *StorageStats
+	// get number of records in each of the databases, keyed by database name
+	DbSizes() map[string]uint64
 	// get the shard's DAG node for given transaction Id (no entry == nil)
 	GetShardDagNode(id [64]byte) *DagNode
 	// get the submitter's history for specified submitter id and seq
 	GetSubmitterHistory(id []byte, seq uint64) *SubmitterHistory
-	// get list of shards seen so far based on transaction history
-	GetShards() []byte
+	// get list of shards seen so far based on transaction history, in order of shard id
+	GetShards() [][]byte
+	// get registry metadata of a shard seen in transaction history (no entry == nil)
+	GetShardInfo(shardId []byte) *ShardInfo
 	// get list of submitters seen so far based on transaction history
 	GetSubmitters() []byte
 	// get tip DAG nodes for sharder's DAG
 	ShardTips(shardId []byte) [][64]byte
 	// get tip DAG nodes for submmiter's DAG
 	SubmitterTips(submitterId []byte) []DagNode
+	// get the submitter's DAG node for given transaction Id (no entry == nil)
+	GetSubmitterDagNode(id [64]byte) *DagNode
+	// get submitter DAG nodes from given transaction Id up to submitter's first transaction, across shards
+	SubmitterAncestry(id [64]byte) []DagNode
+	// get submitter DAG nodes extended by more than one transaction on same shard, in order of submitter seq
+	SubmitterForks(submitterId []byte) []DagNode
+	// save an audit record for an issued anchor
+	AddAnchorRecord(r *AnchorRecord) error
+	// update an existing audit record of an issued anchor (matched by signature)
+	UpdateAnchorRecord(r *AnchorRecord) error
+	// get audit records of anchors issued for specified submitter id and seq
+	GetAnchorRecords(id []byte, seq uint64) []AnchorRecord
+	// get highest submitter seq for which an anchor was issued
+	GetAnchorMaxSeq(id []byte) uint64
+	// save a double spend forensic record (an existing record of same conflict is not overwritten)
+	AddForensicRecord(r *ForensicRecord) error
+	// get all double spend forensic records, in order of detection
+	GetForensicRecords() []ForensicRecord
+	// start a write batch of caller's own, mutations through the batch are buffered (and visible to reads
+	// through the batch) until the batch is committed or discarded, so that related updates are applied together
+	Begin() Batch
 }
 
 type dltDb struct {
@@ -70,14 +180,34 @@ type dltDb struct {
 	shardDAGsDb        db.Database
 	shardTipsDb        db.Database
 	submitterHistoryDb db.Database
-//	lock               sync.RWMutex
+	submitterDAGsDb    db.Database
+	submitterTipsDb    db.Database
+	anchorAuditDb      db.Database
+	forensicsDb        db.Database
+	shardsDb           db.Database
+	pinsDb             db.Database
+	// journal of batch writes to more than one DB
+	journalDb db.Database
+	// batch of a view begun from DLT DB, nil when writes go directly to DBs
+	batch *batch
+	// codec to compress transaction records, and statistics of records written
+	compression  int
+	storageStats *StorageStats
+	// lock shared by DLT DB and its batch views
+	lock *sync.RWMutex
 }
 
 func (d *dltDb) GetTx(id [64]byte) dto.Transaction {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getTx(id)
+}
+
+func (d *dltDb) getTx(id [64]byte) dto.Transaction {
 	// get serialized transactions from DB
-	if data, err := d.txDb.Get(id[:]); err != nil {
+	if data, err := d.get(d.txDb, id[:]); err != nil {
+		return nil
+	} else if data, err = decompressRecord(data); err != nil {
 		return nil
 	} else {
 		// deserialize the transaction read from DB
@@ -88,6 +218,7 @@ func (d *dltDb) GetTx(id [64]byte) dto.Transaction {
 		return tx
 	}
 }
+
 func (d *dltDb) AddTx(tx dto.Transaction) error {
 	// save transaction
 	var data []byte
@@ -95,30 +226,80 @@ func (d *dltDb) AddTx(tx dto.Transaction) error {
 	if data, err = tx.Serialize(); err != nil {
 		return err
 	}
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	// check for duplicate transaction
 	id := tx.Id()
-	if present, _ := d.txDb.Has(id[:]); present {
+	if d.has(d.txDb, id[:]) {
 		return errors.New("duplicate transaction")
 	}
 
-	// save the transaction in DB
-	if err = d.txDb.Put(id[:], data); err != nil {
+	// save the transaction in DB, compressed if enabled
+	if compressed := compressRecord(d.compression, data); compressed != nil {
+		if err = d.put(d.txDb, id[:], compressed); err != nil {
+			return err
+		}
+		d.storageStats.TxCompressed += 1
+		d.storageStats.RawBytes += uint64(len(data))
+		d.storageStats.CompressedBytes += uint64(len(compressed))
+	} else {
+		if err = d.put(d.txDb, id[:], data); err != nil {
+			return err
+		}
+		d.storageStats.TxUncompressed += 1
+	}
+	return nil
+}
+
+func (d *dltDb) SetCompression(codec int) error {
+	if err := validCompression(codec); err != nil {
 		return err
 	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.compression = codec
 	return nil
 }
 
+func (d *dltDb) StorageStats() *StorageStats {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	stats := *d.storageStats
+	stats.Compression = d.compression
+	stats.BloomSkipped = db.BloomSkipped(d.txDb) + db.BloomSkipped(d.shardDAGsDb)
+	return &stats
+}
+
+func (d *dltDb) DbSizes() map[string]uint64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	sizes := make(map[string]uint64)
+	for _, database := range []db.Database{d.txDb, d.shardDAGsDb, d.shardTipsDb, d.submitterHistoryDb,
+		d.submitterDAGsDb, d.submitterTipsDb, d.anchorAuditDb, d.forensicsDb, d.shardsDb} {
+		count := uint64(0)
+		iter := database.Iterator(nil)
+		for iter.Next() {
+			count += 1
+		}
+		iter.Release()
+		sizes[database.Name()] = count
+	}
+	return sizes
+}
+
 func (d *dltDb) FlushShard(shardId []byte) error {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	// walk through shard's tips, traverse up and remove
 	tipNodes := []*DagNode{}
 	for _, tip := range d.shardTips(shardId) {
 		tipNodes = append(tipNodes, d.getShardDagNode(tip))
 	}
-	if err := d.shardTipsDb.Delete(shardId); err != nil {
+	if err := d.delete(d.shardTipsDb, shardId); err != nil {
+		return err
+	}
+	// shard's registry entry is rebuilt as its DAG is rebuilt
+	if err := d.delete(d.shardsDb, shardId); err != nil {
 		return err
 	}
 	for len(tipNodes) > 0 {
@@ -129,7 +310,186 @@ func (d *dltDb) FlushShard(shardId []byte) error {
 			tipNodes = append(tipNodes, parent)
 		}
 		// remove current node
-		if err := d.shardDAGsDb.Delete(node.TxId[:]); err != nil {
+		if err := d.delete(d.shardDAGsDb, node.TxId[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dltDb) ResetShard(shardId []byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// buffer removals in a batch of their own, unless called through a batch
+	if d.batch == nil {
+		view := *d
+		view.batch = newBatch(nil)
+		if err := view.resetShard(shardId); err != nil {
+			return err
+		}
+		return d.apply(view.batch)
+	}
+	return d.resetShard(shardId)
+}
+
+// remove shard's DAG nodes, transactions and submitter history, walking up from shard's tips through parents
+// and uncles, since a transaction merged only as an uncle is neither a tip nor a parent (called with lock held)
+func (d *dltDb) resetShard(shardId []byte) error {
+	nodes, visited := [][64]byte{}, make(map[[64]byte]bool)
+	for _, tip := range d.shardTips(shardId) {
+		nodes = append(nodes, tip)
+	}
+	for len(nodes) > 0 {
+		id := nodes[0]
+		nodes = nodes[1:]
+		node := d.getShardDagNode(id)
+		if node == nil || visited[id] {
+			continue
+		}
+		visited[id] = true
+		nodes = append(nodes, node.Parent)
+		if tx := d.getTx(id); tx != nil {
+			nodes = append(nodes, tx.Anchor().ShardUncles...)
+			if len(tx.Request().SubmitterId) > 0 {
+				if err := d.resetSubmitterHistory(tx); err != nil {
+					return err
+				}
+			}
+		}
+		if err := d.delete(d.txDb, id[:]); err != nil {
+			return err
+		}
+		if err := d.delete(d.shardDAGsDb, id[:]); err != nil {
+			return err
+		}
+	}
+	if err := d.delete(d.shardTipsDb, shardId); err != nil {
+		return err
+	}
+	return d.delete(d.shardsDb, shardId)
+}
+
+// remove a transaction from its submitter's history and DAG (called with lock held)
+func (d *dltDb) resetSubmitterHistory(tx dto.Transaction) error {
+	req := tx.Request()
+	if history := d.getSubmitterHistory(req.SubmitterId, req.SubmitterSeq); history != nil {
+		pairs := make([]ShardTxPair, 0, len(history.ShardTxPairs))
+		for _, pair := range history.ShardTxPairs {
+			if pair.TxId != tx.Id() {
+				pairs = append(pairs, pair)
+			}
+		}
+		history.ShardTxPairs = pairs
+		key := submitterHistoryKey(req.SubmitterId, req.SubmitterSeq)
+		if len(pairs) == 0 {
+			if err := d.delete(d.submitterHistoryDb, key); err != nil {
+				return err
+			}
+		} else if data, err := common.Serialize(history); err != nil {
+			return err
+		} else if err := d.put(d.submitterHistoryDb, key, data); err != nil {
+			return err
+		}
+	}
+	return d.removeSubmitterDagNode(req.SubmitterId, tx.Id())
+}
+
+func (d *dltDb) PruneShard(shardId []byte, ids [][64]byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	pruned := make(map[[64]byte]bool)
+	for _, id := range ids {
+		pruned[id] = true
+	}
+	// parents and uncles outside of pruned sub-DAG, candidates to become tips again
+	candidates := [][64]byte{}
+	for _, id := range ids {
+		node := d.getShardDagNode(id)
+		if node == nil {
+			continue
+		}
+		if !pruned[node.Parent] {
+			if parent := d.getShardDagNode(node.Parent); parent != nil {
+				children := make([][64]byte, 0, len(parent.Children))
+				for _, child := range parent.Children {
+					if child != id {
+						children = append(children, child)
+					}
+				}
+				parent.Children = children
+				if err := d.saveShardDagNode(parent); err != nil {
+					return err
+				}
+				candidates = append(candidates, node.Parent)
+			}
+		}
+		if tx := d.getTx(id); tx != nil {
+			for _, uncle := range tx.Anchor().ShardUncles {
+				if !pruned[uncle] {
+					candidates = append(candidates, uncle)
+				}
+			}
+		}
+		if err := d.delete(d.shardDAGsDb, id[:]); err != nil {
+			return err
+		}
+	}
+	// update shard's tips
+	tips := [][64]byte{}
+	isTip := make(map[[64]byte]bool)
+	for _, tip := range d.shardTips(shardId) {
+		if !pruned[tip] && !isTip[tip] {
+			tips = append(tips, tip)
+			isTip[tip] = true
+		}
+	}
+	for _, id := range candidates {
+		if node := d.getShardDagNode(id); node != nil && len(node.Children) == 0 && !isTip[id] {
+			tips = append(tips, id)
+			isTip[id] = true
+		}
+	}
+	return d.updateShardTips(shardId, tips)
+}
+
+func (d *dltDb) SeedShard(genesis dto.Transaction, tips []dto.Transaction) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	shardId := genesis.Request().ShardId
+	if len(d.shardTips(shardId)) > 0 {
+		return errors.New("shard DAG not empty")
+	}
+	genesisId := genesis.Id()
+	if !d.has(d.txDb, genesisId[:]) {
+		return errors.New("genesis transaction not in history")
+	}
+	// parents of seeded transactions are not known locally, so they are linked from genesis for traversals of shard DAG
+	genesisNode := &DagNode{TxId: genesisId}
+	ids := make([][64]byte, 0, len(tips))
+	for _, tx := range tips {
+		txId := tx.Id()
+		if string(tx.Request().ShardId) != string(shardId) {
+			return errors.New("transaction of a different shard")
+		} else if !d.has(d.txDb, txId[:]) {
+			return errors.New("transaction not in history")
+		}
+		if err := d.saveShardDagNode(&DagNode{Parent: tx.Anchor().ShardParent, TxId: txId, Depth: tx.Anchor().ShardSeq}); err != nil {
+			return err
+		}
+		genesisNode.Children = append(genesisNode.Children, txId)
+		ids = append(ids, txId)
+	}
+	if err := d.saveShardDagNode(genesisNode); err != nil {
+		return err
+	}
+	if err := d.updateShardTips(shardId, ids); err != nil {
+		return err
+	}
+	if err := d.updateShardInfo(genesis); err != nil {
+		return err
+	}
+	for _, tx := range tips {
+		if err := d.updateShardInfo(tx); err != nil {
 			return err
 		}
 	}
@@ -139,8 +499,11 @@ func (d *dltDb) FlushShard(shardId []byte) error {
 func (d *dltDb) UpdateShard(tx dto.Transaction) error {
 	// save transaction
 	var err error
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// a transaction already in shard DAG is not counted again in shard's registry entry
+	txId := tx.Id()
+	isNew := !d.has(d.shardDAGsDb, txId[:])
 
 	// add the DAG node for the transaction to shard DAG db
 	dagNode := DagNode{
@@ -181,6 +544,12 @@ func (d *dltDb) UpdateShard(tx dto.Transaction) error {
 	if err = d.updateShardTips(tx.Request().ShardId, newTips); err != nil {
 		return err
 	}
+	// update shard's registry entry
+	if isNew {
+		if err = d.updateShardInfo(tx); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -191,15 +560,15 @@ func (d *dltDb) saveShardDagNode(node *DagNode) error {
 	if data, err = common.Serialize(node); err != nil {
 		return err
 	}
-	if err = d.shardDAGsDb.Put(node.TxId[:], data); err != nil {
+	if err = d.put(d.shardDAGsDb, node.TxId[:], data); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (d *dltDb) ReplaceSubmitter(tx dto.Transaction) error {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 
 	// lookup submitter history, if present
 	var history *SubmitterHistory
@@ -222,6 +591,12 @@ func (d *dltDb) ReplaceSubmitter(tx dto.Transaction) error {
 			// there is some tx for same shard, replace this new pair
 			history.ShardTxPairs[i] = newPair
 			found = true
+			// remove replaced transaction from submitter's DAG
+			if existingPair.TxId != newPair.TxId {
+				if err := d.removeSubmitterDagNode(history.Submitter, existingPair.TxId); err != nil {
+					return err
+				}
+			}
 		}
 	}
 
@@ -229,10 +604,14 @@ func (d *dltDb) ReplaceSubmitter(tx dto.Transaction) error {
 	if !found {
 		history.ShardTxPairs = append(history.ShardTxPairs, newPair)
 	}
+	// add the new transaction to submitter's DAG
+	if err := d.addSubmitterDagNode(tx); err != nil {
+		return err
+	}
 	// update the submitter history
 	if data, err := common.Serialize(history); err != nil {
 		return err
-	} else if err := d.submitterHistoryDb.Put(submitterHistoryKey(history.Submitter, history.Seq), data); err != nil {
+	} else if err := d.put(d.submitterHistoryDb, submitterHistoryKey(history.Submitter, history.Seq), data); err != nil {
 		return err
 	}
 
@@ -240,8 +619,8 @@ func (d *dltDb) ReplaceSubmitter(tx dto.Transaction) error {
 }
 
 func (d *dltDb) UpdateSubmitter(tx dto.Transaction) error {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 
 	// lookup submitter history, if present
 	var history *SubmitterHistory
@@ -265,18 +644,22 @@ func (d *dltDb) UpdateSubmitter(tx dto.Transaction) error {
 				return nil
 			} else {
 				// double spending error
-				return errors.New("double spending tx")
+				return dto.NewTxError(dto.ErrDoubleSpend, "double spending tx")
 			}
 		}
 	}
 
 	// add the new shard/tx pair to history
 	history.ShardTxPairs = append(history.ShardTxPairs, newPair)
+	// add the new transaction to submitter's DAG
+	if err := d.addSubmitterDagNode(tx); err != nil {
+		return err
+	}
 
 	// update the submitter history
 	if data, err := common.Serialize(history); err != nil {
 		return err
-	} else if err := d.submitterHistoryDb.Put(submitterHistoryKey(history.Submitter, history.Seq), data); err != nil {
+	} else if err := d.put(d.submitterHistoryDb, submitterHistoryKey(history.Submitter, history.Seq), data); err != nil {
 		return err
 	}
 
@@ -284,11 +667,11 @@ func (d *dltDb) UpdateSubmitter(tx dto.Transaction) error {
 }
 
 func (d *dltDb) DeleteTx(id [64]byte) error {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.Lock()
+	defer d.lock.Unlock()
 	// TBD: check that its a tip transaction, otherwise cannot delete
 
-	if err := d.txDb.Delete(id[:]); err != nil {
+	if err := d.delete(d.txDb, id[:]); err != nil {
 		return err
 	}
 
@@ -296,15 +679,36 @@ func (d *dltDb) DeleteTx(id [64]byte) error {
 	return nil
 }
 
+func (d *dltDb) PrunePayload(id [64]byte) (bool, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	tx := d.getTx(id)
+	if tx == nil || len(tx.Request().Payload) == 0 || d.getPin(id) != nil {
+		return false, nil
+	}
+	tx.Request().Payload = nil
+	data, err := tx.Serialize()
+	if err != nil {
+		return false, err
+	}
+	if compressed := compressRecord(d.compression, data); compressed != nil {
+		data = compressed
+	}
+	if err := d.put(d.txDb, id[:], data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 func (d *dltDb) GetShardDagNode(id [64]byte) *DagNode {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.RLock()
+	defer d.lock.RUnlock()
 	return d.getShardDagNode(id)
 }
 
 func (d *dltDb) getShardDagNode(id [64]byte) *DagNode {
 	// get serialized DAG node from DB
-	if data, err := d.shardDAGsDb.Get(id[:]); err != nil {
+	if data, err := d.get(d.shardDAGsDb, id[:]); err != nil {
 		return nil
 	} else {
 		// deserialize the DAG node read from DB
@@ -326,8 +730,8 @@ func submitterHistoryKey(id []byte, seq uint64) []byte {
 }
 
 func (d *dltDb) GetSubmitterHistory(id []byte, seq uint64) *SubmitterHistory {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.RLock()
+	defer d.lock.RUnlock()
 
 	// get the submitter history
 	return d.getSubmitterHistory(id, seq)
@@ -335,7 +739,7 @@ func (d *dltDb) GetSubmitterHistory(id []byte, seq uint64) *SubmitterHistory {
 
 func (d *dltDb) getSubmitterHistory(id []byte, seq uint64) *SubmitterHistory {
 	// get the submitter history
-	if data, err := d.submitterHistoryDb.Get(submitterHistoryKey(id, seq)); err != nil {
+	if data, err := d.get(d.submitterHistoryDb, submitterHistoryKey(id, seq)); err != nil {
 		return nil
 	} else {
 		history := &SubmitterHistory{}
@@ -346,23 +750,19 @@ func (d *dltDb) getSubmitterHistory(id []byte, seq uint64) *SubmitterHistory {
 	}
 }
 
-func (d *dltDb) GetShards() []byte {
-	return nil
-}
-
 func (d *dltDb) GetSubmitters() []byte {
 	return nil
 }
 
 func (d *dltDb) ShardTips(shardId []byte) [][64]byte {
-//	d.lock.Lock()
-//	defer d.lock.Unlock()
+	d.lock.RLock()
+	defer d.lock.RUnlock()
 	return d.shardTips(shardId)
 }
 
 func (d *dltDb) shardTips(shardId []byte) [][64]byte {
 	// get serialized tips from DB
-	if data, err := d.shardTipsDb.Get(shardId); err != nil {
+	if data, err := d.get(d.shardTipsDb, shardId); err != nil {
 		return nil
 	} else {
 		// deserialize the tips read from DB
@@ -381,22 +781,199 @@ func (d *dltDb) updateShardTips(shardId []byte, tips [][64]byte) error {
 	if data, err = common.Serialize(tips); err != nil {
 		return err
 	}
-	if err = d.shardTipsDb.Put(shardId, data); err != nil {
+	if err = d.put(d.shardTipsDb, shardId, data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (d *dltDb) SubmitterTips(submitterId []byte) []DagNode {
+// number of most recent sequences of a submitter for which anchor audit records are kept, 0 to keep all
+var AnchorAuditDepth = uint64(1000)
+
+// key prefixes of anchor audit records, and of highest sequence anchored for a submitter
+var (
+	anchorRecordPrefix = []byte("r")
+	anchorMaxSeqPrefix = []byte("m")
+)
+
+func anchorRecordKey(id []byte, seq uint64) []byte {
+	return append(append([]byte{}, anchorRecordPrefix...), submitterHistoryKey(id, seq)...)
+}
+
+func anchorMaxSeqKey(id []byte) []byte {
+	return append(append([]byte{}, anchorMaxSeqPrefix...), id...)
+}
+
+func (d *dltDb) AddAnchorRecord(r *AnchorRecord) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// append the record to any existing records for same submitter/seq
+	records := append(d.getAnchorRecords(r.Submitter, r.Seq), *r)
+	if err := d.saveAnchorRecords(r.Submitter, r.Seq, records); err != nil {
+		return err
+	}
+	// track the highest sequence anchored for the submitter, to walk audit trail later
+	if max := d.getAnchorMaxSeq(r.Submitter); r.Seq > max {
+		if err := d.put(d.anchorAuditDb, anchorMaxSeqKey(r.Submitter), common.Uint64ToBytes(r.Seq)); err != nil {
+			return err
+		}
+		return d.pruneAnchorRecords(r.Submitter, max, r.Seq)
+	}
 	return nil
 }
 
+// remove audit records of sequences that fell out of audit depth when submitter's highest
+// anchored sequence moved from old to new max (records before old window were already removed)
+func (d *dltDb) pruneAnchorRecords(id []byte, oldMax, newMax uint64) error {
+	if AnchorAuditDepth == 0 || newMax <= AnchorAuditDepth {
+		return nil
+	}
+	from, to := uint64(1), newMax-AnchorAuditDepth
+	if oldMax > AnchorAuditDepth {
+		from = oldMax - AnchorAuditDepth + 1
+	}
+	if to > oldMax {
+		to = oldMax
+	}
+	for seq := from; seq <= to; seq++ {
+		if err := d.delete(d.anchorAuditDb, anchorRecordKey(id, seq)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dltDb) UpdateAnchorRecord(r *AnchorRecord) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	records := d.getAnchorRecords(r.Submitter, r.Seq)
+	for i, record := range records {
+		if string(record.Signature) == string(r.Signature) {
+			records[i] = *r
+			return d.saveAnchorRecords(r.Submitter, r.Seq, records)
+		}
+	}
+	return errors.New("anchor record not found")
+}
+
+func (d *dltDb) saveAnchorRecords(id []byte, seq uint64, records []AnchorRecord) error {
+	if data, err := common.Serialize(records); err != nil {
+		return err
+	} else {
+		return d.put(d.anchorAuditDb, anchorRecordKey(id, seq), data)
+	}
+}
+
+func (d *dltDb) GetAnchorRecords(id []byte, seq uint64) []AnchorRecord {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getAnchorRecords(id, seq)
+}
+
+func (d *dltDb) getAnchorRecords(id []byte, seq uint64) []AnchorRecord {
+	records := []AnchorRecord{}
+	if data, err := d.get(d.anchorAuditDb, anchorRecordKey(id, seq)); err == nil {
+		if err := common.Deserialize(data, &records); err != nil {
+			return []AnchorRecord{}
+		}
+	}
+	return records
+}
+
+func (d *dltDb) GetAnchorMaxSeq(id []byte) uint64 {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getAnchorMaxSeq(id)
+}
+
+func (d *dltDb) getAnchorMaxSeq(id []byte) uint64 {
+	if data, err := d.get(d.anchorAuditDb, anchorMaxSeqKey(id)); err != nil {
+		return 0
+	} else {
+		return common.BytesToUint64(data)
+	}
+}
+
+// move anchor audit records to keys with a distinct prefix per record type, existing max sequence
+// records (keyed by raw submitter id) are told apart from audit records by their 8 byte value
+func migrateAnchorAudit(dbp db.DbProvider) error {
+	auditDb := dbp.DB("dlt_anchor_audit")
+	keys, values := [][]byte{}, [][]byte{}
+	iter := auditDb.Iterator(nil)
+	for iter.Next() {
+		keys = append(keys, append([]byte{}, iter.Key()...))
+		values = append(values, append([]byte{}, iter.Value()...))
+	}
+	iter.Release()
+	for i, key := range keys {
+		prefix := anchorRecordPrefix
+		if len(values[i]) == 8 {
+			prefix = anchorMaxSeqPrefix
+		}
+		if err := auditDb.Delete(key); err != nil {
+			return err
+		} else if err := auditDb.Put(append(append([]byte{}, prefix...), key...), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *dltDb) AddForensicRecord(r *ForensicRecord) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	id := r.Id()
+	if d.has(d.forensicsDb, id[:]) {
+		return nil
+	}
+	if data, err := common.Serialize(r); err != nil {
+		return err
+	} else {
+		return d.put(d.forensicsDb, id[:], data)
+	}
+}
+
+func (d *dltDb) GetForensicRecords() []ForensicRecord {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	records := []ForensicRecord{}
+	for _, data := range d.getAll(d.forensicsDb) {
+		record := ForensicRecord{}
+		if err := common.Deserialize(data, &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].DetectedAt < records[j].DetectedAt
+	})
+	return records
+}
+
 func NewDltDb(dbp db.DbProvider) (*dltDb, error) {
+	// upgrade existing data to current record formats, or refuse data from newer code
+	if err := Migrate(dbp); err != nil {
+		return nil, err
+	}
+	txDb, shardDAGsDb := bloomDbs(dbp.DB("dlt_transactions"), dbp.DB("dlt_shard_dags"))
+	// complete writes of a batch interrupted part way
+	if err := replayJournal(dbp, txDb, shardDAGsDb); err != nil {
+		return nil, err
+	}
 	return &dltDb{
-		txDb:               dbp.DB("dlt_transactions"),
-		shardDAGsDb:        dbp.DB("dlt_shard_dags"),
+		txDb:               txDb,
+		shardDAGsDb:        shardDAGsDb,
 		shardTipsDb:        dbp.DB("dlt_shard_tips"),
 		submitterHistoryDb: dbp.DB("dlt_submitter_history"),
+		submitterDAGsDb:    dbp.DB("dlt_submitter_dags"),
+		submitterTipsDb:    dbp.DB("dlt_submitter_tips"),
+		anchorAuditDb:      dbp.DB("dlt_anchor_audit"),
+		forensicsDb:        dbp.DB("dlt_forensics"),
+		shardsDb:           shardsDb(dbp),
+		pinsDb:             pinsDb(dbp),
+		journalDb:          journalDb(dbp),
+		compression:        TxCompression,
+		storageStats:       &StorageStats{},
+		lock:               &sync.RWMutex{},
 	}, nil
 }
@@ -2,9 +2,11 @@
 package repo
 
 import (
+	"fmt"
 	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sync"
 	"testing"
 )
 
@@ -141,6 +143,194 @@ func TestFlushShard(t *testing.T) {
 	}
 }
 
+// test pruning a sub-DAG from shard DAG
+func TestResetShard(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	// submitter's transactions for same seq on two different shards, and a child on first shard
+	submitter := dto.TestSubmitter()
+	tx1 := submitter.NewTransaction(dto.TestAnchor(), "test data")
+	submitter.ShardId = []byte("other shard")
+	tx2 := submitter.NewTransaction(dto.TestAnchor(), "test data")
+	tx3 := dto.TestSignedTransaction("test data")
+	tx3.Anchor().ShardParent = tx1.Id()
+	for _, tx := range []dto.Transaction{tx1, tx2, tx3} {
+		repo.AddTx(tx)
+		repo.UpdateShard(tx)
+		repo.UpdateSubmitter(tx)
+	}
+
+	if err := repo.ResetShard(tx1.Request().ShardId); err != nil {
+		t.Errorf("Failed to reset shard: %s", err)
+	}
+	for _, tx := range []dto.Transaction{tx1, tx3} {
+		if repo.GetTx(tx.Id()) != nil || repo.GetShardDagNode(tx.Id()) != nil || repo.GetSubmitterDagNode(tx.Id()) != nil {
+			t.Errorf("Did not remove transaction of reset shard")
+		}
+	}
+	if len(repo.ShardTips(tx1.Request().ShardId)) != 0 || repo.GetShardInfo(tx1.Request().ShardId) != nil {
+		t.Errorf("Did not remove tips and registry entry of reset shard")
+	}
+	if history := repo.GetSubmitterHistory(tx3.Request().SubmitterId, tx3.Request().SubmitterSeq); history != nil {
+		t.Errorf("Did not remove submitter history of reset shard's transaction")
+	}
+	// submitter's transaction on other shard should not be affected
+	history := repo.GetSubmitterHistory(tx2.Request().SubmitterId, tx2.Request().SubmitterSeq)
+	if history == nil || len(history.ShardTxPairs) != 1 || history.ShardTxPairs[0].TxId != tx2.Id() {
+		t.Errorf("Incorrect submitter history after reset: %v", history)
+	}
+	if repo.GetTx(tx2.Id()) == nil || repo.GetShardDagNode(tx2.Id()) == nil {
+		t.Errorf("Removed transaction of other shard")
+	}
+}
+
+// test that reset removes a transaction merged only as an uncle, which is neither a tip nor a parent
+func TestResetShard_Uncles(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	a := dto.TestSignedTransaction("test data")
+	b := dto.TestSignedTransaction("test data")
+	c := dto.TestSignedTransaction("test data")
+	c.Anchor().ShardParent = a.Id()
+	c.Anchor().ShardUncles = [][64]byte{b.Id()}
+	for _, tx := range []dto.Transaction{a, b, c} {
+		repo.AddTx(tx)
+		repo.UpdateShard(tx)
+		repo.UpdateSubmitter(tx)
+	}
+	if tips := repo.ShardTips(a.Request().ShardId); len(tips) != 1 || tips[0] != c.Id() {
+		t.Fatalf("Incorrect tips before reset: %d", len(tips))
+	}
+
+	if err := repo.ResetShard(a.Request().ShardId); err != nil {
+		t.Errorf("Failed to reset shard: %s", err)
+	}
+	for _, tx := range []dto.Transaction{a, b, c} {
+		if repo.GetTx(tx.Id()) != nil || repo.GetShardDagNode(tx.Id()) != nil || repo.GetSubmitterDagNode(tx.Id()) != nil {
+			t.Errorf("Did not remove transaction %x of reset shard", tx.Id())
+		}
+	}
+}
+
+func TestPruneShard(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx1 := dto.TestSignedTransaction("test data")
+	tx2 := dto.TestSignedTransaction("test data")
+	tx2.Anchor().ShardParent = tx1.Id()
+	tx3 := dto.TestSignedTransaction("test data")
+	tx3.Anchor().ShardParent = tx1.Id()
+	tx4 := dto.TestSignedTransaction("test data")
+	tx4.Anchor().ShardParent = tx2.Id()
+	tx4.Anchor().ShardUncles = [][64]byte{tx3.Id()}
+	for _, tx := range []dto.Transaction{tx1, tx2, tx3, tx4} {
+		repo.AddTx(tx)
+		if err := repo.UpdateShard(tx); err != nil {
+			t.Fatalf("Failed to update shard: %s", err)
+		}
+	}
+
+	// prune sub-DAG of 2nd transaction
+	if err := repo.PruneShard(tx1.Request().ShardId, [][64]byte{tx2.Id(), tx4.Id()}); err != nil {
+		t.Errorf("Failed to prune shard: %s", err)
+	}
+	if repo.GetShardDagNode(tx2.Id()) != nil || repo.GetShardDagNode(tx4.Id()) != nil {
+		t.Errorf("Did not remove DAG nodes of pruned transactions")
+	}
+	if node := repo.GetShardDagNode(tx1.Id()); node == nil || len(node.Children) != 1 || node.Children[0] != tx3.Id() {
+		t.Errorf("Did not remove pruned child from parent: %v", node)
+	}
+	// uncle merged by pruned transaction should be a tip again
+	if tips := repo.ShardTips(tx1.Request().ShardId); len(tips) != 1 || tips[0] != tx3.Id() {
+		t.Errorf("Incorrect tips after prune: %x", tips)
+	}
+	if repo.GetTx(tx2.Id()) == nil {
+		t.Errorf("Pruned transaction should be kept in history")
+	}
+}
+
+func TestPrunePayload(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx := dto.TestSignedTransaction("test data")
+	repo.AddTx(tx)
+	if pruned, err := repo.PrunePayload(tx.Id()); !pruned || err != nil {
+		t.Errorf("Failed to prune payload: %v, %s", pruned, err)
+	}
+	// stripped transaction should keep its ID and anchor
+	if stripped := repo.GetTx(tx.Id()); stripped == nil || len(stripped.Request().Payload) != 0 {
+		t.Errorf("Payload not stripped: %v", stripped)
+	} else if stripped.Id() != tx.Id() || stripped.Anchor().ShardSeq != tx.Anchor().ShardSeq {
+		t.Errorf("Stripped transaction does not match original")
+	}
+	if pruned, _ := repo.PrunePayload(tx.Id()); pruned {
+		t.Errorf("Payload should not be pruned twice")
+	}
+	if pruned, _ := repo.PrunePayload(dto.RandomHash()); pruned {
+		t.Errorf("Unknown transaction should not be pruned")
+	}
+}
+
+// test that a pinned transaction's payload is not pruned, until it's unpinned
+func TestPinTx(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx := dto.TestSignedTransaction("test data")
+	repo.AddTx(tx)
+	if err := repo.PinTx(&Pin{TxId: tx.Id(), Reason: "legal hold", PinnedAt: 1}); err != nil {
+		t.Fatalf("Failed to pin transaction: %s", err)
+	}
+	if pin := repo.GetPin(tx.Id()); pin == nil || pin.Reason != "legal hold" {
+		t.Errorf("Incorrect pin: %v", pin)
+	}
+	if pruned, _ := repo.PrunePayload(tx.Id()); pruned {
+		t.Errorf("Pinned transaction should not be pruned")
+	}
+	if pins := repo.GetPins(); len(pins) != 1 || pins[0].TxId != tx.Id() {
+		t.Errorf("Incorrect pins: %d", len(pins))
+	}
+	repo.UnpinTx(tx.Id())
+	if repo.GetPin(tx.Id()) != nil || len(repo.GetPins()) != 0 {
+		t.Errorf("Transaction not unpinned")
+	}
+	if pruned, _ := repo.PrunePayload(tx.Id()); !pruned {
+		t.Errorf("Unpinned transaction should be pruned")
+	}
+}
+
+// test seeding a shard's DAG with tips restored from a snapshot
+func TestSeedShard(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	genesis := dto.TestSignedTransaction("genesis")
+	genesis.Anchor().ShardSeq = 0
+	tip := dto.TestSignedTransaction("test data")
+	tip.Anchor().ShardSeq = 10
+
+	// transactions must be in history before seeding
+	if err := repo.SeedShard(genesis, []dto.Transaction{tip}); err == nil {
+		t.Errorf("did not expect seeding with unknown transactions")
+	}
+	repo.AddTx(genesis)
+	repo.AddTx(tip)
+	if err := repo.SeedShard(genesis, []dto.Transaction{tip}); err != nil {
+		t.Errorf("Failed to seed shard: %s", err)
+	}
+
+	// seeded tip should be linked from genesis, and be the only tip of the shard
+	if node := repo.GetShardDagNode(genesis.Id()); node == nil || len(node.Children) != 1 || node.Children[0] != tip.Id() {
+		t.Errorf("Did not link seeded tip from genesis: %v", node)
+	}
+	if node := repo.GetShardDagNode(tip.Id()); node == nil || node.Depth != 10 || node.Parent != tip.Anchor().ShardParent {
+		t.Errorf("Incorrect DAG node for seeded tip: %v", node)
+	}
+	if tips := repo.ShardTips(tip.Request().ShardId); len(tips) != 1 || tips[0] != tip.Id() {
+		t.Errorf("Incorrect tips for seeded shard: %x", tips)
+	}
+	if info := repo.GetShardInfo(tip.Request().ShardId); info == nil || info.LatestSeq != 10 || info.GenesisTx != genesis.Id() {
+		t.Errorf("Incorrect registry entry for seeded shard: %v", info)
+	}
+
+	// a shard with history can not be seeded
+	if err := repo.SeedShard(genesis, []dto.Transaction{tip}); err == nil {
+		t.Errorf("did not expect seeding of a shard with history")
+	}
+}
+
 // test shard DAG update during adding transaction
 func TestAddTxShardDagUpdate(t *testing.T) {
 	repo, _ := NewDltDb(db.NewInMemDbProvider())
@@ -428,3 +618,400 @@ func TestUpdateSubmitter_DoubleSpending(t *testing.T) {
 		t.Errorf("Incorrect 1st pair: %s", history.ShardTxPairs[0])
 	}
 }
+
+func TestAnchorRecords(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	submitter := []byte("test submitter")
+
+	// add records for two different sequences, with a gap
+	if err := repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 1, Signature: []byte("sig 1")}); err != nil {
+		t.Errorf("Failed to add anchor record: %s", err)
+	}
+	repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 3, Signature: []byte("sig 3")})
+	repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 1, Signature: []byte("sig 1b")})
+
+	if max := repo.GetAnchorMaxSeq(submitter); max != 3 {
+		t.Errorf("Incorrect max seq: %d", max)
+	}
+	if records := repo.GetAnchorRecords(submitter, 1); len(records) != 2 {
+		t.Errorf("Incorrect number of records: %d", len(records))
+	}
+	if records := repo.GetAnchorRecords(submitter, 2); len(records) != 0 {
+		t.Errorf("Did not expect records for sequence gap: %d", len(records))
+	}
+
+	// update a record
+	if err := repo.UpdateAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 1, Signature: []byte("sig 1b"), Consumed: true}); err != nil {
+		t.Errorf("Failed to update anchor record: %s", err)
+	}
+	if records := repo.GetAnchorRecords(submitter, 1); records[0].Consumed || !records[1].Consumed {
+		t.Errorf("Incorrect record updated")
+	}
+
+	// update of unknown record should fail
+	if err := repo.UpdateAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 2, Signature: []byte("sig 2")}); err == nil {
+		t.Errorf("Expected error for unknown anchor record")
+	}
+}
+
+// a submitter id that matches the record key of another submitter should not overwrite its records
+func TestAnchorRecords_DistinctKeys(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	submitter := []byte("test submitter")
+	other := submitterHistoryKey(submitter, 1)
+	repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 1, Signature: []byte("sig 1")})
+	repo.AddAnchorRecord(&AnchorRecord{Submitter: other, Seq: 2, Signature: []byte("sig 2")})
+	if records := repo.GetAnchorRecords(submitter, 1); len(records) != 1 || string(records[0].Signature) != "sig 1" {
+		t.Errorf("Incorrect records: %v", records)
+	}
+	if max := repo.GetAnchorMaxSeq(other); max != 2 {
+		t.Errorf("Incorrect max seq: %d", max)
+	}
+}
+
+// records of sequences older than audit depth should be pruned as submitter's sequence advances
+func TestAnchorRecords_Prune(t *testing.T) {
+	defer func(depth uint64) { AnchorAuditDepth = depth }(AnchorAuditDepth)
+	AnchorAuditDepth = 2
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	submitter := []byte("test submitter")
+	for seq := uint64(1); seq <= 4; seq++ {
+		repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: seq, Signature: []byte("sig")})
+	}
+	for seq, expected := range []int{0, 0, 1, 1} {
+		if records := repo.GetAnchorRecords(submitter, uint64(seq+1)); len(records) != expected {
+			t.Errorf("Incorrect number of records for seq %d: %d", seq+1, len(records))
+		}
+	}
+	// a jump in sequence should prune all older records
+	repo.AddAnchorRecord(&AnchorRecord{Submitter: submitter, Seq: 100, Signature: []byte("sig")})
+	if records := repo.GetAnchorRecords(submitter, 4); len(records) != 0 {
+		t.Errorf("Record not pruned after jump: %d", len(records))
+	}
+}
+
+func TestForensicRecords(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx1, tx2, tx3 := dto.TestSignedTransaction("tx 1"), dto.TestSignedTransaction("tx 2"), dto.TestSignedTransaction("tx 3")
+	record := func(local, remote dto.Transaction, at int64) *ForensicRecord {
+		return &ForensicRecord{
+			LocalRequest:  local.Request(),
+			LocalAnchor:   local.Anchor(),
+			RemoteRequest: remote.Request(),
+			RemoteAnchor:  remote.Anchor(),
+			Winner:        local.Id(),
+			DetectedAt:    at,
+		}
+	}
+	if err := repo.AddForensicRecord(record(tx1, tx2, 2)); err != nil {
+		t.Errorf("Failed to add forensic record: %s", err)
+	}
+	repo.AddForensicRecord(record(tx3, tx1, 1))
+	// same conflict detected from other side should not overwrite existing record
+	repo.AddForensicRecord(record(tx2, tx1, 3))
+
+	records := repo.GetForensicRecords()
+	if len(records) != 2 {
+		t.Errorf("Incorrect number of records: %d", len(records))
+	} else if records[0].DetectedAt != 1 || records[1].DetectedAt != 2 {
+		t.Errorf("Records not in order of detection")
+	} else if records[1].Winner != tx1.Id() || string(records[1].RemoteRequest.Payload) != "tx 2" {
+		t.Errorf("Incorrect record: %v", records[1])
+	}
+}
+
+// updates of a committed batch should be applied together, and be visible to reads through the batch before commit
+func TestBatch_Commit(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	tx := dto.TestSignedTransaction("test data")
+	batch := repo.Begin()
+	batch.AddTx(tx)
+	batch.UpdateSubmitter(tx)
+	batch.UpdateShard(tx)
+	// reads through batch should include pending updates
+	if batch.GetTx(tx.Id()) == nil || batch.GetShardDagNode(tx.Id()) == nil || len(batch.ShardTips(tx.Request().ShardId)) != 1 {
+		t.Errorf("pending updates not visible to reads")
+	}
+	// reads outside the batch, and underlying DBs should not be updated before commit
+	id := tx.Id()
+	if repo.GetTx(tx.Id()) != nil {
+		t.Errorf("pending updates visible outside the batch")
+	}
+	if present, _ := dbp.DB("dlt_transactions").Has(id[:]); present {
+		t.Errorf("transaction written before commit")
+	}
+	if err := batch.Commit(); err != nil {
+		t.Errorf("failed to commit batch: %s", err)
+	}
+	if present, _ := dbp.DB("dlt_transactions").Has(id[:]); !present {
+		t.Errorf("transaction not written after commit")
+	}
+	if repo.GetSubmitterHistory(tx.Request().SubmitterId, tx.Request().SubmitterSeq) == nil || repo.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("updates not applied after commit")
+	}
+	// journal should be cleared once all DBs are written
+	if present, _ := dbp.DB("dlt_journal").Has(journalKey); present {
+		t.Errorf("journal not cleared after commit")
+	}
+	if err := batch.Commit(); err == nil {
+		t.Errorf("commit of a committed batch should fail")
+	}
+	if err := batch.AddTx(dto.TestSignedTransaction("other data")); err == nil {
+		t.Errorf("update through a committed batch should fail")
+	}
+}
+
+// updates of a discarded batch should not be applied
+func TestBatch_Discard(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx := dto.TestSignedTransaction("test data")
+	batch := repo.Begin()
+	batch.AddTx(tx)
+	batch.UpdateShard(tx)
+	batch.DeleteTx(tx.Id())
+	if batch.GetTx(tx.Id()) != nil {
+		t.Errorf("pending delete not visible to reads")
+	}
+	batch.Discard()
+	if repo.GetTx(tx.Id()) != nil || repo.GetShardDagNode(tx.Id()) != nil || len(repo.ShardTips(tx.Request().ShardId)) != 0 {
+		t.Errorf("discarded updates should not be applied")
+	}
+	// without a batch, updates are written directly
+	repo.AddTx(tx)
+	if repo.GetTx(tx.Id()) == nil {
+		t.Errorf("update without batch not applied")
+	}
+}
+
+// each caller should get a batch of its own, independent of other open batches
+func TestBatch_Concurrent(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx1, tx2 := dto.TestSignedTransaction("tx 1"), dto.TestSignedTransaction("tx 2")
+	batch1, batch2 := repo.Begin(), repo.Begin()
+	batch1.AddTx(tx1)
+	batch2.AddTx(tx2)
+	if batch1.GetTx(tx2.Id()) != nil || batch2.GetTx(tx1.Id()) != nil {
+		t.Errorf("pending updates visible to another batch")
+	}
+	batch2.Discard()
+	if err := batch1.Commit(); err != nil {
+		t.Errorf("failed to commit batch: %s", err)
+	}
+	if repo.GetTx(tx1.Id()) == nil || repo.GetTx(tx2.Id()) != nil {
+		t.Errorf("incorrect updates applied")
+	}
+}
+
+// a batch begun from a batch should be applied into its parent batch
+func TestBatch_Nested(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	tx1, tx2 := dto.TestSignedTransaction("tx 1"), dto.TestSignedTransaction("tx 2")
+	parent := repo.Begin()
+	parent.AddTx(tx1)
+	child := parent.Begin()
+	if child.GetTx(tx1.Id()) == nil {
+		t.Errorf("parent's pending updates not visible to nested batch")
+	}
+	child.AddTx(tx2)
+	if err := child.Commit(); err != nil {
+		t.Errorf("failed to commit nested batch: %s", err)
+	}
+	if parent.GetTx(tx2.Id()) == nil || repo.GetTx(tx2.Id()) != nil {
+		t.Errorf("nested batch should be applied into parent only")
+	}
+	parent.Commit()
+	if repo.GetTx(tx1.Id()) == nil || repo.GetTx(tx2.Id()) == nil {
+		t.Errorf("updates not applied after parent's commit")
+	}
+}
+
+// writes to DBs of a batch's provider should be buffered in the batch
+func TestBatch_Provider(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	dbp.DB("test").Put([]byte("key 1"), []byte("old"))
+	batch := repo.Begin()
+	database := batch.Provider(dbp).DB("test")
+	database.Put([]byte("key 1"), []byte("new"))
+	database.Put([]byte("key 2"), []byte("value 2"))
+	if value, _ := database.Get([]byte("key 1")); string(value) != "new" {
+		t.Errorf("pending write not visible to reads: %s", value)
+	}
+	if value, _ := dbp.DB("test").Get([]byte("key 1")); string(value) != "old" {
+		t.Errorf("write applied before commit: %s", value)
+	}
+	iter := database.Iterator([]byte("key"))
+	count := 0
+	for iter.Next() {
+		count += 1
+	}
+	if count != 2 {
+		t.Errorf("incorrect number of records from iterator: %d", count)
+	}
+	batch.AddTx(dto.TestSignedTransaction("test data"))
+	batch.Commit()
+	if value, _ := dbp.DB("test").Get([]byte("key 2")); string(value) != "value 2" {
+		t.Errorf("write not applied after commit: %s", value)
+	}
+}
+
+// writes of a batch interrupted part way should be completed when DB is opened again
+func TestBatch_ReplayJournal(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	tx := dto.TestSignedTransaction("test data")
+	batch := repo.Begin()
+	batch.AddTx(tx)
+	batch.UpdateShard(tx)
+	// record journal of batch, without writing any DB
+	journal := []journalWrite{}
+	for _, database := range batch.(*dltDb).batch.dbs {
+		writes := batch.(*dltDb).batch.writes[database]
+		for _, key := range writes.keys {
+			journal = append(journal, journalWrite{Namespace: database.Name(), Key: []byte(key), Value: writes.writes[key].value})
+		}
+	}
+	data, _ := common.Serialize(journal)
+	dbp.DB("dlt_journal").Put(journalKey, data)
+	repo, _ = NewDltDb(dbp)
+	if repo.GetTx(tx.Id()) == nil || repo.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("journaled writes not completed")
+	}
+	if present, _ := dbp.DB("dlt_journal").Has(journalKey); present {
+		t.Errorf("journal not cleared after replay")
+	}
+}
+
+// concurrent updates and reads should be safe
+func TestDltDb_Concurrent(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			submitter := dto.TestSubmitter()
+			tx := submitter.NewTransaction(dto.TestAnchor(), fmt.Sprintf("tx %d", i))
+			repo.AddTx(tx)
+			repo.UpdateSubmitter(tx)
+			repo.UpdateShard(tx)
+			if repo.GetTx(tx.Id()) == nil {
+				t.Errorf("transaction %d not found", i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if tips := repo.ShardTips(dto.TestSubmitter().ShardId); len(tips) != 10 {
+		t.Errorf("incorrect number of shard tips: %d", len(tips))
+	}
+}
+
+// test shard registry updates from shard DAG updates
+func TestGetShards(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	if shards := repo.GetShards(); len(shards) != 0 {
+		t.Errorf("unexpected shards in empty registry: %d", len(shards))
+	}
+	genesis := dto.NewTransaction(&dto.TxRequest{ShardId: []byte("test shard"), Signature: []byte("genesis")},
+		&dto.Anchor{Signature: []byte("genesis")})
+	tx1 := dto.TestSignedTransaction("test data")
+	tx1.Anchor().ShardParent = genesis.Id()
+	tx2 := dto.TestSignedTransaction("other data")
+	tx2.Request().ShardId = []byte("another shard")
+	for _, tx := range []dto.Transaction{genesis, tx1, tx2, tx1} {
+		if err := repo.UpdateShard(tx); err != nil {
+			t.Errorf("Failed to update shard: %s", err)
+		}
+	}
+	if shards := repo.GetShards(); len(shards) != 2 {
+		t.Errorf("incorrect number of shards: %d", len(shards))
+	} else if string(shards[0]) != "another shard" || string(shards[1]) != "test shard" {
+		t.Errorf("incorrect shards: %s", shards)
+	}
+	if info := repo.GetShardInfo([]byte("test shard")); info == nil {
+		t.Errorf("no registry entry for shard")
+	} else if info.GenesisTx != genesis.Id() {
+		t.Errorf("incorrect genesis: %x", info.GenesisTx)
+	} else if info.TxCount != 2 {
+		t.Errorf("incorrect tx count: %d", info.TxCount)
+	} else if info.LatestSeq != tx1.Anchor().ShardSeq {
+		t.Errorf("incorrect latest seq: %d", info.LatestSeq)
+	}
+	if info := repo.GetShardInfo([]byte("unknown shard")); info != nil {
+		t.Errorf("unexpected registry entry for unknown shard")
+	}
+
+	// flushing a shard removes its registry entry
+	if err := repo.FlushShard([]byte("test shard")); err != nil {
+		t.Errorf("Failed to flush shard: %s", err)
+	}
+	if shards := repo.GetShards(); len(shards) != 1 {
+		t.Errorf("incorrect number of shards after flush: %d", len(shards))
+	}
+}
+
+// test submitter DAG updates from submitter history updates
+func TestSubmitterDag(t *testing.T) {
+	repo, _ := NewDltDb(db.NewInMemDbProvider())
+	submitter := dto.TestSubmitter()
+	newTx := func(data string, seq uint64, parent [64]byte, shardId string) dto.Transaction {
+		tx := submitter.NewTransaction(dto.TestAnchor(), data)
+		tx.Request().SubmitterSeq = seq
+		tx.Request().LastTx = parent
+		tx.Request().ShardId = []byte(shardId)
+		repo.AddTx(tx)
+		return tx
+	}
+	tx1 := newTx("data 1", 1, [64]byte{}, "shard 1")
+	tx2 := newTx("data 2", 2, tx1.Id(), "shard 1")
+	tx3 := newTx("data 3", 2, tx1.Id(), "shard 2")
+	for _, tx := range []dto.Transaction{tx1, tx2, tx3} {
+		if err := repo.UpdateSubmitter(tx); err != nil {
+			t.Errorf("Failed to update submitter: %s", err)
+		}
+	}
+
+	// transactions extending same parent on different shards are tips, but not a fork
+	if tips := repo.SubmitterTips(submitter.Id); len(tips) != 2 {
+		t.Errorf("incorrect number of tips: %d", len(tips))
+	} else if tips[0].TxId != tx2.Id() || tips[1].TxId != tx3.Id() {
+		t.Errorf("incorrect tips")
+	}
+	if node := repo.GetSubmitterDagNode(tx1.Id()); node == nil || len(node.Children) != 2 {
+		t.Errorf("incorrect submitter DAG node: %v", node)
+	}
+	if forks := repo.SubmitterForks(submitter.Id); len(forks) != 0 {
+		t.Errorf("unexpected forks: %d", len(forks))
+	}
+	if ancestry := repo.SubmitterAncestry(tx2.Id()); len(ancestry) != 2 {
+		t.Errorf("incorrect ancestry length: %d", len(ancestry))
+	} else if ancestry[0].TxId != tx2.Id() || ancestry[1].TxId != tx1.Id() {
+		t.Errorf("incorrect ancestry")
+	}
+
+	// a transaction extending same parent again on same shard is a fork
+	tx4 := newTx("data 4", 3, tx1.Id(), "shard 1")
+	if err := repo.UpdateSubmitter(tx4); err != nil {
+		t.Errorf("Failed to update submitter: %s", err)
+	}
+	if forks := repo.SubmitterForks(submitter.Id); len(forks) != 1 {
+		t.Errorf("incorrect number of forks: %d", len(forks))
+	} else if forks[0].TxId != tx1.Id() {
+		t.Errorf("incorrect fork")
+	}
+
+	// replacing a transaction removes it from submitter's DAG
+	tx5 := newTx("data 5", 2, tx1.Id(), "shard 2")
+	if err := repo.ReplaceSubmitter(tx5); err != nil {
+		t.Errorf("Failed to replace submitter: %s", err)
+	}
+	if node := repo.GetSubmitterDagNode(tx3.Id()); node != nil {
+		t.Errorf("replaced transaction not removed from submitter DAG")
+	}
+	if tips := repo.SubmitterTips(submitter.Id); len(tips) != 3 {
+		t.Errorf("incorrect number of tips after replace: %d", len(tips))
+	} else if tips[2].TxId != tx5.Id() {
+		t.Errorf("replacing transaction not a tip")
+	}
+}
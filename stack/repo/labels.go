@@ -0,0 +1,122 @@
+// Copyright 2019 The trust-net Authors
+// Labels and notes attached to transactions by local node, kept in a side table that's never gossiped
+package repo
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sort"
+	"sync"
+)
+
+// labels and note attached to a transaction
+type TxLabels struct {
+	TxId   [64]byte
+	Labels []string
+	Note   string
+}
+
+// key prefixes of label records, and of label index entries
+var (
+	labelsTxPrefix    = []byte("t")
+	labelsIndexPrefix = []byte("l")
+)
+
+func labelsTxKey(txId [64]byte) []byte {
+	return append(append([]byte{}, labelsTxPrefix...), txId[:]...)
+}
+
+// index entry of a label, label is terminated with a 0 byte so that a label is not a prefix of another
+func labelsIndexKey(label string) []byte {
+	return append(append(append([]byte{}, labelsIndexPrefix...), label...), 0)
+}
+
+type LabelStore struct {
+	db   db.Database
+	lock sync.Mutex
+}
+
+// open labels persisted in a DB provider
+func NewLabelStore(dbp db.DbProvider) *LabelStore {
+	return &LabelStore{
+		db: dbp.DB("dlt_labels"),
+	}
+}
+
+// replace labels and note of a transaction, removes transaction's entry when both are empty
+func (s *LabelStore) Set(txId [64]byte, labels []string, note string) error {
+	for _, label := range labels {
+		if len(label) == 0 {
+			return errors.New("empty label")
+		}
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if existing := s.get(txId); existing != nil {
+		for _, label := range existing.Labels {
+			if err := s.db.Delete(append(labelsIndexKey(label), txId[:]...)); err != nil {
+				return err
+			}
+		}
+	}
+	if len(labels) == 0 && len(note) == 0 {
+		return s.db.Delete(labelsTxKey(txId))
+	}
+	// labels are kept sorted and without duplicates
+	unique := make(map[string]bool)
+	record := &TxLabels{TxId: txId, Note: note}
+	for _, label := range labels {
+		if !unique[label] {
+			unique[label] = true
+			record.Labels = append(record.Labels, label)
+		}
+	}
+	sort.Strings(record.Labels)
+	for _, label := range record.Labels {
+		if err := s.db.Put(append(labelsIndexKey(label), txId[:]...), []byte{}); err != nil {
+			return err
+		}
+	}
+	if data, err := common.Serialize(record); err != nil {
+		return err
+	} else {
+		return s.db.Put(labelsTxKey(txId), data)
+	}
+}
+
+// get labels and note of a transaction, nil if none were attached
+func (s *LabelStore) Get(txId [64]byte) *TxLabels {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.get(txId)
+}
+
+func (s *LabelStore) get(txId [64]byte) *TxLabels {
+	if data, err := s.db.Get(labelsTxKey(txId)); err != nil || len(data) == 0 {
+		return nil
+	} else {
+		record := &TxLabels{}
+		if err := common.Deserialize(data, record); err != nil {
+			return nil
+		}
+		return record
+	}
+}
+
+// get IDs of transactions with a label, in order of IDs
+func (s *LabelStore) TxIds(label string) [][64]byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	prefix := labelsIndexKey(label)
+	ids := [][64]byte{}
+	iter := s.db.Iterator(prefix)
+	defer iter.Release()
+	for iter.Next() {
+		id := [64]byte{}
+		if copy(id[:], iter.Key()[len(prefix):]) == 64 {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
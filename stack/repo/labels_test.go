@@ -0,0 +1,37 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// labels should be indexed for lookup, and replaced on update
+func TestLabelStore(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	tx1, tx2 := dto.RandomHash(), dto.RandomHash()
+	if err := NewLabelStore(dbp).Set(tx1, []string{"incident", "user-1", "incident"}, "test note"); err != nil {
+		t.Fatalf("failed to set labels: %s", err)
+	}
+	NewLabelStore(dbp).Set(tx2, []string{"incident-2"}, "")
+	s := NewLabelStore(dbp)
+	if labels := s.Get(tx1); labels == nil || len(labels.Labels) != 2 || labels.Labels[0] != "incident" || labels.Note != "test note" {
+		t.Errorf("incorrect labels: %v", labels)
+	}
+	// a label should not match labels it's a prefix of
+	if ids := s.TxIds("incident"); len(ids) != 1 || ids[0] != tx1 {
+		t.Errorf("incorrect transactions for label: %d", len(ids))
+	}
+	s.Set(tx1, []string{"user-1"}, "")
+	if ids := s.TxIds("incident"); len(ids) != 0 {
+		t.Errorf("label index not updated: %d", len(ids))
+	}
+	s.Set(tx1, nil, "")
+	if s.Get(tx1) != nil || len(s.TxIds("user-1")) != 0 {
+		t.Errorf("labels not removed")
+	}
+	if err := s.Set(tx2, []string{""}, ""); err == nil {
+		t.Errorf("expected empty label to fail")
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2019 The trust-net Authors
+// Transactions pinned by local node, exempt from pruning regardless of shards' retention policies
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sort"
+)
+
+// a transaction pinned in node's history
+type Pin struct {
+	TxId     [64]byte
+	ShardId  []byte
+	ShardSeq uint64
+	// why transaction was pinned, e.g. a legal hold reference
+	Reason string
+	// unix time (seconds) when transaction was pinned
+	PinnedAt int64
+}
+
+func pinsDb(dbp db.DbProvider) db.Database {
+	return dbp.DB("dlt_pins")
+}
+
+func (d *dltDb) PinTx(pin *Pin) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if data, err := common.Serialize(pin); err != nil {
+		return err
+	} else {
+		return d.put(d.pinsDb, pin.TxId[:], data)
+	}
+}
+
+func (d *dltDb) UnpinTx(id [64]byte) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.delete(d.pinsDb, id[:])
+}
+
+func (d *dltDb) GetPin(id [64]byte) *Pin {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getPin(id)
+}
+
+func (d *dltDb) getPin(id [64]byte) *Pin {
+	if data, err := d.get(d.pinsDb, id[:]); err != nil || len(data) == 0 {
+		return nil
+	} else {
+		pin := &Pin{}
+		if err := common.Deserialize(data, pin); err != nil {
+			return nil
+		}
+		return pin
+	}
+}
+
+func (d *dltDb) GetPins() []Pin {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	pins := []Pin{}
+	for _, data := range d.getAll(d.pinsDb) {
+		pin := Pin{}
+		if err := common.Deserialize(data, &pin); err == nil {
+			pins = append(pins, pin)
+		}
+	}
+	sort.Slice(pins, func(i, j int) bool {
+		return pins[i].PinnedAt < pins[j].PinnedAt
+	})
+	return pins
+}
@@ -0,0 +1,87 @@
+// Copyright 2019 The trust-net Authors
+// Protobuf encoding of shard DAG nodes and submitter history, as per schema in docs/dag.proto
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+)
+
+func (n *DagNode) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Hash(1, n.Parent)
+	for _, child := range n.Children {
+		w.Hash(2, child)
+	}
+	w.Hash(3, n.TxId)
+	w.Uint64(4, n.Depth)
+	return w.Result(), nil
+}
+
+func (n *DagNode) UnmarshalProto(data []byte) error {
+	*n = DagNode{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			n.Parent = pr.Hash()
+		case 2:
+			n.Children = append(n.Children, pr.Hash())
+		case 3:
+			n.TxId = pr.Hash()
+		case 4:
+			n.Depth = pr.Uint64()
+		}
+	}
+	return pr.Err()
+}
+
+func (p *ShardTxPair) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, p.ShardId)
+	w.Hash(2, p.TxId)
+	return w.Result(), nil
+}
+
+func (p *ShardTxPair) UnmarshalProto(data []byte) error {
+	*p = ShardTxPair{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			p.ShardId = pr.Bytes()
+		case 2:
+			p.TxId = pr.Hash()
+		}
+	}
+	return pr.Err()
+}
+
+func (h *SubmitterHistory) MarshalProto() ([]byte, error) {
+	w := &common.ProtoWriter{}
+	w.Bytes(1, h.Submitter)
+	w.Uint64(2, h.Seq)
+	for i := range h.ShardTxPairs {
+		if err := w.Message(3, &h.ShardTxPairs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return w.Result(), nil
+}
+
+func (h *SubmitterHistory) UnmarshalProto(data []byte) error {
+	*h = SubmitterHistory{}
+	pr := common.NewProtoReader(data)
+	for pr.Next() {
+		switch pr.Field() {
+		case 1:
+			h.Submitter = pr.Bytes()
+		case 2:
+			h.Seq = pr.Uint64()
+		case 3:
+			pair := ShardTxPair{}
+			pr.Message(&pair)
+			h.ShardTxPairs = append(h.ShardTxPairs, pair)
+		}
+	}
+	return pr.Err()
+}
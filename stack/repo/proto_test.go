@@ -0,0 +1,47 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+func TestDagNode_Proto(t *testing.T) {
+	node := &DagNode{
+		Parent:   dto.RandomHash(),
+		Children: [][64]byte{dto.RandomHash(), dto.RandomHash()},
+		TxId:     dto.RandomHash(),
+		Depth:    42,
+	}
+	var decoded DagNode
+	if data, err := common.ProtobufCodec.Marshal(node); err != nil {
+		t.Errorf("failed to marshal: %s", err)
+	} else if err := common.ProtobufCodec.Unmarshal(data, &decoded); err != nil {
+		t.Errorf("failed to unmarshal: %s", err)
+	} else if decoded.Parent != node.Parent || decoded.TxId != node.TxId || decoded.Depth != 42 ||
+		len(decoded.Children) != 2 || decoded.Children[1] != node.Children[1] {
+		t.Errorf("node did not round trip: %v", decoded)
+	}
+}
+
+func TestSubmitterHistory_Proto(t *testing.T) {
+	history := &SubmitterHistory{
+		Submitter: []byte("submitter"),
+		Seq:       7,
+		ShardTxPairs: []ShardTxPair{
+			{ShardId: []byte("shard-1"), TxId: dto.RandomHash()},
+			{ShardId: []byte("shard-2"), TxId: dto.RandomHash()},
+		},
+	}
+	var decoded SubmitterHistory
+	if data, err := common.ProtobufCodec.Marshal(history); err != nil {
+		t.Errorf("failed to marshal: %s", err)
+	} else if err := common.ProtobufCodec.Unmarshal(data, &decoded); err != nil {
+		t.Errorf("failed to unmarshal: %s", err)
+	} else if !bytes.Equal(decoded.Submitter, history.Submitter) || decoded.Seq != 7 || len(decoded.ShardTxPairs) != 2 ||
+		!bytes.Equal(decoded.ShardTxPairs[1].ShardId, []byte("shard-2")) || decoded.ShardTxPairs[1].TxId != history.ShardTxPairs[1].TxId {
+		t.Errorf("history did not round trip: %v", decoded)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 The trust-net Authors
+// Receipts tracking finality status of transactions known to local node, kept in a side table that's never gossiped
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sync"
+)
+
+// finality status of a transaction, along with detail of its last update
+type TxReceipt struct {
+	TxId   [64]byte
+	Status string
+	// reason of rejection/orphaning, or peer that confirmed transaction
+	Detail string
+	// unix time (seconds) of last status update
+	UpdatedAt int64
+}
+
+type ReceiptStore struct {
+	db   db.Database
+	lock sync.Mutex
+}
+
+// open receipts persisted in a DB provider
+func NewReceiptStore(dbp db.DbProvider) *ReceiptStore {
+	return &ReceiptStore{
+		db: dbp.DB("dlt_receipts"),
+	}
+}
+
+// save a transaction's receipt, replacing earlier one
+func (s *ReceiptStore) Set(receipt *TxReceipt) error {
+	data, err := common.Serialize(receipt)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.db.Put(receipt.TxId[:], data)
+}
+
+// get receipt of a transaction, nil if none was saved
+func (s *ReceiptStore) Get(txId [64]byte) *TxReceipt {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if data, err := s.db.Get(txId[:]); err != nil || len(data) == 0 {
+		return nil
+	} else {
+		receipt := &TxReceipt{}
+		if err := common.Deserialize(data, receipt); err != nil {
+			return nil
+		}
+		return receipt
+	}
+}
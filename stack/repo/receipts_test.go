@@ -0,0 +1,25 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// receipts should be persisted, and replaced on update
+func TestReceiptStore(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	txId := dto.RandomHash()
+	if NewReceiptStore(dbp).Get(txId) != nil {
+		t.Errorf("expected no receipt for unknown transaction")
+	}
+	if err := NewReceiptStore(dbp).Set(&TxReceipt{TxId: txId, Status: "pending"}); err != nil {
+		t.Fatalf("failed to save receipt: %s", err)
+	}
+	s := NewReceiptStore(dbp)
+	s.Set(&TxReceipt{TxId: txId, Status: "rejected", Detail: "invalid"})
+	if receipt := s.Get(txId); receipt == nil || receipt.Status != "rejected" || receipt.Detail != "invalid" {
+		t.Errorf("incorrect receipt: %v", receipt)
+	}
+}
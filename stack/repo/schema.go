@@ -0,0 +1,113 @@
+// Copyright 2019 The trust-net Authors
+// Storage schema version of DLT DB records, and migrations to upgrade existing data
+package repo
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
+)
+
+// version of storage schema written by this code, data with a newer version is refused
+var SchemaVersion = uint64(6)
+
+// a migration that upgrades data from a schema version to the next version
+type Migration struct {
+	// schema version that migration upgrades from
+	From        uint64
+	Description string
+	// upgrade records in any of the provider's DBs
+	Migrate func(dbp db.DbProvider) error
+}
+
+// migrations in order of schema versions, each record format change must add a migration
+// and bump SchemaVersion
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "record schema version of data created before versioning",
+		Migrate:     func(dbp db.DbProvider) error { return nil },
+	},
+	{
+		From: 1,
+		// existing world state records are all single records, so nothing to convert, but older
+		// code cannot read chunked values and must not open upgraded data
+		Description: "world state resource values stored in chunks",
+		Migrate:     func(dbp db.DbProvider) error { return nil },
+	},
+	{
+		From:        2,
+		Description: "registry of shards seen in transaction history",
+		Migrate:     migrateShardRegistry,
+	},
+	{
+		From:        3,
+		Description: "submitter DAGs built from submitter histories",
+		Migrate:     migrateSubmitterDags,
+	},
+	{
+		From: 4,
+		// existing transaction records are all stored as is, so nothing to convert, but older
+		// code cannot read compressed records and must not open upgraded data
+		Description: "transaction records optionally compressed",
+		Migrate:     func(dbp db.DbProvider) error { return nil },
+	},
+	{
+		From:        5,
+		Description: "anchor audit records keyed with a prefix per record type",
+		Migrate:     migrateAnchorAudit,
+	},
+}
+
+// key of schema version record in schema DB
+var schemaVersionKey = []byte("version")
+
+var schemaLogger = log.NewLogger("Schema")
+
+func schemaDb(dbp db.DbProvider) db.Database {
+	return dbp.DB("dlt_schema")
+}
+
+// get schema version of data in a DB provider, 0 for data created before versioning
+func GetSchemaVersion(dbp db.DbProvider) uint64 {
+	if data, err := schemaDb(dbp).Get(schemaVersionKey); err == nil && len(data) == 8 {
+		return common.BytesToUint64(data)
+	}
+	return 0
+}
+
+// upgrade data in a DB provider to current schema version, running each pending migration in
+// order (version is recorded after each migration, so that an interrupted upgrade resumes), fails
+// if data has a newer schema version than this code supports
+func Migrate(dbp db.DbProvider) error {
+	current := GetSchemaVersion(dbp)
+	if current > SchemaVersion {
+		return fmt.Errorf("data schema version %d is newer than supported version %d", current, SchemaVersion)
+	}
+	if current == 0 && len(dbp.DB("dlt_shard_tips").GetAll()) == 0 {
+		// new data directory, nothing to migrate
+		return schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(SchemaVersion))
+	}
+	for current < SchemaVersion {
+		var migration *Migration
+		for i := range migrations {
+			if migrations[i].From == current {
+				migration = &migrations[i]
+				break
+			}
+		}
+		if migration == nil {
+			return fmt.Errorf("no migration from schema version %d", current)
+		}
+		schemaLogger.Info("Migrating data from schema version %d: %s", current, migration.Description)
+		if err := migration.Migrate(dbp); err != nil {
+			return fmt.Errorf("migration from schema version %d failed: %s", current, err)
+		}
+		current += 1
+		if err := schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(current)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// new data should be stamped with current schema version
+func TestMigrate_NewData(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	if _, err := NewDltDb(dbp); err != nil {
+		t.Errorf("failed to create DB: %s", err)
+	}
+	if GetSchemaVersion(dbp) != SchemaVersion {
+		t.Errorf("incorrect schema version: %d", GetSchemaVersion(dbp))
+	}
+}
+
+// existing data should be upgraded through each pending migration in order
+func TestMigrate_Upgrade(t *testing.T) {
+	origVersion, origMigrations := SchemaVersion, migrations
+	defer func() { SchemaVersion, migrations = origVersion, origMigrations }()
+	applied := []uint64{}
+	SchemaVersion, migrations = 3, []Migration{}
+	for from := uint64(0); from < 3; from++ {
+		from := from
+		migrations = append(migrations, Migration{From: from, Migrate: func(dbp db.DbProvider) error {
+			applied = append(applied, from)
+			return nil
+		}})
+	}
+	// create data at version 1, with some shard data
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	repo.UpdateShard(dto.TestSignedTransaction("test data"))
+	schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(1))
+	applied = applied[:0]
+	if _, err := NewDltDb(dbp); err != nil {
+		t.Errorf("failed to upgrade: %s", err)
+	} else if len(applied) != 2 || applied[0] != 1 || applied[1] != 2 {
+		t.Errorf("incorrect migrations applied: %v", applied)
+	} else if GetSchemaVersion(dbp) != 3 {
+		t.Errorf("incorrect schema version after upgrade: %d", GetSchemaVersion(dbp))
+	}
+}
+
+// failed migration should leave data at last successful version
+func TestMigrate_Failure(t *testing.T) {
+	origVersion, origMigrations := SchemaVersion, migrations
+	defer func() { SchemaVersion, migrations = origVersion, origMigrations }()
+	SchemaVersion = 2
+	migrations = []Migration{
+		{From: 0, Migrate: func(dbp db.DbProvider) error { return nil }},
+		{From: 1, Migrate: func(dbp db.DbProvider) error { return fmt.Errorf("test failure") }},
+	}
+	dbp := db.NewInMemDbProvider()
+	dbp.DB("dlt_shard_tips").Put([]byte("shard"), []byte("tips"))
+	if _, err := NewDltDb(dbp); err == nil {
+		t.Errorf("expected migration failure")
+	} else if GetSchemaVersion(dbp) != 1 {
+		t.Errorf("incorrect schema version after failure: %d", GetSchemaVersion(dbp))
+	}
+}
+
+// data from newer code should be refused
+func TestMigrate_NewerVersion(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(SchemaVersion+1))
+	if _, err := NewDltDb(dbp); err == nil {
+		t.Errorf("expected newer schema version to be refused")
+	}
+}
+
+func TestMigrate_ShardRegistry(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	genesis := dto.NewTransaction(&dto.TxRequest{ShardId: []byte("test shard"), Signature: []byte("genesis")},
+		&dto.Anchor{Signature: []byte("genesis")})
+	tx := dto.TestSignedTransaction("test data")
+	tx.Anchor().ShardParent = genesis.Id()
+	for _, tx := range []dto.Transaction{genesis, tx} {
+		repo.AddTx(tx)
+		repo.UpdateShard(tx)
+	}
+	// simulate data created before the registry
+	for _, data := range shardsDb(dbp).GetAll() {
+		info := &ShardInfo{}
+		common.Deserialize(data, info)
+		shardsDb(dbp).Delete(info.ShardId)
+	}
+	schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(2))
+	if err := Migrate(dbp); err != nil {
+		t.Errorf("failed to migrate: %s", err)
+	}
+	if info := repo.GetShardInfo([]byte("test shard")); info == nil {
+		t.Errorf("registry not rebuilt")
+	} else if info.GenesisTx != genesis.Id() || info.TxCount != 2 || info.LatestSeq != tx.Anchor().ShardSeq {
+		t.Errorf("incorrect registry entry: %x, %d, %d", info.GenesisTx, info.TxCount, info.LatestSeq)
+	}
+}
+
+func TestMigrate_AnchorAudit(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	submitter := []byte("test submitter")
+	// simulate records keyed before type prefixes
+	records, _ := common.Serialize([]AnchorRecord{{Submitter: submitter, Seq: 2, Signature: []byte("sig")}})
+	auditDb := dbp.DB("dlt_anchor_audit")
+	auditDb.Put(submitterHistoryKey(submitter, 2), records)
+	auditDb.Put(submitter, common.Uint64ToBytes(2))
+	schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(5))
+	if err := Migrate(dbp); err != nil {
+		t.Errorf("failed to migrate: %s", err)
+	}
+	if max := repo.GetAnchorMaxSeq(submitter); max != 2 {
+		t.Errorf("incorrect max seq: %d", max)
+	}
+	if records := repo.GetAnchorRecords(submitter, 2); len(records) != 1 || string(records[0].Signature) != "sig" {
+		t.Errorf("incorrect records: %v", records)
+	}
+	if present, _ := auditDb.Has(submitter); present {
+		t.Errorf("record with old key not removed")
+	}
+}
+
+func TestMigrate_SubmitterDags(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	repo, _ := NewDltDb(dbp)
+	tx1 := dto.TestSignedTransaction("test data 1")
+	tx2 := dto.TestSubmitter().NewTransaction(dto.TestAnchor(), "test data 2")
+	tx2.Request().SubmitterId = tx1.Request().SubmitterId
+	tx2.Request().SubmitterSeq = tx1.Request().SubmitterSeq + 1
+	tx2.Request().LastTx = tx1.Id()
+	// add in reverse order of seq, migration should still link the DAG
+	for _, tx := range []dto.Transaction{tx2, tx1} {
+		repo.AddTx(tx)
+		repo.UpdateSubmitter(tx)
+	}
+	// simulate data created before submitter DAGs
+	for _, tx := range []dto.Transaction{tx1, tx2} {
+		id := tx.Id()
+		dbp.DB("dlt_submitter_dags").Delete(id[:])
+	}
+	dbp.DB("dlt_submitter_tips").Delete(tx1.Request().SubmitterId)
+	schemaDb(dbp).Put(schemaVersionKey, common.Uint64ToBytes(3))
+	if err := Migrate(dbp); err != nil {
+		t.Errorf("failed to migrate: %s", err)
+	}
+	if tips := repo.SubmitterTips(tx1.Request().SubmitterId); len(tips) != 1 || tips[0].TxId != tx2.Id() {
+		t.Errorf("incorrect tips after migration: %v", tips)
+	}
+	if ancestry := repo.SubmitterAncestry(tx2.Id()); len(ancestry) != 2 {
+		t.Errorf("incorrect ancestry after migration: %d", len(ancestry))
+	}
+}
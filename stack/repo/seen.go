@@ -0,0 +1,49 @@
+// Copyright 2019 The trust-net Authors
+// Cache of message IDs recently seen by node, persisted in DLT DB so that messages handled before a restart
+// are not processed and gossiped again right after the restart
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+)
+
+// persisted record of seen message IDs
+type seenRecord struct {
+	Ids [][64]byte
+}
+
+var seenKey = []byte("seen")
+
+type SeenCache struct {
+	db db.Database
+}
+
+// open seen message IDs persisted in a DB provider
+func NewSeenCache(dbp db.DbProvider) *SeenCache {
+	return &SeenCache{
+		db: dbp.DB("dlt_seen"),
+	}
+}
+
+// load persisted message IDs, none if never saved
+func (c *SeenCache) Load() ([][64]byte, error) {
+	data, err := c.db.Get(seenKey)
+	if err != nil || len(data) == 0 {
+		return nil, nil
+	}
+	record := &seenRecord{}
+	if err := common.Deserialize(data, record); err != nil {
+		return nil, err
+	}
+	return record.Ids, nil
+}
+
+// persist message IDs, replacing earlier saved IDs
+func (c *SeenCache) Save(ids [][64]byte) error {
+	if data, err := common.Serialize(&seenRecord{Ids: ids}); err != nil {
+		return err
+	} else {
+		return c.db.Put(seenKey, data)
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// seen IDs should survive re-opening of DB, and be replaced on save
+func TestSeenCache_Persist(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	if ids, err := NewSeenCache(dbp).Load(); err != nil || len(ids) != 0 {
+		t.Errorf("did not expect seen IDs before save: %d, %s", len(ids), err)
+	}
+	id1, id2 := dto.RandomHash(), dto.RandomHash()
+	NewSeenCache(dbp).Save([][64]byte{id1, id2})
+	if ids, err := NewSeenCache(dbp).Load(); err != nil || len(ids) != 2 || ids[0] != id1 || ids[1] != id2 {
+		t.Errorf("seen IDs not persisted: %d, %s", len(ids), err)
+	}
+	NewSeenCache(dbp).Save([][64]byte{id2})
+	if ids, _ := NewSeenCache(dbp).Load(); len(ids) != 1 || ids[0] != id2 {
+		t.Errorf("seen IDs not replaced: %d", len(ids))
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2019 The trust-net Authors
+// Registry of shards seen in transaction history, with metadata of each shard
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sort"
+	"time"
+)
+
+// metadata of a shard known to the node
+type ShardInfo struct {
+	// Shard ID
+	ShardId []byte
+	// ID of shard's genesis transaction
+	GenesisTx [64]byte
+	// number of transactions in shard's DAG (including genesis)
+	TxCount uint64
+	// highest shard sequence seen in shard's DAG
+	LatestSeq uint64
+	// time (unix nano) node last added a transaction to shard's DAG, 0 if not recorded yet
+	LastTxAt int64
+}
+
+func shardsDb(dbp db.DbProvider) db.Database {
+	return dbp.DB("dlt_shards")
+}
+
+// update registry entry of a transaction's shard (called with lock held)
+func (d *dltDb) updateShardInfo(tx dto.Transaction) error {
+	info := d.getShardInfo(tx.Request().ShardId)
+	if info == nil {
+		info = &ShardInfo{
+			ShardId: tx.Request().ShardId,
+		}
+	}
+	if tx.Anchor().ShardSeq == 0 {
+		info.GenesisTx = tx.Id()
+	}
+	if tx.Anchor().ShardSeq > info.LatestSeq {
+		info.LatestSeq = tx.Anchor().ShardSeq
+	}
+	info.TxCount += 1
+	info.LastTxAt = time.Now().UnixNano()
+	return d.saveShardInfo(info)
+}
+
+func (d *dltDb) saveShardInfo(info *ShardInfo) error {
+	if data, err := common.Serialize(info); err != nil {
+		return err
+	} else {
+		return d.put(d.shardsDb, info.ShardId, data)
+	}
+}
+
+func (d *dltDb) GetShardInfo(shardId []byte) *ShardInfo {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getShardInfo(shardId)
+}
+
+func (d *dltDb) getShardInfo(shardId []byte) *ShardInfo {
+	if data, err := d.get(d.shardsDb, shardId); err != nil {
+		return nil
+	} else {
+		info := &ShardInfo{}
+		if err := common.Deserialize(data, info); err != nil {
+			return nil
+		}
+		return info
+	}
+}
+
+func (d *dltDb) GetShards() [][]byte {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	shards := [][]byte{}
+	for _, data := range d.getAll(d.shardsDb) {
+		info := &ShardInfo{}
+		if err := common.Deserialize(data, info); err == nil {
+			shards = append(shards, info.ShardId)
+		}
+	}
+	sort.Slice(shards, func(i, j int) bool {
+		return string(shards[i]) < string(shards[j])
+	})
+	return shards
+}
+
+// build shard registry from existing shard DAGs, for data created before the registry
+func migrateShardRegistry(dbp db.DbProvider) error {
+	d := &dltDb{
+		txDb:        dbp.DB("dlt_transactions"),
+		shardDAGsDb: dbp.DB("dlt_shard_dags"),
+		shardsDb:    shardsDb(dbp),
+	}
+	// shard tips are keyed by shard id, so find shards from their tip transactions
+	for _, data := range dbp.DB("dlt_shard_tips").GetAll() {
+		tips := [][64]byte{}
+		if err := common.Deserialize(data, &tips); err != nil || len(tips) == 0 {
+			continue
+		}
+		var info *ShardInfo
+		for _, tip := range tips {
+			if tx := d.getTx(tip); tx != nil {
+				info = &ShardInfo{ShardId: tx.Request().ShardId}
+				break
+			}
+		}
+		if info == nil {
+			continue
+		}
+		// walk shard's DAG up from its tips, visiting each node once
+		visited := make(map[[64]byte]struct{})
+		for len(tips) > 0 {
+			id := tips[0]
+			tips = tips[1:]
+			if _, seen := visited[id]; seen {
+				continue
+			}
+			visited[id] = struct{}{}
+			node := d.getShardDagNode(id)
+			if node == nil {
+				continue
+			}
+			info.TxCount += 1
+			if node.Depth == 0 {
+				info.GenesisTx = node.TxId
+			}
+			if node.Depth > info.LatestSeq {
+				info.LatestSeq = node.Depth
+			}
+			tips = append(tips, node.Parent)
+		}
+		if err := d.saveShardInfo(info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Copyright 2019 The trust-net Authors
+// State diffs of transactions as applied by app's transaction handler, kept in a side table along with receipts, so that
+// a shard's world state can be rebuilt without re-running the handler
+package repo
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"sync"
+)
+
+// update of a resource by a transaction
+type ResourceDiff struct {
+	Key   []byte
+	Owner []byte
+	Value []byte
+	// resource was deleted
+	Deleted bool
+}
+
+// resources updated by a transaction, each key listed once (with its final update), in order of keys
+type StateDiff struct {
+	TxId    [64]byte
+	ShardId []byte
+	Seq     uint64
+	Updates []ResourceDiff
+}
+
+type StateDiffStore struct {
+	dbp  db.DbProvider
+	lock sync.Mutex
+}
+
+// open state diffs persisted in a DB provider
+func NewStateDiffStore(dbp db.DbProvider) *StateDiffStore {
+	return &StateDiffStore{
+		dbp: dbp,
+	}
+}
+
+func (s *StateDiffStore) shardDb(shardId []byte) (db.Database, error) {
+	if sdb := s.dbp.DB("dlt_state_diffs_" + string(shardId)); sdb == nil {
+		return nil, errors.New("cannot open state diffs DB")
+	} else {
+		return sdb, nil
+	}
+}
+
+// save a transaction's state diff, replacing earlier one
+func (s *StateDiffStore) Set(diff *StateDiff) error {
+	data, err := common.Serialize(diff)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sdb, err := s.shardDb(diff.ShardId); err != nil {
+		return err
+	} else {
+		return sdb.Put(diff.TxId[:], data)
+	}
+}
+
+// get state diff of a shard's transaction, nil if none was saved
+func (s *StateDiffStore) Get(shardId []byte, txId [64]byte) *StateDiff {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sdb, err := s.shardDb(shardId); err != nil {
+		return nil
+	} else if data, err := sdb.Get(txId[:]); err != nil || len(data) == 0 {
+		return nil
+	} else {
+		diff := &StateDiff{}
+		if err := common.Deserialize(data, diff); err != nil {
+			return nil
+		}
+		return diff
+	}
+}
+
+// remove state diffs of all transactions of a shard
+func (s *StateDiffStore) Drop(shardId []byte) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if sdb, err := s.shardDb(shardId); err != nil {
+		return err
+	} else {
+		return sdb.Drop()
+	}
+}
@@ -0,0 +1,28 @@
+// Copyright 2019 The trust-net Authors
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// state diffs should be persisted per shard, and dropped with their shard
+func TestStateDiffStore(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	txId := dto.RandomHash()
+	diff := &StateDiff{TxId: txId, ShardId: []byte("shard"), Seq: 3, Updates: []ResourceDiff{{Key: []byte("key"), Value: []byte("value")}}}
+	if err := NewStateDiffStore(dbp).Set(diff); err != nil {
+		t.Fatalf("failed to save diff: %s", err)
+	}
+	s := NewStateDiffStore(dbp)
+	if d := s.Get([]byte("shard"), txId); d == nil || d.Seq != 3 || len(d.Updates) != 1 || string(d.Updates[0].Value) != "value" {
+		t.Errorf("incorrect diff: %v", d)
+	}
+	if s.Get([]byte("other"), txId) != nil {
+		t.Errorf("expected no diff for other shard")
+	}
+	if err := s.Drop([]byte("shard")); err != nil || s.Get([]byte("shard"), txId) != nil {
+		t.Errorf("diff not dropped: %s", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Copyright 2019 The trust-net Authors
+// Submitter DAG, linking each submitter's transactions to submitter's last transaction across shards
+package repo
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sort"
+)
+
+// add DAG node of a transaction to its submitter's DAG, and update submitter's tips (called with lock held)
+func (d *dltDb) addSubmitterDagNode(tx dto.Transaction) error {
+	txId := tx.Id()
+	if d.has(d.submitterDAGsDb, txId[:]) {
+		return nil
+	}
+	node := &DagNode{
+		Parent: tx.Request().LastTx,
+		TxId:   txId,
+		Depth:  tx.Request().SubmitterSeq,
+	}
+	if err := d.saveSubmitterDagNode(node); err != nil {
+		return err
+	}
+	// update the children of the parent DAG node (if present)
+	if parent := d.getSubmitterDagNode(node.Parent); parent != nil {
+		parent.Children = append(parent.Children, txId)
+		if err := d.saveSubmitterDagNode(parent); err != nil {
+			return err
+		}
+	}
+	// replace parent with new transaction in submitter's tips
+	tips := [][64]byte{}
+	for _, tip := range d.submitterTips(tx.Request().SubmitterId) {
+		if tip != node.Parent {
+			tips = append(tips, tip)
+		}
+	}
+	return d.updateSubmitterTips(tx.Request().SubmitterId, append(tips, txId))
+}
+
+// remove DAG node of a replaced transaction from its submitter's DAG (called with lock held)
+func (d *dltDb) removeSubmitterDagNode(submitterId []byte, txId [64]byte) error {
+	node := d.getSubmitterDagNode(txId)
+	if node == nil {
+		return nil
+	}
+	if err := d.delete(d.submitterDAGsDb, txId[:]); err != nil {
+		return err
+	}
+	tips := [][64]byte{}
+	for _, tip := range d.submitterTips(submitterId) {
+		if tip != txId {
+			tips = append(tips, tip)
+		}
+	}
+	// remove from children of the parent DAG node, parent becomes a tip when it has no other children
+	if parent := d.getSubmitterDagNode(node.Parent); parent != nil {
+		children := [][64]byte{}
+		for _, child := range parent.Children {
+			if child != txId {
+				children = append(children, child)
+			}
+		}
+		parent.Children = children
+		if err := d.saveSubmitterDagNode(parent); err != nil {
+			return err
+		}
+		if len(children) == 0 {
+			tips = append(tips, parent.TxId)
+		}
+	}
+	return d.updateSubmitterTips(submitterId, tips)
+}
+
+func (d *dltDb) saveSubmitterDagNode(node *DagNode) error {
+	if data, err := common.Serialize(node); err != nil {
+		return err
+	} else {
+		return d.put(d.submitterDAGsDb, node.TxId[:], data)
+	}
+}
+
+func (d *dltDb) GetSubmitterDagNode(id [64]byte) *DagNode {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return d.getSubmitterDagNode(id)
+}
+
+func (d *dltDb) getSubmitterDagNode(id [64]byte) *DagNode {
+	if data, err := d.get(d.submitterDAGsDb, id[:]); err != nil {
+		return nil
+	} else {
+		node := &DagNode{}
+		if err := common.Deserialize(data, node); err != nil {
+			return nil
+		}
+		return node
+	}
+}
+
+func (d *dltDb) submitterTips(submitterId []byte) [][64]byte {
+	tips := [][64]byte{}
+	if data, err := d.get(d.submitterTipsDb, submitterId); err == nil {
+		if err := common.Deserialize(data, &tips); err != nil {
+			return [][64]byte{}
+		}
+	}
+	return tips
+}
+
+func (d *dltDb) updateSubmitterTips(submitterId []byte, tips [][64]byte) error {
+	if data, err := common.Serialize(tips); err != nil {
+		return err
+	} else {
+		return d.put(d.submitterTipsDb, submitterId, data)
+	}
+}
+
+func (d *dltDb) SubmitterTips(submitterId []byte) []DagNode {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	nodes := []DagNode{}
+	for _, tip := range d.submitterTips(submitterId) {
+		if node := d.getSubmitterDagNode(tip); node != nil {
+			nodes = append(nodes, *node)
+		}
+	}
+	return nodes
+}
+
+func (d *dltDb) SubmitterAncestry(id [64]byte) []DagNode {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	nodes := []DagNode{}
+	for node := d.getSubmitterDagNode(id); node != nil; node = d.getSubmitterDagNode(node.Parent) {
+		nodes = append(nodes, *node)
+	}
+	return nodes
+}
+
+func (d *dltDb) SubmitterForks(submitterId []byte) []DagNode {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	forks := []DagNode{}
+	// walk submitter's DAG up from its tips, visiting each node once
+	visited := make(map[[64]byte]struct{})
+	nodes := d.submitterTips(submitterId)
+	for len(nodes) > 0 {
+		id := nodes[0]
+		nodes = nodes[1:]
+		if _, seen := visited[id]; seen {
+			continue
+		}
+		visited[id] = struct{}{}
+		node := d.getSubmitterDagNode(id)
+		if node == nil {
+			continue
+		}
+		// a submitter may extend same transaction on different shards, but not twice on same shard
+		shards := make(map[string]struct{})
+		for _, child := range node.Children {
+			if tx := d.getTx(child); tx != nil {
+				if _, found := shards[string(tx.Request().ShardId)]; found {
+					forks = append(forks, *node)
+					break
+				}
+				shards[string(tx.Request().ShardId)] = struct{}{}
+			}
+		}
+		nodes = append(nodes, node.Parent)
+	}
+	sort.Slice(forks, func(i, j int) bool {
+		return forks[i].Depth < forks[j].Depth
+	})
+	return forks
+}
+
+// build submitter DAGs from existing submitter histories, for data created before submitter DAGs
+func migrateSubmitterDags(dbp db.DbProvider) error {
+	d := &dltDb{
+		txDb:            dbp.DB("dlt_transactions"),
+		submitterDAGsDb: dbp.DB("dlt_submitter_dags"),
+		submitterTipsDb: dbp.DB("dlt_submitter_tips"),
+	}
+	// add transactions in order of submitter seq, so that parents are added before children
+	txs := []dto.Transaction{}
+	for _, data := range dbp.DB("dlt_submitter_history").GetAll() {
+		history := &SubmitterHistory{}
+		if err := common.Deserialize(data, history); err != nil {
+			continue
+		}
+		for _, pair := range history.ShardTxPairs {
+			if tx := d.getTx(pair.TxId); tx != nil {
+				txs = append(txs, tx)
+			}
+		}
+	}
+	sort.SliceStable(txs, func(i, j int) bool {
+		return txs[i].Request().SubmitterSeq < txs[j].Request().SubmitterSeq
+	})
+	for _, tx := range txs {
+		if err := d.addSubmitterDagNode(tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
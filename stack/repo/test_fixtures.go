@@ -9,6 +9,8 @@ import (
 type MockDltDb struct {
 	GetTxCallCount               int
 	FlushShardCount              int
+	ResetShardCount              int
+	SeedShardCount               int
 	ReplaceSubmitterCount        int
 	AddTxCallCount               int
 	UpdateShardCount             int
@@ -19,9 +21,19 @@ type MockDltDb struct {
 	GetSubmitterDagNodeCallCount int
 	GetSubmitterHistoryCount     int
 	GetShardsCallCount           int
+	GetShardInfoCount            int
 	GetSubmittersCallCount       int
 	ShardTipsCallCount           int
 	SubmitterTipsCallCount       int
+	SubmitterAncestryCount       int
+	SubmitterForksCount          int
+	AddAnchorRecordCount         int
+	UpdateAnchorRecordCount      int
+	GetAnchorRecordsCount        int
+	GetAnchorMaxSeqCount         int
+	AddForensicRecordCount       int
+	GetForensicRecordsCount      int
+	BeginCount                   int
 	db                           DltDb
 }
 
@@ -35,6 +47,23 @@ func (d *MockDltDb) FlushShard(shardId []byte) error {
 	return d.db.FlushShard(shardId)
 }
 
+func (d *MockDltDb) SeedShard(genesis dto.Transaction, tips []dto.Transaction) error {
+	d.SeedShardCount += 1
+	return d.db.SeedShard(genesis, tips)
+}
+
+func (d *MockDltDb) SetCompression(codec int) error {
+	return d.db.SetCompression(codec)
+}
+
+func (d *MockDltDb) StorageStats() *StorageStats {
+	return d.db.StorageStats()
+}
+
+func (d *MockDltDb) DbSizes() map[string]uint64 {
+	return d.db.DbSizes()
+}
+
 func (d *MockDltDb) GetTx(id [64]byte) dto.Transaction {
 	d.GetTxCallCount += 1
 	return d.db.GetTx(id)
@@ -55,6 +84,35 @@ func (d *MockDltDb) UpdateSubmitter(tx dto.Transaction) error {
 	return d.db.UpdateSubmitter(tx)
 }
 
+func (d *MockDltDb) ResetShard(shardId []byte) error {
+	d.ResetShardCount += 1
+	return d.db.ResetShard(shardId)
+}
+
+func (d *MockDltDb) PruneShard(shardId []byte, ids [][64]byte) error {
+	return d.db.PruneShard(shardId, ids)
+}
+
+func (d *MockDltDb) PrunePayload(id [64]byte) (bool, error) {
+	return d.db.PrunePayload(id)
+}
+
+func (d *MockDltDb) PinTx(pin *Pin) error {
+	return d.db.PinTx(pin)
+}
+
+func (d *MockDltDb) UnpinTx(id [64]byte) error {
+	return d.db.UnpinTx(id)
+}
+
+func (d *MockDltDb) GetPin(id [64]byte) *Pin {
+	return d.db.GetPin(id)
+}
+
+func (d *MockDltDb) GetPins() []Pin {
+	return d.db.GetPins()
+}
+
 func (d *MockDltDb) DeleteTx(id [64]byte) error {
 	d.DeleteTxCallCount += 1
 	return d.db.DeleteTx(id)
@@ -65,22 +123,36 @@ func (d *MockDltDb) GetShardDagNode(id [64]byte) *DagNode {
 	return d.db.GetShardDagNode(id)
 }
 
-//
-//func (d *mockDb) GetSubmitterDagNode(id [64]byte) *DagNode {
-//	d.GetSubmitterDagNodeCallCount += 1
-//	return d.db.GetSubmitterDagNode(id)
-//}
+func (d *MockDltDb) GetSubmitterDagNode(id [64]byte) *DagNode {
+	d.GetSubmitterDagNodeCallCount += 1
+	return d.db.GetSubmitterDagNode(id)
+}
+
+func (d *MockDltDb) SubmitterAncestry(id [64]byte) []DagNode {
+	d.SubmitterAncestryCount += 1
+	return d.db.SubmitterAncestry(id)
+}
+
+func (d *MockDltDb) SubmitterForks(submitterId []byte) []DagNode {
+	d.SubmitterForksCount += 1
+	return d.db.SubmitterForks(submitterId)
+}
 
 func (d *MockDltDb) GetSubmitterHistory(id []byte, seq uint64) *SubmitterHistory {
 	d.GetSubmitterHistoryCount += 1
 	return d.db.GetSubmitterHistory(id, seq)
 }
 
-func (d *MockDltDb) GetShards() []byte {
+func (d *MockDltDb) GetShards() [][]byte {
 	d.GetShardsCallCount += 1
 	return d.db.GetShards()
 }
 
+func (d *MockDltDb) GetShardInfo(shardId []byte) *ShardInfo {
+	d.GetShardInfoCount += 1
+	return d.db.GetShardInfo(shardId)
+}
+
 func (d *MockDltDb) GetSubmitters() []byte {
 	d.GetSubmittersCallCount += 1
 	return d.db.GetSubmitters()
@@ -96,6 +168,41 @@ func (d *MockDltDb) SubmitterTips(submitterId []byte) []DagNode {
 	return d.db.SubmitterTips(submitterId)
 }
 
+func (d *MockDltDb) AddAnchorRecord(r *AnchorRecord) error {
+	d.AddAnchorRecordCount += 1
+	return d.db.AddAnchorRecord(r)
+}
+
+func (d *MockDltDb) UpdateAnchorRecord(r *AnchorRecord) error {
+	d.UpdateAnchorRecordCount += 1
+	return d.db.UpdateAnchorRecord(r)
+}
+
+func (d *MockDltDb) GetAnchorRecords(id []byte, seq uint64) []AnchorRecord {
+	d.GetAnchorRecordsCount += 1
+	return d.db.GetAnchorRecords(id, seq)
+}
+
+func (d *MockDltDb) GetAnchorMaxSeq(id []byte) uint64 {
+	d.GetAnchorMaxSeqCount += 1
+	return d.db.GetAnchorMaxSeq(id)
+}
+
+func (d *MockDltDb) AddForensicRecord(r *ForensicRecord) error {
+	d.AddForensicRecordCount += 1
+	return d.db.AddForensicRecord(r)
+}
+
+func (d *MockDltDb) GetForensicRecords() []ForensicRecord {
+	d.GetForensicRecordsCount += 1
+	return d.db.GetForensicRecords()
+}
+
+func (d *MockDltDb) Begin() Batch {
+	d.BeginCount += 1
+	return d.db.Begin()
+}
+
 func (d *MockDltDb) Reset() {
 	*d = MockDltDb{db: d.db}
 }
@@ -0,0 +1,45 @@
+// Copyright 2019 The trust-net Authors
+// Per shard retention policies, pruning shards' history as they move into new epochs
+package stack
+
+import (
+	"encoding/hex"
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+)
+
+func (d *dlt) SetRetention(policy *shard.Retention) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.SetRetention(policy)
+}
+
+func (d *dlt) PruneShard(shardId []byte) (*shard.PruneReport, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.sharder.Prune(shardId)
+}
+
+// prune a shard as per its retention policy once an accepted transaction starts a new epoch of shard's history
+func (d *dlt) pruneOnEpoch(tx dto.Transaction) {
+	if shard.EpochLength == 0 || (tx.Anchor().ShardSeq-1)%shard.EpochLength != 0 {
+		return
+	}
+	if _, err := d.sharder.Prune(tx.Request().ShardId); err != nil {
+		d.logger.Error("Failed to prune shard %x: %s", tx.Request().ShardId, err)
+	}
+}
+
+// decode a shard's retention policy from its config
+func parseRetention(c p2p.Retention) (*shard.Retention, error) {
+	policy := &shard.Retention{
+		Policy: c.Policy,
+		Epochs: c.Epochs,
+	}
+	if policy.ShardId, _ = hex.DecodeString(c.ShardId); len(policy.ShardId) == 0 {
+		return nil, errors.New("invalid shard_id for retention policy")
+	}
+	return policy, nil
+}
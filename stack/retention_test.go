@@ -0,0 +1,39 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+)
+
+// shard should be pruned as per its retention policy once it moves into a new epoch
+func TestPruneOnEpoch(t *testing.T) {
+	defer func(length uint64) { shard.EpochLength = length }(shard.EpochLength)
+	shard.EpochLength = 2
+	stack, sharder, _, _ := initMocks()
+	if err := stack.SetRetention(&shard.Retention{ShardId: stack.app.ShardId, Policy: shard.RETAIN_PAYLOADS, Epochs: 1}); err != nil {
+		t.Fatalf("failed to set retention policy: %s", err)
+	}
+	submitter := dto.TestSubmitter()
+	txs := []dto.Transaction{}
+	for i := 0; i < 3; i++ {
+		if i == 2 && len(stack.db.GetTx(txs[0].Id()).Request().Payload) == 0 {
+			t.Errorf("shard pruned before moving into new epoch")
+		}
+		tx, err := stack.Submit(submitter.NewRequest("test payload"))
+		if err != nil {
+			t.Fatalf("submission failed: %s", err)
+		}
+		txs = append(txs, tx)
+		submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+	}
+	if !sharder.PruneCalled {
+		t.Errorf("shard not pruned on new epoch")
+	}
+	for i, tx := range txs {
+		if pruned := len(stack.db.GetTx(tx.Id()).Request().Payload) == 0; pruned != (i < 2) {
+			t.Errorf("incorrect payload pruning of transaction %d: %v", i, pruned)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The trust-net Authors
+// Trusted checkpoints for bootstrapping a shard's history
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"sync"
+)
+
+// a trusted (out of band) point in a shard's history, any history conflicting with it is refused
+type Checkpoint struct {
+	// shard of the checkpoint
+	ShardId []byte
+	// ID of the trusted transaction in shard's DAG
+	TxId [64]byte
+	// shard sequence of the trusted transaction
+	Seq uint64
+	// root of shard's world state after the trusted transaction (zero value skips state verification)
+	StateRoot [64]byte
+}
+
+// registry of trusted checkpoints per shard
+type checkpoints struct {
+	shards map[string]*Checkpoint
+	lock   sync.RWMutex
+}
+
+func newCheckpoints() *checkpoints {
+	return &checkpoints{
+		shards: make(map[string]*Checkpoint),
+	}
+}
+
+func (c *checkpoints) set(cp *Checkpoint) error {
+	if cp == nil || len(cp.ShardId) == 0 {
+		return fmt.Errorf("missing shard id for checkpoint")
+	}
+	if cp.Seq < ShardSeqOne {
+		return fmt.Errorf("invalid shard seq for checkpoint")
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shards[string(cp.ShardId)] = cp
+	return nil
+}
+
+func (c *checkpoints) get(shardId []byte) *Checkpoint {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.shards[string(shardId)]
+}
+
+// validate a network transaction against the shard's trusted checkpoint,
+// reached indicates whether checkpoint transaction is already part of local shard DAG
+func (cp *Checkpoint) validate(tx dto.Transaction, reached bool) error {
+	seq := tx.Anchor().ShardSeq
+	switch {
+	case seq == cp.Seq && tx.Id() != cp.TxId:
+		return fmt.Errorf("transaction conflicts with trusted checkpoint")
+	case seq < cp.Seq && reached:
+		return fmt.Errorf("transaction below trusted checkpoint")
+	case seq > cp.Seq && !reached:
+		return fmt.Errorf("trusted checkpoint not reached")
+	}
+	return nil
+}
+
+// verify world state after checkpoint transaction has been processed by app
+func (cp *Checkpoint) verifyState(s state.State) error {
+	if cp.StateRoot == [64]byte{} {
+		return nil
+	}
+	if root, err := s.Root(); err != nil {
+		return err
+	} else if root != cp.StateRoot {
+		return fmt.Errorf("world state root mismatch at trusted checkpoint")
+	}
+	return nil
+}
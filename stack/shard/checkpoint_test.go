@@ -0,0 +1,94 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// test that a transaction conflicting with checkpoint is refused
+func TestCheckpoint_Conflict(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	tx, _ := SignedShardTransaction("test payload")
+	if err := s.SetCheckpoint(&Checkpoint{ShardId: tx.Request().ShardId, TxId: dto.RandomHash(), Seq: ShardSeqOne}); err != nil {
+		t.Errorf("failed to set checkpoint: %s", err)
+	}
+	if err := s.Handle(tx); err == nil {
+		t.Errorf("transaction conflicting with checkpoint should be refused")
+	}
+}
+
+// test that transaction matching checkpoint is accepted, and history below checkpoint is refused afterwards
+func TestCheckpoint_Match(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	tx, _ := SignedShardTransaction("test payload")
+	s.SetCheckpoint(&Checkpoint{ShardId: tx.Request().ShardId, TxId: tx.Id(), Seq: ShardSeqOne})
+	if err := s.Handle(tx); err != nil {
+		t.Errorf("transaction matching checkpoint should be accepted: %s", err)
+	}
+	testDb.AddTx(tx)
+	testDb.UpdateShard(tx)
+
+	// a child of checkpoint is above checkpoint
+	child, _ := SignedShardTransaction("child payload")
+	child.Anchor().ShardSeq = ShardSeqOne + 1
+	child.Anchor().ShardParent = tx.Id()
+	if err := s.Handle(child); err != nil {
+		t.Errorf("transaction above checkpoint should be accepted: %s", err)
+	}
+
+	// a sibling of checkpoint is conflicting history
+	sibling, _ := SignedShardTransaction("sibling payload")
+	if err := s.Handle(sibling); err == nil {
+		t.Errorf("transaction conflicting with checkpoint should be refused")
+	}
+}
+
+// test that transactions above checkpoint are refused until checkpoint is reached
+func TestCheckpoint_NotReached(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	tx, _ := SignedShardTransaction("test payload")
+	s.SetCheckpoint(&Checkpoint{ShardId: tx.Request().ShardId, TxId: dto.RandomHash(), Seq: 5})
+	tx.Anchor().ShardSeq = 6
+	if err := s.Handle(tx); err == nil {
+		t.Errorf("transaction above unreached checkpoint should be refused")
+	}
+}
+
+// test that world state is verified at checkpoint
+func TestCheckpoint_StateRoot(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	tx, _ := SignedShardTransaction("test payload")
+	s.Register(tx.Request().ShardId, func(tx dto.Transaction, ws state.State) error {
+		return ws.Put(&state.Resource{Key: []byte("key"), Value: []byte("value")})
+	})
+	s.SetCheckpoint(&Checkpoint{ShardId: tx.Request().ShardId, TxId: tx.Id(), Seq: ShardSeqOne, StateRoot: dto.RandomHash()})
+
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); err == nil {
+		t.Errorf("transaction with mismatched state root should be refused")
+	}
+}
+
+// test checkpoint validation
+func TestSetCheckpoint_Invalid(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	if err := s.SetCheckpoint(&Checkpoint{TxId: dto.RandomHash(), Seq: 1}); err == nil {
+		t.Errorf("checkpoint without shard should be refused")
+	}
+	if err := s.SetCheckpoint(&Checkpoint{ShardId: []byte("test shard"), TxId: dto.RandomHash()}); err == nil {
+		t.Errorf("checkpoint at genesis should be refused")
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 The trust-net Authors
+// Deterministic resolution of conflicting transactions on a shard, rolling back the losing sub-DAG
+package shard
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+)
+
+// outcome of a conflict resolution
+type Resolution struct {
+	// transaction that won the conflict, and the one that lost
+	Winner [64]byte
+	Loser  [64]byte
+	// local transaction lost, and its sub-DAG was rolled back
+	LocalLost bool
+	// transactions removed from shard DAG (losing transaction and its descendants, through parent or uncle
+	// references), in canonical order
+	Pruned [][64]byte
+	// transactions replayed to app after rollback (transactions at or above losing transaction's
+	// sequence that do not descend from it), in canonical order
+	Replayed [][64]byte
+}
+
+// check if a transaction wins over a competing transaction of same submitter, sequence and shard: transaction
+// with lower anchor weight (i.e. anchored earlier on shard) wins, with equal weights the one with lower numeric
+// ID, and then lower ID, so that all nodes pick same winner
+func Wins(tx, competing dto.Transaction) bool {
+	if tx.Anchor().Weight != competing.Anchor().Weight {
+		return tx.Anchor().Weight < competing.Anchor().Weight
+	}
+	txId, competingId := tx.Id(), competing.Id()
+	if Numeric(txId[:]) != Numeric(competingId[:]) {
+		return Numeric(txId[:]) < Numeric(competingId[:])
+	}
+	return bytes.Compare(txId[:], competingId[:]) <= 0
+}
+
+// check if a transaction references any of the specified transactions as its parent or an uncle
+func descendsFrom(tx dto.Transaction, ids map[[64]byte]bool) bool {
+	if ids[tx.Anchor().ShardParent] {
+		return true
+	}
+	for _, uncle := range tx.Anchor().ShardUncles {
+		if ids[uncle] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *sharder) Resolve(local, competing dto.Transaction) (*Resolution, error) {
+	req, other := local.Request(), competing.Request()
+	if local.Id() == competing.Id() || string(req.SubmitterId) != string(other.SubmitterId) ||
+		req.SubmitterSeq != other.SubmitterSeq || string(req.ShardId) != string(other.ShardId) {
+		return nil, fmt.Errorf("transactions are not in conflict")
+	}
+	if Wins(local, competing) {
+		return &Resolution{Winner: local.Id(), Loser: competing.Id()}, nil
+	}
+	genesis := s.db.GetShardDagNode(GenesisShardTx(req.ShardId).Id())
+	if genesis == nil {
+		return nil, fmt.Errorf("unknown shard")
+	} else if s.db.GetShardDagNode(local.Id()) == nil {
+		return nil, fmt.Errorf("local transaction not in shard DAG")
+	}
+	app := s.app(req.ShardId)
+	if app != nil && app.worldState == nil {
+		return nil, fmt.Errorf("world state not locked")
+	} else if app != nil && app.appTxHandler == nil {
+		// transactions cannot be replayed to a paused app
+		return nil, fmt.Errorf("app paused")
+	}
+
+	// collect transactions at or above losing transaction's sequence, these are rolled back
+	seq := local.Anchor().ShardSeq
+	rolledBack := []dto.Transaction{}
+	if err := s.walkShard(genesis, func(node *repo.DagNode, tx dto.Transaction) (bool, error) {
+		if tx.Anchor().ShardSeq >= seq {
+			rolledBack = append(rolledBack, tx)
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+	// mark losing transaction's descendants, through parent as well as uncle references (repeated until no
+	// more are marked, since an uncle may be walked after the transaction referencing it)
+	losing := map[[64]byte]bool{local.Id(): true}
+	for marked := true; marked; {
+		marked = false
+		for _, tx := range rolledBack {
+			if !losing[tx.Id()] && descendsFrom(tx, losing) {
+				losing[tx.Id()] = true
+				marked = true
+			}
+		}
+	}
+	res := &Resolution{Winner: competing.Id(), Loser: local.Id(), LocalLost: true}
+	for _, tx := range rolledBack {
+		if losing[tx.Id()] {
+			res.Pruned = append(res.Pruned, tx.Id())
+		}
+	}
+
+	// roll back world state of registered app, latest transaction first
+	if app != nil && app.undoHandler != nil {
+		for i := len(rolledBack) - 1; i >= 0; i-- {
+			if err := app.undoHandler(rolledBack[i], app.worldState); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if app != nil && !app.externalState {
+		if err := app.worldState.Rollback(seq - 1); err != nil {
+			return nil, err
+		}
+	}
+
+	// remove losing sub-DAG from shard DAG
+	if err := s.db.PruneShard(req.ShardId, res.Pruned); err != nil {
+		return nil, err
+	}
+	if app == nil {
+		return res, nil
+	}
+
+	// replay remaining transactions to app, in canonical order
+	app.worldState.Applied(local.Anchor().ShardParent, seq-1)
+	for _, tx := range rolledBack {
+		if losing[tx.Id()] {
+			continue
+		}
+		if err := s.applyTx(app, tx, app.worldState); err != nil && ErrorCode(err) != ERR_INVALID_TX {
+			return nil, err
+		}
+		res.Replayed = append(res.Replayed, tx.Id())
+	}
+	if err := app.worldState.Persist(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
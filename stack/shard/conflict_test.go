@@ -0,0 +1,143 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// build a shard where a local transaction at seq 2 has a sibling and a child, along with a competing
+// transaction of same submitter and sequence anchored with a lower weight
+func setupConflictShard(undone *[]dto.Transaction) (*sharder, []dto.Transaction, dto.Transaction) {
+	undoHandler := func(tx dto.Transaction, s state.State) error {
+		*undone = append(*undone, tx)
+		return nil
+	}
+	s, chain := setupChainShard(1, chainTestHandler(""), &RegisterOptions{UndoHandler: undoHandler})
+	tx1 := chain[0]
+	submitter := dto.TestSubmitter()
+	local := submitter.NewTransaction(&dto.Anchor{NodeId: []byte("local node"), ShardParent: tx1.Id(), ShardSeq: 2, Weight: 3}, "local")
+	competing := submitter.NewTransaction(&dto.Anchor{NodeId: []byte("remote node"), ShardParent: tx1.Id(), ShardSeq: 2, Weight: 2}, "remote")
+	sibling := dto.TestSignedTransaction("sibling")
+	sibling.Anchor().ShardParent, sibling.Anchor().ShardSeq, sibling.Anchor().Weight = tx1.Id(), 2, 3
+	child := dto.TestSignedTransaction("child")
+	child.Anchor().ShardParent, child.Anchor().ShardSeq, child.Anchor().Weight = local.Id(), 3, 4
+	for _, tx := range []dto.Transaction{local, sibling, child} {
+		addLogTx(s, tx)
+	}
+	return s, []dto.Transaction{tx1, local, sibling, child}, competing
+}
+
+func TestWins(t *testing.T) {
+	tx1, tx2 := dto.TestSignedTransaction("tx 1"), dto.TestSignedTransaction("tx 2")
+	tx1.Anchor().Weight, tx2.Anchor().Weight = 2, 3
+	if !Wins(tx1, tx2) || Wins(tx2, tx1) {
+		t.Errorf("transaction with lower weight should win")
+	}
+	// with equal weights exactly one of the transactions should win
+	tx2.Anchor().Weight = 2
+	if Wins(tx1, tx2) == Wins(tx2, tx1) {
+		t.Errorf("tie break is not deterministic")
+	}
+}
+
+// a local transaction losing the conflict should be rolled back along with its descendants, and the rest replayed
+func TestResolve_LocalLost(t *testing.T) {
+	undone := []dto.Transaction{}
+	s, txs, competing := setupConflictShard(&undone)
+	tx1, local, sibling, child := txs[0], txs[1], txs[2], txs[3]
+	s.LockState()
+	res, err := s.Resolve(local, competing)
+	s.UnlockState()
+	if err != nil {
+		t.Fatalf("conflict resolution failed: %s", err)
+	}
+	if !res.LocalLost || res.Winner != competing.Id() || res.Loser != local.Id() {
+		t.Errorf("incorrect resolution: %+v", res)
+	}
+	if len(res.Pruned) != 2 || len(res.Replayed) != 1 || res.Replayed[0] != sibling.Id() {
+		t.Errorf("incorrect pruned/replayed transactions: %d/%d", len(res.Pruned), len(res.Replayed))
+	}
+	// undo handler should be called for all rolled back transactions, latest first
+	if len(undone) != 3 || undone[0].Id() != child.Id() {
+		t.Errorf("incorrect undo handler calls: %d", len(undone))
+	}
+	// losing sub-DAG should be removed from shard DAG
+	if s.db.GetShardDagNode(local.Id()) != nil || s.db.GetShardDagNode(child.Id()) != nil {
+		t.Errorf("losing sub-DAG not pruned")
+	}
+	if s.db.GetShardDagNode(sibling.Id()) == nil {
+		t.Errorf("sibling removed from shard DAG")
+	}
+	// world state should only have resources of surviving transactions
+	for _, tx := range []dto.Transaction{tx1, sibling} {
+		if _, err := s.GetState(tx.Request().Payload); err != nil {
+			t.Errorf("missing resource of surviving transaction %s: %s", tx.Request().Payload, err)
+		}
+	}
+	for _, tx := range []dto.Transaction{local, child} {
+		if _, err := s.GetState(tx.Request().Payload); err == nil {
+			t.Errorf("resource of rolled back transaction %s still in world state", tx.Request().Payload)
+		}
+	}
+}
+
+// a transaction referencing losing transaction only as an uncle should be rolled back along with losing transaction
+func TestResolve_LocalLostUncle(t *testing.T) {
+	undone := []dto.Transaction{}
+	s, txs, competing := setupConflictShard(&undone)
+	local, sibling, child := txs[1], txs[2], txs[3]
+	nephew := dto.TestSignedTransaction("nephew")
+	nephew.Anchor().ShardParent, nephew.Anchor().ShardSeq, nephew.Anchor().Weight = sibling.Id(), 3, 7
+	nephew.Anchor().ShardUncles = [][64]byte{local.Id()}
+	addLogTx(s, nephew)
+	s.LockState()
+	res, err := s.Resolve(local, competing)
+	s.UnlockState()
+	if err != nil {
+		t.Fatalf("conflict resolution failed: %s", err)
+	}
+	if len(res.Pruned) != 3 || len(res.Replayed) != 1 || res.Replayed[0] != sibling.Id() {
+		t.Errorf("incorrect pruned/replayed transactions: %d/%d", len(res.Pruned), len(res.Replayed))
+	}
+	for _, tx := range []dto.Transaction{local, child, nephew} {
+		if s.db.GetShardDagNode(tx.Id()) != nil {
+			t.Errorf("transaction %s not pruned", tx.Request().Payload)
+		}
+	}
+	if _, err := s.GetState(nephew.Request().Payload); err == nil {
+		t.Errorf("resource of nephew still in world state")
+	}
+	if tips := s.db.ShardTips(local.Request().ShardId); len(tips) != 1 || tips[0] != sibling.Id() {
+		t.Errorf("incorrect tips after resolution: %d", len(tips))
+	}
+}
+
+// a local transaction winning the conflict should not change shard
+func TestResolve_LocalWon(t *testing.T) {
+	undone := []dto.Transaction{}
+	s, txs, competing := setupConflictShard(&undone)
+	local := txs[1]
+	competing.Anchor().Weight = 4
+	s.LockState()
+	res, err := s.Resolve(local, competing)
+	s.UnlockState()
+	if err != nil || res.LocalLost || res.Winner != local.Id() {
+		t.Errorf("incorrect resolution: %+v, %s", res, err)
+	}
+	if len(undone) != 0 || s.db.GetShardDagNode(local.Id()) == nil {
+		t.Errorf("shard changed when local transaction won")
+	}
+}
+
+// transactions that are not in conflict should not be resolved
+func TestResolve_NotInConflict(t *testing.T) {
+	undone := []dto.Transaction{}
+	s, txs, _ := setupConflictShard(&undone)
+	s.LockState()
+	defer s.UnlockState()
+	if _, err := s.Resolve(txs[1], txs[2]); err == nil {
+		t.Errorf("expected transactions from different submitters to fail resolution")
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+)
+
+// handler writing transaction's payload (with a suffix) as value of a counter and of a per transaction key,
+// and deleting key of 2nd transaction with 3rd transaction
+func chainTestHandler(suffix string) func(tx dto.Transaction, s state.State) error {
+	return func(tx dto.Transaction, s state.State) error {
+		if string(tx.Request().Payload) == "value 3" {
+			if err := s.Delete([]byte("value 2")); err != nil {
+				return err
+			}
+		}
+		value := append(tx.Request().Payload, []byte(suffix)...)
+		if err := s.Put(&state.Resource{Key: []byte("counter"), Value: value}); err != nil {
+			return err
+		}
+		return s.Put(&state.Resource{Key: tx.Request().Payload, Value: value})
+	}
+}
+
+// chain of transactions of a shard with payloads "value 1", "value 2", ..., first one over shard's genesis
+// and each after it child of previous one
+func chainTestTxs(count int) []dto.Transaction {
+	txs := make([]dto.Transaction, count)
+	txs[0], _ = SignedShardTransaction("value 1")
+	for i := 1; i < count; i++ {
+		txs[i] = dto.TestSignedTransaction(fmt.Sprintf("value %d", i+1))
+		txs[i].Anchor().ShardParent, txs[i].Anchor().ShardSeq = txs[i-1].Id(), uint64(i+1)
+	}
+	return txs
+}
+
+// add a network transaction to sharder's shard DAG, world state is committed only if transaction is handled
+func addLogTx(s *sharder, tx dto.Transaction) error {
+	s.db.AddTx(tx)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); err != nil {
+		return err
+	}
+	return s.CommitState(tx)
+}
+
+// build a sharder with a chain of transactions on a shard (see chainTestTxs), with app registered for shard
+// using specified handler and options before transactions are added (shard is not registered for nil handler)
+func setupChainShard(count int, txHandler func(tx dto.Transaction, s state.State) error, opts *RegisterOptions) (*sharder, []dto.Transaction) {
+	log.SetLogLevel(log.NONE)
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	txs := chainTestTxs(count)
+	if txHandler != nil {
+		s.RegisterWithOptions(txs[0].Request().ShardId, txHandler, opts)
+	}
+	for _, tx := range txs {
+		addLogTx(s, tx)
+	}
+	return s, txs
+}
@@ -0,0 +1,120 @@
+// Copyright 2019 The trust-net Authors
+// Error taxonomy for application transaction handlers
+package shard
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	HANDLER_OK int = iota
+	// error not classified by app, treated same as before taxonomy was introduced
+	ERR_UNCLASSIFIED
+	// transient failure, sharder will re-attempt the transaction with backoff
+	ERR_RETRYABLE
+	// transaction is permanently invalid for app, sharder will dead-letter it
+	ERR_INVALID_TX
+	// app failed internally, sharder will raise an alert
+	ERR_INTERNAL
+)
+
+// max number of re-attempts for a retryable handler error
+var HandlerRetryLimit = 3
+
+// initial backoff between re-attempts, doubled after every attempt
+var HandlerRetryBackoff = 10 * time.Millisecond
+
+// time taken by app's transaction handler on a transaction beyond which handler is reported as slow, 0 to disable
+var SlowHandlerThreshold = time.Second
+
+// max number of dead letters retained per shard
+var DeadLetterLimit = 1000
+
+// classified error returned by app's transaction handler
+type HandlerError struct {
+	Code int
+	Err  error
+}
+
+func (e *HandlerError) Error() string {
+	switch e.Code {
+	case ERR_RETRYABLE:
+		return fmt.Sprintf("retryable: %s", e.Err)
+	case ERR_INVALID_TX:
+		return fmt.Sprintf("invalid transaction: %s", e.Err)
+	case ERR_INTERNAL:
+		return fmt.Sprintf("internal error: %s", e.Err)
+	default:
+		return e.Err.Error()
+	}
+}
+
+// wrap an error as transient failure that should be re-attempted
+func Retryable(err error) error {
+	return &HandlerError{Code: ERR_RETRYABLE, Err: err}
+}
+
+// wrap an error as permanent rejection of the transaction
+func InvalidTx(err error) error {
+	return &HandlerError{Code: ERR_INVALID_TX, Err: err}
+}
+
+// wrap an error as internal failure of the app
+func InternalError(err error) error {
+	return &HandlerError{Code: ERR_INTERNAL, Err: err}
+}
+
+// get the classification code for an error returned by app's transaction handler
+func ErrorCode(err error) int {
+	if err == nil {
+		return HANDLER_OK
+	} else if herr, ok := err.(*HandlerError); ok {
+		return herr.Code
+	}
+	return ERR_UNCLASSIFIED
+}
+
+// a transaction rejected permanently by app's transaction handler
+type DeadLetter struct {
+	TxId    [64]byte
+	ShardId []byte
+	Reason  string
+	// unix time (seconds) when transaction was dead-lettered
+	Time int64
+}
+
+// collector of dead-lettered transactions per shard
+type deadLetters struct {
+	shards map[string][]DeadLetter
+	lock   sync.RWMutex
+}
+
+func newDeadLetters() *deadLetters {
+	return &deadLetters{
+		shards: make(map[string][]DeadLetter),
+	}
+}
+
+func (d *deadLetters) add(txId [64]byte, shardId []byte, reason error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	letters := append(d.shards[string(shardId)], DeadLetter{
+		TxId:    txId,
+		ShardId: shardId,
+		Reason:  reason.Error(),
+		Time:    time.Now().Unix(),
+	})
+	// drop oldest entries beyond limit
+	if len(letters) > DeadLetterLimit {
+		letters = letters[len(letters)-DeadLetterLimit:]
+	}
+	d.shards[string(shardId)] = letters
+}
+
+func (d *deadLetters) get(shardId []byte) []DeadLetter {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	return append([]DeadLetter{}, d.shards[string(shardId)]...)
+}
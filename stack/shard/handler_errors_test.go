@@ -0,0 +1,185 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+func TestErrorCode(t *testing.T) {
+	if ErrorCode(nil) != HANDLER_OK {
+		t.Errorf("incorrect code for nil error")
+	}
+	if ErrorCode(errors.New("plain")) != ERR_UNCLASSIFIED {
+		t.Errorf("incorrect code for plain error")
+	}
+	if ErrorCode(Retryable(errors.New("busy"))) != ERR_RETRYABLE {
+		t.Errorf("incorrect code for retryable error")
+	}
+	if ErrorCode(InvalidTx(errors.New("bad"))) != ERR_INVALID_TX {
+		t.Errorf("incorrect code for invalid tx error")
+	}
+	if err := InternalError(errors.New("oops")); ErrorCode(err) != ERR_INTERNAL || err.Error() != "internal error: oops" {
+		t.Errorf("incorrect internal error: %s", err)
+	}
+}
+
+func TestHandlerError_RetryableSucceeds(t *testing.T) {
+	HandlerRetryBackoff = time.Millisecond
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	// handler fails twice with retryable error before succeeding
+	attempts := 0
+	txHandler := func(tx dto.Transaction, state state.State) error {
+		attempts += 1
+		if attempts < 3 {
+			return Retryable(errors.New("busy"))
+		}
+		return nil
+	}
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); err != nil {
+		t.Errorf("retryable error was not re-attempted: %s", err)
+	}
+	if attempts != 3 {
+		t.Errorf("incorrect number of attempts: %d", attempts)
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats.HandlerRetries != 2 {
+		t.Errorf("incorrect retry count: %d", stats.HandlerRetries)
+	}
+}
+
+func TestHandlerError_RetryableExhausted(t *testing.T) {
+	HandlerRetryBackoff = time.Millisecond
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	attempts := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { attempts += 1; return Retryable(errors.New("busy")) }
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); ErrorCode(err) != ERR_RETRYABLE {
+		t.Errorf("exhausted retries should return retryable error: %s", err)
+	}
+	if attempts != HandlerRetryLimit+1 {
+		t.Errorf("incorrect number of attempts: %d", attempts)
+	}
+}
+
+func TestHandlerError_InvalidTxDeadLettered(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	attempts := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { attempts += 1; return InvalidTx(errors.New("bad")) }
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); ErrorCode(err) != ERR_INVALID_TX {
+		t.Errorf("invalid transaction error not returned: %s", err)
+	}
+	if attempts != 1 {
+		t.Errorf("invalid transaction should not be re-attempted: %d", attempts)
+	}
+	if letters := s.DeadLetters(tx.Request().ShardId); len(letters) != 1 || letters[0].TxId != tx.Id() {
+		t.Errorf("transaction not dead-lettered: %v", letters)
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats.DeadLettered != 1 {
+		t.Errorf("incorrect dead letter count: %d", stats.DeadLettered)
+	}
+}
+
+func TestHandlerError_InternalError(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	txHandler := func(tx dto.Transaction, state state.State) error { return InternalError(errors.New("oops")) }
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); ErrorCode(err) != ERR_INTERNAL {
+		t.Errorf("internal error not returned: %s", err)
+	}
+	if len(s.DeadLetters(tx.Request().ShardId)) != 0 {
+		t.Errorf("internal error should not dead-letter transaction")
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats.InternalErrors != 1 {
+		t.Errorf("incorrect internal error count: %d", stats.InternalErrors)
+	}
+}
+
+func TestHandlerError_PanicRecovered(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	txHandler := func(tx dto.Transaction, state state.State) error { panic("oops") }
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx); ErrorCode(err) != ERR_INTERNAL {
+		t.Errorf("panic not converted to internal error: %s", err)
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats.HandlerPanics != 1 || stats.InternalErrors != 1 {
+		t.Errorf("incorrect panic count: %d, %d", stats.HandlerPanics, stats.InternalErrors)
+	}
+	// a handler running with deadline should also be recovered
+	s.app(tx.Request().ShardId).handlerTimeout = time.Second
+	tx2, _ := SignedShardTransaction("test payload")
+	if err := s.Handle(tx2); ErrorCode(err) != ERR_INTERNAL {
+		t.Errorf("panic not converted to internal error: %s", err)
+	}
+}
+
+func TestHandlerError_TimeoutAndSlow(t *testing.T) {
+	defer func(threshold time.Duration) { SlowHandlerThreshold = threshold }(SlowHandlerThreshold)
+	SlowHandlerThreshold = 5 * time.Millisecond
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	delay := 20 * time.Millisecond
+	txHandler := func(tx dto.Transaction, state state.State) error { time.Sleep(delay); return nil }
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	if err := s.Handle(tx); err != nil {
+		t.Errorf("slow handler failed: %s", err)
+	}
+	s.UnlockState()
+	if stats := s.Stats(tx.Request().ShardId); stats.SlowHandlers != 1 || stats.HandlerTimeouts != 0 {
+		t.Errorf("incorrect slow handler count: %d, %d", stats.SlowHandlers, stats.HandlerTimeouts)
+	}
+	tx2, _ := SignedShardTransaction("test payload")
+	s.app(tx.Request().ShardId).handlerTimeout = time.Millisecond
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Handle(tx2); ErrorCode(err) != ERR_INTERNAL {
+		t.Errorf("timeout not reported as internal error: %s", err)
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats.HandlerTimeouts != 1 || stats.InternalErrors != 1 {
+		t.Errorf("incorrect timeout count: %d, %d", stats.HandlerTimeouts, stats.InternalErrors)
+	}
+}
+
+func TestHandlerError_ReplaySkipsInvalidTx(t *testing.T) {
+	s, tx := setupReplayShard()
+
+	// invalid transaction during replay should not fail registration
+	txHandler := func(tx dto.Transaction, state state.State) error { return InvalidTx(errors.New("bad")) }
+	if err := s.Register(tx.Request().ShardId, txHandler); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if s.app(tx.Request().ShardId) == nil {
+		t.Errorf("App should remain registered")
+	}
+	if len(s.DeadLetters(tx.Request().ShardId)) != 1 {
+		t.Errorf("replayed transaction not dead-lettered")
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2019 The trust-net Authors
+// Replacement of a registered shard's transaction handler at runtime, with optional verification against current state
+package shard
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+)
+
+// error returned when a replacement transaction handler does not reproduce shard's current state
+var ErrHandlerMismatch = fmt.Errorf("replacement handler does not reproduce current state")
+
+// outcome of verifying a replacement transaction handler
+type SwapReport struct {
+	ShardId []byte
+	// number of most recent transactions re-applied with replacement handler (0 when not verified)
+	Verified int
+	// shard sequence verification started from, i.e. state as of previous sequence was used as base
+	FromSeq uint64
+	// number of re-applied transactions that replacement handler failed
+	Failed int
+	// keys of resources whose value from replacement handler differs from current state
+	Mismatched [][]byte
+}
+
+// a transaction in the window of most recent transactions of a shard
+type swapWindowTx struct {
+	depth uint64
+	tx    dto.Transaction
+}
+
+func (s *sharder) SwapHandler(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, verify int) (*SwapReport, error) {
+	app := s.app(shardId)
+	if app == nil || app.appTxHandler == nil {
+		return nil, fmt.Errorf("shard not registered")
+	} else if txHandler == nil {
+		return nil, fmt.Errorf("nil transaction handler")
+	}
+	report := &SwapReport{ShardId: shardId, Mismatched: [][]byte{}}
+	if verify > 0 {
+		if app.externalState {
+			return nil, fmt.Errorf("cannot verify handler of externally managed state")
+		}
+		if err := s.verifyHandler(app, txHandler, verify, report); err != nil {
+			return report, err
+		}
+	}
+	app.appTxHandler = txHandler
+	s.logger.Info("Swapped transaction handler of shard %x, verified over %d transactions", shardId, report.Verified)
+	return report, nil
+}
+
+// re-apply most recent transactions of a shard with replacement handler, over shard's state before those
+// transactions, and compare the outcome with current state
+func (s *sharder) verifyHandler(app *shardApp, txHandler func(tx dto.Transaction, state state.State) error, count int, report *SwapReport) error {
+	genesis := s.db.GetShardDagNode(GenesisShardTx(app.shardId).Id())
+	if genesis == nil {
+		return fmt.Errorf("unknown shard")
+	}
+	// collect at least count most recent transactions in canonical order, along with all transactions at the
+	// first sequence collected, since resources' history is kept per sequence
+	window := []swapWindowTx{}
+	if err := s.walkShard(genesis, func(node *repo.DagNode, tx dto.Transaction) (bool, error) {
+		window = append(window, swapWindowTx{depth: node.Depth, tx: tx})
+		for len(window) > count && window[0].depth < window[len(window)-count].depth {
+			window = window[1:]
+		}
+		return true, nil
+	}); err != nil {
+		return err
+	}
+	if len(window) == 0 {
+		return nil
+	}
+	current, err := s.newWorldState(app.shardId)
+	if err != nil {
+		return err
+	}
+	report.FromSeq = window[0].depth
+	verifier := newVerifyState(current, report.FromSeq-1)
+	for _, w := range window {
+		report.Verified += 1
+		if IsNodeTx(w.tx) {
+			continue
+		}
+		txId := w.tx.Id()
+		verifier.SetCurrent(txId, w.tx.Anchor().ShardSeq)
+		if err := s.runAppTxHandler(txHandler, w.tx, verifier); err != nil {
+			// dead-lettered transactions are expected to fail, as long as state matches
+			report.Failed += 1
+			verifier.discard()
+		} else {
+			verifier.commit()
+		}
+	}
+	// compare resources updated by replacement handler, and resources updated in current state since base
+	keys := verifier.updated()
+	for _, key := range current.Keys(nil) {
+		if _, found := verifier.writes[string(key)]; !found {
+			before, _ := current.GetAt(key, report.FromSeq-1)
+			after, _ := current.Get(key)
+			if !sameResource(before, after) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		expected, _ := current.Get(key)
+		actual, _ := verifier.Get(key)
+		if !sameResource(expected, actual) {
+			report.Mismatched = append(report.Mismatched, key)
+		}
+	}
+	if len(report.Mismatched) > 0 {
+		return ErrHandlerMismatch
+	}
+	return nil
+}
+
+func sameResource(a, b *state.Resource) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return bytes.Equal(a.Owner, b.Owner) && bytes.Equal(a.Value, b.Value)
+}
+
+// world state seen by a replacement handler during verification, reading resources as of a shard sequence
+// (so history must not be pruned past it) and keeping updates in memory, resource scans and history are
+// not supported
+type verifyState struct {
+	base state.State
+	seq  uint64
+	// read resources from base's current state instead of as of sequence
+	current bool
+	writes  map[string]*state.Resource
+	pending map[string]*state.Resource
+	// transaction being re-applied, and its shard sequence
+	txId  [64]byte
+	txSeq uint64
+}
+
+func newVerifyState(base state.State, seq uint64) *verifyState {
+	return &verifyState{
+		base:    base,
+		seq:     seq,
+		writes:  make(map[string]*state.Resource),
+		pending: make(map[string]*state.Resource),
+	}
+}
+
+// world state reading resources from base's current state (including its updates not yet persisted), and keeping
+// updates in memory
+func newOverlayState(base state.State) *verifyState {
+	v := newVerifyState(base, 0)
+	v.current = true
+	return v
+}
+
+var errVerifyUnsupported = fmt.Errorf("operation not supported during handler verification")
+
+// keep updates of a transaction applied successfully
+func (v *verifyState) commit() {
+	for key, r := range v.pending {
+		v.writes[key] = r
+	}
+	v.pending = make(map[string]*state.Resource)
+}
+
+// drop updates of a failed transaction
+func (v *verifyState) discard() {
+	v.pending = make(map[string]*state.Resource)
+}
+
+// keys of resources updated (or deleted) by committed transactions
+func (v *verifyState) updated() [][]byte {
+	keys := make([][]byte, 0, len(v.writes))
+	for key := range v.writes {
+		keys = append(keys, []byte(key))
+	}
+	return keys
+}
+
+func (v *verifyState) Seen(txId []byte) bool {
+	return false
+}
+
+func (v *verifyState) Get(key []byte) (*state.Resource, error) {
+	r, found := v.pending[string(key)]
+	if !found {
+		r, found = v.writes[string(key)]
+	}
+	if !found && v.current {
+		return v.base.Get(key)
+	} else if !found {
+		return v.base.GetAt(key, v.seq)
+	} else if r == nil {
+		return nil, fmt.Errorf("resource not found")
+	}
+	return &state.Resource{Key: r.Key, Owner: r.Owner, Value: r.Value}, nil
+}
+
+func (v *verifyState) Put(r *state.Resource) error {
+	if r == nil || len(r.Key) == 0 {
+		return fmt.Errorf("invalid resource")
+	}
+	v.pending[string(r.Key)] = &state.Resource{
+		Key:   append([]byte{}, r.Key...),
+		Owner: append([]byte{}, r.Owner...),
+		Value: append([]byte{}, r.Value...),
+	}
+	return nil
+}
+
+func (v *verifyState) Delete(key []byte) error {
+	v.pending[string(key)] = nil
+	return nil
+}
+
+func (v *verifyState) Persist() error {
+	return nil
+}
+
+func (v *verifyState) Reset() error {
+	return errVerifyUnsupported
+}
+
+func (v *verifyState) Close() error {
+	return nil
+}
+
+func (v *verifyState) LastApplied() ([64]byte, uint64) {
+	return v.txId, v.txSeq
+}
+
+func (v *verifyState) Applied(txId [64]byte, seq uint64) {}
+
+func (v *verifyState) Current() ([64]byte, uint64) {
+	return v.txId, v.txSeq
+}
+
+func (v *verifyState) SetCurrent(txId [64]byte, seq uint64) {
+	v.txId, v.txSeq = txId, seq
+}
+
+func (v *verifyState) Root() ([64]byte, error) {
+	return [64]byte{}, errVerifyUnsupported
+}
+
+func (v *verifyState) GetAt(key []byte, seq uint64) (*state.Resource, error) {
+	return nil, errVerifyUnsupported
+}
+
+func (v *verifyState) Rollback(seq uint64) error {
+	return errVerifyUnsupported
+}
+
+func (v *verifyState) PruneHistory(seq uint64) (int, error) {
+	return 0, errVerifyUnsupported
+}
+
+func (v *verifyState) ListByOwner(owner []byte) ([]*state.Resource, error) {
+	return nil, errVerifyUnsupported
+}
+
+func (v *verifyState) Scan(prefix []byte) state.ResourceIterator {
+	return &verifyIterator{}
+}
+
+func (v *verifyState) Keys(prefix []byte) [][]byte {
+	return [][]byte{}
+}
+
+// iterator of an unsupported scan, fails without any resources
+type verifyIterator struct{}
+
+func (i *verifyIterator) Next() bool {
+	return false
+}
+
+func (i *verifyIterator) Resource() *state.Resource {
+	return nil
+}
+
+func (i *verifyIterator) Err() error {
+	return errVerifyUnsupported
+}
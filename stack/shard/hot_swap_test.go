@@ -0,0 +1,76 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+func TestSwapHandler_NotRegistered(t *testing.T) {
+	s, _ := setupChainShard(1, chainTestHandler(""), nil)
+	if _, err := s.SwapHandler([]byte("unknown"), chainTestHandler(""), 0); err == nil {
+		t.Errorf("expected swap of unregistered shard to fail")
+	}
+	if _, err := s.SwapHandler(s.apps[0].shardId, nil, 0); err == nil {
+		t.Errorf("expected swap with nil handler to fail")
+	}
+}
+
+func TestSwapHandler_NoVerify(t *testing.T) {
+	s, txs := setupChainShard(3, chainTestHandler(""), nil)
+	report, err := s.SwapHandler(txs[0].Request().ShardId, chainTestHandler(" v2"), 0)
+	if err != nil {
+		t.Errorf("failed to swap handler: %s", err)
+	} else if report.Verified != 0 {
+		t.Errorf("unexpected verification: %d", report.Verified)
+	}
+	// next transaction should be processed by new handler
+	tx := dto.TestSignedTransaction("value 4")
+	tx.Anchor().ShardParent, tx.Anchor().ShardSeq = txs[2].Id(), 4
+	addLogTx(s, tx)
+	if r, _ := s.GetState([]byte("counter")); r == nil || string(r.Value) != "value 4 v2" {
+		t.Errorf("transaction not processed by new handler: %v", r)
+	}
+}
+
+func TestSwapHandler_Verified(t *testing.T) {
+	s, txs := setupChainShard(5, chainTestHandler(""), nil)
+	report, err := s.SwapHandler(txs[0].Request().ShardId, chainTestHandler(""), 2)
+	if err != nil {
+		t.Errorf("failed to swap handler: %s", err)
+	} else if report.Verified != 2 || report.FromSeq != 4 || len(report.Mismatched) != 0 {
+		t.Errorf("incorrect report: %v", report)
+	}
+}
+
+func TestSwapHandler_Mismatch(t *testing.T) {
+	s, txs := setupChainShard(5, chainTestHandler(""), nil)
+	report, err := s.SwapHandler(txs[0].Request().ShardId, chainTestHandler(" v2"), 2)
+	if err != ErrHandlerMismatch {
+		t.Errorf("expected mismatch, got: %s", err)
+	} else if report == nil || len(report.Mismatched) != 3 {
+		t.Errorf("incorrect report: %v", report)
+	}
+	// original handler should be kept
+	tx := dto.TestSignedTransaction("value 6")
+	tx.Anchor().ShardParent, tx.Anchor().ShardSeq = txs[4].Id(), 6
+	addLogTx(s, tx)
+	if r, _ := s.GetState([]byte("counter")); r == nil || string(r.Value) != "value 6" {
+		t.Errorf("transaction not processed by original handler: %v", r)
+	}
+}
+
+func TestSwapHandler_MissedUpdate(t *testing.T) {
+	s, txs := setupChainShard(5, chainTestHandler(""), nil)
+	// handler that does not write per transaction keys
+	handler := func(tx dto.Transaction, s state.State) error {
+		return s.Put(&state.Resource{Key: []byte("counter"), Value: tx.Request().Payload})
+	}
+	report, err := s.SwapHandler(txs[0].Request().ShardId, handler, 2)
+	if err != ErrHandlerMismatch {
+		t.Errorf("expected mismatch, got: %s", err)
+	} else if len(report.Mismatched) != 2 {
+		t.Errorf("incorrect report: %v", report)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2019 The trust-net Authors
+// Housekeeping transactions issued by a node on the shard it hosts
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+)
+
+// payload of a tip merge transaction
+var TipMergePayload = []byte("dlt:tip-merge")
+
+// payload of a heartbeat transaction
+var HeartbeatPayload = []byte("dlt:heartbeat")
+
+// check whether transaction is issued by a node for housekeeping, i.e. it carries a housekeeping payload
+// and is submitted by the same node that anchored it (such transactions are not delivered to app)
+func IsNodeTx(tx dto.Transaction) bool {
+	return IsTipMerge(tx) || IsHeartbeat(tx)
+}
+
+// check whether transaction is a node issued tip merge
+func IsTipMerge(tx dto.Transaction) bool {
+	return string(tx.Request().Payload) == string(TipMergePayload) &&
+		string(tx.Request().SubmitterId) == string(tx.Anchor().NodeId)
+}
+
+// check whether transaction is a node issued heartbeat
+func IsHeartbeat(tx dto.Transaction) bool {
+	return string(tx.Request().Payload) == string(HeartbeatPayload) &&
+		string(tx.Request().SubmitterId) == string(tx.Anchor().NodeId)
+}
@@ -0,0 +1,192 @@
+// Copyright 2019 The trust-net Authors
+// Per shard retention policies, applied when pruning a shard's history
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"sync"
+)
+
+// retention policies of a shard
+const (
+	// keep shard's full history (default)
+	RETAIN_FOREVER = "keep_forever"
+	// keep full history of most recent epochs, prune transaction payloads and resources' history before that
+	RETAIN_EPOCHS = "keep_epochs"
+	// prune transaction payloads before most recent epochs, keep resources' history
+	RETAIN_PAYLOADS = "payload_prune"
+)
+
+// number of shard sequences in a retention epoch
+var EpochLength = uint64(1000)
+
+// retention policy declared for a shard
+type Retention struct {
+	// shard of the policy
+	ShardId []byte
+	// one of RETAIN_FOREVER, RETAIN_EPOCHS or RETAIN_PAYLOADS
+	Policy string
+	// number of most recent epochs (including current epoch) kept in full, for policies other than RETAIN_FOREVER
+	Epochs uint64
+}
+
+// first shard sequence kept in full for a shard at specified depth (0 when nothing is to be pruned)
+func (r *Retention) horizon(depth uint64) uint64 {
+	if r.Policy == RETAIN_FOREVER || depth < ShardSeqOne || EpochLength == 0 {
+		return 0
+	}
+	current := (depth - 1) / EpochLength
+	if current < r.Epochs {
+		return 0
+	}
+	return (current-r.Epochs+1)*EpochLength + 1
+}
+
+// outcome of pruning a shard as per its retention policy
+type PruneReport struct {
+	ShardId []byte
+	// first shard sequence kept in full (0 when nothing was pruned)
+	Horizon uint64
+	// number of transactions with payloads stripped
+	Payloads int
+	// number of resource versions dropped from world state's history
+	Versions int
+	// number of pinned transactions before horizon that were kept in full
+	Pinned int
+}
+
+// registry of retention policies per shard, along with horizon shards were last pruned to
+type retentions struct {
+	shards   map[string]*Retention
+	horizons map[string]uint64
+	lock     sync.RWMutex
+}
+
+func newRetentions() *retentions {
+	return &retentions{
+		shards:   make(map[string]*Retention),
+		horizons: make(map[string]uint64),
+	}
+}
+
+func (r *retentions) set(policy *Retention) error {
+	if policy == nil || len(policy.ShardId) == 0 {
+		return fmt.Errorf("missing shard id for retention policy")
+	}
+	switch policy.Policy {
+	case RETAIN_FOREVER:
+	case RETAIN_EPOCHS, RETAIN_PAYLOADS:
+		if policy.Epochs < 1 {
+			return fmt.Errorf("retention policy must keep at least 1 epoch")
+		}
+	default:
+		return fmt.Errorf("unknown retention policy: %s", policy.Policy)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.shards[string(policy.ShardId)] = policy
+	return nil
+}
+
+func (r *retentions) get(shardId []byte) *Retention {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.shards[string(shardId)]
+}
+
+// forget horizon a shard was pruned to, once shard's history is reset
+func (r *retentions) reset(shardId []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.horizons, string(shardId))
+}
+
+func (s *sharder) SetRetention(policy *Retention) error {
+	return s.retentions.set(policy)
+}
+
+func (s *sharder) Retention(shardId []byte) *Retention {
+	if policy := s.retentions.get(shardId); policy != nil {
+		return policy
+	}
+	return &Retention{ShardId: shardId, Policy: RETAIN_FOREVER}
+}
+
+// depth of shard's deepest tip
+func (s *sharder) shardDepth(shardId []byte) uint64 {
+	depth := uint64(0)
+	for _, tip := range s.db.ShardTips(shardId) {
+		if node := s.db.GetShardDagNode(tip); node != nil && node.Depth > depth {
+			depth = node.Depth
+		}
+	}
+	return depth
+}
+
+func (s *sharder) Prune(shardId []byte) (*PruneReport, error) {
+	report := &PruneReport{ShardId: shardId}
+	policy := s.retentions.get(shardId)
+	if policy == nil {
+		return report, nil
+	}
+	genesis := s.db.GetShardDagNode(GenesisShardTx(shardId).Id())
+	if genesis == nil {
+		return nil, fmt.Errorf("unknown shard")
+	}
+	report.Horizon = policy.horizon(s.shardDepth(shardId))
+	s.retentions.lock.Lock()
+	last := s.retentions.horizons[string(shardId)]
+	s.retentions.lock.Unlock()
+	if report.Horizon <= last {
+		// shard was already pruned up to horizon
+		return report, nil
+	}
+
+	// strip payloads of transactions before horizon
+	if err := s.walkShard(genesis, func(node *repo.DagNode, tx dto.Transaction) (bool, error) {
+		if node.Depth >= report.Horizon {
+			return false, nil
+		}
+		if s.db.GetPin(node.TxId) != nil {
+			report.Pinned += 1
+			return true, nil
+		}
+		if pruned, err := s.db.PrunePayload(node.TxId); err != nil {
+			return false, err
+		} else if pruned {
+			report.Payloads += 1
+		}
+		return true, nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// drop resources' history before horizon (or shard's earliest pinned transaction, so that state as of
+	// a pinned transaction can still be read), unless app maintains its state externally
+	historyHorizon := report.Horizon
+	for _, pin := range s.db.GetPins() {
+		if string(pin.ShardId) == string(shardId) && pin.ShardSeq < historyHorizon {
+			historyHorizon = pin.ShardSeq
+		}
+	}
+	if app := s.app(shardId); policy.Policy == RETAIN_EPOCHS && (app == nil || !app.externalState) {
+		var ws state.State
+		var err error
+		if app != nil && app.worldState != nil {
+			ws = app.worldState
+		} else if ws, err = s.newWorldState(shardId); err != nil {
+			return nil, err
+		}
+		if report.Versions, err = ws.PruneHistory(historyHorizon); err != nil {
+			return nil, err
+		}
+	}
+	s.retentions.lock.Lock()
+	s.retentions.horizons[string(shardId)] = report.Horizon
+	s.retentions.lock.Unlock()
+	s.logger.Debug("Pruned shard %x up to seq %d: %d payloads, %d versions", shardId, report.Horizon, report.Payloads, report.Versions)
+	return report, nil
+}
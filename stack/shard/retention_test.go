@@ -0,0 +1,120 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// handler updating same resource with each transaction
+func retentionTestHandler(tx dto.Transaction, s state.State) error {
+	return s.Put(&state.Resource{Key: []byte("key"), Value: tx.Request().Payload})
+}
+
+func TestRetention_Validation(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	for name, policy := range map[string]*Retention{
+		"no shard":       &Retention{Policy: RETAIN_FOREVER},
+		"unknown policy": &Retention{ShardId: []byte("shard"), Policy: "keep_some"},
+		"no epochs":      &Retention{ShardId: []byte("shard"), Policy: RETAIN_EPOCHS},
+	} {
+		if err := s.SetRetention(policy); err == nil {
+			t.Errorf("expected policy with %s to fail", name)
+		}
+	}
+	if s.Retention([]byte("shard")).Policy != RETAIN_FOREVER {
+		t.Errorf("shard should keep history forever by default")
+	}
+}
+
+func TestRetention_Horizon(t *testing.T) {
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 10
+	r := &Retention{Policy: RETAIN_PAYLOADS, Epochs: 2}
+	for depth, expected := range map[uint64]uint64{0: 0, 10: 0, 20: 0, 21: 11, 35: 21} {
+		if horizon := r.horizon(depth); horizon != expected {
+			t.Errorf("incorrect horizon at depth %d: %d", depth, horizon)
+		}
+	}
+}
+
+// keep epochs policy should strip payloads and drop resources' history before most recent epochs
+func TestPrune_KeepEpochs(t *testing.T) {
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 2
+	s, txs := setupChainShard(5, retentionTestHandler, nil)
+	shardId := txs[0].Request().ShardId
+	s.SetRetention(&Retention{ShardId: shardId, Policy: RETAIN_EPOCHS, Epochs: 1})
+	report, err := s.Prune(shardId)
+	if err != nil {
+		t.Fatalf("failed to prune shard: %s", err)
+	}
+	if report.Horizon != 5 || report.Payloads != 4 || report.Versions != 4 {
+		t.Errorf("incorrect prune report: %+v", report)
+	}
+	if len(s.db.GetTx(txs[3].Id()).Request().Payload) != 0 || len(s.db.GetTx(txs[4].Id()).Request().Payload) == 0 {
+		t.Errorf("incorrect payloads after prune")
+	}
+	if _, err := s.GetStateAtSeq(shardId, 4, []byte("key")); err == nil {
+		t.Errorf("resource history before horizon not dropped")
+	} else if _, err := s.GetStateAtSeq(shardId, 5, []byte("key")); err != nil {
+		t.Errorf("resource history at horizon dropped: %s", err)
+	}
+	// shard should not be pruned again until horizon moves
+	if report, _ := s.Prune(shardId); report.Payloads != 0 || report.Versions != 0 {
+		t.Errorf("shard pruned again: %+v", report)
+	}
+}
+
+// payload prune policy should keep resources' history
+func TestPrune_PayloadPrune(t *testing.T) {
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 2
+	s, txs := setupChainShard(5, retentionTestHandler, nil)
+	shardId := txs[0].Request().ShardId
+	s.SetRetention(&Retention{ShardId: shardId, Policy: RETAIN_PAYLOADS, Epochs: 2})
+	if report, err := s.Prune(shardId); err != nil || report.Horizon != 3 || report.Payloads != 2 || report.Versions != 0 {
+		t.Errorf("incorrect prune report: %+v, %v", report, err)
+	}
+	if r, err := s.GetStateAtSeq(shardId, 1, []byte("key")); err != nil || string(r.Value) != "value 1" {
+		t.Errorf("resource history dropped: %v, %v", r, err)
+	}
+}
+
+// shards without a retention policy should not be pruned
+func TestPrune_KeepForever(t *testing.T) {
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 2
+	s, txs := setupChainShard(5, retentionTestHandler, nil)
+	if report, err := s.Prune(txs[0].Request().ShardId); err != nil || report.Payloads != 0 {
+		t.Errorf("incorrect prune report: %+v, %v", report, err)
+	}
+}
+
+// pinned transactions should keep their payload, and resources' history from earliest pinned transaction
+func TestPrune_Pinned(t *testing.T) {
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 2
+	s, txs := setupChainShard(5, retentionTestHandler, nil)
+	shardId := txs[0].Request().ShardId
+	s.db.PinTx(&repo.Pin{TxId: txs[1].Id(), ShardId: shardId, ShardSeq: 2})
+	s.SetRetention(&Retention{ShardId: shardId, Policy: RETAIN_EPOCHS, Epochs: 1})
+	report, err := s.Prune(shardId)
+	if err != nil {
+		t.Fatalf("failed to prune shard: %s", err)
+	}
+	if report.Horizon != 5 || report.Payloads != 3 || report.Pinned != 1 {
+		t.Errorf("incorrect prune report: %+v", report)
+	}
+	if len(s.db.GetTx(txs[1].Id()).Request().Payload) == 0 {
+		t.Errorf("payload of pinned transaction stripped")
+	}
+	if _, err := s.GetStateAtSeq(shardId, 2, []byte("key")); err != nil {
+		t.Errorf("resource history at pinned transaction dropped: %s", err)
+	} else if _, err := s.GetStateAtSeq(shardId, 1, []byte("key")); err == nil {
+		t.Errorf("resource history before pinned transaction not dropped")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2019 The trust-net Authors
+// Deterministic ordering of a shard's transactions, for reading a shard as a log
+package shard
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"sort"
+)
+
+// error returned when shard history before a log cursor has changed since the cursor was issued,
+// consumer should re-read the log from the beginning (nil cursor)
+var ErrLogCursorInvalid = fmt.Errorf("log cursor invalidated by change in shard history")
+
+// position of a consumer in a shard's log
+type LogCursor struct {
+	// depth in shard DAG of the last transaction read
+	Depth uint64
+	// ID of the last transaction read
+	TxId [64]byte
+	// number of transactions in the log up to and including the last transaction read
+	Count uint64
+}
+
+// check if specified position is before the cursor in canonical order
+func (c *LogCursor) before(depth uint64, txId [64]byte) bool {
+	return depth < c.Depth || (depth == c.Depth && bytes.Compare(txId[:], c.TxId[:]) < 0)
+}
+
+// sentinel used to stop the shard walk once requested transactions are collected
+var errLogLimit = fmt.Errorf("log limit reached")
+
+// traverse shard DAG from genesis in canonical order, i.e. level by level (parents before children)
+// with transactions within a level ordered by their ID; visit returns false to skip a transaction's descendants
+func (s *sharder) walkShard(genesis *repo.DagNode, visit func(node *repo.DagNode, tx dto.Transaction) (bool, error)) error {
+	level := append([][64]byte{}, genesis.Children...)
+	for len(level) > 0 {
+		sort.Slice(level, func(i, j int) bool { return bytes.Compare(level[i][:], level[j][:]) < 0 })
+		next := [][64]byte{}
+		for _, id := range level {
+			// fetch shard DAG node and its transaction from DB for this id
+			if node := s.db.GetShardDagNode(id); node != nil {
+				if tx := s.db.GetTx(node.TxId); tx != nil {
+					if descend, err := visit(node, tx); err != nil {
+						return err
+					} else if descend {
+						next = append(next, node.Children...)
+					}
+				}
+			}
+		}
+		level = next
+	}
+	return nil
+}
+
+func (s *sharder) ShardLog(shardId []byte, cursor *LogCursor, limit int) ([]dto.Transaction, *LogCursor, error) {
+	genesis := s.db.GetShardDagNode(GenesisShardTx(shardId).Id())
+	if genesis == nil {
+		return nil, nil, fmt.Errorf("unknown shard")
+	}
+	next := &LogCursor{}
+	if cursor != nil {
+		*next = *cursor
+	}
+	txs := []dto.Transaction{}
+	count, found := uint64(0), cursor == nil
+	err := s.walkShard(genesis, func(node *repo.DagNode, tx dto.Transaction) (bool, error) {
+		if !found {
+			// skip transactions up to cursor, counting them to detect any change in history
+			if cursor.before(node.Depth, node.TxId) {
+				count += 1
+				return true, nil
+			} else if node.Depth != cursor.Depth || node.TxId != cursor.TxId || count+1 != cursor.Count {
+				return false, ErrLogCursorInvalid
+			}
+			found = true
+			return true, nil
+		}
+		if limit > 0 && len(txs) >= limit {
+			return false, errLogLimit
+		}
+		txs = append(txs, tx)
+		next.Depth, next.TxId, next.Count = node.Depth, node.TxId, next.Count+1
+		return true, nil
+	})
+	if err == nil && !found {
+		// cursor transaction is no longer part of shard's history
+		err = ErrLogCursorInvalid
+	}
+	if err != nil && err != errLogLimit {
+		return nil, nil, err
+	}
+	return txs, next, nil
+}
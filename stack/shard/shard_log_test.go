@@ -0,0 +1,103 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// build a shard with two siblings at depth 1 and a child of first sibling at depth 2
+func setupLogShard() (*sharder, []dto.Transaction) {
+	s, txs := setupChainShard(1, nil, nil)
+	tx1 := txs[0]
+	tx2, _ := SignedShardTransaction("value 2")
+	child := dto.TestSignedTransaction("value 3")
+	child.Anchor().ShardSeq = ShardSeqOne + 1
+	child.Anchor().ShardParent = tx1.Id()
+	addLogTx(s, tx2)
+	addLogTx(s, child)
+	// canonical order within a level is by transaction ID
+	id1, id2 := tx1.Id(), tx2.Id()
+	if bytes.Compare(id1[:], id2[:]) > 0 {
+		tx1, tx2 = tx2, tx1
+	}
+	return s, []dto.Transaction{tx1, tx2, child}
+}
+
+func TestShardLog_Order(t *testing.T) {
+	s, expected := setupLogShard()
+	txs, cursor, err := s.ShardLog(expected[0].Request().ShardId, nil, 0)
+	if err != nil {
+		t.Errorf("failed to read shard log: %s", err)
+		return
+	}
+	if len(txs) != len(expected) {
+		t.Errorf("incorrect number of transactions: %d", len(txs))
+		return
+	}
+	for i, tx := range txs {
+		if tx.Id() != expected[i].Id() {
+			t.Errorf("incorrect order at %d: %x", i, tx.Id())
+		}
+	}
+	if cursor.Count != 3 || cursor.TxId != expected[2].Id() {
+		t.Errorf("incorrect cursor: %v", cursor)
+	}
+}
+
+func TestShardLog_Cursor(t *testing.T) {
+	s, expected := setupLogShard()
+	shardId := expected[0].Request().ShardId
+	txs, cursor, _ := s.ShardLog(shardId, nil, 2)
+	if len(txs) != 2 || cursor.Count != 2 {
+		t.Errorf("incorrect first page: %d, %v", len(txs), cursor)
+		return
+	}
+	txs, cursor, err := s.ShardLog(shardId, cursor, 2)
+	if err != nil || len(txs) != 1 || txs[0].Id() != expected[2].Id() || cursor.Count != 3 {
+		t.Errorf("incorrect second page: %s", err)
+	}
+	// reading at end of log should return no transactions and same cursor
+	if txs, next, err := s.ShardLog(shardId, cursor, 2); err != nil || len(txs) != 0 || *next != *cursor {
+		t.Errorf("incorrect read at end of log: %s", err)
+	}
+}
+
+func TestShardLog_CursorInvalidated(t *testing.T) {
+	s, expected := setupLogShard()
+	shardId := expected[0].Request().ShardId
+	_, cursor, _ := s.ShardLog(shardId, nil, 0)
+
+	// a late transaction at depth 1 is inserted before cursor in canonical order
+	late, _ := SignedShardTransaction("late payload")
+	addLogTx(s, late)
+	if _, _, err := s.ShardLog(shardId, cursor, 0); err != ErrLogCursorInvalid {
+		t.Errorf("cursor should have been invalidated: %s", err)
+	}
+	// unknown cursor transaction should also be invalid
+	cursor.TxId = dto.RandomHash()
+	if _, _, err := s.ShardLog(shardId, cursor, 0); err != ErrLogCursorInvalid {
+		t.Errorf("unknown cursor should be invalid: %s", err)
+	}
+}
+
+// test that registration replays transactions in same order as shard log
+func TestShardLog_ReplayOrder(t *testing.T) {
+	s, expected := setupLogShard()
+	replayed := []dto.Transaction{}
+	s.Register(expected[0].Request().ShardId, func(tx dto.Transaction, ws state.State) error {
+		replayed = append(replayed, tx)
+		return nil
+	})
+	if len(replayed) != len(expected) {
+		t.Errorf("incorrect number of transactions replayed: %d", len(replayed))
+		return
+	}
+	for i, tx := range replayed {
+		if tx.Id() != expected[i].Id() {
+			t.Errorf("incorrect replay order at %d: %x", i, tx.Id())
+		}
+	}
+}
@@ -4,27 +4,84 @@ package shard
 
 import (
 	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/repo"
 	"github.com/trust-net/dag-lib-go/stack/state"
+	"io"
+	"runtime/debug"
+	"sort"
 	"sync"
+	"time"
 )
 
 var ShardSeqOne = uint64(0x01)
 
+// max number of tips (other than parent) an anchor merges as uncles, 0 for no limit
+var MaxAnchorUncles = 0
+
+// options for application registration with sharder
+type RegisterOptions struct {
+	// do not replay any of the shard's transactions to app at registration
+	SkipReplay bool
+	// only replay transactions with shard sequence at or above this value (0 means replay all)
+	ReplayFrom uint64
+	// reset the shard's world state before replay, so that app can rebuild state from scratch
+	ResetState bool
+	// max time allowed for app's transaction handler per transaction (0 means no limit)
+	HandlerTimeout time.Duration
+	// opt out of stack managed world state, app maintains resources in its own external store
+	// and uses the state's consistency token (last applied transaction) to stay in sync
+	ExternalState bool
+	// handler called for each transaction rolled back from shard when a conflict is resolved against a local
+	// transaction, in reverse canonical order, so that app can undo the transaction's effects (e.g. on an
+	// external store), stack managed world state is rolled back regardless of handler
+	UndoHandler func(tx dto.Transaction, state state.State) error
+	// record state diff (resources updated) of each transaction applied by app's transaction handler, so that
+	// world state can later be rebuilt from diffs (requires stack managed world state)
+	RecordDiffs bool
+	// apply a transaction's recorded state diff, when there is one, instead of calling app's transaction
+	// handler during replay and sync, e.g. to rebuild state quickly after a reset (requires stack managed
+	// world state, diffs are recorded in order transactions were applied, so app's handler must not depend
+	// on order of concurrent transactions)
+	ApplyDiffs bool
+	// spot-check every VerifyDiffs-th transaction applied from its diff (starting with first) by also running
+	// app's transaction handler and comparing its updates with diff, registration (or sync) fails with
+	// ErrDiffMismatch on a difference, 0 to not verify
+	VerifyDiffs int
+	// invariants of app's world state, evaluated after applied transactions (including replay), a violation
+	// fails the transaction and halts the shard until app re-registers (requires stack managed world state)
+	Validators []StateValidator
+}
+
 type Sharder interface {
 	// get a lock on world state at the beginning of transaction processing
 	LockState() error
 	// unlock the world state at the end of transaction processing
 	UnlockState()
-	// commit world state once transaction has been successfully processed
+	// get a lock on world state of a transaction's shard only, so that transactions of different shards are
+	// processed concurrently
+	LockShardState(shardId []byte) error
+	// unlock world state of a shard locked with LockShardState
+	UnlockShardState(shardId []byte)
+	// commit world state once transaction has been successfully processed (only transaction's shard, unless
+	// transaction is nil)
 	CommitState(tx dto.Transaction) error
 	// register application shard with the DLT stack
 	Register(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) error
-	// unregister application shard from DLT stack
+	// register application shard with the DLT stack using specified replay/state options
+	RegisterWithOptions(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, opts *RegisterOptions) error
+	// unregister all application shards from DLT stack
 	Unregister() error
-	// populate a transaction Anchor
+	// unregister application of specified shard from DLT stack
+	UnregisterShard(shardId []byte) error
+	// pause (first registered) application's transaction processing, while continuing to track the registered shard
+	Pause() error
+	// pause transaction processing of application registered for specified shard, while continuing to track the shard
+	PauseShard(shardId []byte) error
+	// populate a transaction Anchor for (first registered) application's shard
 	Anchor(a *dto.Anchor) error
 	// provide anchor for syncing with specified shard
 	SyncAnchor(shardId []byte) *dto.Anchor
@@ -32,25 +89,105 @@ type Sharder interface {
 	Ancestors(startHash [64]byte, max uint64) [][64]byte
 	// provide children of specified hash
 	Children(parent [64]byte) [][64]byte
+	// provide up to max hashes of shard DAG from specified hash (inclusive) with parents before children,
+	// and hashes where walk stopped short
+	Descendants(start [64]byte, max uint64) ([][64]byte, [][64]byte)
 	// Approve submitted transaction
 	Approve(tx dto.Transaction) error
 	// Handle Transaction
 	Handle(tx dto.Transaction) error
-	// get value for a resource from current world state for the registered shard
+	// get value for a resource from current world state for the (first) registered shard
 	GetState(key []byte) (*state.Resource, error)
+	// get value for a resource from current world state of specified registered shard
+	GetShardState(shardId []byte, key []byte) (*state.Resource, error)
+	// get value for a resource from a shard's world state as of a shard sequence
+	GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error)
+	// get resources owned by an owner in world state for the (first) registered shard
+	ListByOwner(owner []byte) ([]*state.Resource, error)
+	// get resources owned by an owner in world state of specified registered shard
+	ListShardByOwner(shardId []byte, owner []byte) ([]*state.Resource, error)
 	// flush a shard
 	Flush(shardId []byte) error
+	// reset a shard (app must not be registered for it): clear its world state, DAG, transactions and their
+	// submitters' history, and re-create its genesis
+	ResetShard(shardId []byte) error
+	// remove a shard (app must not be registered for it) from node altogether: its world state, DAG, transactions
+	// and their submitters' history
+	DropShard(shardId []byte) error
+	// resolve a conflict between a local transaction and a competing transaction (same submitter, sequence and
+	// shard), rolling back the local transaction's sub-DAG when competing transaction wins (world state must be locked)
+	Resolve(local, competing dto.Transaction) (*Resolution, error)
+	// get transaction size/complexity statistics for a shard
+	Stats(shardId []byte) *ShardStats
+	// get transactions dead-lettered as invalid by app's transaction handler for a shard
+	DeadLetters(shardId []byte) []DeadLetter
+	// get ID and shard sequence of last transaction applied to a shard's world state
+	LastApplied(shardId []byte) ([64]byte, uint64)
+	// export a snapshot of a shard's world state, along with shard's tips it corresponds to
+	Snapshot(shardId []byte, w io.Writer, codec common.Codec) (*state.SnapshotHeader, error)
+	// seed a shard unknown locally with a snapshot's world state and tip transactions
+	Restore(snap *state.Snapshot, tips []dto.Transaction) error
+	// read transactions of a shard in canonical order (same as replay), after the specified cursor
+	ShardLog(shardId []byte, cursor *LogCursor, limit int) ([]dto.Transaction, *LogCursor, error)
+	// configure a trusted checkpoint for a shard, network history conflicting with it will be refused
+	SetCheckpoint(cp *Checkpoint) error
+	// get trusted checkpoint configured for a shard (nil if none)
+	Checkpoint(shardId []byte) *Checkpoint
+	// declare a shard's retention policy, respected when shard is pruned
+	SetRetention(policy *Retention) error
+	// get retention policy declared for a shard (RETAIN_FOREVER if none)
+	Retention(shardId []byte) *Retention
+	// prune a shard's history before the epochs kept by its retention policy
+	Prune(shardId []byte) (*PruneReport, error)
+	// cap number of tips an anchor merges as uncles (0 for no limit)
+	SetMaxUncles(max int)
+	// cap size of a resource value accepted by world state (0 for no limit)
+	SetMaxValueSize(size int)
+	// replace transaction handler of a registered shard, after verifying (unless verify is 0) that new handler
+	// reproduces current state from the last verify transactions
+	SwapHandler(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, verify int) (*SwapReport, error)
+	// sharder updating world state, state diffs and shard DAG through a write batch, so that updates are applied
+	// along with the batch
+	WithBatch(batch repo.Batch) Sharder
+}
+
+// an application registered with sharder for a shard
+type shardApp struct {
+	shardId        []byte
+	genesisTx      dto.Transaction
+	appTxHandler   func(tx dto.Transaction, state state.State) error
+	handlerTimeout time.Duration
+	externalState  bool
+	undoHandler    func(tx dto.Transaction, state state.State) error
+	worldState     state.State
+	// state diff options, number of transactions applied from diffs, and diffs pending commit of world state
+	recordDiffs  bool
+	applyDiffs   bool
+	verifyDiffs  int
+	diffsApplied uint64
+	pendingDiffs []*repo.StateDiff
+	// invariants of world state, and violation that halted the shard
+	validators []StateValidator
+	halted     *InvariantViolation
+	// lock of app's world state while a transaction of its shard is processed
+	lock sync.Mutex
 }
 
 type sharder struct {
 	db  repo.DltDb
 	dbp db.DbProvider
 
-	shardId       []byte
-	genesisTx     dto.Transaction
-	appTxHandler     func(tx dto.Transaction, state state.State) error
-	worldState    state.State
+	// applications registered with sharder, in order of registration
+	apps          []*shardApp
 	useWorldState sync.RWMutex
+	stats          *statsCollector
+	deadLetters    *deadLetters
+	checkpoints    *checkpoints
+	retentions     *retentions
+	diffs          *repo.StateDiffStore
+	maxUncles      int
+	maxValueSize   int
+	logger         log.Logger
 }
 
 func GenesisShardTx(shardId []byte) dto.Transaction {
@@ -63,10 +200,31 @@ func GenesisShardTx(shardId []byte) dto.Transaction {
 	return tx
 }
 
+// get application registered for a shard
+func (s *sharder) app(shardId []byte) *shardApp {
+	for _, app := range s.apps {
+		if string(app.shardId) == string(shardId) {
+			return app
+		}
+	}
+	return nil
+}
+
+// get first registered application, used when a shard is not specified
+func (s *sharder) primary() *shardApp {
+	if len(s.apps) == 0 {
+		return nil
+	}
+	return s.apps[0]
+}
+
 func (s *sharder) txHandler(tx dto.Transaction, state state.State, ignoreSeen bool) error {
 	// check if app has registered a transaction handler
-	if s.appTxHandler == nil {
+	app := s.app(tx.Request().ShardId)
+	if app == nil || app.appTxHandler == nil {
 		return fmt.Errorf("no app handler registered")
+	} else if app.halted != nil {
+		return ErrShardHalted
 	}
 
 	// check to make sure transaction is not processed already
@@ -81,18 +239,126 @@ func (s *sharder) txHandler(tx dto.Transaction, state state.State, ignoreSeen bo
 			return nil
 		}
 	}
+
+	if err := s.applyTx(app, tx, state); err != nil {
+		return err
+	}
+	return s.validate(app, tx, state)
+}
+
+// apply a transaction to app's world state, via app's transaction handler
+func (s *sharder) applyTx(app *shardApp, tx dto.Transaction, state state.State) error {
+	txId := tx.Id()
+	// node issued housekeeping transactions carry no app operation
+	if IsNodeTx(tx) {
+		state.Applied(txId, tx.Anchor().ShardSeq)
+		return nil
+	}
 	
-	// call app's registered transaction handler
-	return s.appTxHandler(tx, state)
+	// apply recorded state diff instead of calling app's transaction handler, if app opted to
+	if diff := s.recordedDiff(app, tx); diff != nil {
+		return s.applyDiff(app, tx, diff, state)
+	}
+	// record state diff of transaction, if app opted to
+	var recorder *diffState
+	if app.recordDiffs {
+		recorder = newDiffState(state)
+		state = recorder
+	}
+
+	// call app's registered transaction handler, re-attempting retryable errors with backoff
+	state.SetCurrent(txId, tx.Anchor().ShardSeq)
+	defer state.SetCurrent([64]byte{}, 0)
+	backoff := HandlerRetryBackoff
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := s.callAppTxHandler(app, tx, state)
+		elapsed := time.Since(start)
+		s.stats.recordHandler(tx.Request().ShardId, elapsed)
+		if SlowHandlerThreshold > 0 && elapsed > SlowHandlerThreshold {
+			s.logger.Info("Slow app transaction handler took %s on transaction: %x", elapsed, txId)
+			s.stats.recordSlowHandler(tx.Request().ShardId)
+		}
+		switch ErrorCode(err) {
+		case HANDLER_OK:
+			// update consistency token for the shard's state
+			state.Applied(txId, tx.Anchor().ShardSeq)
+			if recorder != nil {
+				app.pendingDiffs = append(app.pendingDiffs, newStateDiff(tx, recorder.updates))
+			}
+		case ERR_RETRYABLE:
+			if attempt < HandlerRetryLimit {
+				s.stats.recordRetry(tx.Request().ShardId)
+				time.Sleep(backoff)
+				backoff *= 2
+				continue
+			}
+			s.logger.Error("Giving up on transaction after %d attempts: %x", attempt+1, txId)
+		case ERR_INVALID_TX:
+			// dead-letter the transaction, it will not be re-attempted
+			s.logger.Debug("Dead-lettering invalid transaction: %x\n%s", txId, err)
+			s.deadLetters.add(txId, tx.Request().ShardId, err)
+			s.stats.recordDeadLetter(tx.Request().ShardId)
+		case ERR_INTERNAL:
+			// raise alert for app's internal failure
+			s.logger.Error("ALERT: app internal error on transaction: %x\n%s", txId, err)
+			s.stats.recordInternalError(tx.Request().ShardId)
+		}
+		return err
+	}
+}
+
+func (s *sharder) callAppTxHandler(app *shardApp, tx dto.Transaction, state state.State) error {
+	if app.handlerTimeout == 0 {
+		return s.runAppTxHandler(app.appTxHandler, tx, state)
+	}
+	// run the handler with a deadline
+	handler, timeout, done := app.appTxHandler, app.handlerTimeout, make(chan error, 1)
+	go func() {
+		done <- s.runAppTxHandler(handler, tx, state)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		s.logger.Error("App transaction handler timed out after %s on transaction: %x", timeout, tx.Id())
+		s.stats.recordHandlerTimeout(tx.Request().ShardId)
+		return InternalError(fmt.Errorf("app transaction handler timed out"))
+	}
+}
+
+// run app's transaction handler, converting a panic into an internal error so that stack is not crashed
+func (s *sharder) runAppTxHandler(handler func(tx dto.Transaction, state state.State) error, tx dto.Transaction, state state.State) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Error("App transaction handler panicked on transaction: %x\n%v\n%s", tx.Id(), r, debug.Stack())
+			s.stats.recordHandlerPanic(tx.Request().ShardId)
+			err = InternalError(fmt.Errorf("app transaction handler panicked: %v", r))
+		}
+	}()
+	return handler(tx, state)
+}
+
+// create world state instance for a shard, based on app's choice of state management
+func (s *sharder) newWorldState(shardId []byte) (state.State, error) {
+	if app := s.app(shardId); app != nil && app.externalState {
+		return state.NewExternalWorldState(s.dbp, shardId)
+	}
+	ws, err := state.NewWorldState(s.dbp, shardId)
+	if err != nil {
+		return nil, err
+	}
+	ws.SetMaxValueSize(s.maxValueSize)
+	return ws, nil
 }
 
 func (s *sharder) LockState() error {
 //	// lock world state
 //	s.useWorldState.Lock()
-	if s.shardId != nil {
+	for _, app := range s.apps {
 		// create new state from DB
-		if state, err := state.NewWorldState(s.dbp, s.shardId); err == nil {
-			s.worldState = state
+		if state, err := s.newWorldState(app.shardId); err == nil {
+			app.worldState = state
 		} else {
 //			// unlock the lock from above
 //			s.useWorldState.Unlock()
@@ -104,21 +370,59 @@ func (s *sharder) LockState() error {
 
 func (s *sharder) UnlockState() {
 	// discarded whatever is not commited
-	if s.worldState != nil {
+	for _, app := range s.apps {
 		// we should re-use the DB connections
-//		s.worldState.Close()
-		s.worldState = nil
+//		app.worldState.Close()
+		app.worldState = nil
+		app.pendingDiffs = nil
 	}
 //	// unlock world state
 //	s.useWorldState.Unlock()
 }
 
+func (s *sharder) LockShardState(shardId []byte) error {
+	app := s.app(shardId)
+	if app == nil {
+		// no app's world state to lock for the shard
+		return nil
+	}
+	app.lock.Lock()
+	if state, err := s.newWorldState(app.shardId); err == nil {
+		app.worldState = state
+	} else {
+		app.lock.Unlock()
+		return fmt.Errorf("Failed to get world state reference: %s", err)
+	}
+	return nil
+}
+
+func (s *sharder) UnlockShardState(shardId []byte) {
+	if app := s.app(shardId); app != nil {
+		// discarded whatever is not commited
+		app.worldState = nil
+		app.pendingDiffs = nil
+		app.lock.Unlock()
+	}
+}
+
 func (s *sharder) CommitState(tx dto.Transaction) error {
-	// transaction processed successfully, persist world state
-	if s.worldState != nil {
-		if err := s.worldState.Persist(); err != nil {
-			return err
+	// transaction processed successfully, persist world state of transaction's shard (or of all registered
+	// shards during app registration replay), world state of other shards may be in use by their transactions
+	for _, app := range s.apps {
+		if tx != nil && string(app.shardId) != string(tx.Request().ShardId) {
+			continue
 		}
+		if app.worldState != nil {
+			if err := app.worldState.Persist(); err != nil {
+				return err
+			}
+		}
+		for _, diff := range app.pendingDiffs {
+			if err := s.diffs.Set(diff); err != nil {
+				return err
+			}
+		}
+		app.pendingDiffs = nil
 	}
 	// update shard's DAG and Tips in DB
 	if tx == nil {
@@ -128,84 +432,97 @@ func (s *sharder) CommitState(tx dto.Transaction) error {
 	if err := s.db.UpdateShard(tx); err != nil {
 		return err
 	}
+	// count transaction in shard's statistics only once it's accepted
+	s.stats.recordTx(tx)
 	return nil
 }
 
 func (s *sharder) Register(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error) error {
-	s.shardId = append(shardId)
-	s.appTxHandler = txHandler
+	return s.RegisterWithOptions(shardId, txHandler, nil)
+}
+
+func (s *sharder) RegisterWithOptions(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, opts *RegisterOptions) error {
+	if opts == nil {
+		opts = &RegisterOptions{}
+	}
+	// re-registration of a shard (e.g. app resuming) replaces its existing registration
+	app := s.app(shardId)
+	if app == nil {
+		app = &shardApp{shardId: append([]byte{}, shardId...)}
+		s.apps = append(s.apps, app)
+	}
+	app.appTxHandler = txHandler
+	app.handlerTimeout = opts.HandlerTimeout
+	app.externalState = opts.ExternalState
+	app.undoHandler = opts.UndoHandler
+	if (opts.RecordDiffs || opts.ApplyDiffs) && opts.ExternalState {
+		s.UnregisterShard(shardId)
+		return fmt.Errorf("state diffs require stack managed world state")
+	}
+	app.recordDiffs, app.applyDiffs, app.verifyDiffs, app.diffsApplied = opts.RecordDiffs, opts.ApplyDiffs, opts.VerifyDiffs, 0
+	if len(opts.Validators) > 0 && opts.ExternalState {
+		s.UnregisterShard(shardId)
+		return fmt.Errorf("state validators require stack managed world state")
+	}
+	app.validators, app.halted = opts.Validators, nil
 	// lock world state for replay
 	if err := s.LockState(); err != nil {
 		return err
 	}
 	defer s.UnlockState()
 
+	// reset world state if app requested a clean rebuild
+	if opts.ResetState {
+		if err := app.worldState.Reset(); err != nil {
+			s.UnregisterShard(shardId)
+			return err
+		}
+	}
+
 	// construct genesis Tx for this shard based on protocol rules
-	s.genesisTx = GenesisShardTx(shardId)
+	app.genesisTx = GenesisShardTx(shardId)
 
 	// fetch the genesis node for this shard's DAG
 	var genesis *repo.DagNode
-	if genesis = s.db.GetShardDagNode(s.genesisTx.Id()); genesis == nil {
+	if genesis = s.db.GetShardDagNode(app.genesisTx.Id()); genesis == nil {
 		// unknown/new shard, save the genesis transaction
-		if err := s.db.AddTx(s.genesisTx); err != nil {
+		if err := s.db.AddTx(app.genesisTx); err != nil {
 			return err
-		} else if err = s.db.UpdateShard(s.genesisTx); err != nil {
+		} else if err = s.db.UpdateShard(app.genesisTx); err != nil {
 			return err
 		}
 		// now retry to fetch genesis node
-		if genesis = s.db.GetShardDagNode(s.genesisTx.Id()); genesis == nil {
+		if genesis = s.db.GetShardDagNode(app.genesisTx.Id()); genesis == nil {
 			// still can't get it, abort
 			return fmt.Errorf("Cannot fetch genesis DAG node")
 		}
 
 		// fmt.Printf("Registering genesis for shard: %x\n", shardId)
 	}
+	// app does not want any replay
+	if opts.SkipReplay {
+		s.CommitState(nil)
+		return nil
+	}
 	// known shard, so replay transactions to the registered app
-	// by performing a breadth first tranversal on shard's DAG and calling
+	// by traversing shard's DAG in canonical order and calling
 	// app's transaction handler
-	q, _ := repo.NewQueue(100)
-	// add genesis's children's node ids to the queue
-	for _, id := range genesis.Children {
-		// fmt.Printf("Pushing into Q: %x\n", id)
-		q.Push(id)
-	}
-	for q.Count() > 0 {
-		// pop a node id from traversal queue
-		if value, err := q.Pop(); err != nil {
-			// had some problem
-			return err
-		} else {
-			// get nodeId from popped interface
-			id, _ := value.([64]byte)
-			// fmt.Printf("GetShardDagNode: %x\n", value)
-			// fetch shard DAG node from DB for this id
-			if node := s.db.GetShardDagNode(id); node != nil {
-				// fetch transaction for this node
-				if tx := s.db.GetTx(node.TxId); tx != nil {
-					// fmt.Printf("GetTx: %x\n", tx.Id())
-//					// check if transaction is alread seen
-//					if s.worldState.Seen(node.TxId[:]) {
-//						// skip
-//						continue
-//					}
-					// replay transaction to the app, silently ignore seen transaction
-					if err := s.txHandler(tx, s.worldState, true); err == nil {
-						// we only add children of this transaction to queue if this was a good transaction
-						for _, id := range node.Children {
-							// fmt.Printf("Pushing into Q: %x\n", id)
-							if err := q.Push(id); err != nil {
-								// had some problem
-								s.Unregister()
-								return err
-							}
-						}
-					} else {
-						s.Unregister()
-						return err
-					}
-				}
-			}
+	if err := s.walkShard(genesis, func(node *repo.DagNode, tx dto.Transaction) (bool, error) {
+		// skip transactions before requested replay point, but continue traversal to children
+		if tx.Anchor().ShardSeq < opts.ReplayFrom {
+			return true, nil
 		}
+		// replay transaction to the app, silently ignore seen transaction
+		err := s.txHandler(tx, app.worldState, true)
+		if ErrorCode(err) == ERR_INVALID_TX {
+			// dead-lettered transaction, skip it (and its descendants) but continue replay
+			return false, nil
+		}
+		// we only traverse children of this transaction if this was a good transaction
+		return err == nil, err
+	}); err != nil {
+		s.UnregisterShard(shardId)
+		return err
 	}
 	// transaction replay successful, persist world state
 	s.CommitState(nil)
@@ -213,10 +530,38 @@ func (s *sharder) Register(shardId []byte, txHandler func(tx dto.Transaction, st
 }
 
 func (s *sharder) Unregister() error {
-	s.shardId = nil
-	s.appTxHandler = nil
-	s.genesisTx = nil
-	s.worldState = nil
+	s.apps = nil
+	return nil
+}
+
+func (s *sharder) UnregisterShard(shardId []byte) error {
+	for i, app := range s.apps {
+		if string(app.shardId) == string(shardId) {
+			s.apps = append(s.apps[:i], s.apps[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("app not registered")
+}
+
+func (s *sharder) Pause() error {
+	// make sure app is registered
+	app := s.primary()
+	if app == nil {
+		return fmt.Errorf("app not registered")
+	}
+	return s.PauseShard(app.shardId)
+}
+
+func (s *sharder) PauseShard(shardId []byte) error {
+	// make sure app is registered
+	app := s.app(shardId)
+	if app == nil {
+		return fmt.Errorf("app not registered")
+	}
+	// keep the shard registered so that its transactions continue to be processed and stored,
+	// but drop the app's handler so that transactions are not marked as seen until app resumes
+	app.appTxHandler = nil
 	return nil
 }
 
@@ -230,10 +575,10 @@ func Numeric(id []byte) uint64 {
 
 func (s *sharder) Anchor(a *dto.Anchor) error {
 	// make sure app is registered
-	if s.shardId == nil {
+	if app := s.primary(); app == nil {
 		return fmt.Errorf("app not registered")
 	} else {
-		return s.updateAnchor(s.shardId, a)
+		return s.updateAnchor(app.shardId, a)
 	}
 }
 
@@ -267,29 +612,41 @@ func (s *sharder) updateAnchor(shardId []byte, a *dto.Anchor) error {
 
 	// find the deepest node as parent
 	parent := s.db.GetShardDagNode(tips[0])
-	uncles := [][64]byte{}
-	weight := parent.Depth
+	others := []*repo.DagNode{}
 	for i := 1; i < len(tips); i += 1 {
 		node := s.db.GetShardDagNode(tips[i])
-		weight += node.Depth
 		if parent.Depth < node.Depth {
-			uncles = append(uncles, parent.TxId)
+			others = append(others, parent)
 			parent = node
 		} else if parent.Depth == node.Depth && Numeric(parent.TxId[:]) < Numeric(node.TxId[:]) {
-			uncles = append(uncles, parent.TxId)
+			others = append(others, parent)
 			parent = node
 		} else {
-			uncles = append(uncles, node.TxId)
+			others = append(others, node)
 		}
 	}
 
+	// merge only the deepest tips as uncles when capped, rest remain tips for later anchors
+	if s.maxUncles > 0 && len(others) > s.maxUncles {
+		sort.SliceStable(others, func(i, j int) bool {
+			return others[i].Depth > others[j].Depth
+		})
+		others = others[:s.maxUncles]
+	}
+	uncles := make([][64]byte, 0, len(others))
+	weight := parent.Depth
+	for _, node := range others {
+		uncles = append(uncles, node.TxId)
+		weight += node.Depth
+	}
+
 	// assign shard DAG's parent node ID to anchor
 	a.ShardParent = parent.TxId
 
 	// assign sequence 1 greater than DAG's parent node
 	a.ShardSeq = parent.Depth + 1
 
-	// assign weight as summation of all tip's depth + 1
+	// assign weight as summation of merged tip's depth + 1
 	a.Weight = weight + 1
 
 	// assign uncles to anchor
@@ -315,25 +672,44 @@ func (s *sharder) Children(parent [64]byte) [][64]byte {
 	return nil
 }
 
+// walk shard DAG breadth first from specified hash, so that a transaction is listed after its parent
+func (s *sharder) Descendants(start [64]byte, max uint64) ([][64]byte, [][64]byte) {
+	if s.db.GetShardDagNode(start) == nil {
+		return nil, nil
+	}
+	walked := [][64]byte{}
+	queue := [][64]byte{start}
+	for len(queue) > 0 && uint64(len(walked)) < max {
+		node := s.db.GetShardDagNode(queue[0])
+		queue = queue[1:]
+		if node != nil {
+			walked = append(walked, node.TxId)
+			queue = append(queue, node.Children...)
+		}
+	}
+	return walked, queue
+}
+
 func (s *sharder) Approve(tx dto.Transaction) error {
 	// make sure app is registered
-	if s.shardId == nil {
+	if len(s.apps) == 0 {
 		return fmt.Errorf("app not registered")
 	}
 
 	// validate transaction
+	app := s.app(tx.Request().ShardId)
 	if len(tx.Request().ShardId) == 0 {
 		return fmt.Errorf("missing shard id in transaction")
-	} else if string(s.shardId) != string(tx.Request().ShardId) {
+	} else if app == nil {
 		return fmt.Errorf("incorrect shard Id")
 	}
 
 	// check if parent for the transaction is known
 	if parent := s.db.GetShardDagNode(tx.Anchor().ShardParent); parent == nil {
-		return fmt.Errorf("parent transaction unknown for shard")
+		return dto.NewTxError(dto.ErrStaleAnchor, "parent transaction unknown for shard")
 	} else {
 		// process transaction via application's callback
-		if err := s.txHandler(tx, s.worldState, false); err != nil {
+		if err := s.txHandler(tx, app.worldState, false); err != nil {
 			return err
 		}
 
@@ -364,6 +740,14 @@ func (s *sharder) Handle(tx dto.Transaction) error {
 
 	// TBD: lock and unlock
 
+	// refuse history that conflicts with shard's trusted checkpoint, unless transaction is already in local DAG
+	cp := s.checkpoints.get(tx.Request().ShardId)
+	if cp != nil && s.db.GetShardDagNode(tx.Id()) == nil {
+		if err := cp.validate(tx, s.db.GetShardDagNode(cp.TxId) != nil); err != nil {
+			return err
+		}
+	}
+
 	// check for first network transactions of a new shard
 	if tx.Anchor().ShardSeq == ShardSeqOne {
 		genesis := GenesisShardTx(tx.Request().ShardId)
@@ -394,11 +778,18 @@ func (s *sharder) Handle(tx dto.Transaction) error {
 		//		}
 	}
 
-	// if an app is registered, call app's transaction handler
-	if s.appTxHandler != nil && string(s.shardId) == string(tx.Request().ShardId) {
-		if err := s.txHandler(tx, s.worldState, false); err != nil {
+	// if an app is registered for transaction's shard, call app's transaction handler
+	if app := s.app(tx.Request().ShardId); app != nil && app.appTxHandler != nil {
+		if err := s.txHandler(tx, app.worldState, false); err != nil {
 			return err
 		}
+		// verify world state at trusted checkpoint, unless app manages state externally
+		if cp != nil && cp.TxId == tx.Id() && !app.externalState {
+			if err := cp.verifyState(app.worldState); err != nil {
+				s.logger.Error("ALERT: %s: %x", err, tx.Id())
+				return err
+			}
+		}
 		// moved this to txhandler wrapper
 //		// mark the transaction as seen by app so that it will not get replayed at startup/registration
 //		txId := tx.Id()
@@ -409,11 +800,20 @@ func (s *sharder) Handle(tx dto.Transaction) error {
 
 func (s *sharder) GetState(key []byte) (*state.Resource, error) {
 	// make sure app is registered
-	if s.shardId == nil {
+	if app := s.primary(); app == nil {
+		return nil, fmt.Errorf("app not registered")
+	} else {
+		return s.GetShardState(app.shardId, key)
+	}
+}
+
+func (s *sharder) GetShardState(shardId []byte, key []byte) (*state.Resource, error) {
+	// make sure app is registered
+	if app := s.app(shardId); app == nil {
 		return nil, fmt.Errorf("app not registered")
 	} else {
 		// fetch resource from world state
-		if state, err := state.NewWorldState(s.dbp, s.shardId); err != nil {
+		if state, err := s.newWorldState(app.shardId); err != nil {
 			return nil, err
 		} else {
 			// re-use db connection
@@ -423,13 +823,44 @@ func (s *sharder) GetState(key []byte) (*state.Resource, error) {
 	}
 }
 
+// get value for a resource as of a shard sequence, reconstructed from the shard's resource history
+func (s *sharder) GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error) {
+	if len(shardId) == 0 {
+		return nil, fmt.Errorf("missing shard id")
+	} else if ws, err := s.newWorldState(shardId); err != nil {
+		return nil, err
+	} else {
+		return ws.GetAt(key, seq)
+	}
+}
+
+func (s *sharder) ListByOwner(owner []byte) ([]*state.Resource, error) {
+	// make sure app is registered
+	if app := s.primary(); app == nil {
+		return nil, fmt.Errorf("app not registered")
+	} else {
+		return s.ListShardByOwner(app.shardId, owner)
+	}
+}
+
+func (s *sharder) ListShardByOwner(shardId []byte, owner []byte) ([]*state.Resource, error) {
+	// make sure app is registered
+	if app := s.app(shardId); app == nil {
+		return nil, fmt.Errorf("app not registered")
+	} else if ws, err := s.newWorldState(app.shardId); err != nil {
+		return nil, err
+	} else {
+		return ws.ListByOwner(owner)
+	}
+}
+
 // flush world state for the shard
 func (s *sharder) Flush(shardId []byte) error {
-	// first check if the shard is same as registered and has world state open
+	// first check if the shard is registered and has world state open
 	var ws state.State
 	var err error
-	if string(shardId) == string(s.shardId) && s.worldState != nil {
-		ws = s.worldState
+	if app := s.app(shardId); app != nil && app.worldState != nil {
+		ws = app.worldState
 	} else if ws, err = state.NewWorldState(s.dbp, shardId); err != nil {
 		return err
 	}
@@ -447,9 +878,102 @@ func (s *sharder) Flush(shardId []byte) error {
 	return nil
 }
 
+// reset a shard that's not registered, so that an app registering for it later replays a clean history
+func (s *sharder) ResetShard(shardId []byte) error {
+	if err := s.DropShard(shardId); err != nil {
+		return err
+	}
+	// update genesis for the shard
+	gen := GenesisShardTx(shardId)
+	s.db.AddTx(gen)
+	return s.db.UpdateShard(gen)
+}
+
+func (s *sharder) DropShard(shardId []byte) error {
+	if s.app(shardId) != nil {
+		return fmt.Errorf("app registered for shard")
+	}
+	// remove shard's DAG, transactions and submitters' history first, so that a failure leaves shard intact
+	if err := s.db.ResetShard(shardId); err != nil {
+		return err
+	}
+	if ws, err := state.NewWorldState(s.dbp, shardId); err != nil {
+		return err
+	} else if err := ws.Reset(); err != nil {
+		return err
+	}
+	if err := s.diffs.Drop(shardId); err != nil {
+		return err
+	}
+	s.retentions.reset(shardId)
+	return nil
+}
+
+// get transaction size/complexity statistics for a shard
+func (s *sharder) Stats(shardId []byte) *ShardStats {
+	return s.stats.get(shardId)
+}
+
+// get transactions dead-lettered as invalid by app's transaction handler for a shard
+func (s *sharder) DeadLetters(shardId []byte) []DeadLetter {
+	return s.deadLetters.get(shardId)
+}
+
+// get ID and shard sequence of last transaction applied to a shard's world state
+func (s *sharder) LastApplied(shardId []byte) ([64]byte, uint64) {
+	// use the open world state when processing registered shard's transaction
+	if app := s.app(shardId); app != nil && app.worldState != nil {
+		return app.worldState.LastApplied()
+	} else if ws, err := state.NewWorldState(s.dbp, shardId); err == nil {
+		return ws.LastApplied()
+	}
+	return [64]byte{}, 0
+}
+
+func (s *sharder) SetCheckpoint(cp *Checkpoint) error {
+	return s.checkpoints.set(cp)
+}
+
+func (s *sharder) Checkpoint(shardId []byte) *Checkpoint {
+	return s.checkpoints.get(shardId)
+}
+
+func (s *sharder) SetMaxUncles(max int) {
+	s.maxUncles = max
+}
+
+func (s *sharder) SetMaxValueSize(size int) {
+	s.maxValueSize = size
+}
+
+func (s *sharder) WithBatch(batch repo.Batch) Sharder {
+	dbp := batch.Provider(s.dbp)
+	return &sharder{
+		db:           batch,
+		dbp:          dbp,
+		apps:         s.apps,
+		stats:        s.stats,
+		deadLetters:  s.deadLetters,
+		checkpoints:  s.checkpoints,
+		retentions:   s.retentions,
+		diffs:        repo.NewStateDiffStore(dbp),
+		maxUncles:    s.maxUncles,
+		maxValueSize: s.maxValueSize,
+		logger:       s.logger,
+	}
+}
+
 func NewSharder(db repo.DltDb, dbp db.DbProvider) (*sharder, error) {
 	return &sharder{
-		db:  db,
-		dbp: dbp,
+		db:          db,
+		dbp:         dbp,
+		stats:       newStatsCollector(),
+		deadLetters: newDeadLetters(),
+		checkpoints: newCheckpoints(),
+		retentions:  newRetentions(),
+		diffs:       repo.NewStateDiffStore(dbp),
+		maxUncles:   MaxAnchorUncles,
+		maxValueSize: state.MaxValueSize,
+		logger:      log.NewLogger("Sharder"),
 	}, nil
 }
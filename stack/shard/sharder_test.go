@@ -9,6 +9,7 @@ import (
 	"github.com/trust-net/dag-lib-go/stack/state"
 	"github.com/trust-net/dag-lib-go/log"
 	"testing"
+	"time"
 )
 
 func TestInitiatization(t *testing.T) {
@@ -23,7 +24,7 @@ func TestInitiatization(t *testing.T) {
 	if s.(*sharder).db != testDb {
 		t.Errorf("Layer does not have correct DB reference expected: %s, actual: %s", testDb, s.(*sharder).db)
 	}
-	if s.(*sharder).worldState != nil {
+	if s.(*sharder).primary() != nil {
 		t.Errorf("Sharder should initialize with nil world state, until an app is registered")
 	}
 }
@@ -54,7 +55,7 @@ func TestRegistration(t *testing.T) {
 	}
 
 	// make sure sharder registered the values
-	if s.shardId == nil {
+	if s.app([]byte("test shard")) == nil {
 		t.Errorf("Sharder did not register app's shard ID")
 	}
 	if s.txHandler == nil {
@@ -78,7 +79,7 @@ func TestRegistration(t *testing.T) {
 	}
 
 	// make sure that world state reference is nil (will be set then locked)
-	if s.worldState != nil {
+	if s.app([]byte("test shard")).worldState != nil {
 		t.Errorf("Sharder should not set world state reference when app is registered")
 	}
 }
@@ -137,10 +138,9 @@ func TestRegistrationKnownShard(t *testing.T) {
 	}
 
 	// make sure sharder registered the values
-	if s.shardId == nil {
+	if s.app([]byte("test shard")) == nil {
 		t.Errorf("Sharder did not register app's shard ID")
-	}
-	if s.appTxHandler == nil {
+	} else if s.app([]byte("test shard")).appTxHandler == nil {
 		t.Errorf("Sharder did not register transaction call back")
 	}
 
@@ -168,17 +168,61 @@ func TestUnregistration(t *testing.T) {
 		t.Errorf("App un-registration failed: %s", err)
 	}
 
-	// make sure sharder cleared the values
-	if s.shardId != nil {
-		t.Errorf("Sharder did not clear app's shard ID")
-	}
-	if s.appTxHandler != nil {
-		t.Errorf("Sharder did not clear transaction call back")
+	// make sure sharder cleared the app's registration, along with its transaction call back and world state
+	if s.app([]byte("test shard")) != nil || s.primary() != nil {
+		t.Errorf("Sharder did not clear app's registration")
 	}
+}
 
-	// make sure that world state reference is removed correctly
-	if s.worldState != nil {
-		t.Errorf("Sharder did not remove world state reference when app is unregistered")
+// apps registered for multiple shards should each handle their own shard's transactions, and be
+// unregistered individually
+func TestRegistration_MultipleShards(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	handled := map[string]int{}
+	txHandler := func(tx dto.Transaction, ws state.State) error {
+		handled[string(tx.Request().ShardId)] += 1
+		return ws.Put(&state.Resource{Key: []byte("key"), Value: tx.Request().ShardId})
+	}
+	shards := [][]byte{[]byte("shard 1"), []byte("shard 2")}
+	for _, shardId := range shards {
+		if err := s.Register(shardId, txHandler); err != nil {
+			t.Fatalf("App registration failed: %s", err)
+		}
+	}
+	if string(s.primary().shardId) != string(shards[0]) {
+		t.Errorf("first registered app should be primary")
+	}
+	for _, shardId := range shards {
+		submitter := dto.TestSubmitter()
+		submitter.ShardId = shardId
+		tx := submitter.NewTransaction(dto.TestAnchor(), "test payload")
+		tx.Anchor().ShardParent = GenesisShardTx(shardId).Id()
+		s.LockState()
+		if err := s.Approve(tx); err != nil {
+			t.Errorf("Transaction of shard %s not approved: %s", shardId, err)
+		}
+		s.CommitState(tx)
+		s.UnlockState()
+	}
+	for _, shardId := range shards {
+		if handled[string(shardId)] != 1 {
+			t.Errorf("Incorrect transactions handled for shard %s: %d", shardId, handled[string(shardId)])
+		}
+		if ws, _ := s.newWorldState(shardId); ws == nil {
+			t.Errorf("No world state for shard %s", shardId)
+		} else if r, err := ws.Get([]byte("key")); err != nil || string(r.Value) != string(shardId) {
+			t.Errorf("Incorrect world state for shard %s", shardId)
+		}
+	}
+	// unregister first app, second app should remain registered and become primary
+	if err := s.UnregisterShard(shards[0]); err != nil {
+		t.Errorf("App un-registration failed: %s", err)
+	}
+	if s.app(shards[0]) != nil || s.app(shards[1]) == nil || string(s.primary().shardId) != string(shards[1]) {
+		t.Errorf("Incorrect apps after un-registration")
+	}
+	if err := s.UnregisterShard(shards[0]); err == nil {
+		t.Errorf("Expected un-registration of unknown shard to fail")
 	}
 }
 
@@ -685,6 +729,53 @@ func TestChildrenKnownParent(t *testing.T) {
 	}
 }
 
+// descendants should be walked breadth first, parents before children, stopping short at max
+func TestDescendants(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	// tx1 has 2 children tx2 and tx3, and tx2 has a child tx4
+	tx1, _ := SignedShardTransaction("test payload")
+	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
+	s.Register(tx1.Request().ShardId, txHandler)
+	child := func(parent dto.Transaction) dto.Transaction {
+		tx := dto.TestSignedTransaction("test payload")
+		tx.Anchor().ShardParent = parent.Id()
+		tx.Anchor().ShardSeq = parent.Anchor().ShardSeq + 1
+		return tx
+	}
+	tx2 := child(tx1)
+	tx3 := child(tx1)
+	tx4 := child(tx2)
+	for _, tx := range []dto.Transaction{tx1, tx2, tx3, tx4} {
+		s.LockState()
+		if err := s.Handle(tx); err != nil {
+			t.Errorf("Failed to add transaction: %s", err)
+		}
+		s.CommitState(tx)
+		s.UnlockState()
+	}
+
+	// all descendants of tx1, tx4 should be after its parent
+	if walked, pending := s.Descendants(tx1.Id(), 10); len(walked) != 4 || len(pending) != 0 {
+		t.Errorf("Incorrect number of descendants: %d, pending: %d", len(walked), len(pending))
+	} else if walked[0] != tx1.Id() || walked[3] != tx4.Id() {
+		t.Errorf("Incorrect order of descendants")
+	}
+
+	// walk stopping short should provide hashes to continue from
+	if walked, pending := s.Descendants(tx1.Id(), 2); len(walked) != 2 || len(pending) != 2 {
+		t.Errorf("Incorrect number of descendants: %d, pending: %d", len(walked), len(pending))
+	} else if walked[1] != tx2.Id() || pending[0] != tx3.Id() || pending[1] != tx4.Id() {
+		t.Errorf("Incorrect pending descendants")
+	}
+
+	// unknown start hash has no descendants
+	if walked, pending := s.Descendants(dto.RandomHash(), 10); walked != nil || pending != nil {
+		t.Errorf("Unexpected descendants of unknown hash")
+	}
+}
+
 func TestChildrenUnknownParent(t *testing.T) {
 	testDb := repo.NewMockDltDb()
 	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
@@ -983,6 +1074,36 @@ func TestFlush_UnregisteredShard(t *testing.T) {
 	}
 }
 
+// reset of an unregistered shard should clear its world state and history, so that re-registration replays clean
+func TestReset(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	replayed := 0
+	txHandler := func(tx dto.Transaction, s state.State) error {
+		replayed += 1
+		return s.Put(&state.Resource{Key: []byte("key"), Value: tx.Request().Payload})
+	}
+	tx, genesis := SignedShardTransaction("test data")
+	shardId := tx.Request().ShardId
+	s.Register(shardId, txHandler)
+	addLogTx(s, tx)
+	if err := s.ResetShard(shardId); err == nil {
+		t.Errorf("expected reset of registered shard to fail")
+	}
+	s.Unregister()
+	if err := s.ResetShard(shardId); err != nil {
+		t.Fatalf("shard reset failed: %s", err)
+	}
+	if s.db.GetTx(tx.Id()) != nil || s.db.GetShardDagNode(genesis.Id()) == nil {
+		t.Errorf("shard history not reset")
+	}
+	// re-registration should replay nothing, over an empty world state
+	replayed = 0
+	s.Register(shardId, txHandler)
+	if _, err := s.GetState([]byte("key")); err == nil || replayed != 0 {
+		t.Errorf("world state not reset, replayed: %d", replayed)
+	}
+}
+
 func TestCommitState_WithTransaction(t *testing.T) {
 	testDb := repo.NewMockDltDb()
 	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
@@ -1010,3 +1131,326 @@ func TestCommitState_NilTransaction(t *testing.T) {
 		t.Errorf("Commit state should not update shard DAG")
 	}
 }
+
+// world state and shard DAG updates through a batch should be applied only when batch is committed
+func TestCommitState_WithBatch(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	dbp := db.NewInMemDbProvider()
+	dltDb, _ := repo.NewDltDb(dbp)
+	s, _ := NewSharder(dltDb, dbp)
+	tx, _ := SignedShardTransaction("test payload")
+	s.Register(tx.Request().ShardId, func(tx dto.Transaction, s state.State) error {
+		return s.Put(&state.Resource{Key: []byte("key"), Value: tx.Request().Payload})
+	})
+	batch := dltDb.Begin()
+	view := s.WithBatch(batch)
+	view.LockState()
+	if err := view.Approve(tx); err != nil {
+		t.Errorf("failed to approve transaction: %s", err)
+	}
+	if err := view.CommitState(tx); err != nil {
+		t.Errorf("failed to commit state: %s", err)
+	}
+	view.UnlockState()
+	if _, err := s.GetState([]byte("key")); err == nil || dltDb.GetShardDagNode(tx.Id()) != nil {
+		t.Errorf("updates applied before batch is committed")
+	}
+	if err := batch.Commit(); err != nil {
+		t.Errorf("failed to commit batch: %s", err)
+	}
+	if r, err := s.GetState([]byte("key")); err != nil || string(r.Value) != "test payload" {
+		t.Errorf("world state not updated after batch is committed: %s", err)
+	}
+	if dltDb.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("shard DAG not updated after batch is committed")
+	}
+}
+
+// setup a sharder with a network transaction in shard before app registration
+func setupReplayShard() (*sharder, dto.Transaction) {
+	s, txs := setupChainShard(1, nil, nil)
+	return s, txs[0]
+}
+
+func TestRegisterWithOptions_SkipReplay(t *testing.T) {
+	s, tx := setupReplayShard()
+	cbCalled := false
+	txHandler := func(tx dto.Transaction, state state.State) error { cbCalled = true; return nil }
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{SkipReplay: true}); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if cbCalled {
+		t.Errorf("App registration should not replay transactions when skipped")
+	}
+	if s.app(tx.Request().ShardId) == nil {
+		t.Errorf("App not registered")
+	}
+}
+
+func TestRegisterWithOptions_ReplayFrom(t *testing.T) {
+	s, tx := setupReplayShard()
+	cbCalled := false
+	txHandler := func(tx dto.Transaction, state state.State) error { cbCalled = true; return nil }
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{ReplayFrom: tx.Anchor().ShardSeq + 1}); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if cbCalled {
+		t.Errorf("App registration should not replay transactions before replay point")
+	}
+	s.Unregister()
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{ReplayFrom: tx.Anchor().ShardSeq}); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if !cbCalled {
+		t.Errorf("App registration did not replay transactions from replay point")
+	}
+}
+
+func TestRegisterWithOptions_ResetState(t *testing.T) {
+	s, tx := setupReplayShard()
+	count := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { count += 1; return nil }
+	// first registration replays transaction and marks it seen
+	s.Register(tx.Request().ShardId, txHandler)
+	s.Unregister()
+	// second registration should not replay seen transaction
+	s.Register(tx.Request().ShardId, txHandler)
+	s.Unregister()
+	if count != 1 {
+		t.Errorf("Incorrect replay count: %d", count)
+	}
+	// registration with state reset should replay again
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{ResetState: true}); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if count != 2 {
+		t.Errorf("App registration did not replay after state reset: %d", count)
+	}
+}
+
+func TestRegisterWithOptions_HandlerTimeout(t *testing.T) {
+	s, tx := setupReplayShard()
+	txHandler := func(tx dto.Transaction, state state.State) error { time.Sleep(100 * time.Millisecond); return nil }
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{HandlerTimeout: 10 * time.Millisecond}); err == nil {
+		t.Errorf("App registration did not timeout slow handler")
+	}
+	if s.app(tx.Request().ShardId) != nil {
+		t.Errorf("App should not remain registered after failed replay")
+	}
+}
+
+func TestPause(t *testing.T) {
+	s, tx := setupReplayShard()
+
+	// cannot pause without registration
+	if err := s.Pause(); err == nil {
+		t.Errorf("should not pause unregistered app")
+	}
+
+	count := 0
+	txHandler := func(tx dto.Transaction, state state.State) error { count += 1; return nil }
+	s.Register(tx.Request().ShardId, txHandler)
+	if err := s.Pause(); err != nil {
+		t.Errorf("Failed to pause app: %s", err)
+	}
+	if app := s.app(tx.Request().ShardId); app == nil || app.appTxHandler != nil {
+		t.Errorf("app not paused correctly")
+	}
+
+	// transactions should continue to be handled for paused shard without calling app
+	tx2, _ := SignedShardTransaction("paused payload")
+	s.LockState()
+	if err := s.Handle(tx2); err != nil {
+		t.Errorf("paused shard transaction handling failed: %s", err)
+	}
+	s.UnlockState()
+	if count != 1 {
+		t.Errorf("paused app should not be called: %d", count)
+	}
+
+	// anchors should still be available for syncing paused shard
+	if err := s.Anchor(&dto.Anchor{}); err != nil {
+		t.Errorf("paused shard should provide anchor: %s", err)
+	}
+}
+
+func TestRegisterWithOptions_ExternalState(t *testing.T) {
+	s, tx := setupReplayShard()
+
+	// app with external state should not be able to put resources into world state
+	var putErr error
+	txHandler := func(tx dto.Transaction, ws state.State) error {
+		putErr = ws.Put(&state.Resource{Key: []byte("key"), Value: []byte("value")})
+		return nil
+	}
+	if err := s.RegisterWithOptions(tx.Request().ShardId, txHandler, &RegisterOptions{ExternalState: true}); err != nil {
+		t.Errorf("App registration failed: %s", err)
+	}
+	if putErr == nil {
+		t.Errorf("external state app should not update stack managed world state")
+	}
+	if _, err := s.GetState([]byte("key")); err == nil {
+		t.Errorf("external state app should not read stack managed world state")
+	}
+
+	// consistency token should be updated to replayed transaction
+	s.LockState()
+	defer s.UnlockState()
+	if id, seq := s.LastApplied(tx.Request().ShardId); id != tx.Id() || seq != tx.Anchor().ShardSeq {
+		t.Errorf("consistency token not updated after replay")
+	}
+}
+
+func TestHandlerContext(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+
+	// app handler should see the transaction being applied in state's context
+	var currentId [64]byte
+	var currentSeq uint64
+	txHandler := func(tx dto.Transaction, state state.State) error {
+		currentId, currentSeq = state.Current()
+		return nil
+	}
+	s.Register(tx.Request().ShardId, txHandler)
+	s.LockState()
+	if err := s.Handle(tx); err != nil {
+		t.Errorf("Transaction handling failed: %s", err)
+	}
+	if currentId != tx.Id() || currentSeq != tx.Anchor().ShardSeq {
+		t.Errorf("incorrect handler context: %x, %d", currentId, currentSeq)
+	}
+	s.CommitState(tx)
+	s.UnlockState()
+
+	// cursor should be updated after commit
+	if id, seq := s.LastApplied(tx.Request().ShardId); id != tx.Id() || seq != tx.Anchor().ShardSeq {
+		t.Errorf("incorrect last applied cursor: %x, %d", id, seq)
+	}
+
+	// unknown shard should have empty cursor
+	if id, seq := s.LastApplied([]byte("unknown shard")); id != [64]byte{} || seq != 0 {
+		t.Errorf("unknown shard should not have applied cursor")
+	}
+}
+
+// anchor should merge at most configured number of tips as uncles
+func TestAnchorMaxUncles(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+	s.SetMaxUncles(2)
+
+	// register an app
+	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
+	s.Register([]byte("test shard"), txHandler)
+
+	// add 4 child network transactions for genesis, i.e. 4 tips
+	for _, payload := range []string{"child1", "child2", "child3", "child4"} {
+		child, _ := SignedShardTransaction(payload)
+		s.db.AddTx(child)
+		s.LockState()
+		s.Handle(child)
+		s.CommitState(child)
+		s.UnlockState()
+	}
+
+	a := dto.Anchor{}
+	if err := s.Anchor(&a); err != nil {
+		t.Errorf("Anchor update failed: %s", err)
+	}
+	if len(a.ShardUncles) != 2 {
+		t.Errorf("Incorrect shard uncle count: %d", len(a.ShardUncles))
+	}
+	// weight should only include merged tips
+	if a.Weight != (1+1+1)+1 {
+		t.Errorf("Incorrect shard weight: %d", a.Weight)
+	}
+}
+
+// tip merge transactions should not be delivered to app
+func TestHandleTipMerge(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+	called := false
+	txHandler := func(tx dto.Transaction, state state.State) error {
+		called = true
+		return nil
+	}
+	s.Register([]byte("test shard"), txHandler)
+
+	tx, _ := SignedShardTransaction(string(TipMergePayload))
+	tx.Request().SubmitterId = tx.Anchor().NodeId
+	if !IsTipMerge(tx) {
+		t.Errorf("transaction not identified as tip merge")
+	}
+	s.db.AddTx(tx)
+	s.LockState()
+	if err := s.Handle(tx); err != nil {
+		t.Errorf("failed to handle tip merge: %s", err)
+	}
+	s.UnlockState()
+	if called {
+		t.Errorf("tip merge transaction should not be delivered to app")
+	}
+}
+
+// resource values should be queryable as of a shard sequence
+func TestGetStateAtSeq(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	txHandler := func(tx dto.Transaction, s state.State) error {
+		return s.Put(&state.Resource{Key: []byte("key"), Value: tx.Request().Payload})
+	}
+	tx1, _ := SignedShardTransaction("value 1")
+	tx2 := dto.TestSignedTransaction("value 2")
+	tx2.Anchor().ShardParent = tx1.Id()
+	tx2.Anchor().ShardSeq = tx1.Anchor().ShardSeq + 1
+	shardId := tx1.Request().ShardId
+	s.Register(shardId, txHandler)
+	for _, tx := range []dto.Transaction{tx1, tx2} {
+		s.db.AddTx(tx)
+		s.LockState()
+		if err := s.Handle(tx); err != nil {
+			t.Errorf("Transaction handling failed: %s", err)
+		}
+		s.CommitState(tx)
+		s.UnlockState()
+	}
+	// value as of each sequence should be as per transaction at that sequence
+	for seq, expected := range map[uint64]string{1: "value 1", 2: "value 2", 5: "value 2"} {
+		if r, err := s.GetStateAtSeq(shardId, seq, []byte("key")); err != nil {
+			t.Errorf("Failed to get state at seq %d: %s", seq, err)
+		} else if string(r.Value) != expected {
+			t.Errorf("Incorrect value at seq %d: %s", seq, r.Value)
+		}
+	}
+	// resource did not exist before its first transaction
+	if _, err := s.GetStateAtSeq(shardId, 0, []byte("key")); err == nil {
+		t.Errorf("did not expect resource before its creation")
+	}
+	// history should be flushed along with shard
+	s.Flush(shardId)
+	if _, err := s.GetStateAtSeq(shardId, 2, []byte("key")); err == nil {
+		t.Errorf("did not expect resource history after flush")
+	}
+}
+
+// resources owned by transaction submitters should be listed from registered shard's state
+func TestListByOwner(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	if _, err := s.ListByOwner([]byte("owner")); err == nil {
+		t.Errorf("did not expect listing without registered app")
+	}
+	txHandler := func(tx dto.Transaction, s state.State) error {
+		return s.Put(&state.Resource{Key: tx.Request().Payload, Owner: tx.Request().SubmitterId})
+	}
+	tx, _ := SignedShardTransaction("key")
+	s.Register(tx.Request().ShardId, txHandler)
+	s.db.AddTx(tx)
+	s.LockState()
+	s.Handle(tx)
+	s.CommitState(tx)
+	s.UnlockState()
+	if list, err := s.ListByOwner(tx.Request().SubmitterId); err != nil || len(list) != 1 || string(list[0].Key) != "key" {
+		t.Errorf("incorrect owned resources: %v, %v", list, err)
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2019 The trust-net Authors
+// Snapshot of a shard's world state and tips, and seeding of a shard from a snapshot
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io"
+)
+
+// export a snapshot of a shard's persisted world state, along with shard's tips it corresponds to
+func (s *sharder) Snapshot(shardId []byte, w io.Writer, codec common.Codec) (*state.SnapshotHeader, error) {
+	if app := s.app(shardId); app != nil && app.externalState {
+		return nil, fmt.Errorf("world state is managed externally by app")
+	}
+	ws, err := state.NewWorldState(s.dbp, shardId)
+	if err != nil {
+		return nil, err
+	}
+	_, seq := ws.LastApplied()
+	tips := [][]byte{}
+	for _, id := range s.db.ShardTips(shardId) {
+		node := s.db.GetShardDagNode(id)
+		if node == nil || node.Depth == 0 {
+			continue
+		}
+		// transactions of seeded DAG must all be reflected in the state
+		if node.Depth > seq {
+			return nil, fmt.Errorf("world state not applied up to shard's tips")
+		}
+		if tx := s.db.GetTx(id); tx == nil {
+			return nil, fmt.Errorf("missing tip transaction: %x", id[:8])
+		} else if data, err := codec.Marshal(tx); err != nil {
+			return nil, err
+		} else {
+			tips = append(tips, data)
+		}
+	}
+	if len(tips) == 0 {
+		return nil, fmt.Errorf("shard has no history")
+	}
+	return ws.Snapshot(w, codec.Name(), tips)
+}
+
+// seed a shard unknown locally with a snapshot's world state and tips, so that shard's transactions
+// after the snapshot can be processed without shard's earlier history
+func (s *sharder) Restore(snap *state.Snapshot, tips []dto.Transaction) error {
+	shardId := snap.Header.ShardId
+	if s.app(shardId) != nil {
+		return fmt.Errorf("app is registered for shard")
+	}
+	existing := s.db.ShardTips(shardId)
+	for _, id := range existing {
+		if node := s.db.GetShardDagNode(id); node != nil && node.Depth > 0 {
+			return fmt.Errorf("shard history already known")
+		}
+	}
+	// snapshot must be taken at shard's trusted checkpoint, if any, so that it can be verified
+	if cp := s.checkpoints.get(shardId); cp != nil {
+		found := false
+		for _, tx := range tips {
+			found = found || tx.Id() == cp.TxId
+		}
+		if !found {
+			return fmt.Errorf("snapshot not taken at trusted checkpoint")
+		} else if cp.StateRoot != [64]byte{} && cp.StateRoot != snap.Header.Root {
+			return fmt.Errorf("world state root mismatch at trusted checkpoint")
+		}
+	}
+	ws, err := state.NewWorldState(s.dbp, shardId)
+	if err != nil {
+		return err
+	}
+	ws.SetMaxValueSize(s.maxValueSize)
+	if err := ws.Restore(snap); err != nil {
+		return err
+	}
+	// tips are reflected in the restored state, and must not be applied again
+	for _, tx := range tips {
+		txId := tx.Id()
+		ws.Seen(txId[:])
+	}
+	// replace genesis only DAG of the shard with seeded DAG
+	if len(existing) > 0 {
+		if err := s.db.FlushShard(shardId); err != nil {
+			ws.Reset()
+			return err
+		}
+	}
+	genesis := GenesisShardTx(shardId)
+	s.db.AddTx(genesis)
+	for _, tx := range tips {
+		// ignore, transaction may already be in history
+		s.db.AddTx(tx)
+	}
+	if err := s.db.SeedShard(genesis, tips); err != nil {
+		ws.Reset()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright 2019 The trust-net Authors
+// Recording of transactions' state diffs, and rebuilding of world state by applying them instead of re-running app's handler
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"sort"
+)
+
+// error returned when app's transaction handler does not reproduce a transaction's recorded state diff
+var ErrDiffMismatch = fmt.Errorf("transaction handler does not reproduce recorded state diff")
+
+// world state passed to app's transaction handler, recording resources it updates
+type diffState struct {
+	state.State
+	updates map[string]*state.Resource
+}
+
+func newDiffState(ws state.State) *diffState {
+	return &diffState{
+		State:   ws,
+		updates: make(map[string]*state.Resource),
+	}
+}
+
+func (d *diffState) Put(r *state.Resource) error {
+	if err := d.State.Put(r); err != nil {
+		return err
+	}
+	d.updates[string(r.Key)] = &state.Resource{
+		Key:   append([]byte{}, r.Key...),
+		Owner: append([]byte{}, r.Owner...),
+		Value: append([]byte{}, r.Value...),
+	}
+	return nil
+}
+
+func (d *diffState) Delete(key []byte) error {
+	if err := d.State.Delete(key); err != nil {
+		return err
+	}
+	d.updates[string(key)] = nil
+	return nil
+}
+
+// state diff of a transaction from resources it updated, in order of keys
+func newStateDiff(tx dto.Transaction, updates map[string]*state.Resource) *repo.StateDiff {
+	diff := &repo.StateDiff{
+		TxId:    tx.Id(),
+		ShardId: tx.Request().ShardId,
+		Seq:     tx.Anchor().ShardSeq,
+		Updates: make([]repo.ResourceDiff, 0, len(updates)),
+	}
+	for key, r := range updates {
+		if r == nil {
+			diff.Updates = append(diff.Updates, repo.ResourceDiff{Key: []byte(key), Deleted: true})
+		} else {
+			diff.Updates = append(diff.Updates, repo.ResourceDiff{Key: r.Key, Owner: r.Owner, Value: r.Value})
+		}
+	}
+	sort.Slice(diff.Updates, func(i, j int) bool {
+		return string(diff.Updates[i].Key) < string(diff.Updates[j].Key)
+	})
+	return diff
+}
+
+// recorded state diff of a transaction, if app applies diffs and one was recorded at same shard sequence
+func (s *sharder) recordedDiff(app *shardApp, tx dto.Transaction) *repo.StateDiff {
+	if !app.applyDiffs {
+		return nil
+	}
+	if diff := s.diffs.Get(tx.Request().ShardId, tx.Id()); diff != nil && diff.Seq == tx.Anchor().ShardSeq {
+		return diff
+	}
+	return nil
+}
+
+// apply a transaction's recorded state diff to app's world state, spot-checking app's handler against
+// diff when app opted for verification
+func (s *sharder) applyDiff(app *shardApp, tx dto.Transaction, diff *repo.StateDiff, ws state.State) error {
+	txId := tx.Id()
+	ws.SetCurrent(txId, tx.Anchor().ShardSeq)
+	defer ws.SetCurrent([64]byte{}, 0)
+	if app.verifyDiffs > 0 {
+		if app.diffsApplied%uint64(app.verifyDiffs) == 0 {
+			if err := s.verifyDiff(app, tx, diff, ws); err != nil {
+				return err
+			}
+		}
+		app.diffsApplied += 1
+	}
+	for _, u := range diff.Updates {
+		var err error
+		if u.Deleted {
+			err = ws.Delete(u.Key)
+		} else {
+			err = ws.Put(&state.Resource{Key: u.Key, Owner: u.Owner, Value: u.Value})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	ws.Applied(txId, tx.Anchor().ShardSeq)
+	s.stats.recordDiffApplied(tx.Request().ShardId)
+	return nil
+}
+
+// run app's transaction handler over world state (without updating it), and compare its updates with recorded diff
+func (s *sharder) verifyDiff(app *shardApp, tx dto.Transaction, diff *repo.StateDiff, ws state.State) error {
+	overlay := newOverlayState(ws)
+	overlay.SetCurrent(tx.Id(), tx.Anchor().ShardSeq)
+	if err := s.runAppTxHandler(app.appTxHandler, tx, overlay); err != nil {
+		s.logger.Error("ALERT: transaction handler failed a transaction with recorded state diff: %x\n%s", tx.Id(), err)
+		return ErrDiffMismatch
+	}
+	overlay.commit()
+	mismatch := len(overlay.writes) != len(diff.Updates)
+	for _, u := range diff.Updates {
+		expected := &state.Resource{Key: u.Key, Owner: u.Owner, Value: u.Value}
+		if u.Deleted {
+			expected = nil
+		}
+		if actual, found := overlay.writes[string(u.Key)]; !found || !sameResource(expected, actual) {
+			mismatch = true
+		}
+	}
+	s.stats.recordDiffVerified(tx.Request().ShardId)
+	if mismatch {
+		s.logger.Error("ALERT: transaction handler does not reproduce recorded state diff of transaction: %x", tx.Id())
+		return ErrDiffMismatch
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+func failingDiffTestHandler(tx dto.Transaction, s state.State) error {
+	return errors.New("handler should not be called")
+}
+
+func TestStateDiff_Recorded(t *testing.T) {
+	s, txs := setupChainShard(3, chainTestHandler(""), &RegisterOptions{RecordDiffs: true})
+	diff := s.diffs.Get(txs[2].Request().ShardId, txs[2].Id())
+	if diff == nil || diff.Seq != 3 || len(diff.Updates) != 3 {
+		t.Fatalf("incorrect diff: %v", diff)
+	}
+	// updates should be in order of keys
+	if string(diff.Updates[0].Key) != "counter" || string(diff.Updates[0].Value) != "value 3" ||
+		string(diff.Updates[1].Key) != "value 2" || !diff.Updates[1].Deleted || string(diff.Updates[2].Key) != "value 3" {
+		t.Errorf("incorrect updates: %v", diff.Updates)
+	}
+}
+
+// world state should be rebuilt from recorded diffs without calling app's handler
+func TestStateDiff_ApplyOnReplay(t *testing.T) {
+	s, txs := setupChainShard(4, chainTestHandler(""), &RegisterOptions{RecordDiffs: true})
+	shardId := txs[0].Request().ShardId
+	if err := s.RegisterWithOptions(shardId, failingDiffTestHandler, &RegisterOptions{ResetState: true, ApplyDiffs: true}); err != nil {
+		t.Fatalf("failed to replay from diffs: %s", err)
+	}
+	if r, _ := s.GetState([]byte("counter")); r == nil || string(r.Value) != "value 4" {
+		t.Errorf("incorrect rebuilt state: %v", r)
+	}
+	if r, _ := s.GetState([]byte("value 2")); r != nil {
+		t.Errorf("deleted resource not removed: %v", r)
+	}
+	if id, seq := s.LastApplied(shardId); id != txs[3].Id() || seq != 4 {
+		t.Errorf("incorrect last applied: %x, %d", id, seq)
+	}
+	if stats := s.Stats(shardId); stats.DiffsApplied != 4 || stats.DiffsVerified != 0 {
+		t.Errorf("incorrect stats: %d applied, %d verified", stats.DiffsApplied, stats.DiffsVerified)
+	}
+}
+
+// spot-check should compare every n-th transaction's diff with handler's updates
+func TestStateDiff_Verify(t *testing.T) {
+	s, txs := setupChainShard(4, chainTestHandler(""), &RegisterOptions{RecordDiffs: true})
+	shardId := txs[0].Request().ShardId
+	opts := &RegisterOptions{ResetState: true, ApplyDiffs: true, VerifyDiffs: 2}
+	if err := s.RegisterWithOptions(shardId, chainTestHandler(""), opts); err != nil {
+		t.Fatalf("failed to replay from diffs: %s", err)
+	}
+	if stats := s.Stats(shardId); stats.DiffsApplied != 4 || stats.DiffsVerified != 2 {
+		t.Errorf("incorrect stats: %d applied, %d verified", stats.DiffsApplied, stats.DiffsVerified)
+	}
+	if err := s.RegisterWithOptions(shardId, chainTestHandler(" v2"), opts); err != ErrDiffMismatch {
+		t.Errorf("expected diff mismatch, got: %s", err)
+	} else if s.app(shardId) != nil {
+		t.Errorf("shard should not be registered after failed replay")
+	}
+}
+
+func TestStateDiff_ExternalState(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	if err := s.RegisterWithOptions([]byte("shard"), chainTestHandler(""), &RegisterOptions{ExternalState: true, RecordDiffs: true}); err == nil {
+		t.Errorf("expected diffs of external state to fail")
+	} else if s.app([]byte("shard")) != nil {
+		t.Errorf("shard should not be registered")
+	}
+}
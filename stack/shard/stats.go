@@ -0,0 +1,220 @@
+// Copyright 2019 The trust-net Authors
+// Transaction size/complexity statistics per shard for capacity planning
+package shard
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sync"
+	"time"
+)
+
+// upper bounds (in bytes) of payload size distribution buckets,
+// last bucket of the distribution counts payloads larger than largest bound
+var PayloadSizeBuckets = []uint64{256, 1024, 4096, 16384, 65536, 262144, 1048576}
+
+// statistics of transactions processed for a shard
+type ShardStats struct {
+	// number of transactions processed for the shard
+	TxCount uint64
+	// total payload bytes of all transactions processed for the shard
+	PayloadBytes uint64
+	// smallest payload size seen
+	PayloadMin uint64
+	// largest payload size seen
+	PayloadMax uint64
+	// payload size distribution, indexed same as PayloadSizeBuckets (plus one overflow bucket)
+	PayloadSizeDist []uint64
+	// total number of uncles referenced by transaction anchors
+	UncleCount uint64
+	// number of app transaction handler invocations
+	HandlerCount uint64
+	// total time spent in app transaction handler
+	HandlerTime time.Duration
+	// longest time spent in app transaction handler for a single transaction
+	HandlerMax time.Duration
+	// number of re-attempts of app transaction handler for retryable errors
+	HandlerRetries uint64
+	// number of transactions dead-lettered as invalid by app transaction handler
+	DeadLettered uint64
+	// number of internal errors reported by app transaction handler (including timeouts and panics)
+	InternalErrors uint64
+	// number of app transaction handler invocations that took longer than SlowHandlerThreshold
+	SlowHandlers uint64
+	// number of app transaction handler invocations that timed out
+	HandlerTimeouts uint64
+	// number of app transaction handler invocations that panicked
+	HandlerPanics uint64
+	// number of transactions applied from their recorded state diff instead of app transaction handler
+	DiffsApplied uint64
+	// number of recorded state diffs spot-checked against app transaction handler
+	DiffsVerified uint64
+	// number of violations of app's invariants (each halting the shard)
+	InvariantViolations uint64
+	// cumulative number of transactions processed for the shard across restarts (populated by stack
+	// from persisted counters, unlike other statistics that are since node's start)
+	TotalTxCount uint64
+}
+
+// average payload size of transactions processed for the shard
+func (s *ShardStats) AvgPayload() uint64 {
+	if s.TxCount == 0 {
+		return 0
+	}
+	return s.PayloadBytes / s.TxCount
+}
+
+// average number of uncles referenced by transaction anchors
+func (s *ShardStats) AvgUncles() float64 {
+	if s.TxCount == 0 {
+		return 0
+	}
+	return float64(s.UncleCount) / float64(s.TxCount)
+}
+
+// average time spent in app transaction handler
+func (s *ShardStats) AvgHandlerTime() time.Duration {
+	if s.HandlerCount == 0 {
+		return 0
+	}
+	return s.HandlerTime / time.Duration(s.HandlerCount)
+}
+
+func (s *ShardStats) copy() *ShardStats {
+	c := *s
+	c.PayloadSizeDist = append([]uint64{}, s.PayloadSizeDist...)
+	return &c
+}
+
+// collector of statistics for all shards seen by sharder
+type statsCollector struct {
+	shards map[string]*ShardStats
+	lock   sync.RWMutex
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		shards: make(map[string]*ShardStats),
+	}
+}
+
+func (c *statsCollector) shard(shardId []byte) *ShardStats {
+	stats, found := c.shards[string(shardId)]
+	if !found {
+		stats = &ShardStats{
+			PayloadSizeDist: make([]uint64, len(PayloadSizeBuckets)+1),
+		}
+		c.shards[string(shardId)] = stats
+	}
+	return stats
+}
+
+// record size and complexity of a processed transaction
+func (c *statsCollector) recordTx(tx dto.Transaction) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.shard(tx.Request().ShardId)
+	size := uint64(len(tx.Request().Payload))
+	if stats.TxCount == 0 || size < stats.PayloadMin {
+		stats.PayloadMin = size
+	}
+	if size > stats.PayloadMax {
+		stats.PayloadMax = size
+	}
+	stats.TxCount += 1
+	stats.PayloadBytes += size
+	stats.UncleCount += uint64(len(tx.Anchor().ShardUncles))
+	// find the distribution bucket for payload size
+	bucket := len(PayloadSizeBuckets)
+	for i, bound := range PayloadSizeBuckets {
+		if size <= bound {
+			bucket = i
+			break
+		}
+	}
+	stats.PayloadSizeDist[bucket] += 1
+}
+
+// record execution time of app's transaction handler
+func (c *statsCollector) recordHandler(shardId []byte, elapsed time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stats := c.shard(shardId)
+	stats.HandlerCount += 1
+	stats.HandlerTime += elapsed
+	if elapsed > stats.HandlerMax {
+		stats.HandlerMax = elapsed
+	}
+}
+
+// record a re-attempt of app's transaction handler
+func (c *statsCollector) recordRetry(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).HandlerRetries += 1
+}
+
+// record a transaction dead-lettered by app's transaction handler
+func (c *statsCollector) recordDeadLetter(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).DeadLettered += 1
+}
+
+// record an internal error reported by app's transaction handler
+func (c *statsCollector) recordInternalError(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).InternalErrors += 1
+}
+
+// record an app's transaction handler invocation slower than threshold
+func (c *statsCollector) recordSlowHandler(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).SlowHandlers += 1
+}
+
+// record an app's transaction handler invocation that timed out
+func (c *statsCollector) recordHandlerTimeout(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).HandlerTimeouts += 1
+}
+
+// record an app's transaction handler invocation that panicked
+func (c *statsCollector) recordHandlerPanic(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).HandlerPanics += 1
+}
+
+// record a transaction applied from its recorded state diff
+func (c *statsCollector) recordDiffApplied(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).DiffsApplied += 1
+}
+
+// record a recorded state diff spot-checked against app's transaction handler
+func (c *statsCollector) recordDiffVerified(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).DiffsVerified += 1
+}
+
+// record a violation of app's invariant
+func (c *statsCollector) recordInvariantViolation(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shard(shardId).InvariantViolations += 1
+}
+
+// get a snapshot of statistics for a shard (nil if shard was never seen)
+func (c *statsCollector) get(shardId []byte) *ShardStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if stats, found := c.shards[string(shardId)]; found {
+		return stats.copy()
+	}
+	return nil
+}
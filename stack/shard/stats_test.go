@@ -0,0 +1,124 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStats_UnknownShard(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	if stats := s.Stats([]byte("unknown shard")); stats != nil {
+		t.Errorf("should not get stats for unknown shard: %v", stats)
+	}
+}
+
+func TestStats_Approve(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	tx, _ := SignedShardTransaction("test payload")
+
+	// register an app for transaction's shard
+	txHandler := func(tx dto.Transaction, state state.State) error { time.Sleep(time.Millisecond); return nil }
+	s.Register(tx.Request().ShardId, txHandler)
+
+	// send the transaction to sharder for approval
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Approve(tx); err != nil {
+		t.Errorf("Transaction approval failed: %s", err)
+	}
+	s.CommitState(tx)
+
+	// validate stats for the shard
+	stats := s.Stats(tx.Request().ShardId)
+	if stats == nil {
+		t.Errorf("did not get stats for shard")
+		return
+	}
+	if stats.TxCount != 1 {
+		t.Errorf("incorrect transaction count: %d", stats.TxCount)
+	}
+	if stats.PayloadBytes != uint64(len("test payload")) || stats.AvgPayload() != uint64(len("test payload")) {
+		t.Errorf("incorrect payload bytes: %d", stats.PayloadBytes)
+	}
+	if stats.PayloadSizeDist[0] != 1 {
+		t.Errorf("incorrect payload size distribution: %v", stats.PayloadSizeDist)
+	}
+	if stats.HandlerCount != 1 || stats.HandlerMax < time.Millisecond || stats.AvgHandlerTime() < time.Millisecond {
+		t.Errorf("incorrect handler stats: %d, %s", stats.HandlerCount, stats.HandlerMax)
+	}
+}
+
+// transactions rejected by app's handler, or not yet committed, should not be counted
+func TestStats_RejectedNotCounted(t *testing.T) {
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	tx, _ := SignedShardTransaction("test payload")
+	s.Register(tx.Request().ShardId, func(tx dto.Transaction, state state.State) error {
+		return errors.New("rejected")
+	})
+	s.LockState()
+	defer s.UnlockState()
+	if err := s.Approve(tx); err == nil {
+		t.Errorf("Expected transaction to be rejected")
+	}
+	if stats := s.Stats(tx.Request().ShardId); stats == nil || stats.TxCount != 0 || stats.HandlerCount != 1 {
+		t.Errorf("incorrect stats of rejected transaction: %v", stats)
+	}
+}
+
+func TestStats_HandleUnregisteredShard(t *testing.T) {
+	testDb := repo.NewMockDltDb()
+	s, _ := NewSharder(testDb, db.NewInMemDbProvider())
+
+	// send network transactions for a shard with no app registered
+	small, _ := SignedShardTransaction("small")
+	small.Anchor().ShardSeq = ShardSeqOne
+	if err := s.Handle(small); err != nil {
+		t.Errorf("Transaction handling failed: %s", err)
+	}
+	s.CommitState(small)
+	large, _ := SignedShardTransaction(strings.Repeat("x", 2000))
+	large.Request().ShardId = small.Request().ShardId
+	large.Anchor().ShardUncles = [][64]byte{dto.RandomHash(), dto.RandomHash()}
+	if err := s.Handle(large); err != nil {
+		t.Errorf("Transaction handling failed: %s", err)
+	}
+	s.CommitState(large)
+
+	// validate stats for the shard
+	stats := s.Stats(small.Request().ShardId)
+	if stats == nil {
+		t.Errorf("did not get stats for shard")
+		return
+	}
+	if stats.TxCount != 2 {
+		t.Errorf("incorrect transaction count: %d", stats.TxCount)
+	}
+	if stats.PayloadMin != 5 || stats.PayloadMax != 2000 {
+		t.Errorf("incorrect payload min/max: %d/%d", stats.PayloadMin, stats.PayloadMax)
+	}
+	if stats.PayloadSizeDist[0] != 1 || stats.PayloadSizeDist[2] != 1 {
+		t.Errorf("incorrect payload size distribution: %v", stats.PayloadSizeDist)
+	}
+	if stats.UncleCount != 2 || stats.AvgUncles() != 1.0 {
+		t.Errorf("incorrect uncle stats: %d", stats.UncleCount)
+	}
+	// no app handler should have been invoked
+	if stats.HandlerCount != 0 {
+		t.Errorf("unexpected handler invocations: %d", stats.HandlerCount)
+	}
+
+	// stats returned should be a snapshot
+	stats.PayloadSizeDist[0] = 100
+	if s.Stats(small.Request().ShardId).PayloadSizeDist[0] != 1 {
+		t.Errorf("stats snapshot should not modify collected stats")
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2019 The trust-net Authors
+// Application defined invariants of world state, evaluated after applied transactions to halt a shard on violation
+package shard
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+)
+
+// an invariant of an app's world state, e.g. total credits conserved
+type StateValidator struct {
+	// name of invariant, for alerts
+	Name string
+	// check world state (including updates of transaction just applied), returns an error when invariant
+	// does not hold
+	Check func(state state.State) error
+	// evaluate only after transactions completing an epoch (shard sequence a multiple of EpochLength),
+	// e.g. for expensive checks scanning all resources, otherwise after each applied transaction
+	PerEpoch bool
+}
+
+// error returned for transactions of a shard halted on an invariant violation, until app re-registers
+var ErrShardHalted = dto.NewTxError(dto.ErrAppPaused, "shard halted on invariant violation")
+
+// violation of an app's invariant by an applied transaction, transaction is not committed and its shard is halted
+type InvariantViolation struct {
+	ShardId   []byte
+	Validator string
+	// transaction after which invariant did not hold
+	TxId   [64]byte
+	Seq    uint64
+	Reason string
+}
+
+func (v *InvariantViolation) Error() string {
+	return fmt.Sprintf("invariant %s violated by transaction %x: %s", v.Validator, v.TxId, v.Reason)
+}
+
+func (v *InvariantViolation) ErrorCode() dto.ErrorCode {
+	return dto.ErrRejected
+}
+
+// evaluate app's invariants over world state after a transaction was applied, halting app's shard on violation
+func (s *sharder) validate(app *shardApp, tx dto.Transaction, ws state.State) error {
+	seq := tx.Anchor().ShardSeq
+	for _, validator := range app.validators {
+		if validator.PerEpoch && (EpochLength == 0 || seq%EpochLength != 0) {
+			continue
+		}
+		if err := s.runValidator(validator, ws); err != nil {
+			app.halted = &InvariantViolation{
+				ShardId:   app.shardId,
+				Validator: validator.Name,
+				TxId:      tx.Id(),
+				Seq:       seq,
+				Reason:    err.Error(),
+			}
+			s.logger.Error("ALERT: halting shard %x: %s", app.shardId, app.halted)
+			s.stats.recordInvariantViolation(app.shardId)
+			return app.halted
+		}
+	}
+	return nil
+}
+
+// run an invariant check, converting a panic into a violation
+func (s *sharder) runValidator(validator StateValidator, ws state.State) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("validator panicked: %v", r)
+		}
+	}()
+	return validator.Check(ws)
+}
@@ -0,0 +1,107 @@
+// Copyright 2019 The trust-net Authors
+package shard
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/db"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// invariant that counter never reaches a value
+func counterNot(value string) StateValidator {
+	return StateValidator{
+		Name: "counter",
+		Check: func(s state.State) error {
+			if r, _ := s.Get([]byte("counter")); r != nil && string(r.Value) == value {
+				return errors.New("counter reached " + value)
+			}
+			return nil
+		},
+	}
+}
+
+// a violation should fail the transaction without committing it, and halt shard until app re-registers
+func TestValidators_HaltOnViolation(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	txs := chainTestTxs(2)
+	// a sibling of violating transaction
+	sibling := dto.TestSignedTransaction("value 3")
+	sibling.Anchor().ShardParent, sibling.Anchor().ShardSeq = txs[0].Id(), 2
+	shardId := txs[0].Request().ShardId
+	opts := &RegisterOptions{Validators: []StateValidator{counterNot("value 2")}}
+	s.RegisterWithOptions(shardId, chainTestHandler(""), opts)
+	if err := addLogTx(s, txs[0]); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	}
+	err := addLogTx(s, txs[1])
+	if v, ok := err.(*InvariantViolation); !ok || v.Validator != "counter" || v.TxId != txs[1].Id() || v.Seq != 2 {
+		t.Fatalf("expected invariant violation, got: %v", err)
+	}
+	if r, _ := s.GetState([]byte("counter")); r == nil || string(r.Value) != "value 1" {
+		t.Errorf("violating transaction should not be committed: %v", r)
+	}
+	if err := addLogTx(s, sibling); err != ErrShardHalted {
+		t.Errorf("expected halted shard, got: %v", err)
+	}
+	if stats := s.Stats(shardId); stats.InvariantViolations != 1 {
+		t.Errorf("incorrect violations: %d", stats.InvariantViolations)
+	}
+	// re-registration (e.g. with a fixed app) resumes shard
+	opts.Validators = []StateValidator{counterNot("value 9")}
+	if err := s.RegisterWithOptions(shardId, chainTestHandler(""), opts); err != nil {
+		t.Fatalf("failed to re-register: %s", err)
+	}
+	if err := addLogTx(s, sibling); err != nil {
+		t.Errorf("resumed shard failed transaction: %s", err)
+	}
+}
+
+// per epoch invariants should only be evaluated after transactions completing an epoch
+func TestValidators_PerEpoch(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	defer func(length uint64) { EpochLength = length }(EpochLength)
+	EpochLength = 2
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	txs := chainTestTxs(2)
+	checks := 0
+	validator := StateValidator{Name: "epoch", PerEpoch: true, Check: func(s state.State) error {
+		checks += 1
+		return nil
+	}}
+	s.RegisterWithOptions(txs[0].Request().ShardId, chainTestHandler(""), &RegisterOptions{Validators: []StateValidator{validator}})
+	for _, tx := range txs {
+		if err := addLogTx(s, tx); err != nil {
+			t.Fatalf("failed to handle transaction: %s", err)
+		}
+	}
+	if checks != 1 {
+		t.Errorf("incorrect number of checks: %d", checks)
+	}
+}
+
+// registration should fail when replayed history violates an invariant
+func TestValidators_Replay(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	s, _ := NewSharder(repo.NewMockDltDb(), db.NewInMemDbProvider())
+	txs := chainTestTxs(2)
+	shardId := txs[0].Request().ShardId
+	s.Register(shardId, chainTestHandler(""))
+	for _, tx := range txs {
+		addLogTx(s, tx)
+	}
+	opts := &RegisterOptions{ResetState: true, Validators: []StateValidator{counterNot("value 2")}}
+	if _, ok := s.RegisterWithOptions(shardId, chainTestHandler(""), opts).(*InvariantViolation); !ok {
+		t.Errorf("expected registration to fail on violation")
+	} else if s.app(shardId) != nil {
+		t.Errorf("shard should not be registered after violation")
+	}
+	opts = &RegisterOptions{ExternalState: true, Validators: []StateValidator{counterNot("value 2")}}
+	if err := s.RegisterWithOptions(shardId, chainTestHandler(""), opts); err == nil {
+		t.Errorf("expected validators of external state to fail")
+	}
+}
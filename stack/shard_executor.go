@@ -0,0 +1,197 @@
+// Copyright 2019 The trust-net Authors
+// Per-shard execution queues for network transactions
+package stack
+
+import (
+	"sync"
+)
+
+// max number of pending jobs per shard queue
+var ShardQueueSize = 100 * 12
+
+// max number of shards executing jobs concurrently
+var ShardWorkers = 4
+
+// pass increment of a shard with weight 1, a shard with weight w advances by strideUnit/w per job
+const strideUnit = uint64(1 << 20)
+
+// pending jobs of a shard, with the shard's position in weighted schedule
+type shardQueue struct {
+	jobs    []func()
+	running bool
+	// virtual time of shard's next job, and its increment per job
+	pass   uint64
+	stride uint64
+}
+
+// executor with an independent queue per shard, jobs for same shard are executed in order
+// of submission, while jobs for different shards are executed independent of each other so
+// that a slow shard does not build up delays for other shards. When more shards have pending
+// jobs than there are workers, shards are scheduled by stride scheduling as per their weights
+// (default 1), so that a chatty shard does not starve other shards sharing the node
+type shardExecutor struct {
+	size    int
+	workers int
+	weights map[string]int
+	queues  map[string]*shardQueue
+	running int
+	// virtual time of last scheduled job
+	vtime   uint64
+	stopped bool
+	// workers started (including those draining queues after stop), and jobs run in callers' context after stop
+	active sync.WaitGroup
+	inline sync.Mutex
+	lock   sync.Mutex
+	cond   *sync.Cond
+}
+
+func newShardExecutor(size int) *shardExecutor {
+	return newWeightedShardExecutor(size, ShardWorkers, nil)
+}
+
+// create an executor with specified number of workers, and relative weights of shards (keyed by shard id)
+func newWeightedShardExecutor(size, workers int, weights map[string]int) *shardExecutor {
+	if workers <= 0 {
+		workers = 1
+	}
+	e := &shardExecutor{
+		size:    size,
+		workers: workers,
+		weights: weights,
+		queues:  make(map[string]*shardQueue),
+	}
+	e.cond = sync.NewCond(&e.lock)
+	return e
+}
+
+func (e *shardExecutor) weight(shardId string) int {
+	if w := e.weights[shardId]; w > 0 {
+		return w
+	}
+	return 1
+}
+
+// queue a job for execution on specified shard, blocks while shard's queue is full
+func (e *shardExecutor) submit(shardId []byte, job func()) {
+	e.lock.Lock()
+	q, found := e.queues[string(shardId)]
+	if !found && !e.stopped {
+		q = &shardQueue{
+			stride: strideUnit / uint64(e.weight(string(shardId))),
+			pass:   e.vtime,
+		}
+		e.queues[string(shardId)] = q
+	}
+	for !e.stopped && len(q.jobs) >= e.size {
+		e.cond.Wait()
+	}
+	if e.stopped {
+		e.lock.Unlock()
+		// no workers after stop, run job in caller's context once queued jobs have been drained, and
+		// one at a time so that jobs of a shard are still not executed concurrently
+		e.active.Wait()
+		e.inline.Lock()
+		defer e.inline.Unlock()
+		job()
+		return
+	}
+	if len(q.jobs) == 0 && !q.running && q.pass < e.vtime {
+		// an idle shard does not accumulate credit for later
+		q.pass = e.vtime
+	}
+	q.jobs = append(q.jobs, job)
+	e.schedule()
+	e.lock.Unlock()
+}
+
+// start jobs of shards with lowest pass, while workers are available (called with lock held)
+func (e *shardExecutor) schedule() {
+	for e.running < e.workers {
+		var next *shardQueue
+		var nextId string
+		for id, q := range e.queues {
+			if q.running || len(q.jobs) == 0 {
+				continue
+			}
+			if next == nil || q.pass < next.pass || (q.pass == next.pass && id < nextId) {
+				next, nextId = q, id
+			}
+		}
+		if next == nil {
+			return
+		}
+		job := next.jobs[0]
+		next.jobs = next.jobs[1:]
+		next.running = true
+		e.running += 1
+		e.vtime = next.pass
+		next.pass += next.stride
+		// wake up submitters waiting for space in the queue
+		e.cond.Broadcast()
+		e.active.Add(1)
+		go e.worker(next, job)
+	}
+}
+
+func (e *shardExecutor) worker(q *shardQueue, job func()) {
+	defer e.active.Done()
+	for {
+		job()
+		e.lock.Lock()
+		if e.stopped && len(q.jobs) > 0 {
+			// drain pending jobs of the shard after stop
+			job = q.jobs[0]
+			q.jobs = q.jobs[1:]
+			e.lock.Unlock()
+			continue
+		}
+		q.running = false
+		e.running -= 1
+		if !e.stopped {
+			e.schedule()
+		}
+		e.lock.Unlock()
+		return
+	}
+}
+
+// number of shards with an active queue
+func (e *shardExecutor) count() int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return len(e.queues)
+}
+
+// number of pending jobs per shard queue, keyed by shard id
+func (e *shardExecutor) pending() map[string]int {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	pending := make(map[string]int, len(e.queues))
+	for id, q := range e.queues {
+		pending[id] = len(q.jobs)
+	}
+	return pending
+}
+
+// stop all shard workers, returns once pending jobs have been executed (caller must not hold any lock
+// that jobs need), jobs submitted after stop are executed in submitter's context
+func (e *shardExecutor) stop() {
+	e.lock.Lock()
+	if !e.stopped {
+		e.stopped = true
+		for id, q := range e.queues {
+			if !q.running && len(q.jobs) > 0 {
+				job := q.jobs[0]
+				q.jobs = q.jobs[1:]
+				q.running = true
+				e.running += 1
+				e.active.Add(1)
+				go e.worker(q, job)
+			}
+			delete(e.queues, id)
+		}
+		e.cond.Broadcast()
+	}
+	e.lock.Unlock()
+	e.active.Wait()
+}
@@ -0,0 +1,178 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShardExecutor_OrderWithinShard(t *testing.T) {
+	e := newShardExecutor(ShardQueueSize)
+	defer e.stop()
+
+	wg := sync.WaitGroup{}
+	order := []int{}
+	for i := 0; i < 10; i++ {
+		i := i
+		wg.Add(1)
+		e.submit([]byte("shard 1"), func() { order = append(order, i); wg.Done() })
+	}
+	wg.Wait()
+	for i, v := range order {
+		if i != v {
+			t.Errorf("incorrect execution order: %v", order)
+			break
+		}
+	}
+	if e.count() != 1 {
+		t.Errorf("incorrect number of shard queues: %d", e.count())
+	}
+}
+
+func TestShardExecutor_IndependentShards(t *testing.T) {
+	e := newShardExecutor(ShardQueueSize)
+	defer e.stop()
+
+	// block the first shard's worker
+	blocked := make(chan struct{})
+	e.submit([]byte("slow shard"), func() { <-blocked })
+	defer close(blocked)
+
+	// job for another shard should still execute
+	done := make(chan struct{})
+	e.submit([]byte("fast shard"), func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("slow shard blocked another shard's execution")
+	}
+}
+
+func TestShardExecutor_SubmitAfterStop(t *testing.T) {
+	e := newShardExecutor(ShardQueueSize)
+	e.stop()
+
+	// job should run in caller's context after stop
+	called := false
+	e.submit([]byte("shard 1"), func() { called = true })
+	if !called {
+		t.Errorf("job not executed after stop")
+	}
+	if e.count() != 0 {
+		t.Errorf("no shard queues expected after stop: %d", e.count())
+	}
+}
+
+func TestShardExecutor_StopDrainsQueue(t *testing.T) {
+	e := newShardExecutor(ShardQueueSize)
+
+	// block the shard's worker, with more jobs queued behind it
+	blocked := make(chan struct{})
+	lock := sync.Mutex{}
+	order := []int{}
+	record := func(i int) func() {
+		return func() {
+			lock.Lock()
+			defer lock.Unlock()
+			order = append(order, i)
+		}
+	}
+	e.submit([]byte("shard 1"), func() { <-blocked; record(0)() })
+	e.submit([]byte("shard 1"), record(1))
+	stopped := make(chan struct{})
+	go func() {
+		e.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Errorf("stop returned before pending jobs were executed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a job submitted after stop should execute only after shard's queued jobs
+	submitted := make(chan struct{})
+	go func() {
+		e.submit([]byte("shard 1"), record(2))
+		close(submitted)
+	}()
+	close(blocked)
+	for _, done := range []chan struct{}{stopped, submitted} {
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("executor did not drain after stop")
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	if len(order) != 3 || order[0] != 0 || order[1] != 1 || order[2] != 2 {
+		t.Errorf("incorrect execution order: %v", order)
+	}
+}
+
+// run jobs for shards on a single worker, once all are queued, and return order of execution
+func scheduledOrder(weights map[string]int, jobs []string) []string {
+	e := newWeightedShardExecutor(ShardQueueSize, 1, weights)
+	defer e.stop()
+
+	// block the worker until all jobs are queued
+	blocked := make(chan struct{})
+	e.submit([]byte("blocker"), func() { <-blocked })
+	wg := sync.WaitGroup{}
+	order := []string{}
+	for _, shardId := range jobs {
+		shardId := shardId
+		wg.Add(1)
+		e.submit([]byte(shardId), func() { order = append(order, shardId); wg.Done() })
+	}
+	close(blocked)
+	wg.Wait()
+	return order
+}
+
+func TestShardExecutor_FairScheduling(t *testing.T) {
+	// a chatty shard should not hold up a quiet shard's jobs
+	order := scheduledOrder(nil, []string{"a", "a", "a", "a", "b", "b"})
+	if strings.Join(order, ",") != "a,b,a,b,a,a" {
+		t.Errorf("incorrect schedule: %v", order)
+	}
+}
+
+func TestShardExecutor_WeightedScheduling(t *testing.T) {
+	// shard with twice the weight should get twice the share
+	order := scheduledOrder(map[string]int{"a": 2}, []string{"a", "a", "a", "a", "a", "a", "b", "b", "b"})
+	if strings.Join(order, ",") != "a,b,a,a,b,a,a,b,a" {
+		t.Errorf("incorrect schedule: %v", order)
+	}
+}
+
+func TestShardExecutor_QueueFull(t *testing.T) {
+	e := newWeightedShardExecutor(1, 1, nil)
+	defer e.stop()
+
+	// block the worker, and fill the shard's queue
+	blocked := make(chan struct{})
+	e.submit([]byte("shard 1"), func() { <-blocked })
+	e.submit([]byte("shard 1"), func() {})
+
+	// submission should block until queue has space
+	submitted := make(chan struct{})
+	go func() {
+		e.submit([]byte("shard 1"), func() {})
+		close(submitted)
+	}()
+	select {
+	case <-submitted:
+		t.Errorf("submission to full queue did not block")
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(blocked)
+	select {
+	case <-submitted:
+	case <-time.After(time.Second):
+		t.Errorf("submission blocked after queue had space")
+	}
+}
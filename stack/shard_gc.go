@@ -0,0 +1,95 @@
+// Copyright 2019 The trust-net Authors
+// Garbage collection of abandoned shards, i.e. shards with no registered app and no new transactions for a while
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"io"
+	"sync"
+	"time"
+)
+
+// period without new transactions after which a shard with no registered app is considered abandoned
+var AbandonedShardPeriod = 7 * 24 * time.Hour
+
+// shards collected by node, not stored any more unless an app registers for them or they are joined
+type collectedShards struct {
+	shards map[string]bool
+	lock   sync.RWMutex
+}
+
+func newCollectedShards() *collectedShards {
+	return &collectedShards{
+		shards: make(map[string]bool),
+	}
+}
+
+func (c *collectedShards) add(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.shards[string(shardId)] = true
+}
+
+func (c *collectedShards) remove(shardId []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.shards, string(shardId))
+}
+
+func (c *collectedShards) has(shardId []byte) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.shards[string(shardId)]
+}
+
+// get registry info of a shard if it's abandoned, nil otherwise (called with lock held), shards with
+// pinned transactions are never abandoned
+func (d *dlt) abandoned(shardId []byte, now time.Time) *repo.ShardInfo {
+	if d.policies.AbandonedShardPeriod <= 0 || d.registered(shardId) != nil || d.joins.member(shardId) || len(d.pins(shardId)) > 0 {
+		return nil
+	}
+	info := d.db.GetShardInfo(shardId)
+	if info == nil || info.LastTxAt == 0 || now.Sub(time.Unix(0, info.LastTxAt)) < d.policies.AbandonedShardPeriod {
+		return nil
+	}
+	return info
+}
+
+func (d *dlt) AbandonedShards() []*repo.ShardInfo {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	now := time.Now()
+	shards := []*repo.ShardInfo{}
+	for _, shardId := range d.db.GetShards() {
+		if info := d.abandoned(shardId, now); info != nil {
+			shards = append(shards, info)
+		}
+	}
+	return shards
+}
+
+func (d *dlt) CollectShard(shardId []byte, w io.Writer) error {
+	d.lock.Lock()
+	info := d.abandoned(shardId, time.Now())
+	d.lock.Unlock()
+	if info == nil {
+		return errors.New("shard is not abandoned")
+	}
+	if err := d.ExportShard(shardId, w); err != nil {
+		return err
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// shard must not have changed while it was archived
+	if latest := d.abandoned(shardId, time.Now()); latest == nil || latest.LastTxAt != info.LastTxAt || latest.TxCount != info.TxCount {
+		return errors.New("shard changed while archiving")
+	}
+	if err := d.sharder.DropShard(shardId); err != nil {
+		return err
+	}
+	d.collected.add(shardId)
+	d.announceShards()
+	d.logger.Debug("Collected abandoned shard %x with %d transactions", shardId, info.TxCount)
+	return nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"bytes"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+	"time"
+)
+
+// shards with no registered app and no new transactions should be reported abandoned, and collected into an archive
+func TestCollectShard(t *testing.T) {
+	stack, sharder, _, _ := initMocks()
+	other := []byte("another shard")
+	txHandler := func(tx dto.Transaction, state state.State) error { return nil }
+	stack.Register(other, "another app", txHandler)
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = other
+	if _, err := stack.Submit(submitter.NewRequest("test payload")); err != nil {
+		t.Fatalf("Submission failed: %s", err)
+	}
+	stack.UnregisterShard(other)
+	stack.policies.AbandonedShardPeriod = time.Millisecond
+	time.Sleep(2 * time.Millisecond)
+
+	shards := stack.AbandonedShards()
+	if len(shards) != 1 || string(shards[0].ShardId) != string(other) {
+		t.Fatalf("Incorrect abandoned shards: %v", shards)
+	}
+	if err := stack.CollectShard(TestAppConfig().ShardId, &bytes.Buffer{}); err == nil {
+		t.Errorf("Expected collection of registered app's shard to fail")
+	}
+	archive := &bytes.Buffer{}
+	if err := stack.CollectShard(other, archive); err != nil || !sharder.DropCalled {
+		t.Fatalf("Shard collection failed: %s", err)
+	}
+	if archive.Len() == 0 || stack.db.GetShardInfo(other) != nil {
+		t.Errorf("Shard not archived and deleted")
+	}
+	if stack.isStored(other) {
+		t.Errorf("Collected shard should not be stored")
+	}
+	// shard should be stored again once an app registers for it
+	stack.Register(other, "another app", txHandler)
+	if !stack.isStored(other) {
+		t.Errorf("Collected shard not stored after registration")
+	}
+}
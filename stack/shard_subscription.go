@@ -0,0 +1,92 @@
+// Copyright 2019 The trust-net Authors
+// Announcement of shards stored by node, and forwarding of transactions to peers subscribed to their shards
+package stack
+
+import (
+	"encoding/hex"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"sort"
+	"sync"
+)
+
+// shards announced by connected peers, keyed by hex encoded peer id (peers that did not announce
+// their shards are forwarded transactions of all shards)
+type peerSubscriptions struct {
+	peers map[string]*ShardSubscriptionMsg
+	lock  sync.RWMutex
+}
+
+func newPeerSubscriptions() *peerSubscriptions {
+	return &peerSubscriptions{
+		peers: make(map[string]*ShardSubscriptionMsg),
+	}
+}
+
+// record a peer's announcement, unless peer has already announced a later one
+func (s *peerSubscriptions) set(peerId []byte, msg *ShardSubscriptionMsg) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if existing, found := s.peers[hex.EncodeToString(peerId)]; !found || existing.Seq < msg.Seq {
+		s.peers[hex.EncodeToString(peerId)] = msg
+	}
+}
+
+func (s *peerSubscriptions) remove(peerId []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.peers, hex.EncodeToString(peerId))
+}
+
+// check whether a peer should be forwarded transactions of a shard
+func (s *peerSubscriptions) wants(peerId, shardId []byte) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	msg, found := s.peers[hex.EncodeToString(peerId)]
+	if !found {
+		return true
+	}
+	for _, id := range msg.ShardIds {
+		if string(id) == string(shardId) {
+			return true
+		}
+	}
+	return false
+}
+
+// shards stored by node, i.e. shards of registered apps, joined shards, and known shards passing
+// node's storage filter, in order of shard id (called with lock held)
+func (d *dlt) storedShards() [][]byte {
+	unique := make(map[string]bool)
+	for _, app := range d.apps {
+		unique[string(app.ShardId)] = true
+	}
+	for _, shardId := range d.joins.members() {
+		unique[string(shardId)] = true
+	}
+	for _, shardId := range d.db.GetShards() {
+		if d.isStored(shardId) {
+			unique[string(shardId)] = true
+		}
+	}
+	shards := make([][]byte, 0, len(unique))
+	for shardId := range unique {
+		shards = append(shards, []byte(shardId))
+	}
+	sort.Slice(shards, func(i, j int) bool { return string(shards[i]) < string(shards[j]) })
+	return shards
+}
+
+// announce shards stored by node to all peers, when enabled and node's shards change (called with lock held)
+func (d *dlt) announceShards() {
+	if !d.conf.AnnounceShards {
+		return
+	}
+	msg := NewShardSubscriptionMsg(d.storedShards())
+	d.logger.Debug("Announcing %d stored shards to peers", len(msg.ShardIds))
+	d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+}
+
+func (d *dlt) handleRECV_ShardSubscriptionMsg(peer p2p.Peer, msg *ShardSubscriptionMsg) {
+	peer.Logger().Debug("Remote node subscribed to %d shards", len(msg.ShardIds))
+	d.peerSubscriptions.set(peer.ID(), msg)
+}
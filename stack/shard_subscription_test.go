@@ -0,0 +1,56 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+// transactions should only be forwarded to peers subscribed to their shard, or that did not announce shards
+func TestShardSubscription_Forwarding(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	subscribed := NewMockPeer(p2p.TestConn())
+	msg := NewShardSubscriptionMsg([][]byte{TestAppConfig().ShardId})
+	stack.handleRECV_ShardSubscriptionMsg(subscribed, msg)
+	// an earlier announcement should not replace a later one
+	stack.handleRECV_ShardSubscriptionMsg(subscribed, &ShardSubscriptionMsg{Seq: msg.Seq - 1})
+
+	if _, err := stack.Submit(dto.TestSubmitter().NewRequest("test payload")); err != nil {
+		t.Fatalf("Submission failed: %s", err)
+	}
+	if !p2pLayer.DidBroadcast || p2pLayer.BroadcastFilter == nil {
+		t.Fatalf("Transaction not broadcast with peer filter")
+	}
+	if !p2pLayer.BroadcastFilter(subscribed.ID()) {
+		t.Errorf("Transaction not forwarded to subscribed peer")
+	}
+	if !p2pLayer.BroadcastFilter([]byte("unknown peer")) {
+		t.Errorf("Transaction not forwarded to peer that did not announce shards")
+	}
+	if stack.peerSubscriptions.wants(subscribed.ID(), []byte("another shard")) {
+		t.Errorf("Transaction of another shard forwarded to subscribed peer")
+	}
+	// peer's subscription should be forgotten once it disconnects
+	stack.peerSubscriptions.remove(subscribed.ID())
+	if !stack.peerSubscriptions.wants(subscribed.ID(), []byte("another shard")) {
+		t.Errorf("Subscription of disconnected peer not removed")
+	}
+}
+
+// node should announce its stored shards when enabled, and when its shards change
+func TestShardSubscription_Announce(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	stack.announceShards()
+	if p2pLayer.DidBroadcast {
+		t.Errorf("Shards announced when not enabled")
+	}
+	stack.conf.AnnounceShards = true
+	stack.UnregisterShard(TestAppConfig().ShardId)
+	if msg, ok := p2pLayer.BroadcastMsg.(*ShardSubscriptionMsg); !ok {
+		t.Errorf("Shards not announced after unregistering app")
+	} else if len(msg.ShardIds) != 1 || string(msg.ShardIds[0]) != string(TestAppConfig().ShardId) {
+		// unregistered app's shard is still stored, since node has no storage filter
+		t.Errorf("Incorrect announced shards: %d", len(msg.ShardIds))
+	}
+}
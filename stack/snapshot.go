@@ -0,0 +1,80 @@
+// Copyright 2019 The trust-net Authors
+// Export of a shard's world state into a snapshot, and seeding of a new node from a snapshot
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"io"
+)
+
+// export a shard's world state into a snapshot, along with shard's tips it corresponds to
+func (d *dlt) ExportSnapshot(shardId []byte, w io.Writer) (*state.SnapshotHeader, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	header, err := d.sharder.Snapshot(shardId, w, d.codec)
+	if err != nil {
+		return nil, err
+	}
+	d.logger.Info("Exported snapshot of shard %x at shard seq %d, resources: %d", shardId, header.Seq, header.Count)
+	return header, nil
+}
+
+// decode and validate tip transactions of a snapshot
+func (d *dlt) snapshotTips(header *state.SnapshotHeader) ([]dto.Transaction, error) {
+	codec, err := common.CodecByName(header.Codec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %s", err)
+	}
+	tips := make([]dto.Transaction, 0, len(header.Tips))
+	for i, data := range header.Tips {
+		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+		if err := codec.Unmarshal(data, tx); err != nil {
+			return nil, fmt.Errorf("invalid snapshot tip %d: %s", i+1, err)
+		} else if tx.Request() == nil || tx.Anchor() == nil {
+			return nil, fmt.Errorf("invalid snapshot tip %d: missing request or anchor", i+1)
+		} else if string(tx.Request().ShardId) != string(header.ShardId) {
+			return nil, fmt.Errorf("snapshot tip %d of a different shard", i+1)
+		} else if tx.Anchor().ShardSeq > header.Seq {
+			return nil, fmt.Errorf("snapshot tip %d not applied to state", i+1)
+		} else if err := d.validateSignatures(tx); err != nil {
+			return nil, fmt.Errorf("snapshot tip %d: %s", i+1, err)
+		}
+		tips = append(tips, tx)
+	}
+	return tips, nil
+}
+
+func (d *dlt) RestoreSnapshot(shardId []byte, r io.Reader) (*state.SnapshotHeader, error) {
+	snap, err := state.OpenSnapshot(r)
+	if err != nil {
+		return nil, err
+	} else if string(snap.Header.ShardId) != string(shardId) {
+		return nil, fmt.Errorf("snapshot is for shard %x", snap.Header.ShardId)
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.registered(shardId) != nil {
+		return nil, errors.New("app is already registered for shard")
+	} else if d.joins.joining(shardId) {
+		return nil, errors.New("shard join in progress")
+	}
+	tips, err := d.snapshotTips(snap.Header)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.sharder.Restore(snap, tips); err != nil {
+		return nil, err
+	}
+	// shard is stored regardless of storage filter, same as a joined shard
+	d.joins.start(shardId)
+	d.joins.finish(shardId, true)
+	// catch up with shard's transactions after the snapshot from peers carrying the shard
+	msg := NewShardTipsRequestMsg(shardId)
+	d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+	d.logger.Info("Restored snapshot of shard %x at shard seq %d, resources: %d", shardId, snap.Header.Seq, snap.Header.Count)
+	return snap.Header, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"github.com/trust-net/dag-lib-go/stack/state"
+	"testing"
+)
+
+// app handler that saves each transaction's payload as a resource
+func snapshotTestHandler(tx dto.Transaction, s state.State) error {
+	return s.Put(&state.Resource{Key: tx.Request().Payload, Owner: tx.Request().SubmitterId, Value: tx.Request().Payload})
+}
+
+// create a stack with resources created by a chain of submitted transactions, and export its snapshot
+func testSnapshot(t *testing.T, count int) (*bytes.Buffer, []dto.Transaction) {
+	return testSnapshotWithCodec(t, count, common.GobCodec)
+}
+
+// create a stack using a codec with resources created by a chain of submitted transactions, and export its snapshot
+func testSnapshotWithCodec(t *testing.T, count int, codec common.Codec) (*bytes.Buffer, []dto.Transaction) {
+	stack, _, _, _ := initMocks()
+	stack.codec = codec
+	stack.Unregister()
+	stack.Register(TestAppConfig().ShardId, "test app", snapshotTestHandler)
+	submitter := dto.TestSubmitter()
+	txs := []dto.Transaction{}
+	for i := 0; i < count; i++ {
+		if tx, err := stack.Submit(submitter.NewRequest(fmt.Sprintf("resource-%d", i))); err != nil {
+			t.Fatalf("submission failed: %s", err)
+		} else {
+			submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+			txs = append(txs, tx)
+		}
+	}
+	snapshot := &bytes.Buffer{}
+	if header, err := stack.ExportSnapshot(TestAppConfig().ShardId, snapshot); err != nil {
+		t.Fatalf("export failed: %s", err)
+	} else if header.Count != uint64(count) || header.Seq != uint64(count) || len(header.Tips) != 1 {
+		t.Fatalf("incorrect snapshot header: %+v", header)
+	}
+	return snapshot, txs
+}
+
+// a new node should be seeded with snapshot's state and tips, and accept shard's later transactions
+func TestRestoreSnapshot(t *testing.T) {
+	snapshot, txs := testSnapshot(t, 3)
+	stack, _, _, mockP2P := initMocks()
+	stack.Unregister()
+	shardId := TestAppConfig().ShardId
+	if header, err := stack.RestoreSnapshot(shardId, snapshot); err != nil {
+		t.Fatalf("restore failed: %s", err)
+	} else if header.TxId != txs[2].Id() {
+		t.Errorf("incorrect snapshot tip: %x", header.TxId)
+	}
+	// shard's tip should be seeded, without its earlier history
+	if node := stack.db.GetShardDagNode(txs[2].Id()); node == nil || node.Depth != 3 {
+		t.Errorf("snapshot tip not seeded: %v", node)
+	} else if stack.db.GetShardDagNode(txs[1].Id()) != nil {
+		t.Errorf("did not expect earlier history")
+	}
+	if !mockP2P.DidBroadcast || mockP2P.BroadcastCode != ShardTipsRequestMsgCode {
+		t.Errorf("did not request shard's tips from peers")
+	}
+	// app registered for restored shard should find the state, without replay
+	replayed := 0
+	stack.RegisterWithOptions(shardId, "test app", func(tx dto.Transaction, s state.State) error {
+		replayed += 1
+		return snapshotTestHandler(tx, s)
+	}, &shard.RegisterOptions{})
+	if replayed != 0 {
+		t.Errorf("did not expect seeded tip to be replayed")
+	}
+	if r, err := stack.GetState([]byte("resource-1")); err != nil || string(r.Value) != "resource-1" {
+		t.Errorf("resource not restored: %v, %s", r, err)
+	}
+	if _, seq := stack.LastApplied(shardId); seq != 3 {
+		t.Errorf("incorrect last applied seq: %d", seq)
+	}
+	// a later transaction of the shard should be accepted on top of seeded tip
+	submitter := dto.TestSubmitter()
+	tx := submitter.NewTransaction(dto.TestAnchor(), "resource-next")
+	tx.Anchor().ShardParent, tx.Anchor().ShardSeq = txs[2].Id(), 4
+	if err := stack.handleTransaction(NewMockPeer(p2p.TestConn()), make(chan controllerEvent, 10), tx, false); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	}
+	if r, err := stack.GetState([]byte("resource-next")); err != nil || r == nil {
+		t.Errorf("later transaction not applied: %s", err)
+	}
+}
+
+// snapshot exported by a node using protobuf codec should be restored by a node using gob codec
+func TestRestoreSnapshot_ProtobufCodec(t *testing.T) {
+	snapshot, txs := testSnapshotWithCodec(t, 3, common.ProtobufCodec)
+	stack, _, _, _ := initMocks()
+	stack.Unregister()
+	if header, err := stack.RestoreSnapshot(TestAppConfig().ShardId, snapshot); err != nil {
+		t.Fatalf("restore failed: %s", err)
+	} else if header.Codec != common.ProtobufCodec.Name() || header.TxId != txs[2].Id() {
+		t.Errorf("incorrect snapshot header: %+v", header)
+	}
+	if node := stack.db.GetShardDagNode(txs[2].Id()); node == nil || node.Depth != 3 {
+		t.Errorf("snapshot tip not seeded: %v", node)
+	}
+}
+
+// snapshot should be refused for a shard whose history is already known, or when tampered
+func TestRestoreSnapshot_Refused(t *testing.T) {
+	snapshot, _ := testSnapshot(t, 2)
+	data := snapshot.Bytes()
+	shardId := TestAppConfig().ShardId
+	stack, _, _, _ := initMocks()
+	if _, err := stack.RestoreSnapshot(shardId, bytes.NewReader(data)); err == nil {
+		t.Errorf("expected restore to be refused for registered shard")
+	}
+	if _, err := stack.RestoreSnapshot([]byte("other shard"), bytes.NewReader(data)); err == nil {
+		t.Errorf("expected snapshot of different shard to be refused")
+	}
+	stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	stack.Unregister()
+	if _, err := stack.RestoreSnapshot(shardId, bytes.NewReader(data)); err == nil {
+		t.Errorf("expected restore to be refused for known shard history")
+	}
+	// a tampered resource should fail state root verification
+	stack, _, _, _ = initMocks()
+	stack.Unregister()
+	tampered := bytes.Replace(data, []byte("resource-0"), []byte("resource-X"), -1)
+	if _, err := stack.RestoreSnapshot(shardId, bytes.NewReader(tampered)); err == nil {
+		t.Errorf("expected tampered snapshot to be refused")
+	}
+	if len(stack.db.ShardTips(shardId)) > 1 {
+		t.Errorf("did not expect refused snapshot to seed shard")
+	}
+}
+
+// snapshot must be taken at shard's trusted checkpoint, when configured
+func TestRestoreSnapshot_Checkpoint(t *testing.T) {
+	snapshot, txs := testSnapshot(t, 2)
+	data := snapshot.Bytes()
+	shardId := TestAppConfig().ShardId
+	stack, _, _, _ := initMocks()
+	stack.Unregister()
+	stack.sharder.SetCheckpoint(&shard.Checkpoint{ShardId: shardId, TxId: txs[0].Id(), Seq: 1})
+	if _, err := stack.RestoreSnapshot(shardId, bytes.NewReader(data)); err == nil {
+		t.Errorf("expected snapshot not at checkpoint to be refused")
+	}
+	stack.sharder.SetCheckpoint(&shard.Checkpoint{ShardId: shardId, TxId: txs[1].Id(), Seq: 2})
+	if _, err := stack.RestoreSnapshot(shardId, bytes.NewReader(data)); err != nil {
+		t.Errorf("restore at checkpoint failed: %s", err)
+	}
+}
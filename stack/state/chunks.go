@@ -0,0 +1,125 @@
+// Copyright 2019 The trust-net Authors
+// Chunked storage of large resource values in world state
+package state
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+)
+
+// max size (bytes) of a resource value stored as a single DB record, larger values are
+// split into chunks of this size
+var ChunkSize = 64 * 1024
+
+// max size (bytes) of a resource value accepted by world state, 0 for no limit
+var MaxValueSize = 16 * 1024 * 1024
+
+// a resource as stored in DB, value of a chunked resource is stored separately in chunks
+type storedResource struct {
+	Key    []byte
+	Owner  []byte
+	Value  []byte
+	Chunks uint64
+}
+
+// key of a resource record in world state DB
+func storedResourceKey(data []byte) ([]byte, error) {
+	stored := &storedResource{}
+	if err := common.Deserialize(data, stored); err != nil {
+		return nil, err
+	}
+	return stored.Key, nil
+}
+
+// key of a resource value's chunk in chunks DB
+func chunkKey(key []byte, index uint64) []byte {
+	return append(append([]byte{}, key...), common.Uint64ToBytes(index)...)
+}
+
+// number of chunks of a persisted resource
+func (s *worldState) storedChunks(key []byte) uint64 {
+	if data, err := s.stateDb.Get(key); err == nil {
+		stored := &storedResource{}
+		if common.Deserialize(data, stored) == nil {
+			return stored.Chunks
+		}
+	}
+	return 0
+}
+
+// delete chunks of a resource value, starting at specified index
+func (s *worldState) deleteChunks(key []byte, from, count uint64) error {
+	for i := from; i < count; i++ {
+		if err := s.chunkDb.Delete(chunkKey(key, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// read a resource from its DB record, re-assembling value from chunks if needed
+func (s *worldState) readResource(data []byte) (*Resource, error) {
+	stored := &storedResource{}
+	if err := common.Deserialize(data, stored); err != nil {
+		return nil, err
+	}
+	r := &Resource{Key: stored.Key, Owner: stored.Owner, Value: stored.Value}
+	if stored.Chunks > 0 {
+		r.Value = make([]byte, 0, stored.Chunks*uint64(ChunkSize))
+		for i := uint64(0); i < stored.Chunks; i++ {
+			if chunk, err := s.chunkDb.Get(chunkKey(r.Key, i)); err != nil {
+				return nil, fmt.Errorf("missing chunk %d of resource: %s", i, err)
+			} else {
+				r.Value = append(r.Value, chunk...)
+			}
+		}
+	}
+	return r, nil
+}
+
+// write a resource into DB, splitting large value into chunks
+func (s *worldState) writeResource(r *Resource) error {
+	old := s.storedChunks(r.Key)
+	if len(r.Value) <= ChunkSize {
+		if err := s.deleteChunks(r.Key, 0, old); err != nil {
+			return err
+		}
+		if data, err := r.Serialize(); err != nil {
+			return err
+		} else {
+			return s.stateDb.Put(r.Key, data)
+		}
+	}
+	count := uint64(0)
+	for start := 0; start < len(r.Value); start += ChunkSize {
+		end := start + ChunkSize
+		if end > len(r.Value) {
+			end = len(r.Value)
+		}
+		if err := s.chunkDb.Put(chunkKey(r.Key, count), r.Value[start:end]); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := s.deleteChunks(r.Key, count, old); err != nil {
+		return err
+	}
+	if data, err := common.Serialize(&storedResource{Key: r.Key, Owner: r.Owner, Chunks: count}); err != nil {
+		return err
+	} else {
+		return s.stateDb.Put(r.Key, data)
+	}
+}
+
+// delete a resource from DB, along with its chunks
+func (s *worldState) deleteResource(key []byte) error {
+	if err := s.deleteChunks(key, 0, s.storedChunks(key)); err != nil {
+		return err
+	}
+	return s.stateDb.Delete(key)
+}
+
+// set max size of a resource value accepted by world state, 0 for no limit
+func (s *worldState) SetMaxValueSize(size int) {
+	s.maxValueSize = size
+}
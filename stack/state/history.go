@@ -0,0 +1,154 @@
+// Copyright 2019 The trust-net Authors
+// Version history of resources in world state, for queries as of a shard sequence
+package state
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"sort"
+)
+
+// a version of a resource, as updated by transactions at a shard sequence
+type version struct {
+	Seq uint64
+	// serialized resource, empty when resource was deleted
+	Data []byte
+}
+
+// versions of a resource, in order of shard sequence
+type versions []version
+
+func (h versions) Serialize() ([]byte, error) {
+	return common.Serialize(h)
+}
+
+func (h *versions) DeSerialize(data []byte) error {
+	return common.Deserialize(data, h)
+}
+
+// add a version, replacing any existing version at same shard sequence (i.e. a later
+// transaction at same sequence, in canonical order, supersedes the earlier one)
+func (h versions) add(v version) versions {
+	i := sort.Search(len(h), func(i int) bool { return h[i].Seq >= v.Seq })
+	if i < len(h) && h[i].Seq == v.Seq {
+		h[i] = v
+		return h
+	}
+	h = append(h, version{})
+	copy(h[i+1:], h[i:])
+	h[i] = v
+	return h
+}
+
+// latest version at or before a shard sequence, nil if resource had no version yet
+func (h versions) at(seq uint64) *version {
+	i := sort.Search(len(h), func(i int) bool { return h[i].Seq > seq })
+	if i == 0 {
+		return nil
+	}
+	return &h[i-1]
+}
+
+// record an update of resource by transaction currently being processed, pending persistence
+func (s *worldState) record(key string, r *Resource) {
+	v := version{Seq: s.current.seq}
+	if r != nil {
+		v.Data, _ = r.Serialize()
+	}
+	s.pending[key] = append(s.pending[key], v)
+}
+
+func (s *worldState) versions(key []byte) (versions, error) {
+	h := versions{}
+	if data, err := s.historyDb.Get(key); err == nil {
+		if err := h.DeSerialize(data); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// persist pending versions into resources' history
+func (s *worldState) persistHistory() error {
+	for k, pending := range s.pending {
+		h, err := s.versions([]byte(k))
+		if err != nil {
+			return err
+		}
+		for _, v := range pending {
+			h = h.add(v)
+		}
+		if data, err := h.Serialize(); err != nil {
+			return err
+		} else if err := s.historyDb.Put([]byte(k), data); err != nil {
+			return err
+		}
+	}
+	s.pending = make(map[string][]version)
+	return nil
+}
+
+// get value of a resource as of a shard sequence, i.e. after transactions up to that
+// sequence had been applied (only persisted updates are considered)
+func (s *worldState) GetAt(key []byte, seq uint64) (*Resource, error) {
+	if s.external {
+		return nil, errExternalState
+	}
+	h, err := s.versions(key)
+	if err != nil {
+		return nil, err
+	}
+	v := h.at(seq)
+	if v == nil || len(v.Data) == 0 {
+		return nil, fmt.Errorf("resource not found at shard seq %d", seq)
+	}
+	r := &Resource{}
+	if err := r.DeSerialize(v.Data); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// index of the first version needed to answer queries at or after a shard sequence, i.e. the version as of
+// that sequence, unless resource was deleted then
+func (h versions) from(seq uint64) int {
+	i := sort.Search(len(h), func(i int) bool { return h[i].Seq > seq })
+	if i > 0 && len(h[i-1].Data) > 0 {
+		return i - 1
+	}
+	return i
+}
+
+// prune resources' history before a shard sequence, keeping the version each resource had as of that sequence
+// (so that queries at or after the sequence are answered as before), returns number of versions dropped
+func (s *worldState) PruneHistory(seq uint64) (int, error) {
+	if s.external {
+		return 0, errExternalState
+	}
+	updates, dropped := []historyUpdate{}, 0
+	iter := s.historyDb.Iterator(nil)
+	for iter.Next() {
+		h := versions{}
+		if err := h.DeSerialize(iter.Value()); err != nil {
+			iter.Release()
+			return 0, err
+		}
+		if i := h.from(seq); i > 0 {
+			updates = append(updates, historyUpdate{key: append([]byte{}, iter.Key()...), h: h[i:]})
+			dropped += i
+		}
+	}
+	iter.Release()
+	for _, u := range updates {
+		if len(u.h) == 0 {
+			if err := s.historyDb.Delete(u.key); err != nil {
+				return 0, err
+			}
+		} else if data, err := u.h.Serialize(); err != nil {
+			return 0, err
+		} else if err := s.historyDb.Put(u.key, data); err != nil {
+			return 0, err
+		}
+	}
+	return dropped, nil
+}
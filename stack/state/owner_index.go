@@ -0,0 +1,166 @@
+// Copyright 2019 The trust-net Authors
+// Index of world state resources by their owner
+package state
+
+import (
+	"github.com/trust-net/dag-lib-go/common"
+	"sort"
+)
+
+// key in shard's meta data DB marking that owner index covers all resources
+var ownerIndexedKey = []byte("OwnerIndexed")
+
+// keys of resources owned by an owner, in sorted order
+type ownedKeys []string
+
+func (k ownedKeys) Serialize() ([]byte, error) {
+	return common.Serialize(k)
+}
+
+func (k *ownedKeys) DeSerialize(data []byte) error {
+	return common.Deserialize(data, k)
+}
+
+func (k ownedKeys) add(key string) ownedKeys {
+	i := sort.SearchStrings(k, key)
+	if i < len(k) && k[i] == key {
+		return k
+	}
+	k = append(k, "")
+	copy(k[i+1:], k[i:])
+	k[i] = key
+	return k
+}
+
+func (k ownedKeys) remove(key string) ownedKeys {
+	i := sort.SearchStrings(k, key)
+	if i < len(k) && k[i] == key {
+		return append(k[:i], k[i+1:]...)
+	}
+	return k
+}
+
+func (s *worldState) ownedKeys(owner []byte) (ownedKeys, error) {
+	keys := ownedKeys{}
+	if data, err := s.ownerDb.Get(owner); err == nil {
+		if err := keys.DeSerialize(data); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (s *worldState) putOwnedKeys(owner []byte, keys ownedKeys) error {
+	if len(keys) == 0 {
+		return s.ownerDb.Delete(owner)
+	} else if data, err := keys.Serialize(); err != nil {
+		return err
+	} else {
+		return s.ownerDb.Put(owner, data)
+	}
+}
+
+// owner of a persisted resource, nil if resource does not exist
+func (s *worldState) persistedOwner(key []byte) []byte {
+	if data, err := s.stateDb.Get(key); err == nil {
+		r := &Resource{}
+		if r.DeSerialize(data) == nil {
+			return r.Owner
+		}
+	}
+	return nil
+}
+
+// update owner index for pending resource updates, must be called before updates are persisted
+func (s *worldState) updateOwnerIndex() error {
+	adds, removes := make(map[string][]string), make(map[string][]string)
+	for k, r := range s.cache {
+		old := s.persistedOwner([]byte(k))
+		var owner []byte
+		if r != nil {
+			owner = r.Owner
+		}
+		if string(old) == string(owner) {
+			continue
+		}
+		if len(old) > 0 {
+			removes[string(old)] = append(removes[string(old)], k)
+		}
+		if len(owner) > 0 {
+			adds[string(owner)] = append(adds[string(owner)], k)
+		}
+	}
+	owners := make(map[string]bool)
+	for owner, _ := range adds {
+		owners[owner] = true
+	}
+	for owner, _ := range removes {
+		owners[owner] = true
+	}
+	for owner, _ := range owners {
+		keys, err := s.ownedKeys([]byte(owner))
+		if err != nil {
+			return err
+		}
+		for _, k := range removes[owner] {
+			keys = keys.remove(k)
+		}
+		for _, k := range adds[owner] {
+			keys = keys.add(k)
+		}
+		if err := s.putOwnedKeys([]byte(owner), keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// build owner index from all persisted resources, for state persisted before index was maintained
+func (s *worldState) rebuildOwnerIndex() error {
+	if err := s.ownerDb.Drop(); err != nil {
+		return err
+	}
+	index := make(map[string]ownedKeys)
+	for _, data := range s.stateDb.GetAll() {
+		r := &Resource{}
+		if err := r.DeSerialize(data); err != nil {
+			return err
+		}
+		if len(r.Owner) > 0 {
+			index[string(r.Owner)] = index[string(r.Owner)].add(string(r.Key))
+		}
+	}
+	for owner, keys := range index {
+		if err := s.putOwnedKeys([]byte(owner), keys); err != nil {
+			return err
+		}
+	}
+	return s.metaDb.Put(ownerIndexedKey, []byte{})
+}
+
+// list persisted resources owned by an owner, in order of resource keys
+func (s *worldState) ListByOwner(owner []byte) ([]*Resource, error) {
+	if s.external {
+		return nil, errExternalState
+	}
+	if indexed, _ := s.metaDb.Has(ownerIndexedKey); !indexed {
+		if err := s.rebuildOwnerIndex(); err != nil {
+			return nil, err
+		}
+	}
+	keys, err := s.ownedKeys(owner)
+	if err != nil {
+		return nil, err
+	}
+	resources := make([]*Resource, 0, len(keys))
+	for _, k := range keys {
+		if data, err := s.stateDb.Get([]byte(k)); err == nil {
+			if r, err := s.readResource(data); err != nil {
+				return nil, err
+			} else {
+				resources = append(resources, r)
+			}
+		}
+	}
+	return resources, nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2019 The trust-net Authors
+// Rollback of world state to a shard sequence, using resources' version history
+package state
+
+import (
+	"sort"
+)
+
+// a resource whose history is rewritten
+type historyUpdate struct {
+	key []byte
+	h   versions
+}
+
+// roll back resources to their values as of a shard sequence (i.e. undo updates of transactions at later
+// sequences) and drop later versions from resources' history, rollback is persisted along with any pending updates
+func (s *worldState) Rollback(seq uint64) error {
+	if s.external {
+		return errExternalState
+	}
+	// discard updates of transaction being processed, they are rolled back as well
+	s.cache = make(map[string]*Resource)
+	s.pending = make(map[string][]version)
+	updates := []historyUpdate{}
+	iter := s.historyDb.Iterator(nil)
+	for iter.Next() {
+		h := versions{}
+		if err := h.DeSerialize(iter.Value()); err != nil {
+			iter.Release()
+			return err
+		}
+		if len(h) > 0 && h[len(h)-1].Seq > seq {
+			updates = append(updates, historyUpdate{key: append([]byte{}, iter.Key()...), h: h})
+		}
+	}
+	iter.Release()
+	for _, u := range updates {
+		// restore resource's value as of sequence, or delete resource that did not exist then
+		if v := u.h.at(seq); v == nil || len(v.Data) == 0 {
+			s.cache[string(u.key)] = nil
+		} else {
+			r := &Resource{}
+			if err := r.DeSerialize(v.Data); err != nil {
+				return err
+			}
+			s.cache[string(u.key)] = r
+		}
+		// drop versions after sequence from resource's history
+		i := sort.Search(len(u.h), func(i int) bool { return u.h[i].Seq > seq })
+		if i == 0 {
+			if err := s.historyDb.Delete(u.key); err != nil {
+				return err
+			}
+		} else if data, err := u.h[:i].Serialize(); err != nil {
+			return err
+		} else if err := s.historyDb.Put(u.key, data); err != nil {
+			return err
+		}
+	}
+	return s.Persist()
+}
@@ -0,0 +1,92 @@
+// Copyright 2019 The trust-net Authors
+// Iteration over world state resources by key prefix
+package state
+
+import (
+	"sort"
+	"strings"
+)
+
+// iterator over world state resources, in order of keys
+type ResourceIterator interface {
+	// advance to next resource, returns false when there are no more resources or on error
+	Next() bool
+	// resource at iterator's current position
+	Resource() *Resource
+	// error that stopped iteration, nil at end of resources
+	Err() error
+}
+
+// iterator reading resources of keys listed when iterator was created
+type resourceIterator struct {
+	state   *worldState
+	keys    [][]byte
+	current *Resource
+	err     error
+}
+
+func (it *resourceIterator) Next() bool {
+	it.current = nil
+	for it.err == nil && len(it.keys) > 0 {
+		r, err := it.state.Get(it.keys[0])
+		it.keys = it.keys[1:]
+		if err != nil {
+			it.err = err
+		} else if r != nil {
+			// resource not deleted since iterator was created
+			it.current = r
+			return true
+		}
+	}
+	return false
+}
+
+func (it *resourceIterator) Resource() *Resource {
+	return it.current
+}
+
+func (it *resourceIterator) Err() error {
+	return it.err
+}
+
+// keys of resources starting with prefix, in order of keys, including updates not yet persisted
+func (s *worldState) Keys(prefix []byte) [][]byte {
+	if s.external {
+		return nil
+	}
+	found := make(map[string]bool)
+	it := s.stateDb.Iterator(prefix)
+	for it.Next() {
+		found[string(it.Key())] = true
+	}
+	it.Release()
+	// resources updated or deleted in cache override persisted resources
+	for k, r := range s.cache {
+		if strings.HasPrefix(k, string(prefix)) {
+			found[k] = r != nil
+		}
+	}
+	sorted := make([]string, 0, len(found))
+	for k, exists := range found {
+		if exists {
+			sorted = append(sorted, k)
+		}
+	}
+	sort.Strings(sorted)
+	keys := make([][]byte, len(sorted))
+	for i, k := range sorted {
+		keys[i] = []byte(k)
+	}
+	return keys
+}
+
+// iterate over resources with keys starting with prefix, in order of keys, including updates not yet persisted
+func (s *worldState) Scan(prefix []byte) ResourceIterator {
+	if s.external {
+		return &resourceIterator{err: errExternalState}
+	}
+	return &resourceIterator{
+		state: s,
+		keys:  s.Keys(prefix),
+	}
+}
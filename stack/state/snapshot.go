@@ -0,0 +1,139 @@
+// Copyright 2019 The trust-net Authors
+// Snapshot of a shard's world state, for seeding a new node without replaying shard's DAG
+package state
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// format version of world state snapshots
+var SnapshotVersion = uint64(1)
+
+// header of a world state snapshot, followed by the resources in order of key
+type SnapshotHeader struct {
+	Version uint64
+	ShardId []byte
+	// ID and shard sequence of the last transaction applied to the state
+	TxId [64]byte
+	Seq  uint64
+	// serialized transactions of shard's tips as of snapshot, so that shard's DAG can be seeded with them
+	Tips [][]byte
+	// name of codec tips are serialized with (gob when empty)
+	Codec string
+	// root of the world state, verified upon restore
+	Root [64]byte
+	// number of resources in the snapshot
+	Count uint64
+}
+
+// a snapshot opened for restore, whose header has been read
+type Snapshot struct {
+	Header *SnapshotHeader
+	dec    *gob.Decoder
+}
+
+// open a snapshot for restore, reading its header
+func OpenSnapshot(r io.Reader) (*Snapshot, error) {
+	dec := gob.NewDecoder(r)
+	header := &SnapshotHeader{}
+	if err := dec.Decode(header); err != nil {
+		return nil, fmt.Errorf("invalid snapshot header: %s", err)
+	} else if header.Version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version: %d", header.Version)
+	} else if len(header.ShardId) == 0 || header.Seq == 0 || len(header.Tips) == 0 {
+		return nil, fmt.Errorf("snapshot missing shard id or tips")
+	}
+	return &Snapshot{Header: header, dec: dec}, nil
+}
+
+// export all persisted resources of the world state into a snapshot, along with the transactions of shard's
+// tips the state corresponds to serialized with the named codec (pending updates are not included)
+func (s *worldState) Snapshot(w io.Writer, codec string, tips [][]byte) (*SnapshotHeader, error) {
+	if s.external {
+		return nil, errExternalState
+	}
+	header := &SnapshotHeader{
+		Version: SnapshotVersion,
+		ShardId: s.shardId,
+		Tips:    tips,
+		Codec:   codec,
+	}
+	if header.TxId, header.Seq = s.LastApplied(); header.Seq == 0 {
+		return nil, fmt.Errorf("no transaction applied to world state")
+	}
+	resources := []*Resource{}
+	for _, data := range s.stateDb.GetAll() {
+		if r, err := s.readResource(data); err != nil {
+			return nil, err
+		} else {
+			resources = append(resources, r)
+		}
+	}
+	sort.Slice(resources, func(i, j int) bool { return string(resources[i].Key) < string(resources[j].Key) })
+	header.Count = uint64(len(resources))
+	var err error
+	if header.Root, err = s.Root(); err != nil {
+		return nil, err
+	}
+	return header, s.writeSnapshot(w, header, resources)
+}
+
+func (s *worldState) writeSnapshot(w io.Writer, header *SnapshotHeader, resources []*Resource) error {
+	enc := gob.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+	for _, r := range resources {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replace world state with resources of a snapshot, the state is recorded as applied with snapshot's
+// last applied transaction (which is marked as seen), and is not persisted unless snapshot's root is verified
+func (s *worldState) Restore(snap *Snapshot) error {
+	header := snap.Header
+	if s.external {
+		return errExternalState
+	} else if string(header.ShardId) != string(s.shardId) {
+		return fmt.Errorf("snapshot is for shard %x", header.ShardId)
+	}
+	if err := s.Reset(); err != nil {
+		return err
+	}
+	// resources' history starts at snapshot's shard sequence
+	s.SetCurrent(header.TxId, header.Seq)
+	defer s.SetCurrent([64]byte{}, 0)
+	for i := uint64(0); i < header.Count; i++ {
+		r := &Resource{}
+		if err := snap.dec.Decode(r); err != nil {
+			s.discard()
+			return fmt.Errorf("invalid snapshot resource %d: %s", i+1, err)
+		} else if err := s.Put(r); err != nil {
+			s.discard()
+			return err
+		}
+	}
+	if root, err := s.Root(); err != nil {
+		s.discard()
+		return err
+	} else if root != header.Root {
+		s.discard()
+		return fmt.Errorf("world state root mismatch for snapshot")
+	}
+	s.Seen(header.TxId[:])
+	s.Applied(header.TxId, header.Seq)
+	return s.Persist()
+}
+
+// drop updates pending persistence
+func (s *worldState) discard() {
+	s.cache = make(map[string]*Resource)
+	s.pending = make(map[string][]version)
+	s.applied = nil
+}
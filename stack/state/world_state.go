@@ -3,8 +3,11 @@
 package state
 
 import (
+	"crypto/sha512"
 	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
+	"sort"
 //	"sync"
 )
 
@@ -18,13 +21,76 @@ type State interface {
 	Persist() error
 	Reset() error
 	Close() error
+	// consistency token for apps maintaining external stores, i.e. ID and shard sequence of the last
+	// transaction applied to the shard's state (zero values if no transaction has been applied yet)
+	LastApplied() ([64]byte, uint64)
+	// record transaction as applied to the state (used by stack), persisted along with resource updates
+	Applied(txId [64]byte, seq uint64)
+	// ID and shard sequence of the transaction currently being processed by app's handler
+	Current() ([64]byte, uint64)
+	// set the transaction currently being processed by app's handler (used by stack)
+	SetCurrent(txId [64]byte, seq uint64)
+	// hash of all resources in the state, including updates not yet persisted
+	Root() ([64]byte, error)
+	// value of a resource as of a shard sequence, i.e. after transactions up to that sequence were applied
+	GetAt(key []byte, seq uint64) (*Resource, error)
+	// roll back resources to their values as of a shard sequence, dropping later versions from resources' history
+	Rollback(seq uint64) error
+	// prune resources' history before a shard sequence, keeping each resource's version as of that sequence,
+	// returns number of versions dropped
+	PruneHistory(seq uint64) (int, error)
+	// resources owned by an owner, using an index maintained upon resource updates
+	ListByOwner(owner []byte) ([]*Resource, error)
+	// iterate over resources with keys starting with prefix (all resources for empty prefix), in order of keys,
+	// including updates not yet persisted
+	Scan(prefix []byte) ResourceIterator
+	// keys of resources starting with prefix (all keys for empty prefix), in order of keys, including updates
+	// not yet persisted
+	Keys(prefix []byte) [][]byte
 }
 
+// a transaction's position in the shard
+type cursor struct {
+	txId [64]byte
+	seq  uint64
+}
+
+func (c *cursor) bytes() []byte {
+	return append(append([]byte{}, c.txId[:]...), common.Uint64ToBytes(c.seq)...)
+}
+
+// key for consistency token in shard's meta data DB
+var lastAppliedKey = []byte("LastApplied")
+
+// false positive rate of bloom filters over resource keys of world state, so that lookups of
+// unknown resources do not read the DB, 0 to disable filters
+var KeyBloomFalsePositive = 0.01
+
+var errExternalState = fmt.Errorf("world state is managed externally by app")
+
 type worldState struct {
+	shardId []byte
 	stateDb db.Database
 	seenTxDb db.Database
+	metaDb db.Database
+	// versions of resources by shard sequence
+	historyDb db.Database
+	// keys of resources by owner
+	ownerDb db.Database
+	// chunks of large resource values
+	chunkDb db.Database
+	// max size of a resource value accepted, 0 for no limit
+	maxValueSize int
+	// resources are maintained by app in an external store, only seen transactions and consistency token are tracked
+	external bool
+	// consistency token pending persistence
+	applied *cursor
+	// transaction being processed by app
+	current cursor
 	// in mem cache for resource updates, until transaction is completely accepted and persisted
 	cache map[string]*Resource
+	// versions of resource updates, until transaction is completely accepted and persisted
+	pending map[string][]version
 	// TBD: following should be redundant, since we are locking at sharding layer before passing this reference
 	// to app for transaction processing -- but then we never know how app is using it. Also, protects during any
 	// reads happening outside of transaction processing
@@ -34,12 +100,14 @@ type worldState struct {
 func (s *worldState) Get(key []byte) (*Resource, error) {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
+	if s.external {
+		return nil, errExternalState
+	}
 	// first look into cache
 	if r, found := s.cache[string(key)]; !found {
 		// not found, so read from DB and cache
 		if data, err := s.stateDb.Get(key); err == nil {
-			r := &Resource{}
-			if err = r.DeSerialize(data); err == nil {
+			if r, err := s.readResource(data); err == nil {
 				s.cache[string(key)] = r
 				return r, nil
 			} else {
@@ -57,7 +125,11 @@ func (s *worldState) Get(key []byte) (*Resource, error) {
 func (s *worldState) Delete(key []byte) error {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
+	if s.external {
+		return errExternalState
+	}
 	s.cache[string(key)] = nil
+	s.record(string(key), nil)
 	return nil
 }
 
@@ -77,10 +149,17 @@ func (s *worldState) Seen(txId []byte) bool {
 func (s *worldState) Put(r *Resource) error {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
+	if s.external {
+		return errExternalState
+	}
 	if r == nil || len(r.Key) == 0 {
 		return fmt.Errorf("nil resource or key")
 	}
+	if s.maxValueSize > 0 && len(r.Value) > s.maxValueSize {
+		return fmt.Errorf("resource value too large: %d bytes, max %d", len(r.Value), s.maxValueSize)
+	}
 	s.cache[string(r.Key)] = r
+	s.record(string(r.Key), r)
 	return nil
 }
 
@@ -88,40 +167,124 @@ func (s *worldState) Close() error {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
 	s.seenTxDb.Close()
+	s.metaDb.Close()
+	s.historyDb.Close()
+	s.ownerDb.Close()
+	s.chunkDb.Close()
 	return s.stateDb.Close()
 }
 func (s *worldState) Persist() error {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
+	// update owner index while previous owners are still in DB
+	if err := s.updateOwnerIndex(); err != nil {
+		return err
+	}
 	for k, r := range s.cache {
 		if r == nil {
 			// delete from DB
-			if err := s.stateDb.Delete([]byte(k)); err != nil {
+			if err := s.deleteResource([]byte(k)); err != nil {
 				return err
 			}
 		} else {
-			// serialize resource
-			if data, err := r.Serialize(); err != nil {
+			// update in DB, chunking large value
+			if err := s.writeResource(r); err != nil {
 				return err
-			} else {
-				// update in DB
-				if err := s.stateDb.Put(r.Key, data); err != nil {
-					return err
-				}
 			}
 		}
 	}
 	// flush the cache
 	s.cache = make(map[string]*Resource)
+	// update resources' history
+	if err := s.persistHistory(); err != nil {
+		return err
+	}
+	// update consistency token
+	if s.applied != nil {
+		if err := s.metaDb.Put(lastAppliedKey, s.applied.bytes()); err != nil {
+			return err
+		}
+		s.applied = nil
+	}
 	return nil
 }
 
+func (s *worldState) LastApplied() ([64]byte, uint64) {
+	if s.applied != nil {
+		return s.applied.txId, s.applied.seq
+	}
+	txId := [64]byte{}
+	if data, err := s.metaDb.Get(lastAppliedKey); err == nil && len(data) == 72 {
+		copy(txId[:], data[:64])
+		return txId, common.BytesToUint64(data[64:])
+	}
+	return txId, 0
+}
+
+func (s *worldState) Applied(txId [64]byte, seq uint64) {
+	s.applied = &cursor{txId: txId, seq: seq}
+}
+
+func (s *worldState) Current() ([64]byte, uint64) {
+	return s.current.txId, s.current.seq
+}
+
+func (s *worldState) SetCurrent(txId [64]byte, seq uint64) {
+	s.current = cursor{txId: txId, seq: seq}
+}
+
+func (s *worldState) Root() ([64]byte, error) {
+	root := [64]byte{}
+	if s.external {
+		return root, errExternalState
+	}
+	// collect serialized resources from DB, overlaid with pending updates from cache
+	resources := make(map[string][]byte)
+	for _, data := range s.stateDb.GetAll() {
+		stored := &storedResource{}
+		if err := common.Deserialize(data, stored); err != nil {
+			return root, err
+		}
+		if stored.Chunks > 0 {
+			// hash chunked resource same as a resource stored in single record
+			if r, err := s.readResource(data); err != nil {
+				return root, err
+			} else if data, err = r.Serialize(); err != nil {
+				return root, err
+			}
+		}
+		resources[string(stored.Key)] = data
+	}
+	for k, r := range s.cache {
+		if r == nil {
+			delete(resources, k)
+		} else if data, err := r.Serialize(); err != nil {
+			return root, err
+		} else {
+			resources[k] = data
+		}
+	}
+	// hash resources in key order, so that root is same across nodes
+	keys := make([]string, 0, len(resources))
+	for k, _ := range resources {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	hash := sha512.New()
+	for _, k := range keys {
+		hash.Write(resources[k])
+	}
+	copy(root[:], hash.Sum(nil))
+	return root, nil
+}
+
 func (s *worldState) Reset() error {
 //	s.lock.Lock()
 //	defer s.lock.Unlock()
 
     // reset the cache
 	s.cache = make(map[string]*Resource)
+	s.pending = make(map[string][]version)
 
 	// delete world state DB
 	if err := s.stateDb.Drop(); err != nil {
@@ -132,18 +295,64 @@ func (s *worldState) Reset() error {
 	if err := s.seenTxDb.Drop(); err != nil {
 		return err
 	}
+
+	// delete meta data DB
+	s.applied = nil
+	if err := s.metaDb.Drop(); err != nil {
+		return err
+	}
+
+	// delete resources' history DB
+	if err := s.historyDb.Drop(); err != nil {
+		return err
+	}
+
+	// delete owner index DB
+	if err := s.ownerDb.Drop(); err != nil {
+		return err
+	}
+
+	// delete chunks DB
+	if err := s.chunkDb.Drop(); err != nil {
+		return err
+	}
 	return nil
 }
 
 func NewWorldState(dbp db.DbProvider, shardId []byte) (*worldState, error) {
 	if stateDb := dbp.DB("Shard-World-State-" + string(shardId)); stateDb != nil {
 		if seenTxDb := dbp.DB("Shard-Seen-Tx-" + string(shardId)); seenTxDb != nil {
-			return &worldState{
-				stateDb: stateDb,
-				seenTxDb: seenTxDb,
-				cache:   make(map[string]*Resource),
-			}, nil
+			if metaDb := dbp.DB("Shard-Meta-" + string(shardId)); metaDb != nil {
+				historyDb := dbp.DB("Shard-State-History-" + string(shardId))
+				ownerDb := dbp.DB("Shard-Owner-Index-" + string(shardId))
+				chunkDb := dbp.DB("Shard-World-State-Chunks-" + string(shardId))
+				if historyDb != nil && ownerDb != nil && chunkDb != nil {
+					return &worldState{
+						shardId: shardId,
+						stateDb: db.NewBloomDatabase(stateDb, KeyBloomFalsePositive, storedResourceKey),
+						seenTxDb: seenTxDb,
+						metaDb: metaDb,
+						historyDb: historyDb,
+						ownerDb: ownerDb,
+						chunkDb: chunkDb,
+						maxValueSize: MaxValueSize,
+						cache:   make(map[string]*Resource),
+						pending: make(map[string][]version),
+					}, nil
+				}
+			}
 		}
 	}
 	return nil, fmt.Errorf("could not instantiate DB")
 }
+
+// world state for apps that maintain resources in their own external store,
+// it only tracks seen transactions and the consistency token for the shard
+func NewExternalWorldState(dbp db.DbProvider, shardId []byte) (*worldState, error) {
+	if s, err := NewWorldState(dbp, shardId); err != nil {
+		return nil, err
+	} else {
+		s.external = true
+		return s, nil
+	}
+}
@@ -2,7 +2,9 @@
 package state
 
 import (
+	"bytes"
 	"github.com/trust-net/dag-lib-go/db"
+	"strings"
 	"testing"
 )
 
@@ -211,3 +213,449 @@ func TestPersistToDb(t *testing.T) {
 		}
 	}
 }
+
+func TestConsistencyToken(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	s, _ := NewWorldState(dbp, []byte("test shard"))
+	if txId, seq := s.LastApplied(); txId != [64]byte{} || seq != 0 {
+		t.Errorf("consistency token should be empty for new state")
+	}
+
+	// mark a transaction applied and persist
+	txId := [64]byte{1, 2, 3, 4}
+	s.Applied(txId, 7)
+	if id, seq := s.LastApplied(); id != txId || seq != 7 {
+		t.Errorf("pending consistency token not reported")
+	}
+	if err := s.Persist(); err != nil {
+		t.Errorf("Failed to persist: %s", err)
+	}
+
+	// a new instance of state should read the persisted token
+	s2, _ := NewWorldState(dbp, []byte("test shard"))
+	if id, seq := s2.LastApplied(); id != txId || seq != 7 {
+		t.Errorf("consistency token not persisted")
+	}
+
+	// reset should clear the token
+	s2.Reset()
+	if id, _ := s2.LastApplied(); id != [64]byte{} {
+		t.Errorf("consistency token not cleared upon reset")
+	}
+}
+
+func TestExternalWorldState(t *testing.T) {
+	s, err := NewExternalWorldState(db.NewInMemDbProvider(), []byte("test shard"))
+	if err != nil {
+		t.Errorf("Failed to create external world state: %s", err)
+		return
+	}
+
+	// resource access should not be allowed
+	if err := s.Put(&Resource{Key: []byte("key1")}); err == nil {
+		t.Errorf("external world state should not allow put")
+	}
+	if _, err := s.Get([]byte("key1")); err == nil {
+		t.Errorf("external world state should not allow get")
+	}
+	if err := s.Delete([]byte("key1")); err == nil {
+		t.Errorf("external world state should not allow delete")
+	}
+
+	// seen transactions and consistency token are still tracked
+	if s.Seen([]byte("tx1")) || !s.Seen([]byte("tx1")) {
+		t.Errorf("external world state did not track seen transactions")
+	}
+	s.Applied([64]byte{1}, 1)
+	s.Persist()
+	if id, _ := s.LastApplied(); id != [64]byte{1} {
+		t.Errorf("external world state did not track consistency token")
+	}
+}
+
+func TestCurrentTransaction(t *testing.T) {
+	s := testWorldState()
+	if id, seq := s.Current(); id != [64]byte{} || seq != 0 {
+		t.Errorf("current transaction should be empty for new state")
+	}
+	s.SetCurrent([64]byte{1}, 3)
+	if id, seq := s.Current(); id != [64]byte{1} || seq != 3 {
+		t.Errorf("incorrect current transaction: %x, %d", id, seq)
+	}
+}
+
+func TestRoot(t *testing.T) {
+	s1, s2 := testWorldState(), testWorldState()
+	empty, _ := s1.Root()
+
+	// same resources should give same root, regardless of order and persistence
+	s1.Put(&Resource{Key: []byte("key1"), Value: []byte("value1")})
+	s1.Put(&Resource{Key: []byte("key2"), Value: []byte("value2")})
+	s1.Persist()
+	s2.Put(&Resource{Key: []byte("key2"), Value: []byte("value2")})
+	s2.Put(&Resource{Key: []byte("key1"), Value: []byte("value1")})
+	root1, err1 := s1.Root()
+	root2, err2 := s2.Root()
+	if err1 != nil || err2 != nil || root1 != root2 || root1 == empty {
+		t.Errorf("incorrect state roots: %x\n%x", root1, root2)
+	}
+
+	// delete should update root
+	s1.Delete([]byte("key2"))
+	if root, _ := s1.Root(); root == root1 {
+		t.Errorf("state root not updated after delete")
+	}
+}
+
+func TestGetAt(t *testing.T) {
+	s := testWorldState()
+	key := []byte("key1")
+	// create, update and delete resource at different shard sequences
+	for seq, value := range []string{"", "value 1", "value 2", "value 3"} {
+		if seq == 0 {
+			continue
+		}
+		s.SetCurrent([64]byte{}, uint64(seq*10))
+		s.Put(&Resource{Key: key, Value: []byte(value)})
+		if seq == 2 {
+			// later update at same sequence supersedes earlier one
+			s.Put(&Resource{Key: key, Value: []byte("value 2 again")})
+		}
+		if err := s.Persist(); err != nil {
+			t.Errorf("Failed to persist: %s", err)
+		}
+	}
+	s.SetCurrent([64]byte{}, 40)
+	s.Delete(key)
+	// pending updates should not be visible in history
+	if r, err := s.GetAt(key, 40); err != nil || string(r.Value) != "value 3" {
+		t.Errorf("incorrect value before persist: %v, %v", r, err)
+	}
+	s.Persist()
+	for seq, expected := range map[uint64]string{10: "value 1", 15: "value 1", 20: "value 2 again", 39: "value 3"} {
+		if r, err := s.GetAt(key, seq); err != nil {
+			t.Errorf("failed to get value at %d: %s", seq, err)
+		} else if string(r.Value) != expected {
+			t.Errorf("incorrect value at %d: %s", seq, r.Value)
+		}
+	}
+	for _, seq := range []uint64{0, 9, 40, 100} {
+		if _, err := s.GetAt(key, seq); err == nil {
+			t.Errorf("did not expect resource at %d", seq)
+		}
+	}
+	// history should be removed upon reset
+	s.Reset()
+	if _, err := s.GetAt(key, 10); err == nil {
+		t.Errorf("did not expect history after reset")
+	}
+}
+
+func TestRollback(t *testing.T) {
+	s := testWorldState()
+	// key1 created at 10 and updated at 20, key2 created at 20, key3 created at 10 and deleted at 30
+	for _, update := range []struct {
+		seq   uint64
+		key   string
+		value string
+	}{{10, "key1", "1"}, {10, "key3", "3"}, {20, "key1", "1 again"}, {20, "key2", "2"}, {30, "key3", ""}} {
+		s.SetCurrent([64]byte{}, update.seq)
+		if len(update.value) == 0 {
+			s.Delete([]byte(update.key))
+		} else {
+			s.Put(&Resource{Key: []byte(update.key), Owner: []byte("owner"), Value: []byte(update.value)})
+		}
+		s.Persist()
+	}
+	if err := s.Rollback(15); err != nil {
+		t.Fatalf("failed to rollback: %s", err)
+	}
+	if r, err := s.Get([]byte("key1")); err != nil || string(r.Value) != "1" {
+		t.Errorf("incorrect value after rollback: %v, %v", r, err)
+	}
+	if _, err := s.Get([]byte("key2")); err == nil {
+		t.Errorf("resource created after rollback sequence not removed")
+	}
+	if r, err := s.Get([]byte("key3")); err != nil || string(r.Value) != "3" {
+		t.Errorf("deleted resource not restored: %v, %v", r, err)
+	}
+	if resources, _ := s.ListByOwner([]byte("owner")); len(resources) != 2 {
+		t.Errorf("owner index not rolled back: %d", len(resources))
+	}
+	// later versions should be dropped from history
+	if r, err := s.GetAt([]byte("key1"), 20); err != nil || string(r.Value) != "1" {
+		t.Errorf("history not rolled back: %v, %v", r, err)
+	}
+	if _, err := s.GetAt([]byte("key2"), 20); err == nil {
+		t.Errorf("history not removed for resource created after rollback sequence")
+	}
+}
+
+func TestPruneHistory(t *testing.T) {
+	s := testWorldState()
+	// key1 created at 10 and updated at 20 and 30, key2 created at 10 and deleted at 20
+	for _, update := range []struct {
+		seq   uint64
+		key   string
+		value string
+	}{{10, "key1", "1"}, {10, "key2", "2"}, {20, "key1", "1 again"}, {20, "key2", ""}, {30, "key1", "1 yet again"}} {
+		s.SetCurrent([64]byte{}, update.seq)
+		if len(update.value) == 0 {
+			s.Delete([]byte(update.key))
+		} else {
+			s.Put(&Resource{Key: []byte(update.key), Value: []byte(update.value)})
+		}
+		s.Persist()
+	}
+	// versions at 10 of key1, and all versions of key2 should be dropped
+	if dropped, err := s.PruneHistory(25); err != nil || dropped != 3 {
+		t.Fatalf("incorrect pruning: %d, %v", dropped, err)
+	}
+	for seq, expected := range map[uint64]string{20: "1 again", 25: "1 again", 30: "1 yet again"} {
+		if r, err := s.GetAt([]byte("key1"), seq); err != nil || string(r.Value) != expected {
+			t.Errorf("incorrect value at seq %d after pruning: %v, %v", seq, r, err)
+		}
+	}
+	if _, err := s.GetAt([]byte("key1"), 10); err == nil {
+		t.Errorf("version before pruning sequence not dropped")
+	}
+	if _, err := s.historyDb.Get([]byte("key2")); err == nil {
+		t.Errorf("history of resource deleted before pruning sequence not dropped")
+	}
+}
+
+func TestListByOwner(t *testing.T) {
+	s := testWorldState()
+	// resources created before index is maintained should be indexed on first query
+	r1 := &Resource{Key: []byte("key1"), Owner: []byte("owner1"), Value: []byte("1")}
+	data, _ := r1.Serialize()
+	s.stateDb.Put(r1.Key, data)
+	s.Put(&Resource{Key: []byte("key2"), Owner: []byte("owner1"), Value: []byte("2")})
+	s.Put(&Resource{Key: []byte("key3"), Owner: []byte("owner2"), Value: []byte("3")})
+	s.Persist()
+	if list, err := s.ListByOwner([]byte("owner1")); err != nil || len(list) != 2 || string(list[0].Key) != "key1" || string(list[1].Key) != "key2" {
+		t.Errorf("incorrect owner1 resources: %v, %v", list, err)
+	}
+	// ownership change and deletion should update index
+	s.Put(&Resource{Key: []byte("key2"), Owner: []byte("owner2"), Value: []byte("2")})
+	s.Delete([]byte("key3"))
+	s.Put(&Resource{Key: []byte("key1"), Owner: []byte("owner1"), Value: []byte("updated")})
+	// pending updates should not be visible in index
+	if list, _ := s.ListByOwner([]byte("owner2")); len(list) != 1 || string(list[0].Key) != "key3" {
+		t.Errorf("incorrect owner2 resources before persist: %v", list)
+	}
+	s.Persist()
+	if list, _ := s.ListByOwner([]byte("owner1")); len(list) != 1 || string(list[0].Value) != "updated" {
+		t.Errorf("incorrect owner1 resources after update: %v", list)
+	}
+	if list, _ := s.ListByOwner([]byte("owner2")); len(list) != 1 || string(list[0].Key) != "key2" {
+		t.Errorf("incorrect owner2 resources after update: %v", list)
+	}
+	if list, err := s.ListByOwner([]byte("unknown")); err != nil || len(list) != 0 {
+		t.Errorf("unknown owner should own nothing: %v, %v", list, err)
+	}
+	// index should be removed upon reset
+	s.Reset()
+	if list, _ := s.ListByOwner([]byte("owner1")); len(list) != 0 {
+		t.Errorf("did not expect owned resources after reset: %v", list)
+	}
+}
+
+func TestChunkedValue(t *testing.T) {
+	s := testWorldState()
+	key := []byte("blob")
+	large := make([]byte, ChunkSize*2+10)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	s.Put(&Resource{Key: key, Owner: []byte("owner"), Value: large})
+	rootBefore, _ := s.Root()
+	if err := s.Persist(); err != nil {
+		t.Errorf("Failed to persist: %s", err)
+	}
+	// value should be stored in chunks, and re-assembled upon read
+	if s.storedChunks(key) != 3 {
+		t.Errorf("incorrect number of chunks: %d", s.storedChunks(key))
+	}
+	if r, err := s.Get(key); err != nil || string(r.Value) != string(large) || string(r.Owner) != "owner" {
+		t.Errorf("incorrect chunked resource: %s", err)
+	}
+	// root should be same as for a value stored in single record
+	if root, _ := s.Root(); root != rootBefore {
+		t.Errorf("root changed by chunked storage")
+	}
+	if list, _ := s.ListByOwner([]byte("owner")); len(list) != 1 || len(list[0].Value) != len(large) {
+		t.Errorf("incorrect owned chunked resource")
+	}
+	// shrinking value should remove its chunks
+	s.Put(&Resource{Key: key, Value: []byte("small")})
+	s.Persist()
+	if s.storedChunks(key) != 0 || len(s.chunkDb.GetAll()) != 0 {
+		t.Errorf("chunks not removed: %d", len(s.chunkDb.GetAll()))
+	}
+	if r, _ := s.Get(key); string(r.Value) != "small" {
+		t.Errorf("incorrect value after shrink: %s", r.Value)
+	}
+	// deleting chunked value should remove its chunks
+	s.Put(&Resource{Key: key, Value: large})
+	s.Persist()
+	s.Delete(key)
+	s.Persist()
+	if len(s.chunkDb.GetAll()) != 0 {
+		t.Errorf("chunks not removed after delete")
+	}
+}
+
+func TestMaxValueSize(t *testing.T) {
+	s := testWorldState()
+	s.SetMaxValueSize(10)
+	if err := s.Put(&Resource{Key: []byte("key"), Value: make([]byte, 11)}); err == nil {
+		t.Errorf("did not expect value over size limit")
+	}
+	if err := s.Put(&Resource{Key: []byte("key"), Value: make([]byte, 10)}); err != nil {
+		t.Errorf("failed to put value within size limit: %s", err)
+	}
+	s.SetMaxValueSize(0)
+	if err := s.Put(&Resource{Key: []byte("key"), Value: make([]byte, 100)}); err != nil {
+		t.Errorf("failed to put value without size limit: %s", err)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	s := testWorldState()
+	// nothing to snapshot before any transaction is applied
+	if _, err := s.Snapshot(&bytes.Buffer{}, "", nil); err == nil {
+		t.Errorf("did not expect snapshot of state without applied transactions")
+	}
+	large := make([]byte, ChunkSize*2+1)
+	s.Put(&Resource{Key: []byte("key1"), Owner: []byte("owner"), Value: []byte("value1")})
+	s.Put(&Resource{Key: []byte("key2"), Owner: []byte("owner"), Value: large})
+	s.Applied([64]byte{1, 2, 3}, 5)
+	s.Persist()
+	root, _ := s.Root()
+
+	snapshot := &bytes.Buffer{}
+	if header, err := s.Snapshot(snapshot, "", [][]byte{[]byte("tip")}); err != nil {
+		t.Fatalf("failed to snapshot: %s", err)
+	} else if header.Count != 2 || header.Seq != 5 || header.Root != root {
+		t.Errorf("incorrect snapshot header: %+v", header)
+	}
+
+	// restore into a new node's state
+	restored := testWorldState()
+	restored.Put(&Resource{Key: []byte("stale"), Value: []byte("stale")})
+	restored.Persist()
+	snap, err := OpenSnapshot(snapshot)
+	if err != nil {
+		t.Fatalf("failed to open snapshot: %s", err)
+	}
+	if err := restored.Restore(snap); err != nil {
+		t.Fatalf("failed to restore: %s", err)
+	}
+	if r, _ := restored.Root(); r != root {
+		t.Errorf("incorrect root after restore")
+	}
+	txId, seq := restored.LastApplied()
+	if txId != [64]byte{1, 2, 3} || seq != 5 {
+		t.Errorf("incorrect last applied: %x, %d", txId[:3], seq)
+	}
+	if !restored.Seen(txId[:]) {
+		t.Errorf("last applied transaction not marked seen")
+	}
+	if list, _ := restored.ListByOwner([]byte("owner")); len(list) != 2 {
+		t.Errorf("owner index not restored: %d", len(list))
+	}
+	if r, err := restored.GetAt([]byte("key1"), 5); err != nil || string(r.Value) != "value1" {
+		t.Errorf("history not restored at snapshot seq: %s", err)
+	}
+}
+
+func TestSnapshotRestore_Invalid(t *testing.T) {
+	if _, err := OpenSnapshot(bytes.NewReader([]byte("garbage"))); err == nil {
+		t.Errorf("did not expect invalid snapshot to open")
+	}
+	s := testWorldState()
+	s.Put(&Resource{Key: []byte("key1"), Value: []byte("value1")})
+	s.Applied([64]byte{1}, 1)
+	s.Persist()
+	snapshot := &bytes.Buffer{}
+	s.Snapshot(snapshot, "", [][]byte{[]byte("tip")})
+	// snapshot of a different shard should be refused
+	snap, _ := OpenSnapshot(bytes.NewReader(snapshot.Bytes()))
+	other, _ := NewWorldState(db.NewInMemDbProvider(), []byte("other shard"))
+	if err := other.Restore(snap); err == nil {
+		t.Errorf("did not expect snapshot of another shard to restore")
+	}
+	// tampered resource should fail root verification
+	tampered := bytes.Replace(snapshot.Bytes(), []byte("value1"), []byte("valueX"), -1)
+	snap, _ = OpenSnapshot(bytes.NewReader(tampered))
+	restored := testWorldState()
+	if err := restored.Restore(snap); err == nil {
+		t.Errorf("did not expect tampered snapshot to restore")
+	}
+	if _, seq := restored.LastApplied(); seq != 0 {
+		t.Errorf("did not expect tampered snapshot to be applied")
+	}
+}
+
+// world state instances of a shard should share a bloom filter of resource keys, populated with persisted resources,
+// so that lookups of unknown resources do not read DB
+func TestGet_BloomFilter(t *testing.T) {
+	dbp := db.NewInMemDbProvider()
+	s, _ := NewWorldState(dbp, []byte("test shard"))
+	s.Put(&Resource{Key: []byte("key1"), Value: []byte("value1")})
+	s.Persist()
+	s, _ = NewWorldState(dbp, []byte("test shard"))
+	if r, err := s.Get([]byte("key1")); err != nil || string(r.Value) != "value1" {
+		t.Errorf("persisted resource not found: %s", err)
+	}
+	before := db.BloomSkipped(s.stateDb)
+	if _, err := s.Get([]byte("key2")); err == nil {
+		t.Errorf("did not expect unknown resource")
+	}
+	if skipped := db.BloomSkipped(s.stateDb) - before; skipped != 1 {
+		t.Errorf("incorrect lookups skipped: %d", skipped)
+	}
+	// a reset state should not find dropped resources
+	s.Reset()
+	if _, err := s.Get([]byte("key1")); err == nil {
+		t.Errorf("did not expect dropped resource")
+	}
+}
+
+// resources should be scanned by prefix in order of keys, with updates not yet persisted overriding persisted resources
+func TestScan(t *testing.T) {
+	s := testWorldState()
+	for _, k := range []string{"account-2", "account-1", "other-1", "account-3"} {
+		s.Put(&Resource{Key: []byte(k), Value: []byte("value-" + k)})
+	}
+	s.Persist()
+	// pending updates
+	s.Delete([]byte("account-2"))
+	s.Put(&Resource{Key: []byte("account-0"), Value: []byte("value-account-0")})
+	keys := []string{}
+	for _, k := range s.Keys([]byte("account-")) {
+		keys = append(keys, string(k))
+	}
+	if strings.Join(keys, ",") != "account-0,account-1,account-3" {
+		t.Errorf("incorrect keys: %s", keys)
+	}
+	it := s.Scan([]byte("account-"))
+	count := 0
+	for it.Next() {
+		if r := it.Resource(); string(r.Key) != keys[count] || string(r.Value) != "value-"+keys[count] {
+			t.Errorf("incorrect resource: %s", r.Key)
+		}
+		count += 1
+	}
+	if count != 3 || it.Err() != nil {
+		t.Errorf("incorrect scan: %d resources, %s", count, it.Err())
+	}
+	if len(s.Keys(nil)) != 4 {
+		t.Errorf("incorrect number of all keys: %d", len(s.Keys(nil)))
+	}
+	external, _ := NewExternalWorldState(db.NewInMemDbProvider(), []byte("test shard"))
+	if it := external.Scan(nil); it.Next() || it.Err() == nil {
+		t.Errorf("did not expect scan of external state")
+	}
+}
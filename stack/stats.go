@@ -0,0 +1,184 @@
+// Copyright 2019 The trust-net Authors
+// Aggregated runtime statistics of a stack instance, for applications rendering their own dashboards
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/endorsement"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"sync"
+	"time"
+)
+
+// window (seconds) over which shard transaction rates are averaged
+var StatsRateWindow = 60
+
+// transaction rate of a shard
+type ShardRate struct {
+	// number of transactions accepted into local DAG since node's start
+	TxCount uint64
+	// average number of transactions accepted per second, over last StatsRateWindow seconds
+	TxPerSecond float64
+}
+
+// snapshot of a stack's runtime statistics
+type Stats struct {
+	// time at which snapshot was taken
+	Time time.Time
+	// time since stack was created
+	Uptime time.Duration
+	// number of connected peers
+	Peers int
+	// number of network transaction jobs pending per shard queue, keyed by shard id
+	ShardQueues map[string]int
+	// transaction rates of shards with transactions accepted since node's start, keyed by shard id
+	ShardRates map[string]*ShardRate
+	// number of records in each of DLT DB's databases, keyed by database name
+	DbSizes map[string]uint64
+	// storage statistics of transaction records written since node's start
+	Storage *repo.StorageStats
+	// number of network transactions rejected by endorsement layer since node's start, keyed by reason
+	// ("duplicate", "double_spend", "orphan", "invalid" or "throttled")
+	EndorsementRejections map[string]uint64
+	// number of submissions and network transactions throttled by submitters' rate limits since node's start
+	ThrottledSubmissions uint64
+	ThrottledNetworkTxs  uint64
+	// anchoring latencies of shards with submissions since node's start, keyed by shard id
+	ShardLatencies map[string]*ShardLatency
+}
+
+// names of endorsement layer's rejection reasons
+var endorsementRejections = map[int]string{
+	endorsement.ERR_DUPLICATE:    "duplicate",
+	endorsement.ERR_DOUBLE_SPEND: "double_spend",
+	endorsement.ERR_ORPHAN:       "orphan",
+	endorsement.ERR_INVALID:      "invalid",
+	endorsement.ERR_THROTTLED:    "throttled",
+}
+
+// transactions accepted on a shard, with per second counts over the rate window
+type txRate struct {
+	total   uint64
+	buckets []uint64
+	// unix time (seconds) of most recent bucket
+	last int64
+}
+
+// move the window up to specified time, clearing buckets of seconds passed since last update
+func (r *txRate) advance(now int64) {
+	size := int64(len(r.buckets))
+	if now-r.last >= size {
+		for i := range r.buckets {
+			r.buckets[i] = 0
+		}
+	} else {
+		for s := r.last + 1; s <= now; s++ {
+			r.buckets[s%size] = 0
+		}
+	}
+	if now > r.last {
+		r.last = now
+	}
+}
+
+func (r *txRate) perSecond(now int64) float64 {
+	r.advance(now)
+	sum := uint64(0)
+	for _, count := range r.buckets {
+		sum += count
+	}
+	return float64(sum) / float64(len(r.buckets))
+}
+
+// runtime statistics tracked since stack's creation
+type runtimeStats struct {
+	started    time.Time
+	peers      int
+	rates      map[string]*txRate
+	rejections map[string]uint64
+	metrics    MetricsRegistry
+	lock       sync.Mutex
+}
+
+func newRuntimeStats(metrics MetricsRegistry) *runtimeStats {
+	return &runtimeStats{
+		metrics:    metrics,
+		started:    time.Now(),
+		rates:      make(map[string]*txRate),
+		rejections: make(map[string]uint64),
+	}
+}
+
+func (s *runtimeStats) peerConnected() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.peers += 1
+	s.metrics.Gauge(MetricPeers, float64(s.peers), nil)
+}
+
+func (s *runtimeStats) peerDisconnected() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.peers -= 1
+	s.metrics.Gauge(MetricPeers, float64(s.peers), nil)
+}
+
+func (s *runtimeStats) txAccepted(shardId []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now().Unix()
+	rate, found := s.rates[string(shardId)]
+	if !found {
+		window := StatsRateWindow
+		if window < 1 {
+			window = 1
+		}
+		rate = &txRate{
+			buckets: make([]uint64, window),
+			last:    now,
+		}
+		s.rates[string(shardId)] = rate
+	}
+	rate.advance(now)
+	rate.buckets[now%int64(len(rate.buckets))] += 1
+	rate.total += 1
+	s.metrics.Counter(MetricTxAccepted, 1, map[string]string{LabelShard: string(shardId)})
+}
+
+func (s *runtimeStats) txRejected(res int) {
+	reason, found := endorsementRejections[res]
+	if !found {
+		reason = "invalid"
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rejections[reason] += 1
+	s.metrics.Counter(MetricTxRejected, 1, map[string]string{LabelReason: reason})
+}
+
+func (d *dlt) Stats() *Stats {
+	stats := &Stats{
+		Time:                  time.Now(),
+		ShardQueues:           d.executor.pending(),
+		ShardRates:            make(map[string]*ShardRate),
+		DbSizes:               d.db.DbSizes(),
+		Storage:               d.db.StorageStats(),
+		EndorsementRejections: make(map[string]uint64),
+		ShardLatencies:        d.latency.shards(),
+	}
+	stats.ThrottledSubmissions, stats.ThrottledNetworkTxs = d.endorser.Throttled()
+	s := d.stats
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats.Uptime = stats.Time.Sub(s.started)
+	stats.Peers = s.peers
+	for id, rate := range s.rates {
+		stats.ShardRates[id] = &ShardRate{
+			TxCount:     rate.total,
+			TxPerSecond: rate.perSecond(stats.Time.Unix()),
+		}
+	}
+	for reason, count := range s.rejections {
+		stats.EndorsementRejections[reason] = count
+	}
+	return stats
+}
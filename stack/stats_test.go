@@ -0,0 +1,79 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/endorsement"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+// stats should report shard transaction rates, database sizes and endorsement rejections
+func TestStats(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	var tx dto.Transaction
+	for i := 0; i < 2; i++ {
+		var err error
+		if tx, err = stack.Submit(submitter.NewRequest("test payload")); err != nil {
+			t.Fatalf("submission failed: %s", err)
+		}
+		submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+	}
+	// a duplicate network transaction should be counted as rejected by endorsement layer
+	events := make(chan controllerEvent, 10)
+	if err := stack.handleTransaction(NewMockPeer(p2p.TestConn()), events, tx, false); err == nil {
+		t.Errorf("expected duplicate transaction to be rejected")
+	}
+	stats := stack.Stats()
+	if rate := stats.ShardRates[string(stack.app.ShardId)]; rate == nil || rate.TxCount != 2 || rate.TxPerSecond <= 0 {
+		t.Errorf("incorrect shard rate: %+v", rate)
+	}
+	if stats.DbSizes["dlt_transactions"] < 2 {
+		t.Errorf("incorrect database sizes: %v", stats.DbSizes)
+	}
+	if stats.EndorsementRejections["duplicate"] != 1 {
+		t.Errorf("incorrect endorsement rejections: %v", stats.EndorsementRejections)
+	}
+	if stats.Peers != 0 || stats.Storage == nil || stats.Uptime <= 0 {
+		t.Errorf("incorrect stats: %+v", stats)
+	}
+}
+
+// submissions above submitter's rate limit should be rejected, and counted as throttled
+func TestStats_Throttled(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.endorser.SetRateLimits(&endorsement.RateLimit{Rate: 1, Burst: 1}, nil)
+	submitter := dto.TestSubmitter()
+	tx, err := stack.Submit(submitter.NewRequest("test payload"))
+	if err != nil {
+		t.Fatalf("submission failed: %s", err)
+	}
+	submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+	if _, err := stack.Submit(submitter.NewRequest("test payload")); dto.ErrorCodeOf(err) != dto.ErrRateLimited {
+		t.Errorf("submission above rate limit not throttled: %v", err)
+	}
+	if stats := stack.Stats(); stats.ThrottledSubmissions != 1 || stats.ThrottledNetworkTxs != 0 {
+		t.Errorf("incorrect throttle counts: %d, %d", stats.ThrottledSubmissions, stats.ThrottledNetworkTxs)
+	}
+}
+
+// transaction rate should only count transactions within the rate window
+func TestTxRate_Window(t *testing.T) {
+	rate := &txRate{
+		buckets: make([]uint64, 4),
+		last:    100,
+	}
+	rate.buckets[100%4] = 4
+	rate.advance(101)
+	rate.buckets[101%4] = 4
+	if rate.perSecond(102) != 2 {
+		t.Errorf("incorrect rate: %f", rate.perSecond(102))
+	}
+	if rate.perSecond(104) != 1 {
+		t.Errorf("incorrect rate after window moved: %f", rate.perSecond(104))
+	}
+	if rate.perSecond(200) != 0 {
+		t.Errorf("incorrect rate after window expired: %f", rate.perSecond(200))
+	}
+}
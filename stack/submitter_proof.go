@@ -0,0 +1,108 @@
+// Copyright 2019 The trust-net Authors
+// Verifiable proof of a submitter's transaction history
+package stack
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+)
+
+// a submitter's transaction in history proof, with everything needed to verify
+// the submitter's signature and the transaction ID independent of the node
+type SubmitterProofEntry struct {
+	Seq       uint64
+	ShardId   []byte
+	TxId      [64]byte
+	LastTx    [64]byte
+	Payload   []byte
+	Padding   uint64
+	Signature []byte
+	// signature of the transaction's anchor (transaction ID is hash of request and anchor signatures)
+	AnchorSignature []byte
+}
+
+// request of the entry, as signed by submitter
+func (e *SubmitterProofEntry) request(submitterId []byte) *dto.TxRequest {
+	return &dto.TxRequest{
+		Payload:      e.Payload,
+		ShardId:      e.ShardId,
+		LastTx:       e.LastTx,
+		SubmitterId:  submitterId,
+		SubmitterSeq: e.Seq,
+		Padding:      e.Padding,
+		Signature:    e.Signature,
+	}
+}
+
+// proof that a submitter's sequence 1..N maps to a specific chain of transactions
+type SubmitterProof struct {
+	SubmitterId []byte
+	// transactions in order of sequence (a sequence can have transactions on multiple shards)
+	Entries []SubmitterProofEntry
+}
+
+// verify the proof: every transaction is signed by submitter, transaction IDs match their contents,
+// sequences are contiguous from 1, and each transaction's last transaction is in previous sequence
+func (p *SubmitterProof) Verify() error {
+	prev := map[[64]byte]bool{}
+	current := map[[64]byte]bool{}
+	seq := uint64(0)
+	for i, e := range p.Entries {
+		switch {
+		case e.Seq == seq+1:
+			// new sequence
+			seq, prev, current = e.Seq, current, map[[64]byte]bool{}
+		case e.Seq == seq && seq > 0:
+			// another shard's transaction for same sequence
+		default:
+			return fmt.Errorf("entry %d: sequence gap, expected %d, found %d", i, seq+1, e.Seq)
+		}
+		req := e.request(p.SubmitterId)
+		if !p2p.VerifySignature(req.Bytes(), req.Signature, p.SubmitterId) {
+			return fmt.Errorf("entry %d: invalid submitter signature", i)
+		}
+		if sha512.Sum512(append(append([]byte{}, e.Signature...), e.AnchorSignature...)) != e.TxId {
+			return fmt.Errorf("entry %d: transaction ID does not match contents", i)
+		}
+		if seq > 1 && !prev[e.LastTx] {
+			return fmt.Errorf("entry %d: last transaction %x not in sequence %d", i, e.LastTx, seq-1)
+		}
+		current[e.TxId] = true
+	}
+	return nil
+}
+
+func (d *dlt) SubmitterProof(submitterId []byte) (*SubmitterProof, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	proof := &SubmitterProof{
+		SubmitterId: submitterId,
+		Entries:     []SubmitterProofEntry{},
+	}
+	for seq := uint64(1); ; seq++ {
+		history := d.db.GetSubmitterHistory(submitterId, seq)
+		if history == nil {
+			break
+		}
+		for _, pair := range history.ShardTxPairs {
+			tx := d.db.GetTx(pair.TxId)
+			if tx == nil {
+				return nil, fmt.Errorf("missing transaction %x for sequence %d", pair.TxId, seq)
+			}
+			req := tx.Request()
+			proof.Entries = append(proof.Entries, SubmitterProofEntry{
+				Seq:             seq,
+				ShardId:         req.ShardId,
+				TxId:            pair.TxId,
+				LastTx:          req.LastTx,
+				Payload:         req.Payload,
+				Padding:         req.Padding,
+				Signature:       req.Signature,
+				AnchorSignature: tx.Anchor().Signature,
+			})
+		}
+	}
+	return proof, nil
+}
@@ -0,0 +1,89 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// add a chain of signed transactions from a submitter to stack's DB
+func submitterTestChain(endorser *mockEndorser, submitter *dto.Submitter, count int) []dto.Transaction {
+	txs := []dto.Transaction{}
+	for i := 0; i < count; i++ {
+		tx := submitter.NewTransaction(dto.TestAnchor(), "test payload")
+		// regenerate if signature components were not full length
+		for len(tx.Request().Signature) != 64 {
+			tx = submitter.NewTransaction(dto.TestAnchor(), "test payload")
+		}
+		tx.Anchor().Signature = []byte("test anchor signature")
+		endorser.Handle(tx)
+		endorser.Update(tx)
+		txs = append(txs, tx)
+		submitter.Seq, submitter.LastTx = submitter.Seq+1, tx.Id()
+	}
+	return txs
+}
+
+// test that proof covers submitter's history in sequence, and verifies
+func TestSubmitterProof(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, endorser, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	txs := submitterTestChain(endorser, submitter, 3)
+	proof, err := stack.SubmitterProof(submitter.Id)
+	if err != nil {
+		t.Errorf("failed to get proof: %s", err)
+		return
+	}
+	if len(proof.Entries) != 3 {
+		t.Errorf("incorrect number of entries: %d", len(proof.Entries))
+		return
+	}
+	for i, e := range proof.Entries {
+		if e.Seq != uint64(i+1) || e.TxId != txs[i].Id() {
+			t.Errorf("incorrect entry %d: %v", i, e)
+		}
+	}
+	if err := proof.Verify(); err != nil {
+		t.Errorf("proof verification failed: %s", err)
+	}
+}
+
+// test that proof verification detects gaps and substitutions
+func TestSubmitterProof_VerifyTampered(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, endorser, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	submitterTestChain(endorser, submitter, 3)
+	tamper := map[string]func(p *SubmitterProof){
+		"gap": func(p *SubmitterProof) {
+			p.Entries = append(p.Entries[:1], p.Entries[2:]...)
+		},
+		"payload": func(p *SubmitterProof) {
+			p.Entries[1].Payload = []byte("substituted payload")
+		},
+		"tx id": func(p *SubmitterProof) {
+			p.Entries[1].TxId = dto.RandomHash()
+		},
+		"last tx": func(p *SubmitterProof) {
+			p.Entries[2].LastTx = dto.RandomHash()
+		},
+	}
+	for name, f := range tamper {
+		proof, _ := stack.SubmitterProof(submitter.Id)
+		f(proof)
+		if err := proof.Verify(); err == nil {
+			t.Errorf("verification did not detect tampered %s", name)
+		}
+	}
+}
+
+// test that proof of an unknown submitter is empty
+func TestSubmitterProof_Unknown(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, _, _ := initMocks()
+	if proof, err := stack.SubmitterProof([]byte("unknown")); err != nil || len(proof.Entries) != 0 {
+		t.Errorf("unexpected proof: %v, %s", proof, err)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2019 The trust-net Authors
+// Reports of a submitter's activity across shards, for compliance/audit exports
+package stack
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// an operation decoded from a transaction's payload
+type DecodedOp struct {
+	Name string
+	Args map[string]string
+}
+
+// app supplied hook to decode a transaction's payload into its operation, returns nil for a payload that
+// is not recognized (e.g. of another app's shard), whose raw payload is then reported
+type PayloadDecoder func(shardId, payload []byte) *DecodedOp
+
+// a submitter's transaction in activity report
+type SubmitterReportEntry struct {
+	Seq      uint64
+	ShardId  []byte
+	TxId     [64]byte
+	ShardSeq uint64
+	// node that anchored the transaction
+	NodeId []byte
+	// finality status of the transaction (see Status)
+	Status string
+	// raw payload (empty if pruned as per shard's retention policy)
+	Payload []byte
+	// operation decoded from payload (nil if payload was not decoded)
+	Op *DecodedOp
+}
+
+// chronological report of a submitter's transactions across shards
+type SubmitterReport struct {
+	SubmitterId []byte
+	GeneratedAt time.Time
+	// transactions in order of submitter sequence, and then shard
+	Entries []SubmitterReportEntry
+}
+
+// columns of CSV report, decoded op's arguments are in a single column as "name=value" pairs
+var submitterReportColumns = []string{"seq", "shard_id", "tx_id", "shard_seq", "node_id", "status", "op", "args", "payload"}
+
+func (d *dlt) SubmitterReport(submitterId []byte, decode PayloadDecoder) (*SubmitterReport, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	report := &SubmitterReport{
+		SubmitterId: submitterId,
+		GeneratedAt: time.Now(),
+		Entries:     []SubmitterReportEntry{},
+	}
+	for seq := uint64(1); ; seq++ {
+		history := d.db.GetSubmitterHistory(submitterId, seq)
+		if history == nil {
+			break
+		}
+		start := len(report.Entries)
+		for _, pair := range history.ShardTxPairs {
+			tx := d.db.GetTx(pair.TxId)
+			if tx == nil {
+				return nil, fmt.Errorf("missing transaction %x for sequence %d", pair.TxId, seq)
+			}
+			entry := SubmitterReportEntry{
+				Seq:      seq,
+				ShardId:  tx.Request().ShardId,
+				TxId:     pair.TxId,
+				ShardSeq: tx.Anchor().ShardSeq,
+				NodeId:   tx.Anchor().NodeId,
+				Payload:  tx.Request().Payload,
+			}
+			if receipt, err := d.Receipt(pair.TxId); err == nil {
+				entry.Status = receipt.Status
+			}
+			if decode != nil && len(entry.Payload) > 0 {
+				entry.Op = decode(entry.ShardId, entry.Payload)
+			}
+			report.Entries = append(report.Entries, entry)
+		}
+		// a sequence's transactions on multiple shards are reported in order of shard
+		entries := report.Entries[start:]
+		sort.Slice(entries, func(i, j int) bool { return string(entries[i].ShardId) < string(entries[j].ShardId) })
+	}
+	return report, nil
+}
+
+// decoded op's arguments as "name=value" pairs, in order of names
+func (op *DecodedOp) args() string {
+	names := make([]string, 0, len(op.Args))
+	for name := range op.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + "=" + op.Args[name]
+	}
+	return strings.Join(pairs, ";")
+}
+
+// write report as CSV, with a header row, raw payload is written only when it was not decoded
+func (r *SubmitterReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(submitterReportColumns); err != nil {
+		return err
+	}
+	for _, e := range r.Entries {
+		op, args, payload := "", "", ""
+		if e.Op != nil {
+			op, args = e.Op.Name, e.Op.args()
+		} else {
+			payload = hex.EncodeToString(e.Payload)
+		}
+		if err := out.Write([]string{
+			strconv.FormatUint(e.Seq, 10),
+			hex.EncodeToString(e.ShardId),
+			hex.EncodeToString(e.TxId[:]),
+			strconv.FormatUint(e.ShardSeq, 10),
+			hex.EncodeToString(e.NodeId),
+			e.Status,
+			op,
+			args,
+			payload,
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+type submitterReportJSON struct {
+	SubmitterId string                     `json:"submitter_id"`
+	GeneratedAt time.Time                  `json:"generated_at"`
+	Entries     []submitterReportEntryJSON `json:"entries"`
+}
+
+type submitterReportEntryJSON struct {
+	Seq      uint64            `json:"seq"`
+	ShardId  string            `json:"shard_id"`
+	TxId     string            `json:"tx_id"`
+	ShardSeq uint64            `json:"shard_seq"`
+	NodeId   string            `json:"node_id"`
+	Status   string            `json:"status"`
+	Op       string            `json:"op,omitempty"`
+	Args     map[string]string `json:"args,omitempty"`
+	Payload  string            `json:"payload,omitempty"`
+}
+
+// write report as JSON, with IDs and undecoded payloads hex encoded
+func (r *SubmitterReport) WriteJSON(w io.Writer) error {
+	out := submitterReportJSON{
+		SubmitterId: hex.EncodeToString(r.SubmitterId),
+		GeneratedAt: r.GeneratedAt,
+		Entries:     make([]submitterReportEntryJSON, len(r.Entries)),
+	}
+	for i, e := range r.Entries {
+		out.Entries[i] = submitterReportEntryJSON{
+			Seq:      e.Seq,
+			ShardId:  hex.EncodeToString(e.ShardId),
+			TxId:     hex.EncodeToString(e.TxId[:]),
+			ShardSeq: e.ShardSeq,
+			NodeId:   hex.EncodeToString(e.NodeId),
+			Status:   e.Status,
+		}
+		if e.Op != nil {
+			out.Entries[i].Op, out.Entries[i].Args = e.Op.Name, e.Op.Args
+		} else {
+			out.Entries[i].Payload = hex.EncodeToString(e.Payload)
+		}
+	}
+	return json.NewEncoder(w).Encode(out)
+}
@@ -0,0 +1,67 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"testing"
+)
+
+// test that report covers submitter's history in sequence, with payloads decoded by hook
+func TestSubmitterReport(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, endorser, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	txs := submitterTestChain(endorser, submitter, 3)
+	decode := func(shardId, payload []byte) *DecodedOp {
+		return &DecodedOp{Name: "test", Args: map[string]string{"b": "2", "a": "1"}}
+	}
+	report, err := stack.SubmitterReport(submitter.Id, decode)
+	if err != nil {
+		t.Fatalf("failed to get report: %s", err)
+	}
+	if len(report.Entries) != 3 {
+		t.Fatalf("incorrect number of entries: %d", len(report.Entries))
+	}
+	for i, e := range report.Entries {
+		if e.Seq != uint64(i+1) || e.TxId != txs[i].Id() || e.Op == nil || e.Status != TX_ACCEPTED {
+			t.Errorf("incorrect entry %d: %v", i, e)
+		}
+	}
+	buf := bytes.Buffer{}
+	if err := report.WriteCSV(&buf); err != nil {
+		t.Fatalf("failed to write CSV: %s", err)
+	}
+	if rows, err := csv.NewReader(&buf).ReadAll(); err != nil || len(rows) != 4 {
+		t.Errorf("incorrect CSV rows: %d, %v", len(rows), err)
+	} else if rows[1][6] != "test" || rows[1][7] != "a=1;b=2" || len(rows[1][8]) != 0 {
+		t.Errorf("incorrect CSV row: %v", rows[1])
+	}
+}
+
+// test that undecoded payloads are reported raw
+func TestSubmitterReport_RawPayload(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, endorser, _ := initMocks()
+	submitter := dto.TestSubmitter()
+	submitterTestChain(endorser, submitter, 2)
+	report, err := stack.SubmitterReport(submitter.Id, nil)
+	if err != nil {
+		t.Fatalf("failed to get report: %s", err)
+	}
+	buf := bytes.Buffer{}
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatalf("failed to write JSON: %s", err)
+	}
+	out := submitterReportJSON{}
+	if err := json.NewDecoder(&buf).Decode(&out); err != nil || len(out.Entries) != 2 {
+		t.Fatalf("incorrect JSON report: %v", err)
+	}
+	if out.Entries[0].Payload != hex.EncodeToString([]byte("test payload")) || len(out.Entries[0].Op) != 0 {
+		t.Errorf("incorrect JSON entry: %v", out.Entries[0])
+	}
+}
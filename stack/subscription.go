@@ -0,0 +1,90 @@
+// Copyright 2019 The trust-net Authors
+// Event subscriptions for applications using DLT stack
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"sync"
+)
+
+type EventType int
+
+const (
+	_ EventType = iota
+	// a transaction originated by this node was rejected by a remote node
+	EVENT_TX_REJECTED
+	// a double spend was detected and resolved (or a double spending submission was rejected)
+	EVENT_DOUBLE_SPEND
+	// a shard's transaction latency went above its configured SLO
+	EVENT_SLO_BREACH
+	// a transaction violated an app's invariant of world state, and its shard was halted
+	EVENT_INVARIANT_VIOLATION
+)
+
+// event delivered to application subscribers
+type Event struct {
+	Type EventType
+	// transaction the event is about
+	TxId [64]byte
+	// shard of the transaction
+	ShardId []byte
+	// reason code (for rejection events)
+	Reason uint64
+	// human readable detail of the event
+	Detail string
+	// evidence of conflicting transactions (for double spend events)
+	DoubleSpend *DoubleSpendEvidence
+	// latency above SLO (for SLO breach events)
+	SLO *SLOBreach
+	// violated invariant (for invariant violation events)
+	Violation *shard.InvariantViolation
+}
+
+// registry of application event subscribers
+type subscriptions struct {
+	handlers map[uint64]func(e *Event)
+	nextId   uint64
+	lock     sync.RWMutex
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{
+		handlers: make(map[uint64]func(e *Event)),
+	}
+}
+
+func (s *subscriptions) add(handler func(e *Event)) uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.nextId += 1
+	s.handlers[s.nextId] = handler
+	return s.nextId
+}
+
+func (s *subscriptions) remove(id uint64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.handlers, id)
+}
+
+// deliver event to all subscribers, asynchronously so that a slow subscriber does not hold up the stack
+func (s *subscriptions) publish(e *Event) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	for _, handler := range s.handlers {
+		go handler(e)
+	}
+}
+
+// alert app subscribers if a transaction failed on violation of an app's invariant, halting its shard
+func (d *dlt) invariantViolated(err error) {
+	if v, ok := err.(*shard.InvariantViolation); ok {
+		d.subs.publish(&Event{
+			Type:      EVENT_INVARIANT_VIOLATION,
+			TxId:      v.TxId,
+			ShardId:   v.ShardId,
+			Detail:    v.Error(),
+			Violation: v,
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright 2019 The trust-net Authors
+// Shard sync in batches, a transaction unknown locally is fetched from peer along with its shard DAG descendants
+// (parents before children), instead of one request per transaction
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+)
+
+// max number of transactions fetched per request during shard sync, 0 or 1 to fetch one transaction at a time
+var ShardSyncBatchSize = 0
+
+// max number of transactions served (or accepted) in a batch
+const maxShardSyncBatch = 256
+
+// request a transaction and a batch of its descendants from peer (called with lock held)
+func (d *dlt) requestTxShardBatch(peer p2p.Peer, hash [64]byte) error {
+	req := &TxShardBatchRequestMsg{
+		Hash:   hash,
+		MaxTxs: uint64(d.policies.ShardSyncBatchSize),
+	}
+	// save the requested hash into peer's state to validate batch response
+	peer.SetState(int(RECV_TxShardBatchResponseMsg), req.Hash)
+	peer.Logger().Debug("Requesting batch of transaction and its shard DAG descendants for: %x", req.Hash)
+	d.syncPeers.requested(peer.String())
+	return peer.Send(req.Id(), req.Code(), req)
+}
+
+func (d *dlt) handleRECV_TxShardBatchRequestMsg(peer p2p.Peer, msg *TxShardBatchRequestMsg) error {
+	if d.db.GetTx(msg.Hash) == nil {
+		return fmt.Errorf("no transaction exists for requested hash: %x", msg.Hash)
+	}
+	max := msg.MaxTxs
+	if max == 0 || max > maxShardSyncBatch {
+		max = maxShardSyncBatch
+	}
+	hashes, pending := d.sharder.Descendants(msg.Hash, max)
+	txs := make([]dto.Transaction, 0, len(hashes))
+	for _, hash := range hashes {
+		if tx := d.db.GetTx(hash); tx != nil {
+			txs = append(txs, tx)
+		}
+	}
+	res := NewTxShardBatchResponseMsg(msg.Hash, txs, pending, d.codec)
+	if res == nil {
+		return fmt.Errorf("failed to serialize batch of: %x", msg.Hash)
+	}
+	peer.Logger().Debug("Sending batch of %d transactions, %d pending, for: %x", len(res.Txs), len(pending), msg.Hash)
+	return peer.Send(res.Id(), res.Code(), res)
+}
+
+// replay transactions of a batch in order, skipping descendants of a transaction that could not be
+// handled, and queue batch's pending descendants to fetch next
+func (d *dlt) handleRECV_TxShardBatchResponseMsg(peer p2p.Peer, events chan controllerEvent, msg *TxShardBatchResponseMsg) error {
+	// fetch state from peer to validate response's hash
+	if state := peer.GetState(int(RECV_TxShardBatchResponseMsg)); state != msg.Hash {
+		d.syncPeers.responded(peer.String(), false)
+		return fmt.Errorf("unexpected batch for: %x", msg.Hash)
+	}
+	// update the state to null value, to prevent any repeated/cyclic DoS attack
+	peer.SetState(int(RECV_TxShardBatchResponseMsg), [64]byte{})
+	// emit the POP_ShardChild event for processing children queue, once batch is processed
+	defer func() {
+		events <- newControllerEvent(POP_ShardChild, nil)
+	}()
+	if len(msg.Txs) == 0 || len(msg.Txs) > maxShardSyncBatch {
+		d.syncPeers.responded(peer.String(), false)
+		return errors.New("malformed batch")
+	}
+	// transactions of batch, and whether they were handled
+	batch := make(map[[64]byte]bool)
+	for i, data := range msg.Txs {
+		tx := dto.NewTransaction(&dto.TxRequest{}, &dto.Anchor{})
+		if err := d.codec.Unmarshal(data, tx); err != nil {
+			d.syncPeers.responded(peer.String(), false)
+			return fmt.Errorf("failed to decode transaction %d of batch: %s", i+1, err)
+		}
+		// batch must start with requested transaction, and list parents before their children
+		handled, found := batch[tx.Anchor().ShardParent]
+		if (i == 0 && tx.Id() != msg.Hash) || (i > 0 && !found) {
+			d.syncPeers.responded(peer.String(), false)
+			return fmt.Errorf("transaction %d of batch out of order: %x", i+1, tx.Id())
+		}
+		if err := d.validateSignatures(tx); err != nil {
+			d.syncPeers.responded(peer.String(), false)
+			return fmt.Errorf("transaction %d of batch failed signature verification: %s", i+1, err)
+		}
+		batch[tx.Id()] = false
+		if i > 0 && !handled {
+			peer.Logger().Debug("Skipping descendant of unhandled transaction: %x", tx.Id())
+			continue
+		}
+		// mark the transaction as seen by stack
+		d.isSeen(tx.Id())
+		if err := d.handleTransaction(peer, events, tx, true); err != nil {
+			peer.Logger().Debug("Failed to handle transaction of batch: %s\ntransaction: %x", err, tx.Id())
+			continue
+		}
+		batch[tx.Id()] = true
+		// update sync progress, local shard's depth is now past this transaction
+		d.syncs.fetched(tx.Request().ShardId, tx.Anchor().ShardSeq+1)
+	}
+	d.syncPeers.responded(peer.String(), true)
+	for _, child := range msg.Pending {
+		if err := peer.ShardChildrenQ().Push(child); err != nil {
+			peer.Logger().Debug("Failed to add child to shard queue: %s", err)
+			break
+		}
+	}
+	peer.Logger().Debug("Replayed batch of %d transactions, %d pending, for: %x", len(msg.Txs), len(msg.Pending), msg.Hash)
+	return nil
+}
@@ -0,0 +1,233 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+)
+
+// a node of a sync test, with its connection to the other node
+type syncTestNode struct {
+	stack *dlt
+	peer  *mockPeer
+	// events pending to be processed by node
+	queue []controllerEvent
+}
+
+func newSyncTestNode() *syncTestNode {
+	stack, _, _, _ := initMocks()
+	return &syncTestNode{
+		stack: stack,
+		peer:  NewMockPeer(p2p.TestConn()),
+	}
+}
+
+// events of the sync messages exchanged between nodes
+var syncTestEvents = map[uint64]eventEnum{
+	ShardAncestorRequestMsgCode:  RECV_ShardAncestorRequestMsg,
+	ShardAncestorResponseMsgCode: RECV_ShardAncestorResponseMsg,
+	ShardChildrenRequestMsgCode:  RECV_ShardChildrenRequestMsg,
+	ShardChildrenResponseMsgCode: RECV_ShardChildrenResponseMsg,
+	TxShardChildRequestMsgCode:   RECV_TxShardChildRequestMsg,
+	TxShardChildResponseMsgCode:  RECV_TxShardChildResponseMsg,
+	TxShardBatchRequestMsgCode:   RECV_TxShardBatchRequestMsg,
+	TxShardBatchResponseMsgCode:  RECV_TxShardBatchResponseMsg,
+}
+
+// add a transaction of a new submitter on top of specified shard parent
+func (n *syncTestNode) add(t *testing.T, parent dto.Transaction, payload string) dto.Transaction {
+	tx := dto.TestSubmitter().NewTransaction(dto.TestAnchor(), payload)
+	tx.Anchor().ShardParent, tx.Anchor().ShardSeq = parent.Id(), parent.Anchor().ShardSeq+1
+	if err := n.stack.handleTransaction(n.peer, make(chan controllerEvent, 10), tx, false); err != nil {
+		t.Fatalf("failed to add transaction: %s", err)
+	}
+	return tx
+}
+
+// add a chain of transactions on top of specified shard parent
+func (n *syncTestNode) chain(t *testing.T, parent dto.Transaction, length int, prefix string) []dto.Transaction {
+	txs := make([]dto.Transaction, length)
+	for i := range txs {
+		txs[i] = n.add(t, parent, fmt.Sprintf("%s-%d", prefix, i))
+		parent = txs[i]
+	}
+	return txs
+}
+
+// message sent to peer by node, as an event for the other node
+func (n *syncTestNode) sent(t *testing.T) []controllerEvent {
+	if !n.peer.SendCalled {
+		return nil
+	}
+	n.peer.SendCalled = false
+	code, ok := syncTestEvents[n.peer.SendMsgCode]
+	if !ok {
+		t.Fatalf("unexpected message sent to peer: %d", n.peer.SendMsgCode)
+	}
+	return []controllerEvent{newControllerEvent(code, n.peer.SendMsg)}
+}
+
+// process next pending event with node's event listener
+func (n *syncTestNode) step(t *testing.T) []controllerEvent {
+	events := make(chan controllerEvent, 10)
+	events <- n.queue[0]
+	events <- newControllerEvent(SHUTDOWN, nil)
+	n.queue = n.queue[1:]
+	n.stack.peerEventsListener(n.peer, events)
+	// keep events emitted by listener for itself, e.g. POP_ShardChild
+	for len(events) > 0 {
+		n.queue = append(n.queue, <-events)
+	}
+	return n.sent(t)
+}
+
+// exchange sync messages between nodes, after local node receives a transaction, until nodes are done,
+// and return number of requests sent by local node
+func syncTestRun(t *testing.T, local, remote *syncTestNode, tx dto.Transaction) int {
+	if err := local.stack.handleRECV_NewTxBlockMsg(local.peer, make(chan controllerEvent, 10), tx); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	}
+	remote.queue = local.sent(t)
+	requests := len(remote.queue)
+	for len(local.queue)+len(remote.queue) > 0 {
+		if requests > 1000 {
+			t.Fatalf("sync did not finish")
+		}
+		if len(remote.queue) > 0 {
+			local.queue = append(local.queue, remote.step(t)...)
+		} else {
+			sent := local.step(t)
+			requests += len(sent)
+			remote.queue = append(remote.queue, sent...)
+		}
+	}
+	return requests
+}
+
+// build nodes sharing a shard prefix, where remote node has a fork deeper than an ancestors request,
+// with forks of its own, and local node has a fork unknown to remote node
+func syncTestForks(t *testing.T) (*syncTestNode, *syncTestNode, []dto.Transaction, []dto.Transaction) {
+	local, remote := newSyncTestNode(), newSyncTestNode()
+	prefix := remote.chain(t, shard.GenesisShardTx(TestAppConfig().ShardId), 3, "prefix")
+	for _, tx := range prefix {
+		if err := local.stack.handleTransaction(local.peer, make(chan controllerEvent, 10), tx, false); err != nil {
+			t.Fatalf("failed to add prefix: %s", err)
+		}
+	}
+	remoteFork := remote.chain(t, prefix[2], 25, "remote")
+	remoteFork = append(remoteFork, remote.chain(t, remoteFork[5], 12, "remote-inner")...)
+	remoteFork = append(remoteFork, remote.chain(t, remoteFork[20], 2, "remote-short")...)
+	localFork := local.chain(t, prefix[2], 3, "local")
+	return local, remote, remoteFork, localFork
+}
+
+// check that local node has all transactions of both forks
+func syncTestCheck(t *testing.T, local *syncTestNode, remoteFork, localFork []dto.Transaction) {
+	for i, tx := range append(append([]dto.Transaction{}, remoteFork...), localFork...) {
+		if local.stack.db.GetShardDagNode(tx.Id()) == nil {
+			t.Fatalf("transaction %d missing after sync: %x", i, tx.Id())
+		}
+	}
+	if tips := local.stack.db.ShardTips(TestAppConfig().ShardId); len(tips) != 4 {
+		t.Errorf("incorrect number of tips after sync: %d", len(tips))
+	}
+}
+
+// a remote fork deeper than an ancestors request should be walked up in multiple rounds, and fetched
+// one transaction at a time
+func TestShardSync_DeepFork(t *testing.T) {
+	local, remote, remoteFork, localFork := syncTestForks(t)
+	requests := syncTestRun(t, local, remote, remoteFork[24])
+	syncTestCheck(t, local, remoteFork, localFork)
+	// 3 ancestors requests, a children request and a request per transaction
+	if requests != 3+1+len(remoteFork) {
+		t.Errorf("incorrect number of requests: %d", requests)
+	}
+}
+
+// a remote fork should be fetched in batches, when enabled
+func TestShardSync_DeepForkBatches(t *testing.T) {
+	local, remote, remoteFork, localFork := syncTestForks(t)
+	local.stack.policies.ShardSyncBatchSize = 8
+	requests := syncTestRun(t, local, remote, remoteFork[24])
+	syncTestCheck(t, local, remoteFork, localFork)
+	if requests >= 3+1+len(remoteFork) || remote.peer.SendMsgCode != TxShardBatchResponseMsgCode {
+		t.Errorf("did not fetch transactions in batches: %d requests", requests)
+	}
+}
+
+// a remote fork should be fetched, one at a time and in batches, with protobuf codec on both nodes
+func TestShardSync_ProtobufCodec(t *testing.T) {
+	for _, batch := range []int{0, 8} {
+		local, remote, remoteFork, localFork := syncTestForks(t)
+		local.stack.codec, remote.stack.codec = common.ProtobufCodec, common.ProtobufCodec
+		local.stack.policies.ShardSyncBatchSize = batch
+		syncTestRun(t, local, remote, remoteFork[24])
+		syncTestCheck(t, local, remoteFork, localFork)
+	}
+}
+
+// a batch request should be served with requested transaction and its descendants, and an unknown
+// transaction requested should be refused
+func TestRECV_TxShardBatchRequestMsg(t *testing.T) {
+	_, remote, remoteFork, _ := syncTestForks(t)
+	msg := &TxShardBatchRequestMsg{Hash: remoteFork[0].Id(), MaxTxs: 10}
+	if err := remote.stack.handleRECV_TxShardBatchRequestMsg(remote.peer, msg); err != nil {
+		t.Fatalf("failed to handle request: %s", err)
+	}
+	res := remote.peer.SendMsg.(*TxShardBatchResponseMsg)
+	if res.Hash != msg.Hash || len(res.Txs) != 10 || len(res.Pending) != 2 {
+		t.Errorf("incorrect batch: %d transactions, %d pending", len(res.Txs), len(res.Pending))
+	}
+	msg.Hash = dto.RandomHash()
+	if err := remote.stack.handleRECV_TxShardBatchRequestMsg(remote.peer, msg); err == nil {
+		t.Errorf("expected request for unknown transaction to be refused")
+	}
+}
+
+// a batch not requested, or listing a child before its parent, should not be replayed
+func TestRECV_TxShardBatchResponseMsg_Invalid(t *testing.T) {
+	local, _, remoteFork, _ := syncTestForks(t)
+	res := NewTxShardBatchResponseMsg(remoteFork[0].Id(), []dto.Transaction{remoteFork[0], remoteFork[2], remoteFork[1]}, nil, common.GobCodec)
+	events := make(chan controllerEvent, 10)
+	if err := local.stack.handleRECV_TxShardBatchResponseMsg(local.peer, events, res); err == nil {
+		t.Errorf("expected batch not requested to be refused")
+	}
+	local.peer.SetState(int(RECV_TxShardBatchResponseMsg), res.Hash)
+	if err := local.stack.handleRECV_TxShardBatchResponseMsg(local.peer, events, res); err == nil {
+		t.Errorf("expected batch out of order to be refused")
+	}
+	if local.stack.db.GetShardDagNode(remoteFork[2].Id()) != nil {
+		t.Errorf("did not expect transaction out of order to be replayed")
+	}
+	// sync should continue with next child in queue
+	if len(events) != 1 || (<-events).code != POP_ShardChild {
+		t.Errorf("did not emit POP_ShardChild event")
+	}
+}
+
+// stack controller listner generates events for shard batch messages
+func TestPeerListnerGeneratesEventForTxShardBatchMsgs(t *testing.T) {
+	for code, msg := range map[uint64]interface{}{
+		TxShardBatchRequestMsgCode:  &TxShardBatchRequestMsg{},
+		TxShardBatchResponseMsgCode: &TxShardBatchResponseMsg{},
+	} {
+		stack, _, _, _ := initMocks()
+		mockConn := p2p.TestConn()
+		peer := NewMockPeer(mockConn)
+		mockConn.NextMsg(code, msg)
+		mockConn.NextMsg(NodeShutdownMsgCode, &NodeShutdown{})
+		events := make(chan controllerEvent, 10)
+		finished := checkForEventCode(syncTestEvents[code], events)
+		if err := stack.listener(peer, events); err != nil {
+			t.Errorf("Transaction processing has errors: %s", err)
+		}
+		if result := <-finished; !result.seenMsgEvent {
+			t.Errorf("Event listener did not generate event for message: %d", code)
+		}
+	}
+}
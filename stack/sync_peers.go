@@ -0,0 +1,354 @@
+// Copyright 2019 The trust-net Authors
+// Selection of peers as sources for shard sync, by their advertised tips, latency and reliability
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"sort"
+	"sync"
+	"time"
+)
+
+// max number of peers a shard is synced from in parallel
+var MaxSyncPeers = 3
+
+// reliability (ratio of valid responses to sync requests) below which a peer is used as sync source
+// only when there is no other candidate for the shard
+var MinSyncPeerReliability = 0.5
+
+// weight of latest sample in a peer's moving average of response latency
+const syncLatencyWeight = 4
+
+// a candidate source for syncing a shard, as ranked by node
+type SyncPeer struct {
+	// name of the peer
+	Peer string
+	// depth and weight of shard's tip advertised by peer
+	Depth  uint64
+	Weight uint64
+	// moving average of peer's response latency to sync requests (0 if not yet measured)
+	Latency time.Duration
+	// number of valid and invalid (or inconsistent) responses to sync requests
+	Responses uint64
+	Failures  uint64
+	// true while shard is being synced from peer
+	Active bool
+}
+
+// ratio of valid responses, with a neutral prior for a new peer
+func (p *SyncPeer) Reliability() float64 {
+	return float64(p.Responses+1) / float64(p.Responses+p.Failures+2)
+}
+
+// check whether a candidate ranks before another: reliable peers first, then deeper advertised
+// tips, then more reliable peers, then peers with lower (known) latency
+func (p *SyncPeer) before(other *SyncPeer) bool {
+	if r1, r2 := p.Reliability() >= MinSyncPeerReliability, other.Reliability() >= MinSyncPeerReliability; r1 != r2 {
+		return r1
+	}
+	if p.Depth != other.Depth {
+		return p.Depth > other.Depth
+	}
+	if p.Reliability() != other.Reliability() {
+		return p.Reliability() > other.Reliability()
+	}
+	if (p.Latency == 0) != (other.Latency == 0) {
+		return p.Latency != 0
+	}
+	return p.Latency < other.Latency
+}
+
+// statistics of a peer's responses to sync requests
+type syncPeerStats struct {
+	latency   time.Duration
+	responses uint64
+	failures  uint64
+	// time of peer's outstanding sync request
+	sentAt time.Time
+}
+
+// a peer that advertised a shard's tip
+type syncCandidate struct {
+	peer   p2p.Peer
+	anchor *dto.Anchor
+	active bool
+}
+
+// a peer's response to an ancestors request, verified against local shard DAG once shard is synced
+type ancestorsResponse struct {
+	peer      string
+	startHash [64]byte
+	ancestors [][64]byte
+}
+
+// a standby source to re-engage for a shard's sync
+type standbySource struct {
+	peer    p2p.Peer
+	shardId []byte
+}
+
+// candidate sources of a shard's sync
+type shardSources struct {
+	candidates map[string]*syncCandidate
+	ancestors  []ancestorsResponse
+}
+
+// sync sources of shards, keyed by shard id, and statistics of peers, keyed by peer name
+type syncPeers struct {
+	peers  map[string]*syncPeerStats
+	shards map[string]*shardSources
+	// transactions claimed for fetch by a sync source, along with their descendants, so that parallel
+	// sources of a shard fetch different parts of shard DAG
+	claims map[[64]byte]string
+	lock   sync.Mutex
+}
+
+func newSyncPeers() *syncPeers {
+	return &syncPeers{
+		peers:  make(map[string]*syncPeerStats),
+		shards: make(map[string]*shardSources),
+		claims: make(map[[64]byte]string),
+	}
+}
+
+func (s *syncPeers) stats(name string) *syncPeerStats {
+	stats, found := s.peers[name]
+	if !found {
+		stats = &syncPeerStats{}
+		s.peers[name] = stats
+	}
+	return stats
+}
+
+func (s *syncPeers) sources(shardId []byte) *shardSources {
+	sources, found := s.shards[string(shardId)]
+	if !found {
+		sources = &shardSources{candidates: make(map[string]*syncCandidate)}
+		s.shards[string(shardId)] = sources
+	}
+	return sources
+}
+
+func (s *syncPeers) syncPeer(name string, c *syncCandidate) *SyncPeer {
+	stats := s.stats(name)
+	return &SyncPeer{
+		Peer:      name,
+		Depth:     c.anchor.ShardSeq,
+		Weight:    c.anchor.Weight,
+		Latency:   stats.latency,
+		Responses: stats.responses,
+		Failures:  stats.failures,
+		Active:    c.active,
+	}
+}
+
+// select a peer that advertised a shard's tip ahead of local shard as a sync source, returns false
+// when peer is kept as standby, because max sources (0 for no limit) are already syncing the shard, or because peer
+// is unreliable while there are reliable candidates
+func (s *syncPeers) admit(shardId []byte, name string, peer p2p.Peer, anchor *dto.Anchor, max int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	sources := s.sources(shardId)
+	candidate := &syncCandidate{peer: peer, anchor: anchor}
+	if existing, found := sources.candidates[name]; found && existing.active {
+		candidate.active = true
+	}
+	sources.candidates[name] = candidate
+	if candidate.active {
+		return true
+	}
+	active, reliable := 0, false
+	for other, c := range sources.candidates {
+		if c.active {
+			active += 1
+		}
+		if other != name && s.syncPeer(other, c).Reliability() >= MinSyncPeerReliability {
+			reliable = true
+		}
+	}
+	if (max > 0 && active >= max) || (reliable && s.syncPeer(name, candidate).Reliability() < MinSyncPeerReliability) {
+		return false
+	}
+	candidate.active = true
+	return true
+}
+
+// record a sync request sent to peer, for measuring its latency
+func (s *syncPeers) requested(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.stats(name).sentAt = time.Now()
+}
+
+// record a peer's response to a sync request, invalid responses lower peer's reliability
+func (s *syncPeers) responded(name string, valid bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := s.stats(name)
+	if !valid {
+		stats.failures += 1
+	} else {
+		stats.responses += 1
+		if !stats.sentAt.IsZero() {
+			if sample := time.Since(stats.sentAt); stats.latency == 0 {
+				stats.latency = sample
+			} else {
+				stats.latency += (sample - stats.latency) / syncLatencyWeight
+			}
+		}
+	}
+	stats.sentAt = time.Time{}
+}
+
+// record a peer's ancestors response, for shard being synced from the peer
+func (s *syncPeers) ancestors(name string, startHash [64]byte, ancestors [][64]byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, sources := range s.shards {
+		if c, found := sources.candidates[name]; found && c.active {
+			sources.ancestors = append(sources.ancestors, ancestorsResponse{
+				peer:      name,
+				startHash: startHash,
+				ancestors: ancestors,
+			})
+		}
+	}
+}
+
+// claim a transaction (and its descendants) for fetch from a peer, returns false if
+// transaction is claimed by another sync source
+func (s *syncPeers) claim(hash [64]byte, name string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if owner, found := s.claims[hash]; found && owner != name {
+		return false
+	}
+	s.claims[hash] = name
+	return true
+}
+
+// end sync from a peer, releasing its claims. Once no source is syncing a shard, responses of its
+// sources are verified against local shard DAG, i.e. ancestors must match parent links and advertised
+// tip of finished peer must have been fetched. Returns standby candidates to re-engage, in order of rank,
+// whose advertised tips are still unknown locally
+func (s *syncPeers) finish(name string, max int, dagNode func(id [64]byte) *repo.DagNode) []standbySource {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for hash, owner := range s.claims {
+		if owner == name {
+			delete(s.claims, hash)
+		}
+	}
+	standby := []standbySource{}
+	for shardId, sources := range s.shards {
+		finished, found := sources.candidates[name]
+		if !found || !finished.active {
+			continue
+		}
+		finished.active = false
+		active := 0
+		for _, c := range sources.candidates {
+			if c.active {
+				active += 1
+			}
+		}
+		if active > 0 {
+			continue
+		}
+		// verify responses of shard's sources, now that shard is synced
+		for _, res := range sources.ancestors {
+			if !consistentAncestors(res, dagNode) {
+				s.stats(res.peer).failures += 1
+			}
+		}
+		sources.ancestors = nil
+		if dagNode(finished.anchor.ShardParent) == nil {
+			// peer did not deliver history up to the tip it advertised
+			s.stats(name).failures += 1
+		}
+		// re-engage best ranked standby sources still ahead of local shard
+		ranked := []*SyncPeer{}
+		for other, c := range sources.candidates {
+			if other != name && dagNode(c.anchor.ShardParent) == nil {
+				ranked = append(ranked, s.syncPeer(other, c))
+			}
+		}
+		sort.SliceStable(ranked, func(i, j int) bool { return ranked[i].before(ranked[j]) })
+		for i := 0; i < len(ranked) && (max <= 0 || i < max); i++ {
+			standby = append(standby, standbySource{
+				peer:    sources.candidates[ranked[i].Peer].peer,
+				shardId: []byte(shardId),
+			})
+		}
+	}
+	return standby
+}
+
+// check an ancestors response against parent links of local shard DAG, for transactions known locally
+func consistentAncestors(res ancestorsResponse, dagNode func(id [64]byte) *repo.DagNode) bool {
+	node := dagNode(res.startHash)
+	for _, ancestor := range res.ancestors {
+		if node == nil {
+			return true
+		}
+		if node.Parent != ancestor {
+			return false
+		}
+		node = dagNode(ancestor)
+	}
+	return true
+}
+
+// remove a disconnected peer from candidates of all shards
+func (s *syncPeers) remove(name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, sources := range s.shards {
+		delete(sources.candidates, name)
+	}
+}
+
+// get candidate sources of a shard, in order of rank
+func (s *syncPeers) rank(shardId []byte) []SyncPeer {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ranked := []SyncPeer{}
+	if sources, found := s.shards[string(shardId)]; found {
+		for name, c := range sources.candidates {
+			ranked = append(ranked, *s.syncPeer(name, c))
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].before(&ranked[j]) != ranked[j].before(&ranked[i]) {
+			return ranked[i].before(&ranked[j])
+		}
+		return ranked[i].Peer < ranked[j].Peer
+	})
+	return ranked
+}
+
+// select peer as a source for a shard it advertised ahead of local shard
+func (d *dlt) admitSyncSource(peer p2p.Peer, shardId []byte, anchor *dto.Anchor) bool {
+	if d.syncPeers.admit(shardId, peer.String(), peer, anchor, d.policies.MaxSyncPeers) {
+		return true
+	}
+	peer.Logger().Debug("Keeping peer as standby source for sync of shard: %x", shardId)
+	return false
+}
+
+// end sync with a peer, and re-engage standby sources of shards that are still behind
+func (d *dlt) endSync(peer p2p.Peer) {
+	d.syncs.done(peer.String())
+	for _, standby := range d.syncPeers.finish(peer.String(), d.policies.MaxSyncPeers, d.db.GetShardDagNode) {
+		// standby source responds with its shard sync message, upon which it's admitted as a source
+		msg := NewShardTipsRequestMsg(standby.shardId)
+		standby.peer.Logger().Debug("Re-engaging standby source for sync of shard: %x", standby.shardId)
+		standby.peer.Send(msg.Id(), msg.Code(), msg)
+	}
+}
+
+func (d *dlt) SyncPeers(shardId []byte) []SyncPeer {
+	return d.syncPeers.rank(shardId)
+}
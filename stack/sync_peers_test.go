@@ -0,0 +1,162 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
+	"testing"
+)
+
+// a local shard DAG lookup over specified nodes
+func testDag(nodes ...*repo.DagNode) func(id [64]byte) *repo.DagNode {
+	dag := make(map[[64]byte]*repo.DagNode)
+	for _, node := range nodes {
+		dag[node.TxId] = node
+	}
+	return func(id [64]byte) *repo.DagNode {
+		return dag[id]
+	}
+}
+
+func TestSyncPeers_Rank(t *testing.T) {
+	peers := newSyncPeers()
+	shardId := []byte("shard")
+	peers.admit(shardId, "shallow", nil, &dto.Anchor{ShardSeq: 5, ShardParent: dto.RandomHash()}, 0)
+	peers.admit(shardId, "deep", nil, &dto.Anchor{ShardSeq: 10, ShardParent: dto.RandomHash()}, 0)
+	peers.admit(shardId, "unreliable", nil, &dto.Anchor{ShardSeq: 20, ShardParent: dto.RandomHash()}, 0)
+	peers.admit(shardId, "slow", nil, &dto.Anchor{ShardSeq: 10, ShardParent: dto.RandomHash()}, 0)
+	for i := 0; i < 3; i++ {
+		peers.responded("unreliable", false)
+	}
+	peers.requested("deep")
+	peers.responded("deep", true)
+	peers.responded("slow", true)
+	peers.stats("slow").latency = peers.stats("deep").latency + 1000
+
+	ranked := peers.rank(shardId)
+	expected := []string{"deep", "slow", "shallow", "unreliable"}
+	if len(ranked) != len(expected) {
+		t.Fatalf("incorrect number of candidates: %d", len(ranked))
+	}
+	for i, name := range expected {
+		if ranked[i].Peer != name {
+			t.Errorf("incorrect candidate at rank %d: %s, expected: %s", i, ranked[i].Peer, name)
+		}
+	}
+	if ranked[0].Latency == 0 || ranked[0].Responses != 1 || !ranked[0].Active {
+		t.Errorf("incorrect stats of candidate: %+v", ranked[0])
+	}
+}
+
+func TestSyncPeers_AdmitMax(t *testing.T) {
+	peers := newSyncPeers()
+	shardId := []byte("shard")
+	peer1, peer2, peer3 := NewMockPeer(p2p.TestConn()), NewMockPeer(p2p.TestConn()), NewMockPeer(p2p.TestConn())
+	tip1, tip3 := dto.RandomHash(), dto.RandomHash()
+	if !peers.admit(shardId, "peer-1", peer1, &dto.Anchor{ShardSeq: 5, ShardParent: tip1}, 2) ||
+		!peers.admit(shardId, "peer-2", peer2, &dto.Anchor{ShardSeq: 5, ShardParent: tip1}, 2) {
+		t.Errorf("should admit peers up to max")
+	}
+	if peers.admit(shardId, "peer-3", peer3, &dto.Anchor{ShardSeq: 6, ShardParent: tip3}, 2) {
+		t.Errorf("should keep peer over max as standby")
+	}
+	// re-engage standby only after all sources finished
+	dag := testDag(&repo.DagNode{TxId: tip1})
+	if standby := peers.finish("peer-1", 2, dag); len(standby) != 0 {
+		t.Errorf("should not re-engage standby while shard is being synced")
+	}
+	if standby := peers.finish("peer-2", 2, dag); len(standby) != 1 || standby[0].peer != peer3 || string(standby[0].shardId) != "shard" {
+		t.Errorf("did not re-engage standby source ahead of local shard: %v", standby)
+	}
+	if !peers.admit(shardId, "peer-3", peer3, &dto.Anchor{ShardSeq: 6, ShardParent: tip3}, 2) {
+		t.Errorf("should admit re-engaged standby")
+	}
+}
+
+// an unreliable peer should be kept as standby while reliable peers are available
+func TestSyncPeers_AdmitUnreliable(t *testing.T) {
+	peers := newSyncPeers()
+	shardId := []byte("shard")
+	peers.responded("bad", false)
+	peers.responded("bad", false)
+	if !peers.admit(shardId, "bad", nil, &dto.Anchor{ShardSeq: 5}, 0) {
+		t.Errorf("should admit unreliable peer when it's the only candidate")
+	}
+	peers.finish("bad", 0, testDag())
+	peers.responded("good", true)
+	peers.responded("good", true)
+	peers.admit(shardId, "good", nil, &dto.Anchor{ShardSeq: 5}, 1)
+	peers.finish("good", 1, testDag(&repo.DagNode{}))
+	if peers.admit(shardId, "bad", nil, &dto.Anchor{ShardSeq: 5}, 0) {
+		t.Errorf("should not admit unreliable peer while reliable candidates are available")
+	}
+}
+
+func TestSyncPeers_Claims(t *testing.T) {
+	peers := newSyncPeers()
+	hash := dto.RandomHash()
+	if !peers.claim(hash, "peer-1") || !peers.claim(hash, "peer-1") {
+		t.Errorf("peer should claim a transaction")
+	}
+	if peers.claim(hash, "peer-2") {
+		t.Errorf("should not claim a transaction claimed by another peer")
+	}
+	peers.finish("peer-1", 0, testDag())
+	if !peers.claim(hash, "peer-2") {
+		t.Errorf("claims should be released when peer finishes")
+	}
+}
+
+// responses of sources should be verified against local shard DAG once shard is synced
+func TestSyncPeers_VerifyResponses(t *testing.T) {
+	peers := newSyncPeers()
+	shardId := []byte("shard")
+	genesis, tx1, tx2 := &repo.DagNode{TxId: dto.RandomHash()}, &repo.DagNode{TxId: dto.RandomHash()}, &repo.DagNode{TxId: dto.RandomHash()}
+	tx1.Parent, tx2.Parent = genesis.TxId, tx1.TxId
+	peers.admit(shardId, "honest", nil, &dto.Anchor{ShardSeq: 2, ShardParent: tx2.TxId}, 0)
+	peers.admit(shardId, "liar", nil, &dto.Anchor{ShardSeq: 2, ShardParent: tx2.TxId}, 0)
+	peers.ancestors("honest", tx2.TxId, [][64]byte{tx1.TxId, genesis.TxId})
+	peers.ancestors("liar", tx2.TxId, [][64]byte{dto.RandomHash(), genesis.TxId})
+	dag := testDag(genesis, tx1, tx2)
+	peers.finish("honest", 0, dag)
+	peers.finish("liar", 0, dag)
+	if peers.stats("honest").failures != 0 {
+		t.Errorf("consistent response counted as failure")
+	}
+	if peers.stats("liar").failures != 1 {
+		t.Errorf("inconsistent response not counted as failure")
+	}
+
+	// a source that did not deliver its advertised tip should be counted as failure
+	peers.admit(shardId, "honest", nil, &dto.Anchor{ShardSeq: 3, ShardParent: dto.RandomHash()}, 0)
+	peers.finish("honest", 0, dag)
+	if peers.stats("honest").failures != 1 {
+		t.Errorf("undelivered tip not counted as failure")
+	}
+}
+
+// a peer advertising a shard ahead of local, while max sources are syncing the shard, should be kept as standby
+func TestRECV_ShardSyncMsg_StandbySource(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.policies.MaxSyncPeers = 1
+	stack.syncPeers.admit(stack.app.ShardId, "other peer", nil, &dto.Anchor{ShardSeq: 5}, 1)
+
+	peer := NewMockPeer(p2p.TestConn())
+	events := make(chan controllerEvent, 10)
+	finished := make(chan struct{}, 2)
+	go func() {
+		stack.peerEventsListener(peer, events)
+		finished <- struct{}{}
+	}()
+	events <- newControllerEvent(RECV_ShardSyncMsg, NewShardSyncMsg(stack.app.ShardId, &dto.Anchor{Weight: 5, ShardSeq: 5}))
+	events <- newControllerEvent(SHUTDOWN, nil)
+	<-finished
+
+	if peer.SendCalled {
+		t.Errorf("should not sync from standby source")
+	}
+	if ranked := stack.SyncPeers(stack.app.ShardId); len(ranked) != 2 {
+		t.Errorf("incorrect number of candidates: %d", len(ranked))
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 The trust-net Authors
+// Shard sync progress tracking for DLT stack
+package stack
+
+import (
+	"sync"
+	"time"
+)
+
+// progress of a shard's sync with a peer
+type SyncStatus struct {
+	// shard being synced
+	ShardId []byte
+	// name of peer the shard is being synced with
+	Peer string
+	// true while sync is in progress
+	Syncing bool
+	// depth of local shard DAG when sync started
+	StartDepth uint64
+	// depth of local shard DAG reached so far
+	CurrentDepth uint64
+	// depth of remote shard DAG advertised by peer
+	TargetDepth uint64
+	// number of transactions fetched from peer so far
+	TxFetched uint64
+	// estimated number of transactions to fetch (based on DAG depth, i.e. a lower bound)
+	TxEstimated uint64
+	// unix time (seconds) when sync started
+	StartedAt int64
+	// unix time (seconds) when sync was last updated
+	UpdatedAt int64
+	// estimated time to complete sync (0 if unknown or done)
+	ETA time.Duration
+}
+
+// percentage of sync completed
+func (s *SyncStatus) Progress() float64 {
+	if !s.Syncing || s.TargetDepth <= s.StartDepth {
+		return 100
+	}
+	done := float64(s.CurrentDepth-s.StartDepth) / float64(s.TargetDepth-s.StartDepth) * 100
+	if done > 100 {
+		done = 100
+	}
+	return done
+}
+
+// tracker of sync progress for each shard
+type syncTracker struct {
+	shards map[string]*SyncStatus
+	// start times with sub-second precision, for ETA computation
+	started map[string]time.Time
+	lock    sync.RWMutex
+}
+
+func newSyncTracker() *syncTracker {
+	return &syncTracker{
+		shards:  make(map[string]*SyncStatus),
+		started: make(map[string]time.Time),
+	}
+}
+
+// record start of a shard sync with a peer
+func (t *syncTracker) start(shardId []byte, peer string, localDepth, remoteDepth uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := time.Now()
+	status := &SyncStatus{
+		ShardId:      shardId,
+		Peer:         peer,
+		Syncing:      true,
+		StartDepth:   localDepth,
+		CurrentDepth: localDepth,
+		TargetDepth:  remoteDepth,
+		StartedAt:    now.Unix(),
+		UpdatedAt:    now.Unix(),
+	}
+	if remoteDepth > localDepth {
+		status.TxEstimated = remoteDepth - localDepth
+	}
+	t.shards[string(shardId)] = status
+	t.started[string(shardId)] = now
+}
+
+// record a transaction fetched during shard sync
+func (t *syncTracker) fetched(shardId []byte, depth uint64) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	status, found := t.shards[string(shardId)]
+	if !found || !status.Syncing {
+		return
+	}
+	now := time.Now()
+	status.TxFetched += 1
+	status.UpdatedAt = now.Unix()
+	if depth > status.CurrentDepth {
+		status.CurrentDepth = depth
+	}
+	// DAG may be wider than deep, keep estimate at least as much as fetched
+	if status.TxEstimated < status.TxFetched {
+		status.TxEstimated = status.TxFetched
+	}
+	if status.CurrentDepth >= status.TargetDepth {
+		status.Syncing = false
+		status.ETA = 0
+		return
+	}
+	// estimate remaining time from rate of depth progress so far
+	if progress := status.CurrentDepth - status.StartDepth; progress > 0 {
+		elapsed := now.Sub(t.started[string(shardId)])
+		status.ETA = elapsed / time.Duration(progress) * time.Duration(status.TargetDepth-status.CurrentDepth)
+	}
+}
+
+// record end of sync with a peer, for all shards being synced with that peer
+func (t *syncTracker) done(peer string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, status := range t.shards {
+		if status.Peer == peer && status.Syncing {
+			status.Syncing = false
+			status.ETA = 0
+			status.UpdatedAt = time.Now().Unix()
+		}
+	}
+}
+
+// get a snapshot of sync status for all shards
+func (t *syncTracker) status() []SyncStatus {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	statuses := make([]SyncStatus, 0, len(t.shards))
+	for _, status := range t.shards {
+		statuses = append(statuses, *status)
+	}
+	return statuses
+}
+
+// check whether a shard is being synced with any peer
+func (t *syncTracker) syncing(shardId []byte) bool {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	status, found := t.shards[string(shardId)]
+	return found && status.Syncing
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+	"time"
+)
+
+// test that sync progress is tracked as transactions are fetched
+func TestSyncTracker_Progress(t *testing.T) {
+	tracker := newSyncTracker()
+	tracker.start([]byte("test shard"), "test peer", 10, 20)
+
+	statuses := tracker.status()
+	if len(statuses) != 1 || !statuses[0].Syncing || statuses[0].TxEstimated != 10 || statuses[0].Progress() != 0 {
+		t.Errorf("incorrect initial sync status: %v", statuses)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	for depth := uint64(11); depth <= 15; depth++ {
+		tracker.fetched([]byte("test shard"), depth)
+	}
+	status := tracker.status()[0]
+	if status.CurrentDepth != 15 || status.TxFetched != 5 || status.Progress() != 50 {
+		t.Errorf("incorrect sync progress: %v", status)
+	}
+	if status.ETA <= 0 {
+		t.Errorf("sync ETA not estimated")
+	}
+
+	// reaching target depth should complete the sync
+	for depth := uint64(16); depth <= 20; depth++ {
+		tracker.fetched([]byte("test shard"), depth)
+	}
+	if status := tracker.status()[0]; status.Syncing || status.ETA != 0 || status.Progress() != 100 {
+		t.Errorf("sync should have completed: %v", status)
+	}
+}
+
+// test that end of sync with a peer completes all shards synced with that peer
+func TestSyncTracker_Done(t *testing.T) {
+	tracker := newSyncTracker()
+	tracker.start([]byte("shard 1"), "peer 1", 0, 20)
+	tracker.start([]byte("shard 2"), "peer 2", 0, 20)
+	tracker.done("peer 1")
+
+	for _, status := range tracker.status() {
+		if string(status.ShardId) == "shard 1" && status.Syncing {
+			t.Errorf("sync with peer 1 should have ended")
+		} else if string(status.ShardId) == "shard 2" && !status.Syncing {
+			t.Errorf("sync with peer 2 should not have ended")
+		}
+	}
+	// transactions fetched after end of sync should not be counted
+	tracker.fetched([]byte("shard 1"), 10)
+	for _, status := range tracker.status() {
+		if string(status.ShardId) == "shard 1" && status.TxFetched != 0 {
+			t.Errorf("fetch after end of sync should be ignored")
+		}
+	}
+}
+
+// test that stack reports shard sync status
+func TestSyncStatus(t *testing.T) {
+	// create a DLT stack instance with registered app and initialized mocks
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+
+	if len(stack.SyncStatus()) != 0 {
+		t.Errorf("stack should not report sync before any sync")
+	}
+
+	remote := dto.TestAnchor()
+	remote.ShardSeq = 5
+	stack.startSync(peer, []byte("test shard"), nil, remote)
+	if statuses := stack.SyncStatus(); len(statuses) != 1 || statuses[0].TargetDepth != 5 || statuses[0].Peer != peer.String() {
+		t.Errorf("incorrect sync status: %v", statuses)
+	}
+}
@@ -3,6 +3,7 @@ package stack
 
 import (
 	devp2p "github.com/ethereum/go-ethereum/p2p"
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/log"
 	"github.com/trust-net/dag-lib-go/stack/dto"
@@ -11,6 +12,7 @@ import (
 	"github.com/trust-net/dag-lib-go/stack/repo"
 	"github.com/trust-net/dag-lib-go/stack/shard"
 	"github.com/trust-net/dag-lib-go/stack/state"
+	"io"
 	"net"
 )
 
@@ -38,6 +40,12 @@ func TestSignedTransaction(data string) dto.Transaction {
 }
 
 type mockEndorser struct {
+	*mockEndorserCalls
+	orig endorsement.Endorser
+}
+
+// calls recorded by a mock endorser, shared with its batch views
+type mockEndorserCalls struct {
 	TxId                 [64]byte
 	Tx                   dto.Transaction
 	TxHandlerCalled      bool
@@ -46,8 +54,9 @@ type mockEndorser struct {
 	ReplaceCalled        bool
 	ValidateCalled       bool
 	ApproverCalled       bool
+	AnchorIssuedCalled   bool
+	AnchorAuditCalled    bool
 	HandlerReturn        error
-	orig                 endorsement.Endorser
 }
 
 func (e *mockEndorser) Validate(r *dto.TxRequest) error {
@@ -72,6 +81,14 @@ func (e *mockEndorser) Handle(tx dto.Transaction) (int, error) {
 	}
 }
 
+func (e *mockEndorser) SetRateLimits(submitted, network *endorsement.RateLimit) {
+	e.orig.SetRateLimits(submitted, network)
+}
+
+func (e *mockEndorser) Throttled() (submitted, network uint64) {
+	return e.orig.Throttled()
+}
+
 func (e *mockEndorser) Update(tx dto.Transaction) error {
 	e.TxUpdateCalled = true
 	return e.orig.Update(tx)
@@ -87,35 +104,81 @@ func (e *mockEndorser) Replace(tx dto.Transaction) error {
 	return e.orig.Replace(tx)
 }
 
+func (e *mockEndorser) AnchorIssued(submitter []byte, seq uint64, lastTx [64]byte, shardId []byte, a *dto.Anchor) error {
+	e.AnchorIssuedCalled = true
+	return e.orig.AnchorIssued(submitter, seq, lastTx, shardId, a)
+}
+
+func (e *mockEndorser) AnchorAudit(submitter []byte) []repo.AnchorRecord {
+	e.AnchorAuditCalled = true
+	return e.orig.AnchorAudit(submitter)
+}
+
+func (e *mockEndorser) AbandonedAnchors(submitter []byte) []repo.AnchorRecord {
+	e.AnchorAuditCalled = true
+	return e.orig.AbandonedAnchors(submitter)
+}
+
+func (e *mockEndorser) WithBatch(batch repo.Batch) endorsement.Endorser {
+	return &mockEndorser{mockEndorserCalls: e.mockEndorserCalls, orig: e.orig.WithBatch(batch)}
+}
+
 func (e *mockEndorser) Reset() {
-	*e = mockEndorser{orig: e.orig}
+	*e.mockEndorserCalls = mockEndorserCalls{}
 }
 
 func NewMockEndorser(db repo.DltDb) *mockEndorser {
 	orig, _ := endorsement.NewEndorser(db)
 	return &mockEndorser{
-		HandlerReturn: nil,
-		orig:          orig,
+		mockEndorserCalls: &mockEndorserCalls{},
+		orig:              orig,
 	}
 }
 
 type mockSharder struct {
-	LockStateCalled   bool
-	UnlockStateCalled bool
-	CommitStateCalled bool
-	IsRegistered      bool
-	ShardId           []byte
-	AnchorCalled      bool
-	SyncAnchorCalled  bool
-	AncestorsCalled   bool
-	ChildrenCalled    bool
-	ApproverCalled    bool
-	TxHandlerCalled   bool
-	GetStateCalled    bool
-	GetStateKey       []byte
-	FlushCalled       bool
-	TxHandler         func(tx dto.Transaction, state state.State) error
-	orig              shard.Sharder
+	*mockSharderCalls
+	orig shard.Sharder
+}
+
+// calls recorded by a mock sharder, shared with its batch views
+type mockSharderCalls struct {
+	LockStateCalled     bool
+	UnlockStateCalled   bool
+	CommitStateCalled   bool
+	IsRegistered        bool
+	ShardId             []byte
+	AnchorCalled        bool
+	SyncAnchorCalled    bool
+	AncestorsCalled     bool
+	ChildrenCalled      bool
+	DescendantsCalled   bool
+	ApproverCalled      bool
+	TxHandlerCalled     bool
+	GetStateCalled      bool
+	GetStateKey         []byte
+	GetStateAtSeqCalled bool
+	ListByOwnerCalled   bool
+	FlushCalled         bool
+	ResetCalled         bool
+	DropCalled          bool
+	ResolveCalled       bool
+	StatsCalled         bool
+	PauseCalled         bool
+	DeadLettersCalled   bool
+	LastAppliedCalled   bool
+	CheckpointCalled    bool
+	PruneCalled         bool
+	SwapHandlerCalled   bool
+	MaxUncles           int
+	MaxValueSize        int
+	ShardLogCalled      bool
+	SnapshotCalled      bool
+	RestoreCalled       bool
+	// number of approvals to fail with stale anchor, and count of approvals
+	StaleAnchors    int
+	ApproveCount    int
+	TxHandler       func(tx dto.Transaction, state state.State) error
+	RegisterOptions *shard.RegisterOptions
 }
 
 func (s *mockSharder) LockState() error {
@@ -130,6 +193,16 @@ func (s *mockSharder) UnlockState() {
 	s.orig.UnlockState()
 }
 
+func (s *mockSharder) LockShardState(shardId []byte) error {
+	s.LockStateCalled = true
+	return s.orig.LockShardState(shardId)
+}
+
+func (s *mockSharder) UnlockShardState(shardId []byte) {
+	s.UnlockStateCalled = true
+	s.orig.UnlockShardState(shardId)
+}
+
 func (s *mockSharder) CommitState(tx dto.Transaction) error {
 	s.CommitStateCalled = true
 	// transaction processed successfully, persist world state
@@ -143,12 +216,42 @@ func (s *mockSharder) Register(shardId []byte, txHandler func(tx dto.Transaction
 	return s.orig.Register(shardId, txHandler)
 }
 
+func (s *mockSharder) RegisterWithOptions(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, opts *shard.RegisterOptions) error {
+	s.IsRegistered = true
+	s.ShardId = shardId
+	s.TxHandler = txHandler
+	s.RegisterOptions = opts
+	return s.orig.RegisterWithOptions(shardId, txHandler, opts)
+}
+
 func (s *mockSharder) Unregister() error {
 	s.IsRegistered = false
 	s.TxHandler = nil
 	return s.orig.Unregister()
 }
 
+func (s *mockSharder) UnregisterShard(shardId []byte) error {
+	if string(shardId) == string(s.ShardId) {
+		s.IsRegistered = false
+		s.TxHandler = nil
+	}
+	return s.orig.UnregisterShard(shardId)
+}
+
+func (s *mockSharder) Pause() error {
+	s.PauseCalled = true
+	s.TxHandler = nil
+	return s.orig.Pause()
+}
+
+func (s *mockSharder) PauseShard(shardId []byte) error {
+	s.PauseCalled = true
+	if string(shardId) == string(s.ShardId) {
+		s.TxHandler = nil
+	}
+	return s.orig.PauseShard(shardId)
+}
+
 func (s *mockSharder) Anchor(a *dto.Anchor) error {
 	s.AnchorCalled = true
 	return s.orig.Anchor(a)
@@ -169,8 +272,18 @@ func (s *mockSharder) Children(parent [64]byte) [][64]byte {
 	return s.orig.Children(parent)
 }
 
+func (s *mockSharder) Descendants(start [64]byte, max uint64) ([][64]byte, [][64]byte) {
+	s.DescendantsCalled = true
+	return s.orig.Descendants(start, max)
+}
+
 func (s *mockSharder) Approve(tx dto.Transaction) error {
 	s.ApproverCalled = true
+	s.ApproveCount += 1
+	if s.StaleAnchors > 0 {
+		s.StaleAnchors -= 1
+		return dto.NewTxError(dto.ErrStaleAnchor, "parent transaction unknown for shard")
+	}
 	return s.orig.Approve(tx)
 }
 
@@ -185,19 +298,127 @@ func (s *mockSharder) GetState(key []byte) (*state.Resource, error) {
 	return s.orig.GetState(key)
 }
 
+func (s *mockSharder) GetShardState(shardId []byte, key []byte) (*state.Resource, error) {
+	s.GetStateCalled = true
+	s.GetStateKey = key
+	return s.orig.GetShardState(shardId, key)
+}
+
+func (s *mockSharder) GetStateAtSeq(shardId []byte, seq uint64, key []byte) (*state.Resource, error) {
+	s.GetStateAtSeqCalled = true
+	s.GetStateKey = key
+	return s.orig.GetStateAtSeq(shardId, seq, key)
+}
+
+func (s *mockSharder) ListByOwner(owner []byte) ([]*state.Resource, error) {
+	s.ListByOwnerCalled = true
+	return s.orig.ListByOwner(owner)
+}
+
+func (s *mockSharder) ListShardByOwner(shardId []byte, owner []byte) ([]*state.Resource, error) {
+	s.ListByOwnerCalled = true
+	return s.orig.ListShardByOwner(shardId, owner)
+}
+
 func (s *mockSharder) Flush(shardId []byte) error {
 	s.FlushCalled = true
 	return s.orig.Flush(shardId)
 }
 
+func (s *mockSharder) ResetShard(shardId []byte) error {
+	s.ResetCalled = true
+	return s.orig.ResetShard(shardId)
+}
+
+func (s *mockSharder) DropShard(shardId []byte) error {
+	s.DropCalled = true
+	return s.orig.DropShard(shardId)
+}
+
+func (s *mockSharder) Resolve(local, competing dto.Transaction) (*shard.Resolution, error) {
+	s.ResolveCalled = true
+	return s.orig.Resolve(local, competing)
+}
+
+func (s *mockSharder) DeadLetters(shardId []byte) []shard.DeadLetter {
+	s.DeadLettersCalled = true
+	return s.orig.DeadLetters(shardId)
+}
+
+func (s *mockSharder) LastApplied(shardId []byte) ([64]byte, uint64) {
+	s.LastAppliedCalled = true
+	return s.orig.LastApplied(shardId)
+}
+
+func (s *mockSharder) SetCheckpoint(cp *shard.Checkpoint) error {
+	s.CheckpointCalled = true
+	return s.orig.SetCheckpoint(cp)
+}
+
+func (s *mockSharder) Checkpoint(shardId []byte) *shard.Checkpoint {
+	return s.orig.Checkpoint(shardId)
+}
+
+func (s *mockSharder) SetRetention(policy *shard.Retention) error {
+	return s.orig.SetRetention(policy)
+}
+
+func (s *mockSharder) Retention(shardId []byte) *shard.Retention {
+	return s.orig.Retention(shardId)
+}
+
+func (s *mockSharder) Prune(shardId []byte) (*shard.PruneReport, error) {
+	s.PruneCalled = true
+	return s.orig.Prune(shardId)
+}
+
+func (s *mockSharder) SwapHandler(shardId []byte, txHandler func(tx dto.Transaction, state state.State) error, verify int) (*shard.SwapReport, error) {
+	s.SwapHandlerCalled = true
+	return s.orig.SwapHandler(shardId, txHandler, verify)
+}
+
+func (s *mockSharder) SetMaxValueSize(size int) {
+	s.MaxValueSize = size
+	s.orig.SetMaxValueSize(size)
+}
+
+func (s *mockSharder) SetMaxUncles(max int) {
+	s.MaxUncles = max
+	s.orig.SetMaxUncles(max)
+}
+
+func (s *mockSharder) ShardLog(shardId []byte, cursor *shard.LogCursor, limit int) ([]dto.Transaction, *shard.LogCursor, error) {
+	s.ShardLogCalled = true
+	return s.orig.ShardLog(shardId, cursor, limit)
+}
+
+func (s *mockSharder) Snapshot(shardId []byte, w io.Writer, codec common.Codec) (*state.SnapshotHeader, error) {
+	s.SnapshotCalled = true
+	return s.orig.Snapshot(shardId, w, codec)
+}
+
+func (s *mockSharder) Restore(snap *state.Snapshot, tips []dto.Transaction) error {
+	s.RestoreCalled = true
+	return s.orig.Restore(snap, tips)
+}
+
+func (s *mockSharder) Stats(shardId []byte) *shard.ShardStats {
+	s.StatsCalled = true
+	return s.orig.Stats(shardId)
+}
+
+func (s *mockSharder) WithBatch(batch repo.Batch) shard.Sharder {
+	return &mockSharder{mockSharderCalls: s.mockSharderCalls, orig: s.orig.WithBatch(batch)}
+}
+
 func (s *mockSharder) Reset() {
-	*s = mockSharder{orig: s.orig}
+	*s.mockSharderCalls = mockSharderCalls{}
 }
 
 func NewMockSharder(dltDb repo.DltDb) *mockSharder {
 	//	db, _ := repo.NewDltDb(db.NewInMemDbProvider())
 	orig, _ := shard.NewSharder(dltDb, db.NewInMemDbProvider())
-	return &mockSharder{orig: orig}
+	return &mockSharder{mockSharderCalls: &mockSharderCalls{}, orig: orig}
 }
 
 type mockPeer struct {
@@ -0,0 +1,206 @@
+// Copyright 2019 The trust-net Authors
+// Reconciliation of shard tips with peers, by exchanging sketches (invertible bloom lookup tables) of
+// tips instead of full tip lists, so that cost depends on the difference of tips rather than their number
+package stack
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"time"
+)
+
+// interval at which node reconciles its registered shard's tips with peers, 0 to disable
+var TipReconcileInterval = time.Duration(0)
+
+// number of cells in a tip sketch, a sketch reliably decodes a difference of up to about a quarter as many
+// tips (a larger difference falls back to shard sync)
+var TipSketchCells = 96
+
+// number of cells each ID is inserted into, one cell in each partition of the sketch
+const sketchHashes = 3
+
+// max number of cells accepted in a peer's sketch
+const maxSketchCells = 1024
+
+// an invertible bloom lookup table of transaction IDs, the difference of two sketches decodes into
+// the IDs present in only one of the sets, as long as the difference is small relative to sketch size
+type tipSketch struct {
+	counts   []int64
+	idSums   [][64]byte
+	hashSums []uint64
+}
+
+func newTipSketch(size int) *tipSketch {
+	// same number of cells in each partition
+	size -= size % sketchHashes
+	if size < sketchHashes {
+		size = sketchHashes
+	}
+	return &tipSketch{
+		counts:   make([]int64, size),
+		idSums:   make([][64]byte, size),
+		hashSums: make([]uint64, size),
+	}
+}
+
+// sketch of a peer, nil if sketch is malformed
+func sketchFromCells(cells []SketchCell) *tipSketch {
+	if len(cells) == 0 || len(cells)%sketchHashes != 0 || len(cells) > maxSketchCells {
+		return nil
+	}
+	s := newTipSketch(len(cells))
+	for i, c := range cells {
+		s.counts[i], s.idSums[i], s.hashSums[i] = int64(c.Count), c.IdSum, c.HashSum
+	}
+	return s
+}
+
+func (s *tipSketch) cells() []SketchCell {
+	cells := make([]SketchCell, len(s.counts))
+	for i := range cells {
+		cells[i] = SketchCell{Count: uint64(s.counts[i]), IdSum: s.idSums[i], HashSum: s.hashSums[i]}
+	}
+	return cells
+}
+
+// check hash of an ID, to detect cells holding a single ID
+func sketchCheckHash(id [64]byte) uint64 {
+	sum := sha256.Sum256(id[:])
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// cells of an ID, IDs are hashes already, so distinct parts of ID select its cell in each partition
+func (s *tipSketch) indexes(id [64]byte) [sketchHashes]int {
+	part := len(s.counts) / sketchHashes
+	indexes := [sketchHashes]int{}
+	for i := range indexes {
+		indexes[i] = i*part + int(binary.BigEndian.Uint64(id[i*8:i*8+8])%uint64(part))
+	}
+	return indexes
+}
+
+// add (count 1) or remove (count -1) an ID
+func (s *tipSketch) update(id [64]byte, count int64) {
+	check := sketchCheckHash(id)
+	for _, i := range s.indexes(id) {
+		s.counts[i] += count
+		for j := range id {
+			s.idSums[i][j] ^= id[j]
+		}
+		s.hashSums[i] ^= check
+	}
+}
+
+func (s *tipSketch) insert(id [64]byte) {
+	s.update(id, 1)
+}
+
+// check whether a cell holds a single ID (of either set)
+func (s *tipSketch) pure(i int) bool {
+	return (s.counts[i] == 1 || s.counts[i] == -1) && s.hashSums[i] == sketchCheckHash(s.idSums[i])
+}
+
+// decode difference with another sketch of same size, into IDs present only in this sketch and IDs present only
+// in other sketch, returns false when difference is too large to decode
+func (s *tipSketch) diff(other *tipSketch) (local, remote [][64]byte, ok bool) {
+	if len(other.counts) != len(s.counts) {
+		return nil, nil, false
+	}
+	d := newTipSketch(len(s.counts))
+	for i := range d.counts {
+		d.counts[i] = s.counts[i] - other.counts[i]
+		for j := range d.idSums[i] {
+			d.idSums[i][j] = s.idSums[i][j] ^ other.idSums[i][j]
+		}
+		d.hashSums[i] = s.hashSums[i] ^ other.hashSums[i]
+	}
+	// peel cells holding a single ID, until no more such cells are left
+	for peeled := true; peeled; {
+		peeled = false
+		for i := range d.counts {
+			if !d.pure(i) {
+				continue
+			}
+			id, count := d.idSums[i], d.counts[i]
+			if count > 0 {
+				local = append(local, id)
+			} else {
+				remote = append(remote, id)
+			}
+			d.update(id, -count)
+			peeled = true
+		}
+	}
+	for i := range d.counts {
+		if d.counts[i] != 0 || d.idSums[i] != [64]byte{} || d.hashSums[i] != 0 {
+			return nil, nil, false
+		}
+	}
+	return local, remote, true
+}
+
+// sketch of a shard's tips (called with lock held)
+func (d *dlt) shardTipsSketch(shardId []byte, size int) *tipSketch {
+	sketch := newTipSketch(size)
+	for _, tip := range d.db.ShardTips(shardId) {
+		sketch.insert(tip)
+	}
+	return sketch
+}
+
+// send sketch of registered apps' shard tips to peers, so that tips missing on either side are exchanged
+func (d *dlt) reconcileTips() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, app := range d.apps {
+		msg := NewShardTipsSketchMsg(app.ShardId, d.shardTipsSketch(app.ShardId, TipSketchCells).cells(), false)
+		d.p2p.Broadcast(msg.Id(), msg.Code(), msg)
+	}
+}
+
+// reconcile shard's tips with a peer's sketch: local tips the peer lacks are sent to the peer as transactions,
+// and tips of peer unknown locally are requested by replying with local sketch (unless sketch is a reply
+// itself). When difference is too large to decode, peer is asked for its shard sync message instead
+func (d *dlt) handleRECV_ShardTipsSketchMsg(peer p2p.Peer, msg *ShardTipsSketchMsg) error {
+	if !d.isStored(msg.ShardId) {
+		return nil
+	}
+	remote := sketchFromCells(msg.Cells)
+	if remote == nil {
+		return errors.New("malformed tip sketch")
+	}
+	sketch := d.shardTipsSketch(msg.ShardId, len(msg.Cells))
+	localOnly, remoteOnly, ok := sketch.diff(remote)
+	if !ok {
+		peer.Logger().Debug("Tips of shard differ too much to reconcile by sketch: %x", msg.ShardId)
+		req := NewShardTipsRequestMsg(msg.ShardId)
+		return peer.Send(req.Id(), req.Code(), req)
+	}
+	if len(localOnly) > 0 {
+		// reset the seen set at peer, tips may have been sent earlier and lost
+		peer.ResetSeen()
+		for _, id := range localOnly {
+			// genesis is not sent, peer creates it locally
+			if node := d.db.GetShardDagNode(id); node == nil || node.Depth == 0 {
+				continue
+			}
+			if tx := d.db.GetTx(id); tx != nil {
+				peer.Send(id[:], TransactionMsgCode, tx)
+			}
+		}
+	}
+	missing := 0
+	for _, id := range remoteOnly {
+		if d.db.GetShardDagNode(id) == nil {
+			missing += 1
+		}
+	}
+	if missing > 0 && !msg.Reply {
+		peer.Logger().Debug("Requesting %d tips of shard missing locally: %x", missing, msg.ShardId)
+		reply := NewShardTipsSketchMsg(msg.ShardId, sketch.cells(), true)
+		return peer.Send(reply.Id(), reply.Code(), reply)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+func testSketch(ids [][64]byte) *tipSketch {
+	sketch := newTipSketch(TipSketchCells)
+	for _, id := range ids {
+		sketch.insert(id)
+	}
+	return sketch
+}
+
+// deterministic IDs, so that decoding (which is probabilistic) is same across test runs
+func testIds(prefix string, count int) [][64]byte {
+	ids := make([][64]byte, count)
+	for i := range ids {
+		ids[i] = sha512.Sum512([]byte(fmt.Sprintf("%s-%d", prefix, i)))
+	}
+	return ids
+}
+
+// difference of sketches of large sets should decode into the few IDs present on either side
+func TestTipSketch_Diff(t *testing.T) {
+	common, local, remote := testIds("common", 200), testIds("local", 5), testIds("remote", 7)
+	s1 := testSketch(append(append([][64]byte{}, common...), local...))
+	s2 := testSketch(append(append([][64]byte{}, common...), remote...))
+	gotLocal, gotRemote, ok := s1.diff(s2)
+	if !ok {
+		t.Fatalf("failed to decode sketch difference")
+	}
+	contains := func(ids [][64]byte, id [64]byte) bool {
+		for _, i := range ids {
+			if i == id {
+				return true
+			}
+		}
+		return false
+	}
+	if len(gotLocal) != len(local) || len(gotRemote) != len(remote) {
+		t.Errorf("incorrect difference: %d local, %d remote", len(gotLocal), len(gotRemote))
+	}
+	for _, id := range local {
+		if !contains(gotLocal, id) {
+			t.Errorf("missing local ID: %x", id[:8])
+		}
+	}
+	for _, id := range remote {
+		if !contains(gotRemote, id) {
+			t.Errorf("missing remote ID: %x", id[:8])
+		}
+	}
+	// same sets have no difference
+	if l, r, ok := s1.diff(s1); !ok || len(l) != 0 || len(r) != 0 {
+		t.Errorf("expected no difference for same set")
+	}
+}
+
+// difference too large for sketch size should fail to decode, and malformed sketches should be refused
+func TestTipSketch_DiffTooLarge(t *testing.T) {
+	if _, _, ok := testSketch(testIds("local", 100)).diff(testSketch(nil)); ok {
+		t.Errorf("did not expect difference larger than sketch to decode")
+	}
+	if _, _, ok := testSketch(nil).diff(newTipSketch(TipSketchCells * 2)); ok {
+		t.Errorf("did not expect sketches of different size to decode")
+	}
+	if sketchFromCells(make([]SketchCell, TipSketchCells+1)) != nil || sketchFromCells(nil) != nil {
+		t.Errorf("did not expect malformed sketch")
+	}
+	if sketchFromCells(testSketch(testIds("local", 3)).cells()) == nil {
+		t.Errorf("failed to build sketch from cells")
+	}
+}
+
+// node should broadcast sketch of registered shard's tips
+func TestReconcileTips(t *testing.T) {
+	stack, _, _, p2pLayer := initMocks()
+	tx, _ := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	stack.reconcileTips()
+	if !p2pLayer.DidBroadcast || p2pLayer.BroadcastCode != ShardTipsSketchMsgCode {
+		t.Fatalf("did not broadcast tips sketch")
+	}
+	msg := p2pLayer.BroadcastMsg.(*ShardTipsSketchMsg)
+	if string(msg.ShardId) != string(stack.app.ShardId) || msg.Reply {
+		t.Errorf("incorrect sketch message: %x, %v", msg.ShardId, msg.Reply)
+	}
+	if local, _, ok := testSketch([][64]byte{tx.Id()}).diff(sketchFromCells(msg.Cells)); !ok || len(local) != 0 {
+		t.Errorf("sketch does not match shard's tips")
+	}
+}
+
+// tips missing at peer should be sent to peer as transactions
+func TestShardTipsSketch_SendMissing(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tx, _ := stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	peer := NewMockPeer(p2p.TestConn())
+	msg := NewShardTipsSketchMsg(stack.app.ShardId, testSketch(nil).cells(), false)
+	if err := stack.handleRECV_ShardTipsSketchMsg(peer, msg); err != nil {
+		t.Fatalf("failed to handle sketch: %s", err)
+	}
+	if !peer.ResetSeenCalled || peer.SendMsgCode != TransactionMsgCode || peer.SendMsg.(dto.Transaction).Id() != tx.Id() {
+		t.Errorf("did not send missing tip to peer")
+	}
+}
+
+// tips of peer unknown locally should be requested by replying with local sketch, but a reply is not replied to
+func TestShardTipsSketch_RequestMissing(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	tips := stack.db.ShardTips(stack.app.ShardId)
+	peer := NewMockPeer(p2p.TestConn())
+	msg := NewShardTipsSketchMsg(stack.app.ShardId, testSketch(append(tips, dto.RandomHash())).cells(), false)
+	if err := stack.handleRECV_ShardTipsSketchMsg(peer, msg); err != nil {
+		t.Fatalf("failed to handle sketch: %s", err)
+	}
+	if peer.SendMsgCode != ShardTipsSketchMsgCode || !peer.SendMsg.(*ShardTipsSketchMsg).Reply {
+		t.Errorf("did not reply with local sketch")
+	}
+	peer = NewMockPeer(p2p.TestConn())
+	msg.Reply = true
+	stack.handleRECV_ShardTipsSketchMsg(peer, msg)
+	if peer.SendCalled {
+		t.Errorf("did not expect reply to a reply sketch")
+	}
+}
+
+// tips differing too much to decode should fall back to requesting peer's shard sync message
+func TestShardTipsSketch_Fallback(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	peer := NewMockPeer(p2p.TestConn())
+	msg := NewShardTipsSketchMsg(stack.app.ShardId, testSketch(testIds("remote", 100)).cells(), false)
+	if err := stack.handleRECV_ShardTipsSketchMsg(peer, msg); err != nil {
+		t.Fatalf("failed to handle sketch: %s", err)
+	}
+	if peer.SendMsgCode != ShardTipsRequestMsgCode {
+		t.Errorf("did not request shard sync from peer")
+	}
+	// malformed sketch should be refused
+	msg.Cells = msg.Cells[1:]
+	if err := stack.handleRECV_ShardTipsSketchMsg(peer, msg); err == nil {
+		t.Errorf("did not expect malformed sketch to be handled")
+	}
+}
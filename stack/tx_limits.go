@@ -0,0 +1,44 @@
+// Copyright 2019 The trust-net Authors
+// Size limits of transactions, enforced on submissions and on network transactions before their signatures are
+// verified, so that peers cannot flood node with oversized transactions
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+)
+
+// max size (bytes) of a transaction's shard id
+var MaxShardIdSize = 64
+
+// max number of uncles in a network transaction's anchor, 0 for no limit (node's own anchors are capped to same)
+var MaxUnclesPerAnchor = 256
+
+// check a transaction request's payload and shard id against stack's limits, returns a *LimitError
+func (d *dlt) checkRequestLimits(req *dto.TxRequest) error {
+	switch {
+	case len(req.Payload) > d.policies.MaxPayloadSize:
+		return &LimitError{Limit: "stack.max_payload_size", Max: uint64(d.policies.MaxPayloadSize), Value: uint64(len(req.Payload))}
+	case d.policies.MaxShardIdSize > 0 && len(req.ShardId) > d.policies.MaxShardIdSize:
+		return &LimitError{Limit: "stack.max_shard_id_size", Max: uint64(d.policies.MaxShardIdSize), Value: uint64(len(req.ShardId))}
+	}
+	return nil
+}
+
+// check a network transaction against stack's limits, returns a *LimitError
+func (d *dlt) checkLimits(tx dto.Transaction) error {
+	if err := d.checkRequestLimits(tx.Request()); err != nil {
+		return err
+	}
+	if uncles := len(tx.Anchor().ShardUncles); d.policies.MaxUnclesPerAnchor > 0 && uncles > d.policies.MaxUnclesPerAnchor {
+		return &LimitError{Limit: "stack.max_uncles_per_anchor", Max: uint64(d.policies.MaxUnclesPerAnchor), Value: uint64(uncles)}
+	}
+	return nil
+}
+
+// max number of uncles node merges into its own anchors, within the limit its peers accept
+func (p *Policies) anchorUncles() int {
+	if p.MaxUnclesPerAnchor > 0 && (p.MaxAnchorUncles == 0 || p.MaxAnchorUncles > p.MaxUnclesPerAnchor) {
+		return p.MaxUnclesPerAnchor
+	}
+	return p.MaxAnchorUncles
+}
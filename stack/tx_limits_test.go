@@ -0,0 +1,72 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+)
+
+// network transactions exceeding limits should fail validation with limit error
+func TestValidateTx_Limits(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	for limit, update := range map[string]func(tx dto.Transaction){
+		"stack.max_payload_size":      func(tx dto.Transaction) { tx.Request().Payload = make([]byte, MaxPayloadSize+1) },
+		"stack.max_shard_id_size":     func(tx dto.Transaction) { tx.Request().ShardId = make([]byte, MaxShardIdSize+1) },
+		"stack.max_uncles_per_anchor": func(tx dto.Transaction) { tx.Anchor().ShardUncles = make([][64]byte, MaxUnclesPerAnchor+1) },
+	} {
+		tx := TestSignedTransaction("test payload")
+		update(tx)
+		if err := stack.validateTx(tx); err == nil {
+			t.Errorf("transaction exceeding %s did not fail validation", limit)
+		} else if lerr, ok := err.(*LimitError); !ok || lerr.Limit != limit {
+			t.Errorf("incorrect error for %s: %s", limit, err)
+		}
+	}
+}
+
+// network transactions exceeding limits should be rejected before endorsement, e.g. during sync
+func TestHandleTransaction_Limits(t *testing.T) {
+	stack, _, endorser, _ := initMocks()
+	stack.conf.SendNacks = true
+	peer := NewMockPeer(p2p.TestConn())
+	tx := TestSignedTransaction("test payload")
+	tx.Request().Payload = make([]byte, MaxPayloadSize+1)
+	if err := stack.handleTransaction(peer, make(chan controllerEvent, 10), tx, true); err == nil {
+		t.Errorf("oversized transaction should be rejected")
+	}
+	if endorser.TxHandlerCalled {
+		t.Errorf("oversized transaction should not be endorsed")
+	}
+	if !peer.SendCalled || peer.SendMsgCode != TxRejectMsgCode {
+		t.Errorf("oversized transaction was not rejected to peer")
+	} else if msg := peer.SendMsg.(*TxRejectMsg); msg.Reason != REJECT_LIMIT {
+		t.Errorf("incorrect rejection reason: %d", msg.Reason)
+	}
+}
+
+// submission with oversized shard id fails with limit error
+func TestSubmit_ShardIdLimit(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	stack.policies.MaxShardIdSize = 4
+	req := dto.TestRequest()
+	if _, err := stack.Submit(req); err == nil {
+		t.Errorf("oversized shard id should fail")
+	} else if lerr, ok := err.(*LimitError); !ok || lerr.Limit != "stack.max_shard_id_size" {
+		t.Errorf("incorrect error: %s", err)
+	} else if dto.ErrorCodeOf(err) != dto.ErrLimitExceeded {
+		t.Errorf("incorrect error code: %s", dto.ErrorCodeOf(err))
+	}
+}
+
+// node's own anchors should merge no more uncles than its peers accept
+func TestPolicies_AnchorUncles(t *testing.T) {
+	for _, c := range []struct{ merged, accepted, expected int }{
+		{0, 0, 0}, {0, 10, 10}, {5, 10, 5}, {20, 10, 10}, {20, 0, 20},
+	} {
+		p := &Policies{MaxAnchorUncles: c.merged, MaxUnclesPerAnchor: c.accepted}
+		if uncles := p.anchorUncles(); uncles != c.expected {
+			t.Errorf("incorrect uncles for %d / %d: %d", c.merged, c.accepted, uncles)
+		}
+	}
+}
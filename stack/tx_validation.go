@@ -0,0 +1,171 @@
+// Copyright 2019 The trust-net Authors
+// Stateless validation of network transactions (signatures, anchor sanity) on a pool of parallel workers,
+// ahead of their serialized application to shard DAG and world state
+package stack
+
+import (
+	"errors"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"runtime"
+	"sync"
+)
+
+// number of workers validating network transactions in parallel across all peers, 0 to validate
+// in peer's listener
+var TxValidationWorkers = runtime.NumCPU()
+
+// max number of a peer's network transactions pending validation, before peer's listener stops
+// reading further messages from peer
+var TxValidationWindow = 256
+
+// pool bounding the number of concurrently running validations
+type validationPool struct {
+	slots chan struct{}
+}
+
+func newValidationPool(workers int) *validationPool {
+	if workers <= 0 {
+		return &validationPool{}
+	}
+	return &validationPool{
+		slots: make(chan struct{}, workers),
+	}
+}
+
+// run a job on the pool, blocks while all workers are busy, job runs in caller's context
+// when pool has no workers
+func (p *validationPool) run(job func()) {
+	if p == nil || p.slots == nil {
+		job()
+		return
+	}
+	p.slots <- struct{}{}
+	go func() {
+		defer func() { <-p.slots }()
+		job()
+	}()
+}
+
+// stateless validation of a network transaction, safe to run without stack's lock
+func (d *dlt) validateTx(tx dto.Transaction) error {
+	anchor := tx.Anchor()
+	switch {
+	case len(tx.Request().ShardId) == 0:
+		return errors.New("Transaction has no shard id")
+	case len(anchor.NodeId) == 0:
+		return errors.New("Anchor has no node id")
+	case anchor.ShardSeq < 1:
+		return errors.New("Anchor has invalid shard sequence")
+	}
+	// check sizes before any further work on transaction
+	if err := d.checkLimits(tx); err != nil {
+		return err
+	}
+	uncles := make(map[[64]byte]bool)
+	for _, uncle := range anchor.ShardUncles {
+		if uncle == anchor.ShardParent || uncles[uncle] {
+			return errors.New("Anchor has duplicate uncle")
+		}
+		uncles[uncle] = true
+	}
+	return d.validateSignatures(tx)
+}
+
+// a network transaction pending validation
+type txValidation struct {
+	tx   dto.Transaction
+	done chan error
+}
+
+// pipeline of a peer's network transactions, validated in parallel and emitted for processing
+// in the order they were received from the peer
+type txPipeline struct {
+	d       *dlt
+	peer    p2p.Peer
+	events  chan controllerEvent
+	pending chan *txValidation
+	wg      sync.WaitGroup
+	// first validation failure, after which peer's transactions are dropped
+	err  error
+	lock sync.Mutex
+}
+
+func (d *dlt) newTxPipeline(peer p2p.Peer, events chan controllerEvent) *txPipeline {
+	window := TxValidationWindow
+	if window < 1 {
+		window = 1
+	}
+	p := &txPipeline{
+		d:       d,
+		peer:    peer,
+		events:  events,
+		pending: make(chan *txValidation, window),
+	}
+	go p.emitter()
+	return p
+}
+
+// submit a transaction for validation, returns error if an earlier transaction failed validation
+func (p *txPipeline) submit(tx dto.Transaction) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	v := &txValidation{
+		tx:   tx,
+		done: make(chan error, 1),
+	}
+	p.wg.Add(1)
+	p.d.validators.run(p.d.guarded(func() {
+		v.done <- p.d.validateTx(tx)
+	}))
+	p.pending <- v
+	return nil
+}
+
+// wait for all submitted transactions to be validated and emitted
+func (p *txPipeline) flush() error {
+	p.wg.Wait()
+	return p.failed()
+}
+
+// flush and stop the pipeline
+func (p *txPipeline) close() error {
+	err := p.flush()
+	close(p.pending)
+	return err
+}
+
+func (p *txPipeline) failed() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.err
+}
+
+// emit validated transactions in order of submission, under stack's lock
+func (p *txPipeline) emitter() {
+	defer p.d.recoverCrash()
+	for v := range p.pending {
+		err := <-v.done
+		p.d.lock.Lock()
+		if p.failed() != nil {
+			// drop transactions after a failure, peer is disconnected
+		} else if err != nil {
+			p.peer.Logger().Debug("Network transaction failed validation: %s", err)
+			reason := REJECT_BAD_SIGNATURE
+			if _, ok := err.(*LimitError); ok {
+				reason = REJECT_LIMIT
+			}
+			p.d.nack(p.peer, v.tx, reason, err)
+			p.lock.Lock()
+			p.err = err
+			p.lock.Unlock()
+			p.d.p2p.Disconnect(p.peer)
+		} else if !p.d.isSeen(v.tx.Id()) {
+			// emit a RECV_NewTxBlockMsg event
+			p.events <- newControllerEvent(RECV_NewTxBlockMsg, v.tx)
+		}
+		p.d.lock.Unlock()
+		p.wg.Done()
+	}
+}
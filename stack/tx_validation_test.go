@@ -0,0 +1,70 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"testing"
+	"time"
+)
+
+// transactions with insane anchors should fail validation before signatures are checked
+func TestValidateTx_AnchorSanity(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	if err := stack.validateTx(TestSignedTransaction("test payload")); err != nil {
+		t.Errorf("valid transaction failed validation: %s", err)
+	}
+	for name, update := range map[string]func(a *dto.Anchor){
+		"no node id":       func(a *dto.Anchor) { a.NodeId = nil },
+		"zero shard seq":   func(a *dto.Anchor) { a.ShardSeq = 0 },
+		"parent as uncle":  func(a *dto.Anchor) { a.ShardUncles = [][64]byte{a.ShardParent} },
+		"duplicate uncles": func(a *dto.Anchor) { uncle := dto.RandomHash(); a.ShardUncles = [][64]byte{uncle, uncle} },
+	} {
+		tx := TestSignedTransaction("test payload")
+		update(tx.Anchor())
+		if err := stack.validateTx(tx); err == nil {
+			t.Errorf("transaction with %s did not fail validation", name)
+		}
+	}
+}
+
+// listener should emit transactions validated in parallel in the order they were received, and drop
+// transactions after one fails validation
+func TestPeerListener_ParallelValidation(t *testing.T) {
+	for _, workers := range []int{0, 4} {
+		stack, _, _, _ := initMocks()
+		stack.validators = newValidationPool(workers)
+		mockConn := p2p.TestConn()
+		peer := NewMockPeer(mockConn)
+		txs := make([]dto.Transaction, 20)
+		for i := range txs {
+			txs[i] = TestSignedTransaction("test payload")
+			mockConn.NextMsg(TransactionMsgCode, txs[i])
+		}
+		bad := TestSignedTransaction("bad payload")
+		bad.Anchor().ShardSeq = 0
+		mockConn.NextMsg(TransactionMsgCode, bad)
+		mockConn.NextMsg(TransactionMsgCode, TestSignedTransaction("dropped payload"))
+		mockConn.NextMsg(NodeShutdownMsgCode, &NodeShutdown{})
+
+		events := make(chan controllerEvent, 100)
+		if err := stack.listener(peer, events); err == nil {
+			t.Errorf("listener did not fail on invalid transaction with %d workers", workers)
+		}
+		for i := range txs {
+			select {
+			case e := <-events:
+				if e.code != RECV_NewTxBlockMsg || e.data.(dto.Transaction).Id() != txs[i].Id() {
+					t.Fatalf("incorrect event %d with %d workers: %d", i, workers, e.code)
+				}
+			case <-time.After(100 * time.Millisecond):
+				t.Fatalf("missing event %d with %d workers", i, workers)
+			}
+		}
+		select {
+		case e := <-events:
+			t.Errorf("unexpected event after invalid transaction with %d workers: %d", workers, e.code)
+		default:
+		}
+	}
+}
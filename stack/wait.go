@@ -0,0 +1,83 @@
+// Copyright 2019 The trust-net Authors
+// Waiting for a transaction to be applied or confirmed on local node
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// interval at which a waiting caller re-checks the transaction
+var WaitPollInterval = 100 * time.Millisecond
+
+// error returned when a transaction did not meet wait criteria within timeout
+var ErrWaitTimeout = errors.New("timed out waiting for transaction")
+
+// criteria for a transaction to be considered done by WaitFor
+type WaitCriteria struct {
+	// number of shard DAG levels that must be built on top of the transaction,
+	// 0 to wait only until transaction is applied locally
+	Confirmations uint64
+}
+
+// result of a completed wait
+type WaitResult struct {
+	// depth of the transaction in shard DAG
+	Depth uint64
+	// number of shard DAG levels built on top of the transaction
+	Confirmations uint64
+}
+
+// check whether transaction meets wait criteria, returns nil result if not yet
+func (d *dlt) waitCheck(txId [64]byte, criteria WaitCriteria) (*WaitResult, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	tx := d.db.GetTx(txId)
+	if tx == nil {
+		return nil, nil
+	}
+	node := d.db.GetShardDagNode(txId)
+	if node == nil {
+		return nil, nil
+	}
+	shardId := tx.Request().ShardId
+	if app := d.registered(shardId); app != nil {
+		// paused app has not applied the transaction yet
+		if d.paused[string(shardId)] {
+			return nil, nil
+		}
+		for _, letter := range d.sharder.DeadLetters(shardId) {
+			if letter.TxId == txId {
+				return nil, fmt.Errorf("transaction rejected by app: %s", letter.Reason)
+			}
+		}
+	}
+	res := &WaitResult{Depth: node.Depth}
+	for _, tip := range d.db.ShardTips(shardId) {
+		if tipNode := d.db.GetShardDagNode(tip); tipNode != nil && tipNode.Depth > node.Depth+res.Confirmations {
+			res.Confirmations = tipNode.Depth - node.Depth
+		}
+	}
+	if res.Confirmations < criteria.Confirmations {
+		return nil, nil
+	}
+	return res, nil
+}
+
+func (d *dlt) WaitFor(txId [64]byte, criteria WaitCriteria, timeout time.Duration) (*WaitResult, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		if res, err := d.waitCheck(txId, criteria); err != nil || res != nil {
+			return res, err
+		}
+		if !time.Now().Before(deadline) {
+			return nil, ErrWaitTimeout
+		}
+		wait := WaitPollInterval
+		if left := time.Until(deadline); left < wait {
+			wait = left
+		}
+		time.Sleep(wait)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+	"time"
+)
+
+// add a transaction to stack's shard DAG
+func handleTestTx(endorser *mockEndorser, sharder *mockSharder, tx dto.Transaction) {
+	endorser.Handle(tx)
+	sharder.LockState()
+	sharder.Handle(tx)
+	sharder.CommitState(tx)
+	sharder.UnlockState()
+}
+
+// test that wait returns once transaction is applied locally
+func TestWaitFor_Applied(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, sharder, endorser, _ := initMocks()
+	tx, _ := shard.SignedShardTransaction("test payload")
+	// transaction's id is computed lazily, so compute it before it is shared with handler's goroutine
+	id := tx.Id()
+	go func() {
+		time.Sleep(2 * WaitPollInterval)
+		handleTestTx(endorser, sharder, tx)
+	}()
+	if res, err := stack.WaitFor(id, WaitCriteria{}, time.Second); err != nil {
+		t.Errorf("wait failed: %s", err)
+	} else if res.Depth != 1 || res.Confirmations != 0 {
+		t.Errorf("incorrect wait result: %v", res)
+	}
+}
+
+// test that wait times out for unknown transaction
+func TestWaitFor_Timeout(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, _, _, _ := initMocks()
+	start := time.Now()
+	if _, err := stack.WaitFor(dto.RandomHash(), WaitCriteria{}, 50*time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("expected timeout, got: %s", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("wait did not honor timeout")
+	}
+}
+
+// test that wait for confirmations returns only after enough levels are built on top of transaction
+func TestWaitFor_Confirmations(t *testing.T) {
+	log.SetLogLevel(log.NONE)
+	stack, sharder, endorser, _ := initMocks()
+	tx, _ := shard.SignedShardTransaction("test payload")
+	handleTestTx(endorser, sharder, tx)
+	if _, err := stack.WaitFor(tx.Id(), WaitCriteria{Confirmations: 1}, 10*time.Millisecond); err != ErrWaitTimeout {
+		t.Errorf("expected timeout for unconfirmed transaction, got: %s", err)
+	}
+	child := dto.TestSignedTransaction("child payload")
+	child.Anchor().ShardParent = tx.Id()
+	child.Anchor().ShardSeq = 2
+	handleTestTx(endorser, sharder, child)
+	if res, err := stack.WaitFor(tx.Id(), WaitCriteria{Confirmations: 1}, time.Second); err != nil {
+		t.Errorf("wait failed: %s", err)
+	} else if res.Confirmations != 1 {
+		t.Errorf("incorrect confirmations: %d", res.Confirmations)
+	}
+}
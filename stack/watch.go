@@ -0,0 +1,108 @@
+// Copyright 2019 The trust-net Authors
+// Watch-only shard subscriptions, for consumers of shards the node is not registered to as an app
+package stack
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"sync"
+)
+
+// a watcher of a shard, delivering transactions to its handler in order of acceptance
+type watcher struct {
+	shardId []byte
+	handler func(tx dto.Transaction)
+	queue   []dto.Transaction
+	closed  bool
+	cond    *sync.Cond
+}
+
+func (w *watcher) push(tx dto.Transaction) {
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+	w.queue = append(w.queue, tx)
+	w.cond.Signal()
+}
+
+func (w *watcher) close() {
+	w.cond.L.Lock()
+	defer w.cond.L.Unlock()
+	w.closed = true
+	w.cond.Signal()
+}
+
+// deliver queued transactions until watcher is closed, so that a slow watcher does not hold up the stack
+func (w *watcher) run() {
+	for {
+		w.cond.L.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		if w.closed {
+			w.cond.L.Unlock()
+			return
+		}
+		tx := w.queue[0]
+		w.queue = w.queue[1:]
+		w.cond.L.Unlock()
+		w.handler(tx)
+	}
+}
+
+// registry of shard watchers
+type watches struct {
+	watchers map[uint64]*watcher
+	nextId   uint64
+	lock     sync.RWMutex
+}
+
+func newWatches() *watches {
+	return &watches{
+		watchers: make(map[uint64]*watcher),
+	}
+}
+
+func (w *watches) add(shardId []byte, handler func(tx dto.Transaction)) uint64 {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.nextId += 1
+	watcher := &watcher{
+		shardId: append([]byte{}, shardId...),
+		handler: handler,
+		cond:    sync.NewCond(&sync.Mutex{}),
+	}
+	w.watchers[w.nextId] = watcher
+	go watcher.run()
+	return w.nextId
+}
+
+func (w *watches) remove(id uint64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if watcher, found := w.watchers[id]; found {
+		watcher.close()
+		delete(w.watchers, id)
+	}
+}
+
+// deliver an accepted transaction to watchers of its shard
+func (w *watches) deliver(tx dto.Transaction) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	for _, watcher := range w.watchers {
+		if string(watcher.shardId) == string(tx.Request().ShardId) {
+			watcher.push(tx)
+		}
+	}
+}
+
+func (d *dlt) Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error) {
+	if len(shardId) == 0 || handler == nil {
+		return 0, fmt.Errorf("missing shard id or handler")
+	}
+	return d.watches.add(shardId, handler), nil
+}
+
+func (d *dlt) Unwatch(id uint64) {
+	d.watches.remove(id)
+}
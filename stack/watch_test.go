@@ -0,0 +1,98 @@
+// Copyright 2019 The trust-net Authors
+package stack
+
+import (
+	"github.com/trust-net/dag-lib-go/stack/dto"
+	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/shard"
+	"testing"
+	"time"
+)
+
+func waitForTx(watched chan dto.Transaction) dto.Transaction {
+	select {
+	case tx := <-watched:
+		return tx
+	case <-time.After(time.Second):
+		return nil
+	}
+}
+
+// test that watchers receive accepted network transactions of a shard without app registration
+func TestWatch(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	watched := make(chan dto.Transaction, 10)
+	id, err := stack.Watch([]byte("watched shard"), func(tx dto.Transaction) { watched <- tx })
+	if err != nil {
+		t.Fatalf("failed to watch: %s", err)
+	}
+
+	// send a network transaction for watched shard
+	submitter := dto.TestSubmitter()
+	submitter.ShardId = []byte("watched shard")
+	tx := submitter.NewTransaction(dto.TestAnchor(), "test payload")
+	tx.Anchor().ShardParent = shard.GenesisShardTx(submitter.ShardId).Id()
+	if err := stack.handleTransaction(NewMockPeer(p2p.TestConn()), make(chan controllerEvent, 10), tx, false); err != nil {
+		t.Fatalf("failed to handle transaction: %s", err)
+	}
+	if got := waitForTx(watched); got == nil || got.Id() != tx.Id() {
+		t.Errorf("watcher did not receive transaction")
+	}
+	// transaction should be in local shard DAG, even though shard is not registered
+	if stack.db.GetShardDagNode(tx.Id()) == nil {
+		t.Errorf("watched transaction not added to shard DAG")
+	}
+
+	// transactions of other shards should not be delivered
+	stack.Submit(dto.TestSubmitter().NewRequest("test payload"))
+	if got := waitForTx(watched); got != nil {
+		t.Errorf("watcher received transaction of another shard")
+	}
+
+	// cancelled watch should not receive any more transactions
+	stack.Unwatch(id)
+	submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+	next := submitter.NewTransaction(dto.TestAnchor(), "next payload")
+	next.Anchor().ShardParent, next.Anchor().ShardSeq = tx.Id(), 2
+	stack.handleTransaction(NewMockPeer(p2p.TestConn()), make(chan controllerEvent, 10), next, false)
+	if got := waitForTx(watched); got != nil {
+		t.Errorf("cancelled watcher received transaction")
+	}
+}
+
+// test that watched transactions are delivered in order of acceptance
+func TestWatch_Order(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	watched := make(chan dto.Transaction, 10)
+	stack.Watch(stack.app.ShardId, func(tx dto.Transaction) {
+		// slow watcher should not lose order
+		time.Sleep(10 * time.Millisecond)
+		watched <- tx
+	})
+	submitter := dto.TestSubmitter()
+	txs := []dto.Transaction{}
+	for i := 0; i < 3; i++ {
+		tx, err := stack.Submit(submitter.NewRequest("test payload"))
+		if err != nil {
+			t.Fatalf("submission failed: %s", err)
+		}
+		submitter.LastTx, submitter.Seq = tx.Id(), submitter.Seq+1
+		txs = append(txs, tx)
+	}
+	for i, tx := range txs {
+		if got := waitForTx(watched); got == nil || got.Id() != tx.Id() {
+			t.Errorf("incorrect delivery of transaction %d", i)
+		}
+	}
+}
+
+// test that watch requires a shard and handler
+func TestWatch_Invalid(t *testing.T) {
+	stack, _, _, _ := initMocks()
+	if _, err := stack.Watch(nil, func(tx dto.Transaction) {}); err == nil {
+		t.Errorf("watch without shard should fail")
+	}
+	if _, err := stack.Watch([]byte("watched shard"), nil); err == nil {
+		t.Errorf("watch without handler should fail")
+	}
+}
@@ -3,10 +3,10 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/trust-net/dag-lib-go/cli"
 	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/stack"
@@ -15,19 +15,10 @@ import (
 	"github.com/trust-net/dag-lib-go/stack/state"
 	"os"
 	"strconv"
-	"strings"
 )
 
-var commands = map[string][2]string{
-	"countr": {"usage: countr <countr name> ...", "view a counter value"},
-	"incr":   {"usage: incr <countr name> [<integer>] ...", "increment one or more counters"},
-	"decr":   {"usage: decr <countr name> [<integer>] ...", "decrement one or more counters"},
-	"info":   {"usage: info", "get current shard tip"},
-	"join":   {"usage: join <shard id> [<name>]", "join a shard (a unique string)"},
-	"leave":  {"usage: leave", "leave from a registered shard (run as headless, default behavior)"},
-}
-
-var cmdPrompt = "<headless>: "
+// interactive shell of the CLI
+var shell = cli.NewShell("<headless>: ")
 
 var shardId []byte
 
@@ -64,7 +55,7 @@ type op struct {
 	delta int
 }
 
-func scanOps(scanner *bufio.Scanner) (ops []op) {
+func scanOps(scanner *cli.Args) (ops []op) {
 	nextToken := func() (*string, int, bool) {
 		if !scanner.Scan() {
 			return nil, 0, false
@@ -127,7 +118,7 @@ func txHandler(tx dto.Transaction, state state.State) error {
 	fmt.Printf("\n")
 	op := testTx{}
 	if err := common.Deserialize(tx.Request().Payload, &op); err != nil {
-		fmt.Printf("Invalid TX from %x\n%s", tx.Anchor().NodeId, cmdPrompt)
+		fmt.Printf("Invalid TX from %x\n%s", tx.Anchor().NodeId, shell.Prompt())
 		return err
 	}
 	fmt.Printf("TX: %s %s %d\n", op.Op, op.Target, op.Delta)
@@ -138,150 +129,157 @@ func txHandler(tx dto.Transaction, state state.State) error {
 	case "decr":
 		delta = int(-op.Delta)
 	}
-	fmt.Printf("%s --> %d\n%s", op.Target, applyDelta(op.Target, delta, state), cmdPrompt)
+	fmt.Printf("%s --> %d\n%s", op.Target, applyDelta(op.Target, delta, state), shell.Prompt())
 	return nil
 }
 
-// main CLI loop
-func cli(dlt stack.DLT) error {
-	if err := dlt.Start(); err != nil {
-		return err
-	}
-	for {
-		fmt.Printf(cmdPrompt)
-		lineScanner := bufio.NewScanner(os.Stdin)
-		for lineScanner.Scan() {
-			line := lineScanner.Text()
-			if len(line) != 0 {
-				wordScanner := bufio.NewScanner(strings.NewReader(line))
-				wordScanner.Split(bufio.ScanWords)
-				for wordScanner.Scan() {
-					cmd := wordScanner.Text()
-					switch cmd {
-					case "quit":
-						fallthrough
-					case "q":
-						dlt.Stop()
-						return nil
-					case "countr":
-						hasNext := wordScanner.Scan()
-						oneDone := false
-						for hasNext {
-							name := wordScanner.Text()
-							if len(name) != 0 {
-								if oneDone {
-									fmt.Printf("\n")
-								} else {
-									oneDone = true
-								}
-								// get current network counter value from world state
-								if r, err := dlt.GetState([]byte(name)); err == nil {
-									var last int64
-									common.Deserialize(r.Value, &last)
-									fmt.Printf("% 10s: %d", name, last)
-								} else {
-									fmt.Printf("% 10s: %s", name, err)
-								}
-							}
-							hasNext = wordScanner.Scan()
-						}
-						if !oneDone {
-							fmt.Printf("%s\n", commands["countr"][1])
-							fmt.Printf("%s\n", commands["countr"][0])
-						}
-					case "incr":
-						ops := scanOps(wordScanner)
-						if len(ops) == 0 {
-							fmt.Printf("%s\n", commands[cmd][1])
-							fmt.Printf("%s\n", commands[cmd][0])
-						} else {
-							for _, op := range ops {
-								fmt.Printf("adding transaction: incr %s %d\n", op.name, op.delta)
-								if tx, err := dlt.Submit(incrementTx(op.name, op.delta)); err != nil {
-									fmt.Printf("Error submitting transaction: %s\n", err)
-								} else {
-									submitter.Seq += 1
-									submitter.LastTx = tx.Id()
-								}
-							}
-						}
-					case "decr":
-						ops := scanOps(wordScanner)
-						if len(ops) == 0 {
-							fmt.Printf("%s\n", commands[cmd][1])
-							fmt.Printf("%s\n", commands[cmd][0])
-						} else {
-							for _, op := range ops {
-								fmt.Printf("adding transaction: decr %s %d\n", op.name, op.delta)
-								if tx, err := dlt.Submit(decrementTx(op.name, op.delta)); err != nil {
-									fmt.Printf("Error submitting transaction: %s\n", err)
-								} else {
-									submitter.Seq += 1
-									submitter.LastTx = tx.Id()
-								}
-							}
-						}
-					case "info":
-						for wordScanner.Scan() {
-							continue
-						}
-						if a := dlt.Anchor(submitter.Id, submitter.Seq, submitter.LastTx); a == nil {
-							fmt.Printf("failed to get any info...\n")
-						} else {
-							fmt.Printf("Next Seq: %d\n", a.ShardSeq)
-							fmt.Printf("Parent: %x\n", a.ShardParent)
-							fmt.Printf("NodeId: %x\n", a.NodeId)
-						}
-					case "join":
-						if !wordScanner.Scan() {
-							fmt.Printf("%s\n", commands[cmd][1])
-							fmt.Printf("%s\n", commands[cmd][0])
-							break
-						}
-						name := wordScanner.Text()
-						shardId = []byte(name)
-						if wordScanner.Scan() {
-							name = wordScanner.Text()
-						}
-						if err := dlt.Register([]byte(shardId), name, txHandler); err != nil {
-							fmt.Printf("Error registering app: %s\n", err)
-						} else {
-							cmdPrompt = "<" + name + ">: "
-							submitter.ShardId = shardId
-						}
-					case "leave":
-						for wordScanner.Scan() {
-							continue
-						}
-						if err := dlt.Unregister(); err != nil {
-							fmt.Printf("Error during un-registering app: %s\n", err)
-						}
-						cmdPrompt = "<headless>: "
-						submitter.ShardId = nil
-					default:
-						fmt.Printf("Unknown Command: %s", cmd)
-						for wordScanner.Scan() {
-							fmt.Printf(" %s", wordScanner.Text())
-						}
-						fmt.Printf("\n\nAccepted commands...\n")
-						isFirst := true
-						for k, _ := range commands {
-							if !isFirst {
-								fmt.Printf(", ")
-							} else {
-								isFirst = false
-							}
-							fmt.Printf("\"%s\"", k)
-						}
+// register CLI commands with the shell
+func registerCommands(dlt stack.DLT) {
+	shell.Register(cli.Command{
+		Name:        "quit",
+		Aliases:     []string{"q"},
+		Usage:       "usage: quit",
+		Description: "leave application and shutdown",
+		Run: func(args *cli.Args) error {
+			dlt.Stop()
+			return cli.ErrQuit
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "countr",
+		Usage:       "usage: countr <countr name> ...",
+		Description: "view a counter value",
+		Run: func(args *cli.Args) error {
+			hasNext := args.Scan()
+			oneDone := false
+			for hasNext {
+				name := args.Text()
+				if len(name) != 0 {
+					if oneDone {
 						fmt.Printf("\n")
-						break
+					} else {
+						oneDone = true
+					}
+					// get current network counter value from world state
+					if r, err := dlt.GetState([]byte(name)); err == nil {
+						var last int64
+						common.Deserialize(r.Value, &last)
+						fmt.Printf("% 10s: %d", name, last)
+					} else {
+						fmt.Printf("% 10s: %s", name, err)
 					}
 				}
+				hasNext = args.Scan()
 			}
-			fmt.Printf("\n%s", cmdPrompt)
-		}
+			if !oneDone {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "incr",
+		Usage:       "usage: incr <countr name> [<integer>] ...",
+		Description: "increment one or more counters",
+		Run: func(args *cli.Args) error {
+			ops := scanOps(args)
+			if len(ops) == 0 {
+				return cli.ErrUsage
+			}
+			for _, op := range ops {
+				fmt.Printf("adding transaction: incr %s %d\n", op.name, op.delta)
+				if tx, err := dlt.Submit(incrementTx(op.name, op.delta)); err != nil {
+					fmt.Printf("Error submitting transaction: %s\n", err)
+				} else {
+					submitter.Seq += 1
+					submitter.LastTx = tx.Id()
+				}
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "decr",
+		Usage:       "usage: decr <countr name> [<integer>] ...",
+		Description: "decrement one or more counters",
+		Run: func(args *cli.Args) error {
+			ops := scanOps(args)
+			if len(ops) == 0 {
+				return cli.ErrUsage
+			}
+			for _, op := range ops {
+				fmt.Printf("adding transaction: decr %s %d\n", op.name, op.delta)
+				if tx, err := dlt.Submit(decrementTx(op.name, op.delta)); err != nil {
+					fmt.Printf("Error submitting transaction: %s\n", err)
+				} else {
+					submitter.Seq += 1
+					submitter.LastTx = tx.Id()
+				}
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "info",
+		Usage:       "usage: info",
+		Description: "get current shard tip",
+		Run: func(args *cli.Args) error {
+			args.Rest()
+			if a := dlt.Anchor(submitter.Id, submitter.Seq, submitter.LastTx); a == nil {
+				fmt.Printf("failed to get any info...\n")
+			} else {
+				fmt.Printf("Next Seq: %d\n", a.ShardSeq)
+				fmt.Printf("Parent: %x\n", a.ShardParent)
+				fmt.Printf("NodeId: %x\n", a.NodeId)
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "join",
+		Usage:       "usage: join <shard id> [<name>]",
+		Description: "join a shard (a unique string)",
+		Run: func(args *cli.Args) error {
+			if !args.Scan() {
+				return cli.ErrUsage
+			}
+			name := args.Text()
+			shardId = []byte(name)
+			if args.Scan() {
+				name = args.Text()
+			}
+			if err := dlt.Register([]byte(shardId), name, txHandler); err != nil {
+				fmt.Printf("Error registering app: %s\n", err)
+			} else {
+				shell.SetPrompt("<" + name + ">: ")
+				submitter.ShardId = shardId
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "leave",
+		Usage:       "usage: leave",
+		Description: "leave from a registered shard (run as headless, default behavior)",
+		Run: func(args *cli.Args) error {
+			args.Rest()
+			if err := dlt.Unregister(); err != nil {
+				fmt.Printf("Error during un-registering app: %s\n", err)
+			}
+			shell.SetPrompt("<headless>: ")
+			submitter.ShardId = nil
+			return nil
+		},
+	})
+}
+
+// main CLI loop
+func runCli(dlt stack.DLT) error {
+	if err := dlt.Start(); err != nil {
+		return err
 	}
-	return nil
+	registerCommands(dlt)
+	return shell.Run()
 }
 
 func main() {
@@ -316,9 +314,9 @@ func main() {
 	submitter = dto.TestSubmitter()
 
 	// instantiate the DLT stack
-	if dlt, err := stack.NewDltStack(config, db.NewInMemDbProvider()); err != nil {
+	if dlt, err := stack.NewDltStack(stack.WithConfig(config), stack.WithStorage(db.NewInMemDbProvider())); err != nil {
 		fmt.Printf("Failed to create DLT stack: %s", err)
-	} else if err = cli(dlt); err != nil {
+	} else if err = runCli(dlt); err != nil {
 		fmt.Printf("Error in CLI: %s", err)
 	} else {
 		fmt.Printf("Shutdown cleanly")
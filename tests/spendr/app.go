@@ -3,47 +3,46 @@
 package main
 
 import (
-	"bufio"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/cli"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/trust-net/dag-lib-go/common"
+	"github.com/trust-net/dag-lib-go/db"
 	"github.com/trust-net/dag-lib-go/dbp"
+	"github.com/trust-net/dag-lib-go/loadgen"
+	"github.com/trust-net/dag-lib-go/scenario"
 	"github.com/trust-net/dag-lib-go/stack"
 	"github.com/trust-net/dag-lib-go/stack/dto"
 	"github.com/trust-net/dag-lib-go/stack/p2p"
+	"github.com/trust-net/dag-lib-go/stack/repo"
 	"github.com/trust-net/dag-lib-go/stack/state"
 	"math/rand"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
-var commands = map[string][2]string{
-	"show":        {"usage: show <resource name> ...", "show one or more resource's value"},
-	"create":      {"usage: create <resource name> [<initial value>] ...", "create one or more resource with optional initial credits"},
-	"bulk_create": {"usage: bulk_create <resource prefix> <number of counters> ...", "load network by creating bulk of resources with random initial values (0-100)"},
-	"xfer":        {"usage: xfer <owned resource name> <xfer value> <recipient resource name>...", "transfer credits from one resource to another"},
-	"bulk_xfer":   {"usage: bulk_xfer <source resource> <destination resource> <xfer value>", "load network by creating bulk transfer of credits from one resource to another"},
-	"info":        {"usage: info", "get current shard tips from local and remote nodes"},
-	//	"xover":  {"usage: xover <owned resource name> <xfer value> <recipient resource name>", "submit a transaction that has anchor from one node, but is submitted to another node"},
-	"quit": {"usage: quit", "leave application and shutdown"},
-	//	"dupe":   {"usage: dupe <owned resource name> <xfer value> <recipient 1> <recipient 2>", "submit two double spending transactions using same tip"},
-	"double": {"usage: double <owned counter name> <xfer value> <recipient 1 counter> <recipient 2 countr>", "submit two double spending transactions on local node"},
-	"multi":  {"usage: multi <owned resource name> <xfer value> <recipient resource name>", "submit a redundant transactions on two different nodes"},
-	"split":  {"usage: split <owned resource name> <xfer value> <recipient 1> <recipient 2>", "submit two double spending transactions on two different nodes"},
-	"sign":   {"usage: sign <base64 encoded payload>", "submit a payload to sign using CLI's submitter keys"},
-}
-
 var (
 	AppName   = "test-driver-for-double-spending"
 	AppShard  = []byte(AppName)
-	cmdPrompt = "SPENDR: "
 )
 
+// interactive shell of the CLI
+var shell = cli.NewShell("SPENDR: ")
+
 var submitter *dto.Submitter
 
+// persisted state of CLI's submitter, so that restarted CLI continues its sequence
+var submitters *dbp.SubmitterStore
+
+var localDb repo.DltDb
+
 // Transaction Ops
 type Ops struct {
 	// op code
@@ -76,7 +75,7 @@ type ArgsXferValue struct {
 	Value int64
 }
 
-func scanCreateArgs(scanner *bufio.Scanner) (args []ArgsCreate) {
+func scanCreateArgs(scanner *cli.Args) (args []ArgsCreate) {
 	nextToken := func() (*string, int, bool) {
 		if !scanner.Scan() {
 			return nil, 0, false
@@ -157,26 +156,26 @@ func handleOpCodeXferValue(tx dto.Transaction, ws state.State, op Ops) error {
 	// first deduct from source and update world state
 	if from, err = ws.Get([]byte(arg.Source)); err != nil {
 		fmt.Printf("ERROR: attempt to xfer value from a non existing resource: %s\nSubmitter: %x\n", arg.Source, tx.Request().SubmitterId)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Resource does not exists")
 	}
 	// validate: source resource must be owned by submitter
 	if string(tx.Request().SubmitterId) != string(from.Owner) {
 		fmt.Printf("ERROR: attempt to xfer value from unauthorized resource: %s\nOwner: %x\nSubmitter: %x\n", arg.Source, from.Owner, tx.Request().SubmitterId)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Resource not owned")
 	}
 	// validate: xfer value should not be more than source resource's value
 	fromValue := int64(common.BytesToUint64(from.Value))
 	if fromValue < arg.Value {
 		fmt.Printf("ERROR: attempt to xfer excess value: %d\nResource value: %d\nSubmitter: %x\n", arg.Value, fromValue, tx.Request().SubmitterId)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Resource insufficient")
 	}
 	// validate: xfer value cannot be less than 1 (i.e. cannot make negative transaction from other people's resource)
 	if arg.Value < 1 {
 		fmt.Printf("ERROR: attempt to make deduction from other people: %d\nSubmitter: %x\n", arg.Value, tx.Request().SubmitterId)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Negative transaction")
 	}
 	// deduct from source
@@ -184,13 +183,13 @@ func handleOpCodeXferValue(tx dto.Transaction, ws state.State, op Ops) error {
 	// update world state
 	if err := ws.Put(from); err != nil {
 		fmt.Printf("Error in updating '%s' with world state: %s\n", from.Key, err)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return err
 	}
 	// now fetch destination
 	if to, err = ws.Get([]byte(arg.Destination)); err != nil {
 		fmt.Printf("ERROR: attempt to xfer value to a non existing resource: %s\nSubmitter: %x\n", arg.Destination, tx.Request().SubmitterId)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Resource does not exists")
 	}
 	// add value to destination resource
@@ -199,7 +198,7 @@ func handleOpCodeXferValue(tx dto.Transaction, ws state.State, op Ops) error {
 	// update world state
 	if err := ws.Put(to); err != nil {
 		fmt.Printf("Error in updating '%s' with world state: %s\n", to.Key, err)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return err
 	}
 	return nil
@@ -207,11 +206,11 @@ func handleOpCodeXferValue(tx dto.Transaction, ws state.State, op Ops) error {
 
 func txHandler(tx dto.Transaction, state state.State) error {
 //	fmt.Printf("\n")
-//	defer fmt.Printf("\n%s", cmdPrompt)
+//	defer fmt.Printf("\n%s", shell.Prompt())
 	op := Ops{}
 	if err := common.Deserialize(tx.Request().Payload, &op); err != nil {
 		fmt.Printf("Invalid TX from %x\n%s", tx.Anchor().NodeId, err)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return err
 	}
 	switch op.Code {
@@ -221,16 +220,27 @@ func txHandler(tx dto.Transaction, state state.State) error {
 		return handleOpCodeXferValue(tx, state, op)
 	default:
 		fmt.Printf("Unknown Op Code: %d\n", op.Code)
-		fmt.Printf("\n%s", cmdPrompt)
+		fmt.Printf("\n%s", shell.Prompt())
 		return fmt.Errorf("Unknown Op Code: %d", op.Code)
 	}
 }
 
 var dlt, remoteDlt, localDlt stack.DLT
 
+// stack process serving client API of a stateless front-end (nil when app runs its own stacks)
+var frontEnd *api.BackendClient
+
+// backend of client API calls, i.e. app's current stack, or stack process of a front-end
+func backend() api.Backend {
+	if frontEnd != nil {
+		return frontEnd
+	}
+	return dlt
+}
+
 func doGetResource(key string) ([]byte, uint64, error) {
 	// get current network counter value from world state
-	if r, err := dlt.GetState([]byte(key)); err == nil {
+	if r, err := backend().GetState([]byte(key)); err == nil {
 		value := common.BytesToUint64(r.Value)
 		return r.Owner, value, nil
 	} else {
@@ -238,6 +248,20 @@ func doGetResource(key string) ([]byte, uint64, error) {
 	}
 }
 
+func doGetResourceAt(key string, seq uint64) ([]byte, uint64, error) {
+	// get network counter value from world state as of shard sequence
+	if r, err := backend().GetStateAtSeq(AppShard, seq, []byte(key)); err == nil {
+		value := common.BytesToUint64(r.Value)
+		return r.Owner, value, nil
+	} else {
+		return nil, 0, err
+	}
+}
+
+func doListByOwner(owner []byte) ([]*state.Resource, error) {
+	return dlt.ListByOwner(owner)
+}
+
 func getResource(dlt stack.DLT, key string) ([]byte, uint64, error) {
 	// get current network counter value from world state
 	if r, err := dlt.GetState([]byte(key)); err == nil {
@@ -248,8 +272,116 @@ func getResource(dlt stack.DLT, key string) ([]byte, uint64, error) {
 	}
 }
 
-func doSubmitTransaction(req *dto.TxRequest) (dto.Transaction, error) {
-	return dlt.Submit(req)
+func doGetAnchor(submitterId []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	return backend().Anchor(submitterId, seq, lastTx)
+}
+
+func doSubmitTransaction(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	return backend().SubmitWithTrace(req, traceId)
+}
+
+// max number of recent stack events retained for client API
+var maxEvents = 1000
+
+var events = struct {
+	list []*stack.Event
+	lock sync.Mutex
+}{}
+
+func recordEvent(e *stack.Event) {
+	events.lock.Lock()
+	defer events.lock.Unlock()
+	if events.list = append(events.list, e); len(events.list) > maxEvents {
+		events.list = events.list[1:]
+	}
+}
+
+func doGetEvents() []*stack.Event {
+	events.lock.Lock()
+	defer events.lock.Unlock()
+	return append([]*stack.Event{}, events.list...)
+}
+
+// shards known to app, i.e. app's own shard and any shards in node's shard registry
+func doGetShards() [][]byte {
+	shards := [][]byte{AppShard}
+	for _, info := range dlt.Shards() {
+		if string(info.ShardId) != string(AppShard) {
+			shards = append(shards, info.ShardId)
+		}
+	}
+	return shards
+}
+
+func doGetShardLog(shardId []byte) ([]dto.Transaction, error) {
+	txs, _, err := dlt.ShardLog(shardId, nil, 0)
+	return txs, err
+}
+
+// submitter's history, from first sequence until first gap
+func doGetSubmitterHistory(submitterId []byte) []*repo.SubmitterHistory {
+	history := []*repo.SubmitterHistory{}
+	for seq := uint64(1); ; seq++ {
+		if h := localDb.GetSubmitterHistory(submitterId, seq); h == nil {
+			return history
+		} else {
+			history = append(history, h)
+		}
+	}
+}
+
+func doGetSyncStatus() []stack.SyncStatus {
+	return dlt.SyncStatus()
+}
+
+func doGetNodeInfo() *stack.NodeInfo {
+	return backend().NodeInfo()
+}
+
+func doGetForensics() []repo.ForensicRecord {
+	return dlt.Forensics()
+}
+
+func doGetSubmitterProof(submitterId []byte) (*stack.SubmitterProof, error) {
+	return dlt.SubmitterProof(submitterId)
+}
+
+// decode spendr's transaction payloads for submitter reports, payloads of other shards are reported raw
+func decodeOp(shardId, payload []byte) *stack.DecodedOp {
+	op := Ops{}
+	if string(shardId) != string(AppShard) || common.Deserialize(payload, &op) != nil {
+		return nil
+	}
+	switch op.Code {
+	case OpCodeCreate:
+		args := ArgsCreate{}
+		if common.Deserialize(op.Args, &args) != nil {
+			return nil
+		}
+		return &stack.DecodedOp{Name: "create", Args: map[string]string{
+			"name":  args.Name,
+			"value": strconv.FormatInt(args.Value, 10),
+		}}
+	case OpCodeXferValue:
+		args := ArgsXferValue{}
+		if common.Deserialize(op.Args, &args) != nil {
+			return nil
+		}
+		return &stack.DecodedOp{Name: "xfer", Args: map[string]string{
+			"source":      args.Source,
+			"destination": args.Destination,
+			"value":       strconv.FormatInt(args.Value, 10),
+		}}
+	}
+	return nil
+}
+
+func doGetSubmitterReport(submitterId []byte) (*stack.SubmitterReport, error) {
+	return dlt.SubmitterReport(submitterId, decodeOp)
+}
+
+func doWaitForTransaction(txId [64]byte, criteria stack.WaitCriteria, timeout time.Duration) (*stack.WaitResult, error) {
+	return backend().WaitFor(txId, criteria, timeout)
 }
 
 func makeXferValuePayload(source, destination string, value int64) []byte {
@@ -279,6 +411,133 @@ func makeResourceCreationPayload(key string, value int64) []byte {
 	return txPayload
 }
 
+// register transaction templates for spendr's operations, so that clients
+// do not need to construct payloads themselves
+func registerTemplates() {
+	templates.Register(AppShard, &api.TxTemplate{
+		Name:        "create",
+		OpCode:      OpCodeCreate,
+		Description: "create a resource with initial value",
+		Args: []api.TemplateArg{
+			{Name: "name", Type: api.ARG_STRING, Required: true},
+			{Name: "value", Type: api.ARG_INT},
+		},
+		Build: func(args map[string]interface{}) ([]byte, error) {
+			value, _ := args["value"].(int64)
+			return makeResourceCreationPayload(args["name"].(string), value), nil
+		},
+	})
+	templates.Register(AppShard, &api.TxTemplate{
+		Name:        "xfer",
+		OpCode:      OpCodeXferValue,
+		Description: "transfer value from owned resource to another resource",
+		Args: []api.TemplateArg{
+			{Name: "source", Type: api.ARG_STRING, Required: true},
+			{Name: "destination", Type: api.ARG_STRING, Required: true},
+			{Name: "value", Type: api.ARG_UINT, Required: true},
+		},
+		Build: func(args map[string]interface{}) ([]byte, error) {
+			if args["source"] == args["destination"] {
+				return nil, fmt.Errorf("source and destination must be different")
+			}
+			return makeXferValuePayload(args["source"].(string), args["destination"].(string), int64(args["value"].(uint64))), nil
+		},
+	})
+}
+
+// load CLI's submitter keys and state from storage, creating a new submitter upon first run
+func loadSubmitter(provider db.DbProvider) (*dto.Submitter, error) {
+	var err error
+	if submitters, err = dbp.NewSubmitterStore(provider); err != nil {
+		return nil, err
+	}
+	keys := provider.DB("spendr_cli")
+	s := dto.TestSubmitter()
+	s.ShardId = AppShard
+	if data, _ := keys.Get([]byte("submitter_key")); data != nil {
+		if key, err := crypto.ToECDSA(data); err != nil {
+			return nil, err
+		} else {
+			s.Key, s.Id = key, crypto.FromECDSAPub(&key.PublicKey)
+		}
+	} else if err := keys.Put([]byte("submitter_key"), crypto.FromECDSA(s.Key)); err != nil {
+		return nil, err
+	}
+	if found, err := submitters.Load(s); err != nil {
+		return nil, err
+	} else if found {
+		fmt.Printf("Restored submitter %x at sequence %d\n", s.Id, s.Seq)
+	}
+	return s, nil
+}
+
+// environment for scenarios, with local and remote nodes and spendr's templates for operations
+func scenarioEnv() *scenario.Env {
+	node := func(dlt stack.DLT) *scenario.Node {
+		return &scenario.Node{
+			Target: loadgen.StackTarget(dlt),
+			Value: func(key string) (interface{}, error) {
+				_, value, err := getResource(dlt, key)
+				return value, err
+			},
+		}
+	}
+	return &scenario.Env{
+		ShardId: AppShard,
+		Nodes:   map[string]*scenario.Node{"local": node(localDlt), "remote": node(remoteDlt)},
+		Build: func(op string, args map[string]interface{}) ([]byte, error) {
+			if tmpl := templates.Get(AppShard, op); tmpl == nil {
+				return nil, fmt.Errorf("unknown op: %s", op)
+			} else {
+				return tmpl.BuildArgs(args)
+			}
+		},
+	}
+}
+
+func scenarioFiles(list string) []string {
+	files := []string{}
+	for _, file := range strings.Split(list, ",") {
+		if file = strings.TrimSpace(file); len(file) > 0 {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// run scenarios from files and print their results, returns true if all scenarios passed
+func runScenarios(files []string) bool {
+	passed := true
+	for _, file := range files {
+		if s, err := scenario.Load(file); err != nil {
+			fmt.Printf("FAIL: %s: %s\n", file, err)
+			passed = false
+		} else {
+			res := s.Run(scenarioEnv())
+			fmt.Printf("%s", res)
+			passed = passed && res.Passed()
+		}
+	}
+	return passed
+}
+
+// run a workload and print its report, saving CLI submitter's state when used by workload
+func runLoad(conf loadgen.Config) {
+	report, err := loadgen.Run(conf)
+	for _, s := range conf.Submitters {
+		if s == submitter {
+			if err := submitters.Save(submitter); err != nil {
+				fmt.Printf("Failed to save submitter state: %s\n", err)
+			}
+		}
+	}
+	if err != nil {
+		fmt.Printf("Load failed: %s\n", err)
+	} else {
+		fmt.Printf("%s", report)
+	}
+}
+
 func submitTx(dlt stack.DLT, req *dto.TxRequest) bool {
 	if tx, err := dlt.Submit(req); err != nil {
 		fmt.Printf("Failed to submit transaction: %s\n", err)
@@ -286,12 +545,398 @@ func submitTx(dlt stack.DLT, req *dto.TxRequest) bool {
 	} else {
 		submitter.LastTx = tx.Id()
 		submitter.Seq += 1
+		if err := submitters.Save(submitter); err != nil {
+			fmt.Printf("Failed to save submitter state: %s\n", err)
+		}
 		return true
 	}
 }
 
+// register CLI commands with the shell
+func registerCommands() {
+	shell.Register(cli.Command{
+		Name:        "quit",
+		Aliases:     []string{"q"},
+		Usage:       "usage: quit",
+		Description: "leave application and shutdown",
+		Run: func(args *cli.Args) error {
+			dlt.Stop()
+			return cli.ErrQuit
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "show",
+		Aliases:     []string{"value", "v"},
+		Usage:       "usage: show <resource name> ...",
+		Description: "show one or more resource's value",
+		Run: func(args *cli.Args) error {
+			hasNext := args.Scan()
+			oneDone := false
+			for hasNext {
+				key := args.Text()
+				if len(key) != 0 {
+					if oneDone {
+						fmt.Printf("\n")
+					} else {
+						oneDone = true
+					}
+					// get current network counter value from world state
+					_, locVal, locErr := getResource(localDlt, key)
+					_, remVal, remErr := getResource(remoteDlt, key)
+					if locErr == nil && remErr == nil {
+						fmt.Printf("[% 10s]: LOCAL: %d | REMOT: %d", key, locVal, remVal)
+					} else if locErr != nil && remErr == nil {
+						fmt.Printf("[% 10s]: LOCAL: %s | REMOT: %d", key, locErr, remVal)
+					} else if locErr == nil && remErr != nil {
+						fmt.Printf("[% 10s]: LOCAL: %d | REMOT: %s", key, locVal, remErr)
+					} else {
+						fmt.Printf("% 10s: LOCAL: %s | REMOT: %s", key, locErr, remErr)
+					}
+				}
+				hasNext = args.Scan()
+			}
+			if !oneDone {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "create",
+		Aliases:     []string{"c"},
+		Usage:       "usage: create <resource name> [<initial value>] ...",
+		Description: "create one or more resource with optional initial credits",
+		Run: func(args *cli.Args) error {
+			creates := scanCreateArgs(args)
+			if len(creates) == 0 {
+				return cli.ErrUsage
+			} else {
+				for _, arg := range creates {
+					fmt.Printf("adding transaction: create %s %d\n", arg.Name, arg.Value)
+					submitTx(dlt, submitter.NewRequest(string(makeResourceCreationPayload(arg.Name, arg.Value))))
+				}
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "bulk_create",
+		Usage:       "usage: bulk_create <resource prefix> <number of counters> ...",
+		Description: "load network by creating bulk of resources with random initial values (0-100)",
+		Run: func(args *cli.Args) error {
+			creates := scanCreateArgs(args)
+			if len(creates) == 0 {
+				return cli.ErrUsage
+			}
+			for _, arg := range creates {
+				fmt.Printf("bulk createing %d tokens with %s prefix\n", arg.Value, arg.Name)
+				prefix := arg.Name
+				// we do not want to alternate between nodes because of high velocity
+				// transactions, a node with per submitter rate limits (stack.Policies'
+				// SubmitterTxRate) would throttle these transactions from a single submitter
+				runLoad(loadgen.Config{
+					Submitters: []*dto.Submitter{submitter},
+					Targets:    []loadgen.Target{loadgen.StackTarget(localDlt)},
+					Mix: []loadgen.Op{{Name: "create", Weight: 1, Payload: func(s int, n uint64) []byte {
+						return makeResourceCreationPayload(fmt.Sprintf("%s-%04d", prefix, n), rand.Int63n(100))
+					}}},
+					Count: int(arg.Value),
+				})
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "info",
+		Usage:       "usage: info",
+		Description: "get current shard tips from local and remote nodes",
+		Run: func(args *cli.Args) error {
+			args.Rest()
+			if a := localDlt.Anchor([]byte("dummy"), 0x01, [64]byte{}); a == nil {
+				fmt.Printf("failed to get any info from local node...\n")
+			} else {
+				fmt.Printf("Submitter Id : %x\n", submitter.Id)
+				fmt.Printf("LOCAL Next Seq: %d\n", a.ShardSeq)
+				fmt.Printf("LOCAL Weight: %d\n", a.Weight)
+				fmt.Printf("LOCAL Parent: %x\n", a.ShardParent)
+			}
+			if a := remoteDlt.Anchor([]byte("dummy"), 0x01, [64]byte{}); a == nil {
+				fmt.Printf("failed to get any info from remote node...\n")
+			} else {
+				fmt.Printf("REMOT Parent: %x\n", a.ShardParent)
+				fmt.Printf("REMOT Next Seq: %d\n", a.ShardSeq)
+				fmt.Printf("REMOT Weight: %d\n", a.Weight)
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "xfer",
+		Usage:       "usage: xfer <owned resource name> <xfer value> <recipient resource name>...",
+		Description: "transfer credits from one resource to another",
+		Run: func(args *cli.Args) error {
+			arg := ArgsXferValue{}
+			if args.Scan() {
+				arg.Source = args.Text()
+			}
+			if args.Scan() {
+				value, _ := strconv.Atoi(args.Text())
+				arg.Value = int64(value)
+			}
+			if args.Scan() {
+				arg.Destination = args.Text()
+			}
+			if len(arg.Source) != 0 && len(arg.Destination) != 0 && arg.Value > 0 {
+				fmt.Printf("adding transaction: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				submitTx(dlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
+			} else {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "bulk_xfer",
+		Usage:       "usage: bulk_xfer <source resource> <destination resource> <xfer value>",
+		Description: "load network by creating bulk transfer of credits from one resource to another",
+		Run: func(args *cli.Args) error {
+			var source, dest string
+			var value int
+			if args.Scan() {
+				source = args.Text()
+			}
+			if args.Scan() {
+				dest = args.Text()
+			}
+			value, _ = args.Int()
+			if len(source) == 0 || len(dest) == 0 || value <= 0 {
+				return cli.ErrUsage
+			}
+			fmt.Printf("creating resource %s with initial value %d, and %s with initial value 0\n", source, value*10, dest)
+			fmt.Printf("adding %d transactions to xfer 1 value from %s to %s\n", value, source, dest)
+			runLoad(loadgen.Config{
+				Submitters: []*dto.Submitter{submitter},
+				Targets:    []loadgen.Target{loadgen.StackTarget(localDlt)},
+				Setup: func(s int) [][]byte {
+					return [][]byte{makeResourceCreationPayload(source, int64(value*10)), makeResourceCreationPayload(dest, 0)}
+				},
+				Mix: []loadgen.Op{{Name: "xfer", Weight: 1, Payload: func(s int, n uint64) []byte {
+					return makeXferValuePayload(source, dest, 1)
+				}}},
+				Count: value,
+			})
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "scenario",
+		Usage:       "usage: scenario <scenario file> ...",
+		Description: "run scripted scenarios of conflicting submissions across local and remote nodes, and assert on converged state",
+		Run: func(args *cli.Args) error {
+			files := args.Rest()
+			if len(files) == 0 {
+				return cli.ErrUsage
+			}
+			runScenarios(files)
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "load",
+		Usage:       "usage: load <seconds> <target TPS> [<number of submitters>] [<xfers per create>]",
+		Description: "drive a mix of create/xfer transactions from new submitters across local and remote nodes, and report latencies and errors",
+		Run: func(args *cli.Args) error {
+			seconds, ok1 := args.Int()
+			tps, ok2 := args.Int()
+			if !ok1 || !ok2 || seconds <= 0 || tps < 0 {
+				return cli.ErrUsage
+			}
+			count, xfers := 1, 3
+			if n, ok := args.Int(); ok && n > 0 {
+				count = n
+				if n, ok := args.Int(); ok && n >= 0 {
+					xfers = n
+				}
+			}
+			// each submitter owns a source resource to transfer values from
+			prefix := fmt.Sprintf("load-%d", time.Now().Unix())
+			mix := []loadgen.Op{{Name: "create", Weight: 1, Payload: func(s int, n uint64) []byte {
+				return makeResourceCreationPayload(fmt.Sprintf("%s-%d-%d", prefix, s, n), rand.Int63n(100))
+			}}}
+			if xfers > 0 {
+				mix = append(mix, loadgen.Op{Name: "xfer", Weight: xfers, Payload: func(s int, n uint64) []byte {
+					return makeXferValuePayload(fmt.Sprintf("%s-%d-src", prefix, s), fmt.Sprintf("%s-%d-dst", prefix, s), 1)
+				}})
+			}
+			fmt.Printf("running load for %d seconds at %d TPS with %d submitters\n", seconds, tps, count)
+			runLoad(loadgen.Config{
+				Submitters: loadgen.NewSubmitters(count, AppShard),
+				Targets:    []loadgen.Target{loadgen.StackTarget(localDlt), loadgen.StackTarget(remoteDlt)},
+				Setup: func(s int) [][]byte {
+					return [][]byte{makeResourceCreationPayload(fmt.Sprintf("%s-%d-src", prefix, s), 1<<40),
+						makeResourceCreationPayload(fmt.Sprintf("%s-%d-dst", prefix, s), 0)}
+				},
+				Mix:      mix,
+				TPS:      float64(tps),
+				Duration: time.Duration(seconds) * time.Second,
+			})
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "sign",
+		Usage:       "usage: sign <base64 encoded payload>",
+		Description: "submit a payload to sign using CLI's submitter keys",
+		Run: func(args *cli.Args) error {
+			var payload string
+			if args.Scan() {
+				payload = args.Text()
+			}
+			if len(payload) != 0 {
+				if bytes, err := base64.StdEncoding.DecodeString(payload); err != nil {
+					fmt.Printf("Invalid base64 payload: %s\n", err)
+				} else {
+					// sign payload using CLI's submitter
+					fmt.Printf("Submitter Id: %x\nLastTx: %x\nSequence: %d\nShard Id: %x\n", submitter.Id, submitter.LastTx, submitter.Seq, submitter.ShardId)
+					// print the base64 encoded signature
+					fmt.Printf("Signature: %s\n", base64.StdEncoding.EncodeToString(submitter.NewRequest(string(bytes)).Signature))
+				}
+			} else {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "double",
+		Usage:       "usage: double <owned counter name> <xfer value> <recipient 1 counter> <recipient 2 countr>",
+		Description: "submit two double spending transactions on local node",
+		Run: func(args *cli.Args) error {
+			arg := ArgsXferValue{}
+			if args.Scan() {
+				arg.Source = args.Text()
+			}
+			if args.Scan() {
+				value, _ := strconv.Atoi(args.Text())
+				arg.Value = int64(value)
+			}
+			var dest1, dest2 string
+			if args.Scan() {
+				dest1 = args.Text()
+			}
+			if args.Scan() {
+				dest2 = args.Text()
+			}
+			if len(arg.Source) != 0 && len(dest1) != 0 && len(dest2) != 0 && arg.Value > 0 {
+				// save original submitter state
+				oldLastTx := submitter.LastTx
+				oldLastSeq := submitter.Seq
+				arg.Destination = dest1
+				fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				submitTx(dlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
+				// save new submitter state
+				newLastTx := submitter.LastTx
+				newLastSeq := submitter.Seq
+				// switch submitter to old state to create double spending request
+				submitter.LastTx = oldLastTx
+				submitter.Seq = oldLastSeq
+				arg.Destination = dest2
+				fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				newReq := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
+				// revert submitter back to state it was after last submission
+				submitter.LastTx = newLastTx
+				submitter.Seq = newLastSeq
+				// submit new double spending request with same DLT stack
+				submitTx(dlt, newReq)
+			} else {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "multi",
+		Usage:       "usage: multi <owned resource name> <xfer value> <recipient resource name>",
+		Description: "submit a redundant transactions on two different nodes",
+		Run: func(args *cli.Args) error {
+			arg := ArgsXferValue{}
+			if args.Scan() {
+				arg.Source = args.Text()
+			}
+			if args.Scan() {
+				value, _ := strconv.Atoi(args.Text())
+				arg.Value = int64(value)
+			}
+			if args.Scan() {
+				arg.Destination = args.Text()
+			}
+			if len(arg.Source) != 0 && len(arg.Destination) != 0 && arg.Value > 0 {
+				// create instance of request
+				req := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
+				// submit request with local DLT stack
+				fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				submitTx(localDlt, req)
+				fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				// submit same request with remote DLT stack
+				submitTx(remoteDlt, req)
+			} else {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+	shell.Register(cli.Command{
+		Name:        "split",
+		Usage:       "usage: split <owned resource name> <xfer value> <recipient 1> <recipient 2>",
+		Description: "submit two double spending transactions on two different nodes",
+		Run: func(args *cli.Args) error {
+			arg := ArgsXferValue{}
+			if args.Scan() {
+				arg.Source = args.Text()
+			}
+			if args.Scan() {
+				value, _ := strconv.Atoi(args.Text())
+				arg.Value = int64(value)
+			}
+			var dest1, dest2 string
+			if args.Scan() {
+				dest1 = args.Text()
+			}
+			if args.Scan() {
+				dest2 = args.Text()
+			}
+			if len(arg.Source) != 0 && len(dest1) != 0 && len(dest2) != 0 && arg.Value > 0 {
+				// save original submitter state
+				oldLastTx := submitter.LastTx
+				oldLastSeq := submitter.Seq
+				arg.Destination = dest1
+				// submit original request with local DLT stack
+				fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				submitTx(localDlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
+				// save new submitter state
+				newLastTx := submitter.LastTx
+				newLastSeq := submitter.Seq
+				// switch submitter to old state to create double spending request
+				submitter.LastTx = oldLastTx
+				submitter.Seq = oldLastSeq
+				arg.Destination = dest2
+				fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
+				newReq := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
+				// revert submitter back to state it was after last submission
+				submitter.LastTx = newLastTx
+				submitter.Seq = newLastSeq
+				// submit new double spending request with remote DLT stack
+				submitTx(remoteDlt, newReq)
+			} else {
+				return cli.ErrUsage
+			}
+			return nil
+		},
+	})
+}
+
 // main CLI loop
-func cli(local, remote stack.DLT) error {
+func runCli(local, remote stack.DLT, scenarioFiles []string) error {
 	dlt, remoteDlt, localDlt = local, remote, local
 
 	if err := localDlt.Start(); err != nil {
@@ -303,335 +948,55 @@ func cli(local, remote stack.DLT) error {
 	} else if err := remoteDlt.Register(AppShard, AppName, txHandler); err != nil {
 		return err
 	}
-	for {
-		fmt.Printf(cmdPrompt)
-		lineScanner := bufio.NewScanner(os.Stdin)
-		for lineScanner.Scan() {
-			line := lineScanner.Text()
-			if len(line) != 0 {
-				wordScanner := bufio.NewScanner(strings.NewReader(line))
-				wordScanner.Split(bufio.ScanWords)
-				for wordScanner.Scan() {
-					cmd := wordScanner.Text()
-					switch cmd {
-					case "quit":
-						fallthrough
-					case "q":
-						dlt.Stop()
-						return nil
-					case "value":
-						fallthrough
-					case "show":
-						fallthrough
-					case "v":
-						hasNext := wordScanner.Scan()
-						oneDone := false
-						for hasNext {
-							key := wordScanner.Text()
-							if len(key) != 0 {
-								if oneDone {
-									fmt.Printf("\n")
-								} else {
-									oneDone = true
-								}
-								// get current network counter value from world state
-								_, locVal, locErr := getResource(localDlt, key)
-								_, remVal, remErr := getResource(remoteDlt, key)
-								if locErr == nil && remErr == nil {
-									fmt.Printf("[% 10s]: LOCAL: %d | REMOT: %d", key, locVal, remVal)
-								} else if locErr != nil && remErr == nil {
-									fmt.Printf("[% 10s]: LOCAL: %s | REMOT: %d", key, locErr, remVal)
-								} else if locErr == nil && remErr != nil {
-									fmt.Printf("[% 10s]: LOCAL: %d | REMOT: %s", key, locVal, remErr)
-								} else {
-									fmt.Printf("% 10s: LOCAL: %s | REMOT: %s", key, locErr, remErr)
-								}
-							}
-							hasNext = wordScanner.Scan()
-						}
-						if !oneDone {
-							fmt.Printf("%s\n", commands["show"][1])
-							fmt.Printf("%s\n", commands["show"][0])
-						}
-					case "create":
-						fallthrough
-					case "c":
-						args := scanCreateArgs(wordScanner)
-						if len(args) == 0 {
-							fmt.Printf("%s\n", commands["create"][1])
-							fmt.Printf("%s\n", commands["create"][0])
-						} else {
-							for _, arg := range args {
-								fmt.Printf("adding transaction: create %s %d\n", arg.Name, arg.Value)
-								submitTx(dlt, submitter.NewRequest(string(makeResourceCreationPayload(arg.Name, arg.Value))))
-							}
-						}
-					case "bulk_create":
-						args := scanCreateArgs(wordScanner)
-						if len(args) == 0 {
-							fmt.Printf("%s\n", commands["bulk_create"][1])
-							fmt.Printf("%s\n", commands["bulk_create"][0])
-						} else {
-							for _, arg := range args {
-								fmt.Printf("bulk createing %d tokens with %s prefix\n", arg.Value, arg.Name)
-								use := localDlt
-								failCount := 0
-								for i := int64(1); i <= arg.Value; {
-									name := fmt.Sprintf("%s-%04d", arg.Name, i)
-									value := rand.Int63n(100)
-									// we do not want to alternate between nodes because of high velocity
-									// transactions, in practice this would be throtttled by rate limiting
-									// transactions from a single submitter
-									//									if i%2 == 0 {
-									//										use = remoteDlt
-									//									} else {
-									//										use = localDlt
-									//									}
-									if submitTx(use, submitter.NewRequest(string(makeResourceCreationPayload(name, value)))) {
-										i += 1
-										failCount = 0
-									} else if failCount > 100 {
-										fmt.Printf("aborting after %d failures\n", failCount)
-										break
-									} else {
-										failCount += 1
-									}
-								}
-							}
-						}
-					case "info":
-						for wordScanner.Scan() {
-							continue
-						}
-						if a := localDlt.Anchor([]byte("dummy"), 0x01, [64]byte{}); a == nil {
-							fmt.Printf("failed to get any info from local node...\n")
-						} else {
-							fmt.Printf("Submitter Id : %x\n", submitter.Id)
-							fmt.Printf("LOCAL Next Seq: %d\n", a.ShardSeq)
-							fmt.Printf("LOCAL Weight: %d\n", a.Weight)
-							fmt.Printf("LOCAL Parent: %x\n", a.ShardParent)
-						}
-						if a := remoteDlt.Anchor([]byte("dummy"), 0x01, [64]byte{}); a == nil {
-							fmt.Printf("failed to get any info from remote node...\n")
-						} else {
-							fmt.Printf("REMOT Parent: %x\n", a.ShardParent)
-							fmt.Printf("REMOT Next Seq: %d\n", a.ShardSeq)
-							fmt.Printf("REMOT Weight: %d\n", a.Weight)
-						}
-					case "xfer":
-						arg := ArgsXferValue{}
-						if wordScanner.Scan() {
-							arg.Source = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							value, _ := strconv.Atoi(wordScanner.Text())
-							arg.Value = int64(value)
-						}
-						if wordScanner.Scan() {
-							arg.Destination = wordScanner.Text()
-						}
-						if len(arg.Source) != 0 && len(arg.Destination) != 0 && arg.Value > 0 {
-							fmt.Printf("adding transaction: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							submitTx(dlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
-						} else {
-							fmt.Printf("%s\n", commands["xfer"][1])
-							fmt.Printf("%s\n", commands["xfer"][0])
-						}
-					case "bulk_xfer":
-						var source, dest string
-						var value int
-						if wordScanner.Scan() {
-							source = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							dest = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							value, _ = strconv.Atoi(wordScanner.Text())
-						}
-						if len(source) != 0 && len(dest) != 0 && value > 0 {
-							use := localDlt
-							success := submitTx(use, submitter.NewRequest(string(makeResourceCreationPayload(source, int64(value*10)))))
-							fmt.Printf("creating resource %s with initial value %d: %v\n", source, value*10, success)
-							success = success && submitTx(use, submitter.NewRequest(string(makeResourceCreationPayload(dest, 0))))
-							fmt.Printf("creating resource %s with initial value %d: %v\n", dest, 0, success)
-							if success {
-								fmt.Printf("adding %d transactions to xfer 1 value from %s to %s\n", value, source, dest)
-								failCount := 0
-								for i := 1; i <= value; {
-									if submitTx(dlt, submitter.NewRequest(string(makeXferValuePayload(source, dest, 1)))) {
-										i += 1
-										failCount = 0
-									} else if failCount > 100 {
-										fmt.Printf("aborting after %d failures\n", failCount)
-										break
-									} else {
-										failCount += 1
-									}
-								}
-							} else {
-								fmt.Printf("aborting due to failed resource creation\n")
-							}
-						} else {
-							fmt.Printf("%s\n", commands["bulk_xfer"][1])
-							fmt.Printf("%s\n", commands["bulk_xfer"][0])
-						}
-					case "sign":
-						var payload string
-						if wordScanner.Scan() {
-							payload = wordScanner.Text()
-						}
-						if len(payload) != 0 {
-							if bytes, err := base64.StdEncoding.DecodeString(payload); err != nil {
-								fmt.Printf("Invalid base64 payload: %s\n", err)
-							} else {
-								// sign payload using CLI's submitter
-								fmt.Printf("Submitter Id: %x\nLastTx: %x\nSequence: %d\nShard Id: %x\n", submitter.Id, submitter.LastTx, submitter.Seq, submitter.ShardId)
-								// print the base64 encoded signature
-								fmt.Printf("Signature: %s\n", base64.StdEncoding.EncodeToString(submitter.NewRequest(string(bytes)).Signature))
-							}
-						} else {
-							fmt.Printf("%s\n", commands["sign"][1])
-							fmt.Printf("%s\n", commands["sign"][0])
-						}
-					case "double":
-						arg := ArgsXferValue{}
-						if wordScanner.Scan() {
-							arg.Source = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							value, _ := strconv.Atoi(wordScanner.Text())
-							arg.Value = int64(value)
-						}
-						var dest1, dest2 string
-						if wordScanner.Scan() {
-							dest1 = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							dest2 = wordScanner.Text()
-						}
-						if len(arg.Source) != 0 && len(dest1) != 0 && len(dest2) != 0 && arg.Value > 0 {
-							// save original submitter state
-							oldLastTx := submitter.LastTx
-							oldLastSeq := submitter.Seq
-							arg.Destination = dest1
-							fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							submitTx(dlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
-							// save new submitter state
-							newLastTx := submitter.LastTx
-							newLastSeq := submitter.Seq
-							// switch submitter to old state to create double spending request
-							submitter.LastTx = oldLastTx
-							submitter.Seq = oldLastSeq
-							arg.Destination = dest2
-							fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							newReq := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
-							// revert submitter back to state it was after last submission
-							submitter.LastTx = newLastTx
-							submitter.Seq = newLastSeq
-							// submit new double spending request with same DLT stack
-							submitTx(dlt, newReq)
-						} else {
-							fmt.Printf("%s\n", commands["double"][1])
-							fmt.Printf("%s\n", commands["double"][0])
-						}
-					case "multi":
-						arg := ArgsXferValue{}
-						if wordScanner.Scan() {
-							arg.Source = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							value, _ := strconv.Atoi(wordScanner.Text())
-							arg.Value = int64(value)
-						}
-						if wordScanner.Scan() {
-							arg.Destination = wordScanner.Text()
-						}
-						if len(arg.Source) != 0 && len(arg.Destination) != 0 && arg.Value > 0 {
-							// create instance of request
-							req := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
-							// submit request with local DLT stack
-							fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							submitTx(localDlt, req)
-							fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							// submit same request with remote DLT stack
-							submitTx(remoteDlt, req)
-						} else {
-							fmt.Printf("%s\n", commands["multi"][1])
-							fmt.Printf("%s\n", commands["multi"][0])
-						}
-					case "split":
-						arg := ArgsXferValue{}
-						if wordScanner.Scan() {
-							arg.Source = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							value, _ := strconv.Atoi(wordScanner.Text())
-							arg.Value = int64(value)
-						}
-						var dest1, dest2 string
-						if wordScanner.Scan() {
-							dest1 = wordScanner.Text()
-						}
-						if wordScanner.Scan() {
-							dest2 = wordScanner.Text()
-						}
-						if len(arg.Source) != 0 && len(dest1) != 0 && len(dest2) != 0 && arg.Value > 0 {
-							// save original submitter state
-							oldLastTx := submitter.LastTx
-							oldLastSeq := submitter.Seq
-							arg.Destination = dest1
-							// submit original request with local DLT stack
-							fmt.Printf("adding transaction #1: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							submitTx(localDlt, submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value))))
-							// save new submitter state
-							newLastTx := submitter.LastTx
-							newLastSeq := submitter.Seq
-							// switch submitter to old state to create double spending request
-							submitter.LastTx = oldLastTx
-							submitter.Seq = oldLastSeq
-							arg.Destination = dest2
-							fmt.Printf("adding transaction #2: xfer %s %d %s\n", arg.Source, arg.Value, arg.Destination)
-							newReq := submitter.NewRequest(string(makeXferValuePayload(arg.Source, arg.Destination, arg.Value)))
-							// revert submitter back to state it was after last submission
-							submitter.LastTx = newLastTx
-							submitter.Seq = newLastSeq
-							// submit new double spending request with remote DLT stack
-							submitTx(remoteDlt, newReq)
-						} else {
-							fmt.Printf("%s\n", commands["split"][1])
-							fmt.Printf("%s\n", commands["split"][0])
-						}
-					default:
-						fmt.Printf("Unknown Command: %s", cmd)
-						for wordScanner.Scan() {
-							fmt.Printf(" %s", wordScanner.Text())
-						}
-						fmt.Printf("\n\nAccepted commands...\n")
-						isFirst := true
-						for k, _ := range commands {
-							if !isFirst {
-								fmt.Printf(", ")
-							} else {
-								isFirst = false
-							}
-							fmt.Printf("\"%s\"", k)
-						}
-						fmt.Printf("\n")
-						break
-					}
-				}
-			}
-			fmt.Printf("\n%s", cmdPrompt)
+	localDlt.Subscribe(recordEvent)
+	if len(scenarioFiles) > 0 {
+		// run scenarios headlessly and shutdown
+		passed := runScenarios(scenarioFiles)
+		localDlt.Stop()
+		remoteDlt.Stop()
+		if !passed {
+			return fmt.Errorf("scenarios failed")
 		}
+		return nil
 	}
-	return nil
+	registerCommands()
+	return shell.Run()
 }
 
 func main() {
 	fileName := flag.String("config", "", "config file name")
 	apiPort := flag.Int("apiPort", 0, "port for client API")
+	apiCert := flag.String("apiCert", "", "certificate file for serving client API over HTTPS")
+	apiKey := flag.String("apiKey", "", "private key file for serving client API over HTTPS")
+	apiClientCA := flag.String("apiClientCA", "", "CA file to require client certificates for client API")
+	apiKeysFile := flag.String("apiKeys", "", "JSON file with API keys required for client API")
+	scenarios := flag.String("scenarios", "", "comma separated scenario files to run headlessly, instead of CLI")
+	backendListen := flag.String("backendListen", "", "internal address to serve local stack to client API front-ends")
+	backendAddr := flag.String("backend", "", "run as a stateless client API front-end of the stack process at address")
+	grpcListen := flag.String("grpcListen", "", "address to serve gRPC client API on, alongside REST client API")
 	flag.Parse()
+	tlsConf := api.TLSConfig{
+		CertFile:          *apiCert,
+		KeyFile:           *apiKey,
+		ClientCAFile:      *apiClientCA,
+		RequireClientCert: len(*apiClientCA) > 0,
+	}
+
+	// load API keys, if client API requires authentication
+	var apiKeys []api.ApiKey
+	var err error
+	if len(*apiKeysFile) > 0 {
+		if apiKeys, err = api.LoadApiKeys(*apiKeysFile); err != nil {
+			fmt.Printf("Failed to load API keys: %s\n", err)
+			return
+		}
+	}
+
+	// a front-end runs no stack, and serves client API until it fails
+	if len(*backendAddr) > 0 {
+		fmt.Printf("Client API front-end stopped: %s\n", RunFrontEnd(*apiPort, tlsConf, apiKeys, *backendAddr))
+		return
+	}
 	if len(*fileName) == 0 {
 		fmt.Printf("Missing required parameter \"config\"\n")
 		return
@@ -665,12 +1030,8 @@ func main() {
 	port, _ := strconv.Atoi(config.Port)
 	config2.Port = strconv.Itoa(port + 100)
 
-	// create a new submitter
-	submitter = dto.TestSubmitter()
-	submitter.ShardId = AppShard
-
 	// start net server
-	if err := StartServer(*apiPort); err != nil {
+	if err := StartServer(*apiPort, tlsConf, apiKeys); err != nil {
 		fmt.Printf("Did not start client API: %s\n", err)
 	}
 
@@ -679,12 +1040,27 @@ func main() {
 	dbpRemote, _ := dbp.NewDbp("spendr-remote")
 //	dbpLocal := db.NewInMemDbProvider()
 //	dbpRemote := db.NewInMemDbProvider()
-	if localDlt, err := stack.NewDltStack(config, dbpLocal); err != nil {
+	// load CLI's submitter from local storage, or create a new submitter
+	if submitter, err = loadSubmitter(dbpLocal); err != nil {
+		fmt.Printf("Failed to load submitter: %s\n", err)
+		return
+	}
+	// read access to local stack's transaction history and DAG for client API
+	localDb, _ = repo.NewDltDb(dbpLocal)
+	signingChallenges = api.NewSigningChallenges(localDb)
+	registerTemplates()
+	// crash dumps are written into stacks' data directories
+	if localDlt, err := stack.NewDltStack(stack.WithConfig(config), stack.WithStorage(dbpLocal), stack.WithCrashDumps("spendr-local")); err != nil {
 		fmt.Printf("Failed to create 1st DLT stack: %s", err)
-	} else if remoteDlt, err := stack.NewDltStack(config2, dbpRemote); err != nil {
+	} else if remoteDlt, err := stack.NewDltStack(stack.WithConfig(config2), stack.WithStorage(dbpRemote), stack.WithCrashDumps("spendr-remote")); err != nil {
 		fmt.Printf("Failed to create 2nd DLT stack: %s", err)
-	} else if err = cli(localDlt, remoteDlt); err != nil {
-		fmt.Printf("Error in CLI: %s", err)
+	} else if err = startBackend(*backendListen, localDlt); err != nil {
+		fmt.Printf("Failed to serve client API front-ends: %s\n", err)
+	} else if err = startGrpc(*grpcListen, localDlt, tlsConf, apiKeys); err != nil {
+		fmt.Printf("Failed to serve gRPC client API: %s\n", err)
+	} else if err = runCli(localDlt, remoteDlt, scenarioFiles(*scenarios)); err != nil {
+		fmt.Printf("Error in CLI: %s\n", err)
+		os.Exit(1)
 	} else {
 		fmt.Printf("Shutdown cleanly")
 	}
@@ -0,0 +1,19 @@
+// Copyright 2019 The trust-net Authors
+//go:build go1.24
+// +build go1.24
+
+// gRPC client API of spendr application
+package main
+
+import (
+	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/stack"
+)
+
+// serve gRPC client API of a stack on an address, if specified
+func startGrpc(addr string, dlt stack.DLT, tlsConf api.TLSConfig, apiKeys []api.ApiKey) error {
+	if len(addr) == 0 {
+		return nil
+	}
+	return api.NewGrpcServer(dlt, api.GrpcConfig{TLS: tlsConf, ApiKeys: apiKeys}).Start(addr)
+}
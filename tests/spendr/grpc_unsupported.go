@@ -0,0 +1,19 @@
+// Copyright 2019 The trust-net Authors
+//go:build !go1.24
+// +build !go1.24
+
+// gRPC client API of spendr application (requires go1.24 or later)
+package main
+
+import (
+	"fmt"
+	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/stack"
+)
+
+func startGrpc(addr string, dlt stack.DLT, tlsConf api.TLSConfig, apiKeys []api.ApiKey) error {
+	if len(addr) == 0 {
+		return nil
+	}
+	return fmt.Errorf("gRPC client API requires go1.24 or later")
+}
@@ -4,22 +4,67 @@ package main
 
 import (
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
 	"github.com/trust-net/dag-lib-go/api"
+	"github.com/trust-net/dag-lib-go/common"
 	"github.com/trust-net/dag-lib-go/log"
+	"github.com/trust-net/dag-lib-go/stack"
+	"github.com/trust-net/dag-lib-go/stack/dto"
 	"net/http"
+	"os"
 	"strconv"
 )
 
 var logger = log.NewLogger("Client API")
 
+// anchor endpoints for app's shard
+var anchors = api.NewAnchorHandler(appAnchors{}, AppShard)
+
+// anchor source over app's DLT stack, resolved on each request since API server is started before the stack
+type appAnchors struct{}
+
+func (appAnchors) Anchor(id []byte, seq uint64, lastTx [64]byte) *dto.Anchor {
+	return doGetAnchor(id, seq, lastTx)
+}
+
+func (appAnchors) Watch(shardId []byte, handler func(tx dto.Transaction)) (uint64, error) {
+	return dlt.Watch(shardId, handler)
+}
+
+func (appAnchors) Unwatch(id uint64) {
+	dlt.Unwatch(id)
+}
+
+// transaction submission endpoint for app's shard
+var transactions = api.NewTransactionHandler(appSubmitter{}, anchors)
+
+// submitter over app's DLT stack (or stack process of a front-end), resolved on each request
+type appSubmitter struct{}
+
+func (appSubmitter) SubmitWithTrace(req *dto.TxRequest, traceId string) (dto.Transaction, error) {
+	return doSubmitTransaction(req, traceId)
+}
+
+func (appSubmitter) SubmitAnchored(req *dto.TxRequest, anchor *dto.Anchor, traceId string) (dto.Transaction, error) {
+	return backend().SubmitAnchored(req, anchor, traceId)
+}
+
+// transaction templates of spendr application's operations
+var templates = api.NewTemplates()
+
+// signing challenges for remote signing clients (initialized once local DB is open)
+var signingChallenges *api.SigningChallenges
+
 // A world state resource for spendr application
 type Resource struct {
 	Key   string `json:"key,omitempty"`
 	Owner string `json:"owner,omitempty"`
 	Value uint64 `json:"value"`
+	// shard sequence that value is as of, for historical queries
+	At uint64 `json:"at,omitempty"`
 }
 
 // response to successful submission of a transaction
@@ -52,46 +97,375 @@ func getResourceByKey(w http.ResponseWriter, r *http.Request) {
 	// fetch request params
 	params := mux.Vars(r)
 	logger.Debug("Recieved GET /resources/%s from: %s", params["key"], r.RemoteAddr)
+	req, err := api.ParseStateRequest(r, params["key"])
+	if err != nil {
+		api.WriteBadRequest(w, err)
+		return
+	}
 	// set headers
 	setHeaders(w)
-	// fetch resource from spendr app
-	owner, value, err := doGetResource(params["key"])
+	// fetch resource from spendr app, as of requested shard sequence if specified
+	var owner []byte
+	var value uint64
+	if req.AtSeq {
+		owner, value, err = doGetResourceAt(req.Key, req.At)
+	} else {
+		owner, value, err = doGetResource(req.Key)
+	}
 	if err != nil {
-		logger.Debug("did not get %s: %s", params["key"], err)
+		logger.Debug("did not get %s: %s", req.Key, err)
 		w.WriteHeader(404)
 		json.NewEncoder(w).Encode(err.Error())
 	} else {
 		json.NewEncoder(w).Encode(Resource{
-			Key:   params["key"],
+			Key:   req.Key,
 			Owner: fmt.Sprintf("%x", owner),
 			Value: value,
+			At:    req.At,
 		})
 	}
 }
 
-func submitTransaction(w http.ResponseWriter, r *http.Request) {
-	logger.Debug("Recieved POST /transactions from: %s", r.RemoteAddr)
+func waitForTransaction(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /transactions/{id}/wait from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	// parse request params
+	req, err := api.ParseWaitRequest(r, mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteBadRequest(w, err)
+		return
+	}
+	// block until transaction meets criteria, or timeout
+	if res, err := doWaitForTransaction(req.TxId, req.Criteria, req.Timeout); err == stack.ErrWaitTimeout {
+		w.WriteHeader(http.StatusRequestTimeout)
+		json.NewEncoder(w).Encode(err.Error())
+	} else if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(err.Error())
+	} else {
+		json.NewEncoder(w).Encode(api.NewWaitResponse(req.TxId, res))
+	}
+}
+
+func getTxLabels(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /transactions/{id}/labels from: %s", r.RemoteAddr)
+	setHeaders(w)
+	txId, err := hex.DecodeString(mux.Vars(r)["id"])
+	if err != nil || len(txId) != 64 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid transaction id")
+		return
+	}
+	id := [64]byte{}
+	copy(id[:], txId)
+	json.NewEncoder(w).Encode(api.NewTxLabels(id, dlt.TxLabels(id)))
+}
+
+func setTxLabels(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved PUT /transactions/{id}/labels from: %s", r.RemoteAddr)
+	setHeaders(w)
+	req, err := api.ParseLabelsRequest(r, mux.Vars(r)["id"])
+	if err != nil {
+		api.WriteBadRequest(w, err)
+		return
+	}
+	if err := dlt.LabelTx(req.TxId(), req.Labels, req.Note); err == stack.ErrTxNotFound {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(err.Error())
+	} else if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+	} else {
+		json.NewEncoder(w).Encode(api.NewTxLabels(req.TxId(), dlt.TxLabels(req.TxId())))
+	}
+}
+
+func getNodeInfo(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /node from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	if info := doGetNodeInfo(); info == nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode("node info not available")
+	} else {
+		json.NewEncoder(w).Encode(api.NewNodeInfoResponse(info))
+	}
+}
+
+func requestSigningChallenge(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved POST /signing/challenge from: %s", r.RemoteAddr)
 	// set headers
 	setHeaders(w)
 	// parse request body
-	req, err := api.ParseSubmitRequest(r)
+	req, err := api.ParseSigningChallengeRequest(r)
 	if err != nil {
 		logger.Debug("Failed to decode request body: %s", err)
-		w.WriteHeader(400)
+		api.WriteBadRequest(w, err)
+		return
+	}
+	if err := api.Authorize(r, req.Submitter(), req.Shard()); err != nil {
+		api.WriteForbidden(w, err)
+		return
+	}
+	if res, err := signingChallenges.Issue(req); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(err.Error())
+	} else {
+		json.NewEncoder(w).Encode(res)
+	}
+}
+
+func completeSigningChallenge(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved POST /signing/complete from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	// parse request body
+	req, err := api.ParseSigningCompleteRequest(r)
+	if err != nil {
+		logger.Debug("Failed to decode request body: %s", err)
+		api.WriteBadRequest(w, err)
 		return
 	}
-	// submit transaction to app
-	if tx, err := doSubmitTransaction(req.DltRequest()); err != nil {
-		logger.Debug("Failed to submit transaction: %s", err)
+	txReq, err := signingChallenges.Complete(req)
+	if err != nil {
+		w.WriteHeader(http.StatusNotAcceptable)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	if err := api.Authorize(r, txReq.SubmitterId, txReq.ShardId); err != nil {
+		api.WriteForbidden(w, err)
+		return
+	}
+	// submit assembled transaction to app
+	if tx, err := doSubmitTransaction(txReq, req.TraceId); err != nil {
+		logger.Debug("[trace %s] Failed to submit transaction: %s", req.TraceId, err)
 		w.WriteHeader(http.StatusNotAcceptable)
 		json.NewEncoder(w).Encode(err.Error())
 	} else {
-		// respond back with transaction submission result
 		json.NewEncoder(w).Encode(api.NewSubmitResponse(tx))
 	}
 }
 
+func getSyncStatus(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /sync from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	// respond back with sync progress of each shard
+	json.NewEncoder(w).Encode(api.NewSyncStatusResponse(doGetSyncStatus()))
+}
+
+func serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved %s /graphql from: %s", r.Method, r.RemoteAddr)
+	api.NewGraphQLHandler(dlt, localDb).ServeHTTP(w, r)
+}
+
+func listShards(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /shards from: %s", r.RemoteAddr)
+	items := []interface{}{}
+	for _, shardId := range doGetShards() {
+		items = append(items, api.NewShard(shardId, dlt.ShardStats(shardId)))
+	}
+	api.WriteList(w, r, items)
+}
+
+func listAbandonedShards(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /shards/abandoned from: %s", r.RemoteAddr)
+	items := []interface{}{}
+	for _, info := range dlt.AbandonedShards() {
+		items = append(items, api.NewAbandonedShard(info))
+	}
+	api.WriteList(w, r, items)
+}
+
+// archive an abandoned shard into a local file, and delete it from node
+func getShardStats(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved GET /shards/%s/stats from: %s", params["id"], r.RemoteAddr)
+	setHeaders(w)
+	shardId, err := hex.DecodeString(params["id"])
+	if err != nil || len(shardId) == 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid shard id")
+		return
+	}
+	json.NewEncoder(w).Encode(api.NewShardStats(shardId, dlt.ShardStats(shardId)))
+}
+
+func collectShard(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved POST /shards/%s/collect from: %s", params["id"], r.RemoteAddr)
+	setHeaders(w)
+	shardId, err := hex.DecodeString(params["id"])
+	if err != nil || len(shardId) == 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid shard id")
+		return
+	}
+	if err := api.Authorize(r, nil, shardId); err != nil {
+		api.WriteForbidden(w, err)
+		return
+	}
+	archive := fmt.Sprintf("shard-%x.archive", shardId)
+	file, err := os.Create(archive)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	err = dlt.CollectShard(shardId, file)
+	file.Close()
+	if err != nil {
+		os.Remove(archive)
+		w.WriteHeader(409)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"archive": archive})
+}
+
+func listTransactions(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /transactions from: %s", r.RemoteAddr)
+	shardId := AppShard
+	if value := r.URL.Query().Get("shard_id"); len(value) > 0 {
+		shardId, _ = hex.DecodeString(value)
+	}
+	var txs []dto.Transaction
+	var err error
+	if label := r.URL.Query().Get("label"); len(label) > 0 {
+		txs = dlt.LabeledTxs(label, shardId)
+	} else {
+		txs, err = doGetShardLog(shardId)
+	}
+	if err != nil {
+		setHeaders(w)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	items := []interface{}{}
+	for _, tx := range txs {
+		items = append(items, api.NewTransaction(tx))
+	}
+	api.WriteList(w, r, items)
+}
+
+func listSubmitterHistory(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved GET /submitters/%s/history from: %s", params["id"], r.RemoteAddr)
+	submitterId, err := hex.DecodeString(params["id"])
+	if err != nil || len(submitterId) == 0 {
+		setHeaders(w)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid submitter id")
+		return
+	}
+	items := []interface{}{}
+	for _, h := range doGetSubmitterHistory(submitterId) {
+		items = append(items, api.NewSubmitterHistory(h))
+	}
+	api.WriteList(w, r, items)
+}
+
+func listOwnedResources(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved GET /owners/%s/resources from: %s", params["id"], r.RemoteAddr)
+	owner, err := hex.DecodeString(params["id"])
+	if err != nil || len(owner) == 0 {
+		setHeaders(w)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid owner id")
+		return
+	}
+	resources, err := doListByOwner(owner)
+	if err != nil {
+		setHeaders(w)
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	items := []interface{}{}
+	for _, r := range resources {
+		items = append(items, &Resource{
+			Key:   string(r.Key),
+			Owner: fmt.Sprintf("%x", r.Owner),
+			Value: common.BytesToUint64(r.Value),
+		})
+	}
+	api.WriteList(w, r, items)
+}
+
+func getSubmitterProof(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved GET /submitters/%s/proof from: %s", params["id"], r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	submitterId, err := hex.DecodeString(params["id"])
+	if err != nil || len(submitterId) == 0 {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid submitter id")
+		return
+	}
+	if proof, err := doGetSubmitterProof(submitterId); err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+	} else {
+		json.NewEncoder(w).Encode(api.NewSubmitterProofResponse(proof))
+	}
+}
+
+func getSubmitterReport(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	logger.Debug("Recieved GET /submitters/%s/report from: %s", params["id"], r.RemoteAddr)
+	submitterId, err := hex.DecodeString(params["id"])
+	if err != nil || len(submitterId) == 0 {
+		setHeaders(w)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid submitter id")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if len(format) > 0 && format != "json" && format != "csv" {
+		setHeaders(w)
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("format must be json or csv")
+		return
+	}
+	report, err := doGetSubmitterReport(submitterId)
+	if err != nil {
+		setHeaders(w)
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(err.Error())
+		return
+	}
+	if format == "csv" {
+		w.Header().Set("content-type", "text/csv")
+		w.Header().Set("content-disposition", fmt.Sprintf("attachment; filename=submitter-%x.csv", submitterId))
+		report.WriteCSV(w)
+	} else {
+		setHeaders(w)
+		report.WriteJSON(w)
+	}
+}
+
+func listEvents(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /events from: %s", r.RemoteAddr)
+	items := []interface{}{}
+	for _, e := range doGetEvents() {
+		items = append(items, api.NewEvent(e))
+	}
+	api.WriteList(w, r, items)
+}
+
+func listForensics(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /forensics from: %s", r.RemoteAddr)
+	items := []interface{}{}
+	for _, record := range doGetForensics() {
+		items = append(items, api.NewForensicRecord(&record))
+	}
+	api.WriteList(w, r, items)
+}
+
 func requestResourceCreationPayload(w http.ResponseWriter, r *http.Request) {
 	logger.Debug("Recieved POST /opcode/create from: %s", r.RemoteAddr)
 	// set headers
@@ -130,7 +504,63 @@ func requestXferValuePayload(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func StartServer(listenPort int) error {
+func listOps(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved GET /shards/{id}/ops from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	shardId, err := hex.DecodeString(mux.Vars(r)["id"])
+	if err != nil {
+		w.WriteHeader(400)
+		json.NewEncoder(w).Encode("invalid shard id")
+		return
+	}
+	json.NewEncoder(w).Encode(templates.List(shardId))
+}
+
+func requestOp(w http.ResponseWriter, r *http.Request) {
+	logger.Debug("Recieved POST /shards/{id}/ops/{name} from: %s", r.RemoteAddr)
+	// set headers
+	setHeaders(w)
+	params := mux.Vars(r)
+	shardId, _ := hex.DecodeString(params["id"])
+	tmpl := templates.Get(shardId, params["name"])
+	if tmpl == nil {
+		w.WriteHeader(404)
+		json.NewEncoder(w).Encode("unknown operation: " + params["name"])
+		return
+	}
+	// parse and validate arguments as per template's schema
+	req, err := api.ParseOpRequest(r, tmpl)
+	if err != nil {
+		logger.Debug("Failed to decode request body: %s", err)
+		api.WriteBadRequest(w, err)
+		return
+	}
+	payload, err := tmpl.Payload(req)
+	if err != nil {
+		api.WriteBadRequest(w, err)
+		return
+	}
+	res := &api.OpResponse{
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Description: tmpl.Description,
+	}
+	// issue a signing challenge for the payload, if submitter was specified
+	if req.Submitter() != nil {
+		if err := api.Authorize(r, req.Submitter(), shardId); err != nil {
+			api.WriteForbidden(w, err)
+			return
+		}
+		if res.Challenge, err = signingChallenges.Issue(api.NewSigningChallengeRequest(req.Submitter(), shardId, payload)); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(err.Error())
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+func StartServer(listenPort int, tlsConf api.TLSConfig, apiKeys []api.ApiKey) error {
 	// if not a valid port, do not start
 	if listenPort < 1024 {
 		return fmt.Errorf("Invalid port: %d", listenPort)
@@ -139,11 +569,73 @@ func StartServer(listenPort int) error {
 	router := mux.NewRouter()
 	router.HandleFunc("/foo", getFoo).Methods("GET")
 	router.HandleFunc("/resources/{key}", getResourceByKey).Methods("GET")
-	router.HandleFunc("/transactions", submitTransaction).Methods("POST")
+	router.HandleFunc("/transactions", transactions.Submit).Methods("POST")
+	router.HandleFunc("/transactions", listTransactions).Methods("GET")
+	router.HandleFunc("/transactions/{id}/wait", waitForTransaction).Methods("GET")
+	router.HandleFunc("/transactions/{id}/labels", getTxLabels).Methods("GET")
+	router.HandleFunc("/transactions/{id}/labels", setTxLabels).Methods("PUT")
+	router.HandleFunc("/shards", listShards).Methods("GET")
+	router.HandleFunc("/shards/abandoned", listAbandonedShards).Methods("GET")
+	router.HandleFunc("/shards/{id}/stats", getShardStats).Methods("GET")
+	router.HandleFunc("/shards/{id}/collect", collectShard).Methods("POST")
+	router.HandleFunc("/shards/{id}/ops", listOps).Methods("GET")
+	router.HandleFunc("/shards/{id}/ops/{name}", requestOp).Methods("POST")
+	router.HandleFunc("/submitters/{id}/history", listSubmitterHistory).Methods("GET")
+	router.HandleFunc("/submitters/{id}/proof", getSubmitterProof).Methods("GET")
+	router.HandleFunc("/submitters/{id}/report", getSubmitterReport).Methods("GET")
+	router.HandleFunc("/owners/{id}/resources", listOwnedResources).Methods("GET")
+	router.HandleFunc("/events", listEvents).Methods("GET")
+	router.HandleFunc("/forensics", listForensics).Methods("GET")
+	router.HandleFunc("/anchors", anchors.Issue).Methods("POST")
+	router.HandleFunc("/anchors/batch", anchors.IssueBatch).Methods("POST")
+	router.HandleFunc("/anchors/stream", anchors.Stream).Methods("GET")
+	router.HandleFunc("/signing/challenge", requestSigningChallenge).Methods("POST")
+	router.HandleFunc("/signing/complete", completeSigningChallenge).Methods("POST")
+	router.HandleFunc("/sync", getSyncStatus).Methods("GET")
+	router.HandleFunc("/node", getNodeInfo).Methods("GET")
+	router.HandleFunc("/graphql", serveGraphQL).Methods("GET", "POST")
 	router.HandleFunc("/opcode/create", requestResourceCreationPayload).Methods("POST")
 	router.HandleFunc("/opcode/xfer", requestXferValuePayload).Methods("POST")
+	server := newServer(router, tlsConf, apiKeys)
 	go func() {
-		logger.Error("End of server: %s", http.ListenAndServe(":"+strconv.Itoa(listenPort), router))
+		logger.Error("End of server: %s", server.ListenAndServe(":"+strconv.Itoa(listenPort)))
 	}()
 	return nil
 }
+
+func newServer(router *mux.Router, tlsConf api.TLSConfig, apiKeys []api.ApiKey) *api.Server {
+	// allow browser based clients from any origin
+	return api.NewServer(router, api.ServerConfig{
+		Cors:    api.CorsConfig{AllowedOrigins: []string{"*"}},
+		TLS:     tlsConf,
+		ApiKeys: apiKeys,
+	})
+}
+
+// serve a stack to client API front-ends on an internal address, if specified
+func startBackend(addr string, dlt stack.DLT) error {
+	if len(addr) == 0 {
+		return nil
+	}
+	return api.NewBackendServer(dlt).Start(addr)
+}
+
+// run as a stateless client API front-end of the stack process at backend address, serving the endpoints
+// for submissions and reads of current state through the backend, blocks until server fails
+func RunFrontEnd(listenPort int, tlsConf api.TLSConfig, apiKeys []api.ApiKey, backendAddr string) error {
+	if listenPort < 1024 {
+		return fmt.Errorf("Invalid port: %d", listenPort)
+	}
+	frontEnd = api.NewBackendClient(backendAddr)
+	defer frontEnd.Close()
+
+	router := mux.NewRouter()
+	router.HandleFunc("/foo", getFoo).Methods("GET")
+	router.HandleFunc("/resources/{key}", getResourceByKey).Methods("GET")
+	router.HandleFunc("/transactions", transactions.Submit).Methods("POST")
+	router.HandleFunc("/transactions/{id}/wait", waitForTransaction).Methods("GET")
+	router.HandleFunc("/anchors", anchors.Issue).Methods("POST")
+	router.HandleFunc("/anchors/batch", anchors.IssueBatch).Methods("POST")
+	router.HandleFunc("/node", getNodeInfo).Methods("GET")
+	return newServer(router, tlsConf, apiKeys).ListenAndServe(":" + strconv.Itoa(listenPort))
+}
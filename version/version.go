@@ -0,0 +1,62 @@
+// Copyright 2019 The trust-net Authors
+// Version and feature flags of the library, populated at build time, e.g.:
+//
+//	go build -ldflags "-X github.com/trust-net/dag-lib-go/version.Semver=0.9.0 \
+//		-X github.com/trust-net/dag-lib-go/version.Commit=$(git rev-parse --short HEAD) \
+//		-X github.com/trust-net/dag-lib-go/version.Features=anchor-cache,rlp"
+package version
+
+import (
+	"fmt"
+	"strings"
+)
+
+// semantic version of the build
+var Semver = "0.0.0-dev"
+
+// git commit of the build
+var Commit = "unknown"
+
+// time of the build
+var BuildTime = ""
+
+// comma separated list of features/codecs enabled in the build
+var Features = ""
+
+// version information of a build
+type Info struct {
+	Semver    string
+	Commit    string
+	BuildTime string
+	Features  []string
+}
+
+// version information of current build
+func Get() Info {
+	info := Info{
+		Semver:    Semver,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		Features:  []string{},
+	}
+	for _, feature := range strings.Split(Features, ",") {
+		if feature = strings.TrimSpace(feature); len(feature) > 0 {
+			info.Features = append(info.Features, feature)
+		}
+	}
+	return info
+}
+
+// check whether a feature is enabled in the build
+func (i Info) HasFeature(name string) bool {
+	for _, feature := range i.Features {
+		if feature == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (i Info) String() string {
+	return fmt.Sprintf("%s (commit: %s, features: [%s])", i.Semver, i.Commit, strings.Join(i.Features, ","))
+}
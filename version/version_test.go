@@ -0,0 +1,21 @@
+// Copyright 2019 The trust-net Authors
+package version
+
+import (
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	Semver, Commit, Features = "1.2.3", "abc123", " rlp, anchor-cache ,,"
+	defer func() { Semver, Commit, Features = "0.0.0-dev", "unknown", "" }()
+	info := Get()
+	if info.Semver != "1.2.3" || info.Commit != "abc123" {
+		t.Errorf("incorrect version: %s", info)
+	}
+	if len(info.Features) != 2 || !info.HasFeature("rlp") || !info.HasFeature("anchor-cache") || info.HasFeature("") {
+		t.Errorf("incorrect features: %v", info.Features)
+	}
+	if info.String() != "1.2.3 (commit: abc123, features: [rlp,anchor-cache])" {
+		t.Errorf("incorrect string: %s", info)
+	}
+}